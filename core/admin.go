@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+)
+
+// CacheStats are the counters of the response cache of a remote
+// (table.remote), used to size the cache ttl
+type CacheStats struct {
+	Remote  string `json:"remote"`
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+// SubscriptionStats are the members of a subscription, all the
+// members of a query and role share a single database poller
+type SubscriptionStats struct {
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+	Members int64  `json:"members"`
+}
+
+// CacheStats function returns the counters of the remote response caches
+func (sg *SuperGraph) CacheStats() []CacheStats {
+	var cs []CacheStats
+
+	for _, c := range sg.remoteCaches() {
+		c.cache.Lock()
+		cs = append(cs, CacheStats{
+			Remote:  c.name,
+			Entries: len(c.cache.m),
+			Hits:    c.cache.hits,
+			Misses:  c.cache.misses,
+		})
+		c.cache.Unlock()
+	}
+
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Remote < cs[j].Remote })
+	return cs
+}
+
+// FlushCache function drops all the responses in the remote response caches,
+// the compiled queries and the cached query results
+func (sg *SuperGraph) FlushCache() {
+	if sg.results != nil {
+		if err := sg.results.Flush(context.Background()); err != nil {
+			sg.log.Printf("WRN result cache: %s", err)
+		}
+	}
+
+	for _, c := range sg.remoteCaches() {
+		c.cache.flush()
+	}
+	if sg.compiled != nil {
+		sg.compiled.flush()
+	}
+}
+
+// Subscriptions function returns the active subscriptions
+func (sg *SuperGraph) Subscriptions() []SubscriptionStats {
+	var ss []SubscriptionStats
+
+	sg.subs.Range(func(k, v interface{}) bool {
+		s := v.(*sub)
+		ss = append(ss, SubscriptionStats{
+			Name:    s.name,
+			Role:    s.role,
+			Members: atomic.LoadInt64(&s.members),
+		})
+		return true
+	})
+
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].Name == ss[j].Name {
+			return ss[i].Role < ss[j].Role
+		}
+		return ss[i].Name < ss[j].Name
+	})
+	return ss
+}
+
+// AllowList function returns the allow list the queries are saved to
+// in development or loaded from in production
+func (sg *SuperGraph) AllowList() *AllowList {
+	return &AllowList{al: sg.allowList}
+}
+
+// QueryRegistry function returns the registry of the approved queries
+// or nil when it's not set (query_registry)
+func (sg *SuperGraph) QueryRegistry() *QueryRegistry {
+	return sg.registry
+}
+
+// remoteCaches returns the resolvers with a cache, each resolver is
+// in the map under two keys
+func (sg *SuperGraph) remoteCaches() []resolvFn {
+	var rf []resolvFn
+	seen := make(map[*remoteCache]struct{})
+
+	for _, r := range sg.rmap {
+		if r.cache == nil {
+			continue
+		}
+		if _, ok := seen[r.cache]; ok {
+			continue
+		}
+		seen[r.cache] = struct{}{}
+		rf = append(rf, r)
+	}
+
+	return rf
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dosco/super-graph/core/internal/allow"
+)
+
+// AllowListItem is a query in the allow list with its variables
+// (values cleared) and comment
+type AllowListItem = allow.Item
+
+// AllowList is the allow list file of a config. Queries are saved to it while
+// running in development and only these can run in production (use_allow_list)
+type AllowList struct {
+	al *allow.List
+}
+
+// OpenAllowList function opens the allow list file of the config (allow_list_file)
+// to manage its queries (eg. in CI), the file is created if it does not exist. When
+// the storage is set the list is kept in it instead, the database store needs
+// to be set in code as KVStore
+func OpenAllowList(conf *Config) (*AllowList, error) {
+	ac := allow.Config{CreateIfNotExists: true}
+
+	switch {
+	case conf.KVStore != nil:
+		ac.Store = &kvAllowStore{kv: conf.KVStore}
+
+	case conf.Storage.Type != "" && conf.Storage.Type != "memory":
+		kv, err := newKVStore(conf, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open allow list: %w", err)
+		}
+		ac.Store = &kvAllowStore{kv: kv}
+	}
+
+	al, err := allow.New(conf.AllowListFile, ac)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open allow list: %w", err)
+	}
+
+	return &AllowList{al: al}, nil
+}
+
+// List returns the queries in the allow list
+func (a *AllowList) List() ([]AllowListItem, error) {
+	return a.al.Load()
+}
+
+// Add saves a named query to the allow list, a query with the
+// same name is replaced
+func (a *AllowList) Add(query string, vars json.RawMessage, comment string) error {
+	return a.al.Add(vars, query, comment)
+}
+
+// Remove deletes the named query from the allow list
+func (a *AllowList) Remove(name string) error {
+	return a.al.Remove(name)
+}
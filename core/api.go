@@ -49,16 +49,23 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"hash/maphash"
 	_log "log"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/chirino/graphql"
 	"github.com/dosco/super-graph/core/internal/allow"
 	"github.com/dosco/super-graph/core/internal/crypto"
+	"github.com/dosco/super-graph/core/internal/mock"
 	"github.com/dosco/super-graph/core/internal/psql"
 	"github.com/dosco/super-graph/core/internal/qcode"
+	"github.com/dosco/super-graph/core/internal/util"
+	octrace "go.opencensus.io/trace"
 )
 
 type contextkey int
@@ -73,28 +80,97 @@ const (
 
 	// User role if pre-defined
 	UserRoleKey
+
+	// Variables set from the claims of the user (map[string]interface{}),
+	// these take the place of request variables with the same name. A nil
+	// claim is never set from the request variables
+	UserClaimsKey
+
+	// Locales the translated columns are returned in, a locale (eg. fr-CA)
+	// or an Accept-Language header value. The locale variable of the
+	// request takes its place
+	LocaleKey
+
+	// The api key or tenant the usage of the request is metered for
+	MeterKey
+
+	// Dry run (bool) runs a mutation in a transaction that's rolled back,
+	// the result is what the mutation would have returned
+	DryRunKey
+
+	// Normalize (bool) returns the rows of the tables in the result as
+	// entities keyed by their table and id, the rows in the data are
+	// replaced with references to them (eg. {"__ref": "users:1"})
+	NormalizeKey
+
+	// SQL fragments (*SQLFragments) added to the query as is, only to be
+	// set for trusted callers and never from the request of a user
+	SQLFragmentsKey
 )
 
 // SuperGraph struct is an instance of the Super Graph engine it holds all the required information like
 // datase schemas, relationships, etc that the GraphQL to SQL compiler would need to do it's job.
 type SuperGraph struct {
-	conf        *Config
-	db          *sql.DB
-	log         *_log.Logger
-	dbinfo      *psql.DBInfo
-	schema      *psql.DBSchema
-	allowList   *allow.List
-	encKey      [32]byte
-	hashSeed    maphash.Seed
-	queries     map[string]*cquery
-	roles       map[string]*Role
-	roleStmt    string
-	rmap        map[uint64]resolvFn
-	abacEnabled bool
-	qc          *qcode.Compiler
-	pc          *psql.Compiler
-	ge          *graphql.Engine
-	subs        sync.Map
+	conf         *Config
+	db           *sql.DB
+	router       DBRouter
+	roleDBs      map[string]*sql.DB
+	shadow       *shadow
+	mock         *mock.DB
+	log          *_log.Logger
+	dbinfo       *psql.DBInfo
+	allowList    *allow.List
+	registry     *QueryRegistry
+	compiled     *compileCache
+	tags         map[string]map[string]string
+	outbox       map[string]*outboxEvent
+	outboxStmt   string
+	blobs        BlobStore
+	blobCols     map[string]map[string]struct{}
+	moneyCols    map[string]map[string]*moneyCol
+	coerce       coerceRules
+	apq          PersistedStore
+	kv           KVStore
+	results      ResultStore
+	usage        UsageStore
+	slowSem      chan struct{}
+	slowMu       sync.Mutex
+	planner      *planner
+	counts       countCache
+	events       eventHub
+	resultsMu    sync.Mutex
+	resultsGen   uint64
+	encKey       [32]byte
+	hashSeed     maphash.Seed
+	queries      map[string]*cquery
+	roles        map[string]*Role
+	roleStmt     string
+	sessionVars  []sessionVar
+	sessionStmt  string
+	cacheHints   map[string]*CacheControl
+	formats      map[string]map[string]*formatter
+	fcache       *formatCache
+	computed     map[string]map[string]*ComputedField
+	cachedFields map[string]map[string]*CachedField
+	fieldCaches  map[string]*fieldCache
+	nsTables     map[string]*Namespace
+	attached     map[string]*SuperGraph
+	idgens       map[string]idGen
+	flags        map[string]int
+	lintRules    []LintRule
+	rmap         map[uint64]resolvFn
+	breakers     map[string]*breaker
+	breakersMu   sync.Mutex
+	abacEnabled  bool
+	qc           *qcode.Compiler
+	pc           *psql.Compiler
+	engines      atomic.Value
+	reloadMu     sync.Mutex
+	subs         sync.Map
+
+	// done is closed when the instance is closed to stop its background work
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // NewSuperGraph creates the SuperGraph struct, this involves querying the database to learn its
@@ -115,28 +191,121 @@ func newSuperGraph(conf *Config, db *sql.DB, dbinfo *psql.DBInfo) (*SuperGraph,
 		dbinfo:   dbinfo,
 		log:      _log.New(os.Stdout, "", 0),
 		hashSeed: maphash.MakeSeed(),
+		done:     make(chan struct{}),
 	}
 
 	if err := sg.initConfig(); err != nil {
 		return nil, err
 	}
 
+	if err := sg.initCacheControl(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initFormatters(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initFlags(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initLint(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initCoerce(); err != nil {
+		return nil, err
+	}
+
+	var mt []mock.Table
+	var err error
+
+	if conf.MockData != "" {
+		if mt, err = sg.initMock(); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := sg.initCompilers(); err != nil {
 		return nil, err
 	}
 
+	if conf.MockData != "" {
+		sg.mock = mock.New(mt, sg.pc.Schema(), conf.Vars)
+	}
+
+	if err := sg.initStorage(); err != nil {
+		return nil, err
+	}
+
 	if err := sg.initAllowList(); err != nil {
 		return nil, err
 	}
 
+	if err := sg.initTags(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initOutbox(); err != nil {
+		return nil, err
+	}
+
+	sg.compiled = newCompileCache(conf.CompileCacheSize)
+
+	if err := sg.initPersisted(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initResultCache(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initMetering(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initSlowQuery(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initPlanner(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initSessionVars(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initFieldCaches(); err != nil {
+		return nil, err
+	}
+
 	if err := sg.initResolvers(); err != nil {
 		return nil, err
 	}
 
+	if err := sg.initIDGen(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initBlobs(); err != nil {
+		return nil, err
+	}
+
+	if err := sg.initMoney(); err != nil {
+		return nil, err
+	}
+
 	if err := sg.initGraphQLEgine(); err != nil {
 		return nil, err
 	}
 
+	// only against a real database and not the one of the tests
+	if dbinfo == nil && conf.MockData == "" {
+		sg.checkPrivileges()
+	}
+
 	sg.prepareRoleStmt()
 
 	if conf.SecretKey != "" {
@@ -150,6 +319,13 @@ func newSuperGraph(conf *Config, db *sql.DB, dbinfo *psql.DBInfo) (*SuperGraph,
 	return sg, nil
 }
 
+// Close function stops the background work of the instance (eg. refreshing the
+// cached fields), it's called once an instance is replaced by another. Queries
+// can still be run and subscriptions end when their members leave.
+func (sg *SuperGraph) Close() {
+	sg.closeOnce.Do(func() { close(sg.done) })
+}
+
 // Result struct contains the output of the GraphQL function this includes resulting json from the
 // database query and any error information
 type Result struct {
@@ -157,6 +333,14 @@ type Result struct {
 	name string
 	sql  string
 	role string
+	tags map[string]string
+	fp   string
+
+	// dbTime is the time the sql took to run
+	dbTime time.Duration
+
+	// streamed is set once GraphQLStream starts the response
+	streamed bool
 
 	Error      string          `json:"message,omitempty"`
 	Data       json.RawMessage `json:"data,omitempty"`
@@ -170,6 +354,24 @@ type Result struct {
 // In developer mode all names queries are saved into a file `allow.list` and in production mode only
 // queries from this file can be run.
 func (sg *SuperGraph) GraphQL(c context.Context, query string, vars json.RawMessage) (*Result, error) {
+	query, vars, err := sg.beforeParse(c, query, vars)
+	if err != nil {
+		return &Result{Error: err.Error()}, err
+	}
+
+	if len(sg.attached) != 0 {
+		if res, ok, err := sg.attachedGraphQL(c, query, vars); ok {
+			return res, err
+		}
+	}
+
+	fp := queryFingerprint([]byte(query))
+
+	c, span := startSpan(c, "graphql")
+	defer span.End()
+
+	span.AddAttributes(octrace.StringAttribute("fingerprint", fp))
+
 	ct := scontext{
 		Context: c,
 		sg:      sg,
@@ -180,16 +382,52 @@ func (sg *SuperGraph) GraphQL(c context.Context, query string, vars json.RawMess
 	res := &Result{
 		op:   ct.op,
 		name: ct.name,
+		tags: sg.queryTags(ct.name),
+		fp:   fp,
+	}
+
+	// the budget covers running the query, its remote
+	// joins and encoding the result
+	if ct.budget = sg.newBudget(); ct.budget != nil && sg.conf.Budget.MaxTime != 0 {
+		var cancel context.CancelFunc
+		ct.Context, cancel = context.WithTimeout(ct.Context, sg.conf.Budget.MaxTime)
+		defer cancel()
 	}
 
+	span.AddAttributes(
+		octrace.StringAttribute("operation", res.OperationName()),
+		octrace.StringAttribute("query_name", res.QueryName()))
+
 	if ct.op == qcode.QTSubscription {
 		return res, errors.New("use 'core.Subscribe' for subscriptions")
 	}
 
+	if ct.op == qcode.QTMutation && sg.conf.ReadOnly {
+		err := &codeError{ErrCodeRoleForbidden, "mutations are disabled: read only"}
+		res.Error = err.Error()
+		return res, err
+	}
+
+	var role string
+
+	if keyExists(c, UserIDKey) {
+		role = "user"
+	} else {
+		role = "anon"
+	}
+
 	// use the chirino/graphql library for introspection queries
 	// disabled when allow list is enforced
-	if !sg.conf.UseAllowList && ct.name == "IntrospectionQuery" {
-		r := sg.ge.ServeGraphQL(&graphql.Request{Query: query})
+	if !sg.conf.UseAllowList && ct.op == qcode.QTQuery &&
+		(ct.name == "IntrospectionQuery" || qcode.IsIntrospection(query)) {
+		// the schema only has what the role has access to
+		if v, ok, err := sg.ctxRole(c); err != nil {
+			return res, err
+		} else if ok {
+			role = v
+		}
+
+		r := sg.introspectionEngine(role).ServeGraphQL(&graphql.Request{Query: query})
 		res.Data = r.Data
 
 		if r.Error() != nil {
@@ -198,34 +436,146 @@ func (sg *SuperGraph) GraphQL(c context.Context, query string, vars json.RawMess
 		return res, r.Error()
 	}
 
-	var role string
+	var mkey, quotaWarn string
 
-	if keyExists(c, UserIDKey) {
-		role = "user"
-	} else {
-		role = "anon"
+	if sg.usage != nil {
+		if mkey = sg.meterKey(c); mkey != "" {
+			var err error
+			if quotaWarn, err = sg.checkQuota(c, mkey); err != nil {
+				res.Error = err.Error()
+				return res, err
+			}
+		}
+	}
+
+	var rkey string
+	var rgen uint64
+
+	// the sql fragments of trusted callers change the rows returned
+	if sg.results != nil && ct.op == qcode.QTQuery && sqlFragments(c) == nil {
+		rkey = resultKey(c, query, vars, role)
+
+		var data []byte
+		var err error
+
+		// normalized results are made from the selections of the query
+		if !isNormalized(c) {
+			data, err = sg.results.Get(c, rkey)
+		}
+
+		if err != nil {
+			sg.log.Printf("WRN result cache: %s", err)
+		} else if data != nil {
+			span.AddAttributes(octrace.BoolAttribute("result_cached", true))
+			res.Data = json.RawMessage(data)
+			res.role = role
+
+			if mkey != "" {
+				sg.meter(c, mkey, data, 0)
+			}
+			if quotaWarn != "" {
+				res.ext().Warnings = append(res.ext().Warnings, quotaWarn)
+			}
+			return res, nil
+		}
+		rgen = sg.resultGen()
 	}
 
+	st := time.Now()
 	qr, err := ct.execQuery(query, vars, role)
+	err = ct.budget.timeErr(err)
+
+	if err == nil && mkey != "" {
+		sg.meter(c, mkey, qr.data, time.Since(st))
+	}
+
+	if err == nil && sg.results != nil && qr.q != nil && !ct.dryRun() && len(qr.warns) == 0 {
+		sg.cacheResult(c, rkey, qr, rgen)
+	}
 
 	if err != nil {
 		res.Error = err.Error()
+		spanError(span, err)
 	}
 
 	if qr.q != nil {
 		res.sql = qr.q.st.sql
+		res.dbTime = qr.dbTime
+
+		if w := qr.q.st.md.Warnings(); len(w) != 0 {
+			res.ext().Warnings = w
+		}
+
+		if len(qr.warns) != 0 {
+			res.ext().Warnings = append(res.ext().Warnings, qr.warns...)
+		}
+
+		// lint issues are only returned in development
+		if sg.conf.Lint && !sg.conf.UseAllowList {
+			for _, li := range sg.lint(qr.q.st.qc) {
+				res.ext().Warnings = append(res.ext().Warnings, li.String())
+			}
+		}
+
+		if err == nil {
+			if cc := sg.cacheControl(qr.q.st.qc); cc != nil {
+				res.ext().CacheControl = cc
+			}
+		}
+
+		// the cost is returned when it's limited so clients can see how close they are
+		if qc := qr.q.st.qc; qc != nil && (sg.conf.MaxDepth != 0 || sg.conf.MaxCost != 0) {
+			res.ext().Cost = &qc.Cost
+		}
+	}
+
+	if quotaWarn != "" {
+		res.ext().Warnings = append(res.ext().Warnings, quotaWarn)
+	}
+
+	if ct.budget != nil {
+		res.ext().Budget = ct.budget.usage()
+	}
+
+	// the changes of the mutation were rolled back
+	if ct.dryRun() {
+		res.ext().DryRun = true
 	}
 
 	res.Data = json.RawMessage(qr.data)
 	res.role = qr.role
 
+	if err == nil && qr.q != nil && isNormalized(c) {
+		if res.Data, res.ext().Entities, err = normalize(sg.pc.Schema(), qr.q.st.qc, res.Data); err != nil {
+			res.Error = err.Error()
+		}
+	}
+
 	return res, err
 }
 
+func (r *Result) ext() *extensions {
+	if r.Extensions == nil {
+		r.Extensions = &extensions{}
+	}
+	return r.Extensions
+}
+
 // GraphQLSchema function return the GraphQL schema for the underlying database connected
 // to this instance of Super Graph
 func (sg *SuperGraph) GraphQLSchema() (string, error) {
-	return sg.ge.Schema.String(), nil
+	return sg.schemaEngine().Schema.String(), nil
+}
+
+// GraphQLSchemaJSON function returns the result of the standard introspection
+// query for the GraphQL schema of the underlying database, a snapshot of the
+// schema that can be compared with another (eg. before and after a migration)
+func (sg *SuperGraph) GraphQLSchemaJSON() (json.RawMessage, error) {
+	r := sg.schemaEngine().ServeGraphQL(&graphql.Request{Query: introspectionQuery})
+	if err := r.Error(); err != nil {
+		return nil, err
+	}
+	return r.Data, nil
 }
 
 // Operation function return the operation type from the query. It uses a very fast algorithm to
@@ -239,3 +589,102 @@ func Operation(query string) OpType {
 func Name(query string) string {
 	return allow.QueryName(query)
 }
+
+// SelectOperation function returns the operation with the name from a query
+// document with more than one, along with the fragments in the document. The
+// query is returned as is if it has a single operation, an error is returned
+// if the name is empty and it has more than one or if no operation has the name.
+func SelectOperation(query, name string) (string, error) {
+	// only documents with more than one operation or with fragments
+	// are parsed, the name of a single operation is checked as is
+	if !manyBlocks(query) {
+		if name != "" && !strings.EqualFold(allow.QueryName(query), name) {
+			return "", fmt.Errorf("operation '%s' not found", name)
+		}
+		return query, nil
+	}
+
+	d, err := qcode.ParseDocument([]byte(query))
+	if err != nil {
+		// the errors of a query without a name are returned by GraphQL
+		if name == "" {
+			return query, nil
+		}
+		return "", err
+	}
+
+	op, err := d.SelectOperation(name)
+	if err != nil {
+		return "", err
+	}
+
+	if len(d.Operations) == 1 {
+		return query, nil
+	}
+
+	return d.Query(op), nil
+}
+
+// manyBlocks returns true when the query has more than one block at the
+// top level (eg. operations or fragments), strings and comments are skipped
+func manyBlocks(query string) bool {
+	n, depth := 0, 0
+
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+
+		case '"':
+			for i++; i < len(query) && query[i] != '"'; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+
+		case '{', '(':
+			if depth == 0 && query[i] == '{' {
+				if n++; n > 1 {
+					return true
+				}
+			}
+			depth++
+
+		case '}', ')':
+			depth--
+		}
+	}
+
+	return false
+}
+
+// ErrorMessages function returns the messages of all the errors found in a query
+// when more than one is returned by GraphQL, else just the message of the error
+func ErrorMessages(err error) []string {
+	if err == nil {
+		return nil
+	}
+
+	errs, ok := err.(util.Errors)
+	if !ok {
+		return []string{err.Error()}
+	}
+
+	msgs := make([]string, len(errs))
+	for i := range errs {
+		msgs[i] = errs[i].Error()
+	}
+	return msgs
+}
+
+// PoolStats are counters of the query parser pools and arenas
+type PoolStats = qcode.PoolStats
+
+// ParserPoolStats function returns the query parser pool statistics. A high share of
+// new items means the pools are too small for the load and a lot of arena blocks means
+// the queries are larger than the blocks.
+func ParserPoolStats() PoolStats {
+	return qcode.Stats()
+}
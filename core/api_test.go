@@ -2,7 +2,9 @@ package core
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -20,7 +22,7 @@ func BenchmarkGraphQL(b *testing.B) {
 
 	// mock.ExpectQuery(`^SELECT jsonb_build_object`).WithArgs()
 	c := &Config{}
-	sg, err := newSuperGraph(c, db, psql.GetTestDBInfo())
+	sg, err := newTestGraph(b, c, db, psql.GetTestDBInfo())
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -60,3 +62,245 @@ func BenchmarkGraphQL(b *testing.B) {
 	//fmt.Println(mock.ExpectationsWereMet())
 
 }
+
+func TestSelectOperation(t *testing.T) {
+	query := `query GetProducts { products { id } }
+	query GetUsers { users { id } }`
+
+	q, err := SelectOperation(query, "GetUsers")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q != `query GetUsers { users { id } }` {
+		t.Fatalf("wrong operation selected: %s", q)
+	}
+
+	if Name(q) != "GetUsers" {
+		t.Fatalf("wrong operation name: %s", Name(q))
+	}
+
+	if _, err := SelectOperation(query, "GetOrders"); err == nil {
+		t.Fatal("expected an error for an unknown operation")
+	}
+
+	if _, err := SelectOperation(query, ""); err == nil {
+		t.Fatal("expected an error for a document with many operations and no name")
+	}
+
+	single := `query GetProducts { products { id } }`
+
+	if _, err := SelectOperation(single, "Other"); err == nil {
+		t.Fatal("expected an error for an unknown operation")
+	}
+
+	for _, name := range []string{"", "getProducts"} {
+		if q, err := SelectOperation(single, name); err != nil || q != single {
+			t.Fatalf("expected the query as is got: %s, %v", q, err)
+		}
+	}
+
+	// a single operation with fragments is returned as is
+	frag := `query GetProducts { products { ...Product } }
+	fragment Product on products { id }`
+
+	if q, err := SelectOperation(frag, "GetProducts"); err != nil || q != frag {
+		t.Fatalf("expected the query as is got: %s, %v", q, err)
+	}
+
+	if _, err := SelectOperation(frag, "Other"); err == nil {
+		t.Fatal("expected an error for an unknown operation")
+	}
+
+	// braces in strings and arguments don't count as operations
+	args := `query GetProducts($f: Filter = { id: 1 }) { products(where: { name: "}{" }) { id } }`
+
+	if manyBlocks(args) {
+		t.Fatalf("expected a single block in: %s", args)
+	}
+}
+
+func TestSizeLimits(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{MaxQueryBytes: 50, MaxNameLength: 12}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		code  string
+	}{
+		{`query { products { id name description price user { id email } } }`, ErrCodeQueryTooLarge},
+		{`{ products { a_very_long_alias: id } }`, ErrCodeNameTooLong},
+	}
+
+	for _, v := range tests {
+		_, err := sg.GraphQL(context.Background(), v.query, nil)
+		if code := ErrorCode(err); code != v.code {
+			t.Fatalf("expected error code %s got '%s' (%v)", v.code, code, err)
+		}
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{MaxErrors: 3}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, "1")
+
+	tests := []struct {
+		query string
+		errs  int
+	}{
+		{`query { products(limit: "ten", offset: "two") { id } }`, 2},
+		{`query { products { nmae descr user { emial } } }`, 3},
+		{`query { products { id nmae } }`, 1},
+		{`query getProduct($id: Int!, $price: Float!) { products(id: $id) { id } }`, 2},
+	}
+
+	for _, v := range tests {
+		_, err := sg.GraphQL(ct, v.query, nil)
+		if msgs := ErrorMessages(err); len(msgs) != v.errs {
+			t.Fatalf("%s: expected %d errors got %d: %v", v.query, v.errs, len(msgs), err)
+		}
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{MaxSelectors: 2, MaxResultBytes: 20}
+
+	if err := conf.AddRoleTable("anon", "products", Insert{Block: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := context.Background()
+
+	tests := []struct {
+		c     context.Context
+		query string
+		code  string
+	}{
+		{c, `query { products { id user { id } customers { id } } }`, ErrCodeQueryTooComplex},
+		{c, `mutation { products(insert: $data) { id } }`, ErrCodeRoleForbidden},
+		{context.WithValue(c, UserRoleKey, "root"), `query { products { id } }`, ErrCodeRoleForbidden},
+	}
+
+	for _, v := range tests {
+		_, err := sg.GraphQL(v.c, v.query, json.RawMessage(`{"data": {"name": "a"}}`))
+		if code := ErrorCode(err); code != v.code {
+			t.Fatalf("expected error code %s got '%s' (%v)", v.code, code, err)
+		}
+	}
+
+	mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{"__root"}).
+		AddRow(`{"products": [{"id": 1}, {"id": 2}]}`))
+
+	res, err := sg.GraphQL(c, `query { products { id } }`, nil)
+	if code := ErrorCode(err); code != ErrCodeResultTooLarge || len(res.Data) != 0 {
+		t.Fatalf("expected error code %s got '%s' (%v)", ErrCodeResultTooLarge, code, err)
+	}
+
+	if ErrorCode(ErrRateLimited) != ErrCodeRateLimited {
+		t.Fatal("expected the rate limited error code")
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, nil, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := "query {\n  products {\n    id\n    user(where: { id: { eqq: 1 } }) { id }\n  }\n}"
+
+	_, err = sg.GraphQL(context.Background(), gql, nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	b, err := json.Marshal(GraphQLErrors(err))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `[{"message":"`
+	if !strings.HasPrefix(string(b), exp) ||
+		!strings.HasSuffix(string(b), `","locations":[{"line":4,"column":5}],"path":["products","user"]}]`) {
+		t.Fatalf("unexpected errors: %s", b)
+	}
+
+	_, err = sg.GraphQL(context.Background(), "query {\n  products { id %", nil)
+
+	if ge := GraphQLErrors(err); len(ge) != 1 || len(ge[0].Locations) != 1 ||
+		ge[0].Locations[0] != (Location{Line: 2, Column: 17}) {
+		t.Fatalf("unexpected errors: %+v", ge)
+	}
+}
+
+func TestJoinStrategy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Tables: []Table{{
+		Name:         "products",
+		JoinStrategy: map[string]string{"users": "subquery"},
+	}}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`\(SELECT "__sj_1"."json" FROM \(SELECT to_jsonb\("__sr_1".\*\) AS "json" FROM .+\) AS "user"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+
+	ct := context.WithValue(context.Background(), UserIDKey, "1")
+
+	if _, err := sg.GraphQL(ct, `query { products(limit: 5) { id user { id } } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Tables[0].JoinStrategy["users"] = "hash"
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for an unknown join strategy")
+	}
+}
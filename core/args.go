@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
 	"github.com/dosco/super-graph/jsn"
 )
 
@@ -35,6 +38,8 @@ func (sg *SuperGraph) argList(c context.Context, md psql.Metadata, vars []byte)
 		}
 	}
 
+	claims, _ := c.Value(UserClaimsKey).(map[string]interface{})
+
 	for i, p := range params {
 		switch p.Name {
 		case "user_id":
@@ -65,6 +70,11 @@ func (sg *SuperGraph) argList(c context.Context, md psql.Metadata, vars []byte)
 				return ar, argErr(p)
 			}
 
+		case psql.LocalesParam:
+			if vl[i], err = sg.locales(c, fields["locale"]); err != nil {
+				return ar, err
+			}
+
 		case "cursor":
 			if v, ok := fields["cursor"]; ok && v[0] == '"' {
 				v1, err := sg.decrypt(string(v[1 : len(v)-1]))
@@ -78,6 +88,50 @@ func (sg *SuperGraph) argList(c context.Context, md psql.Metadata, vars []byte)
 			ar.cindx = i
 
 		default:
+			// the freshness of a cache table of the cached fields
+			if strings.HasPrefix(p.Name, psql.CachedParam) {
+				vl[i] = sg.cacheFresh(p.Name[len(psql.CachedParam):])
+				continue
+			}
+
+			// a count of rows made outside the query
+			if cq, ok := md.CountQuery(p.Name); ok {
+				if vl[i], err = sg.countArg(c, cq, vars); err != nil {
+					return ar, err
+				}
+				continue
+			}
+
+			// a global id passed as the id of a table
+			if t, vn, ok := qcode.ParseNodeParam(p.Name); ok {
+				if vl[i], err = sg.nodeArg(t, psql.Param{Name: vn, Type: "ID"}, fields[vn]); err != nil {
+					return ar, err
+				}
+				continue
+			}
+
+			// a limit or offset and the order of a column set by the client
+			if max, vn, ok := qcode.ParsePagingParam(p.Name); ok {
+				if vl[i], err = pagingArg(vn, max, fields[vn]); err != nil {
+					return ar, err
+				}
+				continue
+			}
+
+			if vn, ok := qcode.ParseOrderParam(p.Name); ok {
+				if vl[i], err = orderArg(vn, fields[vn]); err != nil {
+					return ar, err
+				}
+				continue
+			}
+
+			if v, ok := claims[p.Name]; ok {
+				if vl[i], err = claimArg(p, v); err != nil {
+					return ar, err
+				}
+				continue
+			}
+
 			if v, ok := fields[p.Name]; ok {
 				switch {
 				case p.IsArray && v[0] != '[':
@@ -87,10 +141,27 @@ func (sg *SuperGraph) argList(c context.Context, md psql.Metadata, vars []byte)
 					return ar, fmt.Errorf("variable '%s' should be an array or object", p.Name)
 				}
 
+				if v, err = sg.coerceArg(p, v); err != nil {
+					return ar, fmt.Errorf("variable '%s': %w", p.Name, err)
+				}
+
+				if v, err = scalarArg(p, v); err != nil {
+					return ar, fmt.Errorf("variable '%s': %w", p.Name, err)
+				}
+
+				// geometries are passed as GeoJSON text
+				if psql.GeoType(p.Type) != "" {
+					vl[i] = string(v)
+					continue
+				}
+
 				switch v[0] {
 				case '[', '{':
 					vl[i] = v
 
+				case 'n':
+					vl[i] = nil
+
 				default:
 					if v[0] == '"' {
 						vl[i] = string(v[1 : len(v)-1])
@@ -108,6 +179,60 @@ func (sg *SuperGraph) argList(c context.Context, md psql.Metadata, vars []byte)
 	return ar, nil
 }
 
+// claimArg returns the value of a claim as an argument, objects and lists
+// are passed as json the same as they are from the request variables
+func claimArg(p psql.Param, v interface{}) (interface{}, error) {
+	switch v1 := v.(type) {
+	case string:
+		return v1, nil
+	case float64:
+		return strconv.FormatFloat(v1, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v1), nil
+	case json.Number:
+		return v1.String(), nil
+	case nil:
+		return nil, argErr(p)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("variable '%s': %w", p.Name, err)
+	}
+	return json.RawMessage(b), nil
+}
+
 func argErr(p psql.Param) error {
 	return fmt.Errorf("required variable '%s' of type '%s' must be set", p.Name, p.Type)
 }
+
+// pagingArg returns the value of a limit or offset variable clamped between
+// zero and max (when max is not zero), an offset that's not set is zero
+func pagingArg(name string, max int, v json.RawMessage) (int, error) {
+	if isNullValue(v) {
+		if max == 0 {
+			return 0, nil
+		}
+		return 0, argErr(psql.Param{Name: name, Type: "integer"})
+	}
+
+	n, err := strconv.Atoi(strings.Trim(string(v), `"`))
+	if err != nil {
+		return 0, fmt.Errorf("variable '%s' must be an integer", name)
+	}
+	return qcode.ClampPaging(n, max), nil
+}
+
+// orderArg returns the value of a variable with the order of a column
+func orderArg(name string, v json.RawMessage) (string, error) {
+	if isNullValue(v) {
+		return "", argErr(psql.Param{Name: name, Type: "text"})
+	}
+
+	o := strings.Trim(string(v), `"`)
+
+	if _, err := qcode.ParseOrder(o); err != nil {
+		return "", fmt.Errorf("variable '%s': %w", name, err)
+	}
+	return o, nil
+}
@@ -0,0 +1,380 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+const (
+	defaultBlobURLTTL  = 15 * time.Minute
+	defaultBlobMaxSize = 10 << 20
+)
+
+// Blobs struct configures the object storage of the blob columns. It's S3 or
+// any S3 compatible storage like GCS (with the Endpoint set to
+// https://storage.googleapis.com and HMAC keys), the credentials are read
+// from the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY env vars
+type Blobs struct {
+	Bucket   string
+	Region   string
+	Endpoint string
+
+	// Prefix is added to the keys of the uploaded files (eg. uploads/)
+	Prefix string
+
+	// URLTTL is how long the signed urls returned for the blob
+	// columns are valid. Defaults to 15m
+	URLTTL time.Duration `mapstructure:"url_ttl"`
+
+	// MaxSize is the max size in bytes of an uploaded file. Defaults to 10MB
+	MaxSize int `mapstructure:"max_size"`
+}
+
+// BlobStore is the object storage of the blob columns, files are put with a
+// new key and a signed url valid for the ttl is returned for the key
+type BlobStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// BlobReaderStore is a blob store that can put a file from a reader
+// without reading all of it in memory (eg. large uploads)
+type BlobReaderStore interface {
+	PutReader(ctx context.Context, key, contentType string, r io.Reader) error
+}
+
+// BlobDeleteStore is a blob store that can delete a file (eg. an upload
+// for a mutation that failed)
+type BlobDeleteStore interface {
+	Delete(ctx context.Context, key string) error
+}
+
+// initBlobs indexes the blob columns by table and sets up the store
+func (sg *SuperGraph) initBlobs() error {
+	schema := sg.pc.Schema()
+
+	for _, t := range sg.conf.Tables {
+		for _, c := range t.Columns {
+			if !c.Blob {
+				continue
+			}
+
+			ti, err := schema.GetTableInfo(t.Name)
+			if err != nil {
+				return err
+			}
+
+			if sg.blobCols == nil {
+				sg.blobCols = make(map[string]map[string]struct{})
+			}
+			if sg.blobCols[ti.Name] == nil {
+				sg.blobCols[ti.Name] = make(map[string]struct{})
+			}
+			sg.blobCols[ti.Name][strings.ToLower(c.Name)] = struct{}{}
+		}
+	}
+
+	if len(sg.blobCols) == 0 {
+		return nil
+	}
+
+	if sg.conf.BlobStore != nil {
+		sg.blobs = sg.conf.BlobStore
+		return nil
+	}
+
+	bs, err := NewS3BlobStore(sg.conf.Blobs)
+	if err != nil {
+		return err
+	}
+	sg.blobs = bs
+
+	return nil
+}
+
+// blobURL is the formatter of the blob columns, it returns
+// a signed url of the key stored in the column
+func (sg *SuperGraph) blobURL(v json.RawMessage, arg string) (json.RawMessage, error) {
+	var key string
+
+	if err := json.Unmarshal(v, &key); err != nil {
+		return nil, fmt.Errorf("blob: %w", err)
+	}
+
+	u, err := sg.blobs.SignedURL(key, sg.blobURLTTL())
+	if err != nil {
+		return nil, fmt.Errorf("blob: %w", err)
+	}
+
+	return json.Marshal(u)
+}
+
+// blobURLTTL returns how long the signed urls of the blob columns are valid for
+func (sg *SuperGraph) blobURLTTL() time.Duration {
+	if ttl := sg.conf.Blobs.URLTTL; ttl != 0 {
+		return ttl
+	}
+	return defaultBlobURLTTL
+}
+
+// selectsBlobs returns true if the query selects a blob column, the
+// signed urls in its result expire
+func (sg *SuperGraph) selectsBlobs(qc *qcode.QCode) bool {
+	if len(sg.blobCols) == 0 {
+		return false
+	}
+
+	for i := range qc.Selects {
+		sel := &qc.Selects[i]
+		name := sel.Name
+
+		if ti, err := sg.pc.Schema().GetTableInfo(name); err == nil {
+			name = ti.Name
+		}
+
+		cols, ok := sg.blobCols[name]
+		if !ok {
+			continue
+		}
+
+		for _, c := range sel.Cols {
+			if _, ok := cols[strings.ToLower(c.Name)]; ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// uploadBlobs uploads the data urls set for the blob columns in the inserts,
+// updates and upserts and sets the columns to the keys of the uploaded files
+func (sg *SuperGraph) uploadBlobs(ctx context.Context, qc *qcode.QCode, vm map[string]json.RawMessage) error {
+	for _, m := range qc.Mutations {
+		if m.Type != qcode.QTInsert && m.Type != qcode.QTUpdate && m.Type != qcode.QTUpsert {
+			continue
+		}
+
+		ti, err := sg.pc.Schema().GetTableInfo(qc.Selects[m.SelID].Name)
+		if err != nil {
+			continue
+		}
+
+		cols, ok := sg.blobCols[ti.Name]
+		if !ok {
+			continue
+		}
+
+		v, ok := vm[m.ActionVar]
+		if !ok || len(v) == 0 {
+			continue
+		}
+
+		upload := func(row map[string]json.RawMessage) error {
+			return sg.uploadRow(ctx, ti.Name, cols, row)
+		}
+
+		if vm[m.ActionVar], err = editRows(v, upload); err != nil {
+			return fmt.Errorf("variable '%s': %w", m.ActionVar, err)
+		}
+	}
+
+	return nil
+}
+
+// uploadVarBlobs is uploadBlobs for the variables passed to the query
+func (sg *SuperGraph) uploadVarBlobs(ctx context.Context, qc *qcode.QCode, vars json.RawMessage) (json.RawMessage, error) {
+	if len(sg.blobCols) == 0 || len(vars) == 0 || len(qc.Mutations) == 0 {
+		return vars, nil
+	}
+
+	var vm map[string]json.RawMessage
+
+	if err := json.Unmarshal(vars, &vm); err != nil {
+		return nil, err
+	}
+
+	if err := sg.uploadBlobs(ctx, qc, vm); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(vm)
+}
+
+func (sg *SuperGraph) uploadRow(ctx context.Context, table string,
+	cols map[string]struct{}, row map[string]json.RawMessage) error {
+
+	for cn, val := range row {
+		if _, ok := cols[strings.ToLower(cn)]; !ok || string(val) == "null" {
+			continue
+		}
+
+		var s string
+
+		if err := json.Unmarshal(val, &s); err != nil {
+			return fmt.Errorf("blob column %s: data url expected", cn)
+		}
+
+		ct, data, err := parseDataURL(s)
+		if err != nil {
+			return fmt.Errorf("blob column %s: %w", cn, err)
+		}
+
+		max := sg.conf.Blobs.MaxSize
+		if max == 0 {
+			max = defaultBlobMaxSize
+		}
+
+		if len(data) > max {
+			return fmt.Errorf("blob column %s: file is too large: %d bytes (max %d)",
+				cn, len(data), max)
+		}
+
+		key, err := sg.blobKey(table, cn, ct)
+		if err != nil {
+			return err
+		}
+
+		// the file is not uploaded for a dry run, only checked
+		if !isDryRun(ctx) {
+			if err := sg.blobs.Put(ctx, key, ct, data); err != nil {
+				return fmt.Errorf("blob column %s: %w", cn, err)
+			}
+		}
+
+		if row[cn], err = json.Marshal(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// blobKey returns a new key for a file (eg. uploads/users/avatar/<uuid>.png)
+func (sg *SuperGraph) blobKey(table, col, contentType string) (string, error) {
+	id, err := newUUIDv4()
+	if err != nil {
+		return "", err
+	}
+
+	var ext string
+
+	if v, err := mime.ExtensionsByType(contentType); err == nil && len(v) != 0 {
+		ext = v[0]
+	}
+
+	return sg.conf.Blobs.Prefix + table + "/" + strings.ToLower(col) + "/" + id + ext, nil
+}
+
+// parseDataURL returns the content type and the data of
+// a base64 data url (eg. data:image/png;base64,iVBORw0KGgo...)
+func parseDataURL(s string) (string, []byte, error) {
+	if !strings.HasPrefix(s, "data:") {
+		return "", nil, errors.New("data url expected")
+	}
+
+	i := strings.IndexByte(s, ',')
+	if i == -1 {
+		return "", nil, errors.New("invalid data url")
+	}
+
+	ct := s[5:i]
+
+	if !strings.HasSuffix(ct, ";base64") {
+		return "", nil, errors.New("data url must be base64 encoded")
+	}
+	ct = strings.TrimSuffix(ct, ";base64")
+
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+
+	data, err := base64.StdEncoding.DecodeString(s[i+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid data url: %w", err)
+	}
+
+	return ct, data, nil
+}
+
+type s3BlobStore struct {
+	svc    *s3.S3
+	bucket string
+}
+
+// NewS3BlobStore returns a blob store for a bucket in S3 or an
+// S3 compatible storage (eg. GCS) when the endpoint is set
+func NewS3BlobStore(b Blobs) (BlobStore, error) {
+	if b.Bucket == "" {
+		return nil, errors.New("blobs: bucket is required")
+	}
+
+	region := b.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	cfg := aws.NewConfig().WithRegion(region)
+
+	if b.Endpoint != "" {
+		cfg = cfg.WithEndpoint(b.Endpoint).WithS3ForcePathStyle(true)
+	}
+
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("blobs: %w", err)
+	}
+
+	return &s3BlobStore{svc: s3.New(sess), bucket: b.Bucket}, nil
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	_, err := s.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+// PutReader uploads the file in parts as it's read
+func (s *s3BlobStore) PutReader(ctx context.Context, key, contentType string, r io.Reader) error {
+	_, err := s3manager.NewUploaderWithClient(s.svc).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        r,
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+	_, err := s.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *s3BlobStore) SignedURL(key string, ttl time.Duration) (string, error) {
+	req, _ := s.svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(ttl)
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+type testBlobStore struct {
+	keys  []string
+	types []string
+	data  []string
+}
+
+func (s *testBlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	s.keys = append(s.keys, key)
+	s.types = append(s.types, contentType)
+	s.data = append(s.data, string(data))
+	return nil
+}
+
+func (s *testBlobStore) SignedURL(key string, ttl time.Duration) (string, error) {
+	return "https://blobs.example.com/" + key + "?ttl=" + ttl.String(), nil
+}
+
+func TestBlobs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bs := &testBlobStore{}
+
+	conf := &Config{
+		Tables: []Table{{Name: "products", Columns: []Column{
+			{Name: "description", Blob: true},
+		}}},
+		Blobs:     Blobs{Prefix: "uploads/", URLTTL: time.Hour},
+		BlobStore: bs,
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`INSERT INTO "products"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).
+			AddRow(`{"product": {"id": 5, "description": "uploads/products/description/a.txt"}}`))
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	// "hello" as a base64 data url
+	vars := json.RawMessage(`{"data": {"name": "Bag", "description": "data:text/plain;base64,aGVsbG8="}}`)
+
+	res, err := sg.GraphQL(ct, `mutation { product(insert: $data) { id description } }`, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bs.keys) != 1 || bs.data[0] != "hello" || bs.types[0] != "text/plain" {
+		t.Fatalf("unexpected upload: %v %v %v", bs.keys, bs.types, bs.data)
+	}
+
+	if k := bs.keys[0]; !strings.HasPrefix(k, "uploads/products/description/") {
+		t.Fatalf("unexpected key: %s", k)
+	}
+
+	exp := `{"product": {"id": 5, "description":"https://blobs.example.com/uploads/products/description/a.txt?ttl=1h0m0s"}}`
+
+	if string(res.Data) != exp {
+		t.Fatalf("unexpected result: %s", res.Data)
+	}
+
+	// only data urls can be set for a blob column
+	vars = json.RawMessage(`{"data": {"name": "Bag", "description": "uploads/a.txt"}}`)
+
+	if _, err := sg.GraphQL(ct, `mutation { product(insert: $data) { id } }`, vars); err == nil {
+		t.Fatal("expected an error for a value that's not a data url")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a store is required for blob columns
+	conf.BlobStore = nil
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error when no bucket is configured")
+	}
+}
+
+func TestParseDataURL(t *testing.T) {
+	ct, data, err := parseDataURL("data:;base64,aGk=")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ct != "application/octet-stream" || string(data) != "hi" {
+		t.Fatalf("unexpected result: %s %s", ct, data)
+	}
+
+	for _, v := range []string{"hi", "data:text/plain,hi", "data:text/plain;base64"} {
+		if _, _, err := parseDataURL(v); err == nil {
+			t.Errorf("expected an error for %s", v)
+		}
+	}
+}
+
+// ttlResultStore keeps the ttl the results are set with
+type ttlResultStore struct {
+	ResultStore
+	ttl time.Duration
+}
+
+func (s *ttlResultStore) Set(ctx context.Context, key string, data []byte, ttl time.Duration, tables []string) error {
+	s.ttl = ttl
+	return s.ResultStore.Set(ctx, key, data, ttl, tables)
+}
+
+func TestBlobResultTTL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rs := &ttlResultStore{ResultStore: NewMemoryResultStore(0)}
+
+	conf := &Config{
+		Tables: []Table{{Name: "products", Columns: []Column{
+			{Name: "description", Blob: true},
+		}}},
+		Blobs:       Blobs{URLTTL: time.Minute},
+		BlobStore:   &testBlobStore{},
+		ResultCache: ResultCache{Enable: true, TTL: time.Hour},
+		ResultStore: rs,
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	// the results with signed urls are cached until they expire
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": [{"id": 1, "description": "a.txt"}]}`))
+
+	if _, err := sg.GraphQL(ct, `query { products(limit: 5) { id description } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if rs.ttl != time.Minute {
+		t.Fatalf("expected the ttl of the signed urls got %s", rs.ttl)
+	}
+
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": [{"id": 1}]}`))
+
+	if _, err := sg.GraphQL(ct, `query { products(limit: 5) { id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if rs.ttl != time.Hour {
+		t.Fatalf("expected the result cache ttl got %s", rs.ttl)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Budget limits the work done to run a request, requests over it fail with
+// a BUDGET_EXCEEDED error. Zero values are no limit
+type Budget struct {
+	// MaxStatements is the max number of sql statements run for a request,
+	// the roots of a split query and the roles query each count as one
+	MaxStatements int `mapstructure:"max_statements"`
+
+	// MaxRemoteCalls is the max number of requests made to remote apis for
+	// the remote joins of a request, a batch of ids counts as one
+	MaxRemoteCalls int `mapstructure:"max_remote_calls"`
+
+	// MaxTime is the max time a request takes, from compiling the
+	// query to encoding the result
+	MaxTime time.Duration `mapstructure:"max_time"`
+}
+
+// Resources of a budget, see BudgetError
+const (
+	BudgetStatements  = "statements"
+	BudgetRemoteCalls = "remote_calls"
+	BudgetTime        = "time"
+)
+
+// BudgetError is returned for requests over their budget, with the resource
+// that ran out (eg. BudgetStatements) and how much of it was used. Time is
+// in milliseconds
+type BudgetError struct {
+	Resource string `json:"resource"`
+	Limit    int64  `json:"limit"`
+	Used     int64  `json:"used"`
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("budget exceeded: %s: %d (max %d)", e.Resource, e.Used, e.Limit)
+}
+
+// budgetUsage is the part of the budget a request used, it's
+// returned in the response extensions when a budget is set
+type budgetUsage struct {
+	Statements  int64 `json:"statements"`
+	RemoteCalls int64 `json:"remoteCalls"`
+	Time        int64 `json:"time"`
+}
+
+// budget tracks the work done for a request, it's shared by
+// the statements and remote calls that run at the same time
+type budget struct {
+	conf  Budget
+	start time.Time
+	stmts int64
+	calls int64
+}
+
+// newBudget returns the budget of a request or nil when none is set
+func (sg *SuperGraph) newBudget() *budget {
+	b := sg.conf.Budget
+	if b.MaxStatements == 0 && b.MaxRemoteCalls == 0 && b.MaxTime == 0 {
+		return nil
+	}
+	return &budget{conf: b, start: time.Now()}
+}
+
+// addStmts counts n statements about to be run
+func (b *budget) addStmts(n int) error {
+	if b == nil {
+		return nil
+	}
+	used := atomic.AddInt64(&b.stmts, int64(n))
+
+	if max := int64(b.conf.MaxStatements); max != 0 && used > max {
+		return &BudgetError{Resource: BudgetStatements, Limit: max, Used: used}
+	}
+	return nil
+}
+
+// addCalls counts n requests about to be made to remote apis
+func (b *budget) addCalls(n int) error {
+	if b == nil {
+		return nil
+	}
+	used := atomic.AddInt64(&b.calls, int64(n))
+
+	if max := int64(b.conf.MaxRemoteCalls); max != 0 && used > max {
+		return &BudgetError{Resource: BudgetRemoteCalls, Limit: max, Used: used}
+	}
+	return nil
+}
+
+// timeErr returns a budget error in place of the error of a
+// request that failed since it ran out of time
+func (b *budget) timeErr(err error) error {
+	if b == nil || err == nil || b.conf.MaxTime == 0 {
+		return err
+	}
+	if d := time.Since(b.start); d >= b.conf.MaxTime {
+		return &BudgetError{Resource: BudgetTime,
+			Limit: b.conf.MaxTime.Milliseconds(), Used: d.Milliseconds()}
+	}
+	return err
+}
+
+func (b *budget) usage() *budgetUsage {
+	return &budgetUsage{
+		Statements:  atomic.LoadInt64(&b.stmts),
+		RemoteCalls: atomic.LoadInt64(&b.calls),
+		Time:        time.Since(b.start).Milliseconds(),
+	}
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+	"github.com/dosco/super-graph/jsn"
+)
+
+func TestBudgetStatements(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{SplitSQLBytes: 100, Budget: Budget{MaxStatements: 1}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	// the split query is two statements
+	_, err = sg.GraphQL(ct, `query { products(limit: 5) { id } users(limit: 5) { id } }`, nil)
+
+	var be *BudgetError
+	if !errors.As(err, &be) || be.Resource != BudgetStatements || be.Used != 2 || be.Limit != 1 {
+		t.Fatalf("expected a statements budget error got %v", err)
+	}
+
+	if ErrorCode(err) != ErrCodeBudgetExceeded {
+		t.Fatalf("expected the code %s got %s", ErrCodeBudgetExceeded, ErrorCode(err))
+	}
+
+	if ge := GraphQLErrors(err); ge[0].Extensions.Budget != be {
+		t.Fatalf("expected the budget in the extensions got %+v", ge[0].Extensions)
+	}
+
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+
+	res, err := sg.GraphQL(ct, `query { products(limit: 5) { id } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u := res.Extensions.Budget; u == nil || u.Statements != 1 {
+		t.Fatalf("expected the budget used in the extensions got %+v", u)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBudgetRemoteCalls(t *testing.T) {
+	var n int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		_, _ = w.Write([]byte(`{"amount": 100}`))
+	}))
+	defer ts.Close()
+
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Tables: []Table{{
+		Name:    "customers",
+		Remotes: []Remote{{Name: "payments", ID: "id", URL: ts.URL + "/$id"}},
+	}}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sel := []qcode.Select{
+		{ID: 0, ParentID: -1, Name: "customers", FieldName: "customers"},
+		{ID: 1, ParentID: 0, Name: "payments", FieldName: "payments",
+			Cols: []qcode.Column{{Name: "amount"}}, SkipRender: qcode.SkipTypeRemote},
+	}
+
+	h := maphash.Hash{}
+	h.SetSeed(sg.hashSeed)
+
+	_, sfmap, err := sg.parentFieldIds(&h, sel, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := []jsn.Field{
+		{Key: []byte("__customers_id"), Value: []byte("1")},
+		{Key: []byte("__customers_id"), Value: []byte("2")},
+		{Key: []byte("__customers_id"), Value: []byte("3")},
+	}
+
+	bu := &budget{conf: Budget{MaxRemoteCalls: 2}, start: time.Now()}
+
+	_, _, err = sg.resolveRemotes(nil, bu, &h, from, sel, sfmap)
+
+	var be *BudgetError
+	if !errors.As(err, &be) || be.Resource != BudgetRemoteCalls || be.Used != 3 {
+		t.Fatalf("expected a remote calls budget error got %v", err)
+	}
+
+	if n != 0 {
+		t.Fatalf("expected no remote requests got %d", n)
+	}
+}
+
+func TestBudgetTime(t *testing.T) {
+	bu := &budget{conf: Budget{MaxTime: time.Millisecond}, start: time.Now().Add(-time.Second)}
+
+	var be *BudgetError
+	if err := bu.timeErr(context.DeadlineExceeded); !errors.As(err, &be) || be.Resource != BudgetTime {
+		t.Fatalf("expected a time budget error got %v", err)
+	}
+
+	if err := bu.timeErr(nil); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+}
@@ -24,7 +24,14 @@ func (sg *SuperGraph) compileQuery(cq *cquery, role string) error {
 	// compile and cache the result else compile each time
 	if sg.conf.UseAllowList {
 		if cq1, ok := sg.queries[(cq.q.name + role)]; ok {
+			vars := cq.q.vars
 			cq.q = cq1.q
+
+			// the @skip and @include directives are decided by the variables
+			// of the request, the saved ones only set the mutation inputs
+			if cq.q.op != qcode.QTMutation {
+				cq.q.vars = vars
+			}
 		} else {
 			return errNotFound
 		}
@@ -36,7 +43,7 @@ func (sg *SuperGraph) compileQuery(cq *cquery, role string) error {
 		}
 
 	} else {
-		err = sg.compileQueryFn(cq, role)
+		err = sg.compileCached(cq, role)
 	}
 
 	return err
@@ -45,33 +52,53 @@ func (sg *SuperGraph) compileQuery(cq *cquery, role string) error {
 func (sg *SuperGraph) compileQueryFn(cq *cquery, role string) error {
 	var err error
 
+	md := cq.md
+	md.Poll = (cq.q.op != qcode.QTQuery)
+
 	switch cq.q.op {
 	case qcode.QTQuery:
 		if sg.abacEnabled {
-			cq.stmts, cq.st, err = sg.buildMultiStmt(cq.q.query, cq.q.vars, false)
-		} else {
-			cq.st, err = sg.buildRoleStmt(cq.q.query, cq.q.vars, role, false)
+			cq.stmts, cq.st, err = sg.buildMultiStmt(cq.q.query, cq.q.vars, md)
+		} else if cq.st, err = sg.buildRoleStmt(cq.q.query, cq.q.vars, role, md); err == nil {
+			cq.parts, cq.parallel, err = sg.buildRootStmts(cq, role, md)
 		}
 
 	case qcode.QTSubscription:
 		if sg.abacEnabled {
-			cq.stmts, cq.st, err = sg.buildMultiStmt(cq.q.query, cq.q.vars, true)
+			cq.stmts, cq.st, err = sg.buildMultiStmt(cq.q.query, cq.q.vars, md)
 		} else {
-			cq.st, err = sg.buildRoleStmt(cq.q.query, cq.q.vars, role, true)
+			cq.st, err = sg.buildRoleStmt(cq.q.query, cq.q.vars, role, md)
 		}
 
 	case qcode.QTMutation:
-		cq.st, err = sg.buildRoleStmt(cq.q.query, cq.q.vars, role, true)
+		cq.st, err = sg.buildRoleStmt(cq.q.query, cq.q.vars, role, md)
 
 	default:
 		err = errors.New("unknown query")
 	}
 
 	cq.roleArg = (len(cq.stmts) > 0)
+
+	if tags := sg.queryTags(cq.q.name); err == nil && len(tags) != 0 {
+		cq.st.sql = tagComment(tags) + cq.st.sql
+
+		for i := range cq.parts {
+			cq.parts[i].sql = tagComment(tags) + cq.parts[i].sql
+		}
+	}
+
+	if hint := hintComment(cq.frags); err == nil && hint != "" {
+		cq.st.sql = hint + cq.st.sql
+
+		for i := range cq.parts {
+			cq.parts[i].sql = hint + cq.parts[i].sql
+		}
+	}
+
 	return err
 }
 
-func (sg *SuperGraph) buildRoleStmt(query, vars []byte, role string, poll bool) (stmt, error) {
+func (sg *SuperGraph) buildRoleStmt(query, vars []byte, role string, md psql.Metadata) (stmt, error) {
 	var st stmt
 
 	ro, ok := sg.roles[role]
@@ -84,21 +111,32 @@ func (sg *SuperGraph) buildRoleStmt(query, vars []byte, role string, poll bool)
 
 	if len(vars) != 0 {
 		if err := json.Unmarshal(vars, &vm); err != nil {
-			return st, err
+			return st, withCat(ErrCatValidate, err)
 		}
 	}
 
 	qc, err := sg.qc.Compile(query, ro.Name)
 	if err != nil {
+		return st, withCat(ErrCatValidate, err)
+	}
+
+	if vm, err = applyVarDefs(qc, vm); err != nil {
+		return st, withCat(ErrCatValidate, err)
+	}
+
+	if err := sg.genIDs(qc, vm); err != nil {
 		return st, err
 	}
 
+	if err := sg.initRemoteSorts(qc); err != nil {
+		return st, withCat(ErrCatValidate, err)
+	}
+
 	w := &bytes.Buffer{}
-	md := psql.Metadata{Poll: poll}
 
 	st.md, err = sg.pc.CompileWithMetadata(w, qc, psql.Variables(vm), md)
 	if err != nil {
-		return st, err
+		return st, withCat(ErrCatCompile, err)
 	}
 
 	st.role = ro
@@ -108,14 +146,14 @@ func (sg *SuperGraph) buildRoleStmt(query, vars []byte, role string, poll bool)
 	return st, nil
 }
 
-func (sg *SuperGraph) buildMultiStmt(query, vars []byte, poll bool) ([]stmt, stmt, error) {
+func (sg *SuperGraph) buildMultiStmt(query, vars []byte, md psql.Metadata) ([]stmt, stmt, error) {
 	var vm map[string]json.RawMessage
 	var err error
 	var st stmt
 
 	if len(vars) != 0 {
 		if err := json.Unmarshal(vars, &vm); err != nil {
-			return nil, st, err
+			return nil, st, withCat(ErrCatValidate, err)
 		}
 	}
 
@@ -125,7 +163,6 @@ func (sg *SuperGraph) buildMultiStmt(query, vars []byte, poll bool) ([]stmt, stm
 
 	stmts := make([]stmt, 0, len(sg.conf.Roles))
 	w := &bytes.Buffer{}
-	md := psql.Metadata{Poll: poll}
 
 	for i := 0; i < len(sg.conf.Roles); i++ {
 		role := &sg.conf.Roles[i]
@@ -137,15 +174,27 @@ func (sg *SuperGraph) buildMultiStmt(query, vars []byte, poll bool) ([]stmt, stm
 
 		qc, err := sg.qc.Compile(query, role.Name)
 		if err != nil {
+			return nil, st, withCat(ErrCatValidate, err)
+		}
+
+		if vm, err = applyVarDefs(qc, vm); err != nil {
+			return nil, st, withCat(ErrCatValidate, err)
+		}
+
+		if err := sg.genIDs(qc, vm); err != nil {
 			return nil, st, err
 		}
 
+		if err := sg.initRemoteSorts(qc); err != nil {
+			return nil, st, withCat(ErrCatValidate, err)
+		}
+
 		stmts = append(stmts, stmt{role: role, qc: qc})
 		s := &stmts[len(stmts)-1]
 
 		md, err = sg.pc.CompileWithMetadata(w, qc, psql.Variables(vm), md)
 		if err != nil {
-			return nil, st, err
+			return nil, st, withCat(ErrCatCompile, err)
 		}
 
 		s.sql = w.String()
@@ -157,7 +206,7 @@ func (sg *SuperGraph) buildMultiStmt(query, vars []byte, poll bool) ([]stmt, stm
 
 	st.sql, err = sg.renderUserQuery(md, stmts)
 	if err != nil {
-		return nil, st, err
+		return nil, st, withCat(ErrCatCompile, err)
 	}
 
 	return stmts, st, nil
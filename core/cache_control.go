@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// cacheControl is the Apollo cache control extension added to responses
+// https://github.com/apollographql/apollo-cache-control
+type cacheControl struct {
+	Version int         `json:"version"`
+	Hints   []cacheHint `json:"hints"`
+}
+
+type cacheHint struct {
+	Path   []string `json:"path"`
+	MaxAge int      `json:"maxAge"`
+	Scope  string   `json:"scope,omitempty"`
+}
+
+// initCacheControl validates the cache control config of the tables
+// and indexes it by table name
+func (sg *SuperGraph) initCacheControl() error {
+	for i := range sg.conf.Tables {
+		t := &sg.conf.Tables[i]
+		cc := &t.CacheControl
+
+		if cc.MaxAge == 0 && cc.Scope == "" {
+			continue
+		}
+
+		cc.Scope = strings.ToUpper(cc.Scope)
+
+		if cc.Scope != "" && cc.Scope != "PUBLIC" && cc.Scope != "PRIVATE" {
+			return fmt.Errorf("table %s: cache_control scope must be PUBLIC or PRIVATE: %s",
+				t.Name, cc.Scope)
+		}
+
+		if sg.cacheHints == nil {
+			sg.cacheHints = make(map[string]*CacheControl)
+		}
+		sg.cacheHints[strings.ToLower(t.Name)] = cc
+	}
+
+	return nil
+}
+
+// cacheControl returns the cache hints for the tables in the query
+// each hint has the path of the selection in the response
+func (sg *SuperGraph) cacheControl(qc *qcode.QCode) *cacheControl {
+	if len(sg.cacheHints) == 0 || qc == nil || qc.Type != qcode.QTQuery {
+		return nil
+	}
+
+	var hints []cacheHint
+	paths := make([][]string, len(qc.Selects))
+
+	// selections are ordered so parents always come before their children
+	for i := range qc.Selects {
+		sel := &qc.Selects[i]
+
+		if sel.ParentID == -1 {
+			paths[i] = []string{sel.FieldName}
+		} else {
+			pp := paths[sel.ParentID]
+			paths[i] = append(pp[:len(pp):len(pp)], sel.FieldName)
+		}
+
+		if sel.SkipRender != qcode.SkipTypeNone {
+			continue
+		}
+
+		cc, ok := sg.cacheHints[sel.Name]
+		if !ok {
+			if ti, err := sg.pc.Schema().GetTableInfo(sel.Name); err == nil {
+				cc, ok = sg.cacheHints[ti.Name]
+			}
+		}
+
+		if ok {
+			hints = append(hints, cacheHint{
+				Path:   paths[i],
+				MaxAge: cc.MaxAge,
+				Scope:  cc.Scope,
+			})
+		}
+	}
+
+	if len(hints) == 0 {
+		return nil
+	}
+
+	return &cacheControl{Version: 1, Hints: hints}
+}
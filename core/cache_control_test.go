@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sg-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "mock.yml")
+
+	if err := ioutil.WriteFile(fn, []byte(mockYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{
+		MockData:      fn,
+		AllowListFile: filepath.Join(dir, "allow.list"),
+		Tables: []Table{{
+			Name:         "users",
+			CacheControl: CacheControl{MaxAge: 60, Scope: "private"},
+		}},
+	}
+
+	sg, err := NewSuperGraph(conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := sg.GraphQL(context.Background(), `query { user(id: $id) { full_name } }`, json.RawMessage(`{"id": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(res.Extensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"cacheControl":{"version":1,"hints":[{"path":["user"],"maxAge":60,"scope":"PRIVATE"}]}}`
+
+	if string(b) != exp {
+		t.Fatalf("expected: %s got: %s", exp, b)
+	}
+}
@@ -0,0 +1,276 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+const (
+	// keys of the refresh times of the cache tables kept in the storage
+	kvKeyCacheRefreshed = "field_cache_refreshed:"
+	kvKeyCacheRefresh   = "field_cache_refresh:"
+
+	defaultCacheEvery = 5 * time.Minute
+)
+
+// CachedField is an expensive field of a table (eg. an aggregate) read from a
+// cache table or materialized view that's refreshed on a schedule. The live
+// sql is used in its place when the cache is staler than MaxStale
+type CachedField struct {
+	// Name of the field
+	Name string
+
+	// Type is the GraphQL type of the field in the introspection
+	// schema. Defaults to String
+	Type string
+
+	// SQL is the expression computing the value live, the row is referenced
+	// by the table name (eg. `(SELECT avg(rating) FROM reviews WHERE
+	// reviews.product_id = products.id)`)
+	SQL string
+
+	// Table is the cache table or materialized view with the values
+	Table string
+
+	// Column is the column of the cache table with the value.
+	// Defaults to the name of the field
+	Column string
+
+	// Key is the column of the cache table with the primary key
+	// of the row. Defaults to id
+	Key string
+
+	// Refresh is the sql that refreshes the cache table. Defaults
+	// to `REFRESH MATERIALIZED VIEW <table>`
+	Refresh string
+
+	// Every is how often the cache table is refreshed. Defaults to 5 minutes
+	Every time.Duration
+
+	// MaxStale is how old the cache table can get before the live
+	// sql is used. Defaults to twice Every
+	MaxStale time.Duration `mapstructure:"max_stale"`
+}
+
+// fieldCache is a cache table the cached fields are read from, refreshed
+// is when it was last refreshed in unix nanoseconds
+type fieldCache struct {
+	refreshed int64
+	table     string
+	refresh   string
+	every     time.Duration
+	maxStale  time.Duration
+}
+
+// cachedCols returns the cached fields keyed by the table and then the field,
+// the fields are checked against the schema
+func (sg *SuperGraph) cachedCols(s *psql.DBSchema) (map[string]map[string]psql.CachedField, error) {
+	var cols map[string]map[string]psql.CachedField
+
+	for _, t := range sg.conf.Tables {
+		if len(t.Cached) == 0 {
+			continue
+		}
+
+		if sg.conf.DBType == "mysql" {
+			return nil, errors.New("cached fields: only supported with postgres")
+		}
+
+		ti, err := s.GetTableInfo(t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("cached field: %w", err)
+		}
+
+		for i := range t.Cached {
+			cf := t.Cached[i]
+			fn := strings.ToLower(cf.Name)
+
+			if cf.Name == "" || cf.SQL == "" || cf.Table == "" {
+				return nil, fmt.Errorf("cached field: %s: name, sql and table are required", t.Name)
+			}
+
+			switch cf.Type {
+			case "", "String", "Int", "Float", "Boolean", "ID":
+			default:
+				return nil, fmt.Errorf("cached field: %s.%s: unknown type: %s", t.Name, cf.Name, cf.Type)
+			}
+
+			if ti.ColumnExists(fn) {
+				return nil, fmt.Errorf("cached field: %s.%s: a column of the same name exists", t.Name, cf.Name)
+			}
+
+			if cf.Column == "" {
+				cf.Column = cf.Name
+			}
+
+			if cf.Key == "" {
+				cf.Key = "id"
+			}
+
+			if cols == nil {
+				cols = make(map[string]map[string]psql.CachedField)
+				sg.cachedFields = make(map[string]map[string]*CachedField)
+			}
+			if cols[ti.Name] == nil {
+				cols[ti.Name] = make(map[string]psql.CachedField)
+				sg.cachedFields[ti.Name] = make(map[string]*CachedField)
+			}
+
+			cols[ti.Name][fn] = psql.CachedField{
+				SQL:    cf.SQL,
+				Table:  cf.Table,
+				Column: cf.Column,
+				Key:    cf.Key,
+			}
+			sg.cachedFields[ti.Name][fn] = &cf
+		}
+	}
+
+	return cols, nil
+}
+
+// initFieldCaches starts refreshing the cache tables of the cached fields,
+// the fields sharing a cache table are refreshed together as often as the
+// most frequent of them
+func (sg *SuperGraph) initFieldCaches() error {
+	for _, m := range sg.cachedFields {
+		for _, cf := range m {
+			every := cf.Every
+			if every <= 0 {
+				every = defaultCacheEvery
+			}
+
+			maxStale := cf.MaxStale
+			if maxStale <= 0 {
+				maxStale = every * 2
+			}
+
+			fc, ok := sg.fieldCaches[cf.Table]
+			if !ok {
+				if sg.fieldCaches == nil {
+					sg.fieldCaches = make(map[string]*fieldCache)
+				}
+				fc = &fieldCache{table: cf.Table, every: every, maxStale: maxStale}
+				sg.fieldCaches[cf.Table] = fc
+			}
+
+			if cf.Refresh != "" {
+				fc.refresh = cf.Refresh
+			}
+			if every < fc.every {
+				fc.every = every
+			}
+			if maxStale < fc.maxStale {
+				fc.maxStale = maxStale
+			}
+		}
+	}
+
+	for _, fc := range sg.fieldCaches {
+		if fc.refresh == "" {
+			fc.refresh = "REFRESH MATERIALIZED VIEW " + psql.Postgres.QuoteIdent(fc.table)
+		}
+		go sg.refreshFieldCache(fc)
+	}
+
+	return nil
+}
+
+// refreshFieldCache refreshes the cache table on its schedule, the storage
+// is shared so only one instance refreshes it and the others get the time
+// it was refreshed at from the storage
+func (sg *SuperGraph) refreshFieldCache(fc *fieldCache) {
+	sg.loadCacheRefreshed(fc)
+
+	t := time.NewTicker(fc.every)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-sg.done:
+			return
+		case <-t.C:
+		}
+
+		if err := sg.refreshCache(fc); err != nil {
+			sg.log.Printf("WRN cached fields: %s: %s", fc.table, err)
+		}
+	}
+}
+
+// refreshCache refreshes the cache table unless another instance
+// is refreshing it in this interval
+func (sg *SuperGraph) refreshCache(fc *fieldCache) error {
+	ct, cancel := context.WithTimeout(context.Background(), fc.every)
+	defer cancel()
+
+	ok, err := sg.kv.Add(ct, kvKeyCacheRefresh+fc.table, []byte{'1'}, fc.every)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		sg.loadCacheRefreshed(fc)
+		return nil
+	}
+
+	if _, err := sg.db.ExecContext(ct, fc.refresh); err != nil {
+		return err
+	}
+
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&fc.refreshed, now)
+
+	return sg.kv.Set(ct, kvKeyCacheRefreshed+fc.table,
+		[]byte(strconv.FormatInt(now, 10)), 0)
+}
+
+// loadCacheRefreshed sets when the cache table was refreshed from
+// the storage when an other instance refreshed it later
+func (sg *SuperGraph) loadCacheRefreshed(fc *fieldCache) {
+	b, err := sg.kv.Get(context.Background(), kvKeyCacheRefreshed+fc.table)
+	if err != nil || len(b) == 0 {
+		return
+	}
+
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return
+	}
+
+	if n > atomic.LoadInt64(&fc.refreshed) {
+		atomic.StoreInt64(&fc.refreshed, n)
+	}
+}
+
+// cacheFresh returns true when the cache table was refreshed within
+// its max staleness and the cached fields can be read from it
+func (sg *SuperGraph) cacheFresh(table string) bool {
+	fc, ok := sg.fieldCaches[table]
+	if !ok {
+		return false
+	}
+
+	n := atomic.LoadInt64(&fc.refreshed)
+	return n != 0 && time.Since(time.Unix(0, n)) <= fc.maxStale
+}
+
+// cachedNames returns the names of the cached fields of a table in order
+func cachedNames(m map[string]*CachedField) []string {
+	names := make([]string, 0, len(m))
+
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
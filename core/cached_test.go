@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestCachedFields(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Tables: []Table{{
+		Name: "products",
+		Cached: []CachedField{{
+			Name:  "rating",
+			Type:  "Float",
+			SQL:   `(SELECT avg(stars) FROM reviews WHERE reviews.product_id = products.id)`,
+			Table: "product_stats",
+		}},
+	}}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.Background()
+	query := `query { products { id rating } }`
+
+	expect := func(fresh bool) {
+		mock.ExpectQuery(`\(CASE WHEN \$1 :: boolean THEN \(SELECT "__sg_c"."rating" ` +
+			`FROM "product_stats" AS "__sg_c" WHERE \(\("__sg_c"."id"\) = \("products"."id"\)\) LIMIT 1\) ` +
+			`ELSE \(\(SELECT avg\(stars\) FROM reviews WHERE reviews.product_id = products.id\)\) END\) AS "rating"`).
+			WithArgs(fresh).
+			WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+	}
+
+	// the live sql is used till the cache is refreshed
+	expect(false)
+
+	if _, err := sg.GraphQL(ct, query, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`REFRESH MATERIALIZED VIEW "product_stats"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := sg.refreshCache(sg.fieldCaches["product_stats"]); err != nil {
+		t.Fatal(err)
+	}
+
+	expect(true)
+
+	if _, err := sg.GraphQL(ct, query, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// refreshed by another instance in the interval
+	if err := sg.refreshCache(sg.fieldCaches["product_stats"]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the live sql is used once the cache is too stale
+	fc := sg.fieldCaches["product_stats"]
+	atomic.StoreInt64(&fc.refreshed, time.Now().Add(-fc.maxStale-time.Second).UnixNano())
+
+	expect(false)
+
+	if _, err := sg.GraphQL(ct, query, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+)
+
+const (
+	defaultCanaryMinRequests  = 100
+	defaultCanaryMaxErrorRate = 0.05
+)
+
+// Canary states
+const (
+	CanaryRunning int32 = iota
+	CanaryPromoted
+	CanaryRolledBack
+)
+
+// CanaryConfig struct defines how a new config is rolled out
+type CanaryConfig struct {
+	// Percent of requests sent to the new instance while the
+	// canary is running, from 0 to 100
+	Percent int
+
+	// MinRequests the new instance must serve before it's either
+	// promoted or rolled back. Defaults to 100
+	MinRequests int `mapstructure:"min_requests"`
+
+	// MaxErrorRate is how much higher the error rate of the new
+	// instance can be than the current one before it's rolled
+	// back (0.05 is 5 percentage points). Defaults to 0.05
+	MaxErrorRate float64 `mapstructure:"max_error_rate"`
+}
+
+// CanaryStats struct holds the number of requests served and
+// how many of them failed
+type CanaryStats struct {
+	Requests int64
+	Errors   int64
+}
+
+func (s CanaryStats) errorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
+
+// Canary struct routes a share of the requests to a Super Graph instance
+// created with a new config or allow list. Once the new instance has served
+// enough requests it's promoted if its error rate is close to that of the
+// current instance or rolled back if it's not. The instance that's no longer
+// used is closed.
+type Canary struct {
+	// counters are first to keep them 64-bit aligned for atomics
+	sstats canaryCounter
+	nstats canaryCounter
+	state  int32
+	conf   CanaryConfig
+	stable *SuperGraph
+	next   *SuperGraph
+	done   func(state int32, stable, next CanaryStats)
+}
+
+type canaryCounter struct {
+	requests int64
+	errors   int64
+}
+
+func (c *canaryCounter) add(err error) {
+	atomic.AddInt64(&c.requests, 1)
+	if err != nil {
+		atomic.AddInt64(&c.errors, 1)
+	}
+}
+
+func (c *canaryCounter) stats() CanaryStats {
+	return CanaryStats{
+		Requests: atomic.LoadInt64(&c.requests),
+		Errors:   atomic.LoadInt64(&c.errors),
+	}
+}
+
+// NewCanary function starts rolling out the next instance to a share of
+// the requests while the rest are served by the stable instance. The done
+// function if not nil is called once the next instance is promoted or
+// rolled back.
+func NewCanary(stable, next *SuperGraph, conf CanaryConfig,
+	done func(state int32, stable, next CanaryStats)) (*Canary, error) {
+
+	if conf.Percent < 0 || conf.Percent > 100 {
+		return nil, fmt.Errorf("canary: percent must be from 0 to 100, got %d", conf.Percent)
+	}
+
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = defaultCanaryMinRequests
+	}
+
+	if conf.MaxErrorRate <= 0 {
+		conf.MaxErrorRate = defaultCanaryMaxErrorRate
+	}
+
+	return &Canary{conf: conf, stable: stable, next: next, done: done}, nil
+}
+
+// GraphQL function runs the query on either the stable or the next instance
+func (c *Canary) GraphQL(ctx context.Context, query string, vars json.RawMessage) (*Result, error) {
+	switch atomic.LoadInt32(&c.state) {
+	case CanaryPromoted:
+		return c.next.GraphQL(ctx, query, vars)
+
+	case CanaryRolledBack:
+		return c.stable.GraphQL(ctx, query, vars)
+	}
+
+	if rand.Intn(100) >= c.conf.Percent {
+		res, err := c.stable.GraphQL(ctx, query, vars)
+		c.sstats.add(err)
+		return res, err
+	}
+
+	res, err := c.next.GraphQL(ctx, query, vars)
+	c.nstats.add(err)
+	c.check()
+
+	return res, err
+}
+
+// check promotes or rolls back the next instance once it has
+// served enough requests
+func (c *Canary) check() {
+	ns := c.nstats.stats()
+	if ns.Requests < int64(c.conf.MinRequests) {
+		return
+	}
+	ss := c.sstats.stats()
+
+	state := CanaryPromoted
+	if ns.errorRate()-ss.errorRate() > c.conf.MaxErrorRate {
+		state = CanaryRolledBack
+	}
+
+	if !atomic.CompareAndSwapInt32(&c.state, CanaryRunning, state) {
+		return
+	}
+
+	if state == CanaryPromoted {
+		c.stable.Close()
+	} else {
+		c.next.Close()
+	}
+
+	if c.done != nil {
+		c.done(state, ss, ns)
+	}
+}
+
+// Stop function rolls back a running rollout without calling the done
+// function, it's used when the rollout is replaced by another one
+func (c *Canary) Stop() {
+	if atomic.CompareAndSwapInt32(&c.state, CanaryRunning, CanaryRolledBack) {
+		c.next.Close()
+	}
+}
+
+// State function returns the state of the rollout
+func (c *Canary) State() int32 {
+	return atomic.LoadInt32(&c.state)
+}
+
+// Current function returns the instance all requests will be
+// served by once the rollout is done. Until then it's the
+// stable instance.
+func (c *Canary) Current() *SuperGraph {
+	if atomic.LoadInt32(&c.state) == CanaryPromoted {
+		return c.next
+	}
+	return c.stable
+}
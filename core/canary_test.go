@@ -0,0 +1,116 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newMockGraph(t *testing.T, dir, name, data string) *SuperGraph {
+	fn := filepath.Join(dir, name+".yml")
+
+	if err := ioutil.WriteFile(fn, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sg, err := NewSuperGraph(&Config{
+		MockData:      fn,
+		AllowListFile: filepath.Join(dir, name+".list"),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sg
+}
+
+func TestCanary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sg-canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+	query := `query { users { full_name } }`
+
+	tests := []struct {
+		name  string
+		next  *SuperGraph
+		state int32
+	}{
+		{"promoted", newMockGraph(t, dir, "good", mockYAML), CanaryPromoted},
+		{"rolled back", newMockGraph(t, dir, "bad", strings.Replace(mockYAML, "users", "people", 1)), CanaryRolledBack},
+	}
+
+	for _, tt := range tests {
+		var done bool
+
+		stable := newMockGraph(t, dir, "stable", mockYAML)
+
+		c, err := NewCanary(stable, tt.next, CanaryConfig{Percent: 50, MinRequests: 10},
+			func(state int32, _, _ CanaryStats) { done = true })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 200 && c.State() == CanaryRunning; i++ {
+			_, _ = c.GraphQL(ct, query, nil)
+		}
+
+		if c.State() != tt.state || !done {
+			t.Fatalf("%s: unexpected state %d", tt.name, c.State())
+		}
+
+		// once done all requests go to a single instance
+		_, err = c.GraphQL(ct, query, nil)
+
+		if tt.state == CanaryPromoted && (err != nil || c.Current() != tt.next) {
+			t.Fatalf("%s: expected the next instance to serve requests", tt.name)
+		}
+
+		if tt.state == CanaryRolledBack && (err != nil || c.Current() != stable) {
+			t.Fatalf("%s: expected the stable instance to serve requests", tt.name)
+		}
+
+		// the instance that's no longer used is closed
+		closed := tt.next
+		if tt.state == CanaryPromoted {
+			closed = stable
+		}
+
+		if !isClosed(closed) || isClosed(c.Current()) {
+			t.Fatalf("%s: expected only the replaced instance to be closed", tt.name)
+		}
+	}
+
+	next := newMockGraph(t, dir, "next", mockYAML)
+
+	for _, p := range []int{-1, 101} {
+		if _, err := NewCanary(next, next, CanaryConfig{Percent: p}, nil); err == nil {
+			t.Fatalf("expected an error for percent %d", p)
+		}
+	}
+
+	c, err := NewCanary(newMockGraph(t, dir, "stable", mockYAML), next, CanaryConfig{Percent: 100}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Stop()
+
+	if c.State() != CanaryRolledBack || !isClosed(next) {
+		t.Fatal("expected a stopped rollout to be rolled back and the next instance closed")
+	}
+}
+
+func isClosed(sg *SuperGraph) bool {
+	select {
+	case <-sg.done:
+		return true
+	default:
+		return false
+	}
+}
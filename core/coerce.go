@@ -0,0 +1,118 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+// coerceRules are the column types with values converted
+// from strings in variables, see Config.CoerceVariables
+type coerceRules struct {
+	number  bool
+	boolean bool
+}
+
+func (sg *SuperGraph) initCoerce() error {
+	for _, v := range sg.conf.CoerceVariables {
+		switch strings.ToLower(v) {
+		case "number":
+			sg.coerce.number = true
+		case "boolean":
+			sg.coerce.boolean = true
+		default:
+			return fmt.Errorf("coerce_variables: unknown type '%s' (expecting number or boolean)", v)
+		}
+	}
+	return nil
+}
+
+// coerceValue converts a string set for a number or boolean column to a number
+// or boolean (eg. "42" to 42 or "yes" to true), a blank string is set to null.
+// Strings that are not a number or boolean are an error
+func (sg *SuperGraph) coerceValue(typ string, v json.RawMessage) (json.RawMessage, error) {
+	if len(v) == 0 || v[0] != '"' {
+		return v, nil
+	}
+
+	number := sg.coerce.number && isNumberType(typ)
+	boolean := sg.coerce.boolean && (typ == "boolean" || typ == "bool")
+
+	if !number && !boolean {
+		return v, nil
+	}
+
+	var s string
+
+	if err := json.Unmarshal(v, &s); err != nil {
+		return nil, err
+	}
+
+	if s = strings.TrimSpace(s); s == "" {
+		return json.RawMessage(`null`), nil
+	}
+
+	if boolean {
+		switch strings.ToLower(s) {
+		case "true", "t", "yes", "y", "on", "1":
+			return json.RawMessage(`true`), nil
+		case "false", "f", "no", "n", "off", "0":
+			return json.RawMessage(`false`), nil
+		}
+		return nil, fmt.Errorf("invalid boolean: %s", s)
+	}
+
+	// only plain numbers are accepted (not eg. Inf or 0x10)
+	if c := s[0]; (c != '-' && (c < '0' || c > '9')) || !json.Valid([]byte(s)) {
+		return nil, fmt.Errorf("invalid number: %s", s)
+	}
+
+	if isIntType(typ) {
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid integer: %s", s)
+		}
+	}
+
+	return json.RawMessage(s), nil
+}
+
+// coerceArg is coerceValue for a variable bound to a param,
+// each value of a list is converted
+func (sg *SuperGraph) coerceArg(p psql.Param, v json.RawMessage) (json.RawMessage, error) {
+	if !p.IsArray || v[0] != '[' {
+		return sg.coerceValue(p.Type, v)
+	}
+
+	var list []json.RawMessage
+
+	if err := json.Unmarshal(v, &list); err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		var err error
+		if list[i], err = sg.coerceValue(p.Type, list[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(list)
+}
+
+// isNumberType returns true for the integer, decimal and float types,
+// money is left out since postgres takes it formatted (eg. $1.50)
+func isNumberType(t string) bool {
+	if n := strings.IndexByte(t, '('); n != -1 {
+		t = t[:n]
+	}
+
+	switch strings.TrimSpace(t) {
+	case "smallserial", "serial", "bigserial", "decimal", "numeric",
+		"real", "float4", "float8", "double precision":
+		return true
+	}
+	return isIntType(t)
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+type jsonArg string
+
+func (a jsonArg) Match(v driver.Value) bool {
+	b, ok := v.([]byte)
+	return ok && strings.Contains(string(b), string(a))
+}
+
+func TestCoerceVariables(t *testing.T) {
+	sg := &SuperGraph{conf: &Config{CoerceVariables: []string{"number", "boolean"}}}
+
+	if err := sg.initCoerce(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		typ string
+		val string
+		exp string
+		err string
+	}{
+		{"integer", `" 42 "`, `42`, ""},
+		{"numeric(7,2)", `"-12.50"`, `-12.50`, ""},
+		{"double precision", `"1e3"`, `1e3`, ""},
+		{"bigint", `""`, `null`, ""},
+		{"boolean", `"Yes"`, `true`, ""},
+		{"boolean", `"0"`, `false`, ""},
+		{"integer", `7`, `7`, ""},
+		{"text", `"42"`, `"42"`, ""},
+		{"money", `"$1.50"`, `"$1.50"`, ""},
+		{"integer", `"1.5"`, ``, "invalid integer"},
+		{"real", `"Inf"`, ``, "invalid number"},
+		{"numeric", `"0x10"`, ``, "invalid number"},
+		{"boolean", `"maybe"`, ``, "invalid boolean"},
+	}
+
+	for _, v := range tests {
+		res, err := sg.coerceValue(v.typ, json.RawMessage(v.val))
+
+		if v.err != "" {
+			if err == nil || !strings.Contains(err.Error(), v.err) {
+				t.Fatalf("%s %s: expected the error '%s' got %v", v.typ, v.val, v.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(res) != v.exp {
+			t.Fatalf("%s %s: expected %s got %s", v.typ, v.val, v.exp, res)
+		}
+	}
+
+	if err := (&SuperGraph{conf: &Config{CoerceVariables: []string{"date"}}}).initCoerce(); err == nil {
+		t.Fatal("expected an error for an unknown type")
+	}
+}
+
+func TestCoerceMutation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{CoerceVariables: []string{"number"}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`INSERT INTO "products"`).
+		WithArgs(jsonArg(`"price":12.5`)).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"product": {"id": 5}}`))
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+	vars := json.RawMessage(`{"data": {"name": "Bag", "price": "12.5"}}`)
+
+	if _, err := sg.GraphQL(ct, `mutation { product(insert: $data) { id } }`, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	vars = json.RawMessage(`{"data": {"name": "Bag", "price": "twelve"}}`)
+
+	_, err = sg.GraphQL(ct, `mutation { product(insert: $data) { id } }`, vars)
+	if err == nil || !strings.Contains(err.Error(), "invalid number: twelve") {
+		t.Fatalf("expected an invalid number error got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,238 @@
+package core
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+const defaultCompileCacheSize = 1000
+
+// compileCache is an LRU of the compiled queries keyed by the fingerprint
+// of the query, role and compile options. It's only used when the allow
+// list is not (in production the allow list queries are compiled once).
+// The SQL of a hit is the same string so the statement prepared for it by
+// the driver on each connection is reused too.
+type compileCache struct {
+	sync.Mutex
+	max int
+	ll  *list.List
+	m   map[string]*list.Element
+
+	// gen changes on a flush so compiles that started
+	// before it are not added
+	gen uint64
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type compileEntry struct {
+	key     string
+	st      stmt
+	stmts   []stmt
+	roleArg bool
+}
+
+// CompileCacheStats are the counters of the compiled query cache
+type CompileCacheStats struct {
+	Entries   int    `json:"entries"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+func newCompileCache(size int) *compileCache {
+	if size < 0 {
+		return nil
+	}
+	if size == 0 {
+		size = defaultCompileCacheSize
+	}
+
+	return &compileCache{
+		max: size,
+		ll:  list.New(),
+		m:   make(map[string]*list.Element),
+	}
+}
+
+func (c *compileCache) get(k string) (*compileEntry, uint64, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	if e, ok := c.m[k]; ok {
+		c.hits++
+		c.ll.MoveToFront(e)
+		return e.Value.(*compileEntry), c.gen, true
+	}
+
+	c.misses++
+	return nil, c.gen, false
+}
+
+func (c *compileCache) set(gen uint64, ce *compileEntry) {
+	c.Lock()
+	defer c.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+
+	if e, ok := c.m[ce.key]; ok {
+		e.Value = ce
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.m[ce.key] = c.ll.PushFront(ce)
+
+	if c.ll.Len() > c.max {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.m, e.Value.(*compileEntry).key)
+		c.evictions++
+	}
+}
+
+func (c *compileCache) flush() {
+	c.Lock()
+	c.ll.Init()
+	c.m = make(map[string]*list.Element)
+	c.gen++
+	c.Unlock()
+}
+
+func (c *compileCache) stats() CompileCacheStats {
+	c.Lock()
+	defer c.Unlock()
+
+	return CompileCacheStats{
+		Entries:   c.ll.Len(),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+// compileCached compiles the query or takes it from the cache, only queries
+// are cached since mutations are compiled with their variables
+func (sg *SuperGraph) compileCached(cq *cquery, role string) error {
+	cc := sg.compiled
+
+	// the sql fragments of trusted callers differ with each request
+	if cc == nil || cq.q.op != qcode.QTQuery || cq.frags != nil {
+		return sg.compileQueryFn(cq, role)
+	}
+
+	k := compileKey(cq, role)
+
+	ce, gen, ok := cc.get(k)
+	if ok {
+		cq.st, cq.stmts, cq.roleArg = ce.st, ce.stmts, ce.roleArg
+		cq.cached = true
+		return nil
+	}
+
+	if err := sg.compileQueryFn(cq, role); err != nil {
+		return err
+	}
+
+	// the sql depends on the values of the @skip and @include variables
+	if cq.st.md.HasDirectiveVars() {
+		return nil
+	}
+
+	cc.set(gen, &compileEntry{key: k, st: cq.st, stmts: cq.stmts, roleArg: cq.roleArg})
+	return nil
+}
+
+func compileKey(cq *cquery, role string) string {
+	h := sha256.New()
+	h.Write(fingerprint(cq.q.query)) //nolint: errcheck
+
+	k := make([]byte, 0, sha256.Size+len(role)+2)
+	k = h.Sum(k)
+	k = append(k, role...)
+
+	if cq.md.Lenient {
+		k = append(k, 0, 'l')
+	}
+	if cq.md.Stream {
+		k = append(k, 0, 's')
+	}
+	return string(k)
+}
+
+// fingerprint returns the query with the whitespace, commas and comments
+// that don't change its meaning removed. Strings are kept as is.
+func fingerprint(q []byte) []byte {
+	b := make([]byte, 0, len(q))
+	space := false
+
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			space = true
+			continue
+
+		case c == '#':
+			for i < len(q) && q[i] != '\n' {
+				i++
+			}
+			space = true
+			continue
+		}
+
+		if space && len(b) != 0 && isNameChar(b[len(b)-1]) && isNameChar(c) {
+			b = append(b, ' ')
+		}
+		space = false
+
+		if c != '"' {
+			b = append(b, c)
+			continue
+		}
+
+		// copy the string, block strings ("""...""") included
+		s := i
+		if i+2 < len(q) && q[i+1] == '"' && q[i+2] == '"' {
+			for i += 3; i < len(q); i++ {
+				if q[i] == '"' && i+2 < len(q) && q[i+1] == '"' && q[i+2] == '"' && q[i-1] != '\\' {
+					i += 2
+					break
+				}
+			}
+		} else {
+			for i++; i < len(q) && q[i] != '"'; i++ {
+				if q[i] == '\\' {
+					i++
+				}
+			}
+		}
+
+		if i >= len(q) {
+			i = len(q) - 1
+		}
+		b = append(b, q[s:i+1]...)
+	}
+
+	return b
+}
+
+func isNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_'
+}
+
+// CompileCacheStats function returns the counters of the compiled query cache
+func (sg *SuperGraph) CompileCacheStats() CompileCacheStats {
+	if sg.compiled == nil {
+		return CompileCacheStats{}
+	}
+	return sg.compiled.stats()
+}
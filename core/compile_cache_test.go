@@ -0,0 +1,88 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+func TestFingerprint(t *testing.T) {
+	same := [][2]string{
+		{`query { products(limit: 5, where: { name: { eq: "a  b" } }) { id name } }`,
+			"query {\n  products(limit: 5 where: {name: {eq: \"a  b\"}}) {\n    id, name # the name\n  }\n}"},
+		{`{ products { id } }`, `  {products{id}}  `},
+	}
+
+	for _, v := range same {
+		if a, b := string(fingerprint([]byte(v[0]))), string(fingerprint([]byte(v[1]))); a != b {
+			t.Errorf("expected the same fingerprint:\n%s\n%s", a, b)
+		}
+	}
+
+	diff := [][2]string{
+		{`{ products { id name } }`, `{ products { idname } }`},
+		{`{ products(where: { name: { eq: "a b" } }) { id } }`, `{ products(where: { name: { eq: "ab" } }) { id } }`},
+		{`{ products(where: { name: { eq: "# a" } }) { id } }`, `{ products(where: { name: { eq: "" } }) { id } }`},
+	}
+
+	for _, v := range diff {
+		if a, b := string(fingerprint([]byte(v[0]))), string(fingerprint([]byte(v[1]))); a == b {
+			t.Errorf("expected different fingerprints: %s", a)
+		}
+	}
+}
+
+func TestCompileCache(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{CompileCacheSize: 2}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compile := func(query string) *cquery {
+		cq := &cquery{q: rquery{op: qcode.QTQuery, query: []byte(query)}}
+		if err := sg.compileQuery(cq, "user"); err != nil {
+			t.Fatal(err)
+		}
+		return cq
+	}
+
+	q1 := compile(`query { products { id } }`)
+	q2 := compile("query {\n  products {\n    id\n  }\n}")
+
+	if q1.st.sql != q2.st.sql {
+		t.Fatal("expected the same sql from the cache")
+	}
+
+	compile(`query { users { id } }`)
+	compile(`query { customers { id } }`)
+
+	s := sg.CompileCacheStats()
+
+	if s.Hits != 1 || s.Misses != 3 || s.Evictions != 1 || s.Entries != 2 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+
+	sg.FlushCache()
+
+	if s := sg.CompileCacheStats(); s.Entries != 0 {
+		t.Fatalf("expected an empty cache: %+v", s)
+	}
+
+	if sg, err = newTestGraph(t, &Config{CompileCacheSize: -1}, db, psql.GetTestDBInfo()); err != nil {
+		t.Fatal(err)
+	}
+
+	compile(`query { products { id } }`)
+
+	if s := sg.CompileCacheStats(); s.Misses != 0 {
+		t.Fatalf("expected the cache to be off: %+v", s)
+	}
+}
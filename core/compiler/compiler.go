@@ -0,0 +1,273 @@
+// Package compiler provides the Super Graph GraphQL to SQL compiler as a standalone
+// module. It does not need a database connection or network access, the database
+// schema is passed in instead. This makes it possible to build it for targets like
+// WASM to validate queries and preview the generated SQL in editor plugins or the
+// admin web UI.
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// Schema struct describes the database tables and columns to compile queries against
+type Schema struct {
+	// Version of the database (eg. 110000 for Postgres 11)
+	Version   int      `json:"version"`
+	Tables    []Table  `json:"tables"`
+	Blocklist []string `json:"blocklist"`
+}
+
+// Table struct defines a database table
+type Table struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Columns []Column `json:"columns"`
+}
+
+// Column struct defines a database column. ForeignKey is in the
+// format <table>.<column>
+type Column struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	NotNull    bool   `json:"not_null"`
+	PrimaryKey bool   `json:"primary_key"`
+	UniqueKey  bool   `json:"unique_key"`
+	Array      bool   `json:"array"`
+	ForeignKey string `json:"related_to"`
+	Generated  bool   `json:"generated"`
+	Identity   string `json:"identity"`
+}
+
+// Config struct contains the compiler config values
+type Config struct {
+	DefaultBlock bool              `json:"default_block"`
+	Vars         map[string]string `json:"variables"`
+	Roles        []Role            `json:"roles"`
+}
+
+// Role struct contains role specific access control values for database tables
+type Role struct {
+	Name   string      `json:"name"`
+	Tables []RoleTable `json:"tables"`
+}
+
+// RoleTable struct contains role specific access control values for a database table
+type RoleTable struct {
+	Name     string  `json:"name"`
+	ReadOnly bool    `json:"read_only"`
+	Query    *Query  `json:"query"`
+	Insert   *Insert `json:"insert"`
+	Update   *Update `json:"update"`
+	Delete   *Delete `json:"delete"`
+}
+
+// Query struct contains access control values for query operations
+type Query struct {
+	Limit            int      `json:"limit"`
+	Filters          []string `json:"filters"`
+	Columns          []string `json:"columns"`
+	DisableFunctions bool     `json:"disable_functions"`
+	Block            bool     `json:"block"`
+}
+
+// Insert struct contains access control values for insert operations
+type Insert struct {
+	Filters []string          `json:"filters"`
+	Columns []string          `json:"columns"`
+	Presets map[string]string `json:"presets"`
+	Block   bool              `json:"block"`
+}
+
+// Update struct contains access control values for update operations
+type Update struct {
+	Filters []string          `json:"filters"`
+	Columns []string          `json:"columns"`
+	Presets map[string]string `json:"presets"`
+	Block   bool              `json:"block"`
+}
+
+// Delete struct contains access control values for delete operations
+type Delete struct {
+	Filters []string `json:"filters"`
+	Columns []string `json:"columns"`
+	Block   bool     `json:"block"`
+}
+
+// Compiler struct holds the compiled schema and role config, it's safe for
+// concurrent use.
+type Compiler struct {
+	qc *qcode.Compiler
+	pc *psql.Compiler
+}
+
+// Result struct contains the generated SQL and the names of the variables
+// it expects in order of their placeholders ($1, $2, etc)
+type Result struct {
+	SQL    string   `json:"sql"`
+	Params []string `json:"params"`
+}
+
+// New function creates a new compiler for the schema and config
+func New(s Schema, conf Config) (*Compiler, error) {
+	di, err := newDBInfo(s)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := psql.NewDBSchema(di, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	qc, err := qcode.NewCompiler(qcode.WithDefaultBlock(conf.DefaultBlock))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range conf.Roles {
+		for _, t := range r.Tables {
+			if err := addRole(qc, r.Name, t, conf.DefaultBlock); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	pc := psql.NewCompiler(psql.Config{
+		Schema: schema,
+		Vars:   conf.Vars,
+	})
+
+	return &Compiler{qc: qc, pc: pc}, nil
+}
+
+// Compile function compiles the GraphQL query into SQL for the role
+func (co *Compiler) Compile(query []byte, vars json.RawMessage, role string) (Result, error) {
+	var res Result
+	var vm map[string]json.RawMessage
+
+	if len(vars) != 0 {
+		if err := json.Unmarshal(vars, &vm); err != nil {
+			return res, err
+		}
+	}
+
+	qc, err := co.qc.Compile(query, role)
+	if err != nil {
+		return res, err
+	}
+
+	var w bytes.Buffer
+
+	md, err := co.pc.Compile(&w, qc, psql.Variables(vm))
+	if err != nil {
+		return res, err
+	}
+
+	res.SQL = w.String()
+
+	for _, p := range md.Params() {
+		res.Params = append(res.Params, p.Name)
+	}
+
+	return res, nil
+}
+
+// Validate function returns an error if the GraphQL query cannot be compiled for the role
+func (co *Compiler) Validate(query []byte, role string) error {
+	_, err := co.Compile(query, nil, role)
+	return err
+}
+
+func newDBInfo(s Schema) (*psql.DBInfo, error) {
+	tables := make([]psql.DBTable, len(s.Tables))
+	columns := make([][]psql.DBColumn, len(s.Tables))
+
+	// column ids indexed by table and column name used to
+	// resolve the foreign keys
+	cm := make(map[string]int16)
+
+	for i, t := range s.Tables {
+		tables[i] = psql.DBTable{ID: i, Name: t.Name, Type: t.Type}
+
+		if tables[i].Type == "" {
+			tables[i].Type = "table"
+		}
+
+		cols := make([]psql.DBColumn, len(t.Columns))
+
+		for n, c := range t.Columns {
+			cols[n] = psql.DBColumn{
+				ID:         int16(n + 1),
+				Name:       c.Name,
+				Type:       c.Type,
+				Array:      c.Array,
+				NotNull:    c.NotNull,
+				PrimaryKey: c.PrimaryKey,
+				UniqueKey:  c.UniqueKey || c.PrimaryKey,
+				Generated:  c.Generated,
+				Identity:   c.Identity,
+			}
+			cm[strings.ToLower(t.Name+"."+c.Name)] = cols[n].ID
+		}
+		columns[i] = cols
+	}
+
+	for i, t := range s.Tables {
+		for n, c := range t.Columns {
+			if c.ForeignKey == "" {
+				continue
+			}
+
+			v := strings.SplitN(c.ForeignKey, ".", 2)
+			if len(v) != 2 {
+				return nil, fmt.Errorf("invalid foreign key defined for table '%s' and column '%s': %s",
+					t.Name, c.Name, c.ForeignKey)
+			}
+
+			id, ok := cm[strings.ToLower(c.ForeignKey)]
+			if !ok {
+				return nil, fmt.Errorf("foreign key for table '%s' and column '%s' points to unknown column '%s'",
+					t.Name, c.Name, c.ForeignKey)
+			}
+
+			columns[i][n].FKeyTable = v[0]
+			columns[i][n].FKeyColID = []int16{id}
+		}
+	}
+
+	return psql.NewDBInfo(s.Version, tables, columns, nil, s.Blocklist), nil
+}
+
+func addRole(qc *qcode.Compiler, role string, t RoleTable, defaultBlock bool) error {
+	ro := t.ReadOnly || (defaultBlock && role == "anon")
+
+	trc := qcode.TRConfig{
+		Insert: qcode.InsertConfig{Block: ro},
+		Update: qcode.UpdateConfig{Block: ro},
+		Delete: qcode.DeleteConfig{Block: ro},
+	}
+
+	if t.Query != nil {
+		trc.Query = qcode.QueryConfig(*t.Query)
+	}
+
+	if t.Insert != nil {
+		trc.Insert = qcode.InsertConfig(*t.Insert)
+	}
+
+	if t.Update != nil {
+		trc.Update = qcode.UpdateConfig(*t.Update)
+	}
+
+	if t.Delete != nil {
+		trc.Delete = qcode.DeleteConfig(*t.Delete)
+	}
+
+	return qc.AddRole(role, t.Name, trc)
+}
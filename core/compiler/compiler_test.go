@@ -0,0 +1,68 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+var testSchema = Schema{
+	Version: 110000,
+	Tables: []Table{
+		{Name: "users", Columns: []Column{
+			{Name: "id", Type: "bigint", NotNull: true, PrimaryKey: true},
+			{Name: "email", Type: "character varying", NotNull: true},
+			{Name: "password", Type: "character varying"},
+		}},
+		{Name: "products", Columns: []Column{
+			{Name: "id", Type: "bigint", NotNull: true, PrimaryKey: true},
+			{Name: "name", Type: "character varying"},
+			{Name: "user_id", Type: "bigint", ForeignKey: "users.id"},
+		}},
+	},
+	Blocklist: []string{"password"},
+}
+
+func TestCompile(t *testing.T) {
+	co, err := New(testSchema, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := co.Compile([]byte(`query { products(where: { id: { eq: $id } }) { id name user { email } } }`),
+		nil, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(res.SQL, `"users"`) || !strings.Contains(res.SQL, `"products"`) {
+		t.Fatalf("unexpected sql: %s", res.SQL)
+	}
+
+	if len(res.Params) != 1 || res.Params[0] != "id" {
+		t.Fatalf("expected a single param 'id' got: %v", res.Params)
+	}
+}
+
+func TestCompileBlocked(t *testing.T) {
+	co, err := New(testSchema, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := co.Validate([]byte(`query { users { id password } }`), "user"); err == nil {
+		t.Fatal("expecting an error for a blocked column")
+	}
+}
+
+func TestInvalidForeignKey(t *testing.T) {
+	s := Schema{Tables: []Table{
+		{Name: "products", Columns: []Column{
+			{Name: "id", Type: "bigint", PrimaryKey: true},
+			{Name: "user_id", Type: "bigint", ForeignKey: "users.id"},
+		}},
+	}}
+
+	if _, err := New(s, Config{}); err == nil {
+		t.Fatal("expecting an error for an unknown foreign key")
+	}
+}
@@ -0,0 +1,69 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Main package for the WASM build of the Super Graph compiler. It registers a
+// global javascript function `sgCompile(schema, config, query, vars, role)` that
+// returns an object with either the `sql` and `params` or an `error`.
+//
+// Build with: GOOS=js GOARCH=wasm go build -o compiler.wasm ./core/compiler/wasm
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"github.com/dosco/super-graph/core/compiler"
+)
+
+func main() {
+	js.Global().Set("sgCompile", js.FuncOf(compile))
+
+	// block forever so the exported function stays available
+	select {}
+}
+
+func compile(this js.Value, args []js.Value) interface{} {
+	if len(args) != 5 {
+		return errorResult("expecting 5 arguments: schema, config, query, vars and role")
+	}
+
+	var schema compiler.Schema
+	var conf compiler.Config
+
+	if err := json.Unmarshal([]byte(args[0].String()), &schema); err != nil {
+		return errorResult(err.Error())
+	}
+
+	if err := json.Unmarshal([]byte(args[1].String()), &conf); err != nil {
+		return errorResult(err.Error())
+	}
+
+	co, err := compiler.New(schema, conf)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+
+	var vars json.RawMessage
+	if v := args[3].String(); v != "" {
+		vars = json.RawMessage(v)
+	}
+
+	res, err := co.Compile([]byte(args[2].String()), vars, args[4].String())
+	if err != nil {
+		return errorResult(err.Error())
+	}
+
+	params := make([]interface{}, len(res.Params))
+	for i := range res.Params {
+		params[i] = res.Params[i]
+	}
+
+	return map[string]interface{}{
+		"sql":    res.SQL,
+		"params": params,
+	}
+}
+
+func errorResult(msg string) interface{} {
+	return map[string]interface{}{"error": msg}
+}
@@ -26,20 +26,47 @@ type Config struct {
 	// path is assumed to be the same as the config path (allow.list)
 	AllowListFile string `mapstructure:"allow_list_file"`
 
+	// QueryRegistry is the path of the registry file of the approved queries
+	// and their versions. When set the current versions in it are the queries
+	// that can run in production instead of the ones in the allow list file
+	QueryRegistry string `mapstructure:"query_registry"`
+
 	// SetUserID forces the database session variable `user.id` to
 	// be set to the user id. This variables can be used by triggers
 	// or other database functions
 	SetUserID bool `mapstructure:"set_user_id"`
 
+	// SessionVars are Postgres settings (eg. app.current_user_id) set in the
+	// transaction of every request so the audit triggers in the database can
+	// read them with current_setting. A value can be $user_id, $user_id_provider,
+	// $user_role, $role (the role the query is run as), a claim of the user
+	// (eg. $tenant_id) or a constant
+	SessionVars map[string]string `mapstructure:"session_vars"`
+
 	// DefaultBlock ensures that in anonymous mode (role 'anon') all tables
 	// are blocked from queries and mutations. To open access to tables in
 	// anonymous mode they have to be added to the 'anon' role config.
 	DefaultBlock bool `mapstructure:"default_block"`
 
+	// ReadOnly is for query only deployments, mutations are rejected for
+	// every role. The database user is expected to only have SELECT on the
+	// tables, a warning is logged at startup if it can write to them
+	ReadOnly bool `mapstructure:"read_only"`
+
 	// Vars is a map of hardcoded variables that can be leveraged in your
 	// queries (eg. variable admin_id will be $admin_id in the query)
 	Vars map[string]string `mapstructure:"variables"`
 
+	// Constants are server defined values queries use as variables with
+	// the path to the value (eg. $env.max_rows), they're set when the query
+	// is compiled so the same persisted query can be tuned per environment
+	Constants map[string]interface{}
+
+	// Filters are named filters queries can use by name in the where
+	// argument (eg. `where: { filter: active_users }`) keeping complex
+	// filters in one place
+	Filters map[string]string
+
 	// Blocklist is a list of tables and columns that should be filtered
 	// out from any and all queries
 	Blocklist []string
@@ -48,6 +75,14 @@ type Config struct {
 	// creating relationships between tables, etc
 	Tables []Table
 
+	// SQLQueries are named raw sql queries selected like tables, they're
+	// kept in the config so they are reviewed along with it
+	SQLQueries []SQLQuery `mapstructure:"sql_queries"`
+
+	// Namespaces group tables under a root field of the namespace name
+	// (eg. `billing { invoices { id } }`) to keep large schemas navigable
+	Namespaces []Namespace
+
 	// RolesQuery if set enabled attributed based access control. This query
 	// is used to fetch the user attributes that then dynamically define the users
 	// role.
@@ -68,6 +103,15 @@ type Config struct {
 	// Database schema name. Defaults to 'public'
 	DBSchema string `mapstructure:"db_schema"`
 
+	// Schemas are other schemas of the database whose tables are added,
+	// they can be related to the tables of the default schema
+	Schemas []Schema
+
+	// DBType is the database queried, postgres (default) or mysql. Only
+	// queries are supported with MySQL 8.0.17 or later and not mutations,
+	// subscriptions or the features specific to Postgres (eg. search)
+	DBType string `mapstructure:"db_type"`
+
 	// Log warnings and other debug information
 	Debug bool
 
@@ -78,6 +122,309 @@ type Config struct {
 	// this sets the duration (in seconds) between requests.
 	// Defaults to 5 seconds
 	PollDuration time.Duration `mapstructure:"poll_every_seconds"`
+
+	// FailoverRetries is the number of times a query is retried when the
+	// database fails over (eg. closed connections or the server became
+	// read-only). Idle connections are closed before each retry so the
+	// database host is re-resolved. Defaults to 0 (no retries)
+	FailoverRetries int `mapstructure:"failover_retries"`
+
+	// MaxIdleConns is the number of idle connections kept in the database
+	// pools, it's set again after they're closed for a failover. Defaults
+	// to 2 (the database/sql default)
+	MaxIdleConns int `mapstructure:"max_idle_conns"`
+
+	// SerializableMutations runs mutations in transactions at the SERIALIZABLE
+	// isolation level. A mutation that conflicts with another transaction
+	// fails with a serialization failure and is run again up to
+	// SerializableRetries times. Defaults to 3 retries
+	SerializableMutations bool `mapstructure:"serializable_mutations"`
+	SerializableRetries   int  `mapstructure:"serializable_retries"`
+
+	// MockData is the path to a yaml file with tables and rows to serve
+	// from memory instead of the database. Only queries are supported,
+	// it's useful for demos and testing without Postgres
+	MockData string `mapstructure:"mock_data"`
+
+	// LenientMode drops unknown columns from queries and returns a warning
+	// in the response extensions instead of failing. Useful when the same
+	// queries are used against databases at different migration stages.
+	// Defaults to false (strict mode)
+	LenientMode bool `mapstructure:"lenient_mode"`
+
+	// Relay enables the Relay node root field, global ids and
+	// connections (edges and pageInfo) for Relay clients. The id of
+	// tables is returned and taken as an opaque global id
+	Relay bool `mapstructure:"relay"`
+
+	// Lint runs the lint rules on queries in development and returns the
+	// issues found as warnings in the response extensions
+	Lint bool `mapstructure:"lint"`
+
+	// LintSkip turns off builtin lint rules by name (eg. require_typename)
+	LintSkip []string `mapstructure:"lint_skip"`
+
+	// LintRules are custom lint rules run after the builtin
+	// ones. They can only be set in code
+	LintRules []LintRule `mapstructure:"-"`
+
+	// Rewrites are rules that change matching queries before they are
+	// compiled. They are an escape hatch to mitigate problem queries
+	// without waiting on client changes
+	Rewrites []Rewrite
+
+	// Directives are handlers for custom directives on table selections
+	// (eg. @tenant(id: 5)) keyed by the directive name. They can only be
+	// set in code
+	Directives map[string]DirectiveFunc `mapstructure:"-"`
+
+	// Formatters are custom column formats (eg. markdown to html) keyed by
+	// the format name used in the table columns. They can only be set in code
+	Formatters map[string]FormatterFunc `mapstructure:"-"`
+
+	// Hooks are functions run before the query is parsed, after it's compiled
+	// and after it's run. They can only be set in code
+	Hooks Hooks `mapstructure:"-"`
+
+	// ComputedFields are fields with values computed by Go functions keyed
+	// by the table and then the field name. They can only be set in code
+	ComputedFields map[string]map[string]ComputedField `mapstructure:"-"`
+
+	// FeatureFlags turn on compiler behaviors for a percent of the
+	// requests (eg. lenient_mode) to roll out changes safely
+	FeatureFlags []FeatureFlag `mapstructure:"feature_flags"`
+
+	// FlagProvider is an external feature flag service used instead of
+	// the percents in FeatureFlags. It can only be set in code
+	FlagProvider FlagProvider `mapstructure:"-"`
+
+	// CoerceVariables are the column types (number and boolean) with values
+	// converted from strings in variables (eg. "42" or "true") for clients
+	// like html forms that send every value as a string. A blank string is
+	// set to null. Defaults to no coercion
+	CoerceVariables []string `mapstructure:"coerce_variables"`
+
+	// MaxQueryBytes is the max size of a query, larger queries are rejected
+	// before they are parsed. Defaults to 1MB
+	MaxQueryBytes int `mapstructure:"max_query_bytes"`
+
+	// MaxNameLength is the max length of the names in a query (fields,
+	// aliases, arguments and variables). Defaults to 256
+	MaxNameLength int `mapstructure:"max_name_length"`
+
+	// MaxSelectors, MaxFields and MaxArgs are the max number of tables, fields
+	// and arguments in a query, more complex queries are rejected. Zero keeps
+	// the defaults
+	MaxSelectors int `mapstructure:"max_selectors"`
+	MaxFields    int `mapstructure:"max_fields"`
+	MaxArgs      int `mapstructure:"max_args"`
+
+	// MaxDepth is the max nesting of the fields of a query and MaxCost its
+	// max complexity, the cost of a table is 1 (or its cost in FieldCosts)
+	// times the rows of the lists it's nested in. When set the cost of a
+	// query is returned in the response extensions. Defaults to no limit
+	MaxDepth int `mapstructure:"max_depth"`
+	MaxCost  int `mapstructure:"max_cost"`
+
+	// FieldCosts are the costs of tables (eg. products) and
+	// of fields of a table (eg. products.search_rank)
+	FieldCosts map[string]int `mapstructure:"field_costs"`
+
+	// MaxResultBytes is the max size of the result of a query, larger
+	// results are not returned. Defaults to no limit
+	MaxResultBytes int `mapstructure:"max_result_bytes"`
+
+	// MaxLimit is the max a limit set from a variable (eg. limit: $n) is
+	// clamped to. Defaults to 1000
+	MaxLimit int `mapstructure:"max_limit"`
+
+	// MaxRemoteSortRows is the max number of rows of a root ordered by the
+	// fields of a remote selection, the rows are sorted in memory once the
+	// remote data is joined. Defaults to 1000
+	MaxRemoteSortRows int `mapstructure:"max_remote_sort_rows"`
+
+	// ParallelRoots is the number of root selections (eg. the lists of a
+	// dashboard) a query needs to have its roots run as separate statements
+	// at the same time on their own connections. Defaults to 0 (off)
+	ParallelRoots int `mapstructure:"parallel_roots"`
+
+	// SplitSQLBytes is the size of the sql of a query over which its roots
+	// are run as separate statements one after the other, a few smaller
+	// statements are easier to plan for the database than a huge one.
+	// Defaults to 0 (off)
+	SplitSQLBytes int `mapstructure:"split_sql_bytes"`
+
+	// StreamBatchSize is the number of rows fetched at a time by
+	// GraphQLStream. Defaults to 1000
+	StreamBatchSize int `mapstructure:"stream_batch_size"`
+
+	// StreamMaxRows is the max number of rows returned by GraphQLStream, the
+	// response ends with an error past it. Defaults to 100000, -1 turns it off
+	StreamMaxRows int `mapstructure:"stream_max_rows"`
+
+	// QueryTimeout is the max time a query runs for, past it the query
+	// is canceled in the database and a QUERY_TIMEOUT error returned. The
+	// timeout of the query name in QueryTimeouts comes first and then the
+	// one of the role. Defaults to no timeout
+	QueryTimeout time.Duration `mapstructure:"query_timeout"`
+
+	// QueryTimeouts are the timeouts of queries keyed by the query name
+	// (eg. salesReport: 2m) for the long running analytical queries
+	QueryTimeouts map[string]time.Duration `mapstructure:"query_timeouts"`
+
+	// ConstraintErrors are the messages of the constraint violations of
+	// mutations keyed by the constraint name (eg. users_email_key: email
+	// already taken). {table}, {column} and {constraint} in them are
+	// replaced with their names
+	ConstraintErrors map[string]string `mapstructure:"constraint_errors"`
+
+	// CartesianJoins is what's done with the joins of a query on columns
+	// that are unique on neither side (eg. a relationship set with
+	// related_to on a column that's not a key), warn adds a warning to the
+	// response, reject fails the query and allow runs it as is. Defaults
+	// to warn
+	CartesianJoins string `mapstructure:"cartesian_joins"`
+
+	// Budget limits the sql statements, remote calls and
+	// time of each request
+	Budget Budget
+
+	// MaxErrors is the number of errors (eg. unknown fields and bad
+	// arguments) returned together for a query. Defaults to 10
+	MaxErrors int `mapstructure:"max_errors"`
+
+	// QueryTags are tags (eg. owner, team, feature) of queries keyed by the
+	// query name, they're added to the logs, metrics and sql comments of
+	// the queries. Tags can also be set in the allow list comments
+	// with @key:value
+	QueryTags map[string]map[string]string `mapstructure:"query_tags"`
+
+	// CompileCacheSize is the number of compiled queries kept so the same
+	// query is not compiled again when the allow list is not used.
+	// Defaults to 1000, -1 turns it off
+	CompileCacheSize int `mapstructure:"compile_cache_size"`
+
+	// Storage is the key value store shared by the persisted queries, the
+	// allow list, the idempotency keys and the rate limits
+	Storage Storage
+
+	// KVStore is a custom key value store used instead of the one
+	// set in Storage. It can only be set in code
+	KVStore KVStore `mapstructure:"-"`
+
+	// PersistedQueries enables automatic persisted queries (APQ) as
+	// supported by Apollo Client
+	PersistedQueries PersistedQueries `mapstructure:"persisted_queries"`
+
+	// PersistedStore is a custom store for the persisted queries used
+	// instead of the one set in PersistedQueries. It can only be set in code
+	PersistedStore PersistedStore `mapstructure:"-"`
+
+	// ResultCache caches the results of queries for a time set with the
+	// @cacheControl directive or in the config, mutations drop the cached
+	// results of the tables they change
+	ResultCache ResultCache `mapstructure:"result_cache"`
+
+	// ResultStore is a custom store for the cached results used instead
+	// of the one set in ResultCache. It can only be set in code
+	ResultStore ResultStore `mapstructure:"-"`
+
+	// SlowQuery samples the plans of the queries slower than a threshold
+	// with EXPLAIN ANALYZE and keeps them in the storage
+	SlowQuery SlowQuery `mapstructure:"slow_query"`
+
+	// Planner keeps statistics of the queries in memory and tunes the
+	// join strategies of the related tables from them
+	Planner Planner
+
+	// Metering counts the operations, rows and database time of each
+	// api key or tenant and limits them to their quotas
+	Metering Metering
+
+	// UsageStore is a custom store for the usage metered used instead
+	// of the one in memory. It can only be set in code
+	UsageStore UsageStore `mapstructure:"-"`
+
+	// Blobs configures the object storage (eg. S3 or GCS) the
+	// values of the blob columns are uploaded to
+	Blobs Blobs
+
+	// BlobStore is a custom store for the blob columns used instead
+	// of the one set in Blobs. It can only be set in code
+	BlobStore BlobStore `mapstructure:"-"`
+
+	// Locales configures the locale the translated columns fall back to
+	Locales Locales
+
+	// RecursiveDepth is the max depth of the rows returned by a recursive
+	// selection (`find: children` or `find: parents`). Defaults to 10
+	RecursiveDepth int `mapstructure:"recursive_depth"`
+
+	// CursorWatermark adds the max primary key of the table when the first
+	// page is fetched to the cursor so the later pages don't have the rows
+	// inserted since then, no duplicates or gaps while paging. Only tables
+	// with an integer primary key (eg. serial) get one
+	CursorWatermark bool `mapstructure:"cursor_watermark"`
+
+	// Events streams the changes made by mutations to the _events
+	// subscription of the roles in it (eg. admin)
+	Events Events `mapstructure:"events"`
+
+	// Outbox inserts an event row into an outbox table in the same
+	// transaction as the mutations it's configured for
+	Outbox Outbox
+}
+
+// Events struct configures the _events subscription, the changes made by
+// mutations are streamed to it as they're made for internal tools to watch
+// data change live (eg. `subscription { _events(tables: ["products"]) {
+// table op data } }`). Only the roles in Roles can subscribe to it
+type Events struct {
+	Roles []string
+
+	// BufferSize is the number of events queued for a subscriber, the
+	// events are dropped for subscribers that fall behind. Defaults to 100
+	BufferSize int `mapstructure:"buffer_size"`
+}
+
+// Outbox struct configures the transactional outbox. A mutation with an
+// event runs in a transaction that also inserts the event into the outbox
+// table (name text, payload jsonb), so the event is only there when the
+// mutation commits and downstream services can reliably read it from there
+type Outbox struct {
+	// Table is the outbox table. Defaults to outbox
+	Table string
+
+	Events []OutboxEvent
+}
+
+// OutboxEvent struct defines the event inserted for a mutation, Query is the
+// name of the mutation. Payload is a json template, string values like
+// `$user.id` are replaced by the value at the path in the mutation result
+// and `$` by the whole result. Defaults to the whole result
+type OutboxEvent struct {
+	Name    string
+	Query   string
+	Payload string
+}
+
+// Rewrite struct defines a rule to change matching queries. Name, Table and
+// Field are glob patterns (eg. `get_*`) matched against the query name, the
+// table and the selected columns. Empty patterns match everything.
+type Rewrite struct {
+	Name  string
+	Table string
+	Field string
+
+	// Filter is added to the where clause (eg. `{ deleted: { eq: false } }`)
+	Filter string
+
+	// Limit caps the number of rows returned
+	Limit int
+
+	// View is used in place of the table, it must have the same columns.
+	// The relationships of the table are used to join it
+	View string
 }
 
 // Table struct defines a database table
@@ -88,6 +435,86 @@ type Table struct {
 	Blocklist []string
 	Remotes   []Remote
 	Columns   []Column
+
+	// CacheControl adds cache hints for this table to the response
+	// used by Apollo style client and CDN caches
+	CacheControl CacheControl `mapstructure:"cache_control"`
+
+	// GenerateID creates the primary key of rows inserted without one
+	// instead of relying on a database default. It can be `uuid` (v4),
+	// `uuidv7` or `ulid`
+	GenerateID string `mapstructure:"generate_id"`
+
+	// Timestamps sets the created_at column to the current time on insert
+	// and updated_at on insert and update. Values for them in the mutation
+	// are ignored
+	Timestamps bool
+
+	// Search is the tsvector column or expression used by the search
+	// argument (eg. `to_tsvector('english', name || ' ' || description)`).
+	// The tsvector column of the table is used if not set
+	Search string
+
+	// Types maps the values of the type column of a polymorphic table to
+	// the tables (eg. the Rails class name `Product` to products). The table
+	// name is the value for the tables not in it. The names are also the types
+	// used in the inline fragments (eg. `... on Product { name }`)
+	Types []PolymorphicType
+
+	// JoinStrategy is how the rows of the related tables are fetched keyed
+	// by the related table (eg. `users: subquery`). It can be `lateral`
+	// (default) for a lateral join or `subquery` for a correlated subquery
+	JoinStrategy map[string]string `mapstructure:"join_strategy"`
+
+	// OrderBy are sql expressions the rows can be ordered by keyed by the
+	// name used in the order_by argument (eg. `popularity: likes + views * 2`)
+	OrderBy map[string]string `mapstructure:"order_by"`
+
+	// Count is how the rows are counted for the `_count_estimate` field. It
+	// can be `exact` (default) for count(*), `estimate` for the row estimate
+	// of Postgres or `cached` for count(*) cached for CountTTL. Nested
+	// selections and selections with other fields are always counted exactly
+	Count string
+
+	// CountTTL is how long a cached count is used for. Defaults to a minute
+	CountTTL time.Duration `mapstructure:"count_ttl"`
+
+	// Cached are the expensive fields (eg. aggregates) read from a cache
+	// table refreshed on a schedule
+	Cached []CachedField
+}
+
+// SQLQuery struct is a named raw sql query for the few queries that can't be
+// written in GraphQL, its name is a root field that selects the rows it returns
+// like a table with the columns set. The arguments are used in the sql by name
+// (eg. $region) and set with the args argument (eg. `args: { region: $region }`)
+type SQLQuery struct {
+	Name string
+	SQL  string
+
+	// Args are the arguments of the query with their types
+	Args []Column
+
+	// Columns are the columns of the rows returned with their types
+	Columns []Column
+
+	// Roles are the roles that can run the query, no role
+	// can when it's not set
+	Roles []string
+}
+
+// PolymorphicType struct is a value of the type column of a
+// polymorphic table and the table it refers to
+type PolymorphicType struct {
+	Name  string
+	Table string
+}
+
+// CacheControl struct defines the cache hint for a table. MaxAge is in
+// seconds and Scope is either PUBLIC (default) or PRIVATE
+type CacheControl struct {
+	MaxAge int `mapstructure:"max_age"`
+	Scope  string
 }
 
 // Column struct defines a database column
@@ -95,6 +522,28 @@ type Column struct {
 	Name       string
 	Type       string
 	ForeignKey string `mapstructure:"related_to"`
+
+	// Format changes the value of the column before it's returned, it can be
+	// `currency` (eg. `currency:EUR`), `prefix` (eg. `prefix:https://cdn.com/`),
+	// `rfc3339`, `epoch_ms`, `geojson` or the name of one of the Formatters
+	Format string
+
+	// Blob makes the column a reference to a file in the blob store, a data
+	// url (eg. `data:image/png;base64,...`) set in a mutation is uploaded and
+	// its key stored and queries return a signed url of it
+	Blob bool
+
+	// Translated makes a json, jsonb or hstore column of translations keyed
+	// by locale (eg. `{"en": "Hat", "fr": "Chapeau"}`) return the translation
+	// for the locale of the request
+	Translated bool
+
+	// Currency makes a money, numeric or integer column of amounts in a
+	// currency (eg. USD), integer columns hold the amount in the minor unit
+	// (eg. cents). It's returned as `{"amount": "12.50", "currency": "USD"}`
+	// or a formatted string with the currency format and both are accepted
+	// in mutations
+	Currency string
 }
 
 // Remote struct defines a remote API endpoint
@@ -109,14 +558,84 @@ type Remote struct {
 		Name  string
 		Value string
 	} `mapstructure:"set_headers"`
+
+	// Query makes this a GraphQL remote, the query is sent to the URL with
+	// the id as the $id variable and the Path is within the data of the response
+	Query string
+
+	// Fields are the remote fields that can be selected, when empty
+	// any field can be selected
+	Fields []string
+
+	// BatchURL is used to fetch the remote data for many ids with a single
+	// request. The $ids variable is replaced by a comma seperated list of ids
+	// and the response (after applying Path) must be a json object keyed by id
+	BatchURL string `mapstructure:"batch_url"`
+
+	// BatchSize is the max number of ids in a batch request. Defaults to 50
+	BatchSize int `mapstructure:"batch_size"`
+
+	// BatchParallelism is the max number of batch requests made at the
+	// same time. Defaults to 4
+	BatchParallelism int `mapstructure:"batch_parallelism"`
+
+	// CacheTTL caches the responses by id for this duration (eg. 30s)
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+
+	// CacheStale is how long an expired response is still returned while
+	// it's refreshed in the background (stale-while-revalidate)
+	CacheStale time.Duration `mapstructure:"cache_stale"`
+
+	// Timeout for each request to the remote (eg. 5s). Defaults to no timeout
+	Timeout time.Duration
+
+	// Retries is the number of times a request is retried on connection
+	// errors and 5xx or 429 responses. RetryBackoff is the delay before the
+	// first retry and it doubles with each one. Defaults to 100ms
+	Retries      int
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+
+	// ProxyURL is the http proxy used for requests to the remote
+	ProxyURL string `mapstructure:"proxy_url"`
+
+	// TLS options for requests to the remote
+	TLS RemoteTLS `mapstructure:"tls"`
+
+	// CircuitBreaker stops requests to the remote host after too many
+	// failures. It's shared by all remotes with the same host
+	CircuitBreaker RemoteCircuitBreaker `mapstructure:"circuit_breaker"`
+}
+
+// RemoteTLS struct defines the TLS options used to connect to a remote
+type RemoteTLS struct {
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	ServerName         string `mapstructure:"server_name"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+}
+
+// RemoteCircuitBreaker struct defines when to stop making requests to a
+// remote host. After MaxFailures failed requests in a row no requests are
+// made till the Cooldown (default 30s) has passed
+type RemoteCircuitBreaker struct {
+	MaxFailures int `mapstructure:"max_failures"`
+	Cooldown    time.Duration
 }
 
 // Role struct contains role specific access control values for for all database tables
 type Role struct {
-	Name   string
-	Match  string
-	Tables []RoleTable
-	tm     map[string]*RoleTable
+	Name    string
+	Match   string
+	Timeout time.Duration
+	Tables  []RoleTable
+	tm      map[string]*RoleTable
+
+	// Intents are the kinds of operations (read, create, update, delete,
+	// bulk and export) the role can run on any table, see IntentRead. When
+	// set the others are rejected even if the rules of a table allow them
+	Intents []string
+	im      map[string]struct{}
 }
 
 // RoleTable struct contains role specific access control values for a database table
@@ -174,9 +693,8 @@ func (c *Config) AddRoleTable(role, table string, conf interface{}) error {
 		}
 	}
 	if r == nil {
-		nr := Role{Name: role}
-		c.Roles = append(c.Roles, nr)
-		r = &nr
+		c.Roles = append(c.Roles, Role{Name: role})
+		r = &c.Roles[len(c.Roles)-1]
 	}
 
 	var t *RoleTable
@@ -187,9 +705,8 @@ func (c *Config) AddRoleTable(role, table string, conf interface{}) error {
 		}
 	}
 	if t == nil {
-		nt := RoleTable{Name: table}
-		r.Tables = append(r.Tables, nt)
-		t = &nt
+		r.Tables = append(r.Tables, RoleTable{Name: table})
+		t = &r.Tables[len(r.Tables)-1]
 	}
 
 	switch v := conf.(type) {
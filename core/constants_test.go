@@ -0,0 +1,39 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestConstants(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Constants: map[string]interface{}{
+		"env": map[string]interface{}{"max_rows": 15, "min_price": 2.5},
+	}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := sg.buildRoleStmt(
+		[]byte(`query { products(limit: $env.max_rows, where: { price: { gt: $env.min_price } }) { id } }`),
+		nil, "user", psql.Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{`"products"."price") > '2.5'`, `LIMIT ('15')`} {
+		if !strings.Contains(st.sql, v) {
+			t.Fatalf("expected '%s' in:\n%s", v, st.sql)
+		}
+	}
+}
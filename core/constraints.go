@@ -0,0 +1,112 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgconn"
+)
+
+// Error codes of the constraint violations of mutations, see ConstraintError
+const (
+	ErrCodeUniqueViolation     = "UNIQUE_VIOLATION"
+	ErrCodeForeignKeyViolation = "FOREIGN_KEY_VIOLATION"
+	ErrCodeCheckViolation      = "CHECK_VIOLATION"
+	ErrCodeNotNullViolation    = "NOT_NULL_VIOLATION"
+)
+
+// ConstraintError is returned when a mutation fails a constraint of the
+// database (eg. a unique index or a foreign key), the message is the one of
+// the constraint in ConstraintErrors or one made from the names below
+type ConstraintError struct {
+	Code       string
+	Constraint string
+	Table      string
+	Column     string
+	msg        string
+	err        error
+}
+
+func (e *ConstraintError) Error() string {
+	return e.msg
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.err
+}
+
+// the columns in the detail of unique and foreign key
+// violations, eg. Key (email)=(jane@example.com) already exists.
+var keyColsRe = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// constraintErr returns the error as a ConstraintError when it's a constraint
+// violation, the values in the detail of the error are never returned
+func (sg *SuperGraph) constraintErr(err error) error {
+	var pe *pgconn.PgError
+
+	if err == nil || !errors.As(err, &pe) {
+		return err
+	}
+
+	ce := &ConstraintError{
+		Constraint: pe.ConstraintName,
+		Table:      pe.TableName,
+		Column:     pe.ColumnName,
+		err:        err,
+	}
+
+	if ce.Column == "" {
+		if m := keyColsRe.FindStringSubmatch(pe.Detail); m != nil {
+			ce.Column = m[1]
+		}
+	}
+
+	switch pe.Code {
+	case "23505":
+		ce.Code = ErrCodeUniqueViolation
+		ce.msg = fmt.Sprintf("%s: value already exists", ce.name())
+	case "23503":
+		ce.Code = ErrCodeForeignKeyViolation
+		if strings.Contains(pe.Detail, "still referenced") {
+			ce.msg = fmt.Sprintf("%s: still referenced by '%s'", ce.name(), ce.Table)
+		} else {
+			ce.msg = fmt.Sprintf("%s: related row does not exist", ce.name())
+		}
+	case "23514":
+		ce.Code = ErrCodeCheckViolation
+		ce.msg = fmt.Sprintf("%s: check '%s' failed", ce.name(), ce.Constraint)
+	case "23502":
+		ce.Code = ErrCodeNotNullViolation
+		ce.msg = fmt.Sprintf("%s: value is required", ce.name())
+	default:
+		return err
+	}
+
+	// viper lowercases the keys of maps
+	t, ok := sg.conf.ConstraintErrors[ce.Constraint]
+	if !ok {
+		t, ok = sg.conf.ConstraintErrors[strings.ToLower(ce.Constraint)]
+	}
+
+	if ok {
+		ce.msg = strings.NewReplacer(
+			"{constraint}", ce.Constraint,
+			"{table}", ce.Table,
+			"{column}", ce.Column).Replace(t)
+	}
+
+	return ce
+}
+
+// name returns the table and column of the constraint (eg. users.email)
+func (e *ConstraintError) name() string {
+	switch {
+	case e.Column == "":
+		return e.Table
+	case e.Table == "":
+		return e.Column
+	}
+	return e.Table + "." + e.Column
+}
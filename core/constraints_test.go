@@ -0,0 +1,65 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+)
+
+func TestConstraintErr(t *testing.T) {
+	sg := &SuperGraph{conf: &Config{
+		ConstraintErrors: map[string]string{
+			"users_email_key": "{column} already taken",
+		},
+	}}
+
+	tests := []struct {
+		err    *pgconn.PgError
+		code   string
+		column string
+		msg    string
+	}{
+		{&pgconn.PgError{Code: "23505", ConstraintName: "users_email_key", TableName: "users",
+			Detail: "Key (email)=(jane@example.com) already exists."},
+			ErrCodeUniqueViolation, "email", "email already taken"},
+		{&pgconn.PgError{Code: "23505", ConstraintName: "products_name_key", TableName: "products",
+			Detail: "Key (name)=(Hat) already exists."},
+			ErrCodeUniqueViolation, "name", "products.name: value already exists"},
+		{&pgconn.PgError{Code: "23503", ConstraintName: "products_user_id_fkey", TableName: "products",
+			Detail: "Key (user_id)=(99) is not present in table \"users\"."},
+			ErrCodeForeignKeyViolation, "user_id", "products.user_id: related row does not exist"},
+		{&pgconn.PgError{Code: "23514", ConstraintName: "price_positive", TableName: "products"},
+			ErrCodeCheckViolation, "", "products: check 'price_positive' failed"},
+		{&pgconn.PgError{Code: "23502", TableName: "users", ColumnName: "full_name"},
+			ErrCodeNotNullViolation, "full_name", "users.full_name: value is required"},
+	}
+
+	for _, v := range tests {
+		err := sg.constraintErr(fmt.Errorf("query: %w", v.err))
+
+		var ce *ConstraintError
+		if !errors.As(err, &ce) {
+			t.Fatalf("%s: expected a constraint error got %v", v.err.Code, err)
+		}
+
+		if ce.Code != v.code || ce.Column != v.column || ce.Error() != v.msg {
+			t.Errorf("%s: unexpected error %+v (%s)", v.err.Code, ce, ce)
+		}
+
+		if ErrorCode(err) != v.code {
+			t.Errorf("%s: expected the code %s got %s", v.err.Code, v.code, ErrorCode(err))
+		}
+	}
+
+	ge := GraphQLErrors(sg.constraintErr(tests[0].err))
+	if e := ge[0].Extensions; e.Constraint != "users_email_key" || e.Table != "users" || e.Column != "email" {
+		t.Errorf("unexpected extensions %+v", e)
+	}
+
+	err := &pgconn.PgError{Code: "42P01", Message: "relation does not exist"}
+	if sg.constraintErr(err) != err {
+		t.Error("expected other errors to be returned as is")
+	}
+}
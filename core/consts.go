@@ -12,3 +12,9 @@ var (
 func keyExists(ct context.Context, key contextkey) bool {
 	return ct.Value(key) != nil
 }
+
+// isDryRun returns true if the mutation is to be rolled back
+func isDryRun(ct context.Context) bool {
+	v, _ := ct.Value(DryRunKey).(bool)
+	return v
+}
@@ -3,7 +3,10 @@ package core
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/dosco/super-graph/core/internal/psql"
@@ -20,7 +23,16 @@ const (
 )
 
 type extensions struct {
-	Tracing *trace `json:"tracing,omitempty"`
+	Tracing      *trace        `json:"tracing,omitempty"`
+	CacheControl *cacheControl `json:"cacheControl,omitempty"`
+	Cost         *qcode.Cost   `json:"cost,omitempty"`
+	Budget       *budgetUsage  `json:"budget,omitempty"`
+	Warnings     []string      `json:"warnings,omitempty"`
+	DryRun       bool          `json:"dryRun,omitempty"`
+
+	// Entities are the rows of a normalized result keyed by
+	// their table and id (eg. users:1)
+	Entities json.RawMessage `json:"entities,omitempty"`
 }
 
 type trace struct {
@@ -47,103 +59,544 @@ type resolver struct {
 type scontext struct {
 	context.Context
 
-	sg   *SuperGraph
-	op   qcode.QType
-	name string
+	sg      *SuperGraph
+	op      qcode.QType
+	name    string
+	timeout time.Duration
+	budget  *budget
+
+	// blobVars are the variables with the blobs uploaded, a query that's
+	// run again (eg. on a serialization failure) uses them and doesn't
+	// upload the blobs again
+	blobVars json.RawMessage
+
+	// db is the database the query was last run on, its pool is reset
+	// when it fails over
+	db *sql.DB
 }
 
 type qres struct {
-	q    *cquery
-	data []byte
-	role string
+	q      *cquery
+	data   []byte
+	role   string
+	dbTime time.Duration
+
+	// warns are the remote ids that failed and were set to null
+	warns []string
 }
 
 func (sg *SuperGraph) initCompilers() error {
 	var err error
-	var schema string
-
-	if sg.conf.DBSchema == "" {
-		schema = "public"
-	} else {
-		schema = sg.conf.DBSchema
-	}
 
 	// If sg.di is not null then it's probably set
 	// for tests
 	if sg.dbinfo == nil {
-		sg.dbinfo, err = psql.GetDBInfo(sg.db, schema, sg.conf.Blocklist)
+		sg.dbinfo, err = sg.getDBInfo()
+		if err != nil {
+			return err
+		}
+	}
+
+	dbSchema, err := sg.newDBSchema(sg.dbinfo)
+	if err != nil {
+		return err
+	}
+
+	opts := []qcode.Option{
+		qcode.WithDefaultBlock(sg.conf.DefaultBlock),
+		qcode.WithSizeLimits(sg.conf.MaxQueryBytes, sg.conf.MaxNameLength),
+		qcode.WithLimits(sg.conf.MaxSelectors, sg.conf.MaxFields, sg.conf.MaxArgs),
+		qcode.WithCostLimits(qcode.CostConfig{
+			MaxDepth: sg.conf.MaxDepth,
+			MaxCost:  sg.conf.MaxCost,
+			Fields:   sg.conf.FieldCosts,
+		}),
+		qcode.WithRelay(sg.conf.Relay),
+		qcode.WithMaxLimit(sg.conf.MaxLimit),
+	}
+
+	if sg.conf.MaxErrors != 0 {
+		opts = append(opts, qcode.WithMaxErrors(sg.conf.MaxErrors))
+	}
+
+	if len(sg.conf.Constants) != 0 {
+		opts = append(opts, qcode.WithConstants(sg.conf.Constants))
+	}
+
+	for name, fil := range sg.conf.Filters {
+		opts = append(opts, qcode.WithFilter(name, fil))
+	}
+
+	// the built-in directives can be replaced with a custom one
+	opts = append(opts, qcode.WithDirective("cacheControl", cacheControlDirective))
+	opts = append(opts, qcode.WithDirective("watch", watchDirective))
+
+	for name, fn := range sg.conf.Directives {
+		opts = append(opts, qcode.WithDirective(name, directiveFn(fn)))
+	}
+
+	for _, t := range sg.conf.Tables {
+		for _, pt := range t.Types {
+			opts = append(opts, qcode.WithUnionType(t.Name, pt.Name, pt.Table))
+		}
+	}
+
+	nsOpts, err := sg.namespaceOpts(dbSchema)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, nsOpts...)
+
+	// functions returning rows of a table are root fields, the ones
+	// returning a single row take the singular name of the table
+	for _, f := range dbSchema.GetTableFunctions() {
+		ti, err := dbSchema.GetTableInfo(f.Table)
 		if err != nil {
 			return err
 		}
+
+		t := ti.Singular
+		if f.SetOf {
+			t = ti.Plural
+		}
+		opts = append(opts, qcode.WithTableFunction(f.Name, t))
 	}
+	opts = append(opts, sqlQueryOpts(sg.conf)...)
 
-	if len(sg.dbinfo.Tables) == 0 {
-		return fmt.Errorf("no tables found in database (schema: %s)", schema)
+	sg.qc, err = qcode.NewCompiler(opts...)
+	if err != nil {
+		return err
 	}
 
-	if err = addTables(sg.conf, sg.dbinfo); err != nil {
+	if err := addRoles(sg.conf, sg.qc); err != nil {
 		return err
 	}
 
-	if err = addForeignKeys(sg.conf, sg.dbinfo); err != nil {
+	if err := addSQLQueryRoles(sg.conf, sg.qc); err != nil {
 		return err
 	}
 
-	sg.schema, err = psql.NewDBSchema(sg.dbinfo, getDBTableAliases(sg.conf))
+	if err := addRewrites(sg.conf, sg.qc); err != nil {
+		return err
+	}
+
+	var ts []string
+
+	for _, t := range sg.conf.Tables {
+		if !t.Timestamps {
+			continue
+		}
+		ti, err := dbSchema.GetTableInfo(t.Name)
+		if err != nil {
+			return fmt.Errorf("timestamps: %w", err)
+		}
+		ts = append(ts, ti.Name)
+	}
+
+	dialect, err := psql.GetDialect(sg.conf.DBType)
 	if err != nil {
 		return err
 	}
 
-	sg.qc, err = qcode.NewCompiler(qcode.Config{
-		DefaultBlock: sg.conf.DefaultBlock,
-	})
+	joins, err := joinStrategies(sg.conf)
 	if err != nil {
 		return err
 	}
 
-	if err := addRoles(sg.conf, sg.qc); err != nil {
+	computed, err := sg.computedCols(dbSchema)
+	if err != nil {
+		return err
+	}
+
+	counts, err := countStrategies(sg.conf)
+	if err != nil {
+		return err
+	}
+
+	cached, err := sg.cachedCols(dbSchema)
+	if err != nil {
+		return err
+	}
+
+	cartesian, err := cartesianMode(sg.conf)
+	if err != nil {
 		return err
 	}
 
 	sg.pc = psql.NewCompiler(psql.Config{
-		Schema: sg.schema,
-		Vars:   sg.conf.Vars,
+		Schema:          dbSchema,
+		Vars:            sg.conf.Vars,
+		Lenient:         sg.conf.LenientMode,
+		Timestamps:      ts,
+		MaxErrors:       sg.conf.MaxErrors,
+		RecursiveDepth:  sg.conf.RecursiveDepth,
+		Dialect:         dialect,
+		CursorWatermark: sg.conf.CursorWatermark,
+		Joins:           joins,
+		Computed:        computed,
+		Counts:          counts,
+		Cached:          cached,
+		Cartesian:       cartesian,
 	})
 
 	return nil
 }
 
+// cartesianMode returns what's done with the joins of
+// a query on columns unique on neither side
+func cartesianMode(conf *Config) (psql.CartesianMode, error) {
+	switch strings.ToLower(conf.CartesianJoins) {
+	case "", "warn":
+		return psql.CartesianWarn, nil
+	case "reject":
+		return psql.CartesianReject, nil
+	case "allow":
+		return psql.CartesianAllow, nil
+	}
+	return 0, fmt.Errorf("cartesian_joins: unknown mode '%s'", conf.CartesianJoins)
+}
+
+// joinStrategies returns the join strategies of the tables keyed
+// by the table and then the related table
+func joinStrategies(conf *Config) (map[string]map[string]psql.JoinStrategy, error) {
+	var joins map[string]map[string]psql.JoinStrategy
+
+	for _, t := range conf.Tables {
+		for rt, v := range t.JoinStrategy {
+			var js psql.JoinStrategy
+
+			switch strings.ToLower(v) {
+			case "", "lateral":
+				js = psql.JoinLateral
+			case "subquery":
+				js = psql.JoinSubquery
+			default:
+				return nil, fmt.Errorf("table %s: join_strategy: unknown strategy '%s' for %s",
+					t.Name, v, rt)
+			}
+
+			if joins == nil {
+				joins = make(map[string]map[string]psql.JoinStrategy)
+			}
+			if joins[t.Name] == nil {
+				joins[t.Name] = make(map[string]psql.JoinStrategy)
+			}
+			joins[t.Name][rt] = js
+		}
+	}
+
+	return joins, nil
+}
+
+// getDBInfo discovers the tables, columns and functions of the database
+func (sg *SuperGraph) getDBInfo() (*psql.DBInfo, error) {
+	if sg.conf.DBType == "mysql" {
+		if len(sg.conf.Schemas) != 0 {
+			return nil, errors.New("schemas: not supported with mysql")
+		}
+		return psql.GetMySQLDBInfo(sg.db, sg.conf.DBSchema, sg.conf.Blocklist)
+	}
+
+	di, err := psql.GetDBInfo(sg.db, sg.dbSchemaName(), sg.conf.Blocklist)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sg.addSchemas(di); err != nil {
+		return nil, err
+	}
+	return di, nil
+}
+
+func (sg *SuperGraph) dbSchemaName() string {
+	if sg.conf.DBSchema == "" {
+		return "public"
+	}
+	return sg.conf.DBSchema
+}
+
+// newDBSchema creates the schema used by the compilers from the database info
+// and the tables and relationships added in the config
+func (sg *SuperGraph) newDBSchema(di *psql.DBInfo) (*psql.DBSchema, error) {
+	if len(di.Tables) == 0 {
+		return nil, fmt.Errorf("no tables found in database (schema: %s)", sg.dbSchemaName())
+	}
+
+	if err := addTables(sg.conf, di); err != nil {
+		return nil, err
+	}
+
+	if err := addSQLQueries(sg.conf, di); err != nil {
+		return nil, err
+	}
+
+	if err := addForeignKeys(sg.conf, di); err != nil {
+		return nil, err
+	}
+
+	if err := addSearch(sg.conf, di); err != nil {
+		return nil, err
+	}
+
+	if err := addOrderExps(sg.conf, di); err != nil {
+		return nil, err
+	}
+
+	if err := addTranslations(sg.conf, di); err != nil {
+		return nil, err
+	}
+
+	if err := addCurrencies(sg.conf, di); err != nil {
+		return nil, err
+	}
+
+	if err := addScalars(sg.conf, di); err != nil {
+		return nil, err
+	}
+
+	return psql.NewDBSchema(di, getDBTableAliases(sg.conf))
+}
+
+// ReloadSchema function reads the database schema again and swaps it in
+// for the compilers and introspection. Queries being compiled while
+// it runs finish with the schema they started with.
+func (sg *SuperGraph) ReloadSchema() error {
+	if sg.mock != nil {
+		return errors.New("reload schema: not supported with mock data")
+	}
+
+	di, err := sg.getDBInfo()
+	if err != nil {
+		return fmt.Errorf("reload schema: %w", err)
+	}
+
+	return sg.reloadSchema(di)
+}
+
+func (sg *SuperGraph) reloadSchema(di *psql.DBInfo) error {
+	sg.reloadMu.Lock()
+	defer sg.reloadMu.Unlock()
+
+	dbSchema, err := sg.buildSchema(di)
+	if err != nil {
+		return fmt.Errorf("reload schema: %w", err)
+	}
+
+	// the allow list queries that fail with the new schema
+	// are logged before it's swapped in
+	impact, err := sg.schemaImpact(dbSchema)
+	if err != nil {
+		return fmt.Errorf("reload schema: %w", err)
+	}
+
+	for _, v := range impact {
+		sg.log.Printf("WRN reload schema: %s", v)
+	}
+
+	ge, err := sg.newGraphQLEngines(dbSchema)
+	if err != nil {
+		return fmt.Errorf("reload schema: %w", err)
+	}
+
+	sg.pc.SetSchema(dbSchema)
+	sg.engines.Store(ge)
+
+	// queries compiled with the old schema
+	if sg.compiled != nil {
+		sg.compiled.flush()
+	}
+
+	return nil
+}
+
+// buildSchema returns the database schema with the remote joins added
+func (sg *SuperGraph) buildSchema(di *psql.DBInfo) (*psql.DBSchema, error) {
+	dbSchema, err := sg.newDBSchema(di)
+	if err != nil {
+		return nil, err
+	}
+
+	// remote joins are relationships in the schema
+	for _, t := range sg.conf.Tables {
+		for _, r := range t.Remotes {
+			rel, err := remoteRel(dbSchema, t, r)
+			if err != nil {
+				return nil, err
+			}
+			if err := dbSchema.SetRel(sanitize(r.Name), t.Name, rel); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return dbSchema, nil
+}
+
 func (c *scontext) execQuery(query string, vars []byte, role string) (qres, error) {
+	if d := c.queryTimeout(role); d != 0 {
+		var cancel context.CancelFunc
+		c, cancel = c.withTimeout(d)
+		defer cancel()
+	}
+
 	res, err := c.resolveSQL(query, vars, role)
+
+	for i := 1; err != nil && i <= c.sg.conf.FailoverRetries && c.canRetry(err); i++ {
+		c.sg.log.Printf("WRN database failover detected, retrying (%d): %s", i, err)
+		c.resetPool()
+
+		select {
+		case <-time.After(retryDelay(i)):
+		case <-c.Done():
+			return res, c.Err()
+		}
+		res, err = c.resolveSQL(query, vars, role)
+	}
+
+	// mutations that conflicted with another serializable transaction
+	for i := 1; err != nil && i <= c.serializableRetries() && isSerializationErr(err); i++ {
+		c.sg.log.Printf("WRN serialization failure, retrying (%d): %s", i, err)
+
+		select {
+		case <-time.After(retryDelay(i)):
+		case <-c.Done():
+			return res, c.Err()
+		}
+		res, err = c.resolveSQL(query, vars, role)
+	}
+
 	if err != nil {
-		return res, err
+		return res, c.sg.constraintErr(c.timeoutErr(err))
 	}
 
 	if c.sg.conf.Debug {
 		c.debugLog(&res.q.st)
 	}
 
-	if len(res.data) == 0 || !res.q.st.md.HasRemotes() {
-		return res, nil
+	if len(res.data) != 0 && res.q.st.md.HasRemotes() {
+		// return c.sg.execRemoteJoin(st, data, c.req.hdr)
+		_, span := startSpan(c, "remote_join")
+		res, err = c.sg.execRemoteJoin(res, nil, c.budget)
+		endSpan(span, err)
+
+		if err != nil {
+			return res, withCat(ErrCatRemote, c.timeoutErr(err))
+		}
+	}
+
+	if res.data, err = c.sg.sortRemote(res.q.st.qc, res.data, vars); err != nil {
+		return res, withCat(ErrCatRemote, err)
 	}
 
-	// return c.sg.execRemoteJoin(st, data, c.req.hdr)
-	return c.sg.execRemoteJoin(res, nil)
+	if res.data, err = c.sg.computeData(c, res.q.st.qc, res.data); err != nil {
+		return res, withCat(ErrCatEncode, err)
+	}
+
+	if res.data, err = c.sg.formatData(res.q.st.qc, res.data); err != nil {
+		return res, withCat(ErrCatEncode, err)
+	}
+
+	if res.data, err = c.sg.relayData(res.q.st.qc, res.data); err != nil {
+		return res, withCat(ErrCatEncode, err)
+	}
+
+	if res.data, err = nestNamespaces(res.q.st.qc, res.data); err != nil {
+		return res, withCat(ErrCatEncode, err)
+	}
+
+	if err := c.afterExec(&res); err != nil {
+		return res, err
+	}
+
+	if c.op == qcode.QTMutation && !c.dryRun() {
+		c.publishEvents(res.q.st.qc, res.data, res.role)
+	}
+
+	if max := c.sg.conf.MaxResultBytes; max > 0 && len(res.data) > max {
+		err := &codeError{ErrCodeResultTooLarge,
+			fmt.Sprintf("result is too large: %d bytes (max %d)", len(res.data), max)}
+		res.data = nil
+		return res, err
+	}
+
+	return res, nil
+}
+
+// ctxRole returns the role set in the context with UserRoleKey (eg. from a
+// jwt claim), it has to be one of the configured roles since an unknown
+// role would get the query without the filters and columns of a role
+func (sg *SuperGraph) ctxRole(c context.Context) (string, bool, error) {
+	v, ok := c.Value(UserRoleKey).(string)
+	if !ok {
+		return "", false, nil
+	}
+
+	role := sanitize(v)
+
+	if _, ok := sg.roles[role]; !ok {
+		return "", true, &codeError{ErrCodeRoleForbidden, "unknown role: " + v}
+	}
+	return role, true, nil
 }
 
 func (c *scontext) resolveSQL(query string, vars []byte, role string) (qres, error) {
 	var res qres
 
+	if c.sg.mock != nil {
+		return c.resolveMock(query, vars, role)
+	}
+
 	urq := c.sg.abacEnabled && c.op == qcode.QTMutation // userRoleQuery
 	rq := rquery{op: c.op, name: c.name, query: []byte(query), vars: vars}
-	cq := &cquery{q: rq}
+	cq := &cquery{q: rq, md: c.sg.compileMeta(c)}
 	res.q = cq
 
-	conn, err := c.sg.db.Conn(c)
+	if sf := sqlFragments(c); sf != nil {
+		if err := c.setSQLFragments(cq, sf); err != nil {
+			return res, err
+		}
+	}
+
+	if v, ok, err := c.sg.ctxRole(c); err != nil {
+		return res, err
+	} else if ok {
+		role = v
+		urq = false
+	}
+
+	// when the role is known the query is compiled before a connection
+	// is taken so queries with every root skipped never hit the database
+	if !urq {
+		if err := c.compile(cq, role); err != nil {
+			return res, err
+		}
+
+		if cq.st.md.Skipped() {
+			res.data = []byte(`{}`)
+			res.role = role
+			return res, nil
+		}
+
+		// with roles_query the role of a query is found when it's run
+		if !cq.roleArg {
+			if err := c.sg.checkIntents(cq.st.qc, vars, role, false); err != nil {
+				return res, err
+			}
+		}
+
+		if err := c.afterCompile(cq, role); err != nil {
+			return res, err
+		}
+	}
+
+	db := c.queryDB(role)
+	c.db = db
+
+	conn, err := db.Conn(c)
 	if err != nil {
 		return res, err
 	}
-	defer conn.Close()
+	defer func() { conn.Close() }()
 
 	if c.sg.conf.SetUserID {
 		if err := c.setLocalUserID(conn); err != nil {
@@ -151,23 +604,78 @@ func (c *scontext) resolveSQL(query string, vars []byte, role string) (qres, err
 		}
 	}
 
-	if v := c.Value(UserRoleKey); v != nil {
-		role = v.(string)
-	} else if urq {
-		role, err = c.executeRoleQuery(conn, role)
+	if urq {
+		if role, err = c.executeRoleQuery(conn, role); err != nil {
+			return res, err
+		}
+
+		// the role found has its own database
+		if rdb := c.queryDB(role); rdb != db {
+			c.db = rdb
+
+			rc, err := rdb.Conn(c)
+			if err != nil {
+				return res, err
+			}
+			conn.Close()
+			conn = rc
+
+			if c.sg.conf.SetUserID {
+				if err := c.setLocalUserID(conn); err != nil {
+					return res, err
+				}
+			}
+		}
+
+		if err = c.compile(cq, role); err != nil {
+			return res, err
+		}
+
+		if err = c.sg.checkIntents(cq.st.qc, vars, role, false); err != nil {
+			return res, err
+		}
+
+		if err = c.afterCompile(cq, role); err != nil {
+			return res, err
+		}
+	}
+
+	if vars, err = varDefaults(cq.st.qc, vars); err != nil {
+		return res, withCat(ErrCatValidate, err)
 	}
 
-	if err != nil {
+	// rows inserted without a primary key get a generated one
+	if vars, err = c.sg.genVarIDs(cq.st.qc, vars); err != nil {
 		return res, err
 	}
 
-	if err = c.sg.compileQuery(cq, role); err != nil {
-		return res, err
+	// amounts set for currency columns are stored in the form of the column
+	if vars, err = c.sg.moneyVarAmounts(cq.st.qc, vars); err != nil {
+		return res, withCat(ErrCatValidate, err)
+	}
+
+	// dates, uuids, intervals and geometries are validated
+	if vars, err = c.sg.scalarVarValues(cq.st.qc, vars); err != nil {
+		return res, withCat(ErrCatValidate, err)
+	}
+
+	// files set for blob columns are uploaded and their keys stored
+	if c.blobVars != nil {
+		vars = c.blobVars
+	} else if vars, err = c.sg.uploadVarBlobs(c, cq.st.qc, vars); err != nil {
+		return res, withCat(ErrCatRemote, err)
+	} else if len(c.sg.blobCols) != 0 {
+		c.blobVars = vars
+	}
+
+	// queries with a lot of roots have them run at the same time
+	if cq.hasParts() {
+		return c.resolveParts(conn, cq, vars, role)
 	}
 
 	args, err := c.sg.argList(c, cq.st.md, vars)
 	if err != nil {
-		return res, err
+		return res, withCat(ErrCatValidate, err)
 	}
 
 	// var stime time.Time
@@ -178,22 +686,113 @@ func (c *scontext) resolveSQL(query string, vars []byte, role string) (qres, err
 
 	fmt.Println(">", cq.st.sql)
 
-	row := conn.QueryRowContext(c, cq.st.sql, args.values...)
+	st := time.Now()
+	_, span := startSpan(c, "sql")
+
+	var ev *outboxEvent
+	var tx *sql.Tx
+
+	if c.op == qcode.QTMutation {
+		ev = c.sg.outboxEvent(c.name)
+	}
+
+	// the outbox event is inserted in the transaction of the mutation and
+	// the statement timeout and session variables are set only for the
+	// transaction of the query
+	stmtTimeout := c.timeout != 0 && c.sg.conf.DBType != "mysql"
+	sessionVars := len(c.sg.sessionVars) != 0
+	dryRun := c.dryRun()
+
+	if err := c.budget.addStmts(1); err != nil {
+		endSpan(span, err)
+		return res, err
+	}
+
+	var row *sql.Row
+	if ev != nil || stmtTimeout || sessionVars || dryRun || c.serializable() {
+		if tx, err = conn.BeginTx(c, c.txOptions()); err != nil {
+			endSpan(span, err)
+			return res, err
+		}
+		defer tx.Rollback() //nolint: errcheck
+
+		if stmtTimeout {
+			if err := c.setStatementTimeout(tx); err != nil {
+				endSpan(span, err)
+				return res, err
+			}
+		}
+
+		if err := c.sg.setSessionVars(c, tx, role); err != nil {
+			endSpan(span, err)
+			return res, err
+		}
+
+		row = tx.QueryRowContext(c, cq.st.sql, args.values...)
+	} else {
+		row = conn.QueryRowContext(c, cq.st.sql, args.values...)
+	}
+
 	if cq.roleArg {
 		err = row.Scan(&res.role, &res.data)
 	} else {
 		err = row.Scan(&res.data)
 	}
 
+	endSpan(span, err)
+	res.dbTime = time.Since(st)
+
 	if err == sql.ErrNoRows {
 		return res, err
 	} else if err != nil {
 		return res, err
 	}
 
+	if cq.roleArg {
+		if err := c.sg.checkIntents(cq.st.qc, vars, res.role, false); err != nil {
+			res.data = nil
+			return res, err
+		}
+	}
+
+	if ev != nil {
+		if err := c.insertOutbox(tx, ev, res.data); err != nil {
+			return res, err
+		}
+	}
+
+	// the deferred rollback undoes a dry run
+	if tx != nil && !dryRun {
+		if err := tx.Commit(); err != nil {
+			return res, err
+		}
+	}
+
+	// a plan of the slow queries is sampled in the background
+	if d := time.Since(st); c.op == qcode.QTQuery && c.sg.slowQuery(d) {
+		c.sg.sampleSlowQuery(c.queryDB(role), SlowQuerySample{
+			Fingerprint: queryFingerprint([]byte(query)),
+			Name:        c.name,
+			Role:        role,
+			SQL:         cq.st.sql,
+			Duration:    d,
+			At:          st,
+		}, args.values)
+	}
+
+	c.recordPlan(query, cq, role, args.values, time.Since(st))
+
+	if c.sg.shadow != nil && c.op == qcode.QTQuery && !cq.roleArg {
+		c.sg.shadow.replay(ShadowResult{
+			Name:    c.name,
+			SQL:     cq.st.sql,
+			Latency: time.Since(st),
+		}, args.values, res.data)
+	}
+
 	cur, err := c.sg.encryptCursor(cq.st.qc, res.data)
 	if err != nil {
-		return res, err
+		return res, withCat(ErrCatEncode, err)
 	}
 
 	res.data = cur.data
@@ -225,10 +824,20 @@ func (c *scontext) executeRoleQuery(conn *sql.Conn, role string) (string, error)
 		return "anon", nil
 	}
 
+	if err := c.budget.addStmts(1); err != nil {
+		return role, err
+	}
+
 	err := conn.QueryRowContext(c, c.sg.roleStmt, role).Scan(&role)
 	return role, err
 }
 
+// dryRun returns true if the mutation is run in a
+// transaction that's rolled back
+func (c *scontext) dryRun() bool {
+	return c.op == qcode.QTMutation && isDryRun(c)
+}
+
 func (c *scontext) setLocalUserID(conn *sql.Conn) error {
 	var err error
 	if v := c.Value(UserIDKey); v != nil {
@@ -266,6 +875,16 @@ func (r *Result) SQL() string {
 	return r.sql
 }
 
+// DBTime returns the time the SQL of the query took to run in the database
+func (r *Result) DBTime() time.Duration {
+	return r.dbTime
+}
+
+// Tags returns the tags of the query (eg. owner, team, feature)
+func (r *Result) Tags() map[string]string {
+	return r.tags
+}
+
 // func (c *scontext) addTrace(sel []qcode.Select, id int32, st time.Time) {
 // 	et := time.Now()
 // 	du := et.Sub(st)
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestQueryCost(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{MaxDepth: 3, MaxCost: 100, FieldCosts: map[string]int{"users": 3}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`SELECT`).WillReturnRows(
+		sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+
+	res, err := sg.GraphQL(ct, `query { products(limit: 10) { id user { id } } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(res.Extensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"cost":{"depth":3,"complexity":11}}`; string(b) != exp {
+		t.Fatalf("expected %s got %s", exp, b)
+	}
+
+	_, err = sg.GraphQL(ct, `query { products(limit: 50) { id users { id } } }`, nil)
+	if ErrorCode(err) != ErrCodeQueryTooComplex {
+		t.Fatalf("expected a query too complex error got %v", err)
+	}
+
+	_, err = sg.GraphQL(ct, `query { products { users { products { id } } } }`, nil)
+	if ErrorCode(err) != ErrCodeQueryTooComplex {
+		t.Fatalf("expected a query too complex error got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+const (
+	defaultCountTTL      = time.Minute
+	maxCountCacheEntries = 10000
+)
+
+// countCache keeps the cached counts of rows by the sql
+// and the args of the count
+type countCache struct {
+	sync.Mutex
+	m map[string]countEntry
+}
+
+type countEntry struct {
+	n   int64
+	exp time.Time
+}
+
+// countStrategies returns the strategies the rows of the
+// tables are counted with keyed by the table
+func countStrategies(conf *Config) (map[string]psql.CountStrategy, error) {
+	var counts map[string]psql.CountStrategy
+
+	for _, t := range conf.Tables {
+		var cs psql.CountStrategy
+
+		switch strings.ToLower(t.Count) {
+		case "", "exact":
+			continue
+		case "estimate":
+			cs = psql.CountEstimate
+		case "cached":
+			cs = psql.CountCached
+		default:
+			return nil, fmt.Errorf("table %s: count: unknown strategy '%s'", t.Name, t.Count)
+		}
+
+		if counts == nil {
+			counts = make(map[string]psql.CountStrategy)
+		}
+		counts[t.Name] = cs
+	}
+
+	return counts, nil
+}
+
+// countArg returns the count of rows made outside the query
+// that's passed to it as an argument
+func (sg *SuperGraph) countArg(c context.Context, cq psql.CountQuery, vars []byte) (interface{}, error) {
+	ar, err := sg.argList(c, cq.Metadata(), vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cq.Strategy {
+	case psql.CountEstimate:
+		return sg.estimateRows(c, cq.SQL, ar.values)
+
+	case psql.CountCached:
+		return sg.cachedCount(c, cq, ar.values)
+	}
+
+	return nil, fmt.Errorf("count: unknown strategy for %s", cq.Table)
+}
+
+// estimateRows returns the number of rows the planner
+// estimates the query returns
+func (sg *SuperGraph) estimateRows(c context.Context, query string, args []interface{}) (int64, error) {
+	var b []byte
+
+	if err := sg.db.QueryRowContext(c, "EXPLAIN (FORMAT JSON) "+query, args...).Scan(&b); err != nil {
+		return 0, err
+	}
+
+	var plans []struct {
+		Plan struct {
+			PlanRows float64 `json:"Plan Rows"`
+		}
+	}
+
+	if err := json.Unmarshal(b, &plans); err != nil {
+		return 0, err
+	}
+
+	if len(plans) == 0 {
+		return 0, errors.New("no plan found")
+	}
+	return int64(plans[0].Plan.PlanRows), nil
+}
+
+// cachedCount returns the count of the rows of the query from the cache
+// or counts them and caches the count when it's not found or expired
+func (sg *SuperGraph) cachedCount(c context.Context, cq psql.CountQuery, args []interface{}) (int64, error) {
+	k := cq.SQL + "\x00" + fmt.Sprint(args...)
+
+	sg.counts.Lock()
+	e, ok := sg.counts.m[k]
+	sg.counts.Unlock()
+
+	if ok && time.Now().Before(e.exp) {
+		return e.n, nil
+	}
+
+	var n int64
+
+	if err := sg.db.QueryRowContext(c, `SELECT count(*) FROM (`+cq.SQL+`) AS "__count"`,
+		args...).Scan(&n); err != nil {
+		return 0, err
+	}
+
+	ttl := defaultCountTTL
+
+	for _, t := range sg.conf.Tables {
+		if t.Name == cq.Table && t.CountTTL > 0 {
+			ttl = t.CountTTL
+		}
+	}
+
+	sg.counts.Lock()
+	if sg.counts.m == nil || len(sg.counts.m) >= maxCountCacheEntries {
+		sg.counts.m = make(map[string]countEntry)
+	}
+	sg.counts.m[k] = countEntry{n: n, exp: time.Now().Add(ttl)}
+	sg.counts.Unlock()
+
+	return n, nil
+}
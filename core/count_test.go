@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestCountEstimate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Tables: []Table{
+		{Name: "products", Count: "estimate"},
+		{Name: "users", Count: "cached"},
+	}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`EXPLAIN \(FORMAT JSON\) SELECT 1 FROM "products" WHERE .+ > \$1`).
+		WithArgs("10").
+		WillReturnRows(sqlmock.NewRows([]string{"plan"}).AddRow(`[{"Plan": {"Plan Rows": 42}}]`))
+
+	mock.ExpectQuery(`SELECT \$1 :: bigint AS "_count_estimate"`).
+		WithArgs(int64(42)).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": [{"_count_estimate": 42}]}`))
+
+	if _, err := sg.GraphQL(ct, `query { products(where: { price: { gt: $price } }) { _count_estimate } }`,
+		[]byte(`{"price": 10}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the count is only made the first time
+	mock.ExpectQuery(`SELECT count\(\*\) FROM \(SELECT 1 FROM "users"\) AS "__count"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT \$1 :: bigint AS "_count_estimate"`).
+			WithArgs(int64(7)).
+			WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"users": [{"_count_estimate": 7}]}`))
+
+		if _, err := sg.GraphQL(ct, `query { users { _count_estimate } }`, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Tables[0].Count = "sampled"
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for an unknown count strategy")
+	}
+}
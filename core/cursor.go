@@ -24,6 +24,21 @@ func (sg *SuperGraph) encryptCursor(qc *qcode.QCode, data []byte) (cursors, erro
 		}
 	}
 
+	// the cursors of the selections come first and the
+	// cursors of the rows in them after
+	np := len(keys)
+
+	for _, s := range qc.Selects {
+		if s.Paging.Type == qcode.PtOffset {
+			continue
+		}
+		for _, col := range s.Cols {
+			if col.Name == "cursor" {
+				keys = append(keys, []byte(col.FieldName))
+			}
+		}
+	}
+
 	if len(keys) == 0 {
 		return cur, nil
 	}
@@ -42,7 +57,7 @@ func (sg *SuperGraph) encryptCursor(qc *qcode.QCode, data []byte) (cursors, erro
 			val := f.Value[1 : len(f.Value)-1]
 			// save a copy of the first cursor value to use
 			// with subscriptions when fetching the next set
-			if cur.value == "" {
+			if cur.value == "" && isKey(keys[:np], f.Key) {
 				cur.value = string(val)
 			}
 			v, err := crypto.Encrypt(val, &sg.encKey)
@@ -77,3 +92,12 @@ func (sg *SuperGraph) decrypt(data string) ([]byte, error) {
 	}
 	return crypto.Decrypt(v, &sg.encKey)
 }
+
+func isKey(keys [][]byte, k []byte) bool {
+	for _, v := range keys {
+		if bytes.Equal(v, k) {
+			return true
+		}
+	}
+	return false
+}
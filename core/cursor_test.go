@@ -0,0 +1,74 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestRowCursors(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := `query {
+		products(first: 2, after: $cursor, order_by: { price: desc }) { id cursor }
+	}`
+
+	st, err := sg.buildRoleStmt([]byte(gql), []byte(`{ "cursor": null }`), "user", psql.Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(`{"products": [{"id": 2, "cursor": "9.5,2"}, {"id": 1, "cursor": "8,1"}], "products_cursor": "8,1"}`)
+
+	cur, err := sg.encryptCursor(st.qc, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cur.value != "8,1" {
+		t.Fatalf("expected the page cursor got '%s'", cur.value)
+	}
+
+	var res struct {
+		Products []struct {
+			Cursor string
+		}
+		ProductsCursor string `json:"products_cursor"`
+	}
+
+	if err := json.Unmarshal(cur.data, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range []string{"9.5,2", "8,1"} {
+		d, err := sg.decrypt(res.Products[i].Cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(d) != v {
+			t.Fatalf("expected row cursor '%s' got '%s'", v, d)
+		}
+	}
+
+	v, err := base64.StdEncoding.DecodeString(res.ProductsCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v[len(v)-1] ^= 1
+
+	if _, err := sg.decrypt(base64.StdEncoding.EncodeToString(v)); err == nil {
+		t.Fatal("expected a tampered cursor to fail")
+	}
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// DirectiveFunc function handles a custom directive. It's called when a
+// query is compiled with the table the directive is on and its arguments as
+// they are in the query, a variable is passed as its name (eg. `$id`).
+type DirectiveFunc func(table string, args map[string]string) (DirectiveResult, error)
+
+// DirectiveResult struct is how a custom directive changes the table selection
+type DirectiveResult struct {
+	// Skip leaves the selection out of the query
+	Skip bool
+
+	// Filter is added to the where clause (eg. `{ deleted: { eq: false } }`)
+	Filter string
+
+	// Limit caps the number of rows returned, a smaller limit
+	// in the query is kept
+	Limit int
+}
+
+func directiveFn(fn DirectiveFunc) qcode.DirectiveFunc {
+	return func(sel *qcode.Select, args []qcode.Arg, role string) error {
+		am := make(map[string]string, len(args))
+
+		for _, a := range args {
+			if a.Val.Type == qcode.NodeVar {
+				am[a.Name] = "$" + a.Val.Val
+			} else {
+				am[a.Name] = a.Val.Val
+			}
+		}
+
+		res, err := fn(sel.Name, am)
+		if err != nil {
+			return err
+		}
+
+		if res.Skip {
+			sel.SkipRender = qcode.SkipTypeDirective
+			return nil
+		}
+
+		if res.Filter != "" {
+			fil, nu, err := qcode.CompileFilter(res.Filter)
+			if err != nil {
+				return err
+			}
+
+			if nu && role == "anon" {
+				sel.SkipRender = qcode.SkipTypeUserNeeded
+			}
+
+			switch fil.Op {
+			case qcode.OpNop:
+			case qcode.OpFalse:
+				sel.Where = fil
+			default:
+				qcode.AddFilter(sel, fil)
+			}
+		}
+
+		if res.Limit > 0 {
+			qcode.CapLimit(sel, res.Limit)
+		}
+
+		return nil
+	}
+}
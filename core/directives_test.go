@@ -0,0 +1,169 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+func TestCustomDirective(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var args map[string]string
+
+	conf := &Config{Directives: map[string]DirectiveFunc{
+		"tenant": func(table string, a map[string]string) (DirectiveResult, error) {
+			args = a
+			if a["id"] == "0" {
+				return DirectiveResult{}, errors.New("invalid tenant")
+			}
+			return DirectiveResult{Filter: `{ user_id: { eq: ` + a["id"] + ` } }`, Limit: 5}, nil
+		},
+	}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := sg.buildRoleStmt([]byte(`query { products @tenant(id: 7, key: $key) { id } }`),
+		nil, "user", psql.Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if args["id"] != "7" || args["key"] != "$key" {
+		t.Fatalf("unexpected args: %v", args)
+	}
+
+	for _, v := range []string{`"products"."user_id") = '7'`, `LIMIT ('5')`} {
+		if !strings.Contains(st.sql, v) {
+			t.Fatalf("expected '%s' in:\n%s", v, st.sql)
+		}
+	}
+
+	// the directive limit only lowers the limit of the query
+	for gql, v := range map[string]string{
+		`query { products(limit: 2) @tenant(id: 7) { id } }`:  `LIMIT ('2')`,
+		`query { products(limit: 50) @tenant(id: 7) { id } }`: `LIMIT ('5')`,
+	} {
+		st, err := sg.buildRoleStmt([]byte(gql), nil, "user", psql.Metadata{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(st.sql, v) {
+			t.Fatalf("expected '%s' in:\n%s", v, st.sql)
+		}
+	}
+
+	_, err = sg.buildRoleStmt([]byte(`query { products @tenant(id: 0) { id } }`),
+		nil, "user", psql.Metadata{})
+	if err == nil || !strings.Contains(err.Error(), "@tenant: invalid tenant") {
+		t.Fatalf("expected the directive error got: %v", err)
+	}
+}
+
+func TestDirectiveUserNeeded(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Directives: map[string]DirectiveFunc{
+		"mine": func(table string, a map[string]string) (DirectiveResult, error) {
+			return DirectiveResult{Filter: `{ user_id: { eq: $user_id } }`}, nil
+		},
+	}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := []byte(`query { products @mine { id } }`)
+
+	st, err := sg.buildRoleStmt(gql, nil, "anon", psql.Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.qc.Selects[0].SkipRender != qcode.SkipTypeUserNeeded {
+		t.Fatal("expected the selection to need a user for anon")
+	}
+
+	st, err = sg.buildRoleStmt(gql, nil, "user", psql.Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.qc.Selects[0].SkipRender != qcode.SkipTypeNone {
+		t.Fatal("expected the selection to be rendered for a user")
+	}
+}
+
+func TestDirectiveVarsAllowList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	al := filepath.Join(t.TempDir(), "allow.list")
+
+	// the variables saved in the allow list skip the products
+	err = ioutil.WriteFile(al, []byte(`/* getProducts */
+
+variables {
+  "skip": true
+}
+
+query getProducts { products @skip(if: $skip) { id } }
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{UseAllowList: true, AllowListFile: al}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := `query getProducts { products @skip(if: $skip) { id } }`
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+
+	res, err := sg.GraphQL(ct, gql, json.RawMessage(`{"skip": false}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Data) != `{"products": []}` {
+		t.Fatalf("expected the products got: %s", res.Data)
+	}
+
+	res, err = sg.GraphQL(ct, gql, json.RawMessage(`{"skip": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Data) != `{}` {
+		t.Fatalf("expected the products to be skipped got: %s", res.Data)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestDryRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := `{"product": {"id": 5, "name": "Bag"}}`
+	vars := json.RawMessage(`{"data": {"name": "Bag"}}`)
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+	dry := context.WithValue(ct, DryRunKey, true)
+
+	// the mutation is rolled back and its result returned
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "products"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(data))
+	mock.ExpectRollback()
+
+	res, err := sg.GraphQL(dry, `mutation { product(insert: $data) { id name } }`, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(res.Data) != data {
+		t.Fatalf("unexpected result: %s", res.Data)
+	}
+
+	if res.Extensions == nil || !res.Extensions.DryRun {
+		t.Fatal("expected the dry run extension")
+	}
+
+	// queries are run as usual
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+
+	res, err = sg.GraphQL(dry, `query { products { id } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Extensions != nil && res.Extensions.DryRun {
+		t.Fatal("expected no dry run extension for a query")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
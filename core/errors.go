@@ -0,0 +1,273 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+	"github.com/dosco/super-graph/core/internal/util"
+)
+
+// Error codes of the errors returned by GraphQL and Subscribe so clients can
+// tell them apart, see ErrorCode
+const (
+	// ErrCodeQueryTooLarge and ErrCodeNameTooLong are for queries over
+	// MaxQueryBytes and names over MaxNameLength
+	ErrCodeQueryTooLarge = qcode.ErrCodeQueryTooLarge
+	ErrCodeNameTooLong   = qcode.ErrCodeNameTooLong
+
+	// ErrCodeQueryTooComplex is for queries with too many fields,
+	// arguments or tables and those over MaxDepth or MaxCost
+	ErrCodeQueryTooComplex = qcode.ErrCodeQueryTooComplex
+
+	// ErrCodeRoleForbidden is for tables or operations blocked for the
+	// role and roles that are not in the config
+	ErrCodeRoleForbidden = qcode.ErrCodeRoleForbidden
+
+	// ErrCodeResultTooLarge is for results over MaxResultBytes
+	ErrCodeResultTooLarge = "RESULT_TOO_LARGE"
+
+	// ErrCodeRateLimited is for requests over a rate limit
+	ErrCodeRateLimited = "RATE_LIMITED"
+
+	// ErrCodeQuotaExceeded is for requests over the quota
+	// of their api key or tenant
+	ErrCodeQuotaExceeded = "QUOTA_EXCEEDED"
+
+	// ErrCodeQueryTimeout is for queries that ran past their timeout
+	ErrCodeQueryTimeout = "QUERY_TIMEOUT"
+
+	// ErrCodeBudgetExceeded is for requests over their budget, see Budget
+	ErrCodeBudgetExceeded = "BUDGET_EXCEEDED"
+)
+
+// Error categories are the stages of running a query an error is from, see
+// ErrorCategory. Lex, parse, validate and authorize errors are usually bugs of
+// the client and the others problems of the server, database or remote apis
+const (
+	ErrCatLex       = "lex"
+	ErrCatParse     = "parse"
+	ErrCatValidate  = "validate"
+	ErrCatAuthorize = "authorize"
+	ErrCatCompile   = "compile"
+	ErrCatExecute   = "execute"
+	ErrCatEncode    = "encode"
+	ErrCatRemote    = "remote"
+)
+
+// Errors returned by GraphQL and Subscribe, check for them with errors.Is.
+// The limits a query is over are returned as a LimitError that wraps one
+var (
+	ErrBlankQuery = qcode.ErrBlankQuery
+
+	ErrQueryTooLarge = qcode.ErrQueryTooLarge
+	ErrNameTooLong   = qcode.ErrNameTooLong
+	ErrFieldLimit    = qcode.ErrFieldLimit
+	ErrArgLimit      = qcode.ErrArgLimit
+	ErrSelectorLimit = qcode.ErrSelectorLimit
+	ErrMaxDepth      = qcode.ErrMaxDepth
+	ErrMaxCost       = qcode.ErrMaxCost
+)
+
+// Location is the line and column (from 1) of a token in the query
+type Location = qcode.Location
+
+// QueryError is an error found in a query with the locations of the
+// tokens it's for and the path to the field, see GraphQLErrors
+type QueryError = qcode.Error
+
+// SyntaxError is an error in the syntax of a query with the byte offset
+// (Pos) of the token it was found at
+type SyntaxError = qcode.SyntaxError
+
+// LimitError is returned for queries over the size and complexity limits
+// (eg. MaxQueryBytes or MaxDepth), its Code is the error code
+type LimitError = qcode.LimitError
+
+// AccessError is returned for tables, namespaces and operations
+// blocked for the role
+type AccessError = qcode.AccessError
+
+// GraphQLError is an error in the format of the GraphQL spec with the locations
+// in the query it was found at and the path to the field it's for when known
+type GraphQLError struct {
+	Message    string           `json:"message"`
+	Locations  []Location       `json:"locations,omitempty"`
+	Path       []string         `json:"path,omitempty"`
+	Extensions *ErrorExtensions `json:"extensions,omitempty"`
+}
+
+// ErrorExtensions has the code of the error, see ErrorCode, and the
+// constraint, table and column of constraint violations
+type ErrorExtensions struct {
+	Code       string `json:"code"`
+	Constraint string `json:"constraint,omitempty"`
+	Table      string `json:"table,omitempty"`
+	Column     string `json:"column,omitempty"`
+
+	// Budget is the budget a request went over
+	Budget *BudgetError `json:"budget,omitempty"`
+}
+
+// ErrRateLimited is the error for requests over a rate limit
+var ErrRateLimited error = &codeError{ErrCodeRateLimited, "too many requests"}
+
+type codeError struct {
+	code string
+	msg  string
+}
+
+func (e *codeError) Error() string {
+	return e.msg
+}
+
+// catError is an error of a stage of running a query
+type catError struct {
+	cat string
+	err error
+}
+
+func (e *catError) Error() string {
+	return e.err.Error()
+}
+
+func (e *catError) Unwrap() error {
+	return e.err
+}
+
+// withCat sets the category of the error unless it already has one, the
+// errors found in a query are returned as is since they have their own
+func withCat(cat string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(util.Errors); ok || errCategory(err) != "" {
+		return err
+	}
+	return &catError{cat: cat, err: err}
+}
+
+// ErrorCategory function returns the category of the error returned by GraphQL
+// or Subscribe (eg. ErrCatParse), the errors with none are from executing the query
+func ErrorCategory(err error) string {
+	if err == nil {
+		return ""
+	}
+	if cat := errCategory(err); cat != "" {
+		return cat
+	}
+	return ErrCatExecute
+}
+
+func errCategory(err error) string {
+	var cat *catError
+	var le *qcode.LimitError
+	var se *qcode.SyntaxError
+	var ae *qcode.AccessError
+	var qe *qcode.Error
+	var ce *codeError
+	var pe *persistedError
+
+	// the category of the first of the errors found in a query
+	if errs, ok := err.(util.Errors); ok && len(errs) != 0 {
+		return errCategory(errs[0])
+	}
+
+	switch {
+	case errors.As(err, &cat):
+		return cat.cat
+	case errors.As(err, &le):
+		return ErrCatValidate
+	case errors.As(err, &se):
+		if se.Lex {
+			return ErrCatLex
+		}
+		return ErrCatParse
+	case errors.As(err, &ae):
+		return ErrCatAuthorize
+	case errors.As(err, &qe), errors.As(err, &pe):
+		return ErrCatValidate
+	case errors.As(err, &ce):
+		switch ce.code {
+		case ErrCodeResultTooLarge:
+			return ErrCatEncode
+		case ErrCodeQueryTimeout:
+			return ErrCatExecute
+		}
+		return ErrCatAuthorize
+	}
+	return ""
+}
+
+// ErrorCode function returns the code of the error returned by GraphQL or
+// Subscribe if it has one (eg. ErrCodeQueryTooLarge), else an empty string
+func ErrorCode(err error) string {
+	var le *qcode.LimitError
+	var ae *qcode.AccessError
+	var ce *codeError
+	var pe *persistedError
+	var cve *ConstraintError
+	var be *BudgetError
+
+	// the code of the first of the errors found in a query
+	if errs, ok := err.(util.Errors); ok && len(errs) != 0 {
+		return ErrorCode(errs[0])
+	}
+
+	switch {
+	case errors.As(err, &le):
+		return le.Code
+	case errors.As(err, &ae):
+		return ErrCodeRoleForbidden
+	case errors.As(err, &ce):
+		return ce.code
+	case errors.As(err, &pe):
+		return pe.code
+	case errors.As(err, &cve):
+		return cve.Code
+	case errors.As(err, &be):
+		return ErrCodeBudgetExceeded
+	}
+	return ""
+}
+
+// GraphQLErrors function returns the error returned by GraphQL or Subscribe
+// in the format of the GraphQL spec, one for each of the errors found in a query
+func GraphQLErrors(err error) []GraphQLError {
+	if err == nil {
+		return nil
+	}
+
+	errs, ok := err.(util.Errors)
+	if !ok {
+		errs = util.Errors{err}
+	}
+
+	ge := make([]GraphQLError, len(errs))
+
+	for i, e := range errs {
+		ge[i].Message = e.Error()
+
+		var qe *qcode.Error
+		if errors.As(e, &qe) {
+			ge[i].Locations = qe.Locations
+			ge[i].Path = qe.Path
+		}
+
+		if code := ErrorCode(e); code != "" {
+			ge[i].Extensions = &ErrorExtensions{Code: code}
+		}
+
+		var cve *ConstraintError
+		if errors.As(e, &cve) {
+			ge[i].Extensions.Constraint = cve.Constraint
+			ge[i].Extensions.Table = cve.Table
+			ge[i].Extensions.Column = cve.Column
+		}
+
+		var be *BudgetError
+		if errors.As(e, &be) {
+			ge[i].Extensions.Budget = be
+		}
+	}
+	return ge
+}
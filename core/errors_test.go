@@ -0,0 +1,125 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestErrorCategory(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{}
+
+	if err := conf.AddRoleTable("user", "products", Insert{Block: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		vars  string
+		role  string
+		cat   string
+	}{
+		{"query { products { id ^ } }", "", "user", ErrCatLex},
+		{`query { products { id }`, "", "user", ErrCatParse},
+		{`query { users(id: $id) { id } }`, `{"id": `, "user", ErrCatValidate},
+		{`mutation { products(insert: $data) { id } }`, `{"data": {"name": "shoes"}}`, "user", ErrCatAuthorize},
+		{`query { users { id, unknown_column } }`, "", "user", ErrCatCompile},
+	}
+
+	for _, v := range tests {
+		_, err := sg.buildRoleStmt([]byte(v.query), []byte(v.vars), v.role, psql.Metadata{})
+		if err == nil {
+			t.Fatalf("%s: expected an error", v.query)
+		}
+
+		if cat := ErrorCategory(err); cat != v.cat {
+			t.Fatalf("%s: expected the category '%s' got '%s' (%s)", v.query, v.cat, cat, err)
+		}
+	}
+
+	err = withCat(ErrCatRemote, errors.New("remote api failed"))
+
+	if cat := ErrorCategory(fmt.Errorf("join: %w", err)); cat != ErrCatRemote {
+		t.Fatalf("expected the category '%s' got '%s'", ErrCatRemote, cat)
+	}
+
+	if cat := ErrorCategory(errors.New("connection refused")); cat != ErrCatExecute {
+		t.Fatalf("expected the category '%s' got '%s'", ErrCatExecute, cat)
+	}
+
+	if cat := ErrorCategory(ErrRateLimited); cat != ErrCatAuthorize {
+		t.Fatalf("expected the category '%s' got '%s'", ErrCatAuthorize, cat)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{MaxFields: 4, MaxDepth: 2}
+
+	if err := conf.AddRoleTable("user", "products", Insert{Block: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := func(query, vars string) error {
+		_, err := sg.buildRoleStmt([]byte(query), []byte(vars), "user", psql.Metadata{})
+		if err == nil {
+			t.Fatalf("%s: expected an error", query)
+		}
+		return err
+	}
+
+	if err := build(``, ""); !errors.Is(err, ErrBlankQuery) {
+		t.Fatalf("expected ErrBlankQuery got: %v", err)
+	}
+
+	err = build(`query { products { id name price user_id } }`, "")
+
+	var le *LimitError
+	if !errors.Is(err, ErrFieldLimit) || !errors.As(err, &le) || le.Code != ErrCodeQueryTooComplex {
+		t.Fatalf("expected ErrFieldLimit got: %v", err)
+	}
+
+	if err := build(`query { products { user { products { id } } } }`, ""); !errors.Is(err, ErrMaxDepth) {
+		t.Fatalf("expected ErrMaxDepth got: %v", err)
+	}
+
+	var se *SyntaxError
+	if err := build("query {\n products { id ^ } }", ""); !errors.As(err, &se) || !se.Lex {
+		t.Fatalf("expected a syntax error got: %v", err)
+	}
+
+	if se.Pos != 23 {
+		t.Fatalf("expected the syntax error at 23 got %d", se.Pos)
+	}
+
+	var ae *AccessError
+	err = build(`mutation { products(insert: $data) { id } }`, `{"data": {"name": "shoes"}}`)
+
+	if !errors.As(err, &ae) || ae.Role != "user" || ae.Name != "products" {
+		t.Fatalf("expected an access error for products got: %v", err)
+	}
+}
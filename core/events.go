@@ -0,0 +1,316 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// eventsField is the root field of the subscription
+// the mutations are streamed to as they're made
+const eventsField = "_events"
+
+const defaultEventsBuffer = 100
+
+// eventFields are the fields of an event that can be selected
+var eventFields = []string{"table", "op", "name", "role", "user_id", "data", "time"}
+
+// event is a change made by a mutation to a table, data is the
+// result of the mutation for the table
+type event struct {
+	table  string
+	op     string
+	name   string
+	role   string
+	userID interface{}
+	data   json.RawMessage
+	time   time.Time
+}
+
+// eventHub keeps the members of the _events subscription
+type eventHub struct {
+	sync.RWMutex
+	subs map[*Member]*eventSub
+}
+
+// eventSub is the tables a member watches and the fields it selected
+type eventSub struct {
+	hub    *eventHub
+	key    string
+	tables map[string]struct{}
+	fields []eventSel
+}
+
+type eventSel struct {
+	name string
+	key  string
+}
+
+// isEventsQuery returns true if the only root field
+// of the subscription is the _events field
+func isEventsQuery(query string) bool {
+	op, err := qcode.Parse([]byte(query))
+	if err != nil {
+		return false
+	}
+	defer qcode.FreeOperation(op)
+
+	for _, f := range op.Fields {
+		if f.ParentID == -1 {
+			return f.Name == eventsField
+		}
+	}
+	return false
+}
+
+// canWatchEvents returns true if the role can subscribe to _events
+func (sg *SuperGraph) canWatchEvents(role string) bool {
+	for _, r := range sg.conf.Events.Roles {
+		if sanitize(r) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribeEvents adds a member to the _events subscription, it gets
+// the changes made by the mutations to the tables in the tables
+// argument or all the tables when it's not set
+func (sg *SuperGraph) subscribeEvents(query string, vars json.RawMessage, role string) (*Member, error) {
+	if !sg.canWatchEvents(role) {
+		return nil, &codeError{ErrCodeRoleForbidden,
+			fmt.Sprintf("subscription: %s: not allowed for role '%s'", eventsField, role)}
+	}
+
+	es, err := parseEventsQuery(query, vars)
+	if err != nil {
+		return nil, fmt.Errorf("subscription: %s: %w", eventsField, err)
+	}
+
+	n := sg.conf.Events.BufferSize
+	if n <= 0 {
+		n = defaultEventsBuffer
+	}
+
+	m := &Member{Result: make(chan *Result, n), ev: es}
+	es.hub = &sg.events
+
+	sg.events.Lock()
+	if sg.events.subs == nil {
+		sg.events.subs = make(map[*Member]*eventSub)
+	}
+	sg.events.subs[m] = es
+	sg.events.Unlock()
+
+	return m, nil
+}
+
+// parseEventsQuery returns the tables and fields of the _events subscription
+func parseEventsQuery(query string, vars json.RawMessage) (*eventSub, error) {
+	op, err := qcode.Parse([]byte(query))
+	if err != nil {
+		return nil, err
+	}
+	defer qcode.FreeOperation(op)
+
+	var root *qcode.Field
+	for i := range op.Fields {
+		if f := &op.Fields[i]; f.ParentID == -1 {
+			if root != nil {
+				return nil, errors.New("must be the only root field")
+			}
+			root = f
+		}
+	}
+
+	es := &eventSub{key: root.Name}
+	if root.Alias != "" {
+		es.key = root.Alias
+	}
+
+	for _, a := range root.Args {
+		if a.Name != "tables" {
+			return nil, fmt.Errorf("unknown argument '%s'", a.Name)
+		}
+
+		tables, err := eventTables(a.Val, vars)
+		if err != nil {
+			return nil, err
+		}
+
+		es.tables = make(map[string]struct{}, len(tables))
+		for _, t := range tables {
+			es.tables[t] = struct{}{}
+		}
+	}
+
+	for _, id := range root.Children {
+		f := op.Fields[id]
+
+		if len(f.Children) != 0 || !inList(eventFields, f.Name) {
+			return nil, fmt.Errorf("unknown field '%s'", f.Name)
+		}
+
+		sel := eventSel{name: f.Name, key: f.Name}
+		if f.Alias != "" {
+			sel.key = f.Alias
+		}
+		es.fields = append(es.fields, sel)
+	}
+
+	if len(es.fields) == 0 {
+		return nil, errors.New("no fields selected")
+	}
+
+	return es, nil
+}
+
+// eventTables returns the tables of the tables argument
+// set as a list or a variable
+func eventTables(n *qcode.Node, vars json.RawMessage) ([]string, error) {
+	var tables []string
+
+	switch n.Type {
+	case qcode.NodeStr:
+		return []string{n.Val}, nil
+
+	case qcode.NodeList:
+		for _, v := range n.Children {
+			if v.Type != qcode.NodeStr {
+				return nil, errors.New("tables: expecting a list of strings")
+			}
+			tables = append(tables, v.Val)
+		}
+		return tables, nil
+
+	case qcode.NodeVar:
+		var vm map[string]json.RawMessage
+
+		if len(vars) != 0 {
+			if err := json.Unmarshal(vars, &vm); err != nil {
+				return nil, err
+			}
+		}
+
+		v, ok := vm[n.Val]
+		if !ok {
+			return nil, fmt.Errorf("tables: variable '%s' not found", n.Val)
+		}
+
+		if err := json.Unmarshal(v, &tables); err != nil {
+			return nil, fmt.Errorf("tables: expecting a list of strings: %w", err)
+		}
+		return tables, nil
+	}
+
+	return nil, errors.New("tables: expecting a list of strings")
+}
+
+// remove deletes the member from the _events subscription
+func (h *eventHub) remove(m *Member) {
+	h.Lock()
+	delete(h.subs, m)
+	h.Unlock()
+}
+
+// publishEvents sends the changes made by the mutation to the members of
+// the _events subscription watching the tables, the members that fall
+// behind miss the events to not hold up the mutations
+func (c *scontext) publishEvents(qc *qcode.QCode, data json.RawMessage, role string) {
+	h := &c.sg.events
+
+	h.RLock()
+	defer h.RUnlock()
+
+	if len(h.subs) == 0 || qc == nil || len(data) == 0 {
+		return
+	}
+
+	fields, err := readObj(data)
+	if err != nil {
+		c.sg.log.Printf("ERR events: %s", err)
+		return
+	}
+
+	ev := event{
+		op:     qc.Type.String(),
+		name:   c.name,
+		role:   role,
+		userID: c.Value(UserIDKey),
+		time:   time.Now().UTC(),
+	}
+
+	for _, id := range qc.Roots {
+		sel := &qc.Selects[id]
+
+		if sel.SkipRender != qcode.SkipTypeNone {
+			continue
+		}
+
+		ev.table = sel.Name
+		ev.data = nil
+
+		if ti, err := c.sg.pc.Schema().GetTableInfo(sel.Name); err == nil {
+			ev.table = ti.Name
+		}
+
+		for _, f := range fields {
+			if f.key == sel.FieldName {
+				ev.data = f.val
+			}
+		}
+
+		for m, es := range h.subs {
+			if es.tables != nil {
+				if _, ok := es.tables[ev.table]; !ok {
+					continue
+				}
+			}
+
+			res := &Result{op: qcode.QTSubscription, name: eventsField, Data: es.render(ev)}
+
+			select {
+			case m.Result <- res:
+			default:
+			}
+		}
+	}
+}
+
+// render returns the event with the fields selected by the member
+func (es *eventSub) render(ev event) json.RawMessage {
+	fields := make([]jsonField, 0, len(es.fields))
+
+	for _, f := range es.fields {
+		var v interface{}
+
+		switch f.name {
+		case "table":
+			v = ev.table
+		case "op":
+			v = ev.op
+		case "name":
+			v = ev.name
+		case "role":
+			v = ev.role
+		case "user_id":
+			v = ev.userID
+		case "data":
+			v = ev.data
+		case "time":
+			v = ev.time
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			b = nil
+		}
+		fields = append(fields, jsonField{key: f.key, val: b})
+	}
+
+	return writeObj([]jsonField{{key: es.key, val: writeObj(fields)}})
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Events: Events{Roles: []string{"admin"}}}
+
+	if err := conf.AddRoleTable("admin", "products", Query{}); err != nil {
+		t.Fatal(err)
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+	admin := context.WithValue(ct, UserRoleKey, "admin")
+
+	if _, err := sg.Subscribe(ct, `subscription { _events { table } }`, nil); ErrorCode(err) != ErrCodeRoleForbidden {
+		t.Fatalf("expected a role forbidden error got: %v", err)
+	}
+
+	if _, err := sg.Subscribe(admin, `subscription { _events { table price } }`, nil); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+
+	m, err := sg.Subscribe(admin, `subscription { changes: _events(tables: $tables) { table op who: user_id data } }`,
+		json.RawMessage(`{"tables": ["products"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := sg.Subscribe(admin, `subscription { _events { table } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := `{"product": {"id": 5, "name": "Bag"}}`
+
+	mock.ExpectQuery(`INSERT INTO "products"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(data))
+	mock.ExpectQuery(`INSERT INTO "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"user": {"id": 3}}`))
+
+	vars := json.RawMessage(`{"data": {"name": "Bag"}}`)
+
+	if _, err := sg.GraphQL(ct, `mutation { product(insert: $data) { id name } }`, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sg.GraphQL(ct, `mutation { user(insert: $data) { id } }`, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"changes":{"table":"products","op":"insert","who":1,"data":{"id":5,"name":"Bag"}}}`
+
+	if res := <-m.Result; string(res.Data) != exp {
+		t.Fatalf("expected %s got %s", exp, res.Data)
+	}
+
+	// the changes to the other tables are not sent
+	if len(m.Result) != 0 {
+		t.Fatal("expected only the changes to products")
+	}
+
+	for _, exp := range []string{`{"_events":{"table":"products"}}`, `{"_events":{"table":"users"}}`} {
+		if res := <-all.Result; string(res.Data) != exp {
+			t.Fatalf("expected %s got %s", exp, res.Data)
+		}
+	}
+
+	m.Unsubscribe()
+	all.Unsubscribe()
+
+	if len(sg.events.subs) != 0 {
+		t.Fatal("expected no members after unsubscribing")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
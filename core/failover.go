@@ -0,0 +1,89 @@
+package core
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// database/sql default, used to restore the pool after closing idle connections
+// when MaxIdleConns is not set
+const defaultMaxIdleConns = 2
+
+// isFailoverErr returns true for errors seen when the database fails over to a
+// new primary. Eg. the connection was closed or the server we're connected to
+// was demoted to a read-only replica.
+func isFailoverErr(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) {
+		return true
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+
+	var se interface{ SQLState() string }
+	if errors.As(err, &se) {
+		return isFailoverState(se.SQLState())
+	}
+
+	return false
+}
+
+func isFailoverState(code string) bool {
+	switch code {
+	case "25006", // read_only_sql_transaction
+		"57P01",                   // admin_shutdown
+		"57P02",                   // crash_shutdown
+		"57P03",                   // cannot_connect_now
+		"08000", "08003", "08006": // connection exceptions
+		return true
+	}
+	return false
+}
+
+// isReadOnlyErr returns true when the statement was rejected since the server
+// is read-only. Nothing was written so it's safe to retry even mutations.
+func isReadOnlyErr(err error) bool {
+	var se interface{ SQLState() string }
+	return errors.As(err, &se) && se.SQLState() == "25006"
+}
+
+// canRetry returns true if the failed query can be run again on a new connection
+func (c *scontext) canRetry(err error) bool {
+	if c.op == qcode.QTMutation {
+		return errors.Is(err, driver.ErrBadConn) || isReadOnlyErr(err)
+	}
+	return isFailoverErr(err)
+}
+
+// resetPool closes all idle connections of the default database and of the
+// one the query was run on (eg. a replica) so new ones are opened, this also
+// re-resolves the database hosts to find the new primary
+func (c *scontext) resetPool() {
+	n := c.sg.conf.MaxIdleConns
+	if n == 0 {
+		n = defaultMaxIdleConns
+	}
+
+	resetDB(c.sg.db, n)
+
+	if c.db != nil && c.db != c.sg.db {
+		resetDB(c.db, n)
+	}
+}
+
+func resetDB(db *sql.DB, maxIdle int) {
+	db.SetMaxIdleConns(0)
+	db.SetMaxIdleConns(maxIdle)
+}
+
+func retryDelay(attempt int) time.Duration {
+	return time.Duration(attempt*attempt) * 100 * time.Millisecond
+}
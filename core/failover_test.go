@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+type stateErr string
+
+func (e stateErr) Error() string    { return "sql error " + string(e) }
+func (e stateErr) SQLState() string { return string(e) }
+
+// nopConnector opens connections that can't run anything, to count the
+// connections of a pool
+type nopConnector struct{}
+
+func (nopConnector) Connect(context.Context) (driver.Conn, error) { return nopConn{}, nil }
+func (nopConnector) Driver() driver.Driver                        { return nil }
+
+type nopConn struct{}
+
+func (nopConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (nopConn) Close() error                        { return nil }
+func (nopConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func TestCanRetry(t *testing.T) {
+	query := &scontext{op: qcode.QTQuery}
+	mutation := &scontext{op: qcode.QTMutation}
+
+	tests := []struct {
+		err      error
+		query    bool
+		mutation bool
+	}{
+		{driver.ErrBadConn, true, true},
+		{fmt.Errorf("wrapped: %w", stateErr("25006")), true, true},
+		{stateErr("57P01"), true, false},
+		{stateErr("23505"), false, false},
+		{errors.New("syntax error"), false, false},
+	}
+
+	for _, tt := range tests {
+		if v := query.canRetry(tt.err); v != tt.query {
+			t.Errorf("query '%s': expected %t got %t", tt.err, tt.query, v)
+		}
+		if v := mutation.canRetry(tt.err); v != tt.mutation {
+			t.Errorf("mutation '%s': expected %t got %t", tt.err, tt.mutation, v)
+		}
+	}
+}
+
+func TestResetPool(t *testing.T) {
+	db := sql.OpenDB(nopConnector{})
+	defer db.Close()
+
+	replica := sql.OpenDB(nopConnector{})
+	defer replica.Close()
+
+	const maxIdle = 4
+
+	sg := &SuperGraph{conf: &Config{MaxIdleConns: maxIdle}, db: db}
+	c := &scontext{Context: context.Background(), sg: sg, db: replica}
+
+	// idle returns the number of connections left idle after n are used
+	idle := func(db *sql.DB, n int) int {
+		var err error
+
+		conns := make([]*sql.Conn, n)
+		for i := range conns {
+			if conns[i], err = db.Conn(c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, conn := range conns {
+			conn.Close()
+		}
+		return db.Stats().Idle
+	}
+
+	for _, d := range []*sql.DB{db, replica} {
+		idle(d, 1)
+	}
+	c.resetPool()
+
+	for i, d := range []*sql.DB{db, replica} {
+		if n := d.Stats().Idle; n != 0 {
+			t.Fatalf("db %d: expected the idle connections to be closed, got %d", i, n)
+		}
+		if n := idle(d, maxIdle+2); n != maxIdle {
+			t.Fatalf("db %d: expected %d idle connections, got %d", i, maxIdle, n)
+		}
+	}
+}
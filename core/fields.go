@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Field struct is a single selection handed over by another GraphQL server
+// such as gqlgen or graphql-go. It's used to resolve the database backed
+// portion of a schema using Super Graph while the rest of the schema is
+// resolved by custom code.
+type Field struct {
+	// Name of the table or column
+	Name string
+
+	// Alias is the name used for this field in the response json
+	Alias string
+
+	// Args are the field arguments (eg. where, limit, order_by, etc)
+	Args []Arg
+
+	// Fields are the child selections of this field
+	Fields []Field
+}
+
+// Arg struct is a field argument. The value must be a GraphQL literal
+// (eg. `{ id: { eq: $id } }`, `10` or `$id`)
+type Arg struct {
+	Name  string
+	Value string
+}
+
+// GraphQLFields function is used to resolve a selection set passed in from another GraphQL
+// server. The selections are converted into a GraphQL query and executed using the same
+// code path as the GraphQL function. The data returned is keyed by the alias (or name) of
+// each root field.
+func (sg *SuperGraph) GraphQLFields(c context.Context, op OpType, fields []Field, vars json.RawMessage) (*Result, error) {
+	query, err := renderFields(op, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return sg.GraphQL(c, query, vars)
+}
+
+func renderFields(op OpType, fields []Field) (string, error) {
+	var sb strings.Builder
+
+	if len(fields) == 0 {
+		return "", errors.New("no fields selected")
+	}
+
+	switch op {
+	case OpQuery, OpUnknown:
+		sb.WriteString("query ")
+	case OpMutation:
+		sb.WriteString("mutation ")
+	case OpSubscription:
+		return "", errors.New("use 'core.Subscribe' for subscriptions")
+	default:
+		return "", errors.New("unknown operation type")
+	}
+
+	if err := writeFields(&sb, fields); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+func writeFields(sb *strings.Builder, fields []Field) error {
+	sb.WriteString("{ ")
+
+	for _, f := range fields {
+		if f.Name == "" {
+			return errors.New("field name cannot be empty")
+		}
+
+		if f.Alias != "" && f.Alias != f.Name {
+			sb.WriteString(f.Alias)
+			sb.WriteString(": ")
+		}
+		sb.WriteString(f.Name)
+
+		if len(f.Args) != 0 {
+			sb.WriteString("(")
+			for i, a := range f.Args {
+				if i != 0 {
+					sb.WriteString(", ")
+				}
+				sb.WriteString(a.Name)
+				sb.WriteString(": ")
+				sb.WriteString(a.Value)
+			}
+			sb.WriteString(")")
+		}
+		sb.WriteString(" ")
+
+		if len(f.Fields) != 0 {
+			if err := writeFields(sb, f.Fields); err != nil {
+				return err
+			}
+		}
+	}
+
+	sb.WriteString("} ")
+	return nil
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestRenderFields(t *testing.T) {
+	fields := []Field{{
+		Name:  "products",
+		Alias: "items",
+		Args: []Arg{
+			{Name: "limit", Value: "10"},
+			{Name: "where", Value: "{ id: { eq: $id } }"},
+		},
+		Fields: []Field{
+			{Name: "id"},
+			{Name: "name"},
+			{Name: "user", Fields: []Field{{Name: "email"}}},
+		},
+	}}
+
+	exp := `query { items: products(limit: 10, where: { id: { eq: $id } }) { id name user { email } } } `
+
+	q, err := renderFields(OpQuery, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, q)
+	}
+}
+
+func TestRenderFieldsErrors(t *testing.T) {
+	if _, err := renderFields(OpQuery, nil); err == nil {
+		t.Fatal("expecting an error for no fields")
+	}
+
+	if _, err := renderFields(OpSubscription, []Field{{Name: "products"}}); err == nil {
+		t.Fatal("expecting an error for subscriptions")
+	}
+
+	if _, err := renderFields(OpQuery, []Field{{Alias: "products"}}); err == nil {
+		t.Fatal("expecting an error for a field without a name")
+	}
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+// Feature flags that toggle compiler behaviors
+const (
+	// FlagLenientMode drops unknown columns from queries with a
+	// warning instead of failing, like lenient_mode does for all
+	FlagLenientMode = "lenient_mode"
+)
+
+var flagNames = []string{
+	FlagLenientMode,
+}
+
+// FeatureFlag turns on a compiler behavior for a percent of the requests.
+// Flags are set per environment in the config file of the environment
+// so a change can be rolled out to dev and staging before production.
+type FeatureFlag struct {
+	Name    string
+	Percent int
+}
+
+// FlagProvider is an external feature flag service, when set it
+// decides which flags are on for a request instead of the config
+type FlagProvider interface {
+	Enabled(ctx context.Context, flag string) bool
+}
+
+func (sg *SuperGraph) initFlags() error {
+	sg.flags = make(map[string]int, len(sg.conf.FeatureFlags))
+
+	for _, f := range sg.conf.FeatureFlags {
+		if !validFlag(f.Name) {
+			return fmt.Errorf("feature_flags: unknown flag '%s'", f.Name)
+		}
+
+		if f.Percent < 0 || f.Percent > 100 {
+			return fmt.Errorf("feature_flags: percent of '%s' must be between 0 and 100", f.Name)
+		}
+		sg.flags[f.Name] = f.Percent
+	}
+
+	return nil
+}
+
+// flagEnabled returns true if the flag is on for the request
+func (sg *SuperGraph) flagEnabled(c context.Context, name string) bool {
+	if sg.conf.FlagProvider != nil {
+		return sg.conf.FlagProvider.Enabled(c, name)
+	}
+
+	p, ok := sg.flags[name]
+	if !ok || p == 0 {
+		return false
+	}
+
+	return p == 100 || rand.Intn(100) < p
+}
+
+// compileMeta returns the metadata the query of
+// the request is compiled with
+func (sg *SuperGraph) compileMeta(c context.Context) psql.Metadata {
+	return psql.Metadata{
+		Lenient: sg.flagEnabled(c, FlagLenientMode),
+	}
+}
+
+func validFlag(name string) bool {
+	for _, v := range flagNames {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+type testFlags map[string]bool
+
+func (f testFlags) Enabled(ctx context.Context, flag string) bool {
+	return f[flag]
+}
+
+func TestFeatureFlags(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	flags := testFlags{}
+	conf := &Config{FlagProvider: flags}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := []byte(`query { products { id not_a_column } }`)
+
+	if _, err := sg.buildRoleStmt(gql, nil, "user", sg.compileMeta(context.Background())); err == nil {
+		t.Fatal("expected an error for an unknown column")
+	}
+
+	flags[FlagLenientMode] = true
+
+	if _, err := sg.buildRoleStmt(gql, nil, "user", sg.compileMeta(context.Background())); err != nil {
+		t.Fatalf("expected the unknown column to be dropped: %s", err)
+	}
+
+	conf = &Config{FeatureFlags: []FeatureFlag{{Name: FlagLenientMode, Percent: 100}}}
+
+	if sg, err = newTestGraph(t, conf, db, psql.GetTestDBInfo()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !sg.compileMeta(context.Background()).Lenient {
+		t.Fatal("expected the flag to be on for all requests")
+	}
+
+	conf = &Config{FeatureFlags: []FeatureFlag{{Name: "new_pagination", Percent: 10}}}
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for an unknown flag")
+	}
+}
@@ -0,0 +1,292 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+	"github.com/dosco/super-graph/jsn"
+)
+
+// maxFormatCache is the number of formatted values kept
+// so the same value is not formatted again and again
+const maxFormatCache = 10000
+
+// FormatterFunc function changes the value of a column before it's returned, the
+// value is json and so is the result (eg. `"**hi**"` to `"<p><strong>hi</strong></p>"`).
+// The arg is the text after the colon in the format of the column (eg. `currency:EUR`).
+type FormatterFunc func(value json.RawMessage, arg string) (json.RawMessage, error)
+
+type formatter struct {
+	name    string
+	arg     string
+	fn      FormatterFunc
+	nocache bool
+}
+
+type formatCache struct {
+	sync.Mutex
+	m map[string]json.RawMessage
+}
+
+var builtinFormatters = map[string]FormatterFunc{
+	"currency": formatCurrency,
+	"prefix":   formatPrefix,
+	"rfc3339":  formatRFC3339,
+	"epoch_ms": formatEpochMillis,
+}
+
+// initFormatters indexes the formats of the columns by table and column
+// name, custom formatters are looked up before the builtin ones
+func (sg *SuperGraph) initFormatters() error {
+	for _, t := range sg.conf.Tables {
+		for _, c := range t.Columns {
+			// the formats of currency columns are set with their currency
+			if (c.Format == "" && !c.Blob) || c.Currency != "" {
+				continue
+			}
+
+			// geometries are returned as GeoJSON by the database
+			if c.Format == "geojson" {
+				continue
+			}
+
+			v := strings.SplitN(c.Format, ":", 2)
+			f := &formatter{name: v[0]}
+
+			if len(v) == 2 {
+				f.arg = v[1]
+			}
+
+			if c.Blob {
+				if c.Format != "" {
+					return fmt.Errorf("table %s: column %s: a blob column can't have a format", t.Name, c.Name)
+				}
+				// signed urls expire so they are not cached
+				f = &formatter{name: "blob", fn: sg.blobURL, nocache: true}
+			} else if fn, ok := sg.conf.Formatters[f.name]; ok {
+				f.fn = fn
+			} else if fn, ok := builtinFormatters[f.name]; ok {
+				f.fn = fn
+			} else {
+				return fmt.Errorf("table %s: column %s: unknown format: %s", t.Name, c.Name, f.name)
+			}
+
+			tn := strings.ToLower(t.Name)
+
+			if sg.formats == nil {
+				sg.formats = make(map[string]map[string]*formatter)
+				sg.fcache = &formatCache{m: make(map[string]json.RawMessage)}
+			}
+			if sg.formats[tn] == nil {
+				sg.formats[tn] = make(map[string]*formatter)
+			}
+			sg.formats[tn][strings.ToLower(c.Name)] = f
+		}
+	}
+
+	return nil
+}
+
+// formatData applies the formats of the columns to the response. The values
+// are found by their field name so a field name used by a column with another
+// (or no) format elsewhere in the query is left as is.
+func (sg *SuperGraph) formatData(qc *qcode.QCode, data []byte) ([]byte, error) {
+	if len(sg.formats) == 0 || qc == nil || len(data) == 0 {
+		return data, nil
+	}
+
+	fm := make(map[string]*formatter)
+	conflict := make(map[string]struct{})
+
+	add := func(k string, f *formatter) {
+		if v, ok := fm[k]; ok && v != f {
+			conflict[k] = struct{}{}
+		}
+		fm[k] = f
+	}
+
+	for i := range qc.Selects {
+		sel := &qc.Selects[i]
+		add(sel.FieldName, nil)
+
+		if sel.SkipRender != qcode.SkipTypeNone {
+			continue
+		}
+
+		tf, ok := sg.formats[sel.Name]
+		if !ok {
+			if ti, err := sg.pc.Schema().GetTableInfo(sel.Name); err == nil {
+				tf = sg.formats[ti.Name]
+			}
+		}
+
+		for _, c := range sel.Cols {
+			add(c.FieldName, tf[c.Name])
+		}
+	}
+
+	var keys [][]byte
+
+	for k, f := range fm {
+		if _, ok := conflict[k]; !ok && f != nil {
+			keys = append(keys, []byte(k))
+		}
+	}
+
+	if len(keys) == 0 {
+		return data, nil
+	}
+
+	from := jsn.Get(data, keys)
+	to := make([]jsn.Field, len(from))
+
+	for i, f := range from {
+		v, err := sg.format(fm[string(f.Key)], f.Value)
+		if err != nil {
+			return data, fmt.Errorf("format %s: %w", f.Key, err)
+		}
+		to[i] = jsn.Field{Key: f.Key, Value: v}
+	}
+
+	var ob bytes.Buffer
+
+	if err := jsn.Replace(&ob, data, from, to); err != nil {
+		return data, err
+	}
+
+	return ob.Bytes(), nil
+}
+
+func (sg *SuperGraph) format(f *formatter, v []byte) (json.RawMessage, error) {
+	if bytes.Equal(v, []byte("null")) {
+		return v, nil
+	}
+
+	if f.nocache {
+		return f.fn(json.RawMessage(v), f.arg)
+	}
+
+	var k string
+
+	// large values (eg. markdown) are keyed by their hash
+	if len(v) > sha256.Size {
+		h := sha256.Sum256(v)
+		k = f.name + ":" + f.arg + "\x00" + string(h[:])
+	} else {
+		k = f.name + ":" + f.arg + "\x00" + string(v)
+	}
+
+	fc := sg.fcache
+	fc.Lock()
+	fv, ok := fc.m[k]
+	fc.Unlock()
+
+	if ok {
+		return fv, nil
+	}
+
+	fv, err := f.fn(json.RawMessage(v), f.arg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(fv) {
+		return nil, fmt.Errorf("%s: invalid json returned", f.name)
+	}
+
+	fc.Lock()
+	// map iteration order is random so this drops a random entry
+	if len(fc.m) >= maxFormatCache {
+		for k := range fc.m {
+			delete(fc.m, k)
+			break
+		}
+	}
+	fc.m[k] = fv
+	fc.Unlock()
+
+	return fv, nil
+}
+
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"INR": "₹",
+}
+
+// formatCurrency formats a number (eg. 1234.5) as a string with two decimals and
+// thousand separators (eg. "$1,234.50"), the arg is the currency code or symbol
+func formatCurrency(v json.RawMessage, arg string) (json.RawMessage, error) {
+	s := string(v)
+
+	// numeric columns can be returned as strings
+	if len(s) != 0 && s[0] == '"' {
+		if err := json.Unmarshal(v, &s); err != nil {
+			return nil, err
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("currency: not a number: %s", v)
+	}
+
+	sym := "$"
+	if arg != "" {
+		if cs, ok := currencySymbols[strings.ToUpper(arg)]; ok {
+			sym = cs
+		} else {
+			sym = arg
+		}
+	}
+
+	num := strconv.FormatFloat(n, 'f', 2, 64)
+	neg := strings.HasPrefix(num, "-")
+	num = strings.TrimPrefix(num, "-")
+
+	dot := strings.IndexByte(num, '.')
+	var sb strings.Builder
+
+	if neg {
+		sb.WriteByte('-')
+	}
+	sb.WriteString(sym)
+
+	for i := 0; i < dot; i++ {
+		if i != 0 && (dot-i)%3 == 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte(num[i])
+	}
+	sb.WriteString(num[dot:])
+
+	return json.Marshal(sb.String())
+}
+
+// formatPrefix adds the arg to the start of a string value (eg. a cdn url
+// to a path), values that are already absolute urls are left as is
+func formatPrefix(v json.RawMessage, arg string) (json.RawMessage, error) {
+	var s string
+
+	if err := json.Unmarshal(v, &s); err != nil {
+		return v, nil
+	}
+
+	if s == "" || strings.Contains(s, "://") {
+		return v, nil
+	}
+
+	if strings.HasSuffix(arg, "/") && strings.HasPrefix(s, "/") {
+		s = s[1:]
+	}
+
+	return json.Marshal(arg + s)
+}
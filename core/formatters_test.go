@@ -0,0 +1,100 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+func TestFormatters(t *testing.T) {
+	tests := []struct {
+		fn       FormatterFunc
+		arg      string
+		val, exp string
+	}{
+		{formatCurrency, "", `1234567.5`, `"$1,234,567.50"`},
+		{formatCurrency, "eur", `"-12.345"`, `"-€12.35"`},
+		{formatCurrency, "CHF ", `999`, `"CHF 999.00"`},
+		{formatPrefix, "https://cdn.example.com/", `"/img/a.png"`, `"https://cdn.example.com/img/a.png"`},
+		{formatPrefix, "https://cdn.example.com/", `"http://a.com/a.png"`, `"http://a.com/a.png"`},
+	}
+
+	for _, v := range tests {
+		b, err := v.fn(json.RawMessage(v.val), v.arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != v.exp {
+			t.Errorf("expected %s got %s", v.exp, b)
+		}
+	}
+
+	if _, err := formatCurrency(json.RawMessage(`"abc"`), ""); err == nil {
+		t.Error("expected an error for a string that's not a number")
+	}
+}
+
+func TestFormatData(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	calls := 0
+
+	conf := &Config{
+		Tables: []Table{{Name: "products", Columns: []Column{
+			{Name: "price", Format: "currency"},
+			{Name: "description", Format: "upper"},
+		}}},
+		Formatters: map[string]FormatterFunc{
+			"upper": func(v json.RawMessage, arg string) (json.RawMessage, error) {
+				calls++
+				return json.RawMessage(strings.ToUpper(string(v))), nil
+			},
+		},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cq := &cquery{q: rquery{op: qcode.QTQuery,
+		query: []byte(`query { products { id price description } }`)}}
+
+	if err := sg.compileQuery(cq, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	data := `{"products":[{"id":1,"price":10.5,"description":"fresh"},` +
+		`{"id":2,"price":null,"description":"fresh"}]}`
+
+	b, err := sg.formatData(cq.st.qc, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"products":[{"id":1,"price":"$10.50","description":"FRESH"},` +
+		`{"id":2,"price":null,"description":"FRESH"}]}`
+
+	if string(b) != exp {
+		t.Fatalf("expected %s got %s", exp, b)
+	}
+
+	// the formatted value is cached
+	if calls != 1 {
+		t.Fatalf("expected one call to the formatter got %d", calls)
+	}
+
+	conf.Tables[0].Columns[0].Format = "unknown"
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,291 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+	"github.com/dosco/super-graph/jsn"
+)
+
+// Hooks are functions run at the stages of a GraphQL request to add business
+// logic without changing the compiler. An error returned by a hook stops the
+// request and is returned by GraphQL. They can only be set in code
+type Hooks struct {
+	// BeforeParse is run before the query is parsed, it can change the
+	// query and the variables
+	BeforeParse func(c context.Context, r *HookRequest) error
+
+	// AfterCompile is run once the query is compiled and before it's run, it
+	// can change the sql or return an error to stop it from being run
+	AfterCompile func(c context.Context, q *HookQuery) error
+
+	// AfterExec is run once the query is run, it can change the result
+	AfterExec func(c context.Context, r *HookResult) error
+}
+
+// HookRequest is the request passed to the BeforeParse hook
+type HookRequest struct {
+	Query string
+	Vars  json.RawMessage
+}
+
+// HookQuery is the compiled query passed to the AfterCompile hook, the
+// sql is only changed for the request and not in the compile cache
+type HookQuery struct {
+	Operation OpType
+	Name      string
+	Role      string
+	SQL       string
+}
+
+// HookResult is the result passed to the AfterExec hook
+type HookResult struct {
+	Operation OpType
+	Name      string
+	Role      string
+	Data      json.RawMessage
+}
+
+// ComputedField is a field of a table with a value computed by a Go function
+// from the columns of the row it requires (eg. a full_name from the first_name
+// and last_name). The function gets the required columns keyed by name and
+// returns the value as json
+type ComputedField struct {
+	Requires []string
+	Fn       func(c context.Context, row map[string]json.RawMessage) (json.RawMessage, error)
+
+	// Type is the GraphQL type of the field in the introspection
+	// schema. Defaults to String
+	Type string
+}
+
+func opType(op qcode.QType) OpType {
+	switch op {
+	case qcode.QTQuery:
+		return OpQuery
+	case qcode.QTSubscription:
+		return OpSubscription
+	case qcode.QTMutation, qcode.QTInsert, qcode.QTUpdate, qcode.QTDelete, qcode.QTUpsert:
+		return OpMutation
+	}
+	return OpUnknown
+}
+
+// beforeParse runs the BeforeParse hook on the query and variables
+func (sg *SuperGraph) beforeParse(c context.Context, query string, vars json.RawMessage) (string, json.RawMessage, error) {
+	if sg.conf.Hooks.BeforeParse == nil {
+		return query, vars, nil
+	}
+
+	r := HookRequest{Query: query, Vars: vars}
+
+	if err := sg.conf.Hooks.BeforeParse(c, &r); err != nil {
+		return query, vars, err
+	}
+	return r.Query, r.Vars, nil
+}
+
+// afterCompile runs the AfterCompile hook on the sql of the compiled query,
+// a query with its sql changed is no longer run as a statement for each root
+func (c *scontext) afterCompile(cq *cquery, role string) error {
+	if c.sg.conf.Hooks.AfterCompile == nil {
+		return nil
+	}
+
+	q := HookQuery{
+		Operation: opType(c.op),
+		Name:      c.name,
+		Role:      role,
+		SQL:       cq.st.sql,
+	}
+
+	if err := c.sg.conf.Hooks.AfterCompile(c, &q); err != nil {
+		return err
+	}
+
+	if q.SQL != cq.st.sql {
+		cq.st.sql = q.SQL
+		cq.parts = nil
+	}
+	return nil
+}
+
+// afterExec runs the AfterExec hook on the result
+func (c *scontext) afterExec(res *qres) error {
+	if c.sg.conf.Hooks.AfterExec == nil {
+		return nil
+	}
+
+	r := HookResult{
+		Operation: opType(c.op),
+		Name:      c.name,
+		Role:      res.role,
+		Data:      res.data,
+	}
+
+	if err := c.sg.conf.Hooks.AfterExec(c, &r); err != nil {
+		return err
+	}
+
+	res.data = r.Data
+	return nil
+}
+
+// computedCols returns the columns required by the computed fields keyed by
+// the table and then the field, the fields are checked against the schema
+func (sg *SuperGraph) computedCols(s *psql.DBSchema) (map[string]map[string][]string, error) {
+	var cols map[string]map[string][]string
+
+	for t, m := range sg.conf.ComputedFields {
+		ti, err := s.GetTableInfo(t)
+		if err != nil {
+			return nil, fmt.Errorf("computed field: %w", err)
+		}
+
+		for f, cf := range m {
+			fn := strings.ToLower(f)
+
+			if cf.Fn == nil {
+				return nil, fmt.Errorf("computed field: %s.%s: no function set", t, f)
+			}
+
+			switch cf.Type {
+			case "", "String", "Int", "Float", "Boolean", "ID":
+			default:
+				return nil, fmt.Errorf("computed field: %s.%s: unknown type: %s", t, f, cf.Type)
+			}
+
+			if ti.ColumnExists(fn) {
+				return nil, fmt.Errorf("computed field: %s.%s: a column of the same name exists", t, f)
+			}
+
+			var req []string
+
+			for _, cn := range cf.Requires {
+				col, err := ti.GetColumn(strings.ToLower(cn))
+				if err != nil {
+					return nil, fmt.Errorf("computed field: %s.%s: %w", t, f, err)
+				}
+				req = append(req, col.Name)
+			}
+
+			if cols == nil {
+				cols = make(map[string]map[string][]string)
+				sg.computed = make(map[string]map[string]*ComputedField)
+			}
+			if cols[ti.Name] == nil {
+				cols[ti.Name] = make(map[string][]string)
+				sg.computed[ti.Name] = make(map[string]*ComputedField)
+			}
+
+			cf := cf
+			cols[ti.Name][fn] = req
+			sg.computed[ti.Name][fn] = &cf
+		}
+	}
+
+	return cols, nil
+}
+
+// computedNames returns the names of the computed fields of a table in order
+func computedNames(m map[string]*ComputedField) []string {
+	names := make([]string, 0, len(m))
+
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// computeData sets the values of the computed fields in the response from the
+// columns they require, the values are found by their field name like formatData
+func (sg *SuperGraph) computeData(c context.Context, qc *qcode.QCode, data []byte) ([]byte, error) {
+	if len(sg.computed) == 0 || qc == nil || len(data) == 0 {
+		return data, nil
+	}
+
+	fm := make(map[string]*ComputedField)
+	conflict := make(map[string]struct{})
+	computed := make(map[string]struct{})
+
+	add := func(k string, f *ComputedField) {
+		if v, ok := fm[k]; ok && v != f {
+			conflict[k] = struct{}{}
+		}
+		if f != nil {
+			computed[k] = struct{}{}
+		}
+		fm[k] = f
+	}
+
+	for i := range qc.Selects {
+		sel := &qc.Selects[i]
+		add(sel.FieldName, nil)
+
+		if sel.SkipRender != qcode.SkipTypeNone {
+			continue
+		}
+
+		var tf map[string]*ComputedField
+
+		if ti, err := sg.pc.Schema().GetTableInfo(sel.Name); err == nil {
+			tf = sg.computed[ti.Name]
+		}
+
+		for _, c := range sel.Cols {
+			add(c.FieldName, tf[c.Name])
+		}
+	}
+
+	var keys [][]byte
+
+	for k := range computed {
+		// the required columns would be returned in place of the value
+		if _, ok := conflict[k]; ok {
+			return data, fmt.Errorf("computed field %s: the name is used by another field in the query, use an alias", k)
+		}
+		keys = append(keys, []byte(k))
+	}
+
+	if len(keys) == 0 {
+		return data, nil
+	}
+
+	from := jsn.Get(data, keys)
+	to := make([]jsn.Field, len(from))
+
+	for i, f := range from {
+		var row map[string]json.RawMessage
+
+		if err := json.Unmarshal(f.Value, &row); err != nil {
+			return data, fmt.Errorf("computed field %s: %w", f.Key, err)
+		}
+
+		v, err := fm[string(f.Key)].Fn(c, row)
+		if err != nil {
+			return data, fmt.Errorf("computed field %s: %w", f.Key, err)
+		}
+
+		if len(v) == 0 {
+			v = json.RawMessage("null")
+		} else if !json.Valid(v) {
+			return data, fmt.Errorf("computed field %s: invalid json returned", f.Key)
+		}
+		to[i] = jsn.Field{Key: f.Key, Value: v}
+	}
+
+	var ob bytes.Buffer
+
+	if err := jsn.Replace(&ob, data, from, to); err != nil {
+		return data, err
+	}
+
+	return ob.Bytes(), nil
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestHooks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		Hooks: Hooks{
+			BeforeParse: func(c context.Context, r *HookRequest) error {
+				r.Query = strings.Replace(r.Query, "items", "products", 1)
+				return nil
+			},
+			AfterCompile: func(c context.Context, q *HookQuery) error {
+				if q.Operation == OpMutation {
+					return errors.New("read only")
+				}
+				q.SQL = "/* hooked */ " + q.SQL
+				return nil
+			},
+			AfterExec: func(c context.Context, r *HookResult) error {
+				r.Data = json.RawMessage(strings.Replace(string(r.Data), "1", "2", 1))
+				return nil
+			},
+		},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`^/\* hooked \*/ SELECT .*"products"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": [{"id": 1}]}`))
+
+	res, err := sg.GraphQL(ct, `query { items(limit: 5) { id } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"products": [{"id": 2}]}`; string(res.Data) != exp {
+		t.Fatalf("expected %s got %s", exp, res.Data)
+	}
+
+	// the mutation is stopped before it's run
+	_, err = sg.GraphQL(ct, `mutation { products(id: $id, delete: true) { id } }`,
+		json.RawMessage(`{"id": 1}`))
+	if err == nil || err.Error() != "read only" {
+		t.Fatalf("expected the hook error got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestComputedFields(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	label := func(c context.Context, row map[string]json.RawMessage) (json.RawMessage, error) {
+		var name string
+		var price float64
+
+		if err := json.Unmarshal(row["name"], &name); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(row["price"], &price); err != nil {
+			return nil, err
+		}
+		return json.Marshal(fmt.Sprintf("%s ($%.2f)", name, price))
+	}
+
+	conf := &Config{
+		ComputedFields: map[string]map[string]ComputedField{
+			"products": {"label": {Requires: []string{"name", "price"}, Fn: label}},
+		},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`json_build_object\('name', "products"."name", 'price', "products"."price"\) AS "label"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).
+			AddRow(`{"products": [{"id": 1, "label": {"name": "Beer", "price": 2.5}}]}`))
+
+	res, err := sg.GraphQL(ct, `query { products(limit: 5) { id label } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"products": [{"id": 1, "label":"Beer ($2.50)"}]}`; string(res.Data) != exp {
+		t.Fatalf("expected %s got %s", exp, res.Data)
+	}
+
+	// the computed field is in the introspection schema
+	schema, err := sg.GraphQLSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(schema, "label:String") {
+		t.Fatalf("expected the computed field in the schema: %s", schema)
+	}
+
+	conf.ComputedFields["products"]["name"] = ComputedField{Fn: label}
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for a computed field with the name of a column")
+	}
+}
@@ -0,0 +1,238 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// idGen generates the primary key of rows inserted without one
+type idGen struct {
+	col string
+	fn  func() (string, error)
+}
+
+func (sg *SuperGraph) initIDGen() error {
+	sg.idgens = make(map[string]idGen)
+	schema := sg.pc.Schema()
+
+	for _, t := range sg.conf.Tables {
+		if t.GenerateID == "" {
+			continue
+		}
+
+		var fn func() (string, error)
+
+		switch t.GenerateID {
+		case "uuid", "uuidv4":
+			fn = newUUIDv4
+		case "uuidv7":
+			fn = newUUIDv7
+		case "ulid":
+			fn = newULID
+		default:
+			return fmt.Errorf("table %s: invalid generate_id '%s' (uuid, uuidv7 or ulid)",
+				t.Name, t.GenerateID)
+		}
+
+		ti, err := schema.GetTableInfo(t.Name)
+		if err != nil {
+			return err
+		}
+
+		if ti.PrimaryCol == nil {
+			return fmt.Errorf("table %s: generate_id needs a primary key", t.Name)
+		}
+
+		sg.idgens[ti.Name] = idGen{col: ti.PrimaryCol.Name, fn: fn}
+	}
+
+	return nil
+}
+
+// genIDs adds a generated primary key to the rows of the inserts and
+// upserts that don't have one
+func (sg *SuperGraph) genIDs(qc *qcode.QCode, vm map[string]json.RawMessage) error {
+	if len(sg.idgens) == 0 {
+		return nil
+	}
+
+	for _, m := range qc.Mutations {
+		if m.Type != qcode.QTInsert && m.Type != qcode.QTUpsert {
+			continue
+		}
+
+		ti, err := sg.pc.Schema().GetTableInfo(qc.Selects[m.SelID].Name)
+		if err != nil {
+			continue
+		}
+
+		g, ok := sg.idgens[ti.Name]
+		if !ok {
+			continue
+		}
+
+		v, ok := vm[m.ActionVar]
+		if !ok || len(v) == 0 {
+			continue
+		}
+
+		if vm[m.ActionVar], err = g.add(v); err != nil {
+			return fmt.Errorf("variable '%s': %w", m.ActionVar, err)
+		}
+	}
+
+	return nil
+}
+
+// genVarIDs is genIDs for the variables passed to the query
+func (sg *SuperGraph) genVarIDs(qc *qcode.QCode, vars json.RawMessage) (json.RawMessage, error) {
+	if len(sg.idgens) == 0 || len(vars) == 0 || len(qc.Mutations) == 0 {
+		return vars, nil
+	}
+
+	var vm map[string]json.RawMessage
+
+	if err := json.Unmarshal(vars, &vm); err != nil {
+		return nil, err
+	}
+
+	if err := sg.genIDs(qc, vm); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(vm)
+}
+
+func (g idGen) add(v json.RawMessage) (json.RawMessage, error) {
+	if v = bytes.TrimSpace(v); len(v) == 0 || v[0] != '[' {
+		row, err := g.addRow(v)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(row)
+	}
+
+	var rows []json.RawMessage
+
+	if err := json.Unmarshal(v, &rows); err != nil {
+		return nil, err
+	}
+
+	list := make([]map[string]json.RawMessage, len(rows))
+
+	for i := range rows {
+		row, err := g.addRow(rows[i])
+		if err != nil {
+			return nil, err
+		}
+		list[i] = row
+	}
+
+	return json.Marshal(list)
+}
+
+func (g idGen) addRow(v json.RawMessage) (map[string]json.RawMessage, error) {
+	var row map[string]json.RawMessage
+
+	if err := json.Unmarshal(v, &row); err != nil {
+		return nil, err
+	}
+
+	if id, ok := row[g.col]; ok && string(id) != "null" {
+		return row, nil
+	}
+
+	id, err := g.fn()
+	if err != nil {
+		return nil, err
+	}
+	row[g.col] = json.RawMessage(`"` + id + `"`)
+
+	return row, nil
+}
+
+func newUUIDv4() (string, error) {
+	var b [16]byte
+
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return formatUUID(b), nil
+}
+
+// newUUIDv7 returns a time ordered uuid, the first 48 bits are
+// the unix time in milliseconds
+func newUUIDv7() (string, error) {
+	var b [16]byte
+
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	var t [8]byte
+	binary.BigEndian.PutUint64(t[:], ms)
+	copy(b[:6], t[2:])
+
+	b[6] = (b[6] & 0x0f) | 0x70
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return formatUUID(b), nil
+}
+
+func formatUUID(b [16]byte) string {
+	var s [36]byte
+
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+
+	return string(s[:])
+}
+
+// newULID returns a lexicographically sortable id, 48 bits of unix time
+// in milliseconds followed by 80 random bits in Crockford's base32
+func newULID() (string, error) {
+	var b [16]byte
+
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	var t [8]byte
+	binary.BigEndian.PutUint64(t[:], ms)
+	copy(b[:6], t[2:])
+
+	// 128 bits are encoded as 26 chars of 5 bits, the
+	// first char only has the top 3 bits
+	var s [26]byte
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	for i := 25; i >= 0; i-- {
+		s[i] = crockford[lo&31]
+		lo = (lo >> 5) | (hi << 59)
+		hi >>= 5
+	}
+
+	return string(s[:]), nil
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestIDGenFormats(t *testing.T) {
+	tests := []struct {
+		fn  func() (string, error)
+		exp string
+	}{
+		{newUUIDv4, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{newUUIDv7, `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{newULID, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+	}
+
+	for _, tt := range tests {
+		id1, err := tt.fn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id2, _ := tt.fn()
+
+		if !regexp.MustCompile(tt.exp).MatchString(id1) {
+			t.Fatalf("invalid id: %s", id1)
+		}
+
+		if id1 == id2 {
+			t.Fatalf("duplicate id: %s", id1)
+		}
+	}
+}
+
+func TestGenerateID(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Tables: []Table{{Name: "products", GenerateID: "ulid"}}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := sg.buildRoleStmt([]byte(`mutation { products(insert: $data) { id } }`),
+		[]byte(`{"data": [{"name": "a"}]}`), "user", psql.Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := sg.genVarIDs(st.qc, []byte(`{"data": [{"name": "a"}, {"id": "1", "name": "b"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v struct {
+		Data []struct{ ID string }
+	}
+	if err := json.Unmarshal(vars, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(v.Data) != 2 || len(v.Data[0].ID) != 26 || v.Data[1].ID != "1" {
+		t.Fatalf("expected a generated id for the first row only: %s", vars)
+	}
+
+	if !regexp.MustCompile(`INSERT INTO "products" \([^)]*"id"`).MatchString(st.sql) {
+		t.Fatalf("expected the id column in the insert: %s", st.sql)
+	}
+
+	conf = &Config{Tables: []Table{{Name: "products", GenerateID: "serial"}}}
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for an invalid generator")
+	}
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/allow"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+// SchemaImpact struct is a query in the allow list that compiles with the
+// current database schema and fails with a new one, Error is the reason
+// (eg. a column it selects was dropped)
+type SchemaImpact struct {
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+	Error string `json:"error"`
+}
+
+func (si SchemaImpact) String() string {
+	return fmt.Sprintf("query '%s' (role %s) fails: %s", si.Name, si.Role, si.Error)
+}
+
+// CheckSchema function reads the database schema again and compiles the
+// queries in the allow list with it without swapping it in. It returns the
+// ones that would now fail, use it to check a migration before the schema
+// is reloaded or the service restarted
+func (sg *SuperGraph) CheckSchema() ([]SchemaImpact, error) {
+	if sg.mock != nil {
+		return nil, errors.New("check schema: not supported with mock data")
+	}
+
+	di, err := sg.getDBInfo()
+	if err != nil {
+		return nil, fmt.Errorf("check schema: %w", err)
+	}
+
+	dbSchema, err := sg.buildSchema(di)
+	if err != nil {
+		return nil, fmt.Errorf("check schema: %w", err)
+	}
+
+	impact, err := sg.schemaImpact(dbSchema)
+	if err != nil {
+		return nil, fmt.Errorf("check schema: %w", err)
+	}
+
+	return impact, nil
+}
+
+// schemaImpact compiles each query in the allow list for each role with
+// the current and the new schema, the ones that fail or get new warnings
+// (lenient mode) only with the new schema are returned
+func (sg *SuperGraph) schemaImpact(dbSchema *psql.DBSchema) ([]SchemaImpact, error) {
+	if sg.allowList == nil {
+		return nil, nil
+	}
+
+	list, err := sg.allowedQueries()
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]string, 0, len(sg.roles))
+	for name := range sg.roles {
+		roles = append(roles, name)
+	}
+	sort.Strings(roles)
+
+	pc := sg.pc.WithSchema(dbSchema)
+
+	var impact []SchemaImpact
+
+	for _, v := range list {
+		if v.Query == "" {
+			continue
+		}
+
+		for _, role := range roles {
+			ow, err := sg.tryCompile(sg.pc, v, role)
+			if err != nil {
+				// it fails with the current schema too
+				continue
+			}
+
+			nw, err := sg.tryCompile(pc, v, role)
+			if err == nil {
+				err = newWarnings(ow, nw)
+			}
+
+			if err != nil {
+				impact = append(impact, SchemaImpact{Name: v.Name, Role: role, Error: err.Error()})
+			}
+		}
+	}
+
+	return impact, nil
+}
+
+// tryCompile compiles the query with the psql compiler and returns the warnings
+func (sg *SuperGraph) tryCompile(pc *psql.Compiler, v allow.Item, role string) ([]string, error) {
+	var vm map[string]json.RawMessage
+
+	if v.Vars != "" {
+		if err := json.Unmarshal([]byte(v.Vars), &vm); err != nil {
+			return nil, err
+		}
+	}
+
+	qc, err := sg.qc.Compile([]byte(v.Query), role)
+	if err != nil {
+		return nil, err
+	}
+
+	if vm, err = applyVarDefs(qc, vm); err != nil {
+		return nil, err
+	}
+
+	var w bytes.Buffer
+
+	md, err := pc.CompileWithMetadata(&w, qc, psql.Variables(vm), psql.Metadata{})
+	if err != nil {
+		return nil, err
+	}
+
+	return md.Warnings(), nil
+}
+
+// newWarnings returns an error with the warnings that are not in old
+func newWarnings(old, new []string) error {
+	om := make(map[string]struct{}, len(old))
+	for _, w := range old {
+		om[w] = struct{}{}
+	}
+
+	var nw []string
+
+	for _, w := range new {
+		if _, ok := om[w]; !ok {
+			nw = append(nw, w)
+		}
+	}
+
+	if len(nw) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(nw, ", "))
+}
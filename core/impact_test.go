@@ -0,0 +1,79 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestSchemaImpact(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dir, err := ioutil.TempDir("", "test_impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{AllowListFile: filepath.Join(dir, "allow.list")}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	al := sg.AllowList()
+
+	if err := al.Add(`query getProducts { products { id price } }`, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := al.Add(`query getUsers { users { id email } }`, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// fails with the current schema too
+	if err := al.Add(`query getMissing { products { id sku } }`, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	di := psql.GetTestDBInfo()
+
+	for i, c := range di.Columns[2] {
+		if c.Name == "price" {
+			di.Columns[2] = append(di.Columns[2][:i], di.Columns[2][i+1:]...)
+			break
+		}
+	}
+
+	dbSchema, err := sg.buildSchema(di)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	impact, err := sg.schemaImpact(dbSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(impact) == 0 {
+		t.Fatal("expected getProducts to fail with the new schema")
+	}
+
+	for _, v := range impact {
+		if v.Name != "getProducts" {
+			t.Fatalf("unexpected query: %s", v)
+		}
+		if v.Error == "" {
+			t.Fatalf("expected the reason: %s", v)
+		}
+	}
+}
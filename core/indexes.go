@@ -0,0 +1,446 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/allow"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// Reasons an index is suggested for
+const (
+	IndexForFilter  = "filter"
+	IndexForOrderBy = "order_by"
+	IndexForJoin    = "join"
+)
+
+// IndexAdvice struct is an index the queries in the allow list can use that's
+// missing in the database. Rows is the estimated number of rows of the table
+// and Benefit the estimated cost saved on the plans of the queries, it's only
+// set when the hypopg extension is installed to create hypothetical indexes
+type IndexAdvice struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Reason  string   `json:"reason"`
+	Queries []string `json:"queries"`
+	Rows    int64    `json:"rows"`
+	Benefit float64  `json:"benefit,omitempty"`
+}
+
+// SQL returns the statement to create the index
+func (ia IndexAdvice) SQL() string {
+	var sb strings.Builder
+
+	sb.WriteString(`CREATE INDEX CONCURRENTLY ON "`)
+	sb.WriteString(ia.Table)
+	sb.WriteString(`" (`)
+
+	for i, c := range ia.Columns {
+		if i != 0 {
+			sb.WriteString(`, `)
+		}
+		sb.WriteString(`"`)
+		sb.WriteString(c)
+		sb.WriteString(`"`)
+	}
+	sb.WriteString(`);`)
+
+	return sb.String()
+}
+
+func (ia IndexAdvice) String() string {
+	s := fmt.Sprintf("%s (%s) for %s in %s, ~%d rows",
+		ia.Table, strings.Join(ia.Columns, ", "), ia.Reason, strings.Join(ia.Queries, ", "), ia.Rows)
+
+	if ia.Benefit != 0 {
+		s += fmt.Sprintf(", saves ~%.0f cost", ia.Benefit)
+	}
+	return s
+}
+
+// indexQuery is a query in the allow list an index is suggested for
+type indexQuery struct {
+	item allow.Item
+}
+
+// IndexAdvice function compiles the queries in the allow list for the role
+// and returns the indexes missing for the columns they filter, order and join
+// on, with the ones saving the most cost first. The context is used for the
+// user id and other values the queries need to be explained
+func (sg *SuperGraph) IndexAdvice(c context.Context, role string) ([]IndexAdvice, error) {
+	if sg.mock != nil || sg.db == nil {
+		return nil, errors.New("index advice: a database is required")
+	}
+
+	if sg.conf.DBType == "mysql" {
+		return nil, errors.New("index advice: only supported with postgres")
+	}
+
+	list, err := sg.allowedQueries()
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := sg.dbIndexes(c)
+	if err != nil {
+		return nil, fmt.Errorf("index advice: %w", err)
+	}
+
+	m := make(map[string]*IndexAdvice)
+	queries := make(map[string][]indexQuery)
+
+	for _, v := range list {
+		if v.Query == "" || qcode.GetQType(v.Query) != qcode.QTQuery {
+			continue
+		}
+
+		qc, err := sg.qc.Compile([]byte(v.Query), role)
+		if err != nil {
+			sg.log.Printf("WRN index advice: %s: %s", v.Name, err)
+			continue
+		}
+
+		for _, ia := range sg.indexCandidates(qc) {
+			if indexes.has(ia.Table, ia.Columns, ia.Reason == IndexForOrderBy) {
+				continue
+			}
+
+			k := ia.Table + "(" + strings.Join(ia.Columns, ",") + ")"
+
+			if e, ok := m[k]; ok {
+				if e.Queries[len(e.Queries)-1] != v.Name {
+					e.Queries = append(e.Queries, v.Name)
+					queries[k] = append(queries[k], indexQuery{item: v})
+				}
+				continue
+			}
+
+			e := ia
+			e.Queries = []string{v.Name}
+			m[k] = &e
+			queries[k] = []indexQuery{{item: v}}
+		}
+	}
+
+	rows, err := sg.tableRows(c)
+	if err != nil {
+		return nil, fmt.Errorf("index advice: %w", err)
+	}
+
+	hypo, err := sg.hasHypoPG(c)
+	if err != nil {
+		return nil, fmt.Errorf("index advice: %w", err)
+	}
+
+	advice := make([]IndexAdvice, 0, len(m))
+
+	for k, ia := range m {
+		ia.Rows = rows[ia.Table]
+
+		if hypo {
+			ia.Benefit = sg.indexBenefit(c, ia, queries[k], role)
+		}
+		advice = append(advice, *ia)
+	}
+
+	sort.Slice(advice, func(i, j int) bool {
+		a, b := advice[i], advice[j]
+
+		if a.Benefit != b.Benefit {
+			return a.Benefit > b.Benefit
+		}
+		if a.Rows != b.Rows {
+			return a.Rows > b.Rows
+		}
+		return a.SQL() < b.SQL()
+	})
+
+	return advice, nil
+}
+
+// indexCandidates returns the indexes the selections of the query can use
+func (sg *SuperGraph) indexCandidates(qc *qcode.QCode) []IndexAdvice {
+	var list []IndexAdvice
+	schema := sg.pc.Schema()
+
+	for i := range qc.Selects {
+		sel := &qc.Selects[i]
+
+		if sel.SkipRender != qcode.SkipTypeNone || sel.Type != qcode.STNone {
+			continue
+		}
+
+		ti, err := schema.GetTableInfo(sel.Name)
+		if err != nil {
+			continue
+		}
+
+		for _, cn := range filterCols(sel.Where, ti) {
+			list = append(list, IndexAdvice{Table: ti.Name, Columns: []string{cn}, Reason: IndexForFilter})
+		}
+
+		if len(sel.OrderBy) != 0 {
+			cols := make([]string, 0, len(sel.OrderBy))
+
+			for _, ob := range sel.OrderBy {
+				if col, err := ti.GetColumn(ob.Col); err == nil {
+					cols = append(cols, col.Name)
+				}
+			}
+
+			if len(cols) == len(sel.OrderBy) {
+				list = append(list, IndexAdvice{Table: ti.Name, Columns: cols, Reason: IndexForOrderBy})
+			}
+		}
+
+		if sel.ParentID == -1 {
+			continue
+		}
+
+		rel, err := schema.GetRel(sel.Name, qc.Selects[sel.ParentID].Name)
+		if err != nil || rel.Left.Array || rel.Right.Array {
+			continue
+		}
+
+		switch rel.Type {
+		case psql.RelOneToOne, psql.RelOneToMany:
+			list = append(list, IndexAdvice{Table: rel.Left.Table, Columns: []string{rel.Left.Col}, Reason: IndexForJoin})
+
+		case psql.RelOneToManyThrough:
+			list = append(list, IndexAdvice{Table: rel.Through.Table, Columns: []string{rel.Through.ColR}, Reason: IndexForJoin})
+		}
+	}
+
+	return list
+}
+
+// filterCols returns the columns of the table compared to a value in the
+// where clause, columns of json keys and other tables are left out
+func filterCols(ex *qcode.Exp, ti *psql.DBTableInfo) []string {
+	if ex == nil {
+		return nil
+	}
+
+	switch ex.Op {
+	case qcode.OpAnd, qcode.OpOr, qcode.OpNot:
+		var cols []string
+		for _, v := range ex.Children {
+			cols = append(cols, filterCols(v, ti)...)
+		}
+		return cols
+
+	case qcode.OpNop, qcode.OpFalse, qcode.OpTsQuery:
+		return nil
+	}
+
+	if ex.Col == "" || len(ex.NestedCols) != 0 || (ex.Table != "" && ex.Table != ti.Name) {
+		return nil
+	}
+
+	col, err := ti.GetColumn(ex.Col)
+	if err != nil {
+		return nil
+	}
+	return []string{col.Name}
+}
+
+// dbIndexList is the columns of the indexes of each table in their order
+type dbIndexList map[string][][]string
+
+// has returns true if an index starts with the columns, for filters
+// their order does not matter
+func (il dbIndexList) has(table string, cols []string, ordered bool) bool {
+	for _, idx := range il[table] {
+		if len(idx) < len(cols) {
+			continue
+		}
+
+		found := true
+
+		for i, c := range cols {
+			if ordered && idx[i] != c {
+				found = false
+				break
+			}
+			if !ordered && !hasString(idx[:len(cols)], c) {
+				found = false
+				break
+			}
+		}
+
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+const indexesQuery = `SELECT t.relname, array_to_string(array_agg(a.attname ORDER BY k.n), ',')
+FROM pg_index i
+JOIN pg_class t ON t.oid = i.indrelid
+JOIN pg_namespace ns ON ns.oid = t.relnamespace
+CROSS JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, n)
+JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+WHERE ns.nspname = $1
+GROUP BY t.relname, i.indexrelid`
+
+// dbIndexes returns the indexes of the tables in the database schema
+func (sg *SuperGraph) dbIndexes(c context.Context) (dbIndexList, error) {
+	rows, err := sg.db.QueryContext(c, indexesQuery, sg.dbSchemaName())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	il := make(dbIndexList)
+
+	for rows.Next() {
+		var table, cols string
+
+		if err := rows.Scan(&table, &cols); err != nil {
+			return nil, err
+		}
+		il[table] = append(il[table], strings.Split(cols, ","))
+	}
+
+	return il, rows.Err()
+}
+
+const tableRowsQuery = `SELECT c.relname, c.reltuples :: bigint
+FROM pg_class c
+JOIN pg_namespace ns ON ns.oid = c.relnamespace
+WHERE ns.nspname = $1 AND c.relkind = 'r'`
+
+// tableRows returns the estimated number of rows of each table
+func (sg *SuperGraph) tableRows(c context.Context) (map[string]int64, error) {
+	rows, err := sg.db.QueryContext(c, tableRowsQuery, sg.dbSchemaName())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := make(map[string]int64)
+
+	for rows.Next() {
+		var table string
+		var n int64
+
+		if err := rows.Scan(&table, &n); err != nil {
+			return nil, err
+		}
+		m[table] = n
+	}
+
+	return m, rows.Err()
+}
+
+func (sg *SuperGraph) hasHypoPG(c context.Context) (bool, error) {
+	var n int
+
+	err := sg.db.QueryRowContext(c,
+		`SELECT count(*) FROM pg_extension WHERE extname = 'hypopg'`).Scan(&n)
+
+	return n != 0, err
+}
+
+// indexBenefit returns the cost saved on the plans of the queries with a
+// hypothetical index, queries that can't be explained are left out
+func (sg *SuperGraph) indexBenefit(c context.Context, ia *IndexAdvice, list []indexQuery, role string) float64 {
+	conn, err := sg.db.Conn(c)
+	if err != nil {
+		return 0
+	}
+	defer conn.Close()
+
+	type plan struct {
+		sql  string
+		args []interface{}
+		cost float64
+	}
+
+	var plans []plan
+
+	for _, q := range list {
+		cq := &cquery{q: rquery{
+			op:    qcode.QTQuery,
+			name:  q.item.Name,
+			query: []byte(q.item.Query),
+			vars:  []byte(q.item.Vars),
+		}}
+
+		if err := sg.compileQueryFn(cq, role); err != nil {
+			continue
+		}
+
+		args, err := sg.argList(c, cq.st.md, cq.q.vars)
+		if err != nil {
+			continue
+		}
+
+		cost, err := explainCost(c, conn, cq.st.sql, args.values)
+		if err != nil {
+			continue
+		}
+		plans = append(plans, plan{sql: cq.st.sql, args: args.values, cost: cost})
+	}
+
+	if len(plans) == 0 {
+		return 0
+	}
+
+	if _, err := conn.ExecContext(c, `SELECT * FROM hypopg_create_index($1)`,
+		strings.TrimSuffix(strings.Replace(ia.SQL(), " CONCURRENTLY", "", 1), ";")); err != nil {
+		return 0
+	}
+	defer conn.ExecContext(c, `SELECT hypopg_reset()`) //nolint: errcheck
+
+	var saved float64
+
+	for _, p := range plans {
+		if cost, err := explainCost(c, conn, p.sql, p.args); err == nil && cost < p.cost {
+			saved += p.cost - cost
+		}
+	}
+
+	return saved
+}
+
+// explainCost returns the total cost of the plan of the query
+func explainCost(c context.Context, conn *sql.Conn, query string, args []interface{}) (float64, error) {
+	var b []byte
+
+	if err := conn.QueryRowContext(c, "EXPLAIN (FORMAT JSON) "+query, args...).Scan(&b); err != nil {
+		return 0, err
+	}
+
+	var plans []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+		}
+	}
+
+	if err := json.Unmarshal(b, &plans); err != nil {
+		return 0, err
+	}
+
+	if len(plans) == 0 {
+		return 0, errors.New("no plan found")
+	}
+	return plans[0].Plan.TotalCost, nil
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestIndexAdvice(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dir, err := ioutil.TempDir("", "test_indexes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{AllowListFile: filepath.Join(dir, "allow.list")}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	al := sg.AllowList()
+
+	err = al.Add(`query getProducts {
+		products(where: { price: { gt: 10 } }, order_by: { price: desc }) { id }
+	}`, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = al.Add(`query getUsers { users(where: { email: { eq: "a" } }) { id products { id } } }`, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT t.relname`).
+		WillReturnRows(sqlmock.NewRows([]string{"relname", "cols"}).
+			AddRow("users", "id").
+			AddRow("users", "email,full_name").
+			AddRow("products", "id"))
+
+	mock.ExpectQuery(`SELECT c.relname`).
+		WillReturnRows(sqlmock.NewRows([]string{"relname", "reltuples"}).
+			AddRow("users", 100).
+			AddRow("products", 5000))
+
+	mock.ExpectQuery(`FROM pg_extension`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	advice, err := sg.IndexAdvice(context.Background(), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		`CREATE INDEX CONCURRENTLY ON "products" ("price");`,
+		`CREATE INDEX CONCURRENTLY ON "products" ("user_id");`,
+	}
+
+	if len(advice) != len(exp) {
+		t.Fatalf("expected %d indexes got %d: %v", len(exp), len(advice), advice)
+	}
+
+	for i, ia := range advice {
+		if ia.SQL() != exp[i] {
+			t.Errorf("expected %s got %s", exp[i], ia.SQL())
+		}
+		if ia.Rows != 5000 {
+			t.Errorf("expected 5000 rows got %d", ia.Rows)
+		}
+	}
+
+	if q := advice[1].Queries; len(q) != 1 || q[0] != "getUsers" {
+		t.Errorf("expected the join index for getUsers got %v", q)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexListHas(t *testing.T) {
+	il := dbIndexList{"users": {{"email", "full_name"}}}
+
+	tests := []struct {
+		cols    []string
+		ordered bool
+		exp     bool
+	}{
+		{[]string{"email"}, false, true},
+		{[]string{"full_name", "email"}, false, true},
+		{[]string{"full_name", "email"}, true, false},
+		{[]string{"full_name"}, false, false},
+		{[]string{"email", "full_name", "id"}, false, false},
+	}
+
+	for _, v := range tests {
+		if il.has("users", v.cols, v.ordered) != v.exp {
+			t.Errorf("%v (ordered %t): expected %t", v.cols, v.ordered, v.exp)
+		}
+	}
+}
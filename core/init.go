@@ -50,6 +50,10 @@ func (sg *SuperGraph) initConfig() error {
 			role.tm[table.Name] = &role.Tables[n]
 		}
 
+		if err := role.initIntents(); err != nil {
+			return err
+		}
+
 		sg.roles[role.Name] = role
 	}
 
@@ -127,6 +131,55 @@ func addTables(c *Config, di *psql.DBInfo) error {
 	return nil
 }
 
+func addSearch(c *Config, di *psql.DBInfo) error {
+	for _, t := range c.Tables {
+		if t.Search == "" {
+			continue
+		}
+		if err := di.SetSearch(t.Name, t.Search); err != nil {
+			return fmt.Errorf("search: %w", err)
+		}
+	}
+	return nil
+}
+
+func addOrderExps(c *Config, di *psql.DBInfo) error {
+	for _, t := range c.Tables {
+		for name, exp := range t.OrderBy {
+			if _, err := di.GetColumn(t.Name, name); err == nil {
+				return fmt.Errorf("order_by: %s.%s: a column of the same name exists", t.Name, name)
+			}
+			if err := di.SetOrderExp(t.Name, strings.ToLower(name), exp); err != nil {
+				return fmt.Errorf("order_by: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func addTranslations(c *Config, di *psql.DBInfo) error {
+	for _, t := range c.Tables {
+		for _, c := range t.Columns {
+			if !c.Translated {
+				continue
+			}
+
+			col, err := di.GetColumn(t.Name, c.Name)
+			if err != nil {
+				return fmt.Errorf("translated column: %w", err)
+			}
+
+			if col.Type != "json" && col.Type != "jsonb" && col.Type != "hstore" {
+				return fmt.Errorf(
+					"translated column: column '%s' in table '%s' is of type '%s'. Only JSON, JSONB or HSTORE is valid",
+					c.Name, t.Name, col.Type)
+			}
+			col.Translated = true
+		}
+	}
+	return nil
+}
+
 func addJsonTable(di *psql.DBInfo, cols []Column, t Table) error {
 	// This is for jsonb columns that want to be tables.
 	bc, err := di.GetColumn(t.Table, t.Name)
@@ -180,12 +233,43 @@ func addVirtualTable(di *psql.DBInfo, cols []Column, t Table) error {
 		return fmt.Errorf("polymorphic table: foreign key must be <type column>.<foreign key column>")
 	}
 
-	di.VTables = append(di.VTables, psql.VirtualTable{
+	vt := psql.VirtualTable{
 		Name:       t.Name,
 		IDColumn:   c.Name,
 		TypeColumn: s[0],
 		FKeyColumn: s[1],
-	})
+	}
+
+	if len(t.Types) != 0 {
+		vt.Types = make(map[string]string, len(t.Types))
+	}
+
+	for _, pt := range t.Types {
+		if pt.Name == "" || pt.Table == "" {
+			return fmt.Errorf("polymorphic table: %s: types need a name and a table", t.Name)
+		}
+
+		found := false
+		for _, dt := range di.Tables {
+			if dt.Name == pt.Table {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("polymorphic table: %s: table '%s' not found", t.Name, pt.Table)
+		}
+		vt.Types[pt.Table] = pt.Name
+	}
+
+	for i := range di.VTables {
+		if di.VTables[i].Name == vt.Name {
+			di.VTables[i] = vt
+			return nil
+		}
+	}
+	di.VTables = append(di.VTables, vt)
 
 	return nil
 }
@@ -261,6 +345,24 @@ func addRoles(c *Config, qc *qcode.Compiler) error {
 	return nil
 }
 
+func addRewrites(c *Config, qc *qcode.Compiler) error {
+	for _, rw := range c.Rewrites {
+		err := qc.AddRewrite(qcode.RewriteConfig{
+			Name:   rw.Name,
+			Table:  rw.Table,
+			Field:  rw.Field,
+			Filter: rw.Filter,
+			Limit:  rw.Limit,
+			View:   rw.View,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func addRole(qc *qcode.Compiler, r Role, t RoleTable, defaultBlock bool) error {
 	ro := false // read-only
 
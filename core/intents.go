@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// Intents are the kinds of operations a role can be granted in Role.Intents,
+// they're checked for every table on top of the rules of the tables
+const (
+	IntentRead   = "read"
+	IntentCreate = "create"
+	IntentUpdate = "update"
+	IntentDelete = "delete"
+	IntentBulk   = "bulk"
+	IntentExport = "export"
+)
+
+// initIntents checks the intents of the role and sets them up for lookups
+func (ro *Role) initIntents() error {
+	if len(ro.Intents) == 0 {
+		return nil
+	}
+	ro.im = make(map[string]struct{}, len(ro.Intents))
+
+	for _, v := range ro.Intents {
+		switch v {
+		case IntentRead, IntentCreate, IntentUpdate, IntentDelete, IntentBulk, IntentExport:
+			ro.im[v] = struct{}{}
+		default:
+			return fmt.Errorf("role %s: unknown intent: %s", ro.Name, v)
+		}
+	}
+	return nil
+}
+
+// checkIntents returns an error if the query needs an intent the role is not
+// granted, a stream is an export. Inserts with a list of rows and updates and
+// deletes without an id are bulk mutations
+func (sg *SuperGraph) checkIntents(qc *qcode.QCode, vars []byte, role string, stream bool) error {
+	ro, ok := sg.roles[role]
+	if !ok || ro.im == nil {
+		return nil
+	}
+
+	// queries and subscriptions
+	if len(qc.Mutations) == 0 {
+		in := IntentRead
+		if stream {
+			in = IntentExport
+		}
+		if _, ok := ro.im[in]; !ok && len(qc.Roots) != 0 {
+			return intentErr(role, in, qc.Selects[qc.Roots[0]].FieldName)
+		}
+		return nil
+	}
+
+	var vm map[string]json.RawMessage
+
+	if len(vars) != 0 {
+		if err := json.Unmarshal(vars, &vm); err != nil {
+			return withCat(ErrCatValidate, err)
+		}
+	}
+
+	for _, m := range qc.Mutations {
+		sel := &qc.Selects[m.SelID]
+		var need []string
+
+		switch m.Type {
+		case qcode.QTInsert:
+			need = append(need, IntentCreate)
+		case qcode.QTUpsert:
+			need = append(need, IntentCreate, IntentUpdate)
+		case qcode.QTUpdate:
+			need = append(need, IntentUpdate)
+		case qcode.QTDelete:
+			need = append(need, IntentDelete)
+		}
+
+		switch m.Type {
+		case qcode.QTInsert, qcode.QTUpsert:
+			if v := bytes.TrimSpace(vm[m.ActionVar]); len(v) != 0 && v[0] == '[' {
+				need = append(need, IntentBulk)
+			}
+		case qcode.QTUpdate, qcode.QTDelete:
+			if !m.ByID {
+				need = append(need, IntentBulk)
+			}
+		}
+
+		for _, in := range need {
+			if _, ok := ro.im[in]; !ok {
+				return intentErr(role, in, sel.FieldName)
+			}
+		}
+	}
+	return nil
+}
+
+func intentErr(role, intent, name string) error {
+	return &codeError{ErrCodeRoleForbidden,
+		fmt.Sprintf("%s, %s intent not granted: %s", role, intent, name)}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestIntents(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Roles: []Role{
+		{Name: "user", Intents: []string{"read", "create", "update"}},
+		{Name: "admin", Intents: []string{"create", "update", "delete", "bulk", "export"}},
+	}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query  string
+		vars   string
+		role   string
+		stream bool
+		ok     bool
+	}{
+		{`query { products { id } }`, ``, "user", false, true},
+		{`query { products { id } }`, ``, "user", true, false},
+		{`query { products { id } }`, ``, "admin", false, false},
+		{`query { products { id } }`, ``, "admin", true, true},
+		{`query { products { id } }`, ``, "anon", false, true},
+		{`mutation { products(insert: $data) { id } }`, `{"data": {"name": "shoes"}}`, "user", false, true},
+		{`mutation { products(insert: $data) { id } }`, `{"data": [{"name": "shoes"}]}`, "user", false, false},
+		{`mutation { products(insert: $data) { id } }`, `{"data": [{"name": "shoes"}]}`, "admin", false, true},
+		{`mutation { products(upsert: $data) { id } }`, `{"data": {"name": "shoes"}}`, "user", false, true},
+		{`mutation { products(id: $id, update: $data) { id } }`, `{"id": 5, "data": {"name": "shoes"}}`, "user", false, true},
+		{`mutation { products(where: { price: { gt: 5 } }, update: $data) { id } }`, `{"data": {"name": "shoes"}}`, "user", false, false},
+		{`mutation { products(id: $id, delete: true) { id } }`, `{"id": 5}`, "user", false, false},
+		{`mutation { products(id: $id, delete: true) { id } }`, `{"id": 5}`, "admin", false, true},
+	}
+
+	for _, v := range tests {
+		st, err := sg.buildRoleStmt([]byte(v.query), []byte(v.vars), v.role, psql.Metadata{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sg.checkIntents(st.qc, []byte(v.vars), v.role, v.stream)
+		if v.ok && err != nil {
+			t.Errorf("%s: %s: unexpected error %s", v.role, v.query, err)
+		}
+		if !v.ok && ErrorCode(err) != ErrCodeRoleForbidden {
+			t.Errorf("%s: %s: expected a %s error got %v", v.role, v.query, ErrCodeRoleForbidden, err)
+		}
+	}
+
+	conf = &Config{Roles: []Role{{Name: "user", Intents: []string{"write"}}}}
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for the unknown intent")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"sync"
 	"text/scanner"
 
 	"github.com/chirino/graphql/schema"
@@ -28,23 +29,41 @@ type Item struct {
 	Query   string
 	Vars    string
 	Comment string
+
+	// Tags are set with @key:value in the comment
+	// (eg. /* @owner:accounts @team:identity */)
+	Tags map[string]string
 }
 
 type List struct {
 	filepath string
+	store    Store
 	saveChan chan Item
+
+	// mu is held while the file is rewritten
+	mu sync.Mutex
 }
 
 type Config struct {
 	CreateIfNotExists bool
 	Persist           bool
 	Log               *log.Logger
+
+	// Store keeps the list in place of the file
+	Store Store
+}
+
+// Store keeps the list somewhere other than a file (eg. redis),
+// Read returns nothing when the list is not saved yet
+type Store interface {
+	Read() ([]byte, error)
+	Write(b []byte) error
 }
 
 func New(filename string, conf Config) (*List, error) {
-	al := List{}
+	al := List{store: conf.Store}
 
-	if filename != "" {
+	if al.store == nil && filename != "" {
 		fp := filename
 
 		if _, err := os.Stat(fp); err == nil {
@@ -54,7 +73,7 @@ func New(filename string, conf Config) (*List, error) {
 		}
 	}
 
-	if al.filepath == "" {
+	if al.store == nil && al.filepath == "" {
 		fp := "./allow.list"
 
 		if _, err := os.Stat(fp); err == nil {
@@ -64,7 +83,7 @@ func New(filename string, conf Config) (*List, error) {
 		}
 	}
 
-	if al.filepath == "" {
+	if al.store == nil && al.filepath == "" {
 		fp := "./config/allow.list"
 
 		if _, err := os.Stat(fp); err == nil {
@@ -74,7 +93,7 @@ func New(filename string, conf Config) (*List, error) {
 		}
 	}
 
-	if al.filepath == "" {
+	if al.store == nil && al.filepath == "" {
 		if !conf.CreateIfNotExists {
 			return nil, errors.New("allow.list not found")
 		}
@@ -137,7 +156,48 @@ func (al *List) Set(vars []byte, query, comment string) error {
 	return nil
 }
 
+// Add saves the query to the list right away, unlike Set it works
+// when the list is read-only (eg. to manage the list in CI)
+func (al *List) Add(vars []byte, query, comment string) error {
+	if QueryName(query) == "" {
+		return errors.New("query must be named")
+	}
+
+	return al.save(Item{
+		Comment: comment,
+		Query:   query,
+		Vars:    string(vars),
+	})
+}
+
+// Remove deletes the named query from the list
+func (al *List) Remove(name string) error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	list, err := al.Load()
+	if err != nil {
+		return err
+	}
+
+	for i, v := range list {
+		if strings.EqualFold(v.Name, name) {
+			return al.write(append(list[:i], list[i+1:]...))
+		}
+	}
+
+	return fmt.Errorf("query not found: %s", name)
+}
+
 func (al *List) Load() ([]Item, error) {
+	if al.store != nil {
+		b, err := al.store.Read()
+		if err != nil {
+			return nil, err
+		}
+		return parse(string(b), "allow.list")
+	}
+
 	b, err := ioutil.ReadFile(al.filepath)
 	if err != nil {
 		return nil, err
@@ -214,6 +274,7 @@ func parse(b, filename string) ([]Item, error) {
 	for i := range items {
 		items[i].Name = QueryName(items[i].Query)
 		items[i].key = strings.ToLower(items[i].Name)
+		items[i].Tags = ParseTags(items[i].Comment)
 	}
 
 	return items, nil
@@ -245,6 +306,9 @@ func (al *List) save(item Item) error {
 		return nil
 	}
 
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
 	list, err := al.Load()
 	if err != nil {
 		return err
@@ -268,12 +332,13 @@ func (al *List) save(item Item) error {
 		list = append(list, item)
 	}
 
-	f, err := os.Create(al.filepath)
-	if err != nil {
-		return err
-	}
+	return al.write(list)
+}
 
-	defer f.Close()
+func (al *List) write(list []Item) error {
+	var buf bytes.Buffer
+	var f bytes.Buffer
+	var err error
 
 	sort.Slice(list, func(i, j int) bool {
 		return strings.Compare(list[i].key, list[j].key) == -1
@@ -321,7 +386,34 @@ func (al *List) save(item Item) error {
 		}
 	}
 
-	return nil
+	if al.store != nil {
+		return al.store.Write(f.Bytes())
+	}
+
+	return ioutil.WriteFile(al.filepath, f.Bytes(), 0644)
+}
+
+// ParseTags returns the @key:value tags in the comment
+func ParseTags(comment string) map[string]string {
+	var tags map[string]string
+
+	for _, f := range strings.Fields(comment) {
+		if len(f) < 2 || f[0] != '@' {
+			continue
+		}
+
+		kv := strings.SplitN(f[1:], ":", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			continue
+		}
+
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[kv[0]] = kv[1]
+	}
+
+	return tags
 }
 
 func QueryName(b string) string {
@@ -1,6 +1,9 @@
 package allow
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -239,3 +242,108 @@ func TestParse2(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestAddRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	al, err := New(filepath.Join(dir, "allow.list"), Config{CreateIfNotExists: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := al.Add(nil, `query { products { id } }`, ""); err == nil {
+		t.Fatal("expected an error for an unnamed query")
+	}
+
+	if err := al.Add([]byte(`{"id": 5}`), `query getProduct { product(id: $id) { id } }`, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := al.Add(nil, `query getUsers { users { id } }`, "all users"); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := al.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 || list[0].Name != "getProduct" || list[1].Comment != "all users" {
+		t.Fatalf("unexpected allow list: %+v", list)
+	}
+
+	if list[0].Vars == "" || list[0].Vars == `{"id": 5}` {
+		t.Fatalf("expected the variable values to be cleared: %s", list[0].Vars)
+	}
+
+	if err := al.Remove("getproduct"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := al.Remove("getProduct"); err == nil {
+		t.Fatal("expected an error for a missing query")
+	}
+
+	if list, err = al.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].Name != "getUsers" {
+		t.Fatalf("unexpected allow list: %+v", list)
+	}
+}
+
+type memStore struct {
+	b []byte
+}
+
+func (s *memStore) Read() ([]byte, error) {
+	return s.b, nil
+}
+
+func (s *memStore) Write(b []byte) error {
+	s.b = b
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	st := &memStore{}
+
+	al, err := New("", Config{Store: st})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if list, err := al.Load(); err != nil || len(list) != 0 {
+		t.Fatalf("expected an empty allow list got: %+v, %v", list, err)
+	}
+
+	if err := al.Add(nil, `query getUsers { users { id } }`, "all users"); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := al.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].Name != "getUsers" || len(st.b) == 0 {
+		t.Fatalf("expected the query in the store got: %+v", list)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags := ParseTags("Fetch the user @owner:accounts @team:identity @bad @:x email@example.com")
+
+	if len(tags) != 2 || tags["owner"] != "accounts" || tags["team"] != "identity" {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+
+	if tags := ParseTags("no tags here"); tags != nil {
+		t.Fatalf("expected no tags got: %v", tags)
+	}
+}
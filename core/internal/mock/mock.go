@@ -0,0 +1,128 @@
+// Package mock runs compiled queries against tables and rows held in memory.
+// It's used to demo Super Graph and to test the GraphQL layer without a
+// Postgres database.
+package mock
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+// Table struct defines a table and it's rows
+type Table struct {
+	Name    string
+	Columns []Column
+	Rows    []map[string]interface{}
+}
+
+// Column struct defines a table column. ForeignKey is in the
+// format <table>.<column>
+type Column struct {
+	Name       string
+	Type       string
+	PrimaryKey bool   `mapstructure:"primary_key"`
+	ForeignKey string `mapstructure:"related_to"`
+}
+
+// DB struct holds the tables and rows in memory
+type DB struct {
+	schema *psql.DBSchema
+	vars   map[string]string
+	tables map[string][]map[string]interface{}
+}
+
+// NewDBInfo function creates the database info for the tables
+func NewDBInfo(tables []Table) (*psql.DBInfo, error) {
+	dt := make([]psql.DBTable, len(tables))
+	dc := make([][]psql.DBColumn, len(tables))
+
+	// column ids indexed by table and column name used to
+	// resolve the foreign keys
+	cm := make(map[string]int16)
+
+	for i, t := range tables {
+		dt[i] = psql.DBTable{ID: i, Name: t.Name, Type: "table"}
+		cols := make([]psql.DBColumn, len(t.Columns))
+
+		for n, c := range t.Columns {
+			cols[n] = psql.DBColumn{
+				ID:         int16(n + 1),
+				Name:       c.Name,
+				Type:       c.Type,
+				PrimaryKey: c.PrimaryKey,
+				UniqueKey:  c.PrimaryKey,
+			}
+			if cols[n].Type == "" {
+				cols[n].Type = "text"
+			}
+			cm[strings.ToLower(t.Name+"."+c.Name)] = cols[n].ID
+		}
+		dc[i] = cols
+	}
+
+	for i, t := range tables {
+		for n, c := range t.Columns {
+			if c.ForeignKey == "" {
+				continue
+			}
+
+			v := strings.SplitN(c.ForeignKey, ".", 2)
+			id, ok := cm[strings.ToLower(c.ForeignKey)]
+
+			if len(v) != 2 || !ok {
+				return nil, fmt.Errorf("mock: invalid foreign key '%s' for column '%s.%s'",
+					c.ForeignKey, t.Name, c.Name)
+			}
+
+			dc[i][n].FKeyTable = v[0]
+			dc[i][n].FKeyColID = []int16{id}
+		}
+	}
+
+	return psql.NewDBInfo(110000, dt, dc, nil, nil), nil
+}
+
+// New function creates an in-memory database for the tables. The schema must
+// be created from the database info returned by NewDBInfo.
+func New(tables []Table, schema *psql.DBSchema, vars map[string]string) *DB {
+	db := &DB{
+		schema: schema,
+		vars:   vars,
+		tables: make(map[string][]map[string]interface{}, len(tables)),
+	}
+
+	for _, t := range tables {
+		rows := make([]map[string]interface{}, len(t.Rows))
+
+		for i, r := range t.Rows {
+			rows[i] = make(map[string]interface{}, len(r))
+			for k, v := range r {
+				rows[i][strings.ToLower(k)] = normalize(v)
+			}
+		}
+		db.tables[t.Name] = rows
+	}
+
+	return db
+}
+
+// normalize converts the nested maps returned by the yaml parser
+// into values that can be encoded as json
+func normalize(v interface{}) interface{} {
+	switch v1 := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v1))
+		for k, v2 := range v1 {
+			m[fmt.Sprint(k)] = normalize(v2)
+		}
+		return m
+
+	case []interface{}:
+		for i := range v1 {
+			v1[i] = normalize(v1[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,134 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+var tables = []Table{
+	{
+		Name: "users",
+		Columns: []Column{
+			{Name: "id", Type: "bigint", PrimaryKey: true},
+			{Name: "email", Type: "text"},
+		},
+		Rows: []map[string]interface{}{
+			{"id": 1, "email": "jane@example.com"},
+			{"id": 2, "email": "john@example.com"},
+		},
+	},
+	{
+		Name: "products",
+		Columns: []Column{
+			{Name: "id", Type: "bigint", PrimaryKey: true},
+			{Name: "name", Type: "text"},
+			{Name: "price", Type: "numeric"},
+			{Name: "user_id", Type: "bigint", ForeignKey: "users.id"},
+		},
+		Rows: []map[string]interface{}{
+			{"id": 1, "name": "Apple", "price": 1.5, "user_id": 1},
+			{"id": 2, "name": "Banana", "price": 0.5, "user_id": 2},
+			{"id": 3, "name": "Cherry", "price": 3, "user_id": 1},
+			{"id": 4, "name": "Durian", "price": nil, "user_id": 2},
+		},
+	},
+}
+
+func runQuery(t *testing.T, query string, vars string) string {
+	di, err := NewDBInfo(tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := psql.NewDBSchema(di, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qcompile, err := qcode.NewCompiler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qc, err := qcompile.Compile([]byte(query), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vm map[string]json.RawMessage
+	if vars != "" {
+		if err := json.Unmarshal([]byte(vars), &vm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pc := psql.NewCompiler(psql.Config{Schema: schema})
+
+	if _, err := pc.Compile(&bytes.Buffer{}, qc, psql.Variables(vm)); err != nil {
+		t.Fatal(err)
+	}
+
+	params := make(map[string]interface{})
+	for k, v := range vm {
+		params[k] = v
+	}
+
+	db := New(tables, schema, nil)
+
+	res, err := db.Query(qc, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(res)
+}
+
+func TestQueryFilterOrderLimit(t *testing.T) {
+	gql := `query {
+		products(where: { price: { gt: 1 } }, order_by: { price: desc }, limit: 5) {
+			id
+			name
+		}
+	}`
+
+	exp := `{"products": [{"id": 3, "name": "Cherry"}, {"id": 1, "name": "Apple"}]}`
+
+	if res := runQuery(t, gql, ""); res != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, res)
+	}
+}
+
+func TestQueryNested(t *testing.T) {
+	gql := `query {
+		user(id: $id) {
+			email
+			products(order_by: { id: asc }) {
+				name
+			}
+		}
+	}`
+
+	exp := `{"user": {"email": "john@example.com", "products": [{"name": "Banana"}, {"name": "Durian"}]}}`
+
+	if res := runQuery(t, gql, `{"id": 2}`); res != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, res)
+	}
+}
+
+func TestQueryOps(t *testing.T) {
+	gql := `query {
+		products(where: { or: { name: { ilike: "%an%" }, price: { is_null: true } } }) {
+			id
+		}
+	}`
+
+	exp := `{"products": [{"id": 2}, {"id": 4}]}`
+
+	if res := runQuery(t, gql, ""); res != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, res)
+	}
+}
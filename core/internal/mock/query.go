@@ -0,0 +1,532 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+type row = map[string]interface{}
+
+type queryContext struct {
+	*DB
+	s      []qcode.Select
+	params map[string]interface{}
+}
+
+// Query function runs the compiled query against the in-memory tables and returns
+// the same json the database would. Params are the values of the variables used in
+// the query.
+func (db *DB) Query(qc *qcode.QCode, params map[string]interface{}) ([]byte, error) {
+	if qc.Type != qcode.QTQuery {
+		return nil, errors.New("mock: only queries are supported")
+	}
+
+	c := &queryContext{DB: db, s: qc.Selects, params: params}
+	w := &bytes.Buffer{}
+
+	i := 0
+
+	w.WriteString(`{`)
+	for _, id := range qc.Roots {
+		sel := &qc.Selects[id]
+
+		if sel.SkipRender == qcode.SkipTypeDirective {
+			continue
+		}
+
+		if i != 0 {
+			w.WriteString(`, `)
+		}
+		writeKey(w, sel.FieldName)
+		i++
+
+		if sel.SkipRender != qcode.SkipTypeNone {
+			w.WriteString(`null`)
+			continue
+		}
+
+		if err := c.renderSelect(w, sel, nil); err != nil {
+			return nil, err
+		}
+	}
+	w.WriteString(`}`)
+
+	return w.Bytes(), nil
+}
+
+func (c *queryContext) renderSelect(w *bytes.Buffer, sel *qcode.Select, parent row) error {
+	if sel.Type != qcode.STNone {
+		return errors.New("mock: unions are not supported")
+	}
+
+	if sel.Paging.Cursor || len(sel.DistinctOn) != 0 {
+		return errors.New("mock: cursors and distinct are not supported")
+	}
+
+	if len(sel.GroupBy) != 0 {
+		return errors.New("mock: group by is not supported")
+	}
+
+	ti, err := c.schema.GetTableInfoB(sel.Name)
+	if err != nil {
+		return err
+	}
+
+	rows, err := c.selectRows(sel, ti, parent)
+	if err != nil {
+		return err
+	}
+
+	if ti.IsSingular {
+		if len(rows) == 0 {
+			w.WriteString(`null`)
+			return nil
+		}
+		return c.renderRow(w, sel, ti, rows[0])
+	}
+
+	w.WriteString(`[`)
+	for i := range rows {
+		if i != 0 {
+			w.WriteString(`, `)
+		}
+		if err := c.renderRow(w, sel, ti, rows[i]); err != nil {
+			return err
+		}
+	}
+	w.WriteString(`]`)
+
+	return nil
+}
+
+func (c *queryContext) renderRow(w *bytes.Buffer, sel *qcode.Select, ti *psql.DBTableInfo, r row) error {
+	i := 0
+	w.WriteString(`{`)
+
+	for _, col := range sel.Cols {
+		if _, err := ti.GetColumnB(col.Name); err != nil {
+			return fmt.Errorf("mock: functions are not supported: %w", err)
+		}
+
+		if i != 0 {
+			w.WriteString(`, `)
+		}
+		writeKey(w, col.FieldName)
+
+		v, err := json.Marshal(r[strings.ToLower(col.Name)])
+		if err != nil {
+			return err
+		}
+		w.Write(v)
+		i++
+	}
+
+	for _, id := range sel.Children {
+		child := &c.s[id]
+
+		if i != 0 {
+			w.WriteString(`, `)
+		}
+		writeKey(w, child.FieldName)
+		i++
+
+		switch child.SkipRender {
+		case qcode.SkipTypeNone:
+			if err := c.renderSelect(w, child, r); err != nil {
+				return err
+			}
+		case qcode.SkipTypeRemote:
+			return errors.New("mock: remote joins are not supported")
+		default:
+			w.WriteString(`null`)
+		}
+	}
+
+	w.WriteString(`}`)
+	return nil
+}
+
+func (c *queryContext) selectRows(sel *qcode.Select, ti *psql.DBTableInfo, parent row) ([]row, error) {
+	var rows []row
+
+	related, err := c.relatedTo(sel, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range c.tables[ti.Name] {
+		if related != nil && !related(r) {
+			continue
+		}
+
+		ok, err := c.matchExp(sel.Where, ti, r)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, r)
+		}
+	}
+
+	if err := c.orderBy(sel, rows); err != nil {
+		return nil, err
+	}
+
+	if sel.Paging.Offset != "" {
+		n, err := c.intVal(qcode.PagingParam(0, sel.Paging.Offset))
+		if err != nil {
+			return nil, err
+		}
+		if n >= len(rows) {
+			return nil, nil
+		}
+		rows = rows[n:]
+	}
+
+	limit := 20
+
+	switch {
+	case ti.IsSingular:
+		limit = 1
+	case sel.Paging.LimitVar != "":
+		max, _ := strconv.Atoi(sel.Paging.Limit)
+		if limit, err = c.intVal(qcode.PagingParam(max, sel.Paging.LimitVar)); err != nil {
+			return nil, err
+		}
+	case sel.Paging.Limit != "":
+		if limit, err = strconv.Atoi(sel.Paging.Limit); err != nil {
+			return nil, err
+		}
+	case sel.Paging.NoLimit:
+		limit = len(rows)
+	}
+
+	if limit < len(rows) {
+		rows = rows[:limit]
+	}
+
+	return rows, nil
+}
+
+// relatedTo returns a function that matches the rows related to the parent row
+func (c *queryContext) relatedTo(sel *qcode.Select, parent row) (func(row) bool, error) {
+	if parent == nil {
+		return nil, nil
+	}
+
+	rel, err := c.schema.GetRel(sel.Name, c.s[sel.ParentID].Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if rel.Left.Array || rel.Right.Array {
+		return nil, errors.New("mock: array relationships are not supported")
+	}
+
+	pv := parent[strings.ToLower(rel.Right.Col)]
+	lc := strings.ToLower(rel.Left.Col)
+
+	switch rel.Type {
+	case psql.RelOneToOne, psql.RelOneToMany:
+		return func(r row) bool {
+			return equal(r[lc], pv)
+		}, nil
+
+	case psql.RelOneToManyThrough:
+		vals := make([]interface{}, 0)
+		cl := strings.ToLower(rel.Through.ColL)
+		cr := strings.ToLower(rel.Through.ColR)
+
+		for _, t := range c.tables[rel.Through.Table] {
+			if equal(t[cr], pv) {
+				vals = append(vals, t[cl])
+			}
+		}
+
+		return func(r row) bool {
+			return inList(r[lc], vals)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("mock: relationship type %d is not supported", rel.Type)
+}
+
+func (c *queryContext) orderBy(sel *qcode.Select, rows []row) error {
+	if len(sel.OrderBy) == 0 {
+		return nil
+	}
+
+	// the orders set from variables
+	orders := make([]qcode.Order, len(sel.OrderBy))
+
+	for i, ob := range sel.OrderBy {
+		if ob.Var == "" {
+			orders[i] = ob.Order
+			continue
+		}
+
+		v, err := c.varVal(qcode.OrderParam(ob.Var))
+		if err != nil {
+			return err
+		}
+		if orders[i], err = qcode.ParseOrder(fmt.Sprint(v)); err != nil {
+			return fmt.Errorf("variable '%s': %w", ob.Var, err)
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, ob := range sel.OrderBy {
+			col := strings.ToLower(ob.Col)
+			a, b := rows[i][col], rows[j][col]
+			order := orders[k]
+
+			desc := order == qcode.OrderDesc ||
+				order == qcode.OrderDescNullsFirst ||
+				order == qcode.OrderDescNullsLast
+
+			// postgres default is nulls last for asc and first for desc
+			nullsFirst := order == qcode.OrderDesc ||
+				order == qcode.OrderAscNullsFirst ||
+				order == qcode.OrderDescNullsFirst
+
+			switch {
+			case a == nil && b == nil:
+				continue
+			case a == nil:
+				return nullsFirst
+			case b == nil:
+				return !nullsFirst
+			}
+
+			n := compare(a, b)
+			if n == 0 {
+				continue
+			}
+			if desc {
+				return n > 0
+			}
+			return n < 0
+		}
+		return false
+	})
+
+	return nil
+}
+
+func (c *queryContext) matchExp(ex *qcode.Exp, ti *psql.DBTableInfo, r row) (bool, error) {
+	if ex == nil {
+		return true, nil
+	}
+
+	switch ex.Op {
+	case qcode.OpNop:
+		return true, nil
+
+	case qcode.OpAnd, qcode.OpOr:
+		for _, e := range ex.Children {
+			ok, err := c.matchExp(e, ti, r)
+			if err != nil {
+				return false, err
+			}
+			if ex.Op == qcode.OpAnd && !ok {
+				return false, nil
+			}
+			if ex.Op == qcode.OpOr && ok {
+				return true, nil
+			}
+		}
+		return ex.Op == qcode.OpAnd, nil
+
+	case qcode.OpNot:
+		if len(ex.Children) == 0 {
+			return true, nil
+		}
+		ok, err := c.matchExp(ex.Children[0], ti, r)
+		return !ok, err
+
+	case qcode.OpFalse:
+		return false, nil
+	}
+
+	if len(ex.NestedCols) != 0 || ex.Type == qcode.ValRef {
+		return false, errors.New("mock: filters on related tables are not supported")
+	}
+
+	col := ex.Col
+
+	if ex.Op == qcode.OpEqID {
+		if ti.PrimaryCol == nil {
+			return false, fmt.Errorf("no primary key column defined for %s", ti.Name)
+		}
+		col = ti.PrimaryCol.Name
+	}
+
+	cv := r[strings.ToLower(col)]
+
+	if ex.Op == qcode.OpIsNull {
+		return (cv == nil) == strings.EqualFold(ex.Val, "true"), nil
+	}
+
+	val, err := c.expVal(ex)
+	if err != nil {
+		return false, err
+	}
+
+	if cv == nil || val == nil {
+		return false, nil
+	}
+
+	switch ex.Op {
+	case qcode.OpEquals, qcode.OpEqID:
+		return equal(cv, val), nil
+	case qcode.OpNotEquals:
+		return !equal(cv, val), nil
+	case qcode.OpGreaterThan:
+		return compare(cv, val) > 0, nil
+	case qcode.OpGreaterOrEquals:
+		return compare(cv, val) >= 0, nil
+	case qcode.OpLesserThan:
+		return compare(cv, val) < 0, nil
+	case qcode.OpLesserOrEquals:
+		return compare(cv, val) <= 0, nil
+	case qcode.OpIn, qcode.OpNotIn:
+		list, ok := val.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("mock: value for '%s' must be a list", ex.Col)
+		}
+		return inList(cv, list) == (ex.Op == qcode.OpIn), nil
+	case qcode.OpLike, qcode.OpNotLike, qcode.OpILike, qcode.OpNotILike:
+		ci := ex.Op == qcode.OpILike || ex.Op == qcode.OpNotILike
+		ok, err := like(fmt.Sprint(cv), fmt.Sprint(val), ci)
+		return ok == (ex.Op == qcode.OpLike || ex.Op == qcode.OpILike), err
+	}
+
+	return false, fmt.Errorf("mock: filter %s is not supported", ex.Op)
+}
+
+func (c *queryContext) expVal(ex *qcode.Exp) (interface{}, error) {
+	switch ex.Type {
+	case qcode.ValList:
+		list := make([]interface{}, len(ex.ListVal))
+		for i := range ex.ListVal {
+			list[i] = ex.ListVal[i]
+		}
+		return list, nil
+
+	case qcode.ValVar:
+		return c.varVal(ex.Val)
+	}
+
+	return ex.Val, nil
+}
+
+func (c *queryContext) varVal(name string) (interface{}, error) {
+	if v, ok := c.vars[name]; ok {
+		if strings.HasPrefix(v, "sql:") {
+			return nil, fmt.Errorf("mock: sql variable '%s' is not supported", name)
+		}
+		return v, nil
+	}
+
+	v, ok := c.params[name]
+	if !ok {
+		return nil, fmt.Errorf("variable '%s' not set", name)
+	}
+
+	if b, ok := v.(json.RawMessage); ok {
+		var v1 interface{}
+		if err := json.Unmarshal(b, &v1); err != nil {
+			return nil, err
+		}
+		return v1, nil
+	}
+
+	return v, nil
+}
+
+func (c *queryContext) intVal(name string) (int, error) {
+	v, err := c.varVal(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(fmt.Sprint(v))
+}
+
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return compare(a, b) == 0
+}
+
+func inList(v interface{}, list []interface{}) bool {
+	for i := range list {
+		if equal(v, list[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare values as numbers when both are numeric else as strings
+func compare(a, b interface{}) int {
+	as, bs := fmt.Sprint(a), fmt.Sprint(b)
+
+	if an, err := strconv.ParseFloat(as, 64); err == nil {
+		if bn, err := strconv.ParseFloat(bs, 64); err == nil {
+			switch {
+			case an < bn:
+				return -1
+			case an > bn:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	return strings.Compare(as, bs)
+}
+
+// like matches the value using a sql like pattern
+func like(val, pattern string, ci bool) (bool, error) {
+	var sb strings.Builder
+
+	if ci {
+		sb.WriteString(`(?is)^`)
+	} else {
+		sb.WriteString(`(?s)^`)
+	}
+
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			sb.WriteString(`.*`)
+		case '_':
+			sb.WriteString(`.`)
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString(`$`)
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(val), nil
+}
+
+func writeKey(w *bytes.Buffer, key string) {
+	k, _ := json.Marshal(key)
+	w.Write(k)
+	w.WriteString(`: `)
+}
@@ -0,0 +1,67 @@
+package psql
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// CachedParam is the prefix of the params the freshness of the cache tables
+// is passed in as (eg. _sg_cached_product_stats), it's true when the values
+// in the cache table can be used
+const CachedParam = "_sg_cached_"
+
+// CachedField is a field of a table read from a cache table (eg. a
+// materialized view) with a row for each row of the table, the sql
+// computing it live is used when the cache is stale
+type CachedField struct {
+	// SQL is the expression computing the value live
+	SQL string
+
+	// Table is the cache table and Column the column of it with the value
+	Table  string
+	Column string
+
+	// Key is the column of the cache table with the primary key of the row
+	Key string
+}
+
+// isCached returns true for the fields of the table read from a cache table
+func (c *compilerContext) isCached(ti *DBTableInfo, cn string) bool {
+	_, ok := c.cached[ti.Name][cn]
+	return ok
+}
+
+// renderColumnCached renders the value of the field from the cache table when
+// it's fresh or else the live sql. The freshness is a param so the same sql
+// works either way, Postgres only runs the subquery of the branch taken
+func (c *compilerContext) renderColumnCached(sel *qcode.Select, ti *DBTableInfo, col qcode.Column, columnsRendered int) error {
+	cf := c.cached[ti.Name][col.Name]
+
+	if err := ColumnAccess(ti, sel, col.Name, false); err != nil {
+		return err
+	}
+
+	if ti.PrimaryCol == nil {
+		return fmt.Errorf("cached field %s: no primary key column defined for %s", col.Name, ti.Name)
+	}
+
+	c.renderComma(columnsRendered)
+	io.WriteString(c.w, `(CASE WHEN `)
+	c.md.renderParam(c.w, Param{Name: CachedParam + cf.Table, Type: "boolean"})
+	io.WriteString(c.w, ` :: boolean THEN (SELECT `)
+	colWithTable(c.w, "__sg_c", cf.Column)
+	io.WriteString(c.w, ` FROM `)
+	quoted(c.w, cf.Table)
+	io.WriteString(c.w, ` AS "__sg_c" WHERE ((`)
+	colWithTable(c.w, "__sg_c", cf.Key)
+	io.WriteString(c.w, `) = (`)
+	colWithTable(c.w, ti.Name, ti.PrimaryCol.Name)
+	io.WriteString(c.w, `)) LIMIT 1) ELSE (`)
+	io.WriteString(c.w, cf.SQL)
+	io.WriteString(c.w, `) END)`)
+	alias(c.w, col.Name)
+
+	return nil
+}
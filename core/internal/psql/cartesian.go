@@ -0,0 +1,84 @@
+package psql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// CartesianMode is what's done with the joins of a query on columns unique
+// on neither side. Each row of the parent then matches many rows of the child
+// and the other way around, the result grows as the product of the two
+type CartesianMode int
+
+const (
+	// CartesianWarn compiles the query with a warning
+	CartesianWarn CartesianMode = iota
+
+	// CartesianReject fails to compile the query
+	CartesianReject
+
+	// CartesianAllow compiles the query as is
+	CartesianAllow
+)
+
+// checkCartesianJoins finds the selections joined to their parent on columns
+// that are not unique on either side, the path to them is in the message
+func (c *compilerContext) checkCartesianJoins() error {
+	if c.cartesian == CartesianAllow {
+		return nil
+	}
+
+	for i := range c.s {
+		sel := &c.s[i]
+
+		if sel.ParentID == -1 || sel.SkipRender != qcode.SkipTypeNone ||
+			sel.Type != qcode.STNone || c.isJSONSel(sel.ID) {
+			continue
+		}
+
+		// a missing relationship is an error when the selection is rendered
+		rel, err := c.schema.GetRel(sel.Name, c.s[sel.ParentID].Name)
+		if err != nil || !isCartesian(rel) {
+			continue
+		}
+
+		msg := fmt.Sprintf("cartesian join: %s: %s.%s = %s.%s, neither column is unique",
+			c.selPath(sel), rel.Left.Table, rel.Left.Col, rel.Right.Table, rel.Right.Col)
+
+		if c.cartesian == CartesianReject {
+			return errors.New(msg)
+		}
+		c.md.warnings = append(c.md.warnings, msg)
+	}
+	return nil
+}
+
+// isCartesian returns true for a relationship between two columns
+// where neither is a primary key or unique
+func isCartesian(rel *DBRel) bool {
+	if rel.Type != RelOneToOne && rel.Type != RelOneToMany {
+		return false
+	}
+	if rel.Left.Array || rel.Right.Array {
+		return false
+	}
+	l, r := rel.Left.col, rel.Right.col
+
+	return l != nil && r != nil &&
+		!l.UniqueKey && !l.PrimaryKey && !r.UniqueKey && !r.PrimaryKey
+}
+
+// selPath returns the field names from the root to the selection
+// (eg. products.owner)
+func (c *compilerContext) selPath(sel *qcode.Select) string {
+	path := []string{sel.FieldName}
+
+	for sel.ParentID != -1 {
+		sel = &c.s[sel.ParentID]
+		path = append([]string{sel.FieldName}, path...)
+	}
+	return strings.Join(path, ".")
+}
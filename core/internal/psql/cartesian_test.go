@@ -0,0 +1,62 @@
+package psql_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestCartesianJoins(t *testing.T) {
+	tables := []psql.DBTable{
+		{Name: "accounts", Type: "table"},
+		{Name: "orders", Type: "table"},
+	}
+
+	columns := [][]psql.DBColumn{
+		{
+			{ID: 1, Name: "id", Type: "bigint", NotNull: true, PrimaryKey: true, UniqueKey: true},
+			{ID: 2, Name: "name", Type: "text"},
+		},
+		{
+			{ID: 1, Name: "id", Type: "bigint", NotNull: true, PrimaryKey: true, UniqueKey: true},
+			{ID: 2, Name: "account_name", Type: "text", FKeyTable: "accounts", FKeyColID: []int16{2}},
+		},
+	}
+
+	schema, err := psql.NewDBSchema(psql.NewDBInfo(110000, tables, columns, nil, nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qc, err := qcompile.Compile([]byte(`query { orders { id accounts { id } } }`), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	co := psql.NewCompiler(psql.Config{Schema: schema})
+
+	md, _, err := co.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := md.Warnings()
+	exp := "cartesian join: orders.accounts: accounts.name = orders.account_name, neither column is unique"
+
+	if len(w) != 1 || w[0] != exp {
+		t.Fatalf("expected the warning '%s' got %v", exp, w)
+	}
+
+	co = psql.NewCompiler(psql.Config{Schema: schema, Cartesian: psql.CartesianReject})
+
+	if _, _, err := co.CompileEx(qc, nil); err == nil || !strings.Contains(err.Error(), "orders.accounts") {
+		t.Fatalf("expected a cartesian join error got %v", err)
+	}
+
+	co = psql.NewCompiler(psql.Config{Schema: schema, Cartesian: psql.CartesianAllow})
+
+	if md, _, err := co.CompileEx(qc, nil); err != nil || len(md.Warnings()) != 0 {
+		t.Fatalf("expected no warnings got %v (%v)", md.Warnings(), err)
+	}
+}
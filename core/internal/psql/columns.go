@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/dosco/super-graph/core/internal/qcode"
+	"github.com/dosco/super-graph/core/internal/util"
 )
 
 func (c *compilerContext) renderBaseColumns(
@@ -27,14 +28,40 @@ func (c *compilerContext) renderBaseColumns(
 		cn := col.Name
 		colmap[cn] = struct{}{}
 
+		// the row cursor is built from the order by columns
+		if isRowCursor(sel, cn) {
+			continue
+		}
+
 		if ti.ColumnExists(cn) {
-			if _, err := ti.GetColumnB(cn); err != nil {
+			dc, err := ti.GetColumnB(cn)
+			if err != nil {
 				return nil, false, err
 			}
 
 			c.renderComma(i)
 			realColsRendered = append(realColsRendered, n)
-			colWithTable(c.w, ti.Name, cn)
+
+			switch {
+			case dc.Translated:
+				c.renderTranslatedCol(ti, dc)
+			case dc.Currency != "" && dc.Type == "money":
+				// money is returned as a string in the format of the locale
+				colWithTable(c.w, ti.Name, dc.Name)
+				io.WriteString(c.w, ` :: numeric`)
+				alias(c.w, cn)
+			case dc.GeoJSON:
+				io.WriteString(c.w, `ST_AsGeoJSON(`)
+				colWithTable(c.w, ti.Name, dc.Name)
+				io.WriteString(c.w, `) :: json`)
+				alias(c.w, cn)
+			case dc.Name != cn:
+				// a column with uppercase in it is selected as the key
+				colWithTable(c.w, ti.Name, dc.Name)
+				alias(c.w, cn)
+			default:
+				colWithTable(c.w, ti.Name, cn)
+			}
 
 		} else {
 			switch {
@@ -53,9 +80,30 @@ func (c *compilerContext) renderBaseColumns(
 					return nil, false, err
 				}
 
+			case c.isComputed(ti, cn):
+				if err := c.renderColumnComputed(sel, ti, col, i); err != nil {
+					return nil, false, err
+				}
+
+			case c.isCached(ti, cn):
+				if err := c.renderColumnCached(sel, ti, col, i); err != nil {
+					return nil, false, err
+				}
+
+			case col.Filter != nil:
+				if err := c.renderColumnCan(ti, col, i); err != nil {
+					return nil, false, err
+				}
+
 			case strings.HasSuffix(cn, "_cursor"):
 				continue
 
+			case cn == CountField:
+				c.renderComma(i)
+				_, _ = io.WriteString(c.w, `count(*)`)
+				alias(c.w, cn)
+				isAgg = true
+
 			default:
 				if err := c.renderColumnFunction(sel, ti, col, i); err != nil {
 					return nil, false, err
@@ -77,12 +125,25 @@ func (c *compilerContext) renderBaseColumns(
 	}
 
 	for _, ob := range sel.OrderBy {
-		if _, ok := colmap[ob.Col]; ok {
+		if _, ok := colmap[ob.Col]; ok || isCountOnly(sel) {
 			continue
 		}
 		colmap[ob.Col] = struct{}{}
-		c.renderComma(i)
-		colWithTable(c.w, ti.Name, ob.Col)
+
+		if isSearchRank(sel, ti, ob.Col) {
+			if err := c.renderColumnSearchRank(sel, ti, qcode.Column{Name: ob.Col}, i); err != nil {
+				return nil, false, err
+			}
+		} else if isOrderExp(ti, ob.Col) {
+			c.renderComma(i)
+			if err := c.renderOrderExp(sel, ti, ob.Col); err != nil {
+				return nil, false, err
+			}
+			alias(c.w, ob.Col)
+		} else {
+			c.renderComma(i)
+			colWithTable(c.w, ti.Name, ob.Col)
+		}
 		i++
 	}
 
@@ -98,29 +159,118 @@ func (c *compilerContext) renderBaseColumns(
 	return realColsRendered, isAgg, nil
 }
 
+// dropUnknownCols removes the columns not found in the table from the
+// selections and adds a warning for each of them
+func (c *compilerContext) dropUnknownCols() {
+	for i := range c.s {
+		sel := &c.s[i]
+
+		if sel.SkipRender != qcode.SkipTypeNone || sel.Type == qcode.STUnion {
+			continue
+		}
+
+		ti, err := c.schema.GetTableInfo(sel.Name)
+		if err != nil {
+			continue
+		}
+
+		cols := sel.Cols[:0]
+		for _, col := range sel.Cols {
+			if c.isKnownCol(ti, col.Name) || isRowCursor(sel, col.Name) {
+				cols = append(cols, col)
+			} else {
+				c.md.warnings = append(c.md.warnings,
+					fmt.Sprintf("unknown field dropped: %s.%s", sel.FieldName, col.Name))
+			}
+		}
+		sel.Cols = cols
+	}
+}
+
+// isSearchRank returns true for the rank of the rows
+// matching the search argument
+func isSearchRank(sel *qcode.Select, ti *DBTableInfo, cn string) bool {
+	return cn == "search_rank" && sel.Args["search"] != nil && !ti.ColumnExists(cn)
+}
+
+// isRowCursor returns true for the cursor field of the rows of a cursor
+// paged selection, it's used over a column of the same name
+func isRowCursor(sel *qcode.Select, cn string) bool {
+	return cn == "cursor" && sel.Paging.Type != qcode.PtOffset
+}
+
+// checkUnknownCols returns the unknown columns in all the selections
+// together instead of failing on the first one
+func (c *compilerContext) checkUnknownCols() error {
+	var errs util.Errors
+
+	for i := range c.s {
+		sel := &c.s[i]
+
+		if sel.SkipRender != qcode.SkipTypeNone || sel.Type == qcode.STUnion {
+			continue
+		}
+
+		ti, err := c.schema.GetTableInfo(sel.Name)
+		if err != nil {
+			continue
+		}
+
+		for _, col := range sel.Cols {
+			if c.isKnownCol(ti, col.Name) || isRowCursor(sel, col.Name) {
+				continue
+			}
+
+			cn := col.Name[funcPrefixLen(c.schema.fm, col.Name):]
+
+			if !errs.Add(ti.colNotFound(cn), c.maxErrs) {
+				return errs.Err()
+			}
+		}
+	}
+
+	return errs.Err()
+}
+
+func (c *compilerContext) isKnownCol(ti *DBTableInfo, cn string) bool {
+	switch {
+	case ti.ColumnExists(cn),
+		cn == "__typename",
+		cn == qcode.CanUpdate,
+		cn == qcode.CanDelete,
+		cn == "search_rank",
+		cn == CountField,
+		strings.HasPrefix(cn, "search_headline_"),
+		strings.HasSuffix(cn, "_cursor"),
+		c.isComputed(ti, cn),
+		c.isCached(ti, cn):
+		return true
+	}
+
+	if pl := funcPrefixLen(c.schema.fm, cn); pl != 0 {
+		return ti.ColumnExists(cn[pl:])
+	}
+	return false
+}
+
 func (c *compilerContext) renderColumnSearchRank(sel *qcode.Select, ti *DBTableInfo, col qcode.Column, columnsRendered int) error {
 	if err := ColumnAccess(ti, sel, col.Name, false); err != nil {
 		return err
 	}
 
-	if ti.TSVCol == nil {
+	if !ti.HasSearch() {
 		return errors.New("no ts_vector column found")
 	}
-	cn := ti.TSVCol.Name
 	arg := sel.Args["search"]
 
 	c.renderComma(columnsRendered)
 	//fmt.Fprintf(w, `ts_rank("%s"."%s", websearch_to_tsquery('%s')) AS %s`,
 	//c.sel.Name, cn, arg.Val, col.Name)
 	_, _ = io.WriteString(c.w, `ts_rank(`)
-	colWithTable(c.w, ti.Name, cn)
-	if c.schema.ver >= 110000 {
-		_, _ = io.WriteString(c.w, `, websearch_to_tsquery(`)
-	} else {
-		_, _ = io.WriteString(c.w, `, to_tsquery(`)
-	}
-	c.md.renderParam(c.w, Param{Name: arg.Val, Type: "text"})
-	_, _ = io.WriteString(c.w, `))`)
+	c.renderTSV(ti)
+	_, _ = io.WriteString(c.w, `, `)
+	c.renderTSQuery(arg.Val, arg.Type == qcode.NodeVar)
+	_, _ = io.WriteString(c.w, `)`)
 	alias(c.w, col.Name)
 
 	return nil
@@ -140,13 +290,9 @@ func (c *compilerContext) renderColumnSearchHeadline(sel *qcode.Select, ti *DBTa
 	//c.sel.Name, cn, arg.Val, col.Name)
 	_, _ = io.WriteString(c.w, `ts_headline(`)
 	colWithTable(c.w, ti.Name, cn)
-	if c.schema.ver >= 110000 {
-		_, _ = io.WriteString(c.w, `, websearch_to_tsquery(`)
-	} else {
-		_, _ = io.WriteString(c.w, `, to_tsquery(`)
-	}
-	c.md.renderParam(c.w, Param{Name: arg.Val, Type: "text"})
-	_, _ = io.WriteString(c.w, `))`)
+	_, _ = io.WriteString(c.w, `, `)
+	c.renderTSQuery(arg.Val, arg.Type == qcode.NodeVar)
+	_, _ = io.WriteString(c.w, `)`)
 	alias(c.w, col.Name)
 
 	return nil
@@ -162,6 +308,65 @@ func (c *compilerContext) renderColumnTypename(sel *qcode.Select, ti *DBTableInf
 	return nil
 }
 
+// isComputed returns true for the fields of the table computed outside the database
+func (c *compilerContext) isComputed(ti *DBTableInfo, cn string) bool {
+	_, ok := c.cfields[ti.Name][cn]
+	return ok
+}
+
+// renderColumnComputed renders the columns a computed field needs as a json
+// object, the value of the field is set from it once the query is run
+func (c *compilerContext) renderColumnComputed(sel *qcode.Select, ti *DBTableInfo, col qcode.Column, columnsRendered int) error {
+	cols := c.cfields[ti.Name][col.Name]
+
+	for _, cn := range cols {
+		if err := ColumnAccess(ti, sel, cn, true); err != nil {
+			return fmt.Errorf("computed field %s: %w", col.Name, err)
+		}
+	}
+
+	c.renderComma(columnsRendered)
+	_, _ = io.WriteString(c.w, `json_build_object(`)
+
+	for i, cn := range cols {
+		if i != 0 {
+			_, _ = io.WriteString(c.w, `, `)
+		}
+		squoted(c.w, cn)
+		_, _ = io.WriteString(c.w, `, `)
+		colWithTable(c.w, ti.Name, cn)
+	}
+
+	_, _ = io.WriteString(c.w, `)`)
+	alias(c.w, col.Name)
+
+	return nil
+}
+
+// renderColumnCan renders the _can_update or _can_delete field of a row,
+// it's true when the row matches the update or delete filter of the role
+func (c *compilerContext) renderColumnCan(ti *DBTableInfo, col qcode.Column, columnsRendered int) error {
+	c.renderComma(columnsRendered)
+
+	switch col.Filter.Op {
+	case qcode.OpNop:
+		io.WriteString(c.w, `true`)
+
+	case qcode.OpFalse:
+		io.WriteString(c.w, `false`)
+
+	default:
+		io.WriteString(c.w, `COALESCE(`)
+		if err := c.renderExp(col.Filter, ti, false); err != nil {
+			return err
+		}
+		io.WriteString(c.w, `, false)`)
+	}
+	alias(c.w, col.Name)
+
+	return nil
+}
+
 func (c *compilerContext) renderColumnFunction(sel *qcode.Select, ti *DBTableInfo, col qcode.Column, columnsRendered int) error {
 	pl := funcPrefixLen(c.schema.fm, col.Name)
 
@@ -177,18 +382,65 @@ func (c *compilerContext) renderColumnFunction(sel *qcode.Select, ti *DBTableInf
 
 	fn := col.Name[:pl-1]
 
+	if numericFunc(fn) {
+		if v, err := ti.GetColumn(cn); err == nil && !isNumeric(v.Type) {
+			return fmt.Errorf("%s: column '%s' of type '%s' is not numeric", fn, cn, v.Type)
+		}
+	}
+
 	c.renderComma(columnsRendered)
 
 	//fmt.Fprintf(w, `%s("%s"."%s") AS %s`, fn, c.sel.Name, cn, col.Name)
 	_, _ = io.WriteString(c.w, fn)
 	_, _ = io.WriteString(c.w, `(`)
 	colWithTable(c.w, ti.Name, cn)
+
+	// amounts are not summed or averaged as floats
+	if numericFunc(fn) {
+		if v, err := ti.GetColumn(cn); err == nil && v.Currency != "" {
+			_, _ = io.WriteString(c.w, ` :: numeric`)
+		}
+	}
 	_, _ = io.WriteString(c.w, `)`)
 	alias(c.w, col.Name)
 
 	return nil
 }
 
+// numericFunc returns true for the aggregate functions
+// that only work with numeric columns
+func numericFunc(fn string) bool {
+	switch fn {
+	case "avg", "sum", "stddev", "stddev_pop", "stddev_samp",
+		"variance", "var_pop", "var_samp":
+		return true
+	}
+	return false
+}
+
+func isIntType(t string) bool {
+	switch t {
+	case "smallint", "integer", "int", "int2", "int4", "int8", "bigint",
+		"smallserial", "serial", "bigserial":
+		return true
+	}
+	return false
+}
+
+func isNumeric(t string) bool {
+	if n := strings.IndexByte(t, '('); n != -1 {
+		t = t[:n]
+	}
+
+	switch strings.TrimSpace(t) {
+	case "smallint", "integer", "int", "int2", "int4", "int8", "bigint",
+		"smallserial", "serial", "bigserial", "decimal", "numeric",
+		"real", "float4", "float8", "double precision", "money":
+		return true
+	}
+	return false
+}
+
 func (c *compilerContext) renderComma(columnsRendered int) {
 	if columnsRendered != 0 {
 		_, _ = io.WriteString(c.w, `, `)
@@ -0,0 +1,133 @@
+//nolint:errcheck
+package psql
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// CountField is the field of a table that returns the number of its rows
+// matching the filters of the selection
+const CountField = "_count_estimate"
+
+// countParamPrefix is the prefix of the params the counts
+// made outside the query are passed in
+const countParamPrefix = "_sg_count_"
+
+// CountStrategy is how the rows of a table are counted for the CountField
+type CountStrategy int
+
+const (
+	// CountExact counts the rows with count(*)
+	CountExact CountStrategy = iota
+
+	// CountEstimate uses the row estimate of the table from pg_class or the
+	// row estimate of the planner (EXPLAIN) when the rows are filtered
+	CountEstimate
+
+	// CountCached counts the rows with count(*) outside the query and the
+	// count is reused till it expires
+	CountCached
+)
+
+// CountQuery is the sql counting the rows of a selection outside the query,
+// its result is passed to the query as the param named Param. For CountEstimate
+// it's run with EXPLAIN and for CountCached it's wrapped in a count(*)
+type CountQuery struct {
+	Param    string
+	Table    string
+	Strategy CountStrategy
+	SQL      string
+	md       Metadata
+}
+
+// Metadata returns the params of the sql of the count
+func (cq CountQuery) Metadata() Metadata {
+	return cq.md
+}
+
+// CountQuery returns the count run outside the query for the param
+func (md Metadata) CountQuery(param string) (CountQuery, bool) {
+	for _, cq := range md.counts {
+		if cq.Param == param {
+			return cq, true
+		}
+	}
+	return CountQuery{}, false
+}
+
+// isCountOnly returns true when the count is the only field of the
+// selection so its rows don't have to be fetched
+func isCountOnly(sel *qcode.Select) bool {
+	return len(sel.Cols) == 1 && sel.Cols[0].Name == CountField &&
+		len(sel.Children) == 0 && len(sel.GroupBy) == 0 && len(sel.DistinctOn) == 0 &&
+		sel.Paging.Type == qcode.PtOffset && !sel.Paging.Cursor && sel.Func == ""
+}
+
+// renderCountSelect renders the count of the rows of a root selection when
+// the table isn't counted with count(*). It returns false when the selection
+// is rendered as usual instead, the count of nested selections or selections
+// with other fields is always exact
+func (c *compilerContext) renderCountSelect(sel *qcode.Select, ti *DBTableInfo, rel *DBRel) (bool, error) {
+	cs := c.counts[ti.Name]
+
+	if cs == CountExact || rel != nil || !sel.Functions || !isCountOnly(sel) || c.md.Poll {
+		return false, nil
+	}
+	isFil := (sel.Where != nil && sel.Where.Op != qcode.OpNop)
+
+	io.WriteString(c.w, `SELECT `)
+
+	if cs == CountEstimate && !isFil {
+		io.WriteString(c.w, `(SELECT greatest("reltuples", 0) :: bigint FROM "pg_catalog"."pg_class" WHERE "oid" = '`)
+		c.renderRegclass(c.w, ti.Name)
+		io.WriteString(c.w, `' :: regclass)`)
+		alias(c.w, CountField)
+		return true, nil
+	}
+
+	var w bytes.Buffer
+
+	cc := &compilerContext{w: &w, s: c.s, schema: c.schema, qvars: c.qvars,
+		joins: c.joins, Compiler: c.Compiler}
+
+	io.WriteString(cc.w, `SELECT 1 FROM `)
+	cc.renderSelTable(cc.w, sel, ti)
+
+	if isFil {
+		io.WriteString(cc.w, ` WHERE (`)
+		if err := cc.renderWhere(sel, ti); err != nil {
+			return false, err
+		}
+		io.WriteString(cc.w, `)`)
+	}
+
+	cq := CountQuery{
+		Param:    countParamPrefix + strconv.Itoa(int(sel.ID)),
+		Table:    ti.Name,
+		Strategy: cs,
+		SQL:      w.String(),
+		md:       cc.md,
+	}
+	c.md.counts = append(c.md.counts, cq)
+
+	c.md.renderParam(c.w, Param{Name: cq.Param, Type: "bigint"})
+	io.WriteString(c.w, ` :: bigint`)
+	alias(c.w, CountField)
+
+	return true, nil
+}
+
+// renderRegclass renders the name of the table as a regclass
+func (c *compilerContext) renderRegclass(w io.Writer, name string) {
+	if ti, ok := c.schema.qt[name]; ok {
+		quoted(w, ti.Schema)
+		io.WriteString(w, `.`)
+		quoted(w, ti.Table)
+	} else {
+		quoted(w, name)
+	}
+}
@@ -0,0 +1,57 @@
+package psql
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// Dialect renders the sql of the compiled queries for a database
+type Dialect interface {
+	// Name of the database (eg. postgres)
+	Name() string
+
+	// QuoteIdent returns the identifier (eg. a table or column name) quoted
+	// for the database, any name is safe including ones with uppercase,
+	// spaces, quotes or a reserved word
+	QuoteIdent(ident string) string
+
+	renderQuery(c *compilerContext, qc *qcode.QCode, vars Variables) error
+	compileMutation(co *Compiler, w io.Writer, qc *qcode.QCode, vars Variables) (Metadata, error)
+}
+
+var (
+	// Postgres is the default dialect, every feature is supported
+	Postgres Dialect = pgDialect{}
+
+	// MySQL is the dialect for MySQL 8.0.17 or later, only queries are
+	// supported and not the features specific to Postgres (eg. search)
+	MySQL Dialect = mysqlDialect{}
+)
+
+type pgDialect struct{}
+
+func (pgDialect) Name() string {
+	return "postgres"
+}
+
+func (pgDialect) QuoteIdent(ident string) string {
+	return `"` + strings.Replace(ident, `"`, `""`, -1) + `"`
+}
+
+func (pgDialect) compileMutation(co *Compiler, w io.Writer, qc *qcode.QCode, vars Variables) (Metadata, error) {
+	return co.compileMutation(w, qc, vars)
+}
+
+// GetDialect returns the dialect of a database by name
+func GetDialect(name string) (Dialect, error) {
+	switch name {
+	case "", "postgres", "postgresql":
+		return Postgres, nil
+	case "mysql":
+		return MySQL, nil
+	}
+	return nil, fmt.Errorf("unknown database type: %s", name)
+}
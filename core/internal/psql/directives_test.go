@@ -0,0 +1,76 @@
+package psql_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestSkipDirectives(t *testing.T) {
+	gql := `query {
+		products @skip(if: $skip) {
+			id
+			name @include(if: $name)
+			customers {
+				email
+			}
+		}
+		users @include(if: false) {
+			id
+		}
+	}`
+
+	compile := func(vars psql.Variables) (psql.Metadata, string) {
+		qc, err := qcompile.Compile([]byte(gql), "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		md, sql, err := pcompile.CompileEx(qc, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return md, string(sql)
+	}
+
+	md, sql := compile(psql.Variables{
+		"skip": json.RawMessage(`false`),
+		"name": json.RawMessage(`false`),
+	})
+
+	if md.Skipped() {
+		t.Fatal("expected the products selection to be rendered")
+	}
+
+	if !strings.Contains(sql, `'products'`) || strings.Contains(sql, `'users'`) {
+		t.Fatalf("unexpected roots in: %s", sql)
+	}
+
+	if strings.Contains(sql, `"name"`) {
+		t.Fatalf("expected the name column to be skipped: %s", sql)
+	}
+
+	md, sql = compile(psql.Variables{
+		"skip": json.RawMessage(`true`),
+		"name": json.RawMessage(`true`),
+	})
+
+	if !md.Skipped() {
+		t.Fatal("expected every root to be skipped")
+	}
+
+	if strings.Contains(sql, `FROM "products"`) || strings.Contains(sql, `FROM "customers"`) {
+		t.Fatalf("expected no joins for skipped selections: %s", sql)
+	}
+
+	qc, err := qcompile.Compile([]byte(gql), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := pcompile.CompileEx(qc, nil); err == nil {
+		t.Fatal("expected an error for a missing directive variable")
+	}
+}
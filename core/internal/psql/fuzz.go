@@ -9,7 +9,7 @@ import (
 )
 
 var (
-	qcompileTest, _ = qcode.NewCompiler(qcode.Config{})
+	qcompileTest, _ = qcode.NewCompiler()
 
 	schema, _ = GetTestSchema()
 
@@ -21,7 +21,9 @@ func (c *compilerContext) renderInsert(
 		return 0, fmt.Errorf("variable '%s' is empty", qc.ActionVar)
 	}
 
-	io.WriteString(c.w, `WITH "_sg_input" AS (SELECT `)
+	c.renderWith()
+	c.renderInputName()
+	io.WriteString(c.w, ` AS (SELECT `)
 	if insert[0] == '[' {
 		io.WriteString(c.w, `json_array_elements(`)
 	}
@@ -33,7 +35,7 @@ func (c *compilerContext) renderInsert(
 	io.WriteString(c.w, ` AS j)`)
 
 	st := util.NewStack()
-	st.Push(kvitem{_type: itemInsert, key: ti.Name, val: insert, ti: ti})
+	st.Push(kvitem{_type: itemInsert, key: ti.Name, val: insert, ti: ti, refs: c.refs})
 
 	for {
 		if st.Len() == 0 {
@@ -83,7 +85,8 @@ func (c *compilerContext) renderInsertStmt(qc *qcode.QCode, w io.Writer, item re
 	io.WriteString(w, ` AS (`)
 
 	io.WriteString(w, `INSERT INTO `)
-	quoted(w, ti.Name)
+	c.renderTableAs(w, ti.Name)
+	c.addCte(item.kvitem)
 	io.WriteString(w, ` (`)
 
 	if rc, err := c.renderInsertUpdateColumns(qc, jt, ti, sk, false); err != nil {
@@ -100,7 +103,9 @@ func (c *compilerContext) renderInsertStmt(qc *qcode.QCode, w io.Writer, item re
 		renderNestedInsertRelColumns(w, item.kvitem, true, rc)
 	}
 
-	io.WriteString(w, ` FROM "_sg_input" i`)
+	io.WriteString(w, ` FROM `)
+	c.renderInputName()
+	io.WriteString(w, ` i`)
 	renderNestedInsertRelTables(w, item.kvitem)
 
 	if !embedded {
@@ -112,6 +117,10 @@ func (c *compilerContext) renderInsertStmt(qc *qcode.QCode, w io.Writer, item re
 func nestedInsertRelColumnsMap(item kvitem) map[string]struct{} {
 	sk := make(map[string]struct{}, len(item.items))
 
+	for _, rel := range item.refs {
+		sk[rel.Right.Col] = struct{}{}
+	}
+
 	if len(item.items) == 0 {
 		if item.relPC != nil && item.relPC.Type == RelOneToMany {
 			sk[item.relPC.Right.Col] = struct{}{}
@@ -128,6 +137,20 @@ func nestedInsertRelColumnsMap(item kvitem) map[string]struct{} {
 }
 
 func renderNestedInsertRelColumns(w io.Writer, item kvitem, values, colsRendered bool) error {
+	// Render foreign key columns set from the rows returned
+	// by an earlier mutation in the same request
+	for _, rel := range item.refs {
+		if colsRendered {
+			io.WriteString(w, `, `)
+		}
+		if values {
+			colWithTable(w, rel.Left.Table, rel.Left.Col)
+		} else {
+			quoted(w, rel.Right.Col)
+		}
+		colsRendered = true
+	}
+
 	if len(item.items) == 0 {
 		if item.relPC != nil && item.relPC.Type == RelOneToMany {
 			if colsRendered {
@@ -153,7 +176,7 @@ func renderNestedInsertRelColumns(w io.Writer, item kvitem, values, colsRendered
 			if values {
 				if v._ctype > 0 {
 					io.WriteString(w, `"_x_`)
-					io.WriteString(w, v.relCP.Left.Table)
+					escapeIdent(w, v.relCP.Left.Table)
 					io.WriteString(w, `".`)
 					quoted(w, v.relCP.Left.Col)
 				} else {
@@ -170,6 +193,11 @@ func renderNestedInsertRelColumns(w io.Writer, item kvitem, values, colsRendered
 }
 
 func renderNestedInsertRelTables(w io.Writer, item kvitem) error {
+	for _, rel := range item.refs {
+		io.WriteString(w, `, `)
+		quoted(w, rel.Left.Table)
+	}
+
 	if len(item.items) == 0 {
 		if item.relPC != nil && item.relPC.Type == RelOneToMany {
 			io.WriteString(w, `, `)
@@ -183,7 +211,7 @@ func renderNestedInsertRelTables(w io.Writer, item kvitem) error {
 				io.WriteString(w, `, `)
 				if v._ctype > 0 {
 					io.WriteString(w, `"_x_`)
-					io.WriteString(w, v.relCP.Left.Table)
+					escapeIdent(w, v.relCP.Left.Table)
 					io.WriteString(w, `"`)
 				} else {
 					quoted(w, v.relCP.Left.Table)
@@ -2,7 +2,10 @@ package psql_test
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
 )
 
 func simpleInsert(t *testing.T) {
@@ -269,3 +272,47 @@ func TestCompileInsert(t *testing.T) {
 	t.Run("nestedInsertOneToOneWithConnect", nestedInsertOneToOneWithConnect)
 	t.Run("nestedInsertOneToOneWithConnectArray", nestedInsertOneToOneWithConnectArray)
 }
+
+func TestCompileInsertGeneratedColumns(t *testing.T) {
+	tables := []psql.DBTable{
+		{Name: "orders", Type: "table"},
+	}
+
+	columns := [][]psql.DBColumn{{
+		{ID: 1, Name: "id", Type: "bigint", NotNull: true, PrimaryKey: true, UniqueKey: true, Identity: "ALWAYS"},
+		{ID: 2, Name: "price", Type: "numeric"},
+		{ID: 3, Name: "quantity", Type: "integer"},
+		{ID: 4, Name: "total", Type: "numeric", Generated: true},
+	}}
+
+	schema, err := psql.NewDBSchema(psql.NewDBInfo(120000, tables, columns, nil, nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := `mutation { orders(insert: $data) { id total } }`
+
+	vars := map[string]json.RawMessage{
+		"data": json.RawMessage(`{"id": 5, "price": 5.50, "quantity": 2, "total": 100}`),
+	}
+
+	qc, err := qcompile.Compile([]byte(gql), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	co := psql.NewCompiler(psql.Config{Schema: schema})
+
+	_, sql, err := co.CompileEx(qc, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(sql), `INSERT INTO "orders" ("price", "quantity")`) {
+		t.Errorf("generated columns should not be inserted: %s", sql)
+	}
+
+	if !strings.Contains(string(sql), `"orders_0"."total" AS "total"`) {
+		t.Errorf("generated columns should be returned: %s", sql)
+	}
+}
@@ -0,0 +1,269 @@
+package psql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// initJSONSels finds the selections of keys in json columns (eg. `metadata {
+// plan limits { api_calls } }`). A selection is a json path when it's not a
+// related table of its parent but a json or jsonb column of it, and so are all
+// the selections under it
+func (c *compilerContext) initJSONSels() error {
+	for i := range c.s {
+		sel := &c.s[i]
+
+		if sel.ParentID == -1 || sel.SkipRender != qcode.SkipTypeNone ||
+			sel.Type != qcode.STNone {
+			continue
+		}
+
+		if _, ok := c.jsels[sel.ParentID]; ok {
+			c.addJSONSel(sel)
+			continue
+		}
+
+		parent := &c.s[sel.ParentID]
+
+		if _, err := c.schema.GetRel(sel.Name, parent.Name); err == nil {
+			continue
+		}
+
+		pti, err := c.schema.GetTableInfo(parent.Name)
+		if err != nil {
+			continue
+		}
+
+		col, ok := pti.colMap[sel.Name]
+		if !ok || (col.Type != "json" && col.Type != "jsonb") {
+			continue
+		}
+
+		if err := ColumnAccess(pti, parent, sel.Name, true); err != nil {
+			return err
+		}
+		c.addJSONSel(sel)
+	}
+
+	return nil
+}
+
+func (c *compilerContext) addJSONSel(sel *qcode.Select) {
+	if c.jsels == nil {
+		c.jsels = make(map[int32]struct{})
+	}
+	c.jsels[sel.ID] = struct{}{}
+}
+
+func (c *compilerContext) isJSONSel(id int32) bool {
+	_, ok := c.jsels[id]
+	return ok
+}
+
+// jsonPath returns the column and the keys of a json path selection
+func (c *compilerContext) jsonPath(sel *qcode.Select) (string, []string) {
+	var keys []string
+
+	for c.isJSONSel(sel.ParentID) {
+		keys = append([]string{sel.Name}, keys...)
+		sel = &c.s[sel.ParentID]
+	}
+
+	return sel.Name, keys
+}
+
+// renderJSONSel renders a json path selection as an object built from the
+// keys selected, it's null unless the value at the path is an object
+func (c *compilerContext) renderJSONSel(sel *qcode.Select, ti *DBTableInfo, parentID int32) {
+	cn, keys := c.jsonPath(sel)
+
+	io.WriteString(c.w, `(CASE WHEN jsonb_typeof(`)
+	c.renderJSONKeys(ti, parentID, cn, keys, false)
+	io.WriteString(c.w, `) = 'object' THEN jsonb_build_object(`)
+
+	i := 0
+
+	for _, col := range sel.Cols {
+		if i != 0 {
+			io.WriteString(c.w, `, `)
+		}
+		squoted(c.w, col.FieldName)
+		io.WriteString(c.w, `, `)
+		c.renderJSONKeys(ti, parentID, cn, append(keys[:len(keys):len(keys)], col.Name), false)
+		i++
+	}
+
+	for _, id := range sel.Children {
+		child := &c.s[id]
+
+		if i != 0 {
+			io.WriteString(c.w, `, `)
+		}
+		squoted(c.w, child.FieldName)
+		io.WriteString(c.w, `, `)
+		c.renderJSONSel(child, ti, parentID)
+		i++
+	}
+
+	io.WriteString(c.w, `) END)`)
+}
+
+// renderJSONKeys renders the value at the keys of the json column as jsonb
+// or as text when asText is set
+func (c *compilerContext) renderJSONKeys(ti *DBTableInfo, id int32, cn string, keys []string, asText bool) {
+	io.WriteString(c.w, `(`)
+	colWithTableID(c.w, ti.Name, id, cn)
+	io.WriteString(c.w, ` :: jsonb)`)
+
+	for i, k := range keys {
+		if asText && i == len(keys)-1 {
+			io.WriteString(c.w, ` ->> `)
+		} else {
+			io.WriteString(c.w, ` -> `)
+		}
+		squoted(c.w, k)
+	}
+}
+
+// jsonExpCol returns the json column of an expression on a key in it
+// (eg. `where: { metadata: { plan: { eq: "pro" } } }`)
+func (c *compilerContext) jsonExpCol(ex *qcode.Exp, ti *DBTableInfo) (*DBColumn, bool) {
+	if len(ex.NestedCols) < 2 {
+		return nil, false
+	}
+
+	if _, err := c.schema.GetRel(ex.NestedCols[0], ti.Name); err == nil {
+		return nil, false
+	}
+
+	col, ok := ti.colMap[ex.NestedCols[0]]
+	if !ok || (col.Type != "json" && col.Type != "jsonb") {
+		return nil, false
+	}
+	return col, true
+}
+
+// renderJSONOp renders an expression on a key in a json column. An equals with
+// a value is a containment check (@>) that can use an index on the column,
+// the other operators compare the text of the value cast to the type of the
+// value (numeric for numbers and boolean for booleans)
+func (c *compilerContext) renderJSONOp(ex *qcode.Exp, ti *DBTableInfo, col *DBColumn) error {
+	keys := ex.NestedCols[1:]
+
+	switch ex.Op {
+	case qcode.OpEquals:
+		if ex.Type == qcode.ValVar {
+			break
+		}
+
+		v, err := jsonContains(keys, ex)
+		if err != nil {
+			return err
+		}
+
+		io.WriteString(c.w, `((`)
+		c.renderJSONKeys(ti, -1, col.Name, nil, false)
+		io.WriteString(c.w, `) @> `)
+		squoted(c.w, strings.Replace(v, `'`, `''`, -1))
+		io.WriteString(c.w, ` :: jsonb)`)
+		return nil
+
+	case qcode.OpIsNull:
+		io.WriteString(c.w, `((`)
+		c.renderJSONKeys(ti, -1, col.Name, keys, false)
+		if strings.EqualFold(ex.Val, "true") {
+			io.WriteString(c.w, `) IS NULL)`)
+		} else {
+			io.WriteString(c.w, `) IS NOT NULL)`)
+		}
+		return nil
+
+	case qcode.OpContains, qcode.OpContainedIn:
+		// the value is json
+		vc := &DBColumn{Name: col.Name, Type: "jsonb"}
+
+		io.WriteString(c.w, `((`)
+		c.renderJSONKeys(ti, -1, col.Name, keys, false)
+		if ex.Op == qcode.OpContains {
+			io.WriteString(c.w, `) @>`)
+		} else {
+			io.WriteString(c.w, `) <@`)
+		}
+		c.renderVal(ex, c.vars, vc)
+		io.WriteString(c.w, `)`)
+		return nil
+
+	case qcode.OpHasKey:
+		vc := &DBColumn{Name: col.Name, Type: "text"}
+
+		io.WriteString(c.w, `((`)
+		c.renderJSONKeys(ti, -1, col.Name, keys, false)
+		io.WriteString(c.w, `) ?`)
+		c.renderVal(ex, c.vars, vc)
+		io.WriteString(c.w, `)`)
+		return nil
+
+	case qcode.OpHasKeyAny, qcode.OpHasKeyAll, qcode.OpTsQuery, qcode.OpEqID:
+		return fmt.Errorf("where clause: %s: operator not supported on json keys",
+			strings.Join(ex.NestedCols, "."))
+	}
+
+	vt := "text"
+
+	switch {
+	case ex.Type == qcode.ValNum, ex.Type == qcode.ValList && ex.ListType == qcode.ValNum:
+		vt = "numeric"
+	case ex.Type == qcode.ValBool, ex.Type == qcode.ValList && ex.ListType == qcode.ValBool:
+		vt = "boolean"
+	case ex.Type == qcode.ValVar:
+		// a variable is a number when compared by order
+		switch ex.Op {
+		case qcode.OpGreaterThan, qcode.OpLesserThan,
+			qcode.OpGreaterOrEquals, qcode.OpLesserOrEquals:
+			vt = "numeric"
+		}
+	}
+
+	io.WriteString(c.w, `(((`)
+	c.renderJSONKeys(ti, -1, col.Name, keys, true)
+	io.WriteString(c.w, `) :: `)
+	io.WriteString(c.w, vt)
+	io.WriteString(c.w, `) `)
+
+	return c.renderOpVal(ex, &DBColumn{Name: col.Name, Type: vt})
+}
+
+// jsonContains returns the json object with the value at the keys
+// (eg. `{"limits": {"api_calls": 100}}`)
+func jsonContains(keys []string, ex *qcode.Exp) (string, error) {
+	var v interface{}
+
+	switch ex.Type {
+	case qcode.ValStr:
+		v = ex.Val
+	case qcode.ValNum:
+		if _, err := strconv.ParseFloat(ex.Val, 64); err != nil {
+			return "", fmt.Errorf("where clause: invalid number: %s", ex.Val)
+		}
+		v = json.RawMessage(ex.Val)
+	case qcode.ValBool:
+		v = json.RawMessage(strconv.FormatBool(strings.EqualFold(ex.Val, "true")))
+	default:
+		return "", fmt.Errorf("where clause: %s: invalid value", strings.Join(ex.NestedCols, "."))
+	}
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		v = map[string]interface{}{keys[i]: v}
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
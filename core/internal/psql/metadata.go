@@ -4,37 +4,57 @@ import (
 	"io"
 )
 
+// RenderVar renders the value of a config variable replacing the variables
+// in it (eg. $user_id) with params. A '$' can be escaped with a backslash.
 func (md *Metadata) RenderVar(w io.Writer, vv string) {
 	f, s := -1, 0
 
-	for i := range vv {
+	for i := 0; i < len(vv); i++ {
 		v := vv[i]
-		switch {
-		case (i > 0 && vv[i-1] != '\\' && v == '$') || v == '$':
-			if (i - s) > 0 {
-				_, _ = io.WriteString(w, vv[s:i])
+
+		if f != -1 {
+			if isVarChar(v) {
+				continue
 			}
-			f = i
+			md.renderVarParam(w, vv[f:i])
+			s, f = i, -1
+		}
+
+		if v != '$' {
+			continue
+		}
 
-		case (v < 'a' && v > 'z') &&
-			(v < 'A' && v > 'Z') &&
-			(v < '0' && v > '9') &&
-			v != '_' &&
-			f != -1 &&
-			(i-f) > 1:
-			md.renderParam(w, Param{Name: vv[f+1 : i]})
+		if i > 0 && vv[i-1] == '\\' {
+			_, _ = io.WriteString(w, vv[s:(i-1)])
 			s = i
-			f = -1
+		} else {
+			_, _ = io.WriteString(w, vv[s:i])
+			f = i
 		}
 	}
 
-	if f != -1 && (len(vv)-f) > 1 {
-		md.renderParam(w, Param{Name: vv[f+1:]})
+	if f != -1 {
+		md.renderVarParam(w, vv[f:])
 	} else {
 		_, _ = io.WriteString(w, vv[s:])
 	}
 }
 
+func (md *Metadata) renderVarParam(w io.Writer, v string) {
+	if len(v) > 1 {
+		md.renderParam(w, Param{Name: v[1:]})
+	} else {
+		_, _ = io.WriteString(w, v)
+	}
+}
+
+func isVarChar(v byte) bool {
+	return (v >= 'a' && v <= 'z') ||
+		(v >= 'A' && v <= 'Z') ||
+		(v >= '0' && v <= '9') ||
+		v == '_'
+}
+
 func (md *Metadata) renderParam(w io.Writer, p Param) {
 	var id int
 	var ok bool
@@ -43,6 +63,7 @@ func (md *Metadata) renderParam(w io.Writer, p Param) {
 		_, _ = io.WriteString(w, `$`)
 	}
 
+	// the same variable is always bound to a single param
 	if id, ok = md.pindex[p.Name]; !ok {
 		md.params = append(md.params, p)
 		id = len(md.params)
@@ -51,6 +72,10 @@ func (md *Metadata) renderParam(w io.Writer, p Param) {
 			md.pindex = make(map[string]int)
 		}
 		md.pindex[p.Name] = id
+
+	} else if md.params[id-1].Type == "" {
+		md.params[id-1].Type = p.Type
+		md.params[id-1].IsArray = p.IsArray
 	}
 
 	if md.Poll {
@@ -69,6 +94,25 @@ func (md Metadata) Remotes() int {
 	return md.remoteCount
 }
 
+// Skipped returns true when every root selection was removed by a
+// @skip or @include directive and there is nothing to query.
+func (md Metadata) Skipped() bool {
+	return md.skipped
+}
+
+// HasDirectiveVars returns true when the query has @skip or @include
+// directives that depend on the value of a variable.
+func (md Metadata) HasDirectiveVars() bool {
+	return md.dirVars
+}
+
+// Warnings returns the issues found while compiling the query
+// that did not stop it from being compiled (eg. unknown fields
+// dropped in lenient mode)
+func (md Metadata) Warnings() []string {
+	return md.warnings
+}
+
 func (md Metadata) Params() []Param {
 	return md.params
 }
@@ -0,0 +1,27 @@
+package psql_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestRenderVar(t *testing.T) {
+	var w bytes.Buffer
+	md := psql.Metadata{}
+
+	md.RenderVar(&w, `select id from users where id = $user_id and org = $org_id or owner = $user_id and price > \$5`)
+
+	exp := `select id from users where id = $1 and org = $2 or owner = $1 and price > $5`
+
+	if w.String() != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, w.String())
+	}
+
+	params := md.Params()
+
+	if len(params) != 2 || params[0].Name != "user_id" || params[1].Name != "org_id" {
+		t.Fatalf("unexpected params: %v", params)
+	}
+}
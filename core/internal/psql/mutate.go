@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 
 	"github.com/dosco/super-graph/core/internal/qcode"
@@ -34,6 +35,11 @@ var updateTypes = map[string]itemType{
 
 var noLimit = qcode.Paging{NoLimit: true}
 
+const (
+	createdAtCol = "created_at"
+	updatedAtCol = "updated_at"
+)
+
 func (co *Compiler) compileMutation(w io.Writer, qc *qcode.QCode, vars Variables) (Metadata, error) {
 	md := Metadata{}
 
@@ -41,37 +47,63 @@ func (co *Compiler) compileMutation(w io.Writer, qc *qcode.QCode, vars Variables
 		return md, errors.New("empty query")
 	}
 
-	c := &compilerContext{md, w, qc.Selects, co}
-	root := &qc.Selects[0]
+	c := &compilerContext{md: md, w: w, s: qc.Selects, schema: co.Schema(),
+		joins: co.loadJoins(), Compiler: co}
 
-	ti, err := c.schema.GetTableInfoB(root.Name)
+	ms, err := c.orderMutations(qc, vars)
 	if err != nil {
 		return c.md, err
 	}
 
-	switch qc.Type {
-	case qcode.QTInsert:
-		if _, err := c.renderInsert(w, qc, vars, ti, false); err != nil {
+	for i := range ms {
+		c.mi = i
+		c.refs = ms[i].refs
+
+		if err := c.renderMutation(w, qc, vars, ms[i]); err != nil {
 			return c.md, err
 		}
+	}
+
+	return co.compileQueryWithMetadata(w, qc, vars, c.md)
+}
+
+type mutation struct {
+	qcode.Mutation
+	ti   *DBTableInfo
+	refs []*DBRel
+}
+
+func (c *compilerContext) renderMutation(w io.Writer, qc *qcode.QCode, vars Variables, m mutation) error {
+	var err error
+	root := &qc.Selects[m.SelID]
+
+	// the mutation is rendered using a view of the query
+	// that starts at its root
+	mqc := &qcode.QCode{
+		Type:      m.Type,
+		ActionVar: m.ActionVar,
+		Selects:   qc.Selects[m.SelID:],
+	}
+
+	switch m.Type {
+	case qcode.QTInsert:
+		_, err = c.renderInsert(w, mqc, vars, m.ti, false)
 
 	case qcode.QTUpdate:
-		if _, err := c.renderUpdate(w, qc, vars, ti); err != nil {
-			return c.md, err
-		}
+		_, err = c.renderUpdate(w, mqc, vars, m.ti)
 
 	case qcode.QTUpsert:
-		if _, err := c.renderUpsert(w, qc, vars, ti); err != nil {
-			return c.md, err
-		}
+		_, err = c.renderUpsert(w, mqc, vars, m.ti)
 
 	case qcode.QTDelete:
-		if _, err := c.renderDelete(w, qc, vars, ti); err != nil {
-			return c.md, err
-		}
+		_, err = c.renderDelete(w, mqc, vars, m.ti)
 
 	default:
-		return c.md, errors.New("valid mutations are 'insert', 'update', 'upsert' and 'delete'")
+		err = errors.New("valid mutations are 'insert', 'update', 'upsert' and 'delete'")
+	}
+
+	if err != nil {
+		return err
 	}
 
 	root.Paging = noLimit
@@ -80,7 +112,181 @@ func (co *Compiler) compileMutation(w io.Writer, qc *qcode.QCode, vars Variables
 	root.Where = nil
 	root.Args = nil
 
-	return co.compileQueryWithMetadata(w, qc, vars, c.md)
+	return nil
+}
+
+// orderMutations returns the mutations in the order they must be rendered.
+// An insert into a table with a foreign key to a table inserted into by
+// another mutation of the same request comes after it. If the insert doesn't
+// set the foreign key itself it's set to the id returned by the other one.
+// Eg. a user and a product owned by the user can be created together.
+func (c *compilerContext) orderMutations(qc *qcode.QCode, vars Variables) ([]mutation, error) {
+	ms := make([]mutation, len(qc.Mutations))
+	tables := make(map[string]struct{}, len(ms))
+
+	for i, m := range qc.Mutations {
+		ti, err := c.schema.GetTableInfoB(qc.Selects[m.SelID].Name)
+		if err != nil {
+			return nil, err
+		}
+
+		// the results of a mutation are read from a cte named after its
+		// table so there can only be one per table
+		if _, ok := tables[ti.Name]; ok {
+			return nil, fmt.Errorf("table '%s' can only be mutated once per request", ti.Name)
+		}
+		tables[ti.Name] = struct{}{}
+
+		ms[i] = mutation{Mutation: m, ti: ti}
+	}
+
+	if len(ms) == 1 {
+		return ms, nil
+	}
+
+	// deps are the mutations each one has to come after
+	deps := make([][]int, len(ms))
+
+	for i := range ms {
+		if !isInsert(ms[i].Type) {
+			continue
+		}
+
+		for j := range ms {
+			if i == j || !isInsert(ms[j].Type) {
+				continue
+			}
+
+			rel := c.fkeyRel(ms[i].ti, ms[j].ti)
+			if rel == nil {
+				continue
+			}
+
+			// a bulk insert returns more than one row
+			// so it can't be used to set the key
+			if v := vars[ms[j].ActionVar]; len(v) == 0 || v[0] != '{' {
+				continue
+			}
+
+			set, err := inputHasKey(vars[ms[i].ActionVar], rel.Right.col.Key)
+			if err != nil {
+				return nil, err
+			}
+
+			if !set {
+				ms[i].refs = append(ms[i].refs, rel)
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+
+	// mutations are kept in query order unless they have
+	// to wait for the one they depend on
+	list := make([]mutation, 0, len(ms))
+	done := make([]bool, len(ms))
+
+	for len(list) != len(ms) {
+		n := len(list)
+
+		for i := range ms {
+			if done[i] || !allDone(deps[i], done) {
+				continue
+			}
+			done[i] = true
+			list = append(list, ms[i])
+			break
+		}
+
+		if len(list) == n {
+			return nil, errors.New("mutations have a circular dependency on each other")
+		}
+	}
+
+	return list, nil
+}
+
+// fkeyRel returns the relationship from the parent table to the
+// foreign key column of the child table that references it
+func (c *compilerContext) fkeyRel(child, parent *DBTableInfo) *DBRel {
+	rel, err := c.schema.GetRel(parent.Name, child.Name)
+	if err != nil {
+		return nil
+	}
+
+	if rel.Type != RelOneToOne && rel.Type != RelOneToMany {
+		return nil
+	}
+
+	if rel.Right.col == nil || rel.Right.Table != child.Name ||
+		rel.Right.col.FKeyTable != parent.Name {
+		return nil
+	}
+
+	return rel
+}
+
+func isInsert(qt qcode.QType) bool {
+	return qt == qcode.QTInsert || qt == qcode.QTUpsert
+}
+
+func allDone(list []int, done []bool) bool {
+	for _, i := range list {
+		if !done[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// inputHasKey returns true if the object or any of the objects
+// in the list has the key
+func inputHasKey(v json.RawMessage, key string) (bool, error) {
+	if len(v) == 0 {
+		return false, nil
+	}
+
+	if v[0] != '[' {
+		data, _, err := jsn.Tree(v)
+		if err != nil {
+			return false, err
+		}
+		_, ok := data[key]
+		return ok, nil
+	}
+
+	var list []map[string]json.RawMessage
+
+	if err := json.Unmarshal(v, &list); err != nil {
+		return false, err
+	}
+
+	for i := range list {
+		if _, ok := list[i][key]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// renderWith starts the WITH clause for the first
+// mutation and continues it for the rest
+func (c *compilerContext) renderWith() {
+	if c.mi == 0 {
+		io.WriteString(c.w, `WITH `)
+	} else {
+		io.WriteString(c.w, `, `)
+	}
+}
+
+// renderInputName renders the name of the cte holding
+// the json input of the mutation
+func (c *compilerContext) renderInputName() {
+	io.WriteString(c.w, `"_sg_input`)
+	if c.mi != 0 {
+		io.WriteString(c.w, `_`)
+		int32String(c.w, int32(c.mi))
+	}
+	io.WriteString(c.w, `"`)
 }
 
 type kvitem struct {
@@ -95,6 +301,7 @@ type kvitem struct {
 	ti     *DBTableInfo
 	relCP  *DBRel
 	relPC  *DBRel
+	refs   []*DBRel
 	items  []kvitem
 }
 
@@ -126,7 +333,10 @@ func (c *compilerContext) handleKVItem(st *util.Stack, item kvitem) error {
 
 	item.items = make([]kvitem, 0, len(data))
 
-	for k, v := range data {
+	// sorted keys keep the generated sql and the order
+	// of its params the same for every request
+	for _, k := range sortedKeys(data) {
+		v := data[k]
 		if v[0] != '{' && v[0] != '[' {
 			continue
 		}
@@ -272,7 +482,10 @@ func (c *compilerContext) renderUnionStmt(w io.Writer, item renitem) error {
 			quoted(w, item.ti.Name)
 		}
 		io.WriteString(w, ` AS ( UPDATE `)
-		quoted(w, item.ti.Name)
+		c.renderTableAs(w, item.ti.Name)
+		if !(connect && disconnect) {
+			c.addCteName(item.ti.Name)
+		}
 		io.WriteString(w, ` SET `)
 		quoted(w, item.relPC.Right.Col)
 		io.WriteString(w, ` = `)
@@ -282,7 +495,7 @@ func (c *compilerContext) renderUnionStmt(w io.Writer, item renitem) error {
 		colWithTable(w, item.relPC.Left.Table, item.relPC.Left.Col)
 
 		io.WriteString(w, ` FROM `)
-		quoted(w, item.relPC.Left.Table)
+		c.renderTable(w, item.relPC.Left.Table)
 		io.WriteString(w, ` WHERE`)
 
 		i := 0
@@ -313,7 +526,10 @@ func (c *compilerContext) renderUnionStmt(w io.Writer, item renitem) error {
 			quoted(w, item.ti.Name)
 		}
 		io.WriteString(w, ` AS ( UPDATE `)
-		quoted(w, item.ti.Name)
+		c.renderTableAs(w, item.ti.Name)
+		if !(connect && disconnect) {
+			c.addCteName(item.ti.Name)
+		}
 		io.WriteString(w, ` SET `)
 		quoted(w, item.relPC.Right.Col)
 		io.WriteString(w, ` = `)
@@ -330,7 +546,7 @@ func (c *compilerContext) renderUnionStmt(w io.Writer, item renitem) error {
 		}
 
 		io.WriteString(w, ` FROM `)
-		quoted(w, item.relPC.Left.Table)
+		c.renderTable(w, item.relPC.Left.Table)
 		io.WriteString(w, ` WHERE`)
 
 		i := 0
@@ -389,9 +605,16 @@ func (c *compilerContext) renderInsertUpdateColumns(
 		if cn.Blocked {
 			return false, fmt.Errorf("insert: column '%s' blocked", cn.Name)
 		}
+		// the values of generated columns are set by the database
+		if cn.ReadOnly() {
+			continue
+		}
 		if _, ok := root.PresetMap[cn.Key]; ok {
 			continue
 		}
+		if c.isTimestampCol(ti, cn.Name) {
+			continue
+		}
 		if err := ColumnAccess(ti, root, cn.Name, true); err != nil {
 			return false, err
 		}
@@ -399,14 +622,25 @@ func (c *compilerContext) renderInsertUpdateColumns(
 			io.WriteString(c.w, `, `)
 		}
 
-		if isValues {
+		switch {
+		case isValues && GeoType(cn.Type) != "":
+			// geometries are set as GeoJSON
+			io.WriteString(c.w, `CAST(ST_GeomFromGeoJSON(i.j ->>`)
+			io.WriteString(c.w, `'`)
+			io.WriteString(c.w, cn.Name)
+			io.WriteString(c.w, `') AS `)
+			io.WriteString(c.w, cn.Type)
+			io.WriteString(c.w, `)`)
+
+		case isValues:
 			io.WriteString(c.w, `CAST( i.j ->>`)
 			io.WriteString(c.w, `'`)
 			io.WriteString(c.w, cn.Name)
 			io.WriteString(c.w, `' AS `)
 			io.WriteString(c.w, cn.Type)
 			io.WriteString(c.w, `)`)
-		} else {
+
+		default:
 			quoted(c.w, cn.Name)
 		}
 
@@ -465,9 +699,57 @@ func (c *compilerContext) renderInsertUpdateColumns(
 		renderedCols = true
 	}
 
+	for _, tc := range c.timestampCols(qc, ti) {
+		if _, ok := skipcols[tc]; ok {
+			continue
+		}
+		if _, ok := root.PresetMap[tc]; ok {
+			continue
+		}
+		if renderedCols {
+			io.WriteString(c.w, `, `)
+		}
+
+		if isValues {
+			io.WriteString(c.w, `now()`)
+		} else {
+			quoted(c.w, tc)
+		}
+		renderedCols = true
+	}
+
 	return renderedCols, nil
 }
 
+// timestampCols returns the created_at and updated_at columns of the table
+// if it's config to have them set automatically. Only updated_at is set on
+// update.
+func (c *compilerContext) timestampCols(qc *qcode.QCode, ti *DBTableInfo) []string {
+	if _, ok := c.ts[ti.Name]; !ok {
+		return nil
+	}
+	cols := make([]string, 0, 2)
+
+	if qc.Type != qcode.QTUpdate && ti.ColumnExists(createdAtCol) {
+		cols = append(cols, createdAtCol)
+	}
+
+	if ti.ColumnExists(updatedAtCol) {
+		cols = append(cols, updatedAtCol)
+	}
+
+	return cols
+}
+
+// isTimestampCol returns true for the created_at and updated_at columns of tables that
+// have them set automatically, values for them in the mutation data are ignored
+func (c *compilerContext) isTimestampCol(ti *DBTableInfo, name string) bool {
+	if _, ok := c.ts[ti.Name]; ok {
+		return name == createdAtCol || name == updatedAtCol
+	}
+	return false
+}
+
 func (c *compilerContext) renderUpsert(
 	w io.Writer, qc *qcode.QCode, vars Variables, ti *DBTableInfo) (uint32, error) {
 
@@ -528,6 +810,9 @@ func (c *compilerContext) renderUpsert(
 		if cn.Blocked {
 			return 0, fmt.Errorf("upsert: column '%s' blocked", cn.Name)
 		}
+		if c.isTimestampCol(ti, cn.Name) || cn.ReadOnly() {
+			continue
+		}
 		if i != 0 {
 			io.WriteString(c.w, `, `)
 		}
@@ -537,6 +822,16 @@ func (c *compilerContext) renderUpsert(
 		i++
 	}
 
+	// the row keeps its created_at value when it's updated
+	if _, ok := c.ts[ti.Name]; ok && ti.ColumnExists(updatedAtCol) {
+		if i != 0 {
+			io.WriteString(c.w, `, `)
+		}
+		quoted(c.w, updatedAtCol)
+		io.WriteString(c.w, ` = EXCLUDED.`)
+		quoted(c.w, updatedAtCol)
+	}
+
 	if root.Where != nil {
 		io.WriteString(c.w, ` WHERE `)
 
@@ -582,8 +877,10 @@ func (c *compilerContext) renderConnectStmt(qc *qcode.QCode, w io.Writer,
 
 	}
 
-	io.WriteString(c.w, ` FROM "_sg_input" i,`)
-	quoted(c.w, item.ti.Name)
+	io.WriteString(c.w, ` FROM `)
+	c.renderInputName()
+	io.WriteString(c.w, ` i,`)
+	c.renderTable(c.w, item.ti.Name)
 
 	io.WriteString(c.w, ` WHERE `)
 	if err := renderWhereFromJSON(c.w, item.kvitem, "connect", item.kvitem.val); err != nil {
@@ -613,8 +910,10 @@ func (c *compilerContext) renderDisconnectStmt(qc *qcode.QCode, w io.Writer,
 	if rel.Right.Array {
 		io.WriteString(c.w, `SELECT `)
 		quoted(w, rel.Right.Col)
-		io.WriteString(c.w, ` FROM "_sg_input" i,`)
-		quoted(c.w, item.ti.Name)
+		io.WriteString(c.w, ` FROM `)
+		c.renderInputName()
+		io.WriteString(c.w, ` i,`)
+		c.renderTable(c.w, item.ti.Name)
 		io.WriteString(c.w, ` WHERE `)
 		if err := renderWhereFromJSON(c.w, item.kvitem, "connect", item.kvitem.val); err != nil {
 			return err
@@ -640,7 +939,8 @@ func renderWhereFromJSON(w io.Writer, item kvitem, key string, val []byte) error
 		return err
 	}
 	i := 0
-	for k, v := range kv {
+	for _, k := range sortedKeys(kv) {
+		v := kv[k]
 		col, err := ti.GetColumn(k)
 		if err != nil {
 			return err
@@ -701,7 +1001,7 @@ func renderPathJSON(w io.Writer, item kvitem, key1, key2 string) {
 
 func renderCteName(w io.Writer, item kvitem) error {
 	io.WriteString(w, `"`)
-	io.WriteString(w, item.ti.Name)
+	escapeIdent(w, item.ti.Name)
 	if item._type == itemConnect || item._type == itemDisconnect {
 		io.WriteString(w, `_`)
 		int32String(w, item.id)
@@ -712,7 +1012,7 @@ func renderCteName(w io.Writer, item kvitem) error {
 
 func renderCteNameWithSuffix(w io.Writer, item kvitem, suffix string) error {
 	io.WriteString(w, `"`)
-	io.WriteString(w, item.ti.Name)
+	escapeIdent(w, item.ti.Name)
 	io.WriteString(w, `_`)
 	io.WriteString(w, suffix)
 	io.WriteString(w, `"`)
@@ -729,3 +1029,12 @@ func joinPath(w io.Writer, path []string) {
 		io.WriteString(w, `'`)
 	}
 }
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,6 +2,7 @@ package psql_test
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -121,3 +122,108 @@ func TestCompileMutate(t *testing.T) {
 	// t.Run("blockedInsert", blockedInsert)
 	// t.Run("blockedUpdate", blockedUpdate)
 }
+
+func TestCompileMultiRootMutation(t *testing.T) {
+	// the product is listed first but needs the id of the user
+	gql := `mutation {
+		product(insert: $product) {
+			id
+		}
+		user(insert: $user) {
+			id
+		}
+	}`
+
+	vars := map[string]json.RawMessage{
+		"user":    json.RawMessage(`{"email": "a@b.com", "full_name": "A B"}`),
+		"product": json.RawMessage(`{"name": "Apple", "price": 1.25}`),
+	}
+
+	qc, err := qcompile.Compile([]byte(gql), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sql, err := pcompile.CompileEx(qc, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		`WITH "_sg_input" AS (SELECT $1 :: json AS j), "users" AS (INSERT INTO "users"`,
+		`, "_sg_input_1" AS (SELECT $2 :: json AS j), "products" AS (INSERT INTO "products"`,
+		`"users"."id" FROM "_sg_input_1" i, "users" RETURNING *)`,
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(string(sql), v) {
+			t.Fatalf("expected '%s' in:\n%s", v, sql)
+		}
+	}
+
+	// a foreign key set in the input is left alone
+	vars["product"] = json.RawMessage(`{"name": "Apple", "price": 1.25, "user_id": 5}`)
+
+	qc, err = qcompile.Compile([]byte(gql), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sql, err = pcompile.CompileEx(qc, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(sql), `WITH "_sg_input" AS (SELECT $1 :: json AS j), "products"`) {
+		t.Fatalf("expected the product to be inserted first:\n%s", sql)
+	}
+
+	if strings.Contains(string(sql), `"users"."id" FROM "_sg_input`) {
+		t.Fatalf("expected the user_id from the input:\n%s", sql)
+	}
+
+	// a table can only be mutated once
+	gql = `mutation {
+		a: user(insert: $user) { id }
+		b: user(insert: $user) { id }
+	}`
+
+	compileGQLToPSQLExpectErr(t, gql, vars, "admin")
+}
+
+func TestCompileClientMutationID(t *testing.T) {
+	gql := `mutation {
+		product(insert: $data) {
+			id
+			clientMutationId
+		}
+	}`
+
+	vars := map[string]json.RawMessage{
+		"data": json.RawMessage(`{"clientMutationId": "abc", "name": "Apple", "price": 1.25}`),
+	}
+
+	qc, err := qcompile.Compile([]byte(gql), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md, sql, err := pcompile.CompileEx(qc, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `SELECT "products_0"."id" AS "id", ($1 :: json ->> 'clientMutationId') AS "clientMutationId" FROM`
+
+	if !strings.Contains(string(sql), exp) {
+		t.Fatalf("expected '%s' in:\n%s", exp, sql)
+	}
+
+	if strings.Contains(string(sql), `INSERT INTO "products" ("clientMutationId"`) {
+		t.Fatalf("clientMutationId should not be inserted:\n%s", sql)
+	}
+
+	if n := len(md.Params()); n != 1 {
+		t.Fatalf("expected 1 param got %d", n)
+	}
+}
@@ -0,0 +1,652 @@
+package psql
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// mysqlDialect renders queries for MySQL, the selections are joined with
+// lateral derived tables (8.0.14) and lists filtered with MEMBER OF (8.0.17)
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect) QuoteIdent(ident string) string {
+	return "`" + strings.Replace(ident, "`", "``", -1) + "`"
+}
+
+func (mysqlDialect) compileMutation(co *Compiler, w io.Writer, qc *qcode.QCode, vars Variables) (Metadata, error) {
+	return Metadata{}, errMySQL("mutations")
+}
+
+func errMySQL(feature string) error {
+	return fmt.Errorf("mysql: %s not supported", feature)
+}
+
+// renderQuery renders the query as a single json object with a key for each
+// root selection the same as Postgres, only the sql functions differ
+func (mysqlDialect) renderQuery(c *compilerContext, qc *qcode.QCode, vars Variables) error {
+	if c.md.Stream {
+		return errMySQL("streaming")
+	}
+
+	if c.md.Poll {
+		return errMySQL("subscriptions")
+	}
+
+	rens := make([]int32, 0, len(qc.Roots))
+	i := 0
+
+	io.WriteString(c.w, `SELECT JSON_OBJECT(`)
+	for _, id := range qc.Roots {
+		sel := &qc.Selects[id]
+
+		if sel.SkipRender == qcode.SkipTypeDirective {
+			continue
+		}
+
+		if i != 0 {
+			io.WriteString(c.w, `, `)
+		}
+		c.mySquoted(sel.FieldName)
+		io.WriteString(c.w, `, `)
+
+		if sel.SkipRender == qcode.SkipTypeRemote {
+			c.md.remoteCount++
+		}
+
+		if sel.SkipRender != qcode.SkipTypeNone ||
+			(len(sel.Cols) == 0 && len(sel.Children) == 0) {
+			io.WriteString(c.w, `NULL`)
+		} else {
+			c.myColWithTableID("__sj", sel.ID, "json")
+			rens = append(rens, sel.ID)
+		}
+		i++
+	}
+
+	io.WriteString(c.w, `) AS `)
+	c.myQuoted("__root")
+	io.WriteString(c.w, ` FROM (SELECT 1) AS `)
+	c.myQuoted("__root_x")
+	c.md.skipped = (i == 0)
+
+	for _, id := range rens {
+		if err := c.myRenderSelect(&qc.Selects[id]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// myRenderSelect renders a selection as a lateral derived table with the
+// json of its rows, the children are joined the same way to its rows
+func (c *compilerContext) myRenderSelect(sel *qcode.Select) error {
+	ti, err := c.schema.GetTableInfoB(sel.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := c.myCheckSelect(sel, ti); err != nil {
+		return err
+	}
+
+	var rel *DBRel
+
+	if sel.ParentID != -1 {
+		if rel, err = c.schema.GetRel(sel.Name, c.s[sel.ParentID].Name); err != nil {
+			return err
+		}
+
+		switch {
+		case rel.Type != RelOneToOne && rel.Type != RelOneToMany &&
+			rel.Type != RelOneToManyThrough:
+			return errMySQL(fmt.Sprintf("relationship %s", rel))
+		case rel.Left.Array || rel.Right.Array:
+			return errMySQL("array columns")
+		}
+	}
+
+	children := make([]*qcode.Select, 0, len(sel.Children))
+
+	for _, cid := range sel.Children {
+		child := &c.s[cid]
+
+		if child.SkipRender == qcode.SkipTypeRemote {
+			c.md.remoteCount++
+			continue
+		}
+
+		if c.isJSONSel(cid) {
+			return errMySQL("selecting keys of json columns")
+		}
+
+		if child.SkipRender != qcode.SkipTypeNone ||
+			(len(child.Cols) == 0 && len(child.Children) == 0) {
+			continue
+		}
+		children = append(children, child)
+	}
+
+	plural := !ti.IsSingular
+
+	io.WriteString(c.w, ` LEFT OUTER JOIN LATERAL (`)
+
+	if plural {
+		io.WriteString(c.w, `SELECT COALESCE(JSON_ARRAYAGG(`)
+		c.myColWithTableID("__sr", sel.ID, "json")
+		io.WriteString(c.w, `), JSON_ARRAY()) AS `)
+		c.myQuoted("json")
+		io.WriteString(c.w, ` FROM (`)
+	}
+
+	io.WriteString(c.w, `SELECT JSON_OBJECT(`)
+
+	i := 0
+	for _, col := range sel.Cols {
+		if i != 0 {
+			io.WriteString(c.w, `, `)
+		}
+		c.mySquoted(col.FieldName)
+		io.WriteString(c.w, `, `)
+
+		if col.Name == "__typename" {
+			c.mySquoted(ti.Name)
+		} else {
+			c.myColWithTableID(ti.Name, sel.ID, col.Name)
+		}
+		i++
+	}
+
+	for _, child := range children {
+		if i != 0 {
+			io.WriteString(c.w, `, `)
+		}
+		c.mySquoted(child.FieldName)
+		io.WriteString(c.w, `, `)
+		c.myColWithTableID("__sj", child.ID, "json")
+		i++
+	}
+
+	io.WriteString(c.w, `) AS `)
+	c.myQuoted("json")
+	io.WriteString(c.w, ` FROM (`)
+
+	if err := c.myRenderBaseSelect(sel, ti, rel, children); err != nil {
+		return err
+	}
+
+	io.WriteString(c.w, `) AS `)
+	c.myQuotedID(ti.Name, sel.ID)
+
+	for _, child := range children {
+		if err := c.myRenderSelect(child); err != nil {
+			return err
+		}
+	}
+
+	if plural {
+		io.WriteString(c.w, `) AS `)
+		c.myQuotedID("__sr", sel.ID)
+	}
+
+	io.WriteString(c.w, `) AS `)
+	c.myQuotedID("__sj", sel.ID)
+	io.WriteString(c.w, ` ON true`)
+
+	return nil
+}
+
+// myCheckSelect returns an error for the arguments and columns of a
+// selection that need features of Postgres
+func (c *compilerContext) myCheckSelect(sel *qcode.Select, ti *DBTableInfo) error {
+	switch {
+	case sel.Type != qcode.STNone:
+		return errMySQL("unions")
+	case sel.Paging.Type != qcode.PtOffset || sel.Paging.Cursor:
+		return errMySQL("cursor pagination")
+	case len(sel.DistinctOn) != 0:
+		return errMySQL("distinct")
+	case len(sel.GroupBy) != 0:
+		return errMySQL("group_by")
+	case sel.Func != "":
+		return errMySQL("table functions")
+	case sel.Find != qcode.FindNone:
+		return errMySQL("recursive queries")
+	case sel.Args["search"] != nil:
+		return errMySQL("search")
+	}
+
+	for _, col := range sel.Cols {
+		if col.Name == "__typename" {
+			continue
+		}
+
+		dc, err := ti.GetColumnB(col.Name)
+		if err != nil {
+			if ti.ColumnExists(col.Name) {
+				return err
+			}
+			return errMySQL(fmt.Sprintf("column '%s'", col.Name))
+		}
+
+		if dc.Translated {
+			return errMySQL("translated columns")
+		}
+	}
+
+	return nil
+}
+
+func (c *compilerContext) myRenderBaseSelect(sel *qcode.Select, ti *DBTableInfo,
+	rel *DBRel, children []*qcode.Select) error {
+
+	cols := make([]string, 0, len(sel.Cols)+len(children))
+	colmap := make(map[string]struct{}, cap(cols))
+
+	addCol := func(cn string) {
+		if _, ok := colmap[cn]; !ok {
+			cols = append(cols, cn)
+			colmap[cn] = struct{}{}
+		}
+	}
+
+	for _, col := range sel.Cols {
+		if col.Name != "__typename" {
+			addCol(col.Name)
+		}
+	}
+
+	// the columns the children are joined with
+	for _, child := range children {
+		crel, err := c.schema.GetRel(child.Name, ti.Name)
+		if err != nil {
+			return err
+		}
+		addCol(crel.Right.Col)
+	}
+
+	io.WriteString(c.w, `SELECT `)
+
+	if len(cols) == 0 {
+		io.WriteString(c.w, `1`)
+	}
+
+	for i, cn := range cols {
+		if i != 0 {
+			io.WriteString(c.w, `, `)
+		}
+		dn := ti.ColumnName(cn)
+		c.myColWithTable(ti.Name, dn)
+
+		// a column with uppercase in it is selected as the key
+		if dn != cn {
+			io.WriteString(c.w, ` AS `)
+			c.myQuoted(cn)
+		}
+	}
+
+	io.WriteString(c.w, ` FROM `)
+	if sel.View != "" {
+		c.myQuoted(sel.View)
+		io.WriteString(c.w, ` AS `)
+	}
+	c.myQuoted(ti.Name)
+
+	if rel != nil && rel.Type == RelOneToManyThrough {
+		io.WriteString(c.w, ` LEFT OUTER JOIN `)
+		c.myQuoted(rel.Through.Table)
+		io.WriteString(c.w, ` ON ((`)
+		c.myColWithTable(rel.Through.Table, rel.Through.ColL)
+		io.WriteString(c.w, `) = (`)
+		c.myColWithTable(rel.Left.Table, rel.Left.Col)
+		io.WriteString(c.w, `))`)
+	}
+
+	isFil := (sel.Where != nil && sel.Where.Op != qcode.OpNop)
+
+	if rel != nil || isFil {
+		io.WriteString(c.w, ` WHERE (`)
+	}
+
+	if rel != nil {
+		pid := sel.ParentID
+
+		io.WriteString(c.w, `((`)
+		if rel.Type == RelOneToManyThrough {
+			c.myColWithTable(rel.Through.Table, rel.Through.ColR)
+		} else {
+			c.myColWithTable(rel.Left.Table, rel.Left.Col)
+		}
+		io.WriteString(c.w, `) = (`)
+		c.myColWithTableID(rel.Right.Table, pid, rel.Right.Col)
+		io.WriteString(c.w, `))`)
+
+		if isFil {
+			io.WriteString(c.w, ` AND `)
+		}
+	}
+
+	if isFil {
+		if err := c.myRenderExp(sel.Where, ti); err != nil {
+			return err
+		}
+	}
+
+	if rel != nil || isFil {
+		io.WriteString(c.w, `)`)
+	}
+
+	for i, ob := range sel.OrderBy {
+		if i == 0 {
+			io.WriteString(c.w, ` ORDER BY `)
+		} else {
+			io.WriteString(c.w, `, `)
+		}
+
+		if err := ColumnAccess(ti, sel, ob.Col, true); err != nil {
+			return err
+		}
+
+		if ob.Var != "" {
+			if err := orderVarAllowed(sel, ob); err != nil {
+				return err
+			}
+			p := Param{Name: qcode.OrderParam(ob.Var), Type: "text"}
+
+			io.WriteString(c.w, `CASE WHEN `)
+			c.myRenderParam(p)
+			io.WriteString(c.w, ` = 'asc' THEN `)
+			c.myColWithTable(ti.Name, ti.ColumnName(ob.Col))
+			io.WriteString(c.w, ` END ASC, CASE WHEN `)
+			c.myRenderParam(p)
+			io.WriteString(c.w, ` = 'desc' THEN `)
+			c.myColWithTable(ti.Name, ti.ColumnName(ob.Col))
+			io.WriteString(c.w, ` END DESC`)
+			continue
+		}
+
+		c.myColWithTable(ti.Name, ti.ColumnName(ob.Col))
+
+		switch ob.Order {
+		case qcode.OrderAsc:
+			io.WriteString(c.w, ` ASC`)
+		case qcode.OrderDesc:
+			io.WriteString(c.w, ` DESC`)
+		default:
+			return errMySQL("ordering nulls first or last")
+		}
+	}
+
+	switch {
+	case ti.IsSingular:
+		io.WriteString(c.w, ` LIMIT 1`)
+
+	case sel.Paging.LimitVar != "":
+		io.WriteString(c.w, ` LIMIT `)
+		c.myRenderParam(pagingParam(sel.Paging.LimitVar, sel.Paging.Limit))
+
+	case sel.Paging.Limit != "":
+		io.WriteString(c.w, ` LIMIT `)
+		io.WriteString(c.w, sel.Paging.Limit)
+
+	case sel.Paging.NoLimit:
+		// MySQL has no offset without a limit
+		if sel.Paging.Offset != "" {
+			io.WriteString(c.w, ` LIMIT 18446744073709551615`)
+		}
+
+	default:
+		io.WriteString(c.w, ` LIMIT 20`)
+	}
+
+	if sel.Paging.Offset != "" {
+		io.WriteString(c.w, ` OFFSET `)
+		c.myRenderParam(pagingParam(sel.Paging.Offset, ""))
+	}
+
+	return nil
+}
+
+func (c *compilerContext) myRenderExp(ex *qcode.Exp, ti *DBTableInfo) error {
+	switch ex.Op {
+	case qcode.OpNop:
+		io.WriteString(c.w, `true`)
+
+	case qcode.OpFalse:
+		io.WriteString(c.w, `false`)
+
+	case qcode.OpAnd, qcode.OpOr:
+		io.WriteString(c.w, `(`)
+		for i, cex := range ex.Children {
+			if i != 0 {
+				if ex.Op == qcode.OpAnd {
+					io.WriteString(c.w, ` AND `)
+				} else {
+					io.WriteString(c.w, ` OR `)
+				}
+			}
+			if err := c.myRenderExp(cex, ti); err != nil {
+				return err
+			}
+		}
+		io.WriteString(c.w, `)`)
+
+	case qcode.OpNot:
+		io.WriteString(c.w, `NOT `)
+		return c.myRenderExp(ex.Children[0], ti)
+
+	default:
+		if len(ex.NestedCols) != 0 {
+			return errMySQL("filtering on related tables")
+		}
+		return c.myRenderOp(ex, ti)
+	}
+
+	return nil
+}
+
+func (c *compilerContext) myRenderOp(ex *qcode.Exp, ti *DBTableInfo) error {
+	var col *DBColumn
+	var err error
+
+	switch {
+	case ex.Op == qcode.OpEqID:
+		if ti.PrimaryCol == nil {
+			return fmt.Errorf("no primary key column defined for %s", ti.Name)
+		}
+		col = ti.PrimaryCol
+
+	case ex.Op == qcode.OpTsQuery:
+		return errMySQL("search")
+
+	case ex.Col == "":
+		return errors.New("no column found for expression value")
+
+	case ex.IsFromQuery():
+		col, err = ti.GetColumnB(ex.Col)
+
+	default:
+		col, err = ti.GetColumn(ex.Col)
+	}
+
+	if err != nil {
+		return fmt.Errorf("where clause: %w", err)
+	}
+
+	io.WriteString(c.w, `((`)
+
+	switch {
+	case ex.Op == qcode.OpILike || ex.Op == qcode.OpNotILike:
+		io.WriteString(c.w, `LOWER(`)
+		c.myColWithTable(ti.Name, col.Name)
+		io.WriteString(c.w, `)`)
+	case ex.Type == qcode.ValRef && ex.Op == qcode.OpIsNull:
+		c.myColWithTable(ex.Table, ex.Col)
+	default:
+		c.myColWithTable(ti.Name, col.Name)
+	}
+	io.WriteString(c.w, `) `)
+
+	switch ex.Op {
+	case qcode.OpIsNull:
+		if strings.EqualFold(ex.Val, "true") {
+			io.WriteString(c.w, `IS NULL)`)
+		} else {
+			io.WriteString(c.w, `IS NOT NULL)`)
+		}
+		return nil
+
+	case qcode.OpIn, qcode.OpNotIn:
+		if ex.Op == qcode.OpNotIn {
+			io.WriteString(c.w, `NOT `)
+		}
+
+		if ex.Type == qcode.ValList {
+			io.WriteString(c.w, `IN (`)
+			for i, v := range ex.ListVal {
+				if i != 0 {
+					io.WriteString(c.w, `, `)
+				}
+				c.myRenderLit(ex.ListType, v)
+			}
+			io.WriteString(c.w, `))`)
+			return nil
+		}
+
+		if _, ok := c.vars[ex.Val]; ex.Type != qcode.ValVar || ok {
+			return errMySQL("in with a value that's not a list")
+		}
+
+		// the list is passed as a json array
+		io.WriteString(c.w, `MEMBER OF (CAST(`)
+		c.myRenderParam(Param{Name: ex.Val, Type: col.Type, IsArray: true})
+		io.WriteString(c.w, ` AS JSON)))`)
+		return nil
+
+	case qcode.OpEquals, qcode.OpEqID:
+		io.WriteString(c.w, `=`)
+	case qcode.OpNotEquals:
+		io.WriteString(c.w, `!=`)
+	case qcode.OpNotDistinct:
+		io.WriteString(c.w, `<=>`)
+	case qcode.OpGreaterOrEquals:
+		io.WriteString(c.w, `>=`)
+	case qcode.OpLesserOrEquals:
+		io.WriteString(c.w, `<=`)
+	case qcode.OpGreaterThan:
+		io.WriteString(c.w, `>`)
+	case qcode.OpLesserThan:
+		io.WriteString(c.w, `<`)
+	case qcode.OpLike, qcode.OpILike:
+		io.WriteString(c.w, `LIKE`)
+	case qcode.OpNotLike, qcode.OpNotILike:
+		io.WriteString(c.w, `NOT LIKE`)
+	default:
+		return errMySQL(fmt.Sprintf("where clause operator %d", ex.Op))
+	}
+
+	io.WriteString(c.w, ` `)
+
+	if ex.Op == qcode.OpILike || ex.Op == qcode.OpNotILike {
+		io.WriteString(c.w, `LOWER(`)
+		if err := c.myRenderVal(ex, col); err != nil {
+			return err
+		}
+		io.WriteString(c.w, `)`)
+	} else if err := c.myRenderVal(ex, col); err != nil {
+		return err
+	}
+
+	io.WriteString(c.w, `)`)
+	return nil
+}
+
+// myRenderVal renders the value of an expression, MySQL converts the
+// values compared to a column so they are not cast to its type
+func (c *compilerContext) myRenderVal(ex *qcode.Exp, col *DBColumn) error {
+	switch ex.Type {
+	case qcode.ValVar:
+		val, ok := c.vars[ex.Val]
+		switch {
+		case ok && strings.HasPrefix(val, "sql:"):
+			return errMySQL("sql config variables")
+		case ok:
+			c.mySquoted(val)
+		default:
+			c.myRenderParam(Param{Name: ex.Val, Type: col.Type})
+		}
+
+	case qcode.ValRef:
+		c.myColWithTable(ex.Table, ex.Col)
+
+	case qcode.ValList:
+		return errMySQL("lists with this operator")
+
+	default:
+		c.myRenderLit(ex.Type, ex.Val)
+	}
+
+	return nil
+}
+
+func (c *compilerContext) myRenderLit(t qcode.ValType, v string) {
+	switch t {
+	case qcode.ValNum, qcode.ValBool:
+		io.WriteString(c.w, v)
+	default:
+		c.mySquoted(v)
+	}
+}
+
+// myRenderParam renders a param placeholder, MySQL params are not numbered
+// so a variable used twice is passed twice
+func (c *compilerContext) myRenderParam(p Param) {
+	c.md.params = append(c.md.params, p)
+	io.WriteString(c.w, `?`)
+}
+
+func (c *compilerContext) myQuoted(identifier string) {
+	io.WriteString(c.w, MySQL.QuoteIdent(identifier))
+}
+
+func (c *compilerContext) myQuotedID(identifier string, id int32) {
+	io.WriteString(c.w, "`")
+	io.WriteString(c.w, strings.Replace(identifier, "`", "``", -1))
+	io.WriteString(c.w, `_`)
+	int32String(c.w, id)
+	io.WriteString(c.w, "`")
+}
+
+// mySquoted renders a string literal, backslashes are escapes in MySQL
+func (c *compilerContext) mySquoted(s string) {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `''`, -1)
+
+	io.WriteString(c.w, `'`)
+	io.WriteString(c.w, s)
+	io.WriteString(c.w, `'`)
+}
+
+func (c *compilerContext) myColWithTable(table, col string) {
+	c.myQuoted(table)
+	io.WriteString(c.w, `.`)
+	c.myQuoted(col)
+}
+
+func (c *compilerContext) myColWithTableID(table string, id int32, col string) {
+	if id >= 0 {
+		c.myQuotedID(table, id)
+	} else {
+		c.myQuoted(table)
+	}
+	io.WriteString(c.w, `.`)
+	c.myQuoted(col)
+}
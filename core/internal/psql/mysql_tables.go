@@ -0,0 +1,164 @@
+package psql
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GetMySQLDBInfo discovers the tables and columns of a MySQL database, the
+// current database is used when the schema is not set
+func GetMySQLDBInfo(db *sql.DB, schema string, blockList []string) (*DBInfo, error) {
+	var version string
+
+	if err := db.QueryRow(`SELECT VERSION()`).Scan(&version); err != nil {
+		return nil, fmt.Errorf("error fetching version: %w", err)
+	}
+
+	dbVersion, err := mysqlVersionNum(version)
+	if err != nil {
+		return nil, err
+	}
+
+	if schema == "" {
+		if err := db.QueryRow(`SELECT DATABASE()`).Scan(&schema); err != nil {
+			return nil, fmt.Errorf("error fetching database: %w", err)
+		}
+	}
+
+	dbTables, err := GetMySQLTables(db, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	cols, err := GetMySQLColumns(db, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	dbColumns := make([][]DBColumn, 0, len(dbTables))
+
+	for _, t := range dbTables {
+		dbColumns = append(dbColumns, cols[t.Name])
+	}
+
+	return NewDBInfo(dbVersion, dbTables, dbColumns, nil, blockList), nil
+}
+
+// mysqlVersionNum returns a version (eg. 8.0.23-log) as a number
+// in the same form as the version of Postgres (eg. 80023)
+func mysqlVersionNum(version string) (int, error) {
+	if i := strings.IndexAny(version, "-+"); i != -1 {
+		version = version[:i]
+	}
+
+	v := strings.SplitN(version, ".", 3)
+	n := 0
+
+	for i, m := range []int{10000, 100, 1} {
+		if i == len(v) {
+			break
+		}
+		d, err := strconv.Atoi(v[i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid mysql version: %s", version)
+		}
+		n += d * m
+	}
+
+	return n, nil
+}
+
+func GetMySQLTables(db *sql.DB, schema string) ([]DBTable, error) {
+	sqlStmt := `
+SELECT
+	table_name,
+	CASE table_type WHEN 'VIEW' THEN 'view' ELSE 'table' END,
+	table_comment
+FROM information_schema.tables
+WHERE table_schema = ?
+ORDER BY table_name`
+
+	var tables []DBTable
+
+	rows, err := db.Query(sqlStmt, schema)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tables: %s", err)
+	}
+	defer rows.Close()
+
+	for i := 0; rows.Next(); i++ {
+		t := DBTable{ID: i}
+
+		if err := rows.Scan(&t.Name, &t.Type, &t.Comment); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+
+	return tables, rows.Err()
+}
+
+func GetMySQLColumns(db *sql.DB, schema string) (map[string][]DBColumn, error) {
+	sqlStmt := `
+SELECT
+	c.table_name,
+	c.ordinal_position,
+	c.column_name,
+	c.is_nullable = 'NO',
+	c.data_type,
+	c.column_key = 'PRI',
+	c.column_key IN ('PRI', 'UNI'),
+	COALESCE(k.referenced_table_name, ''),
+	COALESCE(rc.ordinal_position, 0),
+	c.column_comment,
+	c.extra LIKE '%GENERATED%'
+FROM information_schema.columns c
+LEFT JOIN information_schema.key_column_usage k
+	ON k.table_schema = c.table_schema
+	AND k.table_name = c.table_name
+	AND k.column_name = c.column_name
+	AND k.referenced_table_name IS NOT NULL
+LEFT JOIN information_schema.columns rc
+	ON rc.table_schema = k.referenced_table_schema
+	AND rc.table_name = k.referenced_table_name
+	AND rc.column_name = k.referenced_column_name
+WHERE c.table_schema = ?
+ORDER BY c.table_name, c.ordinal_position`
+
+	rows, err := db.Query(sqlStmt, schema)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching columns: %s", err)
+	}
+	defer rows.Close()
+
+	cols := make(map[string][]DBColumn)
+	seen := make(map[string]struct{})
+
+	for rows.Next() {
+		var t string
+		var fkColID int16
+		c := DBColumn{}
+
+		err = rows.Scan(&t, &c.ID, &c.Name, &c.NotNull, &c.Type,
+			&c.PrimaryKey, &c.UniqueKey, &c.FKeyTable, &fkColID, &c.Comment, &c.Generated)
+		if err != nil {
+			return nil, err
+		}
+
+		// a column with many foreign keys is related to the first one
+		k := t + "." + c.Name
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+
+		if c.FKeyTable != "" {
+			c.FKeyColID = []int16{fkColID}
+		}
+		cols[t] = append(cols[t], c)
+	}
+
+	return cols, rows.Err()
+}
@@ -0,0 +1,85 @@
+package psql_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestMySQLQuery(t *testing.T) {
+	schema, err := psql.GetTestSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mcompile := psql.NewCompiler(psql.Config{Schema: schema, Dialect: psql.MySQL})
+
+	gql := `query {
+		products(where: { and: { id: { in: $ids }, name: { ilike: $name } } }, order_by: { price: desc }, limit: 5) {
+			id
+			name
+			user {
+				email
+			}
+			customers {
+				email
+			}
+		}
+		user(id: $id) {
+			full_name
+		}
+	}`
+
+	qc, err := qcompile.Compile([]byte(gql), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md, sql, err := mcompile.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		"SELECT JSON_OBJECT('user', `__sj_0`.`json`, 'products', `__sj_1`.`json`) AS `__root` FROM (SELECT 1) AS `__root_x`",
+		"SELECT COALESCE(JSON_ARRAYAGG(`__sr_1`.`json`), JSON_ARRAY()) AS `json`",
+		"((LOWER(`products`.`name`)) LIKE LOWER(?))",
+		"((`products`.`id`) MEMBER OF (CAST(? AS JSON)))",
+		"((`products`.`price`) > 0)",
+		"ORDER BY `products`.`price` DESC LIMIT 5",
+		"LEFT OUTER JOIN `purchases` ON ((`purchases`.`customer_id`) = (`customers`.`id`)) WHERE (((`purchases`.`product_id`) = (`products_1`.`id`)))",
+		"WHERE (((`users`.`id`) = (`products_1`.`user_id`))) LIMIT 1",
+		"WHERE (((`users`.`id`) = ?)) LIMIT 1",
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(string(sql), v) {
+			t.Fatalf("expected %s: %s", v, sql)
+		}
+	}
+
+	// params are not numbered so they are in the order they're used
+	var names []string
+	for _, p := range md.Params() {
+		names = append(names, p.Name)
+	}
+
+	if v := strings.Join(names, ","); v != "id,name,ids" {
+		t.Fatalf("unexpected params: %s", v)
+	}
+
+	for _, gql := range []string{
+		`mutation { product(insert: $data) { id } }`,
+		`query { products(search: "shoes") { id } }`,
+		`query { products(first: 5) { id } }`,
+	} {
+		qc, err := qcompile.Compile([]byte(gql), "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := mcompile.CompileEx(qc, psql.Variables{"data": []byte(`{"name": "a"}`)}); err == nil {
+			t.Fatalf("expected an error for a query not supported by mysql: %s", gql)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package psql
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// orderAggs are the aggregates of the rows of a related table the
+// rows can be ordered by (eg. purchases: { sum_quantity: desc })
+var orderAggs = []string{"sum_", "avg_", "max_", "min_"}
+
+// isOrderExp returns true if the rows are not ordered by a column of the
+// table but by a column of a related table (eg. user.full_name), an aggregate
+// of the rows of one (eg. purchases_count) or a named expression of the table
+func isOrderExp(ti *DBTableInfo, cn string) bool {
+	if ti.ColumnExists(cn) {
+		return false
+	}
+	if _, ok := ti.OrderExps[cn]; ok {
+		return true
+	}
+	return strings.Contains(cn, ".") || strings.HasSuffix(cn, "_count")
+}
+
+// renderOrderExp renders the value the rows are ordered by as a column of the
+// base select, related tables are fetched with a correlated subquery
+func (c *compilerContext) renderOrderExp(sel *qcode.Select, ti *DBTableInfo, cn string) error {
+	if sel.Paging.Type != qcode.PtOffset {
+		return fmt.Errorf("order_by: %s: can't be used with cursor pagination", cn)
+	}
+
+	if exp, ok := ti.OrderExps[cn]; ok {
+		io.WriteString(c.w, `(`)
+		io.WriteString(c.w, exp)
+		io.WriteString(c.w, `)`)
+		return nil
+	}
+
+	var path []string
+
+	if strings.Contains(cn, ".") {
+		path = strings.Split(cn, ".")
+	} else {
+		path = []string{strings.TrimSuffix(cn, "_count"), "count"}
+	}
+
+	return c.renderOrderPath(ti, path, cn)
+}
+
+// renderOrderPath renders the value at the path of related tables, each table
+// but the last has to have one related row and the last can be aggregated
+func (c *compilerContext) renderOrderPath(pti *DBTableInfo, path []string, cn string) error {
+	ti, err := c.schema.GetTableInfo(path[0])
+	if err != nil {
+		return fmt.Errorf("order_by: %s: %w", cn, err)
+	}
+
+	if ti.Blocked {
+		return fmt.Errorf("order_by: %s: table blocked: %s", cn, ti.Name)
+	}
+
+	rel, err := c.schema.GetRel(ti.Name, pti.Name)
+	if err != nil {
+		return fmt.Errorf("order_by: %s: %w", cn, err)
+	}
+
+	if rel.Type != RelOneToOne && rel.Type != RelOneToMany && rel.Type != RelOneToManyThrough {
+		return fmt.Errorf("order_by: %s: relationship with %s not supported", cn, ti.Name)
+	}
+
+	// the related table has one row when it's joined on its key
+	one := rel.Type != RelOneToManyThrough && !rel.Left.Array && !rel.Right.Array &&
+		ti.PrimaryCol != nil && rel.Left.Col == ti.PrimaryCol.Name
+
+	var fn, col string
+
+	switch v := path[1]; {
+	case len(path) > 2:
+		if !one {
+			return fmt.Errorf("order_by: %s: %s has more than one row", cn, ti.Name)
+		}
+
+	case v == "count":
+		fn = "count"
+
+	default:
+		col = v
+		for _, p := range orderAggs {
+			if strings.HasPrefix(v, p) && !ti.ColumnExists(v) {
+				fn, col = strings.TrimSuffix(p, "_"), v[len(p):]
+				break
+			}
+		}
+
+		if !ti.ColumnExists(col) {
+			return fmt.Errorf("order_by: %s: %w", cn, ti.colNotFound(col))
+		}
+
+		if fn == "" && !one {
+			return fmt.Errorf("order_by: %s: %s has more than one row, order by an aggregate (eg. %s: { count: desc })",
+				cn, ti.Name, path[0])
+		}
+	}
+
+	io.WriteString(c.w, `(SELECT `)
+
+	switch {
+	case len(path) > 2:
+		if err := c.renderOrderPath(ti, path[1:], cn); err != nil {
+			return err
+		}
+	case fn == "count":
+		io.WriteString(c.w, `count(*)`)
+	case fn != "":
+		io.WriteString(c.w, fn)
+		io.WriteString(c.w, `(`)
+		colWithTable(c.w, ti.Name, col)
+		io.WriteString(c.w, `)`)
+	default:
+		colWithTable(c.w, ti.Name, col)
+	}
+
+	io.WriteString(c.w, ` FROM `)
+	c.renderTable(c.w, ti.Name)
+
+	if err := c.renderJoinByName(ti.Name, pti.Name, -1); err != nil {
+		return err
+	}
+
+	io.WriteString(c.w, ` WHERE `)
+
+	if err := c.renderRelationshipByName(ti.Name, pti.Name); err != nil {
+		return err
+	}
+
+	if fn == "" {
+		io.WriteString(c.w, ` LIMIT 1`)
+	}
+	io.WriteString(c.w, `)`)
+
+	return nil
+}
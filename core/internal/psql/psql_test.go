@@ -28,7 +28,10 @@ var (
 func TestMain(m *testing.M) {
 	var err error
 
-	qcompile, err = qcode.NewCompiler(qcode.Config{})
+	qcompile, err = qcode.NewCompiler(
+		qcode.WithTableFunction("search_products", "products"),
+		qcode.WithFilter("cheap", "{ price: { lt: 10 } }"),
+		qcode.WithFilter("mine", "{ user_id: { eq: $user_id } }"))
 	if err != nil {
 		log.Fatal(err)
 	}
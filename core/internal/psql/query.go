@@ -9,6 +9,8 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/dosco/super-graph/core/internal/qcode"
 	"github.com/dosco/super-graph/core/internal/util"
@@ -16,6 +18,8 @@ import (
 
 const (
 	closeBlock = 500
+
+	defaultRecursiveDepth = 10
 )
 
 type Param struct {
@@ -25,16 +29,61 @@ type Param struct {
 }
 
 type Metadata struct {
-	Poll        bool
+	Poll bool
+
+	// Lenient turns on lenient mode for this compile only
+	// (eg. when set by a feature flag)
+	Lenient bool
+
+	// Where are sql conditions added to the filters of the selections
+	// of the tables keyed by the table. They're rendered as is and must
+	// only come from trusted callers
+	Where map[string]string
+
+	// Stream renders the rows of the root of the query instead
+	// of a single json object so they can be fetched in batches
+	Stream bool
+
 	remoteCount int
 	params      []Param
 	pindex      map[string]int
+	skipped     bool
+	dirVars     bool
+	warnings    []string
+
+	// ctes are the tables a mutation has a CTE of the same name for,
+	// later references to them are to the CTE
+	ctes map[string]struct{}
+
+	// counts are the counts of rows made outside the query
+	counts []CountQuery
 }
 
 type compilerContext struct {
 	md Metadata
 	w  io.Writer
 	s  []qcode.Select
+
+	// schema is the snapshot used for the whole compile
+	// even if a new one is swapped in meanwhile
+	schema *DBSchema
+
+	// mi is the index of the mutation being rendered and refs are the
+	// relationships used to set its foreign keys from earlier ones
+	mi   int
+	refs []*DBRel
+
+	// jsels are the selections of keys in json columns
+	jsels map[int32]struct{}
+
+	// qvars are the variables of the query, needed to render
+	// the selections fetched with a subquery in the columns
+	qvars Variables
+
+	// joins is the snapshot of the join strategies used for the
+	// whole compile even if new ones are set meanwhile
+	joins map[string]map[string]JoinStrategy
+
 	*Compiler
 }
 
@@ -43,26 +92,230 @@ type Variables map[string]json.RawMessage
 type Config struct {
 	Schema *DBSchema
 	Vars   map[string]string
+
+	// Lenient drops unknown columns from the query with a warning
+	// instead of failing with an error
+	Lenient bool
+
+	// Timestamps is a list of tables that get their created_at column
+	// set on insert and updated_at on insert and update
+	Timestamps []string
+
+	// MaxErrors is the number of unknown columns reported for
+	// a query. Defaults to 10
+	MaxErrors int
+
+	// RecursiveDepth is the max depth of the rows of a recursive
+	// selection (`find: children`). Defaults to 10
+	RecursiveDepth int
+
+	// Dialect is the database the sql is rendered for. Defaults to Postgres
+	Dialect Dialect
+
+	// CursorWatermark adds the max primary key of the table when the first
+	// page is fetched to the cursor, later pages skip the rows added after it.
+	// Only for tables with an integer primary key
+	CursorWatermark bool
+
+	// Joins are the strategies the rows of related tables are fetched
+	// with keyed by the parent table and then the child table. Defaults
+	// to JoinLateral
+	Joins map[string]map[string]JoinStrategy
+
+	// Computed are the fields computed outside the database keyed by the
+	// table and then the field, the columns they need are returned as a
+	// json object in place of the field
+	Computed map[string]map[string][]string
+
+	// Counts are the strategies the rows of the tables are counted with for
+	// the CountField keyed by the table. Defaults to CountExact
+	Counts map[string]CountStrategy
+
+	// Cached are the fields read from a cache table keyed by the
+	// table and then the field
+	Cached map[string]map[string]CachedField
+
+	// Cartesian is what's done with joins on columns unique on neither
+	// side. Defaults to CartesianWarn
+	Cartesian CartesianMode
 }
 
+// JoinStrategy is how the rows of a related table are fetched
+// for the rows of its parent table
+type JoinStrategy int
+
+const (
+	// JoinLateral fetches them with a lateral join
+	JoinLateral JoinStrategy = iota
+
+	// JoinSubquery fetches them with a correlated subquery in the columns
+	// of the parent, often faster when the parent has few rows
+	JoinSubquery
+)
+
 type Compiler struct {
-	schema *DBSchema
-	vars   map[string]string
+	// schema holds a *DBSchema that's never changed once stored,
+	// updates store a modified copy instead
+	schema    atomic.Value
+	smu       sync.Mutex
+	vars      map[string]string
+	lenient   bool
+	ts        map[string]struct{}
+	maxErrs   int
+	rdepth    int
+	dialect   Dialect
+	wmark     bool
+	joins     atomic.Value // map[string]map[string]JoinStrategy
+	cfields   map[string]map[string][]string
+	counts    map[string]CountStrategy
+	cached    map[string]map[string]CachedField
+	cartesian CartesianMode
 }
 
 func NewCompiler(conf Config) *Compiler {
-	return &Compiler{
-		schema: conf.Schema,
-		vars:   conf.Vars,
+	co := &Compiler{
+		vars:      conf.Vars,
+		lenient:   conf.Lenient,
+		ts:        make(map[string]struct{}, len(conf.Timestamps)),
+		maxErrs:   conf.MaxErrors,
+		rdepth:    conf.RecursiveDepth,
+		dialect:   conf.Dialect,
+		wmark:     conf.CursorWatermark,
+		cartesian: conf.Cartesian,
+	}
+
+	if co.dialect == nil {
+		co.dialect = Postgres
+	}
+
+	if co.maxErrs == 0 {
+		co.maxErrs = util.DefaultMaxErrors
+	}
+
+	if co.rdepth == 0 {
+		co.rdepth = defaultRecursiveDepth
+	}
+	co.schema.Store(conf.Schema)
+
+	for _, t := range conf.Timestamps {
+		co.ts[strings.ToLower(t)] = struct{}{}
+	}
+
+	co.joins.Store(lowerJoins(conf.Joins))
+
+	for t, m := range conf.Computed {
+		for f, cols := range m {
+			if co.cfields == nil {
+				co.cfields = make(map[string]map[string][]string)
+			}
+			t := strings.ToLower(t)
+
+			if co.cfields[t] == nil {
+				co.cfields[t] = make(map[string][]string)
+			}
+			co.cfields[t][f] = cols
+		}
 	}
+
+	for t, cs := range conf.Counts {
+		if co.counts == nil {
+			co.counts = make(map[string]CountStrategy)
+		}
+		co.counts[strings.ToLower(t)] = cs
+	}
+
+	for t, m := range conf.Cached {
+		for f, cf := range m {
+			if co.cached == nil {
+				co.cached = make(map[string]map[string]CachedField)
+			}
+			t := strings.ToLower(t)
+
+			if co.cached[t] == nil {
+				co.cached[t] = make(map[string]CachedField)
+			}
+			co.cached[t][f] = cf
+		}
+	}
+
+	return co
+}
+
+// Schema returns the current database schema
+func (co *Compiler) Schema() *DBSchema {
+	return co.schema.Load().(*DBSchema)
+}
+
+// SetSchema swaps in a new database schema. Compiles already
+// in progress finish with the schema they started with.
+func (co *Compiler) SetSchema(schema *DBSchema) {
+	co.smu.Lock()
+	co.schema.Store(schema)
+	co.smu.Unlock()
+}
+
+// SetJoins swaps in new join strategies keyed by the parent table and
+// then the child table. Compiles already in progress finish with the
+// strategies they started with.
+func (co *Compiler) SetJoins(joins map[string]map[string]JoinStrategy) {
+	co.joins.Store(lowerJoins(joins))
+}
+
+func (co *Compiler) loadJoins() map[string]map[string]JoinStrategy {
+	m, _ := co.joins.Load().(map[string]map[string]JoinStrategy)
+	return m
+}
+
+func lowerJoins(joins map[string]map[string]JoinStrategy) map[string]map[string]JoinStrategy {
+	var m map[string]map[string]JoinStrategy
+
+	for pt, jm := range joins {
+		for ct, js := range jm {
+			if m == nil {
+				m = make(map[string]map[string]JoinStrategy)
+			}
+			pt, ct = strings.ToLower(pt), strings.ToLower(ct)
+
+			if m[pt] == nil {
+				m[pt] = make(map[string]JoinStrategy)
+			}
+			m[pt][ct] = js
+		}
+	}
+	return m
+}
+
+// WithSchema returns a compiler with the same config and another
+// database schema, used to try queries with it before it's swapped in
+func (co *Compiler) WithSchema(schema *DBSchema) *Compiler {
+	c := &Compiler{
+		vars:    co.vars,
+		lenient: co.lenient,
+		ts:      co.ts,
+		maxErrs: co.maxErrs,
+		rdepth:  co.rdepth,
+		dialect: co.dialect,
+	}
+	c.schema.Store(schema)
+
+	return c
 }
 
 func (co *Compiler) AddRelationship(child, parent string, rel *DBRel) error {
-	return co.schema.SetRel(child, parent, rel)
+	co.smu.Lock()
+	defer co.smu.Unlock()
+
+	schema := co.Schema().clone()
+	if err := schema.SetRel(child, parent, rel); err != nil {
+		return err
+	}
+	co.schema.Store(schema)
+
+	return nil
 }
 
 func (co *Compiler) IDColumn(table string) (*DBColumn, error) {
-	ti, err := co.schema.GetTableInfo(table)
+	ti, err := co.Schema().GetTableInfo(table)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +350,7 @@ func (co *Compiler) CompileWithMetadata(w io.Writer, qc *qcode.QCode, vars Varia
 		qcode.QTUpdate,
 		qcode.QTDelete,
 		qcode.QTUpsert:
-		return co.compileMutation(w, qc, vars)
+		return co.dialect.compileMutation(co, w, qc, vars)
 
 	default:
 		return Metadata{}, fmt.Errorf("Unknown operation type %d", qc.Type)
@@ -112,16 +365,53 @@ func (co *Compiler) compileQueryWithMetadata(
 		return metad, errors.New("empty query")
 	}
 
-	c := &compilerContext{metad, w, qc.Selects, co}
+	c := &compilerContext{md: metad, w: w, s: qc.Selects, schema: co.Schema(), qvars: vars,
+		joins: co.loadJoins(), Compiler: co}
+
+	if err := c.applyDirectives(vars); err != nil {
+		return c.md, err
+	}
+
+	if err := c.initJSONSels(); err != nil {
+		return c.md, err
+	}
+
+	if c.lenient || c.md.Lenient {
+		c.dropUnknownCols()
+	} else if err := c.checkUnknownCols(); err != nil {
+		return c.md, err
+	}
+
+	if err := c.checkCartesianJoins(); err != nil {
+		return c.md, err
+	}
+
+	err := c.dialect.renderQuery(c, qc, vars)
+	return c.md, err
+}
+
+// renderQuery renders the query as a single json object with a key for
+// each root selection
+func (pgDialect) renderQuery(c *compilerContext, qc *qcode.QCode, vars Variables) error {
 	rens := make([]int32, 0, len(qc.Roots))
 	i := 0
 
+	if c.md.Stream {
+		return c.compileStream(qc, vars)
+	}
+
 	io.WriteString(c.w, `SELECT jsonb_build_object(`)
 	for _, id := range qc.Roots {
+		sel := &qc.Selects[id]
+
+		// roots removed by a directive are left out of the response
+		if sel.SkipRender == qcode.SkipTypeDirective {
+			continue
+		}
+
 		if i != 0 {
 			io.WriteString(c.w, `, `)
 		}
-		sel := &qc.Selects[id]
 		io.WriteString(c.w, `'`)
 		io.WriteString(c.w, sel.FieldName)
 		io.WriteString(c.w, `', `)
@@ -131,7 +421,7 @@ func (co *Compiler) compileQueryWithMetadata(
 		}
 
 		if sel.SkipRender != qcode.SkipTypeNone ||
-			(len(sel.Cols) == 0 && len(sel.Children) == 0) {
+			(len(sel.Cols) == 0 && len(sel.Children) == 0 && sel.ClientMutationID == "") {
 			io.WriteString(c.w, `NULL`)
 
 		} else {
@@ -155,6 +445,7 @@ func (co *Compiler) compileQueryWithMetadata(
 	}
 
 	io.WriteString(c.w, `) as "__root" FROM (VALUES(true)) as "__root_x"`)
+	c.md.skipped = (i == 0)
 
 	st := NewIntStack()
 	for _, id := range rens {
@@ -162,11 +453,82 @@ func (co *Compiler) compileQueryWithMetadata(
 		st.Push(id)
 
 		if err := c.renderQuery(st, vars); err != nil {
-			return c.md, err
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyDirectives removes the selections and columns skipped by the value of
+// the variable in their @skip or @include directive
+func (c *compilerContext) applyDirectives(vars Variables) error {
+	for i := range c.s {
+		sel := &c.s[i]
+
+		if sel.SkipRender == qcode.SkipTypeNone {
+			skip, err := c.skipped(sel.SkipVar, sel.IncludeVar, vars)
+			if err != nil {
+				return err
+			}
+			if skip {
+				sel.SkipRender = qcode.SkipTypeDirective
+			}
+		}
+
+		cols := sel.Cols[:0]
+		for _, col := range sel.Cols {
+			skip, err := c.skipped(col.SkipVar, col.IncludeVar, vars)
+			if err != nil {
+				return err
+			}
+			if !skip {
+				cols = append(cols, col)
+			}
 		}
+		sel.Cols = cols
 	}
 
-	return c.md, nil
+	for i := range c.s {
+		sel := &c.s[i]
+
+		children := sel.Children[:0]
+		for _, id := range sel.Children {
+			if c.s[id].SkipRender != qcode.SkipTypeDirective {
+				children = append(children, id)
+			}
+		}
+		sel.Children = children
+	}
+
+	return nil
+}
+
+func (c *compilerContext) skipped(skipVar, includeVar string, vars Variables) (bool, error) {
+	if skipVar != "" {
+		c.md.dirVars = true
+		if v, err := boolVar(skipVar, vars); err != nil || v {
+			return v, err
+		}
+	}
+
+	if includeVar != "" {
+		c.md.dirVars = true
+		v, err := boolVar(includeVar, vars)
+		return !v, err
+	}
+
+	return false, nil
+}
+
+func boolVar(name string, vars Variables) (bool, error) {
+	switch string(vars[name]) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("variable '%s' must be a boolean", name)
 }
 
 func (c *compilerContext) renderQuery(st *IntStack, vars Variables) error {
@@ -193,6 +555,9 @@ func (c *compilerContext) renderQuery(st *IntStack, vars Variables) error {
 
 		plural := !ti.IsSingular
 
+		// the rows of the root are returned as is when streaming
+		stream := c.md.Stream && sel.ParentID == -1
+
 		if sel.Type == qcode.STMember {
 			if pti, err := c.schema.GetTableInfo(c.s[sel.ParentID].Name); err != nil {
 				return err
@@ -211,10 +576,21 @@ func (c *compilerContext) renderQuery(st *IntStack, vars Variables) error {
 					continue
 				}
 
-				c.renderLateralJoin()
+				if c.isSubquerySel(sel) {
+					io.WriteString(c.w, `(SELECT "__sj_`)
+					int32String(c.w, sel.ID)
+					io.WriteString(c.w, `"."json" FROM (`)
+
+					if plural {
+						c.renderPluralSelect(sel, ti)
+					}
+
+				} else if !stream {
+					c.renderLateralJoin()
 
-				if plural {
-					c.renderPluralSelect(sel, ti)
+					if plural {
+						c.renderPluralSelect(sel, ti)
+					}
 				}
 
 				if err := c.renderSelect(sel, ti, vars); err != nil {
@@ -229,7 +605,8 @@ func (c *compilerContext) renderQuery(st *IntStack, vars Variables) error {
 					c.md.remoteCount++
 					continue
 
-				} else if child.SkipRender != qcode.SkipTypeNone {
+				} else if child.SkipRender != qcode.SkipTypeNone || c.isJSONSel(cid) ||
+					child.Find != qcode.FindNone || c.isSubquerySel(child) {
 					continue
 				}
 
@@ -242,11 +619,22 @@ func (c *compilerContext) renderQuery(st *IntStack, vars Variables) error {
 				io.WriteString(c.w, `)`)
 				aliasWithID(c.w, "__sr", sel.ID)
 
-				if plural {
+				if c.isSubquerySel(sel) {
+					if plural {
+						io.WriteString(c.w, `)`)
+						aliasWithID(c.w, "__sj", sel.ID)
+					}
 					io.WriteString(c.w, `)`)
 					aliasWithID(c.w, "__sj", sel.ID)
+					io.WriteString(c.w, `)`)
+
+				} else if !stream {
+					if plural {
+						io.WriteString(c.w, `)`)
+						aliasWithID(c.w, "__sj", sel.ID)
+					}
+					c.renderLateralJoinClose(sel.ID)
 				}
-				c.renderLateralJoinClose(sel.ID)
 			}
 
 			if sel.Type != qcode.STMember {
@@ -289,6 +677,11 @@ func (c *compilerContext) renderPluralSelect(sel *qcode.Select, ti *DBTableInfo)
 			int32String(c.w, int32(i))
 			io.WriteString(c.w, `")`)
 		}
+		if c.hasWatermark(sel, ti) {
+			io.WriteString(c.w, `, CASE WHEN count(*) != 0 THEN `)
+			c.renderWatermark(sel, ti, n)
+			io.WriteString(c.w, ` END`)
+		}
 		io.WriteString(c.w, `) as "cursor"`)
 	}
 
@@ -331,11 +724,37 @@ func (c *compilerContext) initSelect(sel *qcode.Select, ti *DBTableInfo, vars Va
 
 	if sel.Paging.Cursor {
 		c.addSeekPredicate(sel)
+
+		if c.hasWatermark(sel, ti) {
+			c.addWatermarkPredicate(sel, ti)
+		}
 	}
 
 	for _, id := range sel.Children {
 		child := &c.s[id]
 
+		// the column the children or parents are found with
+		if child.Find != qcode.FindNone {
+			cn, err := c.recursiveCol(child, ti)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := colmap[cn]; !ok {
+				cols = append(cols, &qcode.Column{Table: ti.Name, Name: cn, FieldName: cn})
+				colmap[cn] = struct{}{}
+			}
+			continue
+		}
+
+		// the json column the keys are selected from
+		if c.isJSONSel(id) {
+			if _, ok := colmap[child.Name]; !ok {
+				cols = append(cols, &qcode.Column{Table: ti.Name, Name: child.Name, FieldName: child.Name})
+				colmap[child.Name] = struct{}{}
+			}
+			continue
+		}
+
 		rel, err := c.schema.GetRel(child.Name, ti.Name)
 		if err != nil {
 			return nil, err
@@ -364,8 +783,8 @@ func (c *compilerContext) initSelect(sel *qcode.Select, ti *DBTableInfo, vars Va
 			if _, ok := colmap[rel.Left.Col]; !ok {
 				cols = append(cols, &qcode.Column{Table: ti.Name, Name: rel.Left.Col, FieldName: rel.Right.Col})
 				colmap[rel.Left.Col] = struct{}{}
-				child.SkipRender = qcode.SkipTypeRemote
 			}
+			child.SkipRender = qcode.SkipTypeRemote
 
 		case RelPolymorphic:
 			if _, ok := colmap[rel.Left.Col]; !ok {
@@ -533,6 +952,49 @@ func (c *compilerContext) renderSelect(sel *qcode.Select, ti *DBTableInfo, vars
 	return nil
 }
 
+// isSubquerySel returns true if the selection is fetched with a correlated
+// subquery in the columns of its parent. Selections with a cursor need the
+// lateral join for it and are never fetched with one
+func (c *compilerContext) isSubquerySel(sel *qcode.Select) bool {
+	if len(c.joins) == 0 || sel.ParentID == -1 || sel.Type != qcode.STNone ||
+		sel.Paging.Type != qcode.PtOffset {
+		return false
+	}
+
+	m, ok := c.joins[c.s[sel.ParentID].Name]
+	if !ok {
+		if pti, err := c.schema.GetTableInfo(c.s[sel.ParentID].Name); err == nil {
+			m, ok = c.joins[pti.Name]
+		}
+	}
+	if !ok {
+		return false
+	}
+
+	js, ok := m[sel.Name]
+	if !ok {
+		if ti, err := c.schema.GetTableInfo(sel.Name); err == nil {
+			js = m[ti.Name]
+		}
+	}
+	return js == JoinSubquery
+}
+
+// renderRawWhere adds the sql condition set for the table in Where
+func (c *compilerContext) renderRawWhere(ti *DBTableInfo, and bool) {
+	v, ok := c.md.Where[ti.Name]
+	if !ok {
+		return
+	}
+
+	if and {
+		io.WriteString(c.w, ` AND `)
+	}
+	io.WriteString(c.w, `(`)
+	io.WriteString(c.w, v)
+	io.WriteString(c.w, `)`)
+}
+
 func (c *compilerContext) renderLateralJoin() error {
 	io.WriteString(c.w, ` LEFT OUTER JOIN LATERAL (`)
 	return nil
@@ -566,9 +1028,9 @@ func (c *compilerContext) renderJoinByName(table, parent string, id int32) error
 
 	//fmt.Fprintf(w, ` LEFT OUTER JOIN "%s" ON (("%s"."%s") = ("%s_%d"."%s"))`,
 	//rel.Through, rel.Through, rel.ColT, c.parent.Name, c.parent.ID, rel.Left.Col)
-	io.WriteString(c.w, ` LEFT OUTER JOIN "`)
-	io.WriteString(c.w, rel.Through.Table)
-	io.WriteString(c.w, `" ON ((`)
+	io.WriteString(c.w, ` LEFT OUTER JOIN `)
+	c.renderTable(c.w, rel.Through.Table)
+	io.WriteString(c.w, ` ON ((`)
 	colWithTable(c.w, rel.Through.Table, rel.Through.ColL)
 	io.WriteString(c.w, `) = (`)
 	colWithTable(c.w, rel.Left.Table, rel.Left.Col)
@@ -581,12 +1043,14 @@ func (c *compilerContext) renderColumns(sel *qcode.Select, ti *DBTableInfo) erro
 	i := 0
 
 	for _, col := range sel.Cols {
-		if n := funcPrefixLen(c.schema.fm, col.Name); n != 0 {
+		cursor := isRowCursor(sel, col.Name)
+
+		if n := funcPrefixLen(c.schema.fm, col.Name); n != 0 || col.Name == CountField {
 			if !sel.Functions {
 				continue
 			}
 		} else {
-			if strings.HasSuffix(col.Name, "_cursor") {
+			if !cursor && strings.HasSuffix(col.Name, "_cursor") {
 				continue
 			}
 		}
@@ -595,12 +1059,30 @@ func (c *compilerContext) renderColumns(sel *qcode.Select, ti *DBTableInfo) erro
 			io.WriteString(c.w, ", ")
 		}
 
-		colWithTableID(c.w, ti.Name, sel.ID, col.Name)
+		if cursor {
+			c.renderRowCursor(sel, ti)
+		} else {
+			colWithTableID(c.w, ti.Name, sel.ID, col.Name)
+		}
 		alias(c.w, col.FieldName)
 
 		i++
 	}
 
+	// the clientMutationId is returned from the input untouched
+	if sel.ClientMutationID != "" {
+		if i != 0 {
+			io.WriteString(c.w, ", ")
+		}
+		io.WriteString(c.w, `(`)
+		c.md.renderParam(c.w, Param{Name: sel.ActionVar, Type: "json"})
+		io.WriteString(c.w, ` :: json ->> '`)
+		io.WriteString(c.w, qcode.ClientMutationID)
+		io.WriteString(c.w, `')`)
+		alias(c.w, sel.ClientMutationID)
+		i++
+	}
+
 	i += c.renderRemoteRelColumns(sel, ti, i)
 
 	return c.renderJoinColumns(sel, ti, i)
@@ -653,6 +1135,32 @@ func (c *compilerContext) renderJoinColumns(sel *qcode.Select, ti *DBTableInfo,
 				return err
 			}
 
+		} else if c.isJSONSel(id) {
+			c.renderJSONSel(childSel, ti, sel.ID)
+			alias(c.w, childSel.FieldName)
+			i++
+			continue
+
+		} else if childSel.Find != qcode.FindNone {
+			if err := c.renderRecursiveSel(childSel, ti, sel.ID); err != nil {
+				return err
+			}
+			alias(c.w, childSel.FieldName)
+			i++
+			continue
+
+		} else if c.isSubquerySel(childSel) {
+			st := NewIntStack()
+			st.Push(childSel.ID + closeBlock)
+			st.Push(childSel.ID)
+
+			if err := c.renderQuery(st, c.qvars); err != nil {
+				return err
+			}
+			alias(c.w, childSel.FieldName)
+			i++
+			continue
+
 		} else {
 			io.WriteString(c.w, `"__sj_`)
 			int32String(c.w, childSel.ID)
@@ -690,7 +1198,7 @@ func (c *compilerContext) renderUnionColumn(parent, sel *qcode.Select, ti *DBTab
 		io.WriteString(c.w, `WHEN `)
 		colWithTableID(c.w, ti.Name, parent.ID, rel.Right.Table)
 		io.WriteString(c.w, ` = `)
-		squoted(c.w, uti.Name)
+		squoted(c.w, c.schema.polyType(sel.Name, uti.Name))
 		io.WriteString(c.w, ` THEN `)
 		io.WriteString(c.w, `"__sj_`)
 		int32String(c.w, unionSel.ID)
@@ -707,6 +1215,10 @@ func (c *compilerContext) renderBaseSelect(sel *qcode.Select, ti *DBTableInfo, r
 	isFil := (sel.Where != nil && sel.Where.Op != qcode.OpNop)
 	hasOrder := len(sel.OrderBy) != 0
 
+	if ok, err := c.renderCountSelect(sel, ti, rel); ok || err != nil {
+		return err
+	}
+
 	if sel.Paging.Cursor {
 		c.renderCursorCTE(sel, ti)
 	}
@@ -724,13 +1236,20 @@ func (c *compilerContext) renderBaseSelect(sel *qcode.Select, ti *DBTableInfo, r
 
 	io.WriteString(c.w, ` FROM `)
 
-	c.renderFrom(sel, ti, rel)
+	if err := c.renderFrom(sel, ti, rel); err != nil {
+		return err
+	}
+
+	_, isRaw := c.md.Where[ti.Name]
 
-	if isRoot && isFil {
+	if isRoot && (isFil || isRaw) {
 		io.WriteString(c.w, ` WHERE (`)
-		if err := c.renderWhere(sel, ti); err != nil {
-			return err
+		if isFil {
+			if err := c.renderWhere(sel, ti); err != nil {
+				return err
+			}
 		}
+		c.renderRawWhere(ti, isFil)
 		io.WriteString(c.w, `)`)
 	}
 
@@ -750,10 +1269,16 @@ func (c *compilerContext) renderBaseSelect(sel *qcode.Select, ti *DBTableInfo, r
 				return err
 			}
 		}
+		c.renderRawWhere(ti, true)
 		io.WriteString(c.w, `)`)
 	}
 
-	if isAgg && len(realColsRendered) != 0 {
+	if len(sel.GroupBy) != 0 {
+		if err := c.renderGroupBy(sel, ti, realColsRendered, childCols); err != nil {
+			return err
+		}
+
+	} else if isAgg && len(realColsRendered) != 0 {
 		io.WriteString(c.w, ` GROUP BY `)
 
 		for i, id := range realColsRendered {
@@ -763,7 +1288,8 @@ func (c *compilerContext) renderBaseSelect(sel *qcode.Select, ti *DBTableInfo, r
 		}
 	}
 
-	if hasOrder {
+	// the rows are grouped into the count
+	if hasOrder && !isCountOnly(sel) {
 		if err := c.renderOrderBy(sel, ti); err != nil {
 			return err
 		}
@@ -773,6 +1299,11 @@ func (c *compilerContext) renderBaseSelect(sel *qcode.Select, ti *DBTableInfo, r
 	case ti.IsSingular:
 		io.WriteString(c.w, ` LIMIT ('1') :: integer`)
 
+	case sel.Paging.LimitVar != "":
+		io.WriteString(c.w, ` LIMIT (`)
+		c.md.renderParam(c.w, pagingParam(sel.Paging.LimitVar, sel.Paging.Limit))
+		io.WriteString(c.w, `) :: integer`)
+
 	case sel.Paging.Limit != "":
 		io.WriteString(c.w, ` LIMIT ('`)
 		io.WriteString(c.w, sel.Paging.Limit)
@@ -786,10 +1317,9 @@ func (c *compilerContext) renderBaseSelect(sel *qcode.Select, ti *DBTableInfo, r
 	}
 
 	if sel.Paging.Offset != "" {
-		//fmt.Fprintf(w, ` OFFSET ('%s') :: integer`, c.sel.Paging.Offset)
-		io.WriteString(c.w, ` OFFSET ('`)
-		io.WriteString(c.w, sel.Paging.Offset)
-		io.WriteString(c.w, `') :: integer`)
+		io.WriteString(c.w, ` OFFSET (`)
+		c.md.renderParam(c.w, pagingParam(sel.Paging.Offset, ""))
+		io.WriteString(c.w, `) :: integer`)
 	}
 
 	return nil
@@ -799,18 +1329,14 @@ func (c *compilerContext) renderFrom(sel *qcode.Select, ti *DBTableInfo, rel *DB
 	if rel != nil && rel.Type == RelEmbedded {
 		// jsonb_to_recordset('[{"a":1,"b":[1,2,3],"c":"bar"}, {"a":2,"b":[1,2,3],"c":"bar"}]') as x(a int, b text, d text);
 
-		io.WriteString(c.w, `"`)
-		io.WriteString(c.w, rel.Left.Table)
-		io.WriteString(c.w, `", `)
+		quoted(c.w, rel.Left.Table)
+		io.WriteString(c.w, `, `)
 
 		io.WriteString(c.w, ti.Type)
 		io.WriteString(c.w, `_to_recordset(`)
 		colWithTable(c.w, rel.Left.Table, rel.Right.Col)
-		io.WriteString(c.w, `) AS `)
-
-		io.WriteString(c.w, `"`)
-		io.WriteString(c.w, ti.Name)
-		io.WriteString(c.w, `"`)
+		io.WriteString(c.w, `)`)
+		alias(c.w, ti.Name)
 
 		io.WriteString(c.w, `(`)
 		for i, col := range ti.Columns {
@@ -823,20 +1349,47 @@ func (c *compilerContext) renderFrom(sel *qcode.Select, ti *DBTableInfo, rel *DB
 		}
 		io.WriteString(c.w, `)`)
 
+	} else if ti.Type == "sql" {
+		if err := c.renderSQLTable(sel, ti); err != nil {
+			return err
+		}
+
+	} else if sel.Func != "" {
+		if err := c.renderTableFunc(sel, ti); err != nil {
+			return err
+		}
+
 	} else {
 		//fmt.Fprintf(w, ` FROM "%s"`, c.sel.Name)
-		io.WriteString(c.w, `"`)
-		io.WriteString(c.w, ti.Name)
-		io.WriteString(c.w, `"`)
+		c.renderSelTable(c.w, sel, ti)
 	}
 
 	if sel.Paging.Cursor {
 		io.WriteString(c.w, `, "__cur"`)
+
+		if c.hasWatermark(sel, ti) {
+			io.WriteString(c.w, `, "__wm"`)
+		}
 	}
 
 	return nil
 }
 
+// renderRowCursor renders the cursor of a row, it's the values of the order by
+// columns of the row in the same form as the cursor of the selection
+func (c *compilerContext) renderRowCursor(sel *qcode.Select, ti *DBTableInfo) {
+	io.WriteString(c.w, `CONCAT_WS(','`)
+	for _, ob := range sel.OrderBy {
+		io.WriteString(c.w, `, `)
+		colWithTableID(c.w, ti.Name, sel.ID, ob.Col)
+	}
+	if c.hasWatermark(sel, ti) {
+		io.WriteString(c.w, `, `)
+		c.renderWatermark(sel, ti, len(sel.OrderBy))
+	}
+	io.WriteString(c.w, `)`)
+}
+
 func (c *compilerContext) renderCursorCTE(sel *qcode.Select, ti *DBTableInfo) error {
 	io.WriteString(c.w, `WITH "__cur" AS (SELECT `)
 	for i, ob := range sel.OrderBy {
@@ -857,9 +1410,73 @@ func (c *compilerContext) renderCursorCTE(sel *qcode.Select, ti *DBTableInfo) er
 	io.WriteString(c.w, ` FROM string_to_array(`)
 	c.md.renderParam(c.w, Param{Name: "cursor", Type: "text"})
 	io.WriteString(c.w, `, ',') as a) `)
+
+	// the watermark is the value after those of the order by columns
+	if c.hasWatermark(sel, ti) {
+		io.WriteString(c.w, `, "__wm" AS (SELECT a[`)
+		int32String(c.w, int32(len(sel.OrderBy)+1))
+		io.WriteString(c.w, `] :: `)
+		io.WriteString(c.w, ti.PrimaryCol.Type)
+		io.WriteString(c.w, ` as `)
+		quoted(c.w, ti.PrimaryCol.Name)
+		io.WriteString(c.w, ` FROM string_to_array(`)
+		c.md.renderParam(c.w, Param{Name: "cursor", Type: "text"})
+		io.WriteString(c.w, `, ',') as a) `)
+	}
 	return nil
 }
 
+// hasWatermark returns true if the cursor of the selection has a watermark,
+// the rows of an integer primary key are added in order so the max is the
+// last row that existed when the first page was fetched
+func (c *compilerContext) hasWatermark(sel *qcode.Select, ti *DBTableInfo) bool {
+	return c.wmark && sel.Paging.Type != qcode.PtOffset &&
+		ti.PrimaryCol.Name != "" && isIntType(ti.PrimaryCol.Type)
+}
+
+// renderWatermark renders the watermark of the cursor, the one in the cursor
+// sent or the max primary key of the table for the first page. n is the
+// number of order by values in the cursor before it
+func (c *compilerContext) renderWatermark(sel *qcode.Select, ti *DBTableInfo, n int) {
+	io.WriteString(c.w, `COALESCE(`)
+	if sel.Paging.Cursor {
+		io.WriteString(c.w, `NULLIF(split_part(`)
+		c.md.renderParam(c.w, Param{Name: "cursor", Type: "text"})
+		io.WriteString(c.w, `, ',', `)
+		int32String(c.w, int32(n+1))
+		io.WriteString(c.w, `), ''), `)
+	}
+	io.WriteString(c.w, `(SELECT max(`)
+	quoted(c.w, ti.PrimaryCol.Name)
+	io.WriteString(c.w, `) :: text FROM `)
+	c.renderTable(c.w, ti.Name)
+	io.WriteString(c.w, `))`)
+}
+
+// addWatermarkPredicate skips the rows added after the
+// watermark, there's none for cursors without one
+func (c *compilerContext) addWatermarkPredicate(sel *qcode.Select, ti *DBTableInfo) {
+	isnull := qcode.NewFilter()
+	isnull.Op = qcode.OpIsNull
+	isnull.Type = qcode.ValRef
+	isnull.Table = "__wm"
+	isnull.Col = ti.PrimaryCol.Name
+	isnull.Val = "true"
+
+	f := qcode.NewFilter()
+	f.Op = qcode.OpLesserOrEquals
+	f.Type = qcode.ValRef
+	f.Table = "__wm"
+	f.Col = ti.PrimaryCol.Name
+	f.Val = ti.PrimaryCol.Name
+
+	or := qcode.NewFilter()
+	or.Op = qcode.OpOr
+	or.Children = append(or.Children, isnull, f)
+
+	qcode.AddFilter(sel, or)
+}
+
 func (c *compilerContext) renderRelationshipByName(table, parent string) error {
 	rel, err := c.schema.GetRel(table, parent)
 	if err != nil {
@@ -944,7 +1561,7 @@ func (c *compilerContext) renderRelationship(sel *qcode.Select, rel *DBRel) erro
 		io.WriteString(c.w, `) AND (`)
 		colWithTableID(c.w, rel.Left.Table, pid, rel.Right.Table)
 		io.WriteString(c.w, `) = (`)
-		squoted(c.w, ti.Name)
+		squoted(c.w, c.schema.polyType(c.s[sel.ParentID].Name, ti.Name))
 	}
 
 	io.WriteString(c.w, `))`)
@@ -1013,7 +1630,12 @@ func (c *compilerContext) renderExp(ex *qcode.Exp, ti *DBTableInfo, skipNested b
 				st.Push(qcode.OpNot)
 
 			default:
-				if !skipNested && len(val.NestedCols) != 0 {
+				if col, ok := c.jsonExpCol(val, ti); ok && !skipNested {
+					if err := c.renderJSONOp(val, ti, col); err != nil {
+						return err
+					}
+
+				} else if !skipNested && len(val.NestedCols) != 0 {
 					io.WriteString(c.w, `EXISTS `)
 
 					if err := c.renderNestedWhere(val, ti); err != nil {
@@ -1046,7 +1668,11 @@ func (c *compilerContext) renderNestedWhere(ex *qcode.Exp, ti *DBTableInfo) erro
 		}
 
 		io.WriteString(c.w, `(SELECT 1 FROM `)
-		io.WriteString(c.w, cti.Name)
+		if cti.Schema != "" {
+			c.renderTable(c.w, cti.Name)
+		} else {
+			io.WriteString(c.w, cti.Name)
+		}
 
 		if err := c.renderJoinByName(cti.Name, ti.Name, -1); err != nil {
 			return err
@@ -1094,17 +1720,61 @@ func (c *compilerContext) renderOp(ex *qcode.Exp, ti *DBTableInfo) error {
 			return fmt.Errorf("where clause: %w", err)
 		}
 
+		if ex.Op == qcode.OpStDWithin {
+			return c.renderDWithin(ex, ti, col)
+		}
+
 		io.WriteString(c.w, `((`)
 		if ex.Type == qcode.ValRef && ex.Op == qcode.OpIsNull {
 			colWithTable(c.w, ex.Table, ex.Col)
 		} else {
-			colWithTable(c.w, ti.Name, ex.Col)
+			colWithTable(c.w, ti.Name, col.Name)
 		}
 		io.WriteString(c.w, `) `)
 	}
 
 	switch ex.Op {
-	case qcode.OpEquals:
+	case qcode.OpIsNull:
+		if strings.EqualFold(ex.Val, "true") {
+			io.WriteString(c.w, `IS NULL)`)
+		} else {
+			io.WriteString(c.w, `IS NOT NULL)`)
+		}
+		return nil
+
+	case qcode.OpEqID:
+		if ti.PrimaryCol == nil {
+			return fmt.Errorf("no primary key column defined for %s", ti.Name)
+		}
+		col = ti.PrimaryCol
+		//fmt.Fprintf(w, `(("%s") =`, c.ti.PrimaryCol)
+		io.WriteString(c.w, `((`)
+		colWithTable(c.w, ti.Name, ti.PrimaryCol.Name)
+		//io.WriteString(c.w, ti.PrimaryCol)
+		io.WriteString(c.w, `) `)
+
+	case qcode.OpTsQuery:
+		if !ti.HasSearch() {
+			return fmt.Errorf("no tsv column defined for %s", ti.Name)
+		}
+		//fmt.Fprintf(w, `(("%s") @@ websearch_to_tsquery('%s'))`, c.ti.TSVCol, val.Val)
+		io.WriteString(c.w, `((`)
+		c.renderTSV(ti)
+		io.WriteString(c.w, `) @@ `)
+		c.renderTSQuery(ex.Val, ex.Type == qcode.ValVar)
+		io.WriteString(c.w, `)`)
+
+		return nil
+	}
+
+	return c.renderOpVal(ex, col)
+}
+
+// renderOpVal renders the operator and the value of the expression
+// cast to the type of the column
+func (c *compilerContext) renderOpVal(ex *qcode.Exp, col *DBColumn) error {
+	switch ex.Op {
+	case qcode.OpEquals, qcode.OpEqID:
 		io.WriteString(c.w, `=`)
 	case qcode.OpNotEquals:
 		io.WriteString(c.w, `!=`)
@@ -1146,42 +1816,14 @@ func (c *compilerContext) renderOp(ex *qcode.Exp, ti *DBTableInfo) error {
 		io.WriteString(c.w, `?|`)
 	case qcode.OpHasKeyAll:
 		io.WriteString(c.w, `?&`)
-	case qcode.OpIsNull:
-		if strings.EqualFold(ex.Val, "true") {
-			io.WriteString(c.w, `IS NULL)`)
-		} else {
-			io.WriteString(c.w, `IS NOT NULL)`)
-		}
-		return nil
-
-	case qcode.OpEqID:
-		if ti.PrimaryCol == nil {
-			return fmt.Errorf("no primary key column defined for %s", ti.Name)
-		}
-		col = ti.PrimaryCol
-		//fmt.Fprintf(w, `(("%s") =`, c.ti.PrimaryCol)
-		io.WriteString(c.w, `((`)
-		colWithTable(c.w, ti.Name, ti.PrimaryCol.Name)
-		//io.WriteString(c.w, ti.PrimaryCol)
-		io.WriteString(c.w, `) =`)
-
-	case qcode.OpTsQuery:
-		if ti.PrimaryCol == nil {
-			return fmt.Errorf("no tsv column defined for %s", ti.Name)
-		}
-		//fmt.Fprintf(w, `(("%s") @@ websearch_to_tsquery('%s'))`, c.ti.TSVCol, val.Val)
-		io.WriteString(c.w, `((`)
-		colWithTable(c.w, ti.Name, ti.TSVCol.Name)
-		if c.schema.ver >= 110000 {
-			io.WriteString(c.w, `) @@ websearch_to_tsquery(`)
-		} else {
-			io.WriteString(c.w, `) @@ to_tsquery(`)
+	case qcode.OpBetween:
+		if col == nil {
+			return errors.New("no column found for expression value")
 		}
-		c.md.renderParam(c.w, Param{Name: ex.Val, Type: "text"})
-		io.WriteString(c.w, `))`)
-
+		io.WriteString(c.w, `BETWEEN`)
+		c.renderBetween(ex, col)
+		io.WriteString(c.w, `)`)
 		return nil
-
 	default:
 		return fmt.Errorf("[Where] unexpected op code %d", ex.Op)
 	}
@@ -1206,28 +1848,137 @@ func (c *compilerContext) renderOrderBy(sel *qcode.Select, ti *DBTableInfo) erro
 			io.WriteString(c.w, `, `)
 		}
 		ob := sel.OrderBy[i]
-		colWithTable(c.w, ti.Name, ob.Col)
-
-		switch ob.Order {
-		case qcode.OrderAsc:
-			io.WriteString(c.w, ` ASC`)
-		case qcode.OrderDesc:
-			io.WriteString(c.w, ` DESC`)
-		case qcode.OrderAscNullsFirst:
-			io.WriteString(c.w, ` ASC NULLS FIRST`)
-		case qcode.OrderDescNullsFirst:
-			io.WriteString(c.w, ` DESC NULLLS FIRST`)
-		case qcode.OrderAscNullsLast:
-			io.WriteString(c.w, ` ASC NULLS LAST`)
-		case qcode.OrderDescNullsLast:
-			io.WriteString(c.w, ` DESC NULLS LAST`)
-		default:
-			return fmt.Errorf("13: unexpected value %v", ob.Order)
+
+		col := func() {
+			// the rank and the order expressions are columns of the select
+			if isSearchRank(sel, ti, ob.Col) || isOrderExp(ti, ob.Col) {
+				quoted(c.w, ob.Col)
+			} else {
+				colWithTable(c.w, ti.Name, ti.ColumnName(ob.Col))
+			}
 		}
+
+		if ob.Var != "" {
+			if err := orderVarAllowed(sel, ob); err != nil {
+				return err
+			}
+			p := Param{Name: qcode.OrderParam(ob.Var), Type: "text"}
+
+			// the column is null for every row in the other
+			// case so only the one set orders the rows
+			io.WriteString(c.w, `CASE WHEN `)
+			c.md.renderParam(c.w, p)
+			io.WriteString(c.w, ` = 'asc' THEN `)
+			col()
+			io.WriteString(c.w, ` END ASC, CASE WHEN `)
+			c.md.renderParam(c.w, p)
+			io.WriteString(c.w, ` = 'desc' THEN `)
+			col()
+			io.WriteString(c.w, ` END DESC`)
+			continue
+		}
+
+		col()
+
+		if err := c.renderOrder(ob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderVarAllowed returns an error when the order of the column can't be
+// set from a variable, the rows of a page of a cursor are found with it
+func orderVarAllowed(sel *qcode.Select, ob *qcode.OrderBy) error {
+	if sel.Paging.Type != qcode.PtOffset {
+		return fmt.Errorf("order_by: %s: a variable can't be used with cursor pagination", ob.Col)
+	}
+	return nil
+}
+
+// pagingParam returns the param of a limit or offset variable,
+// the value is clamped to the max when the query is run
+func pagingParam(name, max string) Param {
+	n, _ := strconv.Atoi(max)
+	return Param{Name: qcode.PagingParam(n, name), Type: "integer"}
+}
+
+func (c *compilerContext) renderOrder(ob *qcode.OrderBy) error {
+	if ob.Var != "" {
+		return fmt.Errorf("order_by: %s: a variable can't be used here", ob.Col)
+	}
+
+	switch ob.Order {
+	case qcode.OrderAsc:
+		io.WriteString(c.w, ` ASC`)
+	case qcode.OrderDesc:
+		io.WriteString(c.w, ` DESC`)
+	case qcode.OrderAscNullsFirst:
+		io.WriteString(c.w, ` ASC NULLS FIRST`)
+	case qcode.OrderDescNullsFirst:
+		io.WriteString(c.w, ` DESC NULLLS FIRST`)
+	case qcode.OrderAscNullsLast:
+		io.WriteString(c.w, ` ASC NULLS LAST`)
+	case qcode.OrderDescNullsLast:
+		io.WriteString(c.w, ` DESC NULLS LAST`)
+	default:
+		return fmt.Errorf("13: unexpected value %v", ob.Order)
+	}
+	return nil
+}
+
+// renderGroupBy renders the group_by argument, the columns selected, ordered by
+// and needed to join the children must all be grouped
+func (c *compilerContext) renderGroupBy(sel *qcode.Select, ti *DBTableInfo,
+	realCols []int, childCols []*qcode.Column) error {
+
+	if sel.Paging.Type != qcode.PtOffset {
+		return fmt.Errorf("group_by: cannot be used with cursor pagination")
+	}
+
+	for _, cn := range sel.GroupBy {
+		if err := ColumnAccess(ti, sel, cn, true); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range realCols {
+		if !grouped(sel, sel.Cols[id].Name) {
+			return fmt.Errorf("group_by: column '%s' must be grouped or aggregated", sel.Cols[id].Name)
+		}
+	}
+
+	for _, ob := range sel.OrderBy {
+		if !grouped(sel, ob.Col) {
+			return fmt.Errorf("group_by: cannot order by column '%s' that is not grouped", ob.Col)
+		}
+	}
+
+	for _, col := range childCols {
+		if col.Table == ti.Name && !grouped(sel, col.Name) {
+			return fmt.Errorf("group_by: column '%s' is needed to fetch the nested tables and must be grouped", col.Name)
+		}
+	}
+
+	io.WriteString(c.w, ` GROUP BY `)
+
+	for i, cn := range sel.GroupBy {
+		c.renderComma(i)
+		colWithTable(c.w, ti.Name, cn)
 	}
+
 	return nil
 }
 
+func grouped(sel *qcode.Select, cn string) bool {
+	for _, v := range sel.GroupBy {
+		if v == cn {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *compilerContext) renderDistinctOn(sel *qcode.Select, ti *DBTableInfo) {
 	io.WriteString(c.w, `DISTINCT ON (`)
 	for i := range sel.DistinctOn {
@@ -1257,6 +2008,73 @@ func (c *compilerContext) renderList(ex *qcode.Exp) {
 	io.WriteString(c.w, `])`)
 }
 
+// renderBetween renders the two values of the between operator from
+// a list or a variable with a list of two values
+func (c *compilerContext) renderBetween(ex *qcode.Exp, col *DBColumn) {
+	for i := 0; i < 2; i++ {
+		if i != 0 {
+			io.WriteString(c.w, ` AND`)
+		}
+		io.WriteString(c.w, ` `)
+
+		switch {
+		case ex.Type == qcode.ValVar:
+			io.WriteString(c.w, `(`)
+			c.md.renderParam(c.w, Param{Name: ex.Val, Type: col.Type, IsArray: true})
+			io.WriteString(c.w, ` :: json ->> `)
+			int32String(c.w, int32(i))
+			io.WriteString(c.w, `)`)
+
+		case ex.ListType == qcode.ValStr:
+			squoted(c.w, ex.ListVal[i])
+
+		default:
+			io.WriteString(c.w, ex.ListVal[i])
+		}
+
+		io.WriteString(c.w, ` :: `)
+		io.WriteString(c.w, col.Type)
+	}
+}
+
+// renderDWithin renders the st_dwithin operator of a geometry or geography
+// column, the point is in longitude and latitude (SRID 4326)
+func (c *compilerContext) renderDWithin(ex *qcode.Exp, ti *DBTableInfo, col *DBColumn) error {
+	gt := GeoType(col.Type)
+	if gt == "" {
+		return fmt.Errorf("where clause: st_dwithin: column '%s' is not a geometry or geography", col.Name)
+	}
+
+	io.WriteString(c.w, `(ST_DWithin(`)
+	colWithTable(c.w, ti.Name, col.Name)
+	io.WriteString(c.w, `, `)
+
+	if ex.ListType == qcode.ValVar {
+		io.WriteString(c.w, `ST_SetSRID(ST_GeomFromGeoJSON(`)
+		c.md.renderParam(c.w, Param{Name: ex.ListVal[0], Type: gt})
+		io.WriteString(c.w, `), 4326)`)
+	} else {
+		io.WriteString(c.w, `ST_SetSRID(ST_MakePoint(`)
+		io.WriteString(c.w, ex.ListVal[0])
+		io.WriteString(c.w, `, `)
+		io.WriteString(c.w, ex.ListVal[1])
+		io.WriteString(c.w, `), 4326)`)
+	}
+	io.WriteString(c.w, ` :: `)
+	io.WriteString(c.w, gt)
+	io.WriteString(c.w, `, `)
+
+	if ex.Type == qcode.ValVar {
+		c.md.renderParam(c.w, Param{Name: ex.Val, Type: "float8"})
+		io.WriteString(c.w, ` :: float8`)
+	} else {
+		io.WriteString(c.w, ex.Val)
+	}
+	io.WriteString(c.w, `))`)
+
+	return nil
+}
+
 func (c *compilerContext) renderVal(ex *qcode.Exp, vars map[string]string, col *DBColumn) {
 	io.WriteString(c.w, ` `)
 
@@ -1282,6 +2100,12 @@ func (c *compilerContext) renderVal(ex *qcode.Exp, vars map[string]string, col *
 			io.WriteString(c.w, `[])`)
 			return
 
+		case GeoType(col.Type) != "":
+			// geometries are set as GeoJSON
+			io.WriteString(c.w, `ST_GeomFromGeoJSON(`)
+			c.md.renderParam(c.w, Param{Name: ex.Val, Type: col.Type, IsArray: false})
+			io.WriteString(c.w, `)`)
+
 		default:
 			c.md.renderParam(c.w, Param{Name: ex.Val, Type: col.Type, IsArray: false})
 		}
@@ -1309,12 +2133,12 @@ func funcPrefixLen(fm map[string]*DBFunction, fn string) int {
 		return 4
 	case strings.HasPrefix(fn, "sum_"):
 		return 4
-	case strings.HasPrefix(fn, "stddev_"):
-		return 7
 	case strings.HasPrefix(fn, "stddev_pop_"):
 		return 11
 	case strings.HasPrefix(fn, "stddev_samp_"):
 		return 12
+	case strings.HasPrefix(fn, "stddev_"):
+		return 7
 	case strings.HasPrefix(fn, "variance_"):
 		return 9
 	case strings.HasPrefix(fn, "var_pop_"):
@@ -1334,48 +2158,88 @@ func funcPrefixLen(fm map[string]*DBFunction, fn string) int {
 }
 
 func alias(w io.Writer, alias string) {
-	io.WriteString(w, ` AS "`)
-	io.WriteString(w, alias)
-	io.WriteString(w, `"`)
+	io.WriteString(w, ` AS `)
+	quoted(w, alias)
 }
 
 func aliasWithID(w io.Writer, alias string, id int32) {
 	io.WriteString(w, ` AS "`)
-	io.WriteString(w, alias)
+	escapeIdent(w, alias)
 	io.WriteString(w, `_`)
 	int32String(w, id)
 	io.WriteString(w, `"`)
 }
 
 func colWithTable(w io.Writer, table, col string) {
-	io.WriteString(w, `"`)
-	io.WriteString(w, table)
-	io.WriteString(w, `"."`)
-	io.WriteString(w, col)
-	io.WriteString(w, `"`)
+	quoted(w, table)
+	io.WriteString(w, `.`)
+	quoted(w, col)
 }
 
 func colWithTableID(w io.Writer, table string, id int32, col string) {
 	io.WriteString(w, `"`)
-	io.WriteString(w, table)
+	escapeIdent(w, table)
 	if id >= 0 {
 		io.WriteString(w, `_`)
 		int32String(w, id)
 	}
-	io.WriteString(w, `"."`)
-	io.WriteString(w, col)
-	io.WriteString(w, `"`)
+	io.WriteString(w, `".`)
+	quoted(w, col)
+}
+
+// renderTSV renders the tsvector column or expression of the table
+func (c *compilerContext) renderTSV(ti *DBTableInfo) {
+	if ti.TSVExp != "" {
+		io.WriteString(c.w, ti.TSVExp)
+		return
+	}
+	colWithTable(c.w, ti.Name, ti.TSVCol.Name)
+}
+
+// renderTSQuery renders the search text from a variable or a string as a
+// tsquery, websearch_to_tsquery needs Postgres 11 or later
+func (c *compilerContext) renderTSQuery(val string, isVar bool) {
+	if c.schema.ver >= 110000 {
+		io.WriteString(c.w, `websearch_to_tsquery(`)
+	} else {
+		io.WriteString(c.w, `to_tsquery(`)
+	}
+
+	if isVar {
+		c.md.renderParam(c.w, Param{Name: val, Type: "text"})
+	} else {
+		squoted(c.w, val)
+	}
+	io.WriteString(c.w, `)`)
 }
 
+// quoted renders the identifier in double quotes so any name is safe
+// (eg. with uppercase, spaces or a reserved word), the double quotes
+// in it are doubled
 func quoted(w io.Writer, identifier string) {
 	io.WriteString(w, `"`)
-	io.WriteString(w, identifier)
+	escapeIdent(w, identifier)
 	io.WriteString(w, `"`)
 }
 
-func squoted(w io.Writer, identifier string) {
+// escapeIdent renders the identifier with the double quotes in it doubled,
+// for the names quoted along with a suffix (eg. "products_1")
+func escapeIdent(w io.Writer, identifier string) {
+	if strings.IndexByte(identifier, '"') == -1 {
+		io.WriteString(w, identifier)
+	} else {
+		io.WriteString(w, strings.Replace(identifier, `"`, `""`, -1))
+	}
+}
+
+// squoted renders a string literal, the single quotes in it are doubled
+func squoted(w io.Writer, s string) {
 	io.WriteString(w, `'`)
-	io.WriteString(w, identifier)
+	if strings.IndexByte(s, '\'') == -1 {
+		io.WriteString(w, s)
+	} else {
+		io.WriteString(w, strings.Replace(s, `'`, `''`, -1))
+	}
 	io.WriteString(w, `'`)
 }
 
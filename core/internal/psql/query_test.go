@@ -3,7 +3,12 @@ package psql_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
 )
 
 func simpleQuery(t *testing.T) {
@@ -133,6 +138,17 @@ func searchQuery(t *testing.T) {
 	compileGQLToPSQL(t, gql, nil, "admin")
 }
 
+func searchQueryString(t *testing.T) {
+	gql := `query {
+		products(search: "running shoes", order_by: { search_rank: desc }) {
+			id
+			search_rank
+		}
+	}`
+
+	compileGQLToPSQL(t, gql, nil, "admin")
+}
+
 func oneToMany(t *testing.T) {
 	gql := `query {
 		users {
@@ -255,6 +271,41 @@ func aggFunctionWithFilter(t *testing.T) {
 	compileGQLToPSQL(t, gql, nil, "user")
 }
 
+func aggFunctionGroupBy(t *testing.T) {
+	gql := `query {
+		products(group_by: name, order_by: { name: asc }) {
+			name
+			count_id
+			avg_price
+		}
+	}`
+
+	compileGQLToPSQL(t, gql, nil, "user")
+}
+
+func aggFunctionNotNumeric(t *testing.T) {
+	gql := `query {
+		products {
+			id
+			avg_name
+		}
+	}`
+
+	compileGQLToPSQLExpectErr(t, gql, nil, "user")
+}
+
+func aggFunctionNotGrouped(t *testing.T) {
+	gql := `query {
+		products(group_by: name) {
+			id
+			name
+			count_id
+		}
+	}`
+
+	compileGQLToPSQLExpectErr(t, gql, nil, "user")
+}
+
 func syntheticTables(t *testing.T) {
 	gql := `query {
 		me {
@@ -456,25 +507,36 @@ func subscription(t *testing.T) {
 	compileGQLToPSQL(t, gql, nil, "user")
 }
 
-// func withInlineFragment(t *testing.T) {
-// 	gql := `
-// 	query {
-// 		users {
-// 			... on users {
-// 				id
-// 				email
-// 			}
-// 			created_at
-// 			... on user {
-// 				first_name
-// 				last_name
-// 			}
-// 		}
-// 	}
-// `
-
-// 	compileGQLToPSQL(t, gql, nil, "anon")
-// }
+func withInlineFragment(t *testing.T) {
+	gql := `
+	query {
+		users {
+			...userFields2
+
+			avatar
+			... on userOutput {
+				...userFields1
+			}
+		}
+	}
+
+	fragment userFields2 on user {
+		... on users {
+			full_name
+		}
+	}
+
+	fragment userFields1 on user {
+		id
+		...userEmail
+	}
+
+	fragment userEmail on user {
+		email
+	}`
+
+	compileGQLToPSQL(t, gql, nil, "user")
+}
 
 func withCursor(t *testing.T) {
 	gql := `query {
@@ -493,6 +555,24 @@ func withCursor(t *testing.T) {
 	compileGQLToPSQL(t, gql, vars, "admin")
 }
 
+func withRowCursor(t *testing.T) {
+	gql := `query {
+		products(
+			first: 20
+			after: $cursor
+			order_by: { price: desc }) {
+			name
+			cursor
+		}
+	}`
+
+	vars := map[string]json.RawMessage{
+		"cursor": json.RawMessage(`"0,1"`),
+	}
+
+	compileGQLToPSQL(t, gql, vars, "admin")
+}
+
 func jsonColumnAsTable(t *testing.T) {
 	gql := `query {
 		products {
@@ -557,6 +637,7 @@ func TestCompileQuery(t *testing.T) {
 	t.Run("withWhereMultiOr", withWhereMultiOr)
 	t.Run("fetchByID", fetchByID)
 	t.Run("searchQuery", searchQuery)
+	t.Run("searchQueryString", searchQueryString)
 	t.Run("oneToMany", oneToMany)
 	t.Run("oneToManyReverse", oneToManyReverse)
 	t.Run("oneToManyArray", oneToManyArray)
@@ -566,6 +647,9 @@ func TestCompileQuery(t *testing.T) {
 	t.Run("aggFunctionBlockedByCol", aggFunctionBlockedByCol)
 	t.Run("aggFunctionDisabled", aggFunctionDisabled)
 	t.Run("aggFunctionWithFilter", aggFunctionWithFilter)
+	t.Run("aggFunctionGroupBy", aggFunctionGroupBy)
+	t.Run("aggFunctionNotNumeric", aggFunctionNotNumeric)
+	t.Run("aggFunctionNotGrouped", aggFunctionNotGrouped)
 	t.Run("syntheticTables", syntheticTables)
 	t.Run("queryWithVariables", queryWithVariables)
 	t.Run("withWhereOnRelations", withWhereOnRelations)
@@ -574,11 +658,13 @@ func TestCompileQuery(t *testing.T) {
 	t.Run("withFragment2", withFragment2)
 	t.Run("withFragment3", withFragment3)
 	t.Run("withFragment4", withFragment4)
+	t.Run("withInlineFragment", withInlineFragment)
 	t.Run("withPolymorphicUnion", withPolymorphicUnion)
 	t.Run("subscription", subscription)
 	// t.Run("withInlineFragment", withInlineFragment)
 	t.Run("jsonColumnAsTable", jsonColumnAsTable)
 	t.Run("withCursor", withCursor)
+	t.Run("withRowCursor", withRowCursor)
 	t.Run("nullForAuthRequiredInAnon", nullForAuthRequiredInAnon)
 	t.Run("blockedQuery", blockedQuery)
 	t.Run("blockedFunctions", blockedFunctions)
@@ -607,6 +693,177 @@ var benchGQL = []byte(`query {
 	}
 }`)
 
+func TestWhereColumnSuggestion(t *testing.T) {
+	gql := `query {
+		users(where: { emial: { eq: "a@b.com" } }) {
+			id
+		}
+	}`
+
+	qc, err := qcompile.Compile([]byte(gql), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = pcompile.CompileEx(qc, nil)
+	if err == nil {
+		t.Fatal(errors.New("we were expecting an error"))
+	}
+
+	if !strings.Contains(err.Error(), "did you mean 'email'?") {
+		t.Fatalf("expecting a suggestion, got: %s", err)
+	}
+}
+
+func TestRewriteView(t *testing.T) {
+	qc, err := qcode.NewCompiler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := qc.AddRewrite(qcode.RewriteConfig{Table: "purchases", View: "recent_purchases"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the view is joined to its parent and children with the
+	// relationships of the table
+	q, err := qc.Compile([]byte(`query {
+		customers { id purchases { id product { id } } }
+	}`), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sql, err := pcompile.CompileEx(q, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `FROM "recent_purchases" AS "purchases"`
+	if !strings.Contains(string(sql), exp) {
+		t.Fatalf("expected the view in: %s", sql)
+	}
+
+	if strings.Contains(string(sql), `FROM "purchases"`) {
+		t.Fatalf("expected the table to be replaced in: %s", sql)
+	}
+}
+
+func TestSearchExpression(t *testing.T) {
+	di := psql.GetTestDBInfo()
+	if err := di.SetSearch("products", `to_tsvector('english', "products"."name")`); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := psql.NewDBSchema(di, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc := psql.NewCompiler(psql.Config{Schema: schema})
+
+	qc, err := qcompile.Compile([]byte(`query { products(search: $query) { id search_rank } }`), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sql, err := pc.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `((to_tsvector('english', "products"."name")) @@ websearch_to_tsquery($1))`
+	if !strings.Contains(string(sql), exp) {
+		t.Fatalf("expected the search expression in: %s", sql)
+	}
+}
+
+func TestLenientMode(t *testing.T) {
+	gql := `query {
+		users {
+			id
+			emial
+			count_nothing
+		}
+	}`
+
+	qc, err := qcompile.Compile([]byte(gql), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := pcompile.CompileEx(qc, nil); err == nil {
+		t.Fatal(errors.New("we were expecting an error in strict mode"))
+	}
+
+	schema, err := psql.GetTestSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lenient := psql.NewCompiler(psql.Config{Schema: schema, Lenient: true})
+
+	qc, err = qcompile.Compile([]byte(gql), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md, sql, err := lenient.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(md.Warnings()) != 2 {
+		t.Fatalf("expected 2 warnings, got: %v", md.Warnings())
+	}
+
+	if strings.Contains(string(sql), "emial") {
+		t.Fatalf("expected the unknown field to be dropped: %s", sql)
+	}
+}
+
+func TestStreamQuery(t *testing.T) {
+	gql := `query {
+		products(limit: 5) {
+			id
+			user {
+				email
+			}
+		}
+	}`
+
+	qc, err := qcompile.Compile([]byte(gql), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var w bytes.Buffer
+
+	if _, err := pcompile.CompileWithMetadata(&w, qc, nil, psql.Metadata{Stream: true}); err != nil {
+		t.Fatal(err)
+	}
+	sql := w.String()
+
+	if !strings.HasPrefix(sql, `SELECT "__sj_0"."json" FROM (SELECT to_jsonb("__sr_0".*)`) ||
+		strings.Contains(sql, "jsonb_agg(\"__sj_0\"") || !strings.HasSuffix(sql, `AS "__sr_0") AS "__sj_0"`) {
+		t.Fatalf("expected the rows of products: %s", sql)
+	}
+
+	for _, gql := range []string{
+		`query { product { id } }`,
+		`query { products { id } users { id } }`,
+	} {
+		qc, err := qcompile.Compile([]byte(gql), "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := pcompile.CompileWithMetadata(&w, qc, nil, psql.Metadata{Stream: true}); err == nil {
+			t.Fatalf("expected an error for: %s", gql)
+		}
+	}
+}
+
 func BenchmarkCompile(b *testing.B) {
 	w := &bytes.Buffer{}
 
@@ -649,3 +906,754 @@ func BenchmarkCompileParallel(b *testing.B) {
 		}
 	})
 }
+
+func TestJSONKeys(t *testing.T) {
+	gql := `query {
+		customers(where: { and: [
+			{ metadata: { plan: { eq: "pro" } } },
+			{ metadata: { limits: { api_calls: { gt: 100 } } } }
+		] }) {
+			id
+			metadata {
+				plan
+				limits {
+					api_calls
+				}
+			}
+		}
+	}`
+
+	qc, err := qcompile.Compile([]byte(gql), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sql, err := pcompile.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		`(CASE WHEN jsonb_typeof(("customers_0"."metadata" :: jsonb)) = 'object' THEN jsonb_build_object('plan', ("customers_0"."metadata" :: jsonb) -> 'plan', 'limits', (CASE WHEN jsonb_typeof(("customers_0"."metadata" :: jsonb) -> 'limits') = 'object' THEN jsonb_build_object('api_calls', ("customers_0"."metadata" :: jsonb) -> 'limits' -> 'api_calls') END)) END) AS "metadata"`,
+		`SELECT "customers"."id", "customers"."metadata" FROM "customers"`,
+		`((("customers"."metadata" :: jsonb)) @> '{"plan":"pro"}' :: jsonb)`,
+		`(((("customers"."metadata" :: jsonb) -> 'limits' ->> 'api_calls') :: numeric) > '100' :: numeric)`,
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(string(sql), v) {
+			t.Fatalf("expected %s: %s", v, sql)
+		}
+	}
+
+	// metadata is not in the columns of customers for the user role
+	qc, err = qcompile.Compile([]byte(`query { customers { id metadata { plan } } }`), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := pcompile.CompileEx(qc, nil); err == nil {
+		t.Fatal("expected an error for a column the role cannot select")
+	}
+}
+
+func TestTableFunction(t *testing.T) {
+	gql := `query {
+		search_products(args: { q: "shoe", max_price: $max }, where: { id: { gt: 10 } }, limit: 5) {
+			id
+			name
+			user {
+				email
+			}
+		}
+	}`
+
+	qc, err := qcompile.Compile([]byte(gql), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sql, err := pcompile.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		`FROM "search_products"("q" => 'shoe' :: text,"max_price" => $1 :: numeric) AS "products"`,
+		`(("products"."price") > '0' :: numeric(7,2))`,
+		`(("products"."id") > '10' :: bigint)`,
+		`LIMIT ('5') :: integer`,
+		`jsonb_build_object('search_products', "__sj_0"."json")`,
+		`(("users"."id") = ("products_0"."user_id"))`,
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(string(sql), v) {
+			t.Fatalf("expected %s: %s", v, sql)
+		}
+	}
+
+	qc, err = qcompile.Compile([]byte(`query { search_products(args: { term: "shoe" }) { id } }`), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := pcompile.CompileEx(qc, nil); err == nil {
+		t.Fatal("expected an error for an unknown function argument")
+	}
+
+	if _, err := qcompile.Compile([]byte(`query { products(args: { q: "shoe" }) { id } }`), "user"); err == nil {
+		t.Fatal("expected an error for args on a table")
+	}
+}
+
+func TestRecursiveFind(t *testing.T) {
+	gql := `query {
+		comment(id: $id) {
+			id
+			replies: comments(find: "children", order_by: { id: desc }) {
+				id
+				body
+			}
+			parents: comments(find: "parents") {
+				id
+			}
+		}
+	}`
+
+	qc, err := qcompile.Compile([]byte(gql), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	co := psql.NewCompiler(psql.Config{Schema: pcompile.Schema(), RecursiveDepth: 2})
+
+	_, sql, err := co.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		`(WITH RECURSIVE "__rcte_2" AS (SELECT "comments"."id", "comments"."parent_id", "comments"."body", 1 AS "__depth", ARRAY["comments"."id"] AS "__path" FROM "comments" WHERE (("comments"."parent_id") = ("comments_0"."id"))`,
+		`AND ("__rcte_2"."__depth" < 2) AND NOT ("comments"."id" = ANY("__rcte_2"."__path"))`,
+		`'replies', NULL) ORDER BY "__rcte_2_2"."id" DESC), '[]') FROM "__rcte_2" AS "__rcte_2_2" WHERE ("__rcte_2_2"."__depth" = 2) AND (("__rcte_2_2"."parent_id") = ("__rcte_2_1"."id"))`,
+		`WHERE (("comments"."id") = ("comments_0"."parent_id"))`,
+		`(("__rcte_1_2"."id") = ("__rcte_1_1"."parent_id"))`,
+		`SELECT "comments"."id", "comments"."parent_id" FROM "comments"`,
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(string(sql), v) {
+			t.Fatalf("expected %s: %s", v, sql)
+		}
+	}
+
+	// products is not related to itself
+	qc, err = qcompile.Compile([]byte(`query { product(id: $id) { id products(find: "children") { id } } }`), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := pcompile.CompileEx(qc, nil); err == nil {
+		t.Fatal("expected an error for a table not related to itself")
+	}
+
+	if _, err := qcompile.Compile([]byte(`query { comments(find: "children") { id } }`), "admin"); err == nil {
+		t.Fatal("expected an error for find on a root selection")
+	}
+}
+
+func TestTranslatedColumn(t *testing.T) {
+	gql := `query {
+		tags {
+			id
+			title
+		}
+	}`
+
+	qc, err := qcompile.Compile([]byte(gql), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md, sql, err := pcompile.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `(SELECT "tags"."title" ->> "__sg_l"."l" FROM json_array_elements_text($1 :: json) WITH ORDINALITY AS "__sg_l"("l", "n") WHERE ("tags"."title" ->> "__sg_l"."l") IS NOT NULL ORDER BY "__sg_l"."n" LIMIT 1) AS "title"`
+
+	if !strings.Contains(string(sql), exp) {
+		t.Fatalf("expected %s: %s", exp, sql)
+	}
+
+	if p := md.Params(); len(p) != 1 || p[0].Name != psql.LocalesParam {
+		t.Fatalf("expected the locales param: %v", p)
+	}
+}
+
+func TestCanFields(t *testing.T) {
+	gql := `query {
+		products {
+			id
+			_can_update
+			_can_delete
+		}
+	}`
+
+	qc, err := qcompile.Compile([]byte(gql), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sql, err := pcompile.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		`COALESCE((("products"."user_id") = $1 :: bigint), false) AS "_can_update"`,
+		`COALESCE(((("products"."price") > '0' :: numeric(7,2)) AND (("products"."price") < '8' :: numeric(7,2))), false) AS "_can_delete"`,
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(string(sql), v) {
+			t.Fatalf("expected %s: %s", v, sql)
+		}
+	}
+
+	qc, err = qcompile.Compile([]byte(`query { users { id _can_update _can_delete } }`), "bad_dude")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, sql, err = pcompile.CompileEx(qc, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `false AS "_can_update", true AS "_can_delete"`; !strings.Contains(string(sql), exp) {
+		t.Fatalf("expected %s: %s", exp, sql)
+	}
+}
+
+func TestNamedFilters(t *testing.T) {
+	tests := []struct {
+		gql, exp string
+	}{
+		{`query { products(where: { and: [{ filter: cheap }, { id: { gt: 5 } }] }) { id } }`,
+			`WHERE (((("products"."id") > '5' :: bigint) AND (("products"."price") < '10' :: numeric(7,2))))`},
+		{`query { products(where: { filter: [mine, cheap] }) { id } }`,
+			`WHERE (((("products"."user_id") = $1 :: bigint) AND (("products"."price") < '10' :: numeric(7,2))))`},
+	}
+
+	for _, v := range tests {
+		qc, err := qcompile.Compile([]byte(v.gql), "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, sql, err := pcompile.CompileEx(qc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(sql), v.exp) {
+			t.Errorf("expected %s: %s", v.exp, sql)
+		}
+	}
+
+	if _, err := qcompile.Compile([]byte(`query { products(where: { filter: pricey }) { id } }`), "admin"); err == nil {
+		t.Fatal("expected an error for an unknown filter")
+	}
+
+	// anon has no user id for the filter
+	qc, err := qcompile.Compile([]byte(`query { products(where: { filter: mine }) { id } }`), "anon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qc.Selects[0].SkipRender != qcode.SkipTypeUserNeeded {
+		t.Fatal("expected the selection to be skipped for anon")
+	}
+}
+
+func TestCursorWatermark(t *testing.T) {
+	schema, err := psql.NewDBSchema(psql.GetTestDBInfo(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc := psql.NewCompiler(psql.Config{Schema: schema, CursorWatermark: true})
+
+	qc, err := qcompile.Compile([]byte(`query {
+		products(first: 20, after: $cursor, order_by: { price: desc }) {
+			name
+			cursor
+		}
+	}`), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sql, err := pc.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		// the watermark of the first page is the max id
+		`COALESCE(NULLIF(split_part($1, ',', 3), ''), (SELECT max("id") :: text FROM "products"))`,
+		`"__wm" AS (SELECT a[3] :: bigint as "id" FROM string_to_array($1, ',') as a)`,
+		`((("__wm"."id") IS NULL) OR (("products"."id") <= "__wm"."id" :: bigint))`,
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(string(sql), v) {
+			t.Fatalf("expected %s: %s", v, sql)
+		}
+	}
+
+	// no watermark with offset pagination
+	qc, err = qcompile.Compile([]byte(`query { products(limit: 20, offset: $offset) { name } }`), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, sql, err = pc.CompileEx(qc, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(sql), "max(") {
+		t.Fatalf("unexpected watermark: %s", sql)
+	}
+}
+
+func TestJoinSubquery(t *testing.T) {
+	schema, err := psql.NewDBSchema(psql.GetTestDBInfo(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc := psql.NewCompiler(psql.Config{
+		Schema: schema,
+		Joins: map[string]map[string]psql.JoinStrategy{
+			"products": {"users": psql.JoinSubquery, "customers": psql.JoinSubquery},
+		},
+	})
+
+	qc, err := qcompile.Compile([]byte(`query {
+		products(limit: 20) {
+			name
+			user { full_name }
+			customers(limit: 5) { email }
+		}
+	}`), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sql, err := pc.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		`(SELECT "__sj_2"."json" FROM (SELECT to_jsonb("__sr_2".*) AS "json" FROM (SELECT "users_2"."full_name" AS "full_name" FROM (SELECT "users"."full_name" FROM "users" WHERE ((("users"."id") = ("products_0"."user_id"))) LIMIT ('1') :: integer) AS "users_2") AS "__sr_2") AS "__sj_2") AS "user"`,
+		`(SELECT "__sj_1"."json" FROM (SELECT coalesce(jsonb_agg("__sj_1"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_1".*) AS "json" FROM (SELECT "customers_1"."email" AS "email" FROM `,
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(string(sql), v) {
+			t.Fatalf("expected %s: %s", v, sql)
+		}
+	}
+
+	// only the root is a lateral join
+	if n := strings.Count(string(sql), "LATERAL"); n != 1 {
+		t.Fatalf("expected a single lateral join got %d: %s", n, sql)
+	}
+
+	// strategies set later are used by the next compiles
+	pc.SetJoins(map[string]map[string]psql.JoinStrategy{
+		"Products": {"Customers": psql.JoinSubquery},
+	})
+
+	_, sql, err = pc.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(string(sql), "LATERAL"); n != 2 {
+		t.Fatalf("expected two lateral joins got %d: %s", n, sql)
+	}
+	if !strings.Contains(string(sql), exp[1]) {
+		t.Fatalf("expected %s: %s", exp[1], sql)
+	}
+}
+
+func TestScalarOps(t *testing.T) {
+	di := psql.GetTestDBInfo()
+	di.Columns[2] = append(di.Columns[2],
+		psql.DBColumn{ID: 11, Name: "location", Key: "location", Type: "geometry(Point,4326)", GeoJSON: true})
+
+	schema, err := psql.NewDBSchema(di, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc := psql.NewCompiler(psql.Config{Schema: schema})
+
+	qc, err := qcompile.Compile([]byte(`query {
+		products(where: { and: {
+			created_at: { between: ["2020-01-01", "2020-02-01"] },
+			updated_at: { between: $range },
+			location: { st_dwithin: { point: [-122.4, 37.7], distance: $dist } }
+		} }) {
+			id
+			location
+		}
+	}`), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sql, err := pc.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		`ST_AsGeoJSON("products"."location") :: json AS "location"`,
+		`(("products"."created_at") BETWEEN '2020-01-01' :: timestamp without time zone AND '2020-02-01' :: timestamp without time zone)`,
+		`(("products"."updated_at") BETWEEN ($2 :: json ->> 0) :: timestamp without time zone AND ($2 :: json ->> 1) :: timestamp without time zone)`,
+		`(ST_DWithin("products"."location", ST_SetSRID(ST_MakePoint(-122.4, 37.7), 4326) :: geometry, $1 :: float8))`,
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(string(sql), v) {
+			t.Fatalf("expected %s: %s", v, sql)
+		}
+	}
+
+	qc, err = qcompile.Compile([]byte(`query {
+		products(where: { name: { st_dwithin: { point: [1, 2], distance: 5 } } }) { id }
+	}`), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := pc.CompileEx(qc, nil); err == nil {
+		t.Fatal("expected an error for st_dwithin on a column that's not a geometry")
+	}
+
+	if _, err := qcompile.Compile([]byte(`query {
+		products(where: { created_at: { between: ["2020-01-01"] } }) { id }
+	}`), "admin"); err == nil {
+		t.Fatal("expected an error for between with a single value")
+	}
+}
+
+func TestComputedField(t *testing.T) {
+	co := psql.NewCompiler(psql.Config{
+		Schema: pcompile.Schema(),
+		Computed: map[string]map[string][]string{
+			"products": {"label": {"name", "price"}},
+		},
+	})
+
+	qc, err := qcompile.Compile([]byte(`query { products(limit: 3) { id label } }`), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sql, err := co.CompileEx(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `json_build_object('name', "products"."name", 'price', "products"."price") AS "label"`
+
+	if !strings.Contains(string(sql), exp) {
+		t.Fatalf("expected %s: %s", exp, sql)
+	}
+
+	// the field is unknown without the computed field
+	if _, _, err := pcompile.CompileEx(qc, nil); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
+
+func TestOrderByRelated(t *testing.T) {
+	di := psql.GetTestDBInfo()
+
+	if err := di.SetOrderExp("products", "popularity", `"products"."price" * 2`); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := psql.NewDBSchema(di, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	co := psql.NewCompiler(psql.Config{Schema: schema})
+
+	tests := []struct {
+		order string
+		exp   []string
+	}{
+		{`{ user: { full_name: asc } }`, []string{
+			`(SELECT "users"."full_name" FROM "users" WHERE (("users"."id") = ("products"."user_id")) LIMIT 1) AS "user.full_name"`,
+			`ORDER BY "user.full_name" ASC`,
+		}},
+		{`{ purchases_count: desc }`, []string{
+			`(SELECT count(*) FROM "purchases" WHERE (("purchases"."product_id") = ("products"."id"))) AS "purchases_count"`,
+			`ORDER BY "purchases_count" DESC`,
+		}},
+		{`{ purchases: { sum_quantity: desc } }`, []string{
+			`(SELECT sum("purchases"."quantity") FROM "purchases" WHERE (("purchases"."product_id") = ("products"."id"))) AS "purchases.sum_quantity"`,
+		}},
+		{`{ popularity: desc }`, []string{
+			`("products"."price" * 2) AS "popularity"`,
+			`ORDER BY "popularity" DESC`,
+		}},
+	}
+
+	for _, v := range tests {
+		gql := `query { products(limit: 5, order_by: ` + v.order + `) { id } }`
+
+		qc, err := qcompile.Compile([]byte(gql), "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, sql, err := co.CompileEx(qc, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", v.order, err)
+		}
+
+		for _, e := range v.exp {
+			if !strings.Contains(string(sql), e) {
+				t.Fatalf("expected %s: %s", e, sql)
+			}
+		}
+	}
+
+	errs := []string{
+		`products(order_by: { purchases: { quantity: desc } }) { id }`,
+		`products(first: 5, order_by: { purchases_count: desc }) { id }`,
+		`products(order_by: { user: { nothing: asc } }) { id }`,
+	}
+
+	for _, v := range errs {
+		qc, err := qcompile.Compile([]byte(`query { `+v+` }`), "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := co.CompileEx(qc, nil); err == nil {
+			t.Fatalf("%s: expected an error", v)
+		}
+	}
+}
+
+func TestCountEstimate(t *testing.T) {
+	co := psql.NewCompiler(psql.Config{
+		Schema: pcompile.Schema(),
+		Counts: map[string]psql.CountStrategy{
+			"products": psql.CountEstimate,
+			"users":    psql.CountCached,
+		},
+	})
+
+	tests := []struct {
+		gql   string
+		exp   string
+		count bool
+	}{
+		{`products { _count_estimate }`,
+			`(SELECT greatest("reltuples", 0) :: bigint FROM "pg_catalog"."pg_class" WHERE "oid" = '"products"' :: regclass) AS "_count_estimate"`, false},
+		{`products(where: { price: { gt: 10 } }) { _count_estimate }`,
+			`SELECT $1 :: bigint AS "_count_estimate"`, true},
+		{`users { _count_estimate }`,
+			`SELECT $1 :: bigint AS "_count_estimate"`, true},
+		{`products { id _count_estimate }`,
+			`count(*) AS "_count_estimate"`, false},
+		{`users { id products { _count_estimate } }`,
+			`count(*) AS "_count_estimate"`, false},
+		{`customers { _count_estimate }`,
+			`count(*) AS "_count_estimate"`, false},
+	}
+
+	for _, v := range tests {
+		qc, err := qcompile.Compile([]byte(`query { `+v.gql+` }`), "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		md, sql, err := co.CompileEx(qc, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", v.gql, err)
+		}
+
+		if !strings.Contains(string(sql), v.exp) {
+			t.Fatalf("%s: expected %s: %s", v.gql, v.exp, sql)
+		}
+
+		var cq psql.CountQuery
+		var ok bool
+
+		for _, p := range md.Params() {
+			if cq, ok = md.CountQuery(p.Name); ok {
+				break
+			}
+		}
+
+		if ok != v.count {
+			t.Fatalf("%s: expected count query %t", v.gql, v.count)
+		}
+
+		if ok && !strings.HasPrefix(cq.SQL, `SELECT 1 FROM "`+cq.Table+`"`) {
+			t.Fatalf("%s: unexpected count query %s", v.gql, cq.SQL)
+		}
+	}
+}
+
+func TestSplitSQLArgs(t *testing.T) {
+	sql := `SELECT $a, $1, '$b', "$c", $$ $d $$, $x$ $e $x$ FROM t WHERE id = $id_2`
+
+	parts, names := psql.SplitSQLArgs(sql)
+
+	if len(names) != 2 || names[0] != "a" || names[1] != "id_2" {
+		t.Fatalf("unexpected arguments: %v", names)
+	}
+
+	if len(parts) != 3 || parts[0] != "SELECT " || parts[2] != "" {
+		t.Fatalf("unexpected parts: %q", parts)
+	}
+
+	if strings.Join(parts, "$") != `SELECT $, $1, '$b', "$c", $$ $d $$, $x$ $e $x$ FROM t WHERE id = $` {
+		t.Fatalf("unexpected parts: %q", parts)
+	}
+}
+
+func TestCompileAliasedSelections(t *testing.T) {
+	gql := `query {
+		users {
+			id
+			recent: products(order_by: { id: desc }, limit: 5) {
+				id
+			}
+			expensive: products(order_by: { price: desc }, limit: 3) {
+				id
+				price
+			}
+		}
+	}`
+
+	qc, err := qcompile.Compile([]byte(gql), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := psql.GetTestSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dialect psql.Dialect
+		expect  []string
+	}{
+		{psql.Postgres, []string{
+			`"__sj_1"."json" AS "expensive", "__sj_2"."json" AS "recent"`,
+			`ORDER BY "products"."id" DESC LIMIT ('5') :: integer) AS "products_2"`,
+			`ORDER BY "products"."price" DESC LIMIT ('3') :: integer) AS "products_1"`,
+		}},
+		{psql.MySQL, []string{
+			"'expensive', `__sj_1`.`json`, 'recent', `__sj_2`.`json`",
+			"ORDER BY `products`.`id` DESC LIMIT 5) AS `products_2`",
+			"ORDER BY `products`.`price` DESC LIMIT 3) AS `products_1`",
+		}},
+	}
+
+	for _, tt := range tests {
+		co := psql.NewCompiler(psql.Config{Schema: schema, Dialect: tt.dialect})
+
+		_, sql, err := co.CompileEx(qc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, e := range tt.expect {
+			if !strings.Contains(string(sql), e) {
+				t.Errorf("%s: expected %s in: %s", tt.dialect.Name(), e, sql)
+			}
+		}
+	}
+}
+
+func TestCompilePagingVars(t *testing.T) {
+	gql := `query {
+		products(limit: $limit, offset: $offset, order_by: { price: $order }) {
+			id
+		}
+	}`
+
+	qc, err := qcompile.Compile([]byte(gql), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := psql.GetTestSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dialect psql.Dialect
+		expect  []string
+		params  []string
+	}{
+		{psql.Postgres, []string{
+			`ORDER BY CASE WHEN $1 = 'asc' THEN "products"."price" END ASC, CASE WHEN $1 = 'desc' THEN "products"."price" END DESC`,
+			`LIMIT ($2) :: integer OFFSET ($3) :: integer`,
+		}, []string{"__order.order", "__paging.1000.limit", "__paging.0.offset"}},
+		{psql.MySQL, []string{
+			"ORDER BY CASE WHEN ? = 'asc' THEN `products`.`price` END ASC, CASE WHEN ? = 'desc' THEN `products`.`price` END DESC",
+			"LIMIT ? OFFSET ?",
+		}, []string{"__order.order", "__order.order", "__paging.1000.limit", "__paging.0.offset"}},
+	}
+
+	for _, tt := range tests {
+		co := psql.NewCompiler(psql.Config{Schema: schema, Dialect: tt.dialect})
+
+		md, sql, err := co.CompileEx(qc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, e := range tt.expect {
+			if !strings.Contains(string(sql), e) {
+				t.Errorf("%s: expected %s in: %s", tt.dialect.Name(), e, sql)
+			}
+		}
+
+		var params []string
+		for _, p := range md.Params() {
+			params = append(params, p.Name)
+		}
+
+		if strings.Join(params, ",") != strings.Join(tt.params, ",") {
+			t.Errorf("%s: expected params %v got %v", tt.dialect.Name(), tt.params, params)
+		}
+	}
+
+	gql = `query { products(first: $limit, after: $cursor, order_by: { price: $order }) { id } }`
+
+	qc, err = qcompile.Compile([]byte(gql), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := pcompile.CompileEx(qc, nil); err == nil {
+		t.Fatal("expecting an error for an order variable with a cursor")
+	}
+}
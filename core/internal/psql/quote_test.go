@@ -0,0 +1,99 @@
+package psql_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	tests := []struct {
+		ident string
+		pg    string
+		mysql string
+	}{
+		{`id`, `"id"`, "`id`"},
+		{`FullName`, `"FullName"`, "`FullName`"},
+		{`full name`, `"full name"`, "`full name`"},
+		{`select`, `"select"`, "`select`"},
+		{`order`, `"order"`, "`order`"},
+		{`user`, `"user"`, "`user`"},
+		{``, `""`, "``"},
+		{`na"me`, `"na""me"`, "`na\"me`"},
+		{`"`, `""""`, "`\"`"},
+		{"na`me", "\"na`me\"", "`na``me`"},
+		{"`", "\"`\"", "````"},
+		{`a"); DROP TABLE users; --`, `"a""); DROP TABLE users; --"`, "`a\"); DROP TABLE users; --`"},
+		{`it's`, `"it's"`, "`it's`"},
+		{`back\slash`, `"back\slash"`, "`back\\slash`"},
+		{`größe`, `"größe"`, "`größe`"},
+		{`列`, `"列"`, "`列`"},
+	}
+
+	for _, tt := range tests {
+		if v := psql.Postgres.QuoteIdent(tt.ident); v != tt.pg {
+			t.Errorf("postgres: %q: expected %s got %s", tt.ident, tt.pg, v)
+		}
+		if v := psql.MySQL.QuoteIdent(tt.ident); v != tt.mysql {
+			t.Errorf("mysql: %q: expected %s got %s", tt.ident, tt.mysql, v)
+		}
+	}
+}
+
+func TestQuoteIdentCompile(t *testing.T) {
+	tables := []psql.DBTable{
+		{Name: "Orders", Type: "table"},
+	}
+
+	columns := [][]psql.DBColumn{{
+		{ID: 1, Name: "ID", Type: "bigint", NotNull: true, PrimaryKey: true, UniqueKey: true},
+		{ID: 2, Name: "select", Type: "text"},
+	}}
+
+	schema, err := psql.NewDBSchema(psql.NewDBInfo(110000, tables, columns, nil, nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := `query { orders(where: { select: { eq: "a" } }, order_by: { select: asc }) { id select } }`
+
+	qc, err := qcompile.Compile([]byte(gql), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dialect psql.Dialect
+		expect  []string
+	}{
+		{psql.Postgres, []string{
+			`FROM "Orders"`,
+			`"Orders"."ID" AS "id"`,
+			`"Orders"."select") = 'a'`,
+			`ORDER BY "Orders"."select" ASC`,
+			`"Orders_0"."select" AS "select"`,
+		}},
+		{psql.MySQL, []string{
+			"FROM `Orders`",
+			"`Orders`.`ID` AS `id`",
+			"`Orders`.`select`) = 'a'",
+			"`Orders_0`.`select`",
+		}},
+	}
+
+	for _, tt := range tests {
+		co := psql.NewCompiler(psql.Config{Schema: schema, Dialect: tt.dialect})
+
+		_, sql, err := co.CompileEx(qc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, e := range tt.expect {
+			if !strings.Contains(string(sql), e) {
+				t.Errorf("%s: expected %s in: %s", tt.dialect.Name(), e, sql)
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package psql
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// selfRefCol returns the column of a table with a foreign key to the
+// table itself (eg. parent_id of comments)
+func selfRefCol(ti *DBTableInfo) (*DBColumn, error) {
+	if ti.PrimaryCol == nil {
+		return nil, fmt.Errorf("find: no primary key column found: %s", ti.Name)
+	}
+
+	for i := range ti.Columns {
+		col := &ti.Columns[i]
+		if col.FKeyTable != "" && strings.EqualFold(col.FKeyTable, ti.Name) {
+			return col, nil
+		}
+	}
+
+	return nil, fmt.Errorf("find: no column of %s related to itself found", ti.Name)
+}
+
+// recursiveCol returns the column of the parent row the children (the
+// primary key) or the parents (the foreign key) are found with
+func (c *compilerContext) recursiveCol(sel *qcode.Select, ti *DBTableInfo) (string, error) {
+	fk, err := selfRefCol(ti)
+	if err != nil {
+		return "", err
+	}
+
+	if sel.Find == qcode.FindChildren {
+		return ti.PrimaryCol.Name, nil
+	}
+	return fk.Name, nil
+}
+
+// renderRecursiveSel renders the children or the parents of the parent row with
+// a recursive cte, the rows are returned nested with each level under the field
+// name of the selection in the rows of the level before it. Rows already in
+// the path from the parent row end the recursion so cycles are not followed
+func (c *compilerContext) renderRecursiveSel(sel *qcode.Select, ti *DBTableInfo, parentID int32) error {
+	if sti, err := c.schema.GetTableInfo(sel.Name); err != nil {
+		return err
+	} else if sti.Name != ti.Name {
+		return fmt.Errorf("find: %s is not the same table as %s", sel.Name, ti.Name)
+	}
+
+	if len(sel.Children) != 0 {
+		return fmt.Errorf("find: %s: only columns can be selected", sel.FieldName)
+	}
+
+	if sel.Paging.Type != qcode.PtOffset {
+		return fmt.Errorf("find: %s: cursor pagination not supported", sel.FieldName)
+	}
+
+	fk, err := selfRefCol(ti)
+	if err != nil {
+		return err
+	}
+
+	// the column of the next row and the one of the row it's related to
+	var next, cur string
+
+	if sel.Find == qcode.FindChildren {
+		next, cur = fk.Name, ti.PrimaryCol.Name
+	} else {
+		next, cur = ti.PrimaryCol.Name, fk.Name
+	}
+
+	// the columns of the rows in the cte
+	cols := []string{ti.PrimaryCol.Name, fk.Name}
+	colmap := map[string]struct{}{cols[0]: {}, cols[1]: {}}
+
+	addCol := func(cn string) error {
+		if err := ColumnAccess(ti, sel, cn, true); err != nil {
+			return err
+		}
+		if _, ok := colmap[cn]; !ok {
+			cols = append(cols, cn)
+			colmap[cn] = struct{}{}
+		}
+		return nil
+	}
+
+	for _, col := range sel.Cols {
+		if err := addCol(col.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, ob := range sel.OrderBy {
+		if err := addCol(ob.Col); err != nil {
+			return err
+		}
+	}
+
+	cte := "__rcte_" + strconv.Itoa(int(sel.ID))
+
+	io.WriteString(c.w, `(WITH RECURSIVE "`)
+	io.WriteString(c.w, cte)
+	io.WriteString(c.w, `" AS (SELECT `)
+	c.renderRecursiveCols(ti, cols)
+	io.WriteString(c.w, `, 1 AS "__depth", ARRAY[`)
+	colWithTable(c.w, ti.Name, ti.PrimaryCol.Name)
+	io.WriteString(c.w, `] AS "__path" FROM `)
+	c.renderTable(c.w, ti.Name)
+	io.WriteString(c.w, ` WHERE ((`)
+	colWithTable(c.w, ti.Name, next)
+	io.WriteString(c.w, `) = (`)
+	colWithTableID(c.w, ti.Name, parentID, cur)
+	io.WriteString(c.w, `))`)
+
+	if err := c.renderRecursiveWhere(sel, ti); err != nil {
+		return err
+	}
+
+	io.WriteString(c.w, ` UNION ALL SELECT `)
+	c.renderRecursiveCols(ti, cols)
+	io.WriteString(c.w, `, "`)
+	io.WriteString(c.w, cte)
+	io.WriteString(c.w, `"."__depth" + 1, "`)
+	io.WriteString(c.w, cte)
+	io.WriteString(c.w, `"."__path" || `)
+	colWithTable(c.w, ti.Name, ti.PrimaryCol.Name)
+	io.WriteString(c.w, ` FROM `)
+	c.renderTable(c.w, ti.Name)
+	io.WriteString(c.w, `, "`)
+	io.WriteString(c.w, cte)
+	io.WriteString(c.w, `" WHERE ((`)
+	colWithTable(c.w, ti.Name, next)
+	io.WriteString(c.w, `) = (`)
+	colWithTable(c.w, cte, cur)
+	io.WriteString(c.w, `)) AND ("`)
+	io.WriteString(c.w, cte)
+	io.WriteString(c.w, `"."__depth" < `)
+	io.WriteString(c.w, strconv.Itoa(c.rdepth))
+	io.WriteString(c.w, `) AND NOT (`)
+	colWithTable(c.w, ti.Name, ti.PrimaryCol.Name)
+	io.WriteString(c.w, ` = ANY("`)
+	io.WriteString(c.w, cte)
+	io.WriteString(c.w, `"."__path"))`)
+
+	if err := c.renderRecursiveWhere(sel, ti); err != nil {
+		return err
+	}
+
+	io.WriteString(c.w, `) SELECT `)
+
+	if err := c.renderRecursiveLevel(sel, cte, next, cur, 1); err != nil {
+		return err
+	}
+
+	io.WriteString(c.w, `)`)
+	return nil
+}
+
+func (c *compilerContext) renderRecursiveCols(ti *DBTableInfo, cols []string) {
+	for i, cn := range cols {
+		if i != 0 {
+			io.WriteString(c.w, `, `)
+		}
+		colWithTable(c.w, ti.Name, cn)
+	}
+}
+
+func (c *compilerContext) renderRecursiveWhere(sel *qcode.Select, ti *DBTableInfo) error {
+	if sel.Where == nil || sel.Where.Op == qcode.OpNop {
+		return nil
+	}
+
+	io.WriteString(c.w, ` AND (`)
+	if err := c.renderWhere(sel, ti); err != nil {
+		return err
+	}
+	io.WriteString(c.w, `)`)
+	return nil
+}
+
+// renderRecursiveLevel renders the rows at a depth as a json array, the rows
+// at the max depth have null for the next level
+func (c *compilerContext) renderRecursiveLevel(sel *qcode.Select, cte, next, cur string, depth int) error {
+	ta := cte + "_" + strconv.Itoa(depth)
+
+	io.WriteString(c.w, `(SELECT coalesce(jsonb_agg(jsonb_build_object(`)
+
+	for _, col := range sel.Cols {
+		squoted(c.w, col.FieldName)
+		io.WriteString(c.w, `, `)
+		colWithTable(c.w, ta, col.Name)
+		io.WriteString(c.w, `, `)
+	}
+
+	squoted(c.w, sel.FieldName)
+	io.WriteString(c.w, `, `)
+
+	if depth < c.rdepth {
+		if err := c.renderRecursiveLevel(sel, cte, next, cur, depth+1); err != nil {
+			return err
+		}
+	} else {
+		io.WriteString(c.w, `NULL`)
+	}
+	io.WriteString(c.w, `)`)
+
+	for i, ob := range sel.OrderBy {
+		if i == 0 {
+			io.WriteString(c.w, ` ORDER BY `)
+		} else {
+			io.WriteString(c.w, `, `)
+		}
+		colWithTable(c.w, ta, ob.Col)
+		if err := c.renderOrder(ob); err != nil {
+			return err
+		}
+	}
+
+	io.WriteString(c.w, `), '[]') FROM "`)
+	io.WriteString(c.w, cte)
+	io.WriteString(c.w, `" AS "`)
+	io.WriteString(c.w, ta)
+	io.WriteString(c.w, `" WHERE ("`)
+	io.WriteString(c.w, ta)
+	io.WriteString(c.w, `"."__depth" = `)
+	io.WriteString(c.w, strconv.Itoa(depth))
+	io.WriteString(c.w, `)`)
+
+	if depth > 1 {
+		io.WriteString(c.w, ` AND ((`)
+		colWithTable(c.w, ta, next)
+		io.WriteString(c.w, `) = (`)
+		colWithTable(c.w, cte+"_"+strconv.Itoa(depth-1), cur)
+		io.WriteString(c.w, `))`)
+	}
+
+	io.WriteString(c.w, `)`)
+	return nil
+}
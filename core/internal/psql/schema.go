@@ -2,8 +2,10 @@ package psql
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
+	"github.com/dosco/super-graph/core/internal/util"
 	"github.com/gobuffalo/flect"
 )
 
@@ -13,6 +15,11 @@ type DBSchema struct {
 	rm  map[string]map[string]*DBRel
 	vt  map[string]*VirtualTable
 	fm  map[string]*DBFunction
+	tf  map[string]*DBFunction
+	en  []DBEnum
+
+	// qt are the tables of other schemas by name
+	qt map[string]*DBTableInfo
 }
 
 type DBTableInfo struct {
@@ -22,9 +29,19 @@ type DBTableInfo struct {
 	Columns    []DBColumn
 	PrimaryCol *DBColumn
 	TSVCol     *DBColumn
+	TSVExp     string
+	OrderExps  map[string]string
+	SQL        string
+	SQLArgs    []DBColumn
 	Singular   string
 	Plural     string
 	Blocked    bool
+	Comment    string
+
+	// Schema and Table are the schema and the name in it of a table not
+	// in the default schema, it's rendered aliased by its name
+	Schema string
+	Table  string
 
 	fkMultiRef map[string]int
 	colMap     map[string]*DBColumn
@@ -70,8 +87,12 @@ func NewDBSchema(info *DBInfo, aliases map[string][]string) (*DBSchema, error) {
 		rm:  make(map[string]map[string]*DBRel),
 		vt:  make(map[string]*VirtualTable),
 		fm:  make(map[string]*DBFunction, len(info.Functions)),
+		tf:  make(map[string]*DBFunction),
+		en:  info.Enums,
 	}
 
+	info.resolveSchemaFKeys()
+
 	for i, t := range info.Tables {
 		err := schema.addTableInfo(t, info.Columns[i], aliases)
 		if err != nil {
@@ -105,8 +126,20 @@ func NewDBSchema(info *DBInfo, aliases map[string][]string) (*DBSchema, error) {
 	}
 
 	for k, f := range info.Functions {
+		fn := strings.ToLower(f.Name)
+
+		// functions returning rows of a table are root fields
+		// unless there's a table with the same name
+		if f.Table != "" {
+			_, isTable := schema.t[fn]
+			if _, ok := schema.t[strings.ToLower(f.Table)]; ok && !isTable {
+				schema.tf[fn] = &info.Functions[k]
+			}
+			continue
+		}
+
 		if len(f.Params) == 1 {
-			schema.fm[strings.ToLower(f.Name)] = &info.Functions[k]
+			schema.fm[fn] = &info.Functions[k]
 		}
 	}
 
@@ -132,6 +165,9 @@ func (s *DBSchema) addTableInfo(
 		Singular:   singular,
 		Plural:     plural,
 		Blocked:    t.Blocked,
+		Comment:    t.Comment,
+		Schema:     t.Schema,
+		Table:      t.Table,
 		fkMultiRef: fkMultiRef,
 		colMap:     colmap,
 		colIDMap:   colidmap,
@@ -145,6 +181,9 @@ func (s *DBSchema) addTableInfo(
 		Singular:   singular,
 		Plural:     plural,
 		Blocked:    t.Blocked,
+		Comment:    t.Comment,
+		Schema:     t.Schema,
+		Table:      t.Table,
 		fkMultiRef: fkMultiRef,
 		colMap:     colmap,
 		colIDMap:   colidmap,
@@ -175,6 +214,26 @@ func (s *DBSchema) addTableInfo(
 		colidmap[c.ID] = c
 	}
 
+	// the search config is either a tsvector column or an expression
+	if t.Search != "" {
+		if c, ok := colmap[strings.ToLower(t.Search)]; ok && c.Type == "tsvector" {
+			ts.TSVCol, tp.TSVCol = c, c
+		} else {
+			ts.TSVExp, tp.TSVExp = t.Search, t.Search
+		}
+	}
+
+	ts.OrderExps, tp.OrderExps = t.OrderExps, t.OrderExps
+	ts.SQL, tp.SQL = t.SQL, t.SQL
+	ts.SQLArgs, tp.SQLArgs = t.SQLArgs, t.SQLArgs
+
+	if t.Schema != "" {
+		if s.qt == nil {
+			s.qt = make(map[string]*DBTableInfo)
+		}
+		s.qt[t.Name] = tp
+	}
+
 	s.t[singular] = ts
 	s.t[plural] = tp
 
@@ -230,7 +289,8 @@ func (s *DBSchema) addMultiRefs(ti *DBTableInfo) error {
 }
 
 func (s *DBSchema) virtualRels(vts []VirtualTable) error {
-	for _, vt := range vts {
+	for i := range vts {
+		vt := vts[i]
 		s.vt[vt.Name] = &vt
 
 		for _, t := range s.t {
@@ -539,6 +599,12 @@ func (s *DBSchema) GetTableInfo(selName string) (*DBTableInfo, error) {
 	return t, nil
 }
 
+// HasSearch returns true if full text search is
+// possible on the table
+func (ti *DBTableInfo) HasSearch() bool {
+	return ti.TSVCol != nil || ti.TSVExp != ""
+}
+
 func (s *DBSchema) GetTableInfoB(selName string) (*DBTableInfo, error) {
 	t, ok := s.t[selName]
 	if !ok {
@@ -550,6 +616,23 @@ func (s *DBSchema) GetTableInfoB(selName string) (*DBTableInfo, error) {
 	return t, nil
 }
 
+// clone returns a copy of the schema that relationships can be
+// added to without changing the original
+func (s *DBSchema) clone() *DBSchema {
+	s1 := *s
+	s1.rm = make(map[string]map[string]*DBRel, len(s.rm))
+
+	for k, v := range s.rm {
+		m := make(map[string]*DBRel, len(v))
+		for k1, v1 := range v {
+			m[k1] = v1
+		}
+		s1.rm[k] = m
+	}
+
+	return &s1
+}
+
 func (s *DBSchema) SetRel(child, parent string, rel *DBRel) error {
 	sp := strings.ToLower(flect.Singularize(parent))
 	pp := strings.ToLower(flect.Pluralize(parent))
@@ -611,15 +694,24 @@ func (ti *DBTableInfo) ColumnExists(name string) bool {
 func (ti *DBTableInfo) GetColumn(name string) (*DBColumn, error) {
 	c, ok := ti.colMap[name]
 	if !ok {
-		return nil, fmt.Errorf("column: '%s.%s' not found", ti.Name, name)
+		return nil, ti.colNotFound(name)
 	}
 	return c, nil
 }
 
+// ColumnName returns the name of the column in the database, the name
+// queried with is the lowercase key when it has uppercase in it
+func (ti *DBTableInfo) ColumnName(name string) string {
+	if c, ok := ti.colMap[name]; ok {
+		return c.Name
+	}
+	return name
+}
+
 func (ti *DBTableInfo) GetColumnB(name string) (*DBColumn, error) {
 	c, ok := ti.colMap[name]
 	if !ok {
-		return nil, fmt.Errorf("column: '%s.%s' not found", ti.Name, name)
+		return nil, ti.colNotFound(name)
 	}
 	if c.Blocked {
 		return nil, fmt.Errorf("column: '%s.%s' blocked", ti.Name, name)
@@ -627,6 +719,21 @@ func (ti *DBTableInfo) GetColumnB(name string) (*DBColumn, error) {
 	return c, nil
 }
 
+// colNotFound returns an error listing the columns of the table along with
+// the closest match to the missing column. Blocked columns are not listed.
+func (ti *DBTableInfo) colNotFound(name string) error {
+	cols := make([]string, 0, len(ti.Columns))
+
+	for i := range ti.Columns {
+		if !ti.Columns[i].Blocked {
+			cols = append(cols, ti.Columns[i].Name)
+		}
+	}
+
+	return fmt.Errorf("column: '%s.%s' not found, %s",
+		ti.Name, name, util.NotFoundMsg(name, cols))
+}
+
 func (s *DBSchema) GetFunctions() []*DBFunction {
 	var funcs []*DBFunction
 	for _, f := range s.fm {
@@ -635,6 +742,24 @@ func (s *DBSchema) GetFunctions() []*DBFunction {
 	return funcs
 }
 
+// GetTableFunction returns the function returning rows of a table
+// (eg. search_products returning products) with the name
+func (s *DBSchema) GetTableFunction(name string) (*DBFunction, bool) {
+	f, ok := s.tf[strings.ToLower(name)]
+	return f, ok
+}
+
+// GetTableFunctions returns the functions returning rows of a table
+// sorted by name
+func (s *DBSchema) GetTableFunctions() []*DBFunction {
+	funcs := make([]*DBFunction, 0, len(s.tf))
+	for _, f := range s.tf {
+		funcs = append(funcs, f)
+	}
+	sort.Slice(funcs, func(i, j int) bool { return funcs[i].Name < funcs[j].Name })
+	return funcs
+}
+
 func getRelName(colName string) string {
 	cn := strings.ToLower(colName)
 
@@ -656,3 +781,31 @@ func getRelName(colName string) string {
 
 	return colName
 }
+
+// GetEnums returns the enum types in the database
+func (s *DBSchema) GetEnums() []DBEnum {
+	return s.en
+}
+
+// GetRelatedTables returns the names of all tables that can be selected
+// as children of the parent table
+func (s *DBSchema) GetRelatedTables(parent string) []string {
+	var names []string
+	for child, rels := range s.rm {
+		if _, ok := rels[parent]; ok {
+			names = append(names, child)
+		}
+	}
+	return names
+}
+
+// polyType returns the value of the type column of the
+// polymorphic table for the table
+func (s *DBSchema) polyType(vtable, table string) string {
+	if vt, ok := s.vt[vtable]; ok {
+		if v, ok := vt.Types[table]; ok {
+			return v
+		}
+	}
+	return table
+}
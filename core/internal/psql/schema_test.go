@@ -0,0 +1,67 @@
+package psql_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestSchemaSwap(t *testing.T) {
+	schema, err := psql.GetTestSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := psql.NewCompiler(psql.Config{Schema: schema})
+
+	gql := []byte(`query { products { id name user { id } } }`)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for n := 0; n < 50; n++ {
+				qc, err := qcompile.Compile(gql, "user")
+				if err != nil {
+					errs <- err
+					return
+				}
+				if _, _, err := pc.CompileEx(qc, nil); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		rel := &psql.DBRel{Type: psql.RelRemote}
+		rel.Left.Col = "id"
+		rel.Right.Col = "__products_id"
+
+		if err := pc.AddRelationship("payments", "products", rel); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := psql.GetTestSchema()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pc.SetSchema(s)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if _, err := schema.GetRel("payments", "products"); err == nil {
+		t.Fatal("expected the original schema to be left unchanged")
+	}
+}
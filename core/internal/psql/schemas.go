@@ -0,0 +1,188 @@
+package psql
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// AddSchema adds the tables of another schema of the database, they are
+// named with the prefix (eg. billing_invoices) and can be related to the
+// tables of the default schema and the other schemas added
+func (di *DBInfo) AddSchema(db *sql.DB, schema, prefix string, blockList []string) error {
+	tables, err := getTables(db, schema, false)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(tables))
+
+	for i, t := range tables {
+		names[i] = t.Name
+	}
+
+	var columns [][]DBColumn
+
+	if len(names) != 0 {
+		cols, err := GetColumns(db, schema, names)
+		if err != nil {
+			return err
+		}
+
+		for _, t := range names {
+			columns = append(columns, cols[t])
+		}
+	}
+
+	return di.AddSchemaTables(schema, prefix, tables, columns, blockList)
+}
+
+// AddSchemaTables adds the tables and columns of another schema, the
+// tables are named with the prefix. The foreign keys to tables of the
+// schema are named the same, and the ones to other schemas are kept
+// qualified (eg. public.users) till the database schema is built
+func (di *DBInfo) AddSchemaTables(
+	schema, prefix string, tables []DBTable, columns [][]DBColumn, blockList []string) error {
+
+	if schema == di.Schema {
+		return fmt.Errorf("schema %s: is the default schema", schema)
+	}
+
+	if di.colMap == nil {
+		di.colMap = make(map[string]*DBColumn)
+	}
+
+	id := len(di.Tables)
+
+	for i := range tables {
+		t := tables[i]
+
+		t.ID = id + i
+		t.Schema = schema
+		t.Table = t.Name
+		t.Name = prefix + t.Name
+		t.Key = strings.ToLower(t.Name)
+		t.Blocked = t.Blocked || isInList(t.Name, blockList) || isInList(t.Table, blockList)
+
+		for _, v := range di.Tables {
+			if v.Key == t.Key {
+				return fmt.Errorf("schema %s: table %s has the name of another table, set a prefix",
+					schema, t.Table)
+			}
+		}
+
+		cols := columns[i]
+
+		for n := range cols {
+			c := &cols[n]
+			c.Key = strings.ToLower(c.Name)
+			c.Blocked = c.Blocked || isInList(c.Name, blockList)
+
+			if c.FKeyTable != "" && !strings.Contains(c.FKeyTable, ".") {
+				c.FKeyTable = prefix + c.FKeyTable
+			}
+			di.colMap[(t.Key + c.Key)] = c
+		}
+
+		di.Tables = append(di.Tables, t)
+		di.Columns = append(di.Columns, cols)
+	}
+
+	return nil
+}
+
+// resolveSchemaFKeys names the foreign keys to tables in other schemas
+// (eg. billing.invoices) with the name the table is selected with, the
+// ones to schemas that were not added are dropped
+func (di *DBInfo) resolveSchemaFKeys() {
+	var names map[string]string
+
+	for i := range di.Columns {
+		for n := range di.Columns[i] {
+			c := &di.Columns[i][n]
+
+			if !strings.Contains(c.FKeyTable, ".") {
+				continue
+			}
+
+			if names == nil {
+				names = make(map[string]string, len(di.Tables))
+
+				for _, t := range di.Tables {
+					if t.Schema != "" {
+						names[t.Schema+"."+t.Table] = t.Name
+					} else if di.Schema != "" {
+						names[di.Schema+"."+t.Name] = t.Name
+					}
+				}
+			}
+
+			if v, ok := names[c.FKeyTable]; ok {
+				c.FKeyTable = v
+			} else {
+				c.FKeyTable = ""
+				c.FKeyColID = nil
+			}
+		}
+	}
+}
+
+// renderTable renders the table as a relation. A table of another schema is
+// qualified and aliased by the name it's selected with (eg. "billing"."invoices"
+// AS "billing_invoices") unless it's a CTE of a mutation
+func (c *compilerContext) renderTable(w io.Writer, name string) {
+	if _, ok := c.md.ctes[name]; ok {
+		quoted(w, name)
+		return
+	}
+	c.renderTableAs(w, name)
+}
+
+// renderSelTable renders the table the rows of the selection are read from,
+// a view it's redirected to is named after the table so the columns and
+// joins of the table work the same
+func (c *compilerContext) renderSelTable(w io.Writer, sel *qcode.Select, ti *DBTableInfo) {
+	if sel.View == "" {
+		c.renderTable(w, ti.Name)
+		return
+	}
+	quoted(w, sel.View)
+	_, _ = io.WriteString(w, ` AS `)
+	quoted(w, ti.Name)
+}
+
+// renderTableAs renders the table as the target of an insert, update or delete
+func (c *compilerContext) renderTableAs(w io.Writer, name string) {
+	ti, ok := c.schema.qt[name]
+	if !ok {
+		quoted(w, name)
+		return
+	}
+
+	quoted(w, ti.Schema)
+	_, _ = io.WriteString(w, `.`)
+	quoted(w, ti.Table)
+	_, _ = io.WriteString(w, ` AS `)
+	quoted(w, name)
+}
+
+// addCte records the CTE of a mutation named after its table
+func (c *compilerContext) addCte(item kvitem) {
+	if item._type != itemConnect && item._type != itemDisconnect {
+		c.addCteName(item.ti.Name)
+	}
+}
+
+func (c *compilerContext) addCteName(name string) {
+	if _, ok := c.schema.qt[name]; !ok {
+		return
+	}
+
+	if c.md.ctes == nil {
+		c.md.ctes = make(map[string]struct{})
+	}
+	c.md.ctes[name] = struct{}{}
+}
@@ -0,0 +1,107 @@
+package psql_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestSchemas(t *testing.T) {
+	di := psql.GetTestDBInfo()
+	di.Schema = "public"
+
+	tables := []psql.DBTable{
+		{Name: "invoices", Type: "table"},
+		{Name: "invoice_lines", Type: "table"},
+	}
+
+	columns := [][]psql.DBColumn{
+		{
+			{ID: 1, Name: "id", Type: "bigint", NotNull: true, PrimaryKey: true, UniqueKey: true},
+			{ID: 2, Name: "customer_id", Type: "bigint", FKeyTable: "public.customers", FKeyColID: []int16{1}},
+			{ID: 3, Name: "amount", Type: "numeric(7,2)"},
+			{ID: 4, Name: "ledger_id", Type: "bigint", FKeyTable: "ledger.entries", FKeyColID: []int16{1}},
+		},
+		{
+			{ID: 1, Name: "id", Type: "bigint", NotNull: true, PrimaryKey: true, UniqueKey: true},
+			{ID: 2, Name: "invoice_id", Type: "bigint", FKeyTable: "invoices", FKeyColID: []int16{1}},
+		},
+	}
+
+	if err := di.AddSchemaTables("billing", "billing_", tables, columns, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := psql.NewDBSchema(di, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	co := psql.NewCompiler(psql.Config{Schema: schema})
+
+	tests := []struct {
+		gql  string
+		vars string
+		exp  []string
+	}{
+		{`query { billing_invoices(limit: 5) { id amount customer { id } billing_invoice_lines { id } } }`, ``, []string{
+			`FROM "billing"."invoices" AS "billing_invoices"`,
+			`FROM "customers" WHERE ((("customers"."id") = ("billing_invoices_0"."customer_id")))`,
+			`FROM "billing"."invoice_lines" AS "billing_invoice_lines" WHERE ((("billing_invoice_lines"."invoice_id") = ("billing_invoices_0"."id")))`,
+		}},
+		{`query { customers { id billing_invoices { amount } } }`, ``, []string{
+			`FROM "billing"."invoices" AS "billing_invoices" WHERE ((("billing_invoices"."customer_id") = ("customers_0"."id")))`,
+		}},
+		{`mutation { billing_invoices(insert: $data) { id } }`, `{"data": {"amount": 10}}`, []string{
+			`INSERT INTO "billing"."invoices" AS "billing_invoices" ("amount")`,
+			`FROM "billing_invoices") AS "billing_invoices_0"`,
+		}},
+		{`mutation { billing_invoices(where: { id: { eq: 1 } }, delete: true) { id } }`, ``, []string{
+			`DELETE FROM "billing"."invoices" AS "billing_invoices" WHERE`,
+		}},
+	}
+
+	for _, v := range tests {
+		qc, err := qcompile.Compile([]byte(v.gql), "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var vars map[string]json.RawMessage
+		if v.vars != "" {
+			if err := json.Unmarshal([]byte(v.vars), &vars); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, sql, err := co.CompileEx(qc, vars)
+		if err != nil {
+			t.Fatalf("%s: %s", v.gql, err)
+		}
+
+		for _, e := range v.exp {
+			if !strings.Contains(string(sql), e) {
+				t.Fatalf("%s: expected %s: %s", v.gql, e, sql)
+			}
+		}
+	}
+
+	// the foreign key to a schema that wasn't added is dropped
+	ti, err := schema.GetTableInfo("billing_invoices")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ti.ColumnExists("ledger_id") {
+		t.Fatal("expected the ledger_id column")
+	}
+
+	if _, err := schema.GetRel("entries", "billing_invoices"); err == nil {
+		t.Fatal("expected no relationship to a table of a schema not added")
+	}
+
+	if err := di.AddSchemaTables("public", "", tables, columns, nil); err == nil {
+		t.Fatal("expected an error for adding the default schema")
+	}
+}
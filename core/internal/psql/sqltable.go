@@ -0,0 +1,133 @@
+package psql
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+	"github.com/dosco/super-graph/core/internal/util"
+)
+
+// renderSQLTable renders the query of a named sql query in place of the table
+// (eg. `(SELECT ... WHERE region = ($1 :: text)) AS "sales_by_region"`). Its
+// arguments ($name) are set from the args argument or else to null
+func (c *compilerContext) renderSQLTable(sel *qcode.Select, ti *DBTableInfo) error {
+	args := make(map[string]*qcode.FuncArg, len(sel.FuncArgs))
+
+	for i := range sel.FuncArgs {
+		a := &sel.FuncArgs[i]
+
+		if _, err := sqlArg(ti, a.Name); err != nil {
+			return err
+		}
+		args[strings.ToLower(a.Name)] = a
+	}
+
+	parts, names := SplitSQLArgs(ti.SQL)
+
+	io.WriteString(c.w, `(`)
+
+	for i, p := range parts {
+		io.WriteString(c.w, p)
+
+		if i == len(names) {
+			break
+		}
+
+		col, err := sqlArg(ti, names[i])
+		if err != nil {
+			return err
+		}
+
+		io.WriteString(c.w, `(`)
+
+		if a, ok := args[strings.ToLower(names[i])]; ok {
+			c.renderVal(&qcode.Exp{Type: a.Type, Val: a.Val}, c.vars, col)
+		} else {
+			io.WriteString(c.w, `NULL :: `)
+			io.WriteString(c.w, col.Type)
+		}
+
+		io.WriteString(c.w, `)`)
+	}
+
+	io.WriteString(c.w, `)`)
+	alias(c.w, ti.Name)
+
+	return nil
+}
+
+func sqlArg(ti *DBTableInfo, name string) (*DBColumn, error) {
+	names := make([]string, 0, len(ti.SQLArgs))
+
+	for i := range ti.SQLArgs {
+		a := &ti.SQLArgs[i]
+		if strings.EqualFold(a.Name, name) {
+			return a, nil
+		}
+		names = append(names, a.Name)
+	}
+
+	return nil, fmt.Errorf("sql query %s: argument '%s' not found, %s",
+		ti.Name, name, util.NotFoundMsg(name, names))
+}
+
+// SplitSQLArgs function returns the sql split around the named arguments
+// in it (eg. $region) and the names of the arguments, there is one more
+// part than names. Quoted strings, identifiers and dollar quoted strings
+// are skipped along with the positional parameters (eg. $1)
+func SplitSQLArgs(sql string) ([]string, []string) {
+	var parts, names []string
+	st := 0
+
+	for i := 0; i < len(sql); i++ {
+		switch ch := sql[i]; {
+		case ch == '\'' || ch == '"':
+			if n := strings.IndexByte(sql[i+1:], ch); n != -1 {
+				i += n + 1
+			} else {
+				i = len(sql)
+			}
+
+		case ch == '$' && i+1 < len(sql) && isIdentStart(sql[i+1]):
+			j := i + 1
+			for j < len(sql) && isIdentChar(sql[j]) {
+				j++
+			}
+
+			// a dollar quote tag (eg. $body$ ... $body$)
+			if j < len(sql) && sql[j] == '$' {
+				tag := sql[i : j+1]
+				if n := strings.Index(sql[j+1:], tag); n != -1 {
+					i = j + n + len(tag)
+				} else {
+					i = len(sql)
+				}
+				continue
+			}
+
+			parts = append(parts, sql[st:i])
+			names = append(names, sql[i+1:j])
+			st = j
+			i = j - 1
+
+		case ch == '$' && i+1 < len(sql) && sql[i+1] == '$':
+			if n := strings.Index(sql[i+2:], "$$"); n != -1 {
+				i += n + 3
+			} else {
+				i = len(sql)
+			}
+		}
+	}
+
+	return append(parts, sql[st:]), names
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,72 @@
+package psql
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// compileStream renders a query with a single root list as the json of each
+// of its rows so that they can be fetched in batches with a cursor
+func (c *compilerContext) compileStream(qc *qcode.QCode, vars Variables) error {
+	var root *qcode.Select
+
+	for _, id := range qc.Roots {
+		sel := &c.s[id]
+
+		if sel.SkipRender == qcode.SkipTypeDirective {
+			continue
+		}
+
+		if root != nil {
+			return errors.New("stream: only queries with a single root can be streamed")
+		}
+		root = sel
+	}
+
+	if root == nil {
+		c.md.skipped = true
+		return nil
+	}
+
+	if root.SkipRender != qcode.SkipTypeNone || root.Type != qcode.STNone {
+		return fmt.Errorf("stream: %s: only tables can be streamed", root.FieldName)
+	}
+
+	ti, err := c.schema.GetTableInfo(root.Name)
+	if err != nil {
+		return err
+	}
+
+	if ti.IsSingular {
+		return fmt.Errorf("stream: %s: only lists can be streamed", root.FieldName)
+	}
+
+	if len(root.Cols) == 0 && len(root.Children) == 0 {
+		return fmt.Errorf("stream: %s: no fields selected", root.FieldName)
+	}
+
+	// the rows are capped by the caller instead of the default limit
+	if root.Paging.Limit == "" {
+		root.Paging.NoLimit = true
+	}
+
+	io.WriteString(c.w, `SELECT "__sj_`)
+	int32String(c.w, root.ID)
+	io.WriteString(c.w, `"."json" FROM (`)
+
+	st := NewIntStack()
+	st.Push(root.ID + closeBlock)
+	st.Push(root.ID)
+
+	if err := c.renderQuery(st, vars); err != nil {
+		return err
+	}
+
+	io.WriteString(c.w, `)`)
+	aliasWithID(c.w, "__sj", root.ID)
+
+	return nil
+}
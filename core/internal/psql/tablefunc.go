@@ -0,0 +1,59 @@
+package psql
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+	"github.com/dosco/super-graph/core/internal/util"
+)
+
+// renderTableFunc renders the call of a function returning rows of the table
+// (eg. `search_products(q => $1 :: text) AS "products"`) in place of the table,
+// the arguments are passed by name so their order and defaults don't matter
+func (c *compilerContext) renderTableFunc(sel *qcode.Select, ti *DBTableInfo) error {
+	fn, ok := c.schema.GetTableFunction(sel.Func)
+	if !ok {
+		return fmt.Errorf("function not found: %s", sel.Func)
+	}
+
+	quoted(c.w, fn.Name)
+	io.WriteString(c.w, `(`)
+
+	for i, a := range sel.FuncArgs {
+		p, err := funcParam(fn, a.Name)
+		if err != nil {
+			return err
+		}
+
+		if i != 0 {
+			io.WriteString(c.w, `,`)
+		}
+		quoted(c.w, p.Name.String)
+		io.WriteString(c.w, ` =>`)
+
+		ex := qcode.Exp{Type: a.Type, Val: a.Val}
+		c.renderVal(&ex, c.vars, &DBColumn{Name: p.Name.String, Type: p.Type})
+	}
+
+	io.WriteString(c.w, `)`)
+	alias(c.w, ti.Name)
+
+	return nil
+}
+
+func funcParam(fn *DBFunction, name string) (*DBFuncParam, error) {
+	names := make([]string, 0, len(fn.Params))
+
+	for i := range fn.Params {
+		p := &fn.Params[i]
+		if strings.EqualFold(p.Name.String, name) {
+			return p, nil
+		}
+		names = append(names, p.Name.String)
+	}
+
+	return nil, fmt.Errorf("function %s: argument '%s' not found, %s",
+		fn.Name, name, util.NotFoundMsg(name, names))
+}
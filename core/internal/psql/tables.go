@@ -10,11 +10,16 @@ import (
 )
 
 type DBInfo struct {
-	Version   int
+	Version int
+
+	// Schema is the default schema, the tables of other schemas
+	// added with AddSchema have their schema set
+	Schema    string
 	Tables    []DBTable
 	Columns   [][]DBColumn
 	Functions []DBFunction
 	VTables   []VirtualTable
+	Enums     []DBEnum
 	colMap    map[string]*DBColumn
 }
 
@@ -23,10 +28,13 @@ type VirtualTable struct {
 	IDColumn   string
 	TypeColumn string
 	FKeyColumn string
+
+	// Types are the values of the type column keyed by table name,
+	// the table name is the value for the tables not in it
+	Types map[string]string
 }
 
 func GetDBInfo(db *sql.DB, schema string, blockList []string) (*DBInfo, error) {
-	di := &DBInfo{}
 	var version string
 
 	err := db.QueryRow(`SHOW server_version_num`).Scan(&version)
@@ -34,20 +42,19 @@ func GetDBInfo(db *sql.DB, schema string, blockList []string) (*DBInfo, error) {
 		return nil, fmt.Errorf("error fetching version: %w", err)
 	}
 
-	di.Version, err = strconv.Atoi(version)
+	dbVersion, err := strconv.Atoi(version)
 	if err != nil {
 		return nil, err
 	}
 
-	di.Tables, err = GetTables(db, schema)
+	dbTables, err := GetTables(db, schema)
 	if err != nil {
 		return nil, err
 	}
 
 	var tables []string
 
-	for i, t := range di.Tables {
-		di.Tables[i].Blocked = isInList(t.Name, blockList)
+	for _, t := range dbTables {
 		tables = append(tables, t.Name)
 	}
 
@@ -56,23 +63,62 @@ func GetDBInfo(db *sql.DB, schema string, blockList []string) (*DBInfo, error) {
 		return nil, err
 	}
 
+	dbColumns := make([][]DBColumn, 0, len(tables))
+
 	for _, t := range tables {
-		c := cols[t]
-		for i := range c {
-			c[i].Blocked = isInList(c[i].Name, blockList)
-		}
-		di.Columns = append(di.Columns, c)
+		dbColumns = append(dbColumns, cols[t])
+	}
+
+	dbFunctions, err := GetFunctions(db, schema, blockList)
+	if err != nil {
+		return nil, err
 	}
-	di.colMap = newColMap(di.Tables, di.Columns)
 
-	di.Functions, err = GetFunctions(db, schema, blockList)
+	dbEnums, err := GetEnums(db, schema)
 	if err != nil {
 		return nil, err
 	}
 
+	di := NewDBInfo(dbVersion, dbTables, dbColumns, dbFunctions, blockList)
+	di.Schema = schema
+	di.Enums = dbEnums
+
 	return di, nil
 }
 
+// NewDBInfo creates the database info from an existing list of tables, columns
+// and functions. It does not need a database connection and is used when the
+// schema is known ahead of time (eg. tests or when compiling queries offline).
+func NewDBInfo(
+	version int,
+	tables []DBTable,
+	columns [][]DBColumn,
+	functions []DBFunction,
+	blockList []string) *DBInfo {
+
+	di := &DBInfo{
+		Version:   version,
+		Tables:    tables,
+		Columns:   columns,
+		Functions: functions,
+	}
+
+	for i, t := range di.Tables {
+		di.Tables[i].Key = strings.ToLower(t.Name)
+		di.Tables[i].Blocked = isInList(t.Name, blockList)
+	}
+
+	for _, c := range di.Columns {
+		for i := range c {
+			c[i].Key = strings.ToLower(c[i].Name)
+			c[i].Blocked = isInList(c[i].Name, blockList)
+		}
+	}
+	di.colMap = newColMap(di.Tables, di.Columns)
+
+	return di
+}
+
 func (di *DBInfo) AddTable(t DBTable, cols []DBColumn) {
 	t.ID = di.Tables[len(di.Tables)-1].ID
 
@@ -86,6 +132,34 @@ func (di *DBInfo) AddTable(t DBTable, cols []DBColumn) {
 	di.Columns = append(di.Columns, cols)
 }
 
+// SetSearch sets the tsvector column or expression used
+// for full text search on the table
+func (di *DBInfo) SetSearch(table, search string) error {
+	for i := range di.Tables {
+		if strings.EqualFold(di.Tables[i].Name, table) {
+			di.Tables[i].Search = search
+			return nil
+		}
+	}
+	return fmt.Errorf("table: %s not found", table)
+}
+
+// SetOrderExp sets a named sql expression the rows of the table can be ordered by
+func (di *DBInfo) SetOrderExp(table, name, exp string) error {
+	for i := range di.Tables {
+		t := &di.Tables[i]
+
+		if strings.EqualFold(t.Name, table) {
+			if t.OrderExps == nil {
+				t.OrderExps = make(map[string]string)
+			}
+			t.OrderExps[name] = exp
+			return nil
+		}
+	}
+	return fmt.Errorf("table: %s not found", table)
+}
+
 func (di *DBInfo) GetColumn(table, column string) (*DBColumn, error) {
 	c, ok := di.colMap[strings.ToLower(table+column)]
 	if !ok {
@@ -101,9 +175,34 @@ type DBTable struct {
 	Key     string
 	Type    string
 	Blocked bool
+	Comment string
+
+	// Schema and Table are the schema and the name in it of a table not
+	// in the default schema, Name is the name it's selected with
+	Schema string
+	Table  string
+
+	// Search is the tsvector column or expression used for full text
+	// search, the last tsvector column of the table is used if not set
+	Search string
+
+	// OrderExps are the sql expressions the rows can be ordered by keyed
+	// by the name used in the order_by argument
+	OrderExps map[string]string
+
+	// SQL is the query of a named sql query (type sql), its rows are
+	// selected in place of a table. SQLArgs are the arguments used in it
+	SQL     string
+	SQLArgs []DBColumn
 }
 
 func GetTables(db *sql.DB, schema string) ([]DBTable, error) {
+	return getTables(db, schema, true)
+}
+
+// getTables returns the tables of the schema, visible limits them to the
+// ones on the search path not hidden by a table of the same name
+func getTables(db *sql.DB, schema string, visible bool) ([]DBTable, error) {
 	sqlStmt := `
 SELECT
 	c.relname as "name",
@@ -111,16 +210,17 @@ SELECT
 		WHEN 'v' THEN 'view'
 		WHEN 'm' THEN 'materialized view'
 		WHEN 'f' THEN 'foreign table' 
-	END as "type"
+	END as "type",
+	coalesce(obj_description(c.oid, 'pg_class'), '') as "comment"
 FROM pg_catalog.pg_class c
 	LEFT JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
 WHERE c.relkind IN ('r','v','m','f','')
 	AND n.nspname = $1
-	AND pg_catalog.pg_table_is_visible(c.oid);`
+	AND (NOT $2 OR pg_catalog.pg_table_is_visible(c.oid));`
 
 	var tables []DBTable
 
-	rows, err := db.Query(sqlStmt, schema)
+	rows, err := db.Query(sqlStmt, schema, visible)
 	if err != nil {
 		return nil, fmt.Errorf("Error fetching tables: %s", err)
 	}
@@ -128,7 +228,7 @@ WHERE c.relkind IN ('r','v','m','f','')
 
 	for i := 0; rows.Next(); i++ {
 		t := DBTable{ID: i}
-		err = rows.Scan(&t.Name, &t.Type)
+		err = rows.Scan(&t.Name, &t.Type, &t.Comment)
 		if err != nil {
 			return nil, err
 		}
@@ -154,6 +254,44 @@ type DBColumn struct {
 	FKeyColID  []int16
 	fKeyColID  pgtype.Int2Array
 	Blocked    bool
+	Comment    string
+
+	// Translated is set for json, jsonb or hstore columns of translations
+	// keyed by locale, the translation for the locale of the request is
+	// selected in place of the column
+	Translated bool
+
+	// Currency is the currency of the amounts in the column (eg. USD),
+	// money columns are returned as numeric and aggregates of the column
+	// use numeric math
+	Currency string
+
+	// GeoJSON is set for geometry or geography columns
+	// returned as GeoJSON
+	GeoJSON bool
+
+	// Generated is set for generated columns (GENERATED ALWAYS AS) and
+	// Identity is ALWAYS or BY DEFAULT for identity columns
+	Generated bool
+	Identity  string
+}
+
+// ReadOnly returns true for the columns set by the database that can't be
+// inserted or updated, generated columns and identity columns generated always
+func (c *DBColumn) ReadOnly() bool {
+	return c.Generated || c.Identity == "ALWAYS"
+}
+
+// GeoType returns geometry or geography for the PostGIS column
+// types (eg. geometry(Point,4326)) and an empty string for others
+func GeoType(t string) string {
+	switch {
+	case strings.HasPrefix(t, "geometry"):
+		return "geometry"
+	case strings.HasPrefix(t, "geography"):
+		return "geography"
+	}
+	return ""
 }
 
 func GetColumns(db *sql.DB, schema string, tables []string) (map[string][]DBColumn, error) {
@@ -178,13 +316,17 @@ SELECT
 		ELSE false
 	END AS uniquekey,
 	CASE
-		WHEN p.contype = ('f'::char) THEN g.relname 
+		WHEN p.contype = ('f'::char) AND gn.nspname = $1 THEN g.relname
+		WHEN p.contype = ('f'::char) THEN gn.nspname || '.' || g.relname
 		ELSE ''::text
 	END AS foreignkey,
 	CASE
 		WHEN p.contype = ('f'::char) THEN p.confkey::int2[]
 		ELSE ARRAY[]::int2[]
-	END AS foreignkey_fieldnum
+	END AS foreignkey_fieldnum,
+	coalesce(col_description(c.oid, f.attnum), '') AS comment,
+	coalesce(ic.is_generated = 'ALWAYS', false) AS generated,
+	coalesce(ic.identity_generation, '') AS identity
 FROM 
 	pg_attribute f
 	JOIN pg_class c ON c.oid = f.attrelid  
@@ -192,6 +334,9 @@ FROM
 	LEFT JOIN pg_namespace n ON n.oid = c.relnamespace  
 	LEFT JOIN pg_constraint p ON p.conrelid = c.oid AND f.attnum = ANY (p.conkey)  
 	LEFT JOIN pg_class AS g ON p.confrelid = g.oid  
+	LEFT JOIN pg_namespace AS gn ON gn.oid = g.relnamespace
+	LEFT JOIN information_schema.columns AS ic ON ic.table_schema = n.nspname
+		AND ic.table_name = c.relname AND ic.column_name = f.attname
 WHERE 
 	c.relkind IN ('r', 'v', 'm', 'f')
 	AND n.nspname = $1 -- Replace with Schema name  
@@ -212,7 +357,8 @@ ORDER BY id;`
 		var t string
 		var c DBColumn
 
-		err = rows.Scan(&t, &c.ID, &c.Name, &c.NotNull, &c.Type, &c.Array, &c.PrimaryKey, &c.UniqueKey, &c.FKeyTable, &c.fKeyColID)
+		err = rows.Scan(&t, &c.ID, &c.Name, &c.NotNull, &c.Type, &c.Array, &c.PrimaryKey, &c.UniqueKey, &c.FKeyTable, &c.fKeyColID, &c.Comment,
+			&c.Generated, &c.Identity)
 		if err != nil {
 			return nil, err
 		}
@@ -274,9 +420,56 @@ ORDER BY id;`
 	return cols, nil
 }
 
+// DBEnum is a user defined enum type and its values in order
+type DBEnum struct {
+	Name   string
+	Values []string
+}
+
+func GetEnums(db *sql.DB, schema string) ([]DBEnum, error) {
+	sqlStmt := `
+SELECT
+	t.typname as "name",
+	e.enumlabel as "value"
+FROM pg_catalog.pg_type t
+	JOIN pg_catalog.pg_enum e ON e.enumtypid = t.oid
+	JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+WHERE n.nspname = $1
+ORDER BY t.typname, e.enumsortorder;`
+
+	rows, err := db.Query(sqlStmt, schema)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching enums: %s", err)
+	}
+	defer rows.Close()
+
+	var enums []DBEnum
+
+	for rows.Next() {
+		var name, val string
+
+		if err := rows.Scan(&name, &val); err != nil {
+			return nil, err
+		}
+
+		if n := len(enums); n == 0 || enums[n-1].Name != name {
+			enums = append(enums, DBEnum{Name: name})
+		}
+		e := &enums[len(enums)-1]
+		e.Values = append(e.Values, val)
+	}
+
+	return enums, nil
+}
+
 type DBFunction struct {
 	Name   string
 	Params []DBFuncParam
+
+	// Table is set when the function returns rows of a table and SetOf
+	// when it returns a set of them (eg. `RETURNS SETOF products`)
+	Table string
+	SetOf bool
 }
 
 type DBFuncParam struct {
@@ -289,15 +482,21 @@ func GetFunctions(db *sql.DB, schema string, blockList []string) ([]DBFunction,
 	sqlStmt := `
 SELECT 
 	routines.routine_name, 
-	parameters.specific_name,
+	routines.specific_name,
+	(CASE WHEN routines.data_type = 'USER-DEFINED' THEN routines.type_udt_name END),
+	COALESCE(pg_proc.proretset, false),
 	parameters.data_type, 
 	parameters.parameter_name,
 	parameters.ordinal_position	
 FROM 
 	information_schema.routines
-RIGHT JOIN 
+LEFT JOIN 
+	pg_proc 
+	ON (pg_proc.oid = substring(routines.specific_name from '_(\d+)$') :: oid)
+LEFT JOIN 
 	information_schema.parameters 
-	ON (routines.specific_name = parameters.specific_name and parameters.ordinal_position IS NOT NULL)	
+	ON (routines.specific_name = parameters.specific_name and parameters.ordinal_position IS NOT NULL
+		and parameters.parameter_mode IN ('IN', 'INOUT'))	
 WHERE 
 	routines.specific_schema = $1
 ORDER BY 
@@ -315,28 +514,41 @@ ORDER BY
 	parameterIndex := 1
 	for rows.Next() {
 		var fn, fid string
+		var rt, pt sql.NullString
+		var pid sql.NullInt64
+		var setOf bool
 		fp := DBFuncParam{}
 
-		err = rows.Scan(&fn, &fid, &fp.Type, &fp.Name, &fp.ID)
+		err = rows.Scan(&fn, &fid, &rt, &setOf, &pt, &fp.Name, &pid)
 		if err != nil {
 			return nil, err
 		}
 
-		if !fp.Name.Valid {
-			fp.Name.String = string(parameterIndex)
-			fp.Name.Valid = true
-		}
-
-		if i, ok := fm[fid]; ok {
-			funcs[i].Params = append(funcs[i].Params, fp)
-		} else {
+		i, ok := fm[fid]
+		if !ok {
 			if isInList(fn, blockList) {
 				continue
 			}
 
-			funcs = append(funcs, DBFunction{Name: fn, Params: []DBFuncParam{fp}})
-			fm[fid] = len(funcs) - 1
+			funcs = append(funcs, DBFunction{Name: fn, Table: rt.String, SetOf: setOf})
+			i = len(funcs) - 1
+			fm[fid] = i
+		}
+
+		// functions without arguments have no parameters
+		if !pid.Valid {
+			continue
+		}
+
+		fp.ID = int(pid.Int64)
+		fp.Type = pt.String
+
+		if !fp.Name.Valid {
+			fp.Name.String = strconv.Itoa(parameterIndex)
+			fp.Name.Valid = true
 		}
+
+		funcs[i].Params = append(funcs[i].Params, fp)
 		parameterIndex++
 	}
 
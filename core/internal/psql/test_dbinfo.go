@@ -1,18 +1,17 @@
 package psql
 
-import (
-	"strings"
-)
+import "database/sql"
 
 func GetTestDBInfo() *DBInfo {
 	tables := []DBTable{
 		DBTable{Name: "customers", Type: "table"},
-		DBTable{Name: "users", Type: "table"},
+		DBTable{Name: "users", Type: "table", Comment: "People with an account"},
 		DBTable{Name: "products", Type: "table"},
 		DBTable{Name: "purchases", Type: "table"},
 		DBTable{Name: "tags", Type: "table"},
 		DBTable{Name: "tag_count", Type: "json"},
 		DBTable{Name: "notifications", Type: "table"},
+		DBTable{Name: "comments", Type: "table"},
 	}
 
 	columns := [][]DBColumn{
@@ -26,13 +25,14 @@ func GetTestDBInfo() *DBInfo {
 			DBColumn{ID: 7, Name: "reset_password_sent_at", Type: "timestamp without time zone", NotNull: false, PrimaryKey: false, UniqueKey: false},
 			DBColumn{ID: 8, Name: "remember_created_at", Type: "timestamp without time zone", NotNull: false, PrimaryKey: false, UniqueKey: false},
 			DBColumn{ID: 9, Name: "created_at", Type: "timestamp without time zone", NotNull: true, PrimaryKey: false, UniqueKey: false},
-			DBColumn{ID: 10, Name: "updated_at", Type: "timestamp without time zone", NotNull: true, PrimaryKey: false, UniqueKey: false}},
+			DBColumn{ID: 10, Name: "updated_at", Type: "timestamp without time zone", NotNull: true, PrimaryKey: false, UniqueKey: false},
+			DBColumn{ID: 11, Name: "metadata", Type: "jsonb", NotNull: false, PrimaryKey: false, UniqueKey: false}},
 		[]DBColumn{
 			DBColumn{ID: 1, Name: "id", Type: "bigint", NotNull: true, PrimaryKey: true, UniqueKey: true},
 			DBColumn{ID: 2, Name: "full_name", Type: "character varying", NotNull: true, PrimaryKey: false, UniqueKey: false},
 			DBColumn{ID: 3, Name: "phone", Type: "character varying", NotNull: false, PrimaryKey: false, UniqueKey: false},
 			DBColumn{ID: 4, Name: "avatar", Type: "character varying", NotNull: false, PrimaryKey: false, UniqueKey: false},
-			DBColumn{ID: 5, Name: "email", Type: "character varying", NotNull: true, PrimaryKey: false, UniqueKey: false},
+			DBColumn{ID: 5, Name: "email", Type: "character varying", NotNull: true, PrimaryKey: false, UniqueKey: false, Comment: "Used to sign in"},
 			DBColumn{ID: 6, Name: "encrypted_password", Type: "character varying", NotNull: true, PrimaryKey: false, UniqueKey: false},
 			DBColumn{ID: 7, Name: "reset_password_token", Type: "character varying", NotNull: false, PrimaryKey: false, UniqueKey: false},
 			DBColumn{ID: 8, Name: "reset_password_sent_at", Type: "timestamp without time zone", NotNull: false, PrimaryKey: false, UniqueKey: false},
@@ -61,7 +61,8 @@ func GetTestDBInfo() *DBInfo {
 		[]DBColumn{
 			DBColumn{ID: 1, Name: "id", Type: "bigint", NotNull: true, PrimaryKey: true, UniqueKey: true},
 			DBColumn{ID: 2, Name: "name", Type: "text", NotNull: false, PrimaryKey: false, UniqueKey: false},
-			DBColumn{ID: 3, Name: "slug", Type: "text", NotNull: false, PrimaryKey: false, UniqueKey: false}},
+			DBColumn{ID: 3, Name: "slug", Type: "text", NotNull: false, PrimaryKey: false, UniqueKey: false},
+			DBColumn{ID: 4, Name: "title", Type: "jsonb", NotNull: false, PrimaryKey: false, UniqueKey: false, Translated: true}},
 		[]DBColumn{
 			DBColumn{ID: 1, Name: "tag_id", Type: "bigint", NotNull: false, PrimaryKey: false, UniqueKey: false, FKeyTable: "tags", FKeyColID: []int16{1}},
 			DBColumn{ID: 2, Name: "count", Type: "int", NotNull: false, PrimaryKey: false, UniqueKey: false}},
@@ -70,6 +71,10 @@ func GetTestDBInfo() *DBInfo {
 			DBColumn{ID: 2, Name: "key", Type: "text", NotNull: false, PrimaryKey: false, UniqueKey: false},
 			DBColumn{ID: 2, Name: "subject_type", Type: "text", NotNull: false, PrimaryKey: false, UniqueKey: false},
 			DBColumn{ID: 2, Name: "subject_id", Type: "bigint", NotNull: false, PrimaryKey: false, UniqueKey: false}},
+		[]DBColumn{
+			DBColumn{ID: 1, Name: "id", Type: "bigint", NotNull: true, PrimaryKey: true, UniqueKey: true},
+			DBColumn{ID: 2, Name: "body", Type: "text", NotNull: false, PrimaryKey: false, UniqueKey: false},
+			DBColumn{ID: 3, Name: "parent_id", Type: "bigint", NotNull: false, PrimaryKey: false, UniqueKey: false, FKeyTable: "comments", FKeyColID: []int16{1}}},
 	}
 
 	vTables := []VirtualTable{{
@@ -79,21 +84,19 @@ func GetTestDBInfo() *DBInfo {
 		FKeyColumn: "id"},
 	}
 
-	for i := range tables {
-		tables[i].Key = strings.ToLower(tables[i].Name)
-		for n := range columns[i] {
-			columns[i][n].Key = strings.ToLower(columns[i][n].Name)
-		}
-	}
+	functions := []DBFunction{{
+		Name:  "search_products",
+		Table: "products",
+		SetOf: true,
+		Params: []DBFuncParam{
+			{ID: 1, Name: sql.NullString{String: "q", Valid: true}, Type: "text"},
+			{ID: 2, Name: sql.NullString{String: "max_price", Valid: true}, Type: "numeric"}},
+	}}
 
-	return &DBInfo{
-		Version:   110000,
-		Tables:    tables,
-		Columns:   columns,
-		Functions: []DBFunction{},
-		VTables:   vTables,
-		colMap:    newColMap(tables, columns),
-	}
+	di := NewDBInfo(110000, tables, columns, functions, nil)
+	di.VTables = vTables
+
+	return di
 }
 
 func GetTestSchema() (*DBSchema, error) {
@@ -62,6 +62,8 @@ SELECT jsonb_build_object('products', "__sj_0"."json") as "__root" FROM (VALUES(
 SELECT jsonb_build_object('product', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "products_0"."id" AS "id", "products_0"."name" AS "name" FROM (SELECT "products"."id", "products"."name" FROM "products" WHERE ((((("products"."price") > '0' :: numeric(7,2)) AND (("products"."price") < '8' :: numeric(7,2))) AND (("products"."id") = $1 :: bigint))) LIMIT ('1') :: integer) AS "products_0") AS "__sr_0") AS "__sj_0" ON true
 === RUN   TestCompileQuery/searchQuery
 SELECT jsonb_build_object('products', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "products_0"."id" AS "id", "products_0"."name" AS "name", "products_0"."search_rank" AS "search_rank", "products_0"."search_headline_description" AS "search_headline_description" FROM (SELECT "products"."id", "products"."name", ts_rank("products"."tsv", websearch_to_tsquery($1)) AS "search_rank", ts_headline("products"."description", websearch_to_tsquery($1)) AS "search_headline_description" FROM "products" WHERE ((("products"."tsv") @@ websearch_to_tsquery($1))) LIMIT ('20') :: integer) AS "products_0") AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
+=== RUN   TestCompileQuery/searchQueryString
+SELECT jsonb_build_object('products', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "products_0"."id" AS "id", "products_0"."search_rank" AS "search_rank" FROM (SELECT "products"."id", ts_rank("products"."tsv", websearch_to_tsquery('running shoes')) AS "search_rank" FROM "products" WHERE ((("products"."tsv") @@ websearch_to_tsquery('running shoes'))) ORDER BY "search_rank" DESC LIMIT ('20') :: integer) AS "products_0") AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
 === RUN   TestCompileQuery/oneToMany
 SELECT jsonb_build_object('users', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "users_0"."email" AS "email", "__sj_1"."json" AS "products" FROM (SELECT "users"."email", "users"."id" FROM "users" LIMIT ('20') :: integer) AS "users_0" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_1"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_1".*) AS "json" FROM (SELECT "products_1"."name" AS "name", "products_1"."price" AS "price" FROM (SELECT "products"."name", "products"."price" FROM "products" WHERE ((("products"."user_id") = ("users_0"."id")) AND ((("products"."price") > '0' :: numeric(7,2)) AND (("products"."price") < '8' :: numeric(7,2)))) LIMIT ('20') :: integer) AS "products_1") AS "__sr_1") AS "__sj_1") AS "__sj_1" ON true) AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
 === RUN   TestCompileQuery/oneToManyReverse
@@ -78,6 +80,10 @@ SELECT jsonb_build_object('products', "__sj_0"."json") as "__root" FROM (VALUES(
 === RUN   TestCompileQuery/aggFunctionDisabled
 === RUN   TestCompileQuery/aggFunctionWithFilter
 SELECT jsonb_build_object('products', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "products_0"."id" AS "id", "products_0"."max_price" AS "max_price" FROM (SELECT "products"."id", max("products"."price") AS "max_price" FROM "products" WHERE ((((("products"."price") > '0' :: numeric(7,2)) AND (("products"."price") < '8' :: numeric(7,2))) AND (("products"."id") > '10' :: bigint))) GROUP BY "products"."id" LIMIT ('20') :: integer) AS "products_0") AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
+=== RUN   TestCompileQuery/aggFunctionGroupBy
+SELECT jsonb_build_object('products', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "products_0"."name" AS "name", "products_0"."count_id" AS "count_id", "products_0"."avg_price" AS "avg_price" FROM (SELECT "products"."name", count("products"."id") AS "count_id", avg("products"."price") AS "avg_price" FROM "products" WHERE (((("products"."price") > '0' :: numeric(7,2)) AND (("products"."price") < '8' :: numeric(7,2)))) GROUP BY "products"."name" ORDER BY "products"."name" ASC LIMIT ('20') :: integer) AS "products_0") AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
+=== RUN   TestCompileQuery/aggFunctionNotNumeric
+=== RUN   TestCompileQuery/aggFunctionNotGrouped
 === RUN   TestCompileQuery/syntheticTables
 SELECT jsonb_build_object('me', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "users_0"."email" AS "email" FROM (SELECT "users"."email" FROM "users" WHERE ((("users"."id") = $1 :: bigint)) LIMIT ('1') :: integer) AS "users_0") AS "__sr_0") AS "__sj_0" ON true
 === RUN   TestCompileQuery/queryWithVariables
@@ -94,6 +100,8 @@ SELECT jsonb_build_object('users', "__sj_0"."json") as "__root" FROM (VALUES(tru
 SELECT jsonb_build_object('users', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "users_0"."full_name" AS "full_name", "users_0"."avatar" AS "avatar", "users_0"."id" AS "id", "users_0"."email" AS "email" FROM (SELECT "users"."full_name", "users"."avatar", "users"."id", "users"."email" FROM "users" LIMIT ('20') :: integer) AS "users_0") AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
 === RUN   TestCompileQuery/withFragment4
 SELECT jsonb_build_object('users', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "users_0"."full_name" AS "full_name", "users_0"."avatar" AS "avatar", "users_0"."id" AS "id", "users_0"."email" AS "email" FROM (SELECT "users"."full_name", "users"."avatar", "users"."id", "users"."email" FROM "users" LIMIT ('20') :: integer) AS "users_0") AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
+=== RUN   TestCompileQuery/withInlineFragment
+SELECT jsonb_build_object('users', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "users_0"."full_name" AS "full_name", "users_0"."avatar" AS "avatar", "users_0"."id" AS "id", "users_0"."email" AS "email" FROM (SELECT "users"."full_name", "users"."avatar", "users"."id", "users"."email" FROM "users" LIMIT ('20') :: integer) AS "users_0") AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
 === RUN   TestCompileQuery/withPolymorphicUnion
 SELECT jsonb_build_object('notifications', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "notifications_0"."id" AS "id", (CASE WHEN "notifications_0"."subject_type" = 'products' THEN "__sj_2"."json" WHEN "notifications_0"."subject_type" = 'users' THEN "__sj_3"."json" END) AS "subject" FROM (SELECT "notifications"."id", "notifications"."subject_id", "notifications"."subject_type" FROM "notifications" LIMIT ('20') :: integer) AS "notifications_0" LEFT OUTER JOIN LATERAL (SELECT to_jsonb("__sr_3".*) AS "json" FROM (SELECT "users_3"."id" AS "id", "users_3"."email" AS "email" FROM (SELECT "users"."id", "users"."email" FROM "users" WHERE ((("users"."id") = ("notifications_0"."subject_id") AND ("notifications_0"."subject_type") = ('users'))) LIMIT ('20') :: integer) AS "users_3") AS "__sr_3") AS "__sj_3" ON true LEFT OUTER JOIN LATERAL (SELECT to_jsonb("__sr_2".*) AS "json" FROM (SELECT "products_2"."id" AS "id", "products_2"."name" AS "name" FROM (SELECT "products"."id", "products"."name" FROM "products" WHERE ((("products"."id") = ("notifications_0"."subject_id") AND ("notifications_0"."subject_type") = ('products')) AND ((("products"."price") > '0' :: numeric(7,2)) AND (("products"."price") < '8' :: numeric(7,2)))) LIMIT ('20') :: integer) AS "products_2") AS "__sr_2") AS "__sj_2" ON true) AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
 === RUN   TestCompileQuery/subscription
@@ -102,6 +110,8 @@ SELECT jsonb_build_object('user', "__sj_0"."json") as "__root" FROM (VALUES(true
 SELECT jsonb_build_object('products', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "products_0"."id" AS "id", "products_0"."name" AS "name", "__sj_1"."json" AS "tag_count" FROM (SELECT "products"."id", "products"."name" FROM "products" LIMIT ('20') :: integer) AS "products_0" LEFT OUTER JOIN LATERAL (SELECT to_jsonb("__sr_1".*) AS "json" FROM (SELECT "tag_count_1"."count" AS "count", "__sj_2"."json" AS "tags" FROM (SELECT "tag_count"."count", "tag_count"."tag_id" FROM "products", json_to_recordset("products"."tag_count") AS "tag_count"(tag_id bigint, count int) WHERE ((("products"."id") = ("products_0"."id"))) LIMIT ('1') :: integer) AS "tag_count_1" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_2"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_2".*) AS "json" FROM (SELECT "tags_2"."name" AS "name" FROM (SELECT "tags"."name" FROM "tags" WHERE ((("tags"."id") = ("tag_count_1"."tag_id"))) LIMIT ('20') :: integer) AS "tags_2") AS "__sr_2") AS "__sj_2") AS "__sj_2" ON true) AS "__sr_1") AS "__sj_1" ON true) AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
 === RUN   TestCompileQuery/withCursor
 SELECT jsonb_build_object('products', "__sj_0"."json", 'products_cursor', "__sj_0"."cursor") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json", CONCAT_WS(',', max("__cur_0"), max("__cur_1")) as "cursor" FROM (SELECT to_jsonb("__sr_0".*) - '__cur_0' - '__cur_1' AS "json" , "__cur_0", "__cur_1"FROM (SELECT "products_0"."name" AS "name", LAST_VALUE("products_0"."price") OVER() AS "__cur_0", LAST_VALUE("products_0"."id") OVER() AS "__cur_1" FROM (WITH "__cur" AS (SELECT a[1] :: numeric(7,2) as "price", a[2] :: bigint as "id" FROM string_to_array($1, ',') as a) SELECT "products"."name", "products"."id", "products"."price" FROM "products", "__cur" WHERE (((("__cur"."price") IS NULL) OR (("products"."price") < "__cur"."price" :: numeric(7,2)) OR ((("products"."price") = "__cur"."price" :: numeric(7,2)) AND (("products"."id") > "__cur"."id" :: bigint)))) ORDER BY "products"."price" DESC, "products"."id" ASC LIMIT ('20') :: integer) AS "products_0") AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
+=== RUN   TestCompileQuery/withRowCursor
+SELECT jsonb_build_object('products', "__sj_0"."json", 'products_cursor', "__sj_0"."cursor") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json", CONCAT_WS(',', max("__cur_0"), max("__cur_1")) as "cursor" FROM (SELECT to_jsonb("__sr_0".*) - '__cur_0' - '__cur_1' AS "json" , "__cur_0", "__cur_1"FROM (SELECT "products_0"."name" AS "name", CONCAT_WS(',', "products_0"."price", "products_0"."id") AS "cursor", LAST_VALUE("products_0"."price") OVER() AS "__cur_0", LAST_VALUE("products_0"."id") OVER() AS "__cur_1" FROM (WITH "__cur" AS (SELECT a[1] :: numeric(7,2) as "price", a[2] :: bigint as "id" FROM string_to_array($1, ',') as a) SELECT "products"."name", "products"."id", "products"."price" FROM "products", "__cur" WHERE (((("__cur"."price") IS NULL) OR (("products"."price") < "__cur"."price" :: numeric(7,2)) OR ((("products"."price") = "__cur"."price" :: numeric(7,2)) AND (("products"."id") > "__cur"."id" :: bigint)))) ORDER BY "products"."price" DESC, "products"."id" ASC LIMIT ('20') :: integer) AS "products_0") AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
 === RUN   TestCompileQuery/nullForAuthRequiredInAnon
 SELECT jsonb_build_object('products', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "products_0"."id" AS "id", "products_0"."name" AS "name", NULL AS "user" FROM (SELECT "products"."id", "products"."name", "products"."user_id" FROM "products" LIMIT ('20') :: integer) AS "products_0") AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
 === RUN   TestCompileQuery/blockedQuery
@@ -116,6 +126,7 @@ SELECT jsonb_build_object('user', "__sj_0"."json") as "__root" FROM (VALUES(true
     --- PASS: TestCompileQuery/withWhereMultiOr (0.00s)
     --- PASS: TestCompileQuery/fetchByID (0.00s)
     --- PASS: TestCompileQuery/searchQuery (0.00s)
+    --- PASS: TestCompileQuery/searchQueryString (0.00s)
     --- PASS: TestCompileQuery/oneToMany (0.00s)
     --- PASS: TestCompileQuery/oneToManyReverse (0.00s)
     --- PASS: TestCompileQuery/oneToManyArray (0.00s)
@@ -125,6 +136,9 @@ SELECT jsonb_build_object('user', "__sj_0"."json") as "__root" FROM (VALUES(true
     --- PASS: TestCompileQuery/aggFunctionBlockedByCol (0.00s)
     --- PASS: TestCompileQuery/aggFunctionDisabled (0.00s)
     --- PASS: TestCompileQuery/aggFunctionWithFilter (0.00s)
+    --- PASS: TestCompileQuery/aggFunctionGroupBy (0.00s)
+    --- PASS: TestCompileQuery/aggFunctionNotNumeric (0.00s)
+    --- PASS: TestCompileQuery/aggFunctionNotGrouped (0.00s)
     --- PASS: TestCompileQuery/syntheticTables (0.00s)
     --- PASS: TestCompileQuery/queryWithVariables (0.00s)
     --- PASS: TestCompileQuery/withWhereOnRelations (0.00s)
@@ -133,16 +147,20 @@ SELECT jsonb_build_object('user', "__sj_0"."json") as "__root" FROM (VALUES(true
     --- PASS: TestCompileQuery/withFragment2 (0.00s)
     --- PASS: TestCompileQuery/withFragment3 (0.00s)
     --- PASS: TestCompileQuery/withFragment4 (0.00s)
+    --- PASS: TestCompileQuery/withInlineFragment (0.00s)
     --- PASS: TestCompileQuery/withPolymorphicUnion (0.00s)
     --- PASS: TestCompileQuery/subscription (0.00s)
     --- PASS: TestCompileQuery/jsonColumnAsTable (0.00s)
     --- PASS: TestCompileQuery/withCursor (0.00s)
+    --- PASS: TestCompileQuery/withRowCursor (0.00s)
     --- PASS: TestCompileQuery/nullForAuthRequiredInAnon (0.00s)
     --- PASS: TestCompileQuery/blockedQuery (0.00s)
     --- PASS: TestCompileQuery/blockedFunctions (0.00s)
 === RUN   TestCompileUpdate
 === RUN   TestCompileUpdate/singleUpdate
 WITH "_sg_input" AS (SELECT $1 :: json AS j), "products" AS (UPDATE "products" SET ("name", "description") = (SELECT CAST( i.j ->>'name' AS character varying), CAST( i.j ->>'description' AS text) FROM "_sg_input" i) WHERE ((("products"."id") = '1' :: bigint) AND (("products"."id") = $2 :: bigint)) RETURNING "products".*) SELECT jsonb_build_object('product', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "products_0"."id" AS "id", "products_0"."name" AS "name" FROM (SELECT "products"."id", "products"."name" FROM "products" LIMIT ('1') :: integer) AS "products_0") AS "__sr_0") AS "__sj_0" ON true
+=== RUN   TestCompileUpdate/bulkUpdate
+WITH "_sg_input" AS (SELECT json_array_elements($1 :: json) AS j), "products" AS (UPDATE "products" SET ("name") = (SELECT CAST( i.j ->>'name' AS character varying)) FROM "_sg_input" i WHERE (("products"."id") = (CAST( i.j ->>'id' AS bigint)) AND (("products"."price") > '0' :: numeric(7,2))) RETURNING "products".*) SELECT jsonb_build_object('products', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT coalesce(jsonb_agg("__sj_0"."json"), '[]') as "json" FROM (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "products_0"."id" AS "id", "products_0"."name" AS "name" FROM (SELECT "products"."id", "products"."name" FROM "products") AS "products_0") AS "__sr_0") AS "__sj_0") AS "__sj_0" ON true
 === RUN   TestCompileUpdate/simpleUpdateWithPresets
 WITH "_sg_input" AS (SELECT $1 :: json AS j), "products" AS (UPDATE "products" SET ("name", "price", "updated_at") = (SELECT CAST( i.j ->>'name' AS character varying), CAST( i.j ->>'price' AS numeric(7,2)), 'now' :: timestamp without time zone FROM "_sg_input" i) WHERE (("products"."user_id") = $2 :: bigint) RETURNING "products".*) SELECT jsonb_build_object('product', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "products_0"."id" AS "id" FROM (SELECT "products"."id" FROM "products" LIMIT ('1') :: integer) AS "products_0") AS "__sr_0") AS "__sj_0" ON true
 === RUN   TestCompileUpdate/nestedUpdateManyToMany
@@ -161,6 +179,7 @@ WITH "_sg_input" AS (SELECT $1 :: json AS j), "_x_users" AS (SELECT "id" FROM "_
 WITH "_sg_input" AS (SELECT $1 :: json AS j), "_x_users" AS (SELECT * FROM (VALUES(NULL::bigint)) AS LOOKUP("id")), "products" AS (UPDATE "products" SET ("name", "price", "user_id") = (SELECT CAST( i.j ->>'name' AS character varying), CAST( i.j ->>'price' AS numeric(7,2)), "_x_users"."id" FROM "_sg_input" i, "_x_users") WHERE (("products"."id") = $2 :: bigint) RETURNING "products".*) SELECT jsonb_build_object('product', "__sj_0"."json") as "__root" FROM (VALUES(true)) as "__root_x" LEFT OUTER JOIN LATERAL (SELECT to_jsonb("__sr_0".*) AS "json" FROM (SELECT "products_0"."id" AS "id", "products_0"."name" AS "name", "products_0"."user_id" AS "user_id" FROM (SELECT "products"."id", "products"."name", "products"."user_id" FROM "products" LIMIT ('1') :: integer) AS "products_0") AS "__sr_0") AS "__sj_0" ON true
 --- PASS: TestCompileUpdate (0.02s)
     --- PASS: TestCompileUpdate/singleUpdate (0.00s)
+    --- PASS: TestCompileUpdate/bulkUpdate (0.00s)
     --- PASS: TestCompileUpdate/simpleUpdateWithPresets (0.00s)
     --- PASS: TestCompileUpdate/nestedUpdateManyToMany (0.00s)
     --- PASS: TestCompileUpdate/nestedUpdateOneToMany (0.00s)
@@ -0,0 +1,71 @@
+package psql_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestTimestamps(t *testing.T) {
+	schema, err := psql.GetTestSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := psql.NewCompiler(psql.Config{Schema: schema, Timestamps: []string{"products"}})
+
+	vars := psql.Variables{
+		"data": json.RawMessage(`{"id": 5, "name": "a", "created_at": "2000-01-01"}`),
+	}
+
+	tests := []struct {
+		gql  string
+		exp  []string
+		nexp []string
+	}{
+		{
+			gql: `mutation { product(insert: $data) { id } }`,
+			exp: []string{
+				`INSERT INTO "products" ("id", "name", "created_at", "updated_at")`,
+				`SELECT CAST( i.j ->>'id' AS bigint), CAST( i.j ->>'name' AS character varying), now(), now()`,
+			},
+		},
+		{
+			gql:  `mutation { product(id: $id, update: $data) { id } }`,
+			exp:  []string{`SET ("id", "name", "updated_at")`},
+			nexp: []string{`"created_at"`},
+		},
+		{
+			gql: `mutation { product(upsert: $data) { id } }`,
+			exp: []string{
+				`("id", "name", "created_at", "updated_at")`,
+				`DO UPDATE SET id = EXCLUDED.id, name = EXCLUDED.name, "updated_at" = EXCLUDED."updated_at"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		qc, err := qcompile.Compile([]byte(tt.gql), "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, sql, err := pc.CompileEx(qc, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, v := range tt.exp {
+			if !strings.Contains(string(sql), v) {
+				t.Fatalf("expected '%s' in: %s", v, sql)
+			}
+		}
+
+		for _, v := range tt.nexp {
+			if strings.Contains(string(sql), v) {
+				t.Fatalf("unexpected '%s' in: %s", v, sql)
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package psql
+
+import (
+	"io"
+)
+
+// LocalesParam is the param the locales of the request are passed in as
+// a json array (eg. ["fr-CA", "fr", "en"]), the first one a translated
+// column has a value for is selected
+const LocalesParam = "_sg_locales"
+
+// renderTranslatedCol renders the translation of a column for the first of
+// the locales of the request it has a value for. The locales are a param so
+// the same sql works for every locale.
+func (c *compilerContext) renderTranslatedCol(ti *DBTableInfo, col *DBColumn) {
+	op := ` ->> `
+	if col.Type == "hstore" {
+		op = ` -> `
+	}
+
+	io.WriteString(c.w, `(SELECT `)
+	colWithTable(c.w, ti.Name, col.Name)
+	io.WriteString(c.w, op)
+	io.WriteString(c.w, `"__sg_l"."l" FROM json_array_elements_text(`)
+	c.md.renderParam(c.w, Param{Name: LocalesParam, Type: "json"})
+	io.WriteString(c.w, ` :: json) WITH ORDINALITY AS "__sg_l"("l", "n") WHERE (`)
+	colWithTable(c.w, ti.Name, col.Name)
+	io.WriteString(c.w, op)
+	io.WriteString(c.w, `"__sg_l"."l") IS NOT NULL ORDER BY "__sg_l"."n" LIMIT 1)`)
+	alias(c.w, col.Name)
+}
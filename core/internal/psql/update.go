@@ -21,10 +21,19 @@ func (c *compilerContext) renderUpdate(
 		return 0, fmt.Errorf("variable '%s' is empty", qc.ActionVar)
 	}
 
-	io.WriteString(c.w, `WITH "_sg_input" AS (SELECT `)
+	c.renderWith()
+	c.renderInputName()
+	io.WriteString(c.w, ` AS (SELECT `)
+	if update[0] == '[' {
+		io.WriteString(c.w, `json_array_elements(`)
+	}
 	c.md.renderParam(c.w, Param{Name: qc.ActionVar, Type: "json"})
 	// io.WriteString(c.w, qc.ActionVar)
-	io.WriteString(c.w, ` :: json AS j)`)
+	io.WriteString(c.w, ` :: json`)
+	if update[0] == '[' {
+		io.WriteString(c.w, `)`)
+	}
+	io.WriteString(c.w, ` AS j)`)
 
 	st := util.NewStack()
 	st.Push(kvitem{_type: itemUpdate, key: ti.Name, val: update, ti: ti})
@@ -53,7 +62,11 @@ func (c *compilerContext) renderUpdate(
 
 			switch item._type {
 			case itemUpdate:
-				err = c.renderUpdateStmt(w, qc, item)
+				if item.array {
+					err = c.renderBulkUpdateStmt(w, qc, item)
+				} else {
+					err = c.renderUpdateStmt(w, qc, item)
+				}
 			case itemConnect:
 				err = c.renderConnectStmt(qc, w, item)
 			case itemDisconnect:
@@ -83,7 +96,8 @@ func (c *compilerContext) renderUpdateStmt(w io.Writer, qc *qcode.QCode, item re
 	io.WriteString(c.w, ` AS (`)
 
 	io.WriteString(w, `UPDATE `)
-	quoted(w, ti.Name)
+	c.renderTableAs(w, ti.Name)
+	c.addCte(item.kvitem)
 	io.WriteString(w, ` SET (`)
 	if rc, err := c.renderInsertUpdateColumns(qc, jt, ti, sk, false); err != nil {
 		return err
@@ -98,7 +112,9 @@ func (c *compilerContext) renderUpdateStmt(w io.Writer, qc *qcode.QCode, item re
 		renderNestedUpdateRelColumns(w, item.kvitem, true, rc)
 	}
 
-	io.WriteString(w, ` FROM "_sg_input" i`)
+	io.WriteString(w, ` FROM `)
+	c.renderInputName()
+	io.WriteString(w, ` i`)
 	renderNestedUpdateRelTables(w, item.kvitem)
 	io.WriteString(w, `) `)
 
@@ -108,7 +124,7 @@ func (c *compilerContext) renderUpdateStmt(w io.Writer, qc *qcode.QCode, item re
 		rel := item.relCP
 
 		io.WriteString(w, `FROM `)
-		quoted(w, rel.Right.Table)
+		c.renderTable(w, rel.Right.Table)
 
 		io.WriteString(w, ` WHERE ((`)
 		colWithTable(w, rel.Left.Table, rel.Left.Col)
@@ -141,6 +157,65 @@ func (c *compilerContext) renderUpdateStmt(w io.Writer, qc *qcode.QCode, item re
 	return nil
 }
 
+// renderBulkUpdateStmt renders the update of a list of objects, each row
+// is matched to its object by the primary key and updated with its values
+func (c *compilerContext) renderBulkUpdateStmt(w io.Writer, qc *qcode.QCode, item renitem) error {
+	ti := item.ti
+	pk := ti.PrimaryCol
+
+	if pk == nil {
+		return fmt.Errorf("bulk update: table '%s' has no primary key", ti.Name)
+	}
+	if _, ok := item.data[pk.Key]; !ok {
+		return fmt.Errorf("bulk update: primary key '%s' missing in the objects", pk.Key)
+	}
+
+	// the primary key only matches the rows
+	sk := map[string]struct{}{pk.Name: {}}
+
+	io.WriteString(c.w, `, `)
+	renderCteName(c.w, item.kvitem)
+	io.WriteString(c.w, ` AS (`)
+
+	io.WriteString(w, `UPDATE `)
+	c.renderTableAs(w, ti.Name)
+	c.addCte(item.kvitem)
+	io.WriteString(w, ` SET (`)
+	if rc, err := c.renderInsertUpdateColumns(qc, item.data, ti, sk, false); err != nil {
+		return err
+	} else if !rc {
+		return errors.New("bulk update: no columns to update")
+	}
+
+	io.WriteString(w, `) = (SELECT `)
+	if _, err := c.renderInsertUpdateColumns(qc, item.data, ti, sk, true); err != nil {
+		return err
+	}
+
+	io.WriteString(w, `) FROM `)
+	c.renderInputName()
+	io.WriteString(w, ` i WHERE ((`)
+	colWithTable(w, ti.Name, pk.Name)
+	io.WriteString(w, `) = (CAST( i.j ->>'`)
+	io.WriteString(w, pk.Name)
+	io.WriteString(w, `' AS `)
+	io.WriteString(w, pk.Type)
+	io.WriteString(w, `))`)
+
+	if qc.Selects[0].Where != nil {
+		io.WriteString(w, ` AND `)
+		if err := c.renderWhere(&qc.Selects[0], ti); err != nil {
+			return err
+		}
+	}
+
+	io.WriteString(w, `) RETURNING `)
+	quoted(w, ti.Name)
+	io.WriteString(w, `.*)`)
+
+	return nil
+}
+
 func nestedUpdateRelColumnsMap(item kvitem) map[string]struct{} {
 	sk := make(map[string]struct{}, len(item.items))
 
@@ -198,7 +273,7 @@ func renderNestedUpdateRelTables(w io.Writer, item kvitem) error {
 	for _, v := range item.items {
 		if v._ctype > 0 && v.relCP.Type == RelOneToMany {
 			io.WriteString(w, `, "_x_`)
-			io.WriteString(w, v.relCP.Left.Table)
+			escapeIdent(w, v.relCP.Left.Table)
 			io.WriteString(w, `"`)
 		}
 	}
@@ -211,11 +286,12 @@ func (c *compilerContext) renderDelete(
 
 	root := &qc.Selects[0]
 
-	io.WriteString(c.w, `WITH `)
+	c.renderWith()
 	quoted(c.w, ti.Name)
 
 	io.WriteString(c.w, ` AS (DELETE FROM `)
-	quoted(c.w, ti.Name)
+	c.renderTableAs(c.w, ti.Name)
+	c.addCteName(ti.Name)
 	io.WriteString(c.w, ` WHERE `)
 
 	if root.Where == nil {
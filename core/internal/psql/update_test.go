@@ -20,6 +20,25 @@ func singleUpdate(t *testing.T) {
 	compileGQLToPSQL(t, gql, vars, "anon")
 }
 
+func bulkUpdate(t *testing.T) {
+	gql := `mutation {
+		products(update: $data, where: { price: { gt: 0 } }) {
+			id
+			name
+		}
+	}`
+
+	vars := map[string]json.RawMessage{
+		"data": json.RawMessage(`[{ "id": 1, "name": "Apple" }, { "id": 2, "name": "Pear" }]`),
+	}
+
+	compileGQLToPSQL(t, gql, vars, "admin")
+
+	// each object needs the primary key
+	vars["data"] = json.RawMessage(`[{ "name": "Apple" }]`)
+	compileGQLToPSQLExpectErr(t, gql, vars, "admin")
+}
+
 func simpleUpdateWithPresets(t *testing.T) {
 	gql := `mutation {
 		product(update: $data) {
@@ -247,6 +266,7 @@ func nestedUpdateOneToOneWithDisconnect(t *testing.T) {
 
 func TestCompileUpdate(t *testing.T) {
 	t.Run("singleUpdate", singleUpdate)
+	t.Run("bulkUpdate", bulkUpdate)
 	t.Run("simpleUpdateWithPresets", simpleUpdateWithPresets)
 	t.Run("nestedUpdateManyToMany", nestedUpdateManyToMany)
 	t.Run("nestedUpdateOneToMany", nestedUpdateOneToMany)
@@ -0,0 +1,340 @@
+package qcode
+
+import (
+	"sync/atomic"
+)
+
+const (
+	nodeBlockSize = 64
+	ptrBlockSize  = 128
+	argBlockSize  = 64
+	idBlockSize   = 128
+	dirBlockSize  = 32
+)
+
+// arena hands out the nodes, node lists, args, directives and child ids of an operation
+// from blocks it owns. Large queries that outgrow the fixed arrays in Field
+// still don't allocate per element and the blocks are kept when the
+// operation goes back to the pool. Nothing handed out can be used once
+// the operation is reset.
+type arena struct {
+	nodes [][]Node
+	ni    int
+
+	ptrs [][]*Node
+	pi   int
+
+	args [][]Arg
+	ai   int
+
+	ids [][]int32
+	ii  int
+
+	dirs [][]Directive
+	di   int
+
+	// scratch collects the children of a list or object
+	// till their count is known
+	scratch []*Node
+}
+
+func (a *arena) reset() {
+	for i := range a.nodes {
+		a.nodes[i] = a.nodes[i][:0]
+	}
+	for i := range a.ptrs {
+		a.ptrs[i] = a.ptrs[i][:0]
+	}
+	for i := range a.args {
+		a.args[i] = a.args[i][:0]
+	}
+	for i := range a.ids {
+		a.ids[i] = a.ids[i][:0]
+	}
+	for i := range a.dirs {
+		a.dirs[i] = a.dirs[i][:0]
+	}
+	a.ni, a.pi, a.ai, a.ii, a.di = 0, 0, 0, 0, 0
+	a.scratch = a.scratch[:0]
+}
+
+func (a *arena) node() *Node {
+	for a.ni < len(a.nodes) && len(a.nodes[a.ni]) == cap(a.nodes[a.ni]) {
+		a.ni++
+	}
+
+	if a.ni == len(a.nodes) {
+		a.nodes = append(a.nodes, make([]Node, 0, nodeBlockSize))
+		atomic.AddUint64(&stats.ArenaBlocks, 1)
+	}
+
+	b := a.nodes[a.ni]
+	b = b[:len(b)+1]
+	a.nodes[a.ni] = b
+	atomic.AddUint64(&stats.ArenaNodes, 1)
+
+	n := &b[len(b)-1]
+	n.Reset()
+	return n
+}
+
+func (a *arena) nodeList(n int) []*Node {
+	for a.pi < len(a.ptrs) && cap(a.ptrs[a.pi])-len(a.ptrs[a.pi]) < n {
+		a.pi++
+	}
+
+	if a.pi == len(a.ptrs) {
+		a.ptrs = append(a.ptrs, make([]*Node, 0, max(ptrBlockSize, n)))
+		atomic.AddUint64(&stats.ArenaBlocks, 1)
+	}
+
+	b := a.ptrs[a.pi]
+	s := len(b)
+	a.ptrs[a.pi] = b[:s+n]
+	return b[s : s+n : s+n]
+}
+
+func (a *arena) argList(n int) []Arg {
+	for a.ai < len(a.args) && cap(a.args[a.ai])-len(a.args[a.ai]) < n {
+		a.ai++
+	}
+
+	if a.ai == len(a.args) {
+		a.args = append(a.args, make([]Arg, 0, max(argBlockSize, n)))
+		atomic.AddUint64(&stats.ArenaBlocks, 1)
+	}
+
+	b := a.args[a.ai]
+	s := len(b)
+	a.args[a.ai] = b[:s+n]
+	return b[s : s+n : s+n]
+}
+
+func (a *arena) idList(n int) []int32 {
+	for a.ii < len(a.ids) && cap(a.ids[a.ii])-len(a.ids[a.ii]) < n {
+		a.ii++
+	}
+
+	if a.ii == len(a.ids) {
+		a.ids = append(a.ids, make([]int32, 0, max(idBlockSize, n)))
+		atomic.AddUint64(&stats.ArenaBlocks, 1)
+	}
+
+	b := a.ids[a.ii]
+	s := len(b)
+	a.ids[a.ii] = b[:s+n]
+	return b[s : s+n : s+n]
+}
+
+func (a *arena) dirList(n int) []Directive {
+	for a.di < len(a.dirs) && cap(a.dirs[a.di])-len(a.dirs[a.di]) < n {
+		a.di++
+	}
+
+	if a.di == len(a.dirs) {
+		a.dirs = append(a.dirs, make([]Directive, 0, max(dirBlockSize, n)))
+		atomic.AddUint64(&stats.ArenaBlocks, 1)
+	}
+
+	b := a.dirs[a.di]
+	s := len(b)
+	a.dirs[a.di] = b[:s+n]
+	return b[s : s+n : s+n]
+}
+
+// newNode returns a node from the arena or the pool
+// when the parser has no arena (eg. ParseArgValue)
+func (p *Parser) newNode() *Node {
+	if p.arena != nil {
+		return p.arena.node()
+	}
+
+	n := nodePool.Get().(*Node)
+	n.Reset()
+	return n
+}
+
+// mark returns where the children of a list or object start in the scratch
+func (p *Parser) mark() int {
+	if p.arena == nil {
+		return 0
+	}
+	return len(p.arena.scratch)
+}
+
+// addChild adds a child of a list or object to the scratch, the nodes
+// are only used when the parser has no arena
+func (p *Parser) addChild(nodes []*Node, n *Node) []*Node {
+	if p.arena == nil {
+		return append(nodes, n)
+	}
+	p.arena.scratch = append(p.arena.scratch, n)
+	return nil
+}
+
+// children returns the children of a list or object added since s
+func (p *Parser) children(s int, nodes []*Node) []*Node {
+	a := p.arena
+	if a == nil {
+		return nodes
+	}
+
+	c := a.nodeList(len(a.scratch) - s)
+	copy(c, a.scratch[s:])
+	a.scratch = a.scratch[:s]
+	return c
+}
+
+func (p *Parser) argList(n int) []Arg {
+	if p.arena == nil {
+		return make([]Arg, n)
+	}
+	return p.arena.argList(n)
+}
+
+func (p *Parser) idList(n int) []int32 {
+	if p.arena == nil {
+		return make([]int32, n)
+	}
+	return p.arena.idList(n)
+}
+
+// growArgs moves full args to the arena with room for as many more
+func (p *Parser) growArgs(args []Arg) []Arg {
+	if p.arena == nil || len(args) < cap(args) {
+		return args
+	}
+
+	a := p.arena.argList(max(2*len(args), 4))
+	n := copy(a, args)
+	return a[:n]
+}
+
+// growIDs moves full child ids to the arena with room for as many more
+func (p *Parser) growIDs(ids []int32) []int32 {
+	if p.arena == nil || len(ids) < cap(ids) {
+		return ids
+	}
+
+	a := p.arena.idList(max(2*len(ids), 4))
+	n := copy(a, ids)
+	return a[:n]
+}
+
+// growDirs moves full directives to the arena with room for as many more
+func (p *Parser) growDirs(dirs []Directive) []Directive {
+	if p.arena == nil || len(dirs) < cap(dirs) {
+		return dirs
+	}
+
+	a := p.arena.dirList(max(2*len(dirs), 2))
+	n := copy(a, dirs)
+	return a[:n]
+}
+
+// growFields returns the fields with room for n more. The fields are moved
+// to a larger slice and the args and children still in the inline arrays
+// of a field are pointed at the arrays of the moved field, so the old slice
+// isn't kept by them
+func (p *Parser) growFields(fields []Field, n int) []Field {
+	if len(fields)+n <= cap(fields) {
+		return fields
+	}
+	atomic.AddUint64(&stats.FieldsGrown, 1)
+
+	nf := make([]Field, len(fields), max(2*cap(fields), len(fields)+n))
+	copy(nf, fields)
+
+	for i := range fields {
+		of, f := &fields[i], &nf[i]
+
+		if cap(of.Args) != 0 && &of.Args[:1][0] == &of.argsA[0] {
+			f.Args = f.argsA[:len(of.Args)]
+		}
+		if cap(of.Children) != 0 && &of.Children[:1][0] == &of.childrenA[0] {
+			f.Children = f.childrenA[:len(of.Children)]
+		}
+	}
+
+	return nf
+}
+
+// PoolStats are counters of the parser pools and arenas, a high share of
+// new items means the pools are too small for the load and a lot of arena
+// blocks means the block sizes are too small for the queries
+type PoolStats struct {
+	Ops         uint64 // operations taken from the pool
+	OpsNew      uint64 // operations the pool had to allocate
+	Frags       uint64
+	FragsNew    uint64
+	Lexers      uint64
+	LexersNew   uint64
+	ArenaNodes  uint64 // nodes handed out by arenas
+	ArenaBlocks uint64 // blocks allocated by arenas
+	FieldsGrown uint64 // times the fields outgrew their slice
+}
+
+var stats PoolStats
+
+// Stats returns the parser pool statistics
+func Stats() PoolStats {
+	return PoolStats{
+		Ops:         atomic.LoadUint64(&stats.Ops),
+		OpsNew:      atomic.LoadUint64(&stats.OpsNew),
+		Frags:       atomic.LoadUint64(&stats.Frags),
+		FragsNew:    atomic.LoadUint64(&stats.FragsNew),
+		Lexers:      atomic.LoadUint64(&stats.Lexers),
+		LexersNew:   atomic.LoadUint64(&stats.LexersNew),
+		ArenaNodes:  atomic.LoadUint64(&stats.ArenaNodes),
+		ArenaBlocks: atomic.LoadUint64(&stats.ArenaBlocks),
+		FieldsGrown: atomic.LoadUint64(&stats.FieldsGrown),
+	}
+}
+
+func getOp() *Operation {
+	atomic.AddUint64(&stats.Ops, 1)
+	op := opPool.Get().(*Operation)
+	op.Reset()
+	return op
+}
+
+// FreeOperation returns an operation from Parse to the pool, nothing in it can
+// be used after. Operations parsed with a Parser into caller owned storage
+// and ones already returned are ignored
+func FreeOperation(op *Operation) {
+	if op == nil || op.owned || op.pooled {
+		return
+	}
+	op.pooled = true
+	opPool.Put(op)
+}
+
+func getFrag() *Fragment {
+	atomic.AddUint64(&stats.Frags, 1)
+	f := fragPool.Get().(*Fragment)
+	f.Reset()
+	return f
+}
+
+// putFrag returns a fragment to the pool unless it's already in it
+func putFrag(f *Fragment) {
+	if f == nil || f.pooled {
+		return
+	}
+	f.pooled = true
+	fragPool.Put(f)
+}
+
+func getLexer() *lexer {
+	atomic.AddUint64(&stats.Lexers, 1)
+	l := lexPool.Get().(*lexer)
+	l.Reset()
+	return l
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -1,12 +1,169 @@
 package qcode
 
 import (
+	"errors"
+	"fmt"
 	"sort"
 	"strings"
+
+	"github.com/gobuffalo/flect"
+)
+
+const (
+	defaultMaxSelectors = 30
+	defaultMaxFields    = 1200
+	defaultMaxArgs      = 25
+	defaultMaxBytes     = 1 << 20
+	defaultMaxNameLen   = 256
 )
 
-type Config struct {
-	DefaultBlock bool
+// Option configures a Compiler created with NewCompiler
+type Option func(*Compiler) error
+
+// DirectiveFunc is called for every table selection that has the
+// directive it was registered for with WithDirective, role is the
+// role the query is compiled for
+type DirectiveFunc func(sel *Select, args []Arg, role string) error
+
+// WithDefaultBlock blocks the anon role from tables that have
+// no role config
+func WithDefaultBlock(block bool) Option {
+	return func(com *Compiler) error {
+		com.defBlock = block
+		return nil
+	}
+}
+
+// WithLimits sets the max number of table selections in a query and the
+// max number of fields and arguments the parser accepts. A value of zero
+// keeps the default.
+func WithLimits(selectors, fields, args int) Option {
+	return func(com *Compiler) error {
+		if selectors < 0 || fields < 0 || args < 0 {
+			return errors.New("qcode: limits cannot be negative")
+		}
+		if selectors != 0 {
+			com.maxSelectors = selectors
+		}
+		if fields != 0 {
+			com.limits.fields = fields
+		}
+		if args != 0 {
+			com.limits.args = args
+		}
+		return nil
+	}
+}
+
+// WithSizeLimits sets the max size in bytes of a query and the max length
+// of the names in it, the lexer rejects queries over them before scanning.
+// A value of zero keeps the default.
+func WithSizeLimits(queryBytes, nameLen int) Option {
+	return func(com *Compiler) error {
+		if queryBytes < 0 || nameLen < 0 {
+			return errors.New("qcode: limits cannot be negative")
+		}
+		if queryBytes != 0 {
+			com.limits.bytes = queryBytes
+		}
+		if nameLen != 0 {
+			com.limits.name = nameLen
+		}
+		return nil
+	}
+}
+
+// WithMaxErrors sets the number of errors collected from a query
+// before giving up on it
+func WithMaxErrors(n int) Option {
+	return func(com *Compiler) error {
+		if n < 1 {
+			return errors.New("qcode: max errors must be at least 1")
+		}
+		com.maxErrors = n
+		return nil
+	}
+}
+
+// WithBlocklist blocks the tables for all roles
+func WithBlocklist(tables ...string) Option {
+	return func(com *Compiler) error {
+		for _, t := range tables {
+			t = strings.ToLower(t)
+			com.blocklist[flect.Singularize(t)] = struct{}{}
+			com.blocklist[flect.Pluralize(t)] = struct{}{}
+		}
+		return nil
+	}
+}
+
+type filter struct {
+	ex *Exp
+	nu bool // needs the user id
+}
+
+// WithFilter adds a named filter queries can use in the where argument by
+// name (eg. `where: { filter: active_users }` or `filter: [active, paid]`)
+// to keep complex filters in one place. Like the role filters it can use
+// any column of the table.
+func WithFilter(name, fil string) Option {
+	return func(com *Compiler) error {
+		ex, nu, err := compileFilter([]string{fil})
+		if err != nil {
+			return fmt.Errorf("qcode: filter %s: %w", name, err)
+		}
+		if ex == nil {
+			return fmt.Errorf("qcode: filter %s: invalid filter", name)
+		}
+
+		if com.filters == nil {
+			com.filters = make(map[string]filter)
+		}
+		com.filters[strings.ToLower(name)] = filter{ex: ex, nu: nu}
+		return nil
+	}
+}
+
+// WithDirective registers a handler for a custom directive on table
+// selections. The built-in @skip and @include cannot be replaced.
+func WithDirective(name string, fn DirectiveFunc) Option {
+	return func(com *Compiler) error {
+		name = strings.ToLower(name)
+
+		if name == "skip" || name == "include" {
+			return fmt.Errorf("qcode: directive @%s is built-in", name)
+		}
+		if fn == nil {
+			return fmt.Errorf("qcode: directive @%s has no handler", name)
+		}
+		com.directives[name] = fn
+		return nil
+	}
+}
+
+// WithUnionType sets the table of a type used in the inline fragments of a
+// polymorphic union (eg. `subject { ... on Product { name } }` for products)
+func WithUnionType(union, typ, table string) Option {
+	return func(com *Compiler) error {
+		union, typ = strings.ToLower(union), strings.ToLower(typ)
+
+		if _, ok := com.utypes[union]; !ok {
+			com.utypes[union] = make(map[string]string)
+		}
+		com.utypes[union][typ] = table
+		return nil
+	}
+}
+
+// WithTableFunction sets the table of a database function that returns rows
+// of it (eg. products for search_products), the function is a root field
+// selected like the table. The table is the singular name for functions that
+// return a single row
+func WithTableFunction(name, table string) Option {
+	return func(com *Compiler) error {
+		com.tfuncs[strings.ToLower(name)] = table
+		return nil
+	}
 }
 
 type QueryConfig struct {
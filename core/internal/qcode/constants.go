@@ -0,0 +1,164 @@
+package qcode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// WithConstants sets the server defined constants, a query uses them as
+// variables with the path to the value (eg. $env.max_rows for the value
+// max_rows in env). They're replaced with their values before the query
+// is parsed so they can be used anywhere a value can
+func WithConstants(consts map[string]interface{}) Option {
+	return func(com *Compiler) error {
+		for k, v := range consts {
+			if _, ok := v.(map[string]interface{}); !ok {
+				return fmt.Errorf("constant %s: expecting the values under a name (eg. %s.name)", k, k)
+			}
+			var b bytes.Buffer
+			if err := writeConstant(&b, v); err != nil {
+				return fmt.Errorf("constant %s: %w", k, err)
+			}
+		}
+		com.consts = consts
+		return nil
+	}
+}
+
+// replaceConstants replaces the constants in the query with their values,
+// the strings and comments in the query are skipped
+func (com *Compiler) replaceConstants(gql []byte) ([]byte, error) {
+	if len(com.consts) == 0 || bytes.IndexByte(gql, '$') == -1 {
+		return gql, nil
+	}
+
+	var b bytes.Buffer
+	last := 0
+
+	for i := 0; i < len(gql); i++ {
+		switch gql[i] {
+		case '"':
+			for i++; i < len(gql) && gql[i] != '"'; i++ {
+				if gql[i] == '\\' {
+					i++
+				}
+			}
+			continue
+
+		case '#':
+			for i < len(gql) && gql[i] != '\n' {
+				i++
+			}
+			continue
+
+		case '$':
+		default:
+			continue
+		}
+
+		start := i
+		end := skipName(gql, i+1)
+
+		v, ok := com.consts[string(gql[i+1:end])]
+		if !ok || end >= len(gql) || gql[end] != '.' {
+			i = end - 1
+			continue
+		}
+
+		// the path to the value (eg. env.max_rows)
+		for end < len(gql) && gql[end] == '.' {
+			m, ok := v.(map[string]interface{})
+			n := skipName(gql, end+1)
+
+			if !ok || n == end+1 {
+				return nil, fmt.Errorf("invalid constant: %s", gql[start+1:n])
+			}
+			if v, ok = m[string(gql[end+1:n])]; !ok {
+				return nil, fmt.Errorf("constant not found: %s", gql[start+1:n])
+			}
+			end = n
+		}
+
+		b.Write(gql[last:start])
+
+		if err := writeConstant(&b, v); err != nil {
+			return nil, fmt.Errorf("constant %s: %w", gql[start+1:end], err)
+		}
+		last = end
+		i = end - 1
+	}
+
+	if last == 0 {
+		return gql, nil
+	}
+
+	b.Write(gql[last:])
+	return b.Bytes(), nil
+}
+
+// writeConstant writes the value as a GraphQL value
+func writeConstant(b *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+
+	case string:
+		s, _ := json.Marshal(v)
+		b.Write(s)
+
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+
+	case int:
+		b.WriteString(strconv.Itoa(v))
+
+	case int64:
+		b.WriteString(strconv.FormatInt(v, 10))
+
+	case float64:
+		b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+
+	case []interface{}:
+		b.WriteByte('[')
+		for i, e := range v {
+			if i != 0 {
+				b.WriteByte(',')
+			}
+			if err := writeConstant(b, e); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			if skipName([]byte(k), 0) != len(k) || k == "" {
+				return fmt.Errorf("invalid name: %s", k)
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i != 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(k)
+			b.WriteByte(':')
+			if err := writeConstant(b, v[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+
+	default:
+		return fmt.Errorf("unsupported value: %v", v)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package qcode
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gobuffalo/flect"
+)
+
+// maxCostMultiplier keeps the row counts of deeply nested lists from
+// overflowing, queries this large are over any sane max cost anyway
+const maxCostMultiplier = 1 << 30
+
+// CostConfig sets the max depth and complexity of a query. The cost of a
+// table selection is its field cost (1 unless set in Fields) times the number
+// of rows of the lists it's nested in. The rows of a list are its limit, first
+// or last argument, the default limit when it's not a number (eg. a variable)
+// and one for a single row (eg. `product(id: 5)`). Fields without children
+// cost nothing unless set in Fields.
+type CostConfig struct {
+	MaxDepth int
+	MaxCost  int
+
+	// Fields are the costs of tables (eg. products) and
+	// of fields of a table (eg. products.search_rank)
+	Fields map[string]int
+}
+
+// Cost is the depth and complexity of a query
+type Cost struct {
+	Depth      int `json:"depth"`
+	Complexity int `json:"complexity"`
+}
+
+// WithCostLimits sets the max depth and complexity of a query, a max of
+// zero is no limit though the cost is still computed
+func WithCostLimits(cc CostConfig) Option {
+	return func(com *Compiler) error {
+		if cc.MaxDepth < 0 || cc.MaxCost < 0 {
+			return errors.New("qcode: cost limits cannot be negative")
+		}
+
+		fields := make(map[string]int, len(cc.Fields))
+
+		for k, v := range cc.Fields {
+			if v < 0 {
+				return errors.New("qcode: field costs cannot be negative")
+			}
+			fields[strings.ToLower(k)] = v
+		}
+
+		com.cost = cc
+		com.cost.Fields = fields
+		return nil
+	}
+}
+
+type costItem struct {
+	id     int32
+	depth  int
+	rows   int
+	parent string
+}
+
+// queryCost walks the fields of the operation to compute its depth and
+// complexity, the query is rejected when it's over the limits
+func (com *Compiler) queryCost(op *Operation) (Cost, error) {
+	var c Cost
+	st := make([]costItem, 0, len(op.Fields))
+
+	for i := range op.Fields {
+		if op.Fields[i].ParentID == -1 {
+			st = append(st, costItem{id: op.Fields[i].ID, depth: 1, rows: 1})
+		}
+	}
+
+	for len(st) != 0 {
+		it := st[len(st)-1]
+		st = st[:len(st)-1]
+
+		f := &op.Fields[it.id]
+
+		if it.depth > c.Depth {
+			c.Depth = it.depth
+		}
+
+		if len(f.Children) == 0 {
+			if v, ok := com.cost.Fields[it.parent+"."+f.Name]; ok && it.parent != "" {
+				c.Complexity = addCost(c.Complexity, v, it.rows)
+			}
+			continue
+		}
+
+		rows := it.rows
+		name := f.Name
+
+		// the parts of a relay connection are the rows of the table
+		if com.relay && it.parent != "" && isConnectionField(f.Name) {
+			name = it.parent
+		} else {
+			fc := 1
+			if v, ok := com.cost.Fields[f.Name]; ok {
+				fc = v
+			}
+			c.Complexity = addCost(c.Complexity, fc, rows)
+
+			if rows *= com.listRows(f); rows > maxCostMultiplier {
+				rows = maxCostMultiplier
+			}
+		}
+
+		for _, cid := range f.Children {
+			st = append(st, costItem{id: cid, depth: it.depth + 1, rows: rows, parent: name})
+		}
+	}
+
+	if com.cost.MaxDepth != 0 && c.Depth > com.cost.MaxDepth {
+		return c, complexErr(ErrMaxDepth, "query depth %d is over the max depth %d", c.Depth, com.cost.MaxDepth)
+	}
+
+	if com.cost.MaxCost != 0 && c.Complexity > com.cost.MaxCost {
+		return c, complexErr(ErrMaxCost, "query cost %d is over the max cost %d", c.Complexity, com.cost.MaxCost)
+	}
+
+	return c, nil
+}
+
+func addCost(total, cost, rows int) int {
+	if v := total + cost*rows; v >= total {
+		return v
+	}
+	return total
+}
+
+func isConnectionField(name string) bool {
+	switch name {
+	case "edges", "node", "pageinfo":
+		return true
+	}
+	return false
+}
+
+// listRows returns the number of rows a selection can return, a
+// limit set from a variable can be up to the max limit
+func (com *Compiler) listRows(f *Field) int {
+	for _, a := range f.Args {
+		switch a.Name {
+		case "id":
+			return 1
+
+		case "limit", "first", "last":
+			if a.Val.Type == NodeVar {
+				return com.maxLimit
+			}
+			if a.Val.Type != NodeNum {
+				return defaultLimit
+			}
+			if n, err := strconv.Atoi(a.Val.Val); err == nil && n >= 0 {
+				return n
+			}
+		}
+	}
+
+	if flect.Singularize(f.Name) == f.Name && flect.Pluralize(f.Name) != f.Name {
+		return 1
+	}
+	return defaultLimit
+}
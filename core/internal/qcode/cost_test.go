@@ -0,0 +1,62 @@
+package qcode
+
+import (
+	"testing"
+)
+
+func TestQueryCost(t *testing.T) {
+	com, err := NewCompiler(WithCostLimits(CostConfig{
+		Fields: map[string]int{"customers": 5, "products.search_rank": 2},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		gql   string
+		depth int
+		cost  int
+	}{
+		{`query { products { id name } }`, 2, 1},
+		{`query { products(limit: 10) { id users { id } } }`, 3, 11},
+		{`query { products { id users(limit: 2) { id } } }`, 3, 21},
+		{`query { product(id: $id) { id customers { id } } }`, 3, 6},
+		{`query { products(limit: 3) { id search_rank } }`, 2, 7},
+		{`query { products(limit: 5) { users(limit: 5) { products(limit: 5) { id } } } }`, 4, 31},
+	}
+
+	for _, v := range tests {
+		qc, err := com.Compile([]byte(v.gql), "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if qc.Cost.Depth != v.depth || qc.Cost.Complexity != v.cost {
+			t.Errorf("%s: expected depth %d and cost %d got %+v", v.gql, v.depth, v.cost, qc.Cost)
+		}
+	}
+}
+
+func TestQueryCostLimits(t *testing.T) {
+	com, err := NewCompiler(WithCostLimits(CostConfig{MaxDepth: 3, MaxCost: 50}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := com.Compile([]byte(`query { products { id users { id } } }`), "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	over := []string{
+		`query { products(limit: 5) { users(limit: 5) { products { id } } } }`,
+		`query { products(limit: 100) { id users { id } } }`,
+	}
+
+	for _, v := range over {
+		_, err := com.Compile([]byte(v), "user")
+
+		if le, ok := err.(*LimitError); !ok || le.Code != ErrCodeQueryTooComplex {
+			t.Errorf("%s: expected a query too complex error got %v", v, err)
+		}
+	}
+}
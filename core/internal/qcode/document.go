@@ -0,0 +1,168 @@
+package qcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Document is a GraphQL document with one or more operations
+type Document struct {
+	Operations []*Operation
+
+	// src is a copy of the document since the lexer
+	// lowercases the names in the one it's given
+	src   string
+	frags []span
+	arena arena
+}
+
+type span struct {
+	start, end int
+}
+
+// ParseDocument parses all the operations in the document. Unlike Parse the
+// operations are not pooled.
+func ParseDocument(gql []byte) (*Document, error) {
+	return parseDocument(gql, defaultLimits)
+}
+
+func parseDocument(gql []byte, lim limits) (*Document, error) {
+	if len(gql) == 0 {
+		return nil, ErrBlankQuery
+	}
+
+	d := &Document{src: string(gql)}
+
+	l := getLexer()
+	defer lexPool.Put(l)
+
+	l.maxBytes, l.maxName = lim.bytes, lim.name
+
+	if err := lex(l, gql); err != nil {
+		return nil, err
+	}
+
+	p := &Parser{
+		lim:   lim,
+		input: l.input,
+		pos:   -1,
+		items: l.items,
+		arena: &d.arena,
+	}
+
+	var starts []int
+	var named bool
+	depth := 0
+
+	for {
+		if p.peek(itemEOF) {
+			p.ignore()
+			break
+		}
+
+		if depth == 0 && p.peek(itemFragment) {
+			p.ignore()
+			s := p.pos
+
+			if err := p.findFragment(); err != nil {
+				return nil, err
+			}
+			d.frags = append(d.frags, p.span(s))
+			continue
+		}
+
+		// the opening brace of an operation only starts it when it's
+		// the query shorthand without the keyword
+		if depth == 0 {
+			switch {
+			case p.peek(itemQuery, itemMutation, itemSub):
+				starts = append(starts, p.pos)
+				named = true
+
+			case p.peek(itemObjOpen):
+				if !named {
+					starts = append(starts, p.pos)
+				}
+				named = false
+			}
+		}
+
+		// the operation arguments are counted so that an object used
+		// as a default value is not taken for the query shorthand
+		switch {
+		case p.peek(itemObjOpen, itemArgsOpen):
+			depth++
+		case p.peek(itemObjClose, itemArgsClose):
+			depth--
+		}
+		p.ignore()
+	}
+
+	if len(starts) == 0 {
+		return nil, errors.New("expecting a query, mutation or subscription")
+	}
+
+	if err := p.parseFragments(); err != nil {
+		return nil, err
+	}
+
+	for _, s := range starts {
+		op := new(Operation)
+		op.Fields = op.fieldsA[:0]
+
+		p.reset(s)
+		if err := p.parseOp(op); err != nil {
+			return nil, err
+		}
+
+		d.Operations = append(d.Operations, op)
+	}
+
+	for _, v := range p.frags {
+		putFrag(v)
+	}
+
+	return d, nil
+}
+
+// span returns the position in the input from the start item
+// to the end of the current one
+func (p *Parser) span(start int) span {
+	end := p.items[p.pos]
+	return span{int(p.items[start].pos), int(end.pos) + len(end.val)}
+}
+
+// SelectOperation returns the operation with the name. The name can
+// be left empty when the document has a single operation.
+func (d *Document) SelectOperation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) == 1 {
+			return d.Operations[0], nil
+		}
+		return nil, errors.New("operation name required, the document has more than one operation")
+	}
+
+	for _, op := range d.Operations {
+		if strings.EqualFold(op.Name, name) {
+			return op, nil
+		}
+	}
+
+	return nil, fmt.Errorf("operation '%s' not found", name)
+}
+
+// Query returns the text of the operation along with the fragments
+// in the document so it can be run on its own
+func (d *Document) Query(op *Operation) string {
+	var sb strings.Builder
+
+	sb.WriteString(d.src[op.src.start:op.src.end])
+
+	for _, f := range d.frags {
+		sb.WriteString("\n\n")
+		sb.WriteString(d.src[f.start:f.end])
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,123 @@
+package qcode
+
+import (
+	"bytes"
+	"errors"
+	"unicode/utf8"
+)
+
+// Location is the line and column of a token in the query, both start at 1
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// ErrBlankQuery is returned for an empty query
+var ErrBlankQuery = errors.New("blank query")
+
+// Error is an error in a query with the location of the token it was found
+// at and the path (the response names) to the field it's for if any
+type Error struct {
+	Err       error
+	Locations []Location
+	Path      []string
+
+	// pos is the byte offset of the token in the query
+	pos Pos
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// SyntaxError is an error in the syntax of a query, Lex is set for
+// the ones found by the lexer (eg. an unterminated string). Pos is the
+// byte offset in the query of the token it was found at
+type SyntaxError struct {
+	Err error
+	Pos int
+	Lex bool
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// syntaxErr returns the error as a syntax error, the errors
+// of the size limits are returned as is
+func syntaxErr(err error, lex bool) error {
+	var le *LimitError
+	if errors.As(err, &le) {
+		return err
+	}
+	se := &SyntaxError{Err: err, Lex: lex}
+
+	var e *Error
+	if errors.As(err, &e) {
+		se.Pos = int(e.pos)
+	}
+	return se
+}
+
+// location returns the location of the byte offset in the query
+func location(query []byte, pos Pos) Location {
+	q := query
+	if int(pos) < len(q) {
+		q = q[:pos]
+	}
+	n := bytes.LastIndexByte(q, '\n')
+
+	return Location{
+		Line:   bytes.Count(q, []byte{'\n'}) + 1,
+		Column: utf8.RuneCount(q[n+1:]) + 1,
+	}
+}
+
+// errAt adds the location of the token at the offset to the error,
+// errors that already have a location are returned as is
+func errAt(query []byte, pos Pos, err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Err: err, Locations: []Location{location(query, pos)}, pos: pos}
+}
+
+// fieldErr adds the location and path of the field to the error
+func fieldErr(op *Operation, f *Field, err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	var path []string
+
+	for id := f.ID; id != -1; id = op.Fields[id].ParentID {
+		pf := &op.Fields[id]
+
+		if pf.Alias != "" {
+			path = append(path, pf.Alias)
+		} else {
+			path = append(path, pf.Name)
+		}
+	}
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	e = &Error{Err: err, Path: path, pos: f.pos}
+
+	if op.query != nil {
+		e.Locations = []Location{location(op.query, f.pos)}
+	}
+	return e
+}
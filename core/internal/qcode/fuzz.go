@@ -10,7 +10,7 @@ func Fuzz(data []byte) int {
 		panic("qt > QTUpsert")
 	}
 
-	qcompile, _ := NewCompiler(Config{})
+	qcompile, _ := NewCompiler()
 	_, err := qcompile.Compile(data, "user")
 	if err != nil {
 		return 0
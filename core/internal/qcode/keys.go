@@ -0,0 +1,101 @@
+package qcode
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// checkResponseKeys returns an error when two fields of the same parent have
+// the same response key (their alias or name) and one would overwrite the
+// other in the response. A column selected more than once is fine when it's
+// the same column with the same arguments, tables can only be selected once.
+func checkResponseKeys(op *Operation) error {
+	keys := make(map[string]int32, len(op.Fields))
+
+	for i := range op.Fields {
+		f := &op.Fields[i]
+
+		k := f.Alias
+		if k == "" {
+			k = f.Name
+		}
+
+		// the roots in a namespace are nested in it
+		mk := strconv.Itoa(int(f.ParentID)) + "." + f.ns + "." + k
+
+		id, ok := keys[mk]
+		if !ok {
+			keys[mk] = f.ID
+			continue
+		}
+		pf := &op.Fields[id]
+
+		var err error
+
+		switch {
+		case pf.Name != f.Name:
+			err = fmt.Errorf("fields '%s' and '%s' have the same response key '%s', use an alias for one",
+				pf.Name, f.Name, k)
+
+		case !sameArgs(pf.Args, f.Args):
+			err = fmt.Errorf("field '%s' is selected more than once with different arguments, use an alias for one", k)
+
+		case len(pf.Children) != 0 || len(f.Children) != 0:
+			err = fmt.Errorf("field '%s' is selected more than once, use an alias for one or select it once", k)
+
+		default:
+			continue
+		}
+
+		// the locations of both fields are returned
+		err = fieldErr(op, f, err)
+
+		if e, ok := err.(*Error); ok && op.query != nil {
+			e.Locations = append([]Location{location(op.query, pf.pos)}, e.Locations...)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// sameArgs returns true if both have the same arguments with the same values
+func sameArgs(a, b []Arg) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		found := false
+		for j := range b {
+			if a[i].Name == b[j].Name {
+				found = sameNode(a[i].Val, b[j].Val)
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameNode(a, b *Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if a.Type != b.Type || a.Name != b.Name || a.Val != b.Val ||
+		len(a.Children) != len(b.Children) {
+		return false
+	}
+
+	for i := range a.Children {
+		if !sameNode(a.Children[i], b.Children[i]) {
+			return false
+		}
+	}
+
+	return true
+}
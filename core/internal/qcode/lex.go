@@ -16,13 +16,7 @@ var (
 	onToken           = []byte("on")
 	trueToken         = []byte("true")
 	falseToken        = []byte("false")
-	quotesToken       = []byte(`'"`)
-	signsToken        = []byte(`+-`)
 	spreadToken       = []byte(`...`)
-	digitToken        = []byte(`0123456789`)
-	dotToken          = []byte(`.`)
-
-	punctuatorToken = `!():=[]{|}`
 )
 
 // Pos represents a byte position in the original input text from which
@@ -66,71 +60,105 @@ const (
 	itemBoolVal
 )
 
-// !$():=@[]{|}
-var punctuators = map[rune]itemType{
-	'{': itemObjOpen,
-	'}': itemObjClose,
-	'[': itemListOpen,
-	']': itemListClose,
-	'(': itemArgsOpen,
-	')': itemArgsClose,
-	':': itemColon,
-	'=': itemEquals,
-}
+// byte classes, the lexer looks up the class of the first byte
+// of a token to decide how to scan it
+const (
+	classOther byte = iota
+	classSpace
+	classNewline
+	classComment
+	classDirective
+	classVariable
+	classPunct
+	classQuote
+	classDot
+	classNumber
+	className
+)
 
-const eof = -1
+var (
+	charClass [256]byte
+	nameChar  [256]bool
+	digitChar [256]bool
+
+	// !$():=@[]{|}
+	punctItem [256]itemType
+)
 
-// stateFn represents the state of the scanner as a function that returns the next state.
-type stateFn func(*lexer) stateFn
+func init() {
+	for _, c := range []byte(" \t\r,") {
+		charClass[c] = classSpace
+	}
+	charClass['\n'] = classNewline
+	charClass['#'] = classComment
+	charClass['@'] = classDirective
+	charClass['$'] = classVariable
+	charClass['"'] = classQuote
+	charClass['\''] = classQuote
+	charClass['.'] = classDot
+	charClass['+'] = classNumber
+	charClass['-'] = classNumber
+
+	for _, c := range []byte("!():=[]{|}") {
+		charClass[c] = classPunct
+		punctItem[c] = itemPunctuator
+	}
+	punctItem['{'] = itemObjOpen
+	punctItem['}'] = itemObjClose
+	punctItem['['] = itemListOpen
+	punctItem[']'] = itemListClose
+	punctItem['('] = itemArgsOpen
+	punctItem[')'] = itemArgsClose
+	punctItem[':'] = itemColon
+	punctItem['='] = itemEquals
+
+	for c := '0'; c <= '9'; c++ {
+		charClass[c] = classNumber
+		nameChar[c] = true
+		digitChar[c] = true
+	}
+
+	for c := 'a'; c <= 'z'; c++ {
+		charClass[c] = className
+		charClass[c-'a'+'A'] = className
+		nameChar[c] = true
+		nameChar[c-'a'+'A'] = true
+	}
+	charClass['_'] = className
+	nameChar['_'] = true
+
+	// multi-byte runes are checked with the unicode tables when scanned
+	for c := utf8.RuneSelf; c < 256; c++ {
+		charClass[c] = className
+	}
+}
 
 // lexer holds the state of the scanner.
 type lexer struct {
 	input  []byte // the string being scanned
 	pos    Pos    // current position in the input
 	start  Pos    // start position of this item
-	width  Pos    // width of last rune read from input
 	items  []item // array of scanned items
 	itemsA [50]item
 	line   int16 // 1+number of newlines seen
 	err    error
+
+	// maxBytes and maxName are the max size of the input
+	// and length of a name, zero is no limit
+	maxBytes int
+	maxName  int
 }
 
 var zeroLex = lexer{}
 
+// Reset clears the lexer, the items grown past itemsA
+// are kept for the next input
 func (l *lexer) Reset() {
+	items := l.items[:0]
 	*l = zeroLex
-}
 
-// next returns the next byte in the input.
-func (l *lexer) next() rune {
-	if int(l.pos) >= len(l.input) {
-		l.width = 0
-		return eof
-	}
-	r, w := utf8.DecodeRune(l.input[l.pos:])
-	l.width = Pos(w)
-	l.pos += l.width
-	if r == '\n' {
-		l.line++
-	}
-	return r
-}
-
-// peek returns but does not consume the next rune in the input.
-func (l *lexer) peek() rune {
-	r := l.next()
-	l.backup()
-	return r
-}
-
-// backup steps back one rune. Can only be called once per call of next.
-func (l *lexer) backup() {
-	if l.pos != 0 {
-		l.pos -= l.width
-		// Correct newline count.
-		if l.width == 1 && l.input[l.pos] == '\n' {
-			l.line--
-		}
+	if cap(items) > len(l.itemsA) {
+		l.items = items
 	}
 }
 
@@ -143,11 +171,7 @@ func (l *lexer) emit(t itemType) {
 	l.items = append(l.items, item{t, l.start, l.current(), l.line})
 	// Some items contain text internally. If so, count their newlines.
 	if t == itemStringVal {
-		for i := l.start; i < l.pos; i++ {
-			if l.input[i] == '\n' {
-				l.line++
-			}
-		}
+		l.line += int16(bytes.Count(l.current(), []byte{'\n'}))
 	}
 	l.start = l.pos
 }
@@ -157,233 +181,326 @@ func (l *lexer) emitL(t itemType) {
 	l.emit(t)
 }
 
-// ignore skips over the pending input before this point.
-func (l *lexer) ignore() {
-	l.start = l.pos
+// errorf sets the error and adds an error token which ends the scan
+func (l *lexer) errorf(format string, args ...interface{}) {
+	l.fail(fmt.Errorf(format, args...))
 }
 
-// accept consumes the next rune if it's from the valid set.
-func (l *lexer) accept(valid []byte) bool {
-	r := l.next()
-	if r != eof && bytes.ContainsRune(valid, r) {
-		return true
-	}
-	l.backup()
-	return false
+// fail emits an error item for the current token
+func (l *lexer) fail(err error) {
+	l.err = err
+	l.items = append(l.items, item{itemError, l.start, l.input[l.start:l.pos], l.line})
 }
 
-// acceptAlphaNum consumes a run of runes while they are alpha nums
-func (l *lexer) acceptAlphaNum() bool {
-	n := 0
-	for r := l.next(); isAlphaNumeric(r); r = l.next() {
-		n++
-	}
-	l.backup()
-	return (n != 0)
+// Error codes of the queries rejected for their size or complexity
+// and those with operations the role is not allowed
+const (
+	ErrCodeQueryTooLarge   = "QUERY_TOO_LARGE"
+	ErrCodeNameTooLong     = "NAME_TOO_LONG"
+	ErrCodeQueryTooComplex = "QUERY_TOO_COMPLEX"
+	ErrCodeRoleForbidden   = "ROLE_FORBIDDEN"
+)
+
+// Errors of the limits a query can be over, the LimitError
+// returned wraps one so they can be checked with errors.Is
+var (
+	ErrQueryTooLarge = errors.New("query too large")
+	ErrNameTooLong   = errors.New("name too long")
+	ErrFieldLimit    = errors.New("too many fields")
+	ErrArgLimit      = errors.New("too many args")
+	ErrSelectorLimit = errors.New("too many selectors")
+	ErrMaxDepth      = errors.New("over the max depth")
+	ErrMaxCost       = errors.New("over the max cost")
+)
+
+// LimitError is returned for queries over the size and complexity
+// limits, Code tells the limits apart for clients
+type LimitError struct {
+	Code string
+	err  error
+	msg  string
 }
 
-// acceptComment consumes a run of runes while till the end of line
-func (l *lexer) acceptComment() {
-	n := 0
-	for r := l.next(); !isEndOfLine(r); r = l.next() {
-		n++
-	}
+func (e *LimitError) Error() string {
+	return e.msg
 }
 
-// acceptRun consumes a run of runes from the valid set.
-func (l *lexer) acceptRun(valid []byte) {
-	for bytes.ContainsRune(valid, l.next()) {
+// Unwrap returns the limit the query is over (eg. ErrFieldLimit)
+func (e *LimitError) Unwrap() error {
+	return e.err
+}
 
-	}
-	l.backup()
+func complexErr(err error, format string, a ...interface{}) error {
+	return &LimitError{Code: ErrCodeQueryTooComplex, err: err, msg: fmt.Sprintf(format, a...)}
 }
 
-// errorf returns an error token and terminates the scan by passing
-// back a nil pointer that will be the next state, terminating l.nextItem.
-func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.err = fmt.Errorf(format, args...)
-	l.items = append(l.items, item{itemError, l.start, l.input[l.start:l.pos], l.line})
-	return nil
+// AccessError is returned for tables and operations blocked for the role,
+// Name is that of the table or namespace
+type AccessError struct {
+	Role string
+	Name string
+	msg  string
+}
+
+func (e *AccessError) Error() string {
+	return e.msg
+}
+
+// accessErr returns the error for the blocked table or namespace,
+// what is the operation or kind of name that's blocked
+func accessErr(role, what, name string) error {
+	return &AccessError{Role: role, Name: name,
+		msg: fmt.Sprintf("%s, %s blocked: %s", role, what, name)}
 }
 
 // lex creates a new scanner for the input string.
 func lex(l *lexer, input []byte) error {
 	if len(input) == 0 {
-		return errors.New("empty query")
+		return ErrBlankQuery
+	}
+
+	if l.maxBytes != 0 && len(input) > l.maxBytes {
+		return &LimitError{Code: ErrCodeQueryTooLarge, err: ErrQueryTooLarge,
+			msg: fmt.Sprintf("query is too large: %d bytes (max %d)", len(input), l.maxBytes)}
 	}
 
 	l.input = input
-	l.items = l.itemsA[:0]
+	if l.items == nil {
+		l.items = l.itemsA[:0]
+	}
 	l.line = 1
 
 	l.run()
 
 	if last := l.items[len(l.items)-1]; last._type == itemError {
-		return l.err
+		return errAt(input, last.pos, l.err)
 	}
 	return nil
 }
 
-// run runs the state machine for the lexer.
+// run scans the input in a single loop, the class of the next byte picks
+// the token to scan so there's no call through a state function per token
 func (l *lexer) run() {
-	for state := lexRoot; state != nil; {
-		state = state(l)
-	}
-}
+	in := l.input
 
-// lexInsideAction scans the elements inside action delimiters.
-func lexRoot(l *lexer) stateFn {
-	r := l.next()
-
-	switch {
-	case r == eof:
-		l.emit(itemEOF)
-		return nil
-	case isEndOfLine(r):
-		l.ignore()
-	case isSpace(r):
-		l.ignore()
-	case r == '#':
-		l.ignore()
-		l.acceptComment()
-		l.ignore()
-	case r == '@':
-		l.ignore()
-		if l.acceptAlphaNum() {
-			l.emit(itemDirective)
-		}
-	case r == '$':
-		l.ignore()
-		if l.acceptAlphaNum() {
-			lowercase(l.current())
-			l.emit(itemVariable)
-		}
-	case contains(l.current(), punctuatorToken):
-		if item, ok := punctuators[r]; ok {
-			l.emit(item)
-		} else {
-			l.emit(itemPunctuator)
-		}
-	case r == '"' || r == '\'':
-		l.backup()
-		return lexString
-	case r == '.':
-		l.accept(dotToken)
-		if equals(l.current(), spreadToken) {
-			l.emit(itemSpread)
-			return lexRoot
-		}
-		//fallthrough // '.' can start a number.
-	case r == '+' || r == '-' || ('0' <= r && r <= '9'):
-		l.backup()
-		return lexNumber
-	case isAlphaNumeric(r):
-		l.backup()
-		return lexName
-	default:
-		return l.errorf("unrecognized character in action: %#U", r)
-	}
-	return lexRoot
-}
+	// dots that are not a spread are kept as the start of the next token
+	var dots bool
 
-// lexName scans a name.
-func lexName(l *lexer) stateFn {
 	for {
-		r := l.next()
+		if !dots {
+			l.start = l.pos
+		}
+		dots = false
 
-		if r == eof {
+		if int(l.pos) >= len(in) {
 			l.emit(itemEOF)
-			return nil
+			return
 		}
+		c := in[l.pos]
 
-		if !isAlphaNumeric(r) {
-			l.backup()
-			val := l.current()
-
-			switch {
-			case equals(val, queryToken):
-				l.emitL(itemQuery)
-			case equals(val, fragmentToken):
-				l.emitL(itemFragment)
-			case equals(val, mutationToken):
-				l.emitL(itemMutation)
-			case equals(val, subscriptionToken):
-				l.emitL(itemSub)
-			case equals(val, onToken):
-				l.emitL(itemOn)
-			case equals(val, trueToken):
-				l.emitL(itemBoolVal)
-			case equals(val, falseToken):
-				l.emitL(itemBoolVal)
-			default:
+		switch charClass[c] {
+		case classSpace:
+			l.pos++
+
+		case classNewline:
+			l.pos++
+			l.line++
+
+		case classComment:
+			// the end of line is left to be counted as a newline
+			for int(l.pos) < len(in) && in[l.pos] != '\n' && in[l.pos] != '\r' {
+				l.pos++
+			}
+
+		case classDirective, classVariable:
+			l.pos++
+			l.start = l.pos
+
+			if !l.scanName(l.pos) {
+				return
+			}
+			if l.pos == l.start {
+				continue
+			}
+
+			if c == '$' {
+				l.emitL(itemVariable)
+			} else {
+				l.emit(itemDirective)
+			}
+
+		case classPunct:
+			l.pos++
+			l.emit(punctItem[c])
+
+		case classQuote:
+			l.pos++
+			l.start = l.pos
+
+			i := bytes.IndexAny(in[l.pos:], `'"`)
+			if i == -1 {
+				l.pos = Pos(len(in))
+				l.line += int16(bytes.Count(l.current(), []byte{'\n'}))
+				l.emit(itemEOF)
+				return
+			}
+			l.pos += Pos(i)
+			l.emit(itemStringVal)
+			l.pos++
+
+		case classDot:
+			if bytes.HasPrefix(in[l.pos:], spreadToken) {
+				l.pos += 3
+				l.emit(itemSpread)
+				continue
+			}
+
+			// '.' can start a number
+			for i := 0; i < 2 && int(l.pos) < len(in) && in[l.pos] == '.'; i++ {
+				l.pos++
+			}
+			dots = true
+
+		case classNumber:
+			if c == '+' || c == '-' {
+				l.pos++
+			}
+			if !l.scanNumber() {
+				return
+			}
+
+		case className:
+			if !l.scanName(l.pos) {
+				return
+			}
+
+			// a name at the end of the input is not emitted
+			if int(l.pos) >= len(in) {
+				l.emit(itemEOF)
+				return
+			}
+
+			if t := keyword(l.current()); t != itemName {
+				l.emitL(t)
+			} else {
 				l.emit(itemName)
 			}
-			break
+
+		default:
+			r, w := utf8.DecodeRune(in[l.pos:])
+			l.pos += Pos(w)
+			l.errorf("unrecognized character in action: %#U", r)
+			return
 		}
 	}
-	return lexRoot
 }
 
-// lexString scans a string.
-func lexString(l *lexer) stateFn {
-	if l.accept([]byte(quotesToken)) {
-		l.ignore()
+// scanName consumes a run of alpha nums from begin, it returns false
+// if the name starts with a multi-byte rune that's not a letter or digit
+func (l *lexer) scanName(begin Pos) bool {
+	in := l.input
 
-		for {
-			r := l.next()
-			if r == eof {
-				l.emit(itemEOF)
-				return nil
-			}
-			if r == '\'' || r == '"' {
-				l.backup()
-				l.emit(itemStringVal)
-				if l.accept(quotesToken) {
-					l.ignore()
-				}
-				break
+	for int(l.pos) < len(in) {
+		c := in[l.pos]
+
+		if nameChar[c] {
+			l.pos++
+			continue
+		}
+
+		if c < utf8.RuneSelf {
+			break
+		}
+
+		r, w := utf8.DecodeRune(in[l.pos:])
+		if !isAlphaNumeric(r) {
+			if l.pos == begin {
+				l.pos += Pos(w)
+				l.errorf("unrecognized character in action: %#U", r)
+				return false
 			}
+			break
 		}
+		l.pos += Pos(w)
 	}
-	return lexRoot
-}
 
-// lexNumber scans a number: decimal and float. This isn't a perfect number scanner
-// for instance it accepts "." and "0x0.2" and "089" - but when it's wrong the input
-// is invalid and the parser (via strconv) should notice.
-func lexNumber(l *lexer) stateFn {
-	if !l.scanNumber() {
-		return l.errorf("bad number syntax: %q", l.input[l.start:l.pos])
+	if l.maxName != 0 && int(l.pos-begin) > l.maxName {
+		l.fail(&LimitError{Code: ErrCodeNameTooLong, err: ErrNameTooLong,
+			msg: fmt.Sprintf("name is too long: %d bytes (max %d)", l.pos-begin, l.maxName)})
+		return false
 	}
-	l.emit(itemNumberVal)
-	return lexRoot
+
+	return true
 }
 
+// scanNumber scans a number: decimal and float. This isn't a perfect number scanner
+// for instance it accepts "089" - but when it's wrong the input is invalid and the
+// parser (via strconv) should notice.
 func (l *lexer) scanNumber() bool {
-	// Optional leading sign.
-	l.accept(signsToken)
-	l.acceptRun(digitToken)
-	if l.accept(dotToken) {
-		l.acceptRun(digitToken)
+	in := l.input
+
+	l.skipDigits()
+	if int(l.pos) < len(in) && in[l.pos] == '.' {
+		l.pos++
+		l.skipDigits()
 	}
+
 	// Is it imaginary?
-	l.accept([]byte("i"))
+	if int(l.pos) < len(in) && in[l.pos] == 'i' {
+		l.pos++
+	}
+
 	// Next thing mustn't be alphanumeric.
-	if isAlphaNumeric(l.peek()) {
-		l.next()
-		return false
+	if int(l.pos) < len(in) {
+		r, w := utf8.DecodeRune(in[l.pos:])
+		if isAlphaNumeric(r) {
+			l.pos += Pos(w)
+			l.errorf("bad number syntax: %q", in[l.start:l.pos])
+			return false
+		}
 	}
+
+	l.emit(itemNumberVal)
 	return true
 }
 
-// isSpace reports whether r is a space character.
-func isSpace(r rune) bool {
-	return r == ',' || r == ' ' || r == '\t'
+func (l *lexer) skipDigits() {
+	for int(l.pos) < len(l.input) && digitChar[l.input[l.pos]] {
+		l.pos++
+	}
 }
 
-// isEndOfLine reports whether r is an end-of-line character.
-func isEndOfLine(r rune) bool {
-	return r == '\r' || r == '\n' || r == eof
+// keyword returns the item type of the keyword or itemName
+func keyword(val []byte) itemType {
+	switch len(val) {
+	case 2:
+		if equals(val, onToken) {
+			return itemOn
+		}
+	case 4:
+		if equals(val, trueToken) {
+			return itemBoolVal
+		}
+	case 5:
+		switch {
+		case equals(val, queryToken):
+			return itemQuery
+		case equals(val, falseToken):
+			return itemBoolVal
+		}
+	case 8:
+		switch {
+		case equals(val, mutationToken):
+			return itemMutation
+		case equals(val, fragmentToken):
+			return itemFragment
+		}
+	case 12:
+		if equals(val, subscriptionToken) {
+			return itemSub
+		}
+	}
+	return itemName
 }
 
 // isAlphaNumeric reports whether r is an alphabetic, digit, or underscore.
@@ -395,10 +512,6 @@ func equals(b []byte, val []byte) bool {
 	return bytes.EqualFold(b, val)
 }
 
-func contains(b []byte, chars string) bool {
-	return bytes.ContainsAny(b, chars)
-}
-
 func lowercase(b []byte) {
 	for i := 0; i < len(b); i++ {
 		if b[i] >= 'A' && b[i] <= 'Z' {
@@ -0,0 +1,135 @@
+package qcode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gobuffalo/flect"
+)
+
+type namespace struct {
+	roles map[string]struct{}
+}
+
+// WithNamespace adds a namespace (eg. billing) with the tables in it, they
+// are selected as the fields of a root field of its name (eg. `billing {
+// invoices { id } }`) and not as roots. When roles are set only they can
+// use the namespace
+func WithNamespace(name string, tables, roles []string) Option {
+	return func(com *Compiler) error {
+		name = strings.ToLower(name)
+
+		if com.ns == nil {
+			com.ns = make(map[string]*namespace)
+			com.nsTables = make(map[string]string)
+		}
+
+		if _, ok := com.ns[name]; ok {
+			return fmt.Errorf("qcode: duplicate namespace: %s", name)
+		}
+
+		ns := &namespace{}
+		com.ns[name] = ns
+
+		for _, r := range roles {
+			if ns.roles == nil {
+				ns.roles = make(map[string]struct{})
+			}
+			ns.roles[r] = struct{}{}
+		}
+
+		for _, t := range tables {
+			t = strings.ToLower(t)
+
+			for _, v := range []string{t, flect.Singularize(t), flect.Pluralize(t)} {
+				if n, ok := com.nsTables[v]; ok && n != name {
+					return fmt.Errorf("qcode: table %s is in the namespaces %s and %s", t, n, name)
+				}
+				com.nsTables[v] = name
+			}
+		}
+		return nil
+	}
+}
+
+// namespaces turns the fields of each namespace root field into roots
+// in that namespace, a table in a namespace can only be selected in it
+func (com *Compiler) namespaces(op *Operation, role string) error {
+	if len(com.ns) == 0 {
+		return nil
+	}
+
+	for i := range op.Fields {
+		f := &op.Fields[i]
+
+		// the roots of the namespaces are set before they are reached
+		if f.ParentID != -1 || f.ns != "" {
+			continue
+		}
+
+		ns, ok := com.ns[strings.ToLower(f.Name)]
+		if !ok {
+			if n, ok := com.nsTables[strings.ToLower(f.Name)]; ok {
+				return fieldErr(op, f, fmt.Errorf("table %s is in the namespace %s (eg. %s { %s { ... } })",
+					f.Name, n, n, f.Name))
+			}
+			continue
+		}
+
+		if ns.roles != nil {
+			if _, ok := ns.roles[role]; !ok {
+				return fieldErr(op, f, accessErr(role, "namespace", f.Name))
+			}
+		}
+
+		if len(f.Args) != 0 || len(f.Directives) != 0 {
+			return fieldErr(op, f, fmt.Errorf("namespace %s: arguments and directives are not supported", f.Name))
+		}
+
+		if len(f.Children) == 0 {
+			return fieldErr(op, f, fmt.Errorf("namespace %s: no tables selected", f.Name))
+		}
+
+		name := f.Name
+		if f.Alias != "" {
+			name = f.Alias
+		}
+
+		for _, cid := range f.Children {
+			t := &op.Fields[cid]
+
+			if n := com.nsTables[strings.ToLower(t.Name)]; n != strings.ToLower(f.Name) {
+				return fieldErr(op, t, fmt.Errorf("table %s is not in the namespace %s", t.Name, f.Name))
+			}
+			t.ParentID = -1
+			t.ns = name
+		}
+
+		// it's no longer a root
+		f.ParentID = -2
+	}
+
+	// the roots of the namespaces are returned as roots and moved under
+	// their namespace after, so their names can't be used by other roots
+	seen := make(map[string]*Field)
+
+	for i := range op.Fields {
+		f := &op.Fields[i]
+
+		if f.ParentID != -1 {
+			continue
+		}
+
+		k := f.Name
+		if f.Alias != "" {
+			k = f.Alias
+		}
+
+		if v, ok := seen[k]; ok && (v.ns != "" || f.ns != "") {
+			return fieldErr(op, f, fmt.Errorf("duplicate root field %s, use an alias", k))
+		}
+		seen[k] = f
+	}
+
+	return nil
+}
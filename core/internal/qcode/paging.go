@@ -0,0 +1,92 @@
+package qcode
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxLimit is the max a limit set from a variable is clamped to
+const defaultMaxLimit = 1000
+
+const (
+	pagingParamPrefix = "__paging."
+	orderParamPrefix  = "__order."
+)
+
+// WithMaxLimit sets the max a limit set from a variable (eg. limit: $n)
+// is clamped to. A value of zero keeps the default.
+func WithMaxLimit(n int) Option {
+	return func(com *Compiler) error {
+		if n < 0 {
+			return errors.New("qcode: max limit cannot be negative")
+		}
+		if n != 0 {
+			com.maxLimit = n
+		}
+		return nil
+	}
+}
+
+// PagingParam returns the name of the param the value of a limit or offset
+// variable is passed as, the value is clamped between zero and max (when
+// max is not zero)
+func PagingParam(max int, varName string) string {
+	return pagingParamPrefix + strconv.Itoa(max) + "." + varName
+}
+
+// ParsePagingParam returns the max and variable of a param named with PagingParam
+func ParsePagingParam(name string) (int, string, bool) {
+	if !strings.HasPrefix(name, pagingParamPrefix) {
+		return 0, "", false
+	}
+
+	v := strings.SplitN(name[len(pagingParamPrefix):], ".", 2)
+	if len(v) != 2 {
+		return 0, "", false
+	}
+
+	max, err := strconv.Atoi(v[0])
+	if err != nil {
+		return 0, "", false
+	}
+	return max, v[1], true
+}
+
+// ClampPaging returns the value of a limit or offset
+// clamped between zero and max (when max is not zero)
+func ClampPaging(n, max int) int {
+	switch {
+	case n < 0:
+		return 0
+	case max != 0 && n > max:
+		return max
+	}
+	return n
+}
+
+// OrderParam returns the name of the param the value of a variable
+// with the order of a column is passed as (eg. order_by: { price: $dir })
+func OrderParam(varName string) string {
+	return orderParamPrefix + varName
+}
+
+// ParseOrderParam returns the variable of a param named with OrderParam
+func ParseOrderParam(name string) (string, bool) {
+	if !strings.HasPrefix(name, orderParamPrefix) {
+		return "", false
+	}
+	return name[len(orderParamPrefix):], true
+}
+
+// ParseOrder returns the order of the value of an order variable,
+// only asc and desc can be set from a variable
+func ParseOrder(v string) (Order, error) {
+	switch v {
+	case "asc":
+		return OrderAsc, nil
+	case "desc":
+		return OrderDesc, nil
+	}
+	return 0, errors.New("value must be asc or desc")
+}
@@ -1,11 +1,16 @@
 package qcode
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"hash/maphash"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"unsafe"
+
+	"github.com/gobuffalo/flect"
 )
 
 var (
@@ -14,11 +19,6 @@ var (
 
 type parserType int32
 
-const (
-	maxFields = 1200
-	maxArgs   = 25
-)
-
 const (
 	parserError parserType = iota
 	parserEOF
@@ -38,14 +38,48 @@ type Operation struct {
 	Name    string
 	Args    []Arg
 	argsA   [10]Arg
+	VarDefs []VarDef
 	Fields  []Field
 	fieldsA [10]Field
+	src     span
+	arena   arena
+
+	// query is the source of the locations in errors
+	query []byte
+
+	// owned is set for operations parsed into caller owned storage, these
+	// are never pooled. pooled is set while the operation is in the pool
+	owned  bool
+	pooled bool
+}
+
+// VarDef is a variable definition in the operation header
+// (eg. `$limit: Int = 10`). Default is the default value as json.
+type VarDef struct {
+	Name    string
+	Type    string
+	List    bool
+	NonNull bool
+	Default json.RawMessage
 }
 
 var zeroOperation = Operation{}
 
+// Reset clears the operation, the arena and the fields grown
+// past fieldsA are kept for the next query
 func (o *Operation) Reset() {
+	a := o.arena
+	fields := o.Fields[:0]
+
 	*o = zeroOperation
+	a.reset()
+	o.arena = a
+
+	if cap(fields) > len(o.fieldsA) {
+		o.Fields = fields
+	} else {
+		o.Fields = o.fieldsA[:0]
+	}
 }
 
 type Fragment struct {
@@ -53,6 +87,7 @@ type Fragment struct {
 	On      string
 	Fields  []Field
 	fieldsA [10]Field
+	pooled  bool
 }
 
 var zeroFragment = Fragment{}
@@ -62,21 +97,31 @@ func (f *Fragment) Reset() {
 }
 
 type Field struct {
-	ID        int32
-	ParentID  int32
-	Name      string
-	Alias     string
-	Args      []Arg
-	argsA     [5]Arg
-	Children  []int32
-	childrenA [5]int32
-	Union     bool
+	ID         int32
+	ParentID   int32
+	Name       string
+	Alias      string
+	Args       []Arg
+	argsA      [5]Arg
+	Children   []int32
+	childrenA  [5]int32
+	Union      bool
+	Directives []Directive
+	node       string
+	ns         string
+
+	// pos is the offset of the field in the query
+	pos Pos
+}
+
+type Directive struct {
+	Name string
+	Args []Arg
 }
 
 type Arg struct {
 	Name string
 	Val  *Node
-	df   bool
 }
 
 type Node struct {
@@ -94,13 +139,45 @@ func (n *Node) Reset() {
 	*n = zeroNode
 }
 
+// limits are the max number of fields and arguments the parser accepts
+// and the max size of the query and length of names the lexer accepts
+type limits struct {
+	fields int
+	args   int
+	bytes  int
+	name   int
+}
+
+var defaultLimits = limits{
+	fields: defaultMaxFields,
+	args:   defaultMaxArgs,
+	bytes:  defaultMaxBytes,
+	name:   defaultMaxNameLen,
+}
+
 type Parser struct {
+	lim   limits
 	frags map[uint64]*Fragment
+
+	// fragPos are the positions of the fragment definitions, fragNames
+	// their names in the order they are defined and fragPath the names
+	// of the fragments being parsed (to find cycles)
+	fragPos   map[uint64]int
+	fragNames []string
+	fragPath  []string
+	fragOn    string
+
 	h     maphash.Hash
 	input []byte // the string being scanned
 	pos   int
 	items []item
 	err   error
+	arena *arena
+
+	// lex is the lexer of a parser from NewParser, it's
+	// kept with the items it grew between queries
+	lex *lexer
+	st  Stack
 }
 
 var nodePool = sync.Pool{
@@ -108,41 +185,90 @@ var nodePool = sync.Pool{
 }
 
 var opPool = sync.Pool{
-	New: func() interface{} { return new(Operation) },
+	New: func() interface{} {
+		atomic.AddUint64(&stats.OpsNew, 1)
+		return new(Operation)
+	},
 }
 
 var fragPool = sync.Pool{
-	New: func() interface{} { return new(Fragment) },
+	New: func() interface{} {
+		atomic.AddUint64(&stats.FragsNew, 1)
+		return new(Fragment)
+	},
 }
 
 var lexPool = sync.Pool{
-	New: func() interface{} { return new(lexer) },
+	New: func() interface{} {
+		atomic.AddUint64(&stats.LexersNew, 1)
+		return new(lexer)
+	},
 }
 
+// Parse parses the query with the default limits. The operation is from a
+// pool, it should be returned with FreeOperation once it's no longer used
 func Parse(gql []byte) (*Operation, error) {
-	var err error
+	return parse(gql, defaultLimits)
+}
 
-	if len(gql) == 0 {
-		return nil, errors.New("blank query")
+// NewParser returns a parser that keeps its lexer and the fragments between
+// queries, parsing into the same operation again doesn't allocate unless the
+// query has more fields or arguments than the last one. It's not safe for
+// concurrent use
+func NewParser() *Parser {
+	return &Parser{lim: defaultLimits, lex: new(lexer)}
+}
+
+// Parse parses the query into dst, it's reset first. dst is owned by the
+// caller and is never put in the pool, nothing in it can be used after the
+// next query is parsed into it
+func (p *Parser) Parse(dst *Operation, gql []byte) error {
+	if p.lex == nil {
+		p.lex = new(lexer)
 	}
+	p.lex.Reset()
 
-	l := lexPool.Get().(*lexer)
-	l.Reset()
+	dst.Reset()
+	dst.owned = true
+
+	return p.parse(dst, p.lex, gql)
+}
+
+func parse(gql []byte, lim limits) (*Operation, error) {
+	l := getLexer()
 	defer lexPool.Put(l)
 
-	if err = lex(l, gql); err != nil {
+	op := getOp()
+	p := Parser{lim: lim}
+
+	if err := p.parse(op, l, gql); err != nil {
+		FreeOperation(op)
 		return nil, err
 	}
 
-	p := &Parser{
-		input: l.input,
-		pos:   -1,
-		items: l.items,
+	return op, nil
+}
+
+func (p *Parser) parse(op *Operation, l *lexer, gql []byte) error {
+	if len(gql) == 0 {
+		return syntaxErr(ErrBlankQuery, false)
+	}
+
+	l.maxBytes, l.maxName = p.lim.bytes, p.lim.name
+
+	if err := lex(l, gql); err != nil {
+		return syntaxErr(err, true)
 	}
 
-	op := opPool.Get().(*Operation)
-	op.Reset()
-	op.Fields = op.fieldsA[:0]
+	op.query = gql
+
+	p.input = l.input
+	p.pos = -1
+	p.items = l.items
+	p.err = nil
+	p.arena = &op.arena
+
+	defer p.freeFrags()
 
 	s := -1
 	qf := false
@@ -155,9 +281,8 @@ func Parse(gql []byte) (*Operation, error) {
 
 		if p.peek(itemFragment) {
 			p.ignore()
-			if f, err := p.parseFragment(); err != nil {
-				fragPool.Put(f)
-				return nil, err
+			if err := p.findFragment(); err != nil {
+				return syntaxErr(p.errAt(err), false)
 			}
 
 		} else {
@@ -169,23 +294,145 @@ func Parse(gql []byte) (*Operation, error) {
 		}
 	}
 
+	if err := p.parseFragments(); err != nil {
+		return syntaxErr(p.errAt(err), false)
+	}
+
 	p.reset(s)
 	if err := p.parseOp(op); err != nil {
-		return nil, err
+		return syntaxErr(p.errAt(err), false)
 	}
 
-	for _, v := range p.frags {
-		fragPool.Put(v)
+	return nil
+}
+
+// freeFrags returns the fragments to the pool, the map
+// is kept for the next query of the parser
+func (p *Parser) freeFrags() {
+	for k, v := range p.frags {
+		putFrag(v)
+		delete(p.frags, k)
 	}
+	for k := range p.fragPos {
+		delete(p.fragPos, k)
+	}
+	p.fragNames = p.fragNames[:0]
+	p.fragPath = p.fragPath[:0]
+}
 
-	return op, nil
+// findFragment keeps the position of the fragment definition and moves
+// past it, the fragments are parsed once all of them are found since
+// they can spread the ones defined after them
+func (p *Parser) findFragment() error {
+	pos := p.pos
+
+	if !p.peek(itemName) {
+		return errors.New("fragment: missing name")
+	}
+	name := p.val(p.next())
+	k := p.fragKey(name)
+
+	if _, ok := p.fragPos[k]; ok {
+		return fmt.Errorf("fragment: '%s' is defined more than once", name)
+	}
+
+	if p.fragPos == nil {
+		p.fragPos = make(map[uint64]int)
+	}
+	p.fragPos[k] = pos
+	p.fragNames = append(p.fragNames, name)
+
+	depth := 0
+	for !p.peek(itemEOF) {
+		switch p.next()._type {
+		case itemObjOpen:
+			depth++
+		case itemObjClose:
+			if depth--; depth == 0 {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseFragments parses the fragments found, the
+// unused ones too so that their errors are returned
+func (p *Parser) parseFragments() error {
+	for _, name := range p.fragNames {
+		if _, err := p.fragment(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fragment returns the fragment with the name, it's parsed the first time
+func (p *Parser) fragment(name string) (*Fragment, error) {
+	k := p.fragKey(name)
+
+	if f, ok := p.frags[k]; ok {
+		return f, nil
+	}
+
+	pos, ok := p.fragPos[k]
+	if !ok {
+		return nil, fmt.Errorf("no fragment named '%s' defined", name)
+	}
+
+	for i, n := range p.fragPath {
+		if n == name {
+			path := append(p.fragPath[i:len(p.fragPath):len(p.fragPath)], name)
+			return nil, fragErr{fmt.Errorf("fragment: '%s' spreads itself (%s)",
+				name, strings.Join(path, " -> "))}
+		}
+	}
+
+	// the fragment is parsed with its own stack since it can be spread
+	// in the middle of another one, the position is kept on an error
+	// for its location
+	pos0, st, on := p.pos, p.st, p.fragOn
+	p.st = Stack{}
+	p.fragPath = append(p.fragPath, name)
+
+	p.reset(pos)
+	f, err := p.parseFragment()
+	if err != nil {
+		putFrag(f)
+		if !errors.As(err, new(fragErr)) {
+			err = fragErr{err}
+		}
+		return nil, err
+	}
+
+	p.fragPath = p.fragPath[:len(p.fragPath)-1]
+	p.pos, p.st, p.fragOn = pos0, st, on
+
+	return f, nil
+}
+
+// fragErr is an error in a fragment, it's returned as
+// is by the fragments it's spread in
+type fragErr struct {
+	error
+}
+
+func (e fragErr) Unwrap() error {
+	return e.error
+}
+
+func (p *Parser) fragKey(name string) uint64 {
+	_, _ = p.h.WriteString(name)
+	k := p.h.Sum64()
+	p.h.Reset()
+	return k
 }
 
 func (p *Parser) parseFragment() (*Fragment, error) {
 	var err error
 
-	frag := fragPool.Get().(*Fragment)
-	frag.Reset()
+	frag := getFrag()
 	frag.Fields = frag.fieldsA[:0]
 
 	if p.peek(itemName) {
@@ -202,6 +449,7 @@ func (p *Parser) parseFragment() (*Fragment, error) {
 
 	if p.peek(itemName) {
 		frag.On = p.vall(p.next())
+		p.fragOn = frag.On
 	} else {
 		return frag, errors.New("fragment: missing table name after 'on' keyword")
 	}
@@ -209,23 +457,21 @@ func (p *Parser) parseFragment() (*Fragment, error) {
 	if p.peek(itemObjOpen) {
 		p.ignore()
 	} else {
-		return frag, fmt.Errorf("fragment: expecting a '{', got: %s", p.next())
+		return frag, fmt.Errorf("fragment: expecting a '{', got: %s", p.peekItem())
 	}
 
 	frag.Fields, err = p.parseFields(frag.Fields)
 	if err != nil {
-		return frag, fmt.Errorf("fragment: %v", err)
+		if errors.As(err, new(fragErr)) {
+			return frag, err
+		}
+		return frag, fmt.Errorf("fragment: %w", err)
 	}
 
 	if p.frags == nil {
 		p.frags = make(map[uint64]*Fragment)
 	}
-
-	_, _ = p.h.WriteString(frag.Name)
-	k := p.h.Sum64()
-	p.h.Reset()
-
-	p.frags[k] = frag
+	p.frags[p.fragKey(frag.Name)] = frag
 
 	return frag, nil
 }
@@ -233,12 +479,13 @@ func (p *Parser) parseFragment() (*Fragment, error) {
 func (p *Parser) parseOp(op *Operation) error {
 	var err error
 	var typeSet bool
+	start := p.pos + 1
 
 	if p.peek(itemQuery, itemMutation, itemSub) {
 		err = p.parseOpTypeAndArgs(op)
 
 		if err != nil {
-			return fmt.Errorf("%s: %v", op.Type, err)
+			return fmt.Errorf("%s: %w", op.Type, err)
 		}
 		typeSet = true
 	}
@@ -255,13 +502,19 @@ func (p *Parser) parseOp(op *Operation) error {
 				break
 			}
 
+			// the next operation in the document
+			if p.peek(itemQuery, itemMutation, itemSub) {
+				break
+			}
+
 			op.Fields, err = p.parseFields(op.Fields)
 			if err != nil {
-				return fmt.Errorf("%s: %v", op.Type, err)
+				return fmt.Errorf("%s: %w", op.Type, err)
 			}
+			op.src = p.span(start)
 		}
 	} else {
-		return fmt.Errorf("expecting a query, mutation or subscription, got: %s", p.next())
+		return fmt.Errorf("expecting a query, mutation or subscription, got: %s", p.peekItem())
 	}
 
 	return nil
@@ -290,7 +543,7 @@ func (p *Parser) parseOpTypeAndArgs(op *Operation) error {
 	if p.peek(itemArgsOpen) {
 		p.ignore()
 
-		op.Args, err = p.parseOpParams(op.Args)
+		op.Args, op.VarDefs, err = p.parseOpParams(op.Args)
 		if err != nil {
 			return err
 		}
@@ -300,14 +553,14 @@ func (p *Parser) parseOpTypeAndArgs(op *Operation) error {
 }
 
 func ParseArgValue(argVal string) (*Node, error) {
-	l := lexPool.Get().(*lexer)
-	l.Reset()
+	l := getLexer()
 
 	if err := lex(l, []byte(argVal)); err != nil {
 		return nil, err
 	}
 
 	p := &Parser{
+		lim:   defaultLimits,
 		input: l.input,
 		pos:   -1,
 		items: l.items,
@@ -320,7 +573,9 @@ func ParseArgValue(argVal string) (*Node, error) {
 
 func (p *Parser) parseFields(fields []Field) ([]Field, error) {
 	var err error
-	st := NewStack()
+
+	st := &p.st
+	st.Reset()
 
 	if !p.peek(itemName, itemSpread) {
 		return nil, fmt.Errorf("unexpected token: %s", p.peekNext())
@@ -343,8 +598,8 @@ func (p *Parser) parseFields(fields []Field) ([]Field, error) {
 			}
 		}
 
-		if len(fields) >= maxFields {
-			return nil, fmt.Errorf("too many fields (max %d)", maxFields)
+		if len(fields) >= p.lim.fields {
+			return nil, complexErr(ErrFieldLimit, "too many fields (max %d)", p.lim.fields)
 		}
 
 		isFrag := false
@@ -370,10 +625,10 @@ func (p *Parser) parseFields(fields []Field) ([]Field, error) {
 
 func (p *Parser) parseNormalFields(st *Stack, fields []Field) ([]Field, error) {
 	if !p.peek(itemName) {
-		return nil, fmt.Errorf("expecting an alias or field name, got: %s", p.next())
+		return nil, fmt.Errorf("expecting an alias or field name, got: %s", p.peekItem())
 	}
 
-	fields = append(fields, Field{ID: int32(len(fields))})
+	fields = append(p.growFields(fields, 1), Field{ID: int32(len(fields)), pos: p.peekItem().pos})
 
 	f := &fields[(len(fields) - 1)]
 	f.Args = f.argsA[:0]
@@ -384,12 +639,13 @@ func (p *Parser) parseNormalFields(st *Stack, fields []Field) ([]Field, error) {
 		return nil, err
 	}
 
-	if st.Len() == 0 {
+	// -1 is pushed for an inline fragment at the top of a fragment
+	if st.Len() == 0 || st.Peek() == -1 {
 		f.ParentID = -1
 	} else {
 		pid := st.Peek()
 		f.ParentID = pid
-		fields[pid].Children = append(fields[pid].Children, f.ID)
+		fields[pid].Children = append(p.growIDs(fields[pid].Children), f.ID)
 	}
 
 	// The first opening curley brackets after this
@@ -404,10 +660,43 @@ func (p *Parser) parseNormalFields(st *Stack, fields []Field) ([]Field, error) {
 
 func (p *Parser) parseFragmentFields(st *Stack, fields []Field) ([]Field, error) {
 	var err error
-	pid := st.Peek()
+	var typ string
+
+	pid := int32(-1)
+	if st.Len() != 0 {
+		pid = st.Peek()
+	}
 
 	if p.peek(itemOn) {
 		p.ignore()
+
+		switch {
+		case pid != -1:
+			typ = fields[pid].Name
+		case len(p.fragPath) != 0:
+			typ = p.fragOn
+		default:
+			return nil, errors.New("inline fragment: expecting it in a field")
+		}
+
+		// an inline fragment on the type of the field itself (eg. ... on
+		// users in users or ... on userOutput as named in the schema) is
+		// not a union, its fields are the fields of the parent
+		if p.peek(itemName) && sameType(typ, p.peekNext()) {
+			p.ignore()
+
+			if !p.peek(itemObjOpen) {
+				return nil, fmt.Errorf("expecting a '{', got: %s", p.peekItem())
+			}
+			p.ignore()
+			st.Push(pid)
+
+			return fields, nil
+		}
+
+		if pid == -1 {
+			return nil, fmt.Errorf("inline fragment: expecting the type '%s'", typ)
+		}
 		fields[pid].Union = true
 
 		if fields, err = p.parseNormalFields(st, fields); err != nil {
@@ -425,22 +714,17 @@ func (p *Parser) parseFragmentFields(st *Stack, fields []Field) ([]Field, error)
 
 	} else {
 		if !p.peek(itemName) {
-			return nil, fmt.Errorf("expecting a fragment name, got: %s", p.next())
+			return nil, fmt.Errorf("expecting a fragment name, got: %s", p.peekItem())
 		}
 
-		name := p.val(p.next())
-		_, _ = p.h.WriteString(name)
-		id := p.h.Sum64()
-		p.h.Reset()
-
-		fr, ok := p.frags[id]
-		if !ok {
-			return nil, fmt.Errorf("no fragment named '%s' defined", name)
+		fr, err := p.fragment(p.val(p.next()))
+		if err != nil {
+			return nil, err
 		}
 		ff := fr.Fields
 
 		n := int32(len(fields))
-		fields = append(fields, ff...)
+		fields = append(p.growFields(fields, len(ff)), ff...)
 
 		for i := 0; i < len(ff); i++ {
 			k := (n + int32(i))
@@ -452,7 +736,7 @@ func (p *Parser) parseFragmentFields(st *Stack, fields []Field) ([]Field, error)
 			if f.ParentID == -1 {
 				f.ParentID = pid
 				if f.ParentID != -1 {
-					fields[pid].Children = append(fields[pid].Children, f.ID)
+					fields[pid].Children = append(p.growIDs(fields[pid].Children), f.ID)
 				}
 				// Update all the other parents id's by our new place in this new array
 			} else {
@@ -460,11 +744,11 @@ func (p *Parser) parseFragmentFields(st *Stack, fields []Field) ([]Field, error)
 			}
 
 			// Copy over children since fields append is not a deep copy
-			f.Children = make([]int32, len(f.Children))
+			f.Children = p.idList(len(f.Children))
 			copy(f.Children, ff[i].Children)
 
 			// Copy over args since args append is not a deep copy
-			f.Args = make([]Arg, len(f.Args))
+			f.Args = p.argList(len(f.Args))
 			copy(f.Args, ff[i].Args)
 
 			// Update all the children which is needed.
@@ -477,6 +761,13 @@ func (p *Parser) parseFragmentFields(st *Stack, fields []Field) ([]Field, error)
 	return fields, nil
 }
 
+// sameType returns true if the type of an inline fragment is the
+// table of the field, singular or plural or its output type
+func sameType(field, typ string) bool {
+	typ = strings.ToLower(strings.TrimSuffix(typ, "Output"))
+	return typ == field || flect.Singularize(typ) == flect.Singularize(field)
+}
+
 func (p *Parser) parseField(f *Field) error {
 	var err error
 	v := p.next()
@@ -501,31 +792,172 @@ func (p *Parser) parseField(f *Field) error {
 		}
 	}
 
+	for p.peek(itemDirective) {
+		d := Directive{Name: p.vall(p.next())}
+
+		if p.peek(itemArgsOpen) {
+			p.ignore()
+			if d.Args, err = p.parseArgs(d.Args); err != nil {
+				return fmt.Errorf("@%s: %w", d.Name, err)
+			}
+		}
+		f.Directives = append(p.growDirs(f.Directives), d)
+	}
+
 	return nil
 }
 
-func (p *Parser) parseOpParams(args []Arg) ([]Arg, error) {
+// parseOpParams parses the operation arguments (eg. `query (limit: 10) {`)
+// and the variable definitions (eg. `query ($id: Int = 5) {`)
+func (p *Parser) parseOpParams(args []Arg) ([]Arg, []VarDef, error) {
+	var vars []VarDef
+	var err error
+	depth := 0
+
 	for {
-		if len(args) >= maxArgs {
-			return nil, fmt.Errorf("too many args (max %d)", maxArgs)
+		if len(args) >= p.lim.args {
+			return nil, nil, complexErr(ErrArgLimit, "too many args (max %d)", p.lim.args)
 		}
 
-		if p.peek(itemEOF, itemArgsClose) {
+		if p.peek(itemEOF) || (depth == 0 && p.peek(itemArgsClose)) {
 			p.ignore()
 			break
 		}
-		p.next()
+
+		if depth == 0 && p.peek(itemVariable) && p.peekType(2) == itemColon {
+			vd, err := p.parseVarDef()
+			if err != nil {
+				return nil, nil, err
+			}
+			vars = append(vars, vd)
+			continue
+		}
+
+		if depth == 0 && p.peek(itemName) && p.peekType(2) == itemColon {
+			args = append(p.growArgs(args), Arg{Name: p.val(p.next())})
+			arg := &args[(len(args) - 1)]
+			p.ignore()
+
+			arg.Val, err = p.parseValue()
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		switch p.next()._type {
+		case itemObjOpen, itemListOpen, itemArgsOpen:
+			depth++
+		case itemObjClose, itemListClose, itemArgsClose:
+			depth--
+		}
 	}
 
-	return args, nil
+	return args, vars, nil
+}
+
+// parseVarDef parses a variable definition (eg. `$ids: [Int!]! = [1, 2]`)
+func (p *Parser) parseVarDef() (VarDef, error) {
+	vd := VarDef{Name: p.val(p.next())}
+	p.ignore()
+
+	if p.peek(itemListOpen) {
+		p.ignore()
+		vd.List = true
+	}
+
+	if !p.peek(itemName) {
+		return vd, fmt.Errorf("variable '%s': expecting a type", vd.Name)
+	}
+	vd.Type = p.val(p.next())
+
+	// the nullability of list items is not checked
+	if vd.List {
+		if p.peek(itemPunctuator) && p.peekNext() == "!" {
+			p.ignore()
+		}
+		if !p.peek(itemListClose) {
+			return vd, fmt.Errorf("variable '%s': missing ']' after type", vd.Name)
+		}
+		p.ignore()
+	}
+
+	if p.peek(itemPunctuator) && p.peekNext() == "!" {
+		p.ignore()
+		vd.NonNull = true
+	}
+
+	if p.peek(itemEquals) {
+		p.ignore()
+
+		n, err := p.parseValue()
+		if err != nil {
+			return vd, fmt.Errorf("variable '%s': %w", vd.Name, err)
+		}
+
+		if vd.Default, err = nodeJSON(n); err != nil {
+			return vd, fmt.Errorf("variable '%s': %w", vd.Name, err)
+		}
+	}
+
+	return vd, nil
+}
+
+// nodeJSON returns the value of the node as json
+func nodeJSON(n *Node) (json.RawMessage, error) {
+	var b []byte
+
+	switch n.Type {
+	case NodeStr:
+		return json.Marshal(n.Val)
+
+	case NodeNum, NodeBool:
+		return json.RawMessage(n.Val), nil
+
+	case NodeList:
+		b = append(b, '[')
+		for i, c := range n.Children {
+			if i != 0 {
+				b = append(b, ',')
+			}
+			v, err := nodeJSON(c)
+			if err != nil {
+				return nil, err
+			}
+			b = append(b, v...)
+		}
+		b = append(b, ']')
+
+	case NodeObj:
+		b = append(b, '{')
+		for i, c := range n.Children {
+			if i != 0 {
+				b = append(b, ',')
+			}
+			k, _ := json.Marshal(c.Name)
+			v, err := nodeJSON(c)
+			if err != nil {
+				return nil, err
+			}
+			b = append(b, k...)
+			b = append(b, ':')
+			b = append(b, v...)
+		}
+		b = append(b, '}')
+
+	case NodeVar:
+		return nil, errors.New("a default value cannot be a variable")
+	}
+
+	return b, nil
 }
 
 func (p *Parser) parseArgs(args []Arg) ([]Arg, error) {
 	var err error
 
 	for {
-		if len(args) >= maxArgs {
-			return nil, fmt.Errorf("too many args (max %d)", maxArgs)
+		if len(args) >= p.lim.args {
+			return nil, complexErr(ErrArgLimit, "too many args (max %d)", p.lim.args)
 		}
 
 		if p.peek(itemEOF, itemArgsClose) {
@@ -536,7 +968,7 @@ func (p *Parser) parseArgs(args []Arg) ([]Arg, error) {
 		if !p.peek(itemName) {
 			return nil, errors.New("expecting an argument name")
 		}
-		args = append(args, Arg{Name: p.val(p.next())})
+		args = append(p.growArgs(args), Arg{Name: p.val(p.next())})
 		arg := &args[(len(args) - 1)]
 
 		if !p.peek(itemColon) {
@@ -553,10 +985,11 @@ func (p *Parser) parseArgs(args []Arg) ([]Arg, error) {
 }
 
 func (p *Parser) parseList() (*Node, error) {
-	nodes := []*Node{}
+	var nodes []*Node
+	var n int
 
-	parent := nodePool.Get().(*Node)
-	parent.Reset()
+	parent := p.newNode()
+	s := p.mark()
 
 	var ty parserType
 	for {
@@ -574,23 +1007,24 @@ func (p *Parser) parseList() (*Node, error) {
 			return nil, errors.New("All values in a list must be of the same type")
 		}
 		node.Parent = parent
-		nodes = append(nodes, node)
+		nodes = p.addChild(nodes, node)
+		n++
 	}
-	if len(nodes) == 0 {
+	if n == 0 {
 		return nil, errors.New("List cannot be empty")
 	}
 
 	parent.Type = NodeList
-	parent.Children = nodes
+	parent.Children = p.children(s, nodes)
 
 	return parent, nil
 }
 
 func (p *Parser) parseObj() (*Node, error) {
-	nodes := []*Node{}
+	var nodes []*Node
 
-	parent := nodePool.Get().(*Node)
-	parent.Reset()
+	parent := p.newNode()
+	s := p.mark()
 
 	for {
 		if p.peek(itemEOF, itemObjClose) {
@@ -614,11 +1048,11 @@ func (p *Parser) parseObj() (*Node, error) {
 		}
 		node.Name = nodeName
 		node.Parent = parent
-		nodes = append(nodes, node)
+		nodes = p.addChild(nodes, node)
 	}
 
 	parent.Type = NodeObj
-	parent.Children = nodes
+	parent.Children = p.children(s, nodes)
 
 	return parent, nil
 }
@@ -635,8 +1069,7 @@ func (p *Parser) parseValue() (*Node, error) {
 	}
 
 	item := p.next()
-	node := nodePool.Get().(*Node)
-	node.Reset()
+	node := p.newNode()
 
 	switch item._type {
 	case itemNumberVal:
@@ -650,7 +1083,8 @@ func (p *Parser) parseValue() (*Node, error) {
 	case itemVariable:
 		node.Type = NodeVar
 	default:
-		return nil, fmt.Errorf("expecting a number, string, object, list or variable as an argument value (not %s)", p.val(p.next()))
+		p.reset(p.pos - 1)
+		return nil, fmt.Errorf("expecting a number, string, object, list or variable as an argument value (not %s)", p.val(item))
 	}
 	node.Val = p.val(item)
 
@@ -689,6 +1123,14 @@ func (p *Parser) peek(types ...itemType) bool {
 	return false
 }
 
+// peekType returns the type of the n'th next item
+func (p *Parser) peekType(n int) itemType {
+	if n := p.pos + n; n < len(p.items) {
+		return p.items[n]._type
+	}
+	return itemEOF
+}
+
 func (p *Parser) next() item {
 	n := p.pos + 1
 	if n >= len(p.items) {
@@ -699,6 +1141,20 @@ func (p *Parser) next() item {
 	return p.items[p.pos]
 }
 
+// peekItem returns the next item without moving past it
+func (p *Parser) peekItem() item {
+	if n := p.pos + 1; n < len(p.items) {
+		return p.items[n]
+	}
+	return item{_type: itemEOF, pos: Pos(len(p.input))}
+}
+
+// errAt adds the location of the next item to the error, the parser
+// stops at the item it fails on
+func (p *Parser) errAt(err error) error {
+	return errAt(p.input, p.peekItem().pos, err)
+}
+
 func (p *Parser) ignore() {
 	n := p.pos + 1
 	if n >= len(p.items) {
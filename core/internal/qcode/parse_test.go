@@ -2,13 +2,15 @@ package qcode
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/chirino/graphql/schema"
 )
 
 func TestCompile1(t *testing.T) {
-	qc, _ := NewCompiler(Config{})
+	qc, _ := NewCompiler()
 	err := qc.AddRole("user", "product", TRConfig{
 		Query: QueryConfig{
 			Columns: []string{"id", "Name"},
@@ -30,7 +32,7 @@ func TestCompile1(t *testing.T) {
 }
 
 func TestCompile2(t *testing.T) {
-	qc, _ := NewCompiler(Config{})
+	qc, _ := NewCompiler()
 	err := qc.AddRole("user", "product", TRConfig{
 		Query: QueryConfig{
 			Columns: []string{"ID"},
@@ -52,7 +54,7 @@ func TestCompile2(t *testing.T) {
 }
 
 func TestCompile3(t *testing.T) {
-	qc, _ := NewCompiler(Config{})
+	qc, _ := NewCompiler()
 	err := qc.AddRole("user", "product", TRConfig{
 		Query: QueryConfig{
 			Columns: []string{"ID"},
@@ -76,7 +78,7 @@ func TestCompile3(t *testing.T) {
 }
 
 func TestInvalidCompile1(t *testing.T) {
-	qcompile, _ := NewCompiler(Config{})
+	qcompile, _ := NewCompiler()
 	_, err := qcompile.Compile([]byte(`#`), "user")
 
 	if err == nil {
@@ -85,7 +87,7 @@ func TestInvalidCompile1(t *testing.T) {
 }
 
 func TestInvalidCompile2(t *testing.T) {
-	qcompile, _ := NewCompiler(Config{})
+	qcompile, _ := NewCompiler()
 	_, err := qcompile.Compile([]byte(`{u(where:{not:0})}`), "user")
 
 	if err == nil {
@@ -93,8 +95,45 @@ func TestInvalidCompile2(t *testing.T) {
 	}
 }
 
+func TestInvalidWhereOp(t *testing.T) {
+	qcompile, _ := NewCompiler()
+	_, err := qcompile.Compile([]byte(`{ users(where: { email: { eqq: "a" } }) { id } }`), "user")
+
+	if err == nil {
+		t.Fatal(errors.New("expecting an error"))
+	}
+
+	if !strings.Contains(err.Error(), "did you mean 'eq'?") {
+		t.Fatalf("expecting a suggestion, got: %s", err)
+	}
+}
+
+func TestParseOpTypes(t *testing.T) {
+	tests := []struct {
+		gql string
+		exp parserType
+	}{
+		{`{ products { id } }`, opQuery},
+		{`query getProducts { products { id } }`, opQuery},
+		{`mutation addProduct { product(insert: $data) { id } }`, opMutate},
+		{`subscription newProducts { products { id } }`, opSub},
+	}
+
+	for _, tt := range tests {
+		op, err := Parse([]byte(tt.gql))
+		if err != nil {
+			t.Fatalf("%s: %s", tt.gql, err)
+		}
+
+		if op.Type != tt.exp {
+			t.Errorf("%s: expected %s, got %s", tt.gql, tt.exp, op.Type)
+		}
+		FreeOperation(op)
+	}
+}
+
 func TestEmptyCompile(t *testing.T) {
-	qcompile, _ := NewCompiler(Config{})
+	qcompile, _ := NewCompiler()
 	_, err := qcompile.Compile([]byte(``), "user")
 
 	if err == nil {
@@ -122,7 +161,7 @@ updateThread {
 	}
 }
 }}`
-	qcompile, _ := NewCompiler(Config{})
+	qcompile, _ := NewCompiler()
 	_, err := qcompile.Compile([]byte(gql), "anon")
 
 	if err == nil {
@@ -152,7 +191,7 @@ func TestFragmentsCompile1(t *testing.T) {
 		last_name
 	}
 	`
-	qcompile, _ := NewCompiler(Config{})
+	qcompile, _ := NewCompiler()
 	_, err := qcompile.Compile([]byte(gql), "user")
 
 	if err != nil {
@@ -180,7 +219,7 @@ func TestFragmentsCompile2(t *testing.T) {
 		first_name
 		last_name
 	}`
-	qcompile, _ := NewCompiler(Config{})
+	qcompile, _ := NewCompiler()
 	_, err := qcompile.Compile([]byte(gql), "user")
 
 	if err != nil {
@@ -210,7 +249,7 @@ func TestFragmentsCompile3(t *testing.T) {
 	}
 
 	`
-	qcompile, _ := NewCompiler(Config{})
+	qcompile, _ := NewCompiler()
 	_, err := qcompile.Compile([]byte(gql), "user")
 
 	if err != nil {
@@ -218,6 +257,75 @@ func TestFragmentsCompile3(t *testing.T) {
 	}
 }
 
+func TestFragmentSpreads(t *testing.T) {
+	// fragments can spread the ones defined after them
+	// and inline fragments on the type of the field
+	gql := `
+	fragment userFields on user {
+		id
+		...userNames
+	}
+
+	query {
+		users {
+			... on userOutput {
+				email
+			}
+			...userFields
+		}
+	}
+
+	fragment userNames on user {
+		first_name
+		... on users { last_name }
+	}`
+
+	op, err := Parse([]byte(gql))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer FreeOperation(op)
+
+	var names []string
+	for _, f := range op.Fields {
+		names = append(names, f.Name)
+	}
+
+	if v := strings.Join(names, " "); v != "users email id first_name last_name" {
+		t.Fatalf("unexpected fields: %s", v)
+	}
+
+	for _, f := range op.Fields[1:] {
+		if f.ParentID != 0 {
+			t.Fatalf("expected the fields under users: %+v", f)
+		}
+	}
+
+	if op.Fields[0].Union {
+		t.Fatal("expected users not to be a union")
+	}
+
+	errs := []struct {
+		gql, err string
+	}{
+		{`query { users { ...a } } fragment a on user { id ...b } fragment b on user { ...a }`,
+			`'a' spreads itself (a -> b -> a)`},
+		{`query { users { ...a } } fragment a on user { ...a }`,
+			`'a' spreads itself (a -> a)`},
+		{`query { users { ...a } } fragment a on user { id } fragment a on user { email }`,
+			`'a' is defined more than once`},
+		{`query { users { ...a } } fragment a on user { ...b }`,
+			`no fragment named 'b' defined`},
+	}
+
+	for _, v := range errs {
+		_, err := Parse([]byte(v.gql))
+		if err == nil || !strings.Contains(err.Error(), v.err) {
+			t.Fatalf("expected error '%s' got: %v", v.err, err)
+		}
+	}
+}
+
 var gql = []byte(`
 	{products(
 		# returns only 30 items
@@ -262,8 +370,58 @@ fragment userFields2 on user {
 	__typename
 }`)
 
+// gqlLarge is a query with many aliased roots to
+// measure the lexer and parser on large queries
+var gqlLarge = func() []byte {
+	var sb strings.Builder
+
+	sb.WriteString("query getProducts {\n")
+	for i := 0; i < 25; i++ {
+		fmt.Fprintf(&sb, `	p%d: products(limit: 30, order_by: { price: desc }, distinct: [ price ],
+		where: { id: { AND: { greater_or_equals: 20, lt: 28 } }, name: { ilike: "%%apple%%" } }) {
+		id
+		name
+		price
+		user @include(if: $withUser) { id email }
+	}
+`, i)
+	}
+	sb.WriteString("}")
+
+	return []byte(sb.String())
+}()
+
+func BenchmarkLex(b *testing.B) {
+	l := &lexer{}
+
+	b.SetBytes(int64(len(gqlLarge)))
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		l.Reset()
+		if err := lex(l, gqlLarge); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseLarge(b *testing.B) {
+	b.SetBytes(int64(len(gqlLarge)))
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		op, err := Parse(gqlLarge)
+		if err != nil {
+			b.Fatal(err)
+		}
+		FreeOperation(op)
+	}
+}
+
 func BenchmarkQCompile(b *testing.B) {
-	qcompile, _ := NewCompiler(Config{})
+	qcompile, _ := NewCompiler()
 
 	b.ResetTimer()
 	b.ReportAllocs()
@@ -278,7 +436,7 @@ func BenchmarkQCompile(b *testing.B) {
 }
 
 func BenchmarkQCompileP(b *testing.B) {
-	qcompile, _ := NewCompiler(Config{})
+	qcompile, _ := NewCompiler()
 
 	b.ResetTimer()
 	b.ReportAllocs()
@@ -295,7 +453,7 @@ func BenchmarkQCompileP(b *testing.B) {
 }
 
 func BenchmarkQCompileFragment(b *testing.B) {
-	qcompile, _ := NewCompiler(Config{})
+	qcompile, _ := NewCompiler()
 
 	b.ResetTimer()
 	b.ReportAllocs()
@@ -375,3 +533,712 @@ func BenchmarkSchemaParseP(b *testing.B) {
 		}
 	})
 }
+
+func TestOperationArgs(t *testing.T) {
+	qc, _ := NewCompiler()
+
+	q, err := qc.Compile([]byte(`
+	query getProducts($tenant: Int!, $tags: [String] = ["a", "b"], limit: 5, where: { tenant_id: { eq: $tenant } }) {
+		products(limit: 10) {
+			id
+		}
+		users {
+			id
+		}
+	}`), "user")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(q.Roots) != 2 {
+		t.Fatalf("expected 2 roots, got %d", len(q.Roots))
+	}
+
+	var products, users Select
+
+	for _, id := range q.Roots {
+		if s := q.Selects[id]; s.Name == "products" {
+			products = s
+		} else {
+			users = s
+		}
+	}
+
+	if products.Paging.Limit != "10" || users.Paging.Limit != "5" {
+		t.Fatalf("unexpected limits: %s, %s", products.Paging.Limit, users.Paging.Limit)
+	}
+
+	for _, s := range []Select{products, users} {
+		if s.Where == nil || s.Where.Col != "tenant_id" || s.Where.Val != "tenant" {
+			t.Fatalf("expected the tenant filter on '%s'", s.Name)
+		}
+	}
+}
+
+func TestCompilerOptions(t *testing.T) {
+	var cached []string
+
+	qc1, err := NewCompiler(
+		WithLimits(2, 0, 0),
+		WithBlocklist("users"),
+		WithDirective("cached", func(sel *Select, args []Arg, role string) error {
+			cached = append(cached, sel.Name)
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qc2, err := NewCompiler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := []byte(`query {
+		products @cached {
+			id
+			customers { id }
+			user { id }
+		}
+	}`)
+
+	if _, err := qc1.Compile(gql, "user"); err == nil {
+		t.Fatal("expected the selector limit to be reached")
+	}
+
+	if _, err := qc2.Compile(gql, "user"); err == nil || !strings.Contains(err.Error(), "unknown directive") {
+		t.Fatalf("expected an unknown directive error, got: %v", err)
+	}
+
+	cached = nil
+
+	qc, err := qc1.Compile([]byte(`query { products @cached { id user { id } } }`), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cached) != 1 || cached[0] != "products" {
+		t.Fatalf("expected the directive handler to be called for products, got: %v", cached)
+	}
+
+	if qc.Selects[1].SkipRender != SkipTypeBlocked {
+		t.Fatal("expected the user table to be blocked")
+	}
+
+	if _, err := qc1.Compile([]byte(`query { products { id @cached } }`), "user"); err == nil {
+		t.Fatal("expected an error for a custom directive on a column")
+	}
+
+	if _, err := NewCompiler(WithDirective("skip", func(*Select, []Arg, string) error { return nil })); err == nil {
+		t.Fatal("expected an error when replacing a built-in directive")
+	}
+}
+
+func TestRewrites(t *testing.T) {
+	qc, _ := NewCompiler()
+
+	rules := []RewriteConfig{
+		{Name: "get_*", Table: "products", Limit: 5},
+		{Table: "users", Field: "email", Filter: "{ id: { eq: $user_id } }"},
+		{Table: "purchases", View: "recent_purchases"},
+	}
+
+	for _, rc := range rules {
+		if err := qc.AddRewrite(rc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q, err := qc.Compile([]byte(`query get_products {
+		products(limit: 50) { id }
+		users { id email }
+		purchases { id }
+	}`), "anon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sels := make(map[string]Select)
+	for _, s := range q.Selects {
+		sels[s.FieldName] = s
+	}
+
+	if l := sels["products"].Paging.Limit; l != "5" {
+		t.Fatalf("expected the limit to be capped at 5, got %s", l)
+	}
+
+	if s := sels["users"]; s.Where == nil || s.SkipRender != SkipTypeUserNeeded {
+		t.Fatal("expected the users filter that needs a user id")
+	}
+
+	if s := sels["purchases"]; s.Name != "purchases" || s.View != "recent_purchases" {
+		t.Fatalf("expected purchases to be redirected, got %s", s.View)
+	}
+
+	// subscriptions are rewritten like queries
+	q, err = qc.Compile([]byte(`subscription get_products {
+		products(limit: 50) { id }
+	}`), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := q.Selects[0].Paging.Limit; l != "5" {
+		t.Fatalf("expected the subscription limit to be capped at 5, got %s", l)
+	}
+
+	q, err = qc.Compile([]byte(`query other {
+		products(limit: 50) { id }
+		users { id }
+	}`), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range q.Selects {
+		if s.Paging.Limit == "5" || s.Where != nil {
+			t.Fatalf("unexpected rewrite of '%s'", s.Name)
+		}
+	}
+
+	if err := qc.AddRewrite(RewriteConfig{Table: "[products"}); err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	gql := `query getProducts {
+		products { id ...Product }
+	}
+
+	fragment Product on products { name }
+
+	mutation addProduct {
+		product(insert: $data) { id }
+	}`
+
+	d, err := ParseDocument([]byte(gql))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Operations) != 2 {
+		t.Fatalf("expected 2 operations got %d", len(d.Operations))
+	}
+
+	if _, err := d.SelectOperation(""); err == nil {
+		t.Fatal("expected an error when no operation name is given")
+	}
+
+	if _, err := d.SelectOperation("removeProduct"); err == nil {
+		t.Fatal("expected an error for an unknown operation")
+	}
+
+	op, err := d.SelectOperation("addProduct")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if op.Type != opMutate || op.Fields[0].Name != "product" {
+		t.Fatalf("wrong operation selected: %s %s", op.Type, op.Name)
+	}
+
+	exp := "mutation addProduct {\n\t\tproduct(insert: $data) { id }\n\t}" +
+		"\n\nfragment Product on products { name }"
+
+	if q := d.Query(op); q != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, q)
+	}
+
+	op, err = d.SelectOperation("getproducts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(op.Fields) != 3 || op.Fields[2].Name != "name" {
+		t.Fatalf("expected the fragment fields in: %+v", op.Fields)
+	}
+}
+
+func TestParseVarDefs(t *testing.T) {
+	gql := `query getProducts($id: Int!, $limit: Int = 10, $tags: [String!]! = ["a", "b"],
+		$where: products_where = { price: { gt: 5 } }) {
+		products(id: $id, limit: $limit) { id }
+	}`
+
+	op, err := Parse([]byte(gql))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []VarDef{
+		{Name: "id", Type: "Int", NonNull: true},
+		{Name: "limit", Type: "Int", Default: []byte(`10`)},
+		{Name: "tags", Type: "String", List: true, NonNull: true, Default: []byte(`["a","b"]`)},
+		{Name: "where", Type: "products_where", Default: []byte(`{"price":{"gt":5}}`)},
+	}
+
+	if len(op.VarDefs) != len(exp) {
+		t.Fatalf("expected %d variables got %d", len(exp), len(op.VarDefs))
+	}
+
+	for i, v := range exp {
+		vd := op.VarDefs[i]
+		if vd.Name != v.Name || vd.Type != v.Type || vd.List != v.List ||
+			vd.NonNull != v.NonNull || string(vd.Default) != string(v.Default) {
+			t.Fatalf("expected %+v got %+v", v, vd)
+		}
+	}
+
+	if _, err := Parse([]byte(`query ($id: Int = $other) { products { id } }`)); err == nil {
+		t.Fatal("expected an error for a variable as a default value")
+	}
+}
+
+func TestParseArena(t *testing.T) {
+	var sb strings.Builder
+
+	sb.WriteString("query { products(")
+	for i := 0; i < 12; i++ {
+		fmt.Fprintf(&sb, "a%d: { b: [%d, %d] } ", i, i, i)
+	}
+	sb.WriteString(") {")
+	for i := 0; i < 12; i++ {
+		fmt.Fprintf(&sb, " c%d", i)
+	}
+	sb.WriteString(" } }")
+
+	s := Stats()
+
+	// parse twice so the second one reuses the arena
+	for n := 0; n < 2; n++ {
+		op, err := Parse([]byte(sb.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f := op.Fields[0]
+		if len(f.Args) != 12 || len(f.Children) != 12 {
+			t.Fatalf("expected 12 args and children got %d and %d", len(f.Args), len(f.Children))
+		}
+
+		for i, arg := range f.Args {
+			v := arg.Val
+			if arg.Name != fmt.Sprintf("a%d", i) || v.Type != NodeObj || len(v.Children) != 1 {
+				t.Fatalf("unexpected arg %d: %+v", i, arg)
+			}
+
+			list := v.Children[0]
+			if list.Parent != v || list.Type != NodeList || len(list.Children) != 2 ||
+				list.Children[1].Val != fmt.Sprintf("%d", i) {
+				t.Fatalf("unexpected list in arg %d: %+v", i, list)
+			}
+		}
+
+		for i, id := range f.Children {
+			if op.Fields[id].Name != fmt.Sprintf("c%d", i) {
+				t.Fatalf("expected child c%d got %s", i, op.Fields[id].Name)
+			}
+		}
+		FreeOperation(op)
+	}
+
+	if st := Stats(); st.Ops-s.Ops != 2 || st.ArenaNodes-s.ArenaNodes != 2*12*4 {
+		t.Fatalf("unexpected pool stats %+v", st)
+	}
+}
+
+func TestParserNoAllocs(t *testing.T) {
+	p := NewParser()
+	var op Operation
+
+	for _, q := range [][]byte{gql, gqlWithFragments, gqlLarge} {
+		// the first parse grows the arena, fields and lexer
+		if err := p.Parse(&op, q); err != nil {
+			t.Fatal(err)
+		}
+
+		n := testing.AllocsPerRun(50, func() {
+			if err := p.Parse(&op, q); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		if n != 0 {
+			t.Fatalf("expected no allocations got %v for: %s", n, q)
+		}
+	}
+
+	if err := p.Parse(&op, gqlWithFragments); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(op.Fields) != 9 || op.Fields[1].Name != "first_name" || op.Fields[5].Name != "id" {
+		t.Fatalf("unexpected fields %+v", op.Fields)
+	}
+
+	// caller owned operations are never pooled
+	FreeOperation(&op)
+
+	if op.pooled {
+		t.Fatal("expected a caller owned operation to not be pooled")
+	}
+}
+
+func TestFreeOperationTwice(t *testing.T) {
+	op, err := Parse(gql)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	FreeOperation(op)
+	FreeOperation(op)
+
+	op1, err := Parse(gql)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op2, err := Parse(gql)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if op1 == op2 {
+		t.Fatal("expected an operation freed twice to be handed out once")
+	}
+}
+
+func TestGrowFields(t *testing.T) {
+	var sb strings.Builder
+
+	sb.WriteString("query { ")
+	for i := 0; i < 15; i++ {
+		fmt.Fprintf(&sb, "f%d: products(id: %d) @skip(if: $s) { id } ", i, i)
+	}
+	sb.WriteString("}")
+
+	op, err := Parse([]byte(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer FreeOperation(op)
+
+	for i := range op.Fields {
+		f := &op.Fields[i]
+
+		if f.Name == "id" {
+			continue
+		}
+
+		// the inline args were moved with the fields
+		if &f.Args[0] != &f.argsA[0] || f.Args[0].Val.Val != fmt.Sprintf("%d", i/2) {
+			t.Fatalf("unexpected args of field %d: %+v", i, f.Args)
+		}
+
+		if len(f.Children) != 1 || len(f.Directives) != 1 {
+			t.Fatalf("unexpected field %d: %+v", i, f)
+		}
+	}
+}
+
+func BenchmarkParser(b *testing.B) {
+	p := NewParser()
+	var op Operation
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		if err := p.Parse(&op, gqlLarge); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLexLimits(t *testing.T) {
+	lim := defaultLimits
+	lim.bytes, lim.name = 64, 11
+
+	tests := []struct {
+		gql  string
+		code string
+	}{
+		{`query { products { id name description price } }`, ""},
+		{`query { products { id name description price user { id email } } }`, ErrCodeQueryTooLarge},
+		{`query { products(id: $the_product_id) { id } }`, ErrCodeNameTooLong},
+		{`query { products { id @include_if_ok(if: true) } }`, ErrCodeNameTooLong},
+	}
+
+	for _, v := range tests {
+		_, err := parse([]byte(v.gql), lim)
+
+		var e *LimitError
+		if errors.As(err, &e) {
+			if e.Code != v.code {
+				t.Fatalf("%s: expected code '%s' got '%s'", v.gql, v.code, e.Code)
+			}
+			continue
+		}
+
+		if err != nil || v.code != "" {
+			t.Fatalf("%s: expected code '%s' got error: %v", v.gql, v.code, err)
+		}
+	}
+}
+
+func TestErrorLocations(t *testing.T) {
+	qcompile, _ := NewCompiler()
+
+	tests := []struct {
+		gql  string
+		loc  Location
+		path []string
+	}{
+		{"query {\n  products(where: { id: { eq: 1 } } {\n    id\n  }\n}", Location{2, 37}, nil},
+		{"query {\n  products(limit: ) { id }\n}", Location{2, 19}, nil},
+		{"query {\n  products(where: { name: { eq: \"é\" } }) { id % }\n}", Location{2, 47}, nil},
+		{"query {\n  products {\n    id\n    u: users(where: { email: { eqq: \"a\" } }) { id }\n  }\n}",
+			Location{4, 5}, []string{"products", "u"}},
+	}
+
+	for _, v := range tests {
+		_, err := qcompile.Compile([]byte(v.gql), "user")
+		if err == nil {
+			t.Fatalf("expecting an error: %s", v.gql)
+		}
+
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Fatalf("expecting a location: %s", err)
+		}
+
+		if len(e.Locations) != 1 || e.Locations[0] != v.loc {
+			t.Errorf("expecting the location %v got %v: %s", v.loc, e.Locations, err)
+		}
+
+		if fmt.Sprint(e.Path) != fmt.Sprint(v.path) {
+			t.Errorf("expecting the path %v got %v: %s", v.path, e.Path, err)
+		}
+	}
+}
+
+func TestDuplicateResponseKeys(t *testing.T) {
+	qcompile, _ := NewCompiler()
+
+	tests := []struct {
+		gql  string
+		locs []Location
+		path []string
+	}{
+		{"query {\n  products {\n    a: id\n    a: name\n  }\n}",
+			[]Location{{3, 5}, {4, 5}}, []string{"products", "a"}},
+		{"query {\n  recent: products(limit: 5) { id }\n  recent: products(limit: 10) { id }\n}",
+			[]Location{{2, 3}, {3, 3}}, []string{"recent"}},
+		{"query {\n  users {\n    products { id }\n    products { name }\n  }\n}",
+			[]Location{{3, 5}, {4, 5}}, []string{"users", "products"}},
+	}
+
+	for _, v := range tests {
+		_, err := qcompile.Compile([]byte(v.gql), "user")
+		if err == nil {
+			t.Fatalf("expecting an error: %s", v.gql)
+		}
+
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Fatalf("expecting a location: %s", err)
+		}
+
+		if fmt.Sprint(e.Locations) != fmt.Sprint(v.locs) {
+			t.Errorf("expecting the locations %v got %v: %s", v.locs, e.Locations, err)
+		}
+
+		if fmt.Sprint(e.Path) != fmt.Sprint(v.path) {
+			t.Errorf("expecting the path %v got %v: %s", v.path, e.Path, err)
+		}
+	}
+
+	// the same column selected twice is returned once
+	gql := `query { products { id name id } a: users { id } b: users { id } }`
+
+	if _, err := qcompile.Compile([]byte(gql), "user"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRootFields(t *testing.T) {
+	gql := `query getEvents($id: Int) {
+		me { id }
+		stats: analytics(x: "{") @skip(if: false) {
+			events(where: { id: $id }) { id name } # a }
+		}
+		count
+	}`
+
+	rf, err := RootFields([]byte(gql))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rf) != 3 {
+		t.Fatalf("expected 3 root fields got %d", len(rf))
+	}
+
+	a := rf[1]
+	if a.Name != "analytics" || a.Alias != "stats" {
+		t.Fatalf("unexpected root field: %+v", a)
+	}
+
+	if v := gql[a.Start:a.Open]; v != `stats: analytics(x: "{") @skip(if: false) ` {
+		t.Fatalf("unexpected field: %s", v)
+	}
+
+	sel := strings.TrimSpace(gql[a.Open+1 : a.Close])
+	if exp := `events(where: { id: $id }) { id name } # a }`; sel != exp {
+		t.Fatalf("expected %s got %s", exp, sel)
+	}
+
+	if rf[2].Open != -1 || rf[2].Close != -1 {
+		t.Fatalf("expected no selection: %+v", rf[2])
+	}
+}
+
+func TestConstants(t *testing.T) {
+	consts := map[string]interface{}{
+		"env": map[string]interface{}{
+			"max_rows": 25,
+			"region":   "eu \"west\"",
+			"tags":     []interface{}{"a", "b"},
+		},
+	}
+
+	qc, err := NewCompiler(WithConstants(consts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := []byte(`query {
+		products(limit: $env.max_rows, where: { region: { eq: $env.region } }) {
+			id # $env.missing
+			name(format: "$env.region")
+		}
+	}`)
+
+	b, err := qc.replaceConstants(gql)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `products(limit: 25, where: { region: { eq: "eu \"west\"" } })`
+	if !strings.Contains(string(b), exp) {
+		t.Fatalf("expected %s in %s", exp, b)
+	}
+
+	if !strings.Contains(string(b), `# $env.missing`) || !strings.Contains(string(b), `"$env.region"`) {
+		t.Fatalf("expected the comments and strings to be unchanged: %s", b)
+	}
+
+	if b, _ := qc.replaceConstants([]byte(`query { products(where: { id: { eq: $env } }) { id } }`)); !strings.Contains(string(b), "$env }") {
+		t.Fatalf("expected a variable of the name of a constant to be unchanged: %s", b)
+	}
+
+	if b, _ := qc.replaceConstants([]byte(`{ a(v: $env.tags) }`)); string(b) != `{ a(v: ["a","b"]) }` {
+		t.Fatalf("unexpected list: %s", b)
+	}
+
+	for _, v := range []string{`{ a(v: $env.missing) }`, `{ a(v: $env.max_rows.x) }`, `{ a(v: $env.) }`} {
+		if _, err := qc.replaceConstants([]byte(v)); err == nil {
+			t.Fatalf("%s: expected an error", v)
+		}
+	}
+
+	if _, err := NewCompiler(WithConstants(map[string]interface{}{"max_rows": 5})); err == nil {
+		t.Fatal("expected an error for a constant not under a name")
+	}
+}
+
+func TestOrderByList(t *testing.T) {
+	qc, _ := NewCompiler()
+
+	tests := []string{
+		`query { products(order_by: { price: desc, user: { email: asc }, id: asc }) { id } }`,
+		`query { products(order_by: [{ price: desc }, { user: { email: asc } }, { id: asc }]) { id } }`,
+	}
+
+	for _, v := range tests {
+		qcode, err := qc.Compile([]byte(v), "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var cols []string
+		for _, ob := range qcode.Selects[0].OrderBy {
+			cols = append(cols, ob.Col)
+		}
+
+		if exp := "price,user.email,id"; strings.Join(cols, ",") != exp {
+			t.Fatalf("%s: expected the order %s got %v", v, exp, cols)
+		}
+
+		if ob := qcode.Selects[0].OrderBy; ob[0].Order != OrderDesc || ob[2].Order != OrderAsc {
+			t.Fatalf("%s: unexpected orders", v)
+		}
+	}
+
+	if _, err := qc.Compile([]byte(`query { products(order_by: [price]) { id } }`), "user"); err == nil {
+		t.Fatal("expected an error for a list of columns")
+	}
+}
+
+func TestTokens(t *testing.T) {
+	gql := []byte("query getProducts($id: Int) {\n  # the products\n  products(where: { id: { eq: $ID } }) @skip(if: true) {\n    ...Fields name\n  }\n  é: price(f: \"a\nb\", n: -1.5) }\n  tail")
+
+	toks, err := Tokens(gql)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	for _, tk := range toks {
+		if tk.Value != string(gql[tk.Start:tk.End]) {
+			t.Fatalf("value '%s' is not the query from %d to %d", tk.Value, tk.Start, tk.End)
+		}
+		fmt.Fprintf(&b, "%s:%s ", tk.Type, tk.Value)
+	}
+
+	exp := "keyword:query name:getProducts punctuator:( variable:$id punctuator:: name:Int punctuator:) punctuator:{ " +
+		"comment:# the products name:products punctuator:( name:where punctuator:: punctuator:{ name:id punctuator:: " +
+		"punctuator:{ name:eq punctuator:: variable:$ID punctuator:} punctuator:} punctuator:) directive:@skip " +
+		"punctuator:( name:if punctuator:: boolean:true punctuator:) punctuator:{ spread:... name:Fields name:name " +
+		"punctuator:} name:é punctuator:: name:price punctuator:( name:f punctuator:: string:\"a\nb\" name:n " +
+		"punctuator:: number:-1.5 punctuator:) punctuator:} name:tail "
+
+	if b.String() != exp {
+		t.Fatalf("unexpected tokens:\n%s\nexpected:\n%s", b.String(), exp)
+	}
+
+	locs := map[string]Location{
+		"# the products": {2, 3},
+		"$ID":            {3, 31},
+		"price":          {6, 6},
+		"-1.5":           {7, 8},
+		"tail":           {8, 3},
+	}
+
+	for _, tk := range toks {
+		if loc, ok := locs[tk.Value]; ok && tk.Location != loc {
+			t.Fatalf("%s: expected the location %v got %v", tk.Value, loc, tk.Location)
+		}
+	}
+
+	if string(gql[:5]) != "query" || !strings.Contains(string(gql), "$ID") {
+		t.Fatal("expected the query to be unchanged")
+	}
+
+	toks, err = Tokens([]byte("{ products ^ }"))
+	if err == nil || len(toks) != 2 {
+		t.Fatalf("expected the tokens before the error: %v %v", toks, err)
+	}
+}
@@ -16,10 +16,6 @@ type SType int8
 type Action int8
 type SkipType int8
 
-const (
-	maxSelectors = 30
-)
-
 const (
 	QTUnknown QType = iota
 	QTQuery
@@ -43,6 +39,18 @@ const (
 	SkipTypeTableNotFound
 	SkipTypeBlocked
 	SkipTypeRemote
+	SkipTypeDirective
+)
+
+// ClientMutationID is the field Relay clients use to match
+// a mutation with its response
+const ClientMutationID = "clientMutationId"
+
+// CanUpdate and CanDelete are the fields of a row that are true
+// when the role is allowed to update or delete the row
+const (
+	CanUpdate = "_can_update"
+	CanDelete = "_can_delete"
 )
 
 type QCode struct {
@@ -51,6 +59,26 @@ type QCode struct {
 	Selects   []Select
 	Roots     []int32
 	rootsA    [5]int32
+
+	// Mutations are the roots that insert, update, upsert or delete in the
+	// order they are in the query. Type and ActionVar are of the first one.
+	Mutations []Mutation
+
+	// Vars are the variables defined in the operation header
+	Vars []VarDef
+
+	// Cost is the depth and complexity of the query
+	Cost Cost
+}
+
+type Mutation struct {
+	Type      QType
+	ActionVar string
+	SelID     int32
+
+	// ByID is set when the rows updated or deleted are
+	// filtered by the id argument
+	ByID bool
 }
 
 type Select struct {
@@ -65,6 +93,7 @@ type Select struct {
 	Where      *Exp
 	OrderBy    []*OrderBy
 	DistinctOn []string
+	GroupBy    []string
 	Paging     Paging
 	Children   []int32
 	Functions  bool
@@ -72,12 +101,66 @@ type Select struct {
 	PresetMap  map[string]string
 	PresetList []string
 	SkipRender SkipType
+	SkipVar    string
+	IncludeVar string
+
+	// ActionVar is the variable with the input of a mutation root and
+	// ClientMutationID the field the clientMutationId in it is returned as
+	ActionVar        string
+	ClientMutationID string
+
+	// Connection is set when the selection is a Relay connection and Node
+	// is the field name of the node root field the selection is a type of
+	Connection *Connection
+	Node       string
+
+	// Func is the database function the rows of the table are selected
+	// from when the root field is a function and FuncArgs its arguments
+	Func     string
+	FuncArgs []FuncArg
+
+	// View is read in place of the table when a rewrite rule redirects
+	// it, the columns and relationships are still the ones of the table
+	View string
+
+	// Find is set for the recursive selection of the children or the
+	// parents of the parent row in the same table
+	Find FindType
+
+	// CacheMaxAge is the seconds the results of the query can be cached
+	// for as set by the @cacheControl directive on the selection
+	CacheMaxAge int
+
+	// Namespace is the field name of the namespace a root is selected in
+	Namespace string
+
+	// RemoteSort is set when the rows are ordered by the fields of
+	// a remote selection, they are sorted once its data is joined
+	RemoteSort *RemoteSort
+
+	// Watch are the columns a subscription is updated for as set by the
+	// @watch directive on the selection, changes to the other columns of
+	// the selection are not sent
+	Watch []string
+}
+
+// FuncArg is a named argument of a function (eg. `args: { q: "shoe" }`)
+type FuncArg struct {
+	Name string
+	Type ValType
+	Val  string
 }
 
 type Column struct {
-	Table     string
-	Name      string
-	FieldName string
+	Table      string
+	Name       string
+	FieldName  string
+	SkipVar    string
+	IncludeVar string
+
+	// Filter is the update or delete filter of the role
+	// for the _can_update and _can_delete fields
+	Filter *Exp
 }
 
 type Exp struct {
@@ -104,6 +187,17 @@ func (ex *Exp) Reset() {
 type OrderBy struct {
 	Col   string
 	Order Order
+
+	// Var is the variable the order is set from (eg. price: $dir)
+	// when it's chosen by the client, see OrderParam
+	Var string
+}
+
+// RemoteSort is the order of the rows by the fields of remote selections
+// (eg. payments.amount) and the paging of the rows once they are sorted
+type RemoteSort struct {
+	OrderBy []*OrderBy
+	Paging  Paging
 }
 
 type PagingType int
@@ -114,12 +208,26 @@ const (
 	PtBackward
 )
 
+// FindType is the direction of a recursive selection of a table
+// related to itself (eg. the replies of a comment)
+type FindType int8
+
+const (
+	FindNone FindType = iota
+	FindChildren
+	FindParents
+)
+
 type Paging struct {
 	Type    PagingType
 	Limit   string
 	Offset  string
 	Cursor  bool
 	NoLimit bool
+
+	// LimitVar is the variable the limit is set from (eg. limit: $n),
+	// its value is clamped to Limit, see PagingParam
+	LimitVar string
 }
 
 type ExpOp int
@@ -154,6 +262,8 @@ const (
 	OpFalse
 	OpNotDistinct
 	OpDistinct
+	OpBetween
+	OpStDWithin
 )
 
 type ValType int
@@ -190,17 +300,63 @@ const (
 )
 
 type Compiler struct {
-	tr       map[string]map[string]*trval
-	defBlock bool
+	tr           map[string]map[string]*trval
+	defBlock     bool
+	maxSelectors int
+	maxLimit     int
+	limits       limits
+	blocklist    map[string]struct{}
+	directives   map[string]DirectiveFunc
+	rw           []rewrite
+	maxErrors    int
+	relay        bool
+	cost         CostConfig
+
+	// filters are the named filters queries can use in the where argument
+	filters map[string]filter
+
+	// utypes are the tables of the types of the unions
+	// keyed by the union and then the type name
+	utypes map[string]map[string]string
+
+	// tfuncs are the tables of the functions that are root fields
+	tfuncs map[string]string
+
+	// ns are the namespaces by name and nsTables the
+	// namespace of each table by its plural and singular name
+	ns       map[string]*namespace
+	nsTables map[string]string
+
+	// consts are the server defined constants queries use (eg. $env.max_rows)
+	consts map[string]interface{}
 }
 
 var expPool = sync.Pool{
 	New: func() interface{} { return &Exp{doFree: true} },
 }
 
-func NewCompiler(c Config) (*Compiler, error) {
-	co := &Compiler{defBlock: c.DefaultBlock}
-	co.tr = make(map[string]map[string]*trval)
+// NewCompiler creates a compiler configured with the options. Compilers
+// do not share any config so differently configured ones can be used
+// side by side.
+func NewCompiler(opts ...Option) (*Compiler, error) {
+	co := &Compiler{
+		tr:           make(map[string]map[string]*trval),
+		maxSelectors: defaultMaxSelectors,
+		maxLimit:     defaultMaxLimit,
+		limits:       defaultLimits,
+		blocklist:    make(map[string]struct{}),
+		directives:   make(map[string]DirectiveFunc),
+		maxErrors:    util.DefaultMaxErrors,
+		utypes:       make(map[string]map[string]string),
+		tfuncs:       make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		if err := opt(co); err != nil {
+			return nil, err
+		}
+	}
+
 	seedExp := [100]Exp{}
 
 	for i := range seedExp {
@@ -281,17 +437,22 @@ func (com *Compiler) Compile(query []byte, role string) (*QCode, error) {
 	qc := QCode{Type: QTQuery}
 	qc.Roots = qc.rootsA[:0]
 
-	op, err := Parse(query)
+	if query, err = com.replaceConstants(query); err != nil {
+		return nil, err
+	}
+
+	op, err := parse(query, com.limits)
 	if err != nil {
 		return nil, err
 	}
 
 	if err = com.compileQuery(&qc, op, role); err != nil {
+		FreeOperation(op)
 		return nil, err
 	}
+	qc.Vars = op.VarDefs
 
-	freeNodes(op)
-	opPool.Put(op)
+	FreeOperation(op)
 
 	return &qc, nil
 }
@@ -303,20 +464,38 @@ func (com *Compiler) compileQuery(qc *QCode, op *Operation, role string) error {
 		return errors.New("invalid graphql no query found")
 	}
 
-	if op.Type == opMutate {
-		if err := com.setMutationType(qc, op.Fields[0].Args); err != nil {
-			return err
-		}
-	}
-
 	selects := make([]Select, 0, 5)
 	st := NewStack()
-	action := qc.Type
+
+	// action is the mutation of the root being compiled and mtype that of
+	// the root the current selection belongs to
+	var action, mtype QType
+	var actionVar string
+	var errs util.Errors
+	var err error
 
 	if len(op.Fields) == 0 {
 		return errors.New("empty query")
 	}
 
+	if err := com.namespaces(op, role); err != nil {
+		return err
+	}
+
+	if err := checkResponseKeys(op); err != nil {
+		return err
+	}
+
+	if qc.Cost, err = com.queryCost(op); err != nil {
+		return err
+	}
+
+	if com.relay {
+		if err := relayNodes(op); err != nil {
+			return err
+		}
+	}
+
 	for i := range op.Fields {
 		if op.Fields[i].ParentID == -1 {
 			val := op.Fields[i].ID | (-1 << 16)
@@ -329,8 +508,8 @@ func (com *Compiler) compileQuery(qc *QCode, op *Operation, role string) error {
 			break
 		}
 
-		if id >= maxSelectors {
-			return fmt.Errorf("selector limit reached (%d)", maxSelectors)
+		if id >= int32(com.maxSelectors) {
+			return complexErr(ErrSelectorLimit, "selector limit reached (%d)", com.maxSelectors)
 		}
 
 		val := st.Pop()
@@ -341,12 +520,44 @@ func (com *Compiler) compileQuery(qc *QCode, op *Operation, role string) error {
 
 		if field.ParentID == -1 {
 			parentID = -1
+			action, actionVar = QTQuery, ""
+
+			if op.Type == opMutate {
+				if action, actionVar, err = mutationType(field.Args); err != nil {
+					return fieldErr(op, field, err)
+				}
+			}
+			mtype = action
+		}
+
+		// the type of an inline fragment in a union can be
+		// a name set for a table (eg. Product for products)
+		if field.ParentID != -1 && op.Fields[field.ParentID].Union {
+			if t, ok := com.utypes[op.Fields[field.ParentID].Name][field.Name]; ok {
+				field.Name = t
+			}
+		}
+
+		// a root field can be a function returning rows of a table
+		// (eg. search_products), it's selected like the table
+		var fn string
+		if field.ParentID == -1 && action == QTQuery {
+			if t, ok := com.tfuncs[strings.ToLower(field.Name)]; ok {
+				fn = field.Name
+				field.Name = t
+			}
 		}
 
 		trv := com.getRole(role, field.Name)
 		skipRender := SkipTypeNone
 
-		if trv != nil {
+		if _, ok := com.blocklist[strings.ToLower(field.Name)]; ok {
+			if action != QTQuery {
+				return fieldErr(op, field, accessErr(role, "table", field.Name))
+			}
+			skipRender = SkipTypeBlocked
+
+		} else if trv != nil {
 			switch action {
 			case QTQuery:
 				if trv.query.block {
@@ -355,17 +566,17 @@ func (com *Compiler) compileQuery(qc *QCode, op *Operation, role string) error {
 
 			case QTInsert:
 				if trv.insert.block {
-					return fmt.Errorf("%s, insert blocked: %s", role, field.Name)
+					return fieldErr(op, field, accessErr(role, "insert", field.Name))
 				}
 
 			case QTUpdate:
 				if trv.update.block {
-					return fmt.Errorf("%s, update blocked: %s", role, field.Name)
+					return fieldErr(op, field, accessErr(role, "update", field.Name))
 				}
 
 			case QTDelete:
 				if trv.delete.block {
-					return fmt.Errorf("%s, delete blocked: %s", role, field.Name)
+					return fieldErr(op, field, accessErr(role, "delete", field.Name))
 				}
 			}
 
@@ -373,25 +584,59 @@ func (com *Compiler) compileQuery(qc *QCode, op *Operation, role string) error {
 			skipRender = SkipTypeTableNotFound
 		}
 
+		var skipVar, includeVar string
+
+		if skipRender == SkipTypeNone {
+			skip, err := com.compileDirectives(field.Directives, true, &skipVar, &includeVar)
+			if err != nil {
+				return fieldErr(op, field, err)
+			}
+			if skip {
+				skipRender = SkipTypeDirective
+			}
+		}
+
 		selects = append(selects, Select{
 			ID:         id,
 			ParentID:   parentID,
 			Name:       field.Name,
 			SkipRender: skipRender,
+			SkipVar:    skipVar,
+			IncludeVar: includeVar,
+			Func:       fn,
 		})
 		s := &selects[(len(selects) - 1)]
 
+		if action != QTQuery {
+			s.ActionVar = actionVar
+			qc.Mutations = append(qc.Mutations, Mutation{
+				Type:      action,
+				ActionVar: actionVar,
+				SelID:     s.ID,
+			})
+		}
+
 		if field.Union {
 			s.Type = STUnion
 		}
 
-		if field.Alias != "" {
+		switch {
+		case field.Alias != "":
 			s.FieldName = field.Alias
-		} else {
+		case fn != "":
+			s.FieldName = fn
+		default:
 			s.FieldName = s.Name
 		}
 
+		// the types of a node are returned as one field
+		if field.node != "" {
+			s.Node = field.node
+			s.FieldName = "__node_" + s.Name
+		}
+
 		if s.ParentID == -1 {
+			s.Namespace = field.ns
 			qc.Roots = append(qc.Roots, s.ID)
 		} else {
 			p := &selects[s.ParentID]
@@ -429,22 +674,55 @@ func (com *Compiler) compileQuery(qc *QCode, op *Operation, role string) error {
 			}
 		}
 
-		err := com.compileArgs(qc, s, field.Args, role)
-		if err != nil {
-			return err
+		// argument errors are collected so all of them can be fixed at once
+		if e := com.compileArgs(qc, s, field.Args, role); len(e) != 0 {
+			for i := range e {
+				e[i] = fieldErr(op, field, e[i])
+			}
+			errs = append(errs, e...)
+			if len(errs) >= com.maxErrors {
+				return errs[:com.maxErrors].Err()
+			}
+		}
+
+		if s.ParentID == -1 && action == QTQuery {
+			if err := com.compileOpArgs(s, field.Args, op.Args, role); err != nil {
+				return fieldErr(op, field, err)
+			}
+		}
+
+		// directives run after the args so the limits they set are not overridden
+		if err := com.runDirectives(s, field.Directives, role); err != nil {
+			return fieldErr(op, field, err)
 		}
 
 		// Order is important AddFilters must come after compileArgs
-		com.AddFilters(qc, s, role)
+		com.AddFilters(mtype, s, role)
+
+		children := field.Children
+
+		if com.relay && mtype == QTQuery {
+			if s.Connection, children, err = connection(op, field); err != nil {
+				return err
+			}
+		}
 
-		s.Cols = make([]Column, 0, len(field.Children))
+		s.Cols = make([]Column, 0, len(children))
 		cm := make(map[string]struct{})
 		action = QTQuery
 
-		for _, cid := range field.Children {
+		for _, cid := range children {
 			f := op.Fields[cid]
 
-			var fname string
+			var fname, skipVar, includeVar string
+
+			skip, err := com.compileDirectives(f.Directives, false, &skipVar, &includeVar)
+			if err != nil {
+				return fieldErr(op, &f, err)
+			}
+			if skip {
+				continue
+			}
 
 			if f.Alias != "" {
 				fname = f.Alias
@@ -464,28 +742,123 @@ func (com *Compiler) compileQuery(qc *QCode, op *Operation, role string) error {
 				continue
 			}
 
-			col := Column{Name: f.Name, FieldName: fname}
+			// Relay clients send a clientMutationId with the input
+			// and expect it back as is in the payload, field names
+			// are lowercased by the lexer so the case is restored
+			if s.ActionVar != "" && strings.EqualFold(f.Name, ClientMutationID) {
+				if f.Alias != "" {
+					s.ClientMutationID = fname
+				} else {
+					s.ClientMutationID = ClientMutationID
+				}
+				continue
+			}
+
+			col := Column{
+				Name:       f.Name,
+				FieldName:  fname,
+				SkipVar:    skipVar,
+				IncludeVar: includeVar,
+			}
+
+			if f.Name == CanUpdate || f.Name == CanDelete {
+				col.Filter = com.canFilter(trv, f.Name, role)
+			}
 			s.Cols = append(s.Cols, col)
 		}
 
+		if s.Connection != nil {
+			// the cursors of the rows are used for the edges and page info
+			s.Cols = append(s.Cols, Column{Name: "cursor", FieldName: RowCursor})
+
+			if s.Paging.Type == PtOffset {
+				s.Paging.Type = PtForward
+			}
+		}
+
+		// subscriptions are compiled as queries, the rows returned
+		// by mutations are not rewritten
+		if mtype == QTQuery {
+			com.applyRewrites(s, op.Name, role)
+		}
+
+		if s.Connection != nil && s.Paging.Limit == "" && !s.Paging.NoLimit {
+			s.Paging.Limit = strconv.Itoa(defaultLimit)
+		}
+
 		id++
 	}
 
+	if len(errs) != 0 {
+		return errs.Err()
+	}
+
 	if id == 0 {
 		return errors.New("invalid query")
 	}
 
 	qc.Selects = selects[:id]
 
+	// roots are compiled last to first so the mutations
+	// are flipped back into query order
+	ms := qc.Mutations
+	for i, j := 0, len(ms)-1; i < j; i, j = i+1, j-1 {
+		ms[i], ms[j] = ms[j], ms[i]
+	}
+
+	for i := range ms {
+		ms[i].ByID = hasIDFilter(qc.Selects[ms[i].SelID].Where)
+	}
+
+	if len(ms) != 0 {
+		qc.Type = ms[0].Type
+		qc.ActionVar = ms[0].ActionVar
+	}
+
 	return nil
 }
 
-func (com *Compiler) AddFilters(qc *QCode, sel *Select, role string) {
+var (
+	canAll  = &Exp{Op: OpNop}
+	canNone = &Exp{Op: OpFalse}
+)
+
+// canFilter returns the filter of the rows the role can update
+// or delete, it's the same filter the mutation would get
+func (com *Compiler) canFilter(trv *trval, field, role string) *Exp {
+	qt := QTUpdate
+	if field == CanDelete {
+		qt = QTDelete
+	}
+
+	if trv == nil {
+		if com.defBlock && role == "anon" {
+			return canNone
+		}
+		return canAll
+	}
+
+	if (qt == QTUpdate && trv.update.block) || (qt == QTDelete && trv.delete.block) {
+		return canNone
+	}
+
+	fil, nu := trv.filter(qt)
+
+	switch {
+	case fil == nil:
+		return canAll
+	case nu && role == "anon":
+		return canNone
+	}
+	return fil
+}
+
+func (com *Compiler) AddFilters(qt QType, sel *Select, role string) {
 	var fil *Exp
 	var nu bool // need user_id (or not) in this filter
 
 	if trv, ok := com.tr[role][sel.Name]; ok {
-		fil, nu = trv.filter(qc.Type)
+		fil, nu = trv.filter(qt)
 	}
 
 	if fil == nil {
@@ -505,7 +878,9 @@ func (com *Compiler) AddFilters(qc *QCode, sel *Select, role string) {
 	}
 }
 
-func (com *Compiler) compileArgs(qc *QCode, sel *Select, args []Arg, role string) error {
+// compileArgs returns the errors in all the args
+func (com *Compiler) compileArgs(qc *QCode, sel *Select, args []Arg, role string) util.Errors {
+	var errs util.Errors
 	var err error
 
 	for i := range args {
@@ -527,6 +902,9 @@ func (com *Compiler) compileArgs(qc *QCode, sel *Select, args []Arg, role string
 		case "distinct_on", "distinct":
 			err = com.compileArgDistinctOn(sel, arg)
 
+		case "group_by", "groupby":
+			err = com.compileArgGroupBy(sel, arg)
+
 		case "limit":
 			err = com.compileArgLimit(sel, arg)
 
@@ -544,6 +922,39 @@ func (com *Compiler) compileArgs(qc *QCode, sel *Select, args []Arg, role string
 
 		case "before":
 			err = com.compileArgAfterBefore(sel, arg, PtBackward)
+
+		case "args":
+			err = com.compileArgFuncArgs(sel, arg)
+
+		case "find":
+			err = com.compileArgFind(sel, arg)
+		}
+
+		if err != nil && !errs.Add(err, com.maxErrors) {
+			break
+		}
+	}
+
+	return errs
+}
+
+// compileOpArgs applies the operation arguments to a root selection. A `limit`
+// is the default for selections without their own paging and a `where` filter
+// is added to every root selection (eg. a tenant filter).
+func (com *Compiler) compileOpArgs(sel *Select, fieldArgs, args []Arg, role string) error {
+	var err error
+
+	for i := range args {
+		arg := &args[i]
+
+		switch arg.Name {
+		case "where":
+			err = com.compileArgWhere(sel, arg, role)
+
+		case "limit":
+			if !hasArg(fieldArgs, "limit", "first", "last") {
+				err = com.compileArgLimit(sel, arg)
+			}
 		}
 
 		if err != nil {
@@ -554,43 +965,107 @@ func (com *Compiler) compileArgs(qc *QCode, sel *Select, args []Arg, role string
 	return nil
 }
 
-func (com *Compiler) setMutationType(qc *QCode, args []Arg) error {
-	setActionVar := func(arg *Arg) error {
-		if arg.Val.Type != NodeVar {
-			return argErr(arg.Name, "variable")
+// compileDirectives handles the @skip and @include directives on a field. It returns
+// true if a literal condition skips the field, a variable condition is left to be
+// decided at render time when the variables are known. Custom directives are only
+// allowed on tables and are left for runDirectives.
+func (com *Compiler) compileDirectives(ds []Directive, table bool, skipVar, includeVar *string) (bool, error) {
+	for i := range ds {
+		d := &ds[i]
+
+		if d.Name != "skip" && d.Name != "include" {
+			if _, ok := com.directives[d.Name]; !ok {
+				return false, fmt.Errorf("unknown directive: @%s", d.Name)
+			}
+			if !table {
+				return false, fmt.Errorf("@%s: only supported on tables", d.Name)
+			}
+			continue
+		}
+
+		if len(d.Args) != 1 || d.Args[0].Name != "if" {
+			return false, fmt.Errorf("@%s: expecting a single 'if' argument", d.Name)
+		}
+		node := d.Args[0].Val
+
+		switch node.Type {
+		case NodeBool:
+			if (d.Name == "skip") == (node.Val == "true") {
+				return true, nil
+			}
+
+		case NodeVar:
+			if d.Name == "skip" {
+				*skipVar = node.Val
+			} else {
+				*includeVar = node.Val
+			}
+
+		default:
+			return false, fmt.Errorf("@%s: 'if' must be a boolean or a variable", d.Name)
+		}
+	}
+
+	return false, nil
+}
+
+// runDirectives calls the handlers of the custom directives on a selection
+func (com *Compiler) runDirectives(sel *Select, ds []Directive, role string) error {
+	for i := range ds {
+		if fn, ok := com.directives[ds[i].Name]; ok {
+			if err := fn(sel, ds[i].Args, role); err != nil {
+				return fmt.Errorf("@%s: %w", ds[i].Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func hasArg(args []Arg, names ...string) bool {
+	for i := range args {
+		for _, n := range names {
+			if args[i].Name == n {
+				return true
+			}
 		}
-		qc.ActionVar = arg.Val.Val
-		return nil
 	}
+	return false
+}
 
+// mutationType returns the mutation and the variable holding
+// its data from the arguments of a root field
+func mutationType(args []Arg) (QType, string, error) {
 	for i := range args {
 		arg := &args[i]
 
 		switch arg.Name {
-		case "insert":
-			qc.Type = QTInsert
-			return setActionVar(arg)
-		case "update":
-			qc.Type = QTUpdate
-			return setActionVar(arg)
-		case "upsert":
-			qc.Type = QTUpsert
-			return setActionVar(arg)
-		case "delete":
-			qc.Type = QTDelete
+		case "insert", "update", "upsert":
+			if arg.Val.Type != NodeVar {
+				return QTQuery, "", argErr(arg.Name, "variable")
+			}
 
+			switch arg.Name {
+			case "insert":
+				return QTInsert, arg.Val.Val, nil
+			case "update":
+				return QTUpdate, arg.Val.Val, nil
+			default:
+				return QTUpsert, arg.Val.Val, nil
+			}
+
+		case "delete":
 			if arg.Val.Type != NodeBool {
-				return argErr(arg.Name, "boolen")
+				return QTQuery, "", argErr(arg.Name, "boolen")
 			}
 
 			if arg.Val.Val == "false" {
-				qc.Type = QTQuery
+				return QTQuery, "", nil
 			}
-			return nil
+			return QTDelete, "", nil
 		}
 	}
 
-	return nil
+	return QTQuery, "", nil
 }
 
 func (com *Compiler) compileArgObj(st *util.Stack, arg *Arg) (*Exp, bool, error) {
@@ -629,7 +1104,20 @@ func (com *Compiler) compileArgNode(st *util.Stack, node *Node, usePool bool) (*
 			continue
 		}
 
-		ex, err := newExp(st, node, usePool)
+		var ex *Exp
+		var err error
+
+		if isFilterRef(node) {
+			var nu bool
+			if ex, nu, err = com.namedFilter(node); err != nil {
+				return nil, needsUser, err
+			}
+			if nu {
+				needsUser = true
+			}
+		} else {
+			ex, err = newExp(st, node, usePool)
+		}
 		if err != nil {
 			return nil, needsUser, err
 		}
@@ -652,8 +1140,56 @@ func (com *Compiler) compileArgNode(st *util.Stack, node *Node, usePool bool) (*
 	return root, needsUser, nil
 }
 
+// isFilterRef returns true for a named filter used in the where argument
+// (eg. `filter: active_users`), a column named filter has operators instead
+func isFilterRef(node *Node) bool {
+	if node.Name != "filter" && node.Name != "_filter" {
+		return false
+	}
+	return node.Type == NodeStr || node.Type == NodeList
+}
+
+// namedFilter returns the filter or the filters (and'ed together) used by name
+func (com *Compiler) namedFilter(node *Node) (*Exp, bool, error) {
+	names := []string{node.Val}
+
+	if node.Type == NodeList {
+		names = names[:0]
+		for _, n := range node.Children {
+			if n.Type != NodeStr {
+				return nil, false, errors.New("filter: a list of filter names expected")
+			}
+			names = append(names, n.Val)
+		}
+	}
+
+	var ex *Exp
+	var needsUser bool
+
+	for _, name := range names {
+		f, ok := com.filters[strings.ToLower(name)]
+		if !ok {
+			return nil, false, fmt.Errorf("unknown filter: %s", name)
+		}
+		if f.nu {
+			needsUser = true
+		}
+
+		if ex == nil {
+			ex = f.ex
+		} else {
+			ex = &Exp{Op: OpAnd, Children: []*Exp{ex, f.ex}, internal: true}
+		}
+	}
+
+	if ex == nil {
+		return nil, false, errors.New("filter: no filter names found")
+	}
+	return ex, needsUser, nil
+}
+
 func (com *Compiler) compileArgID(sel *Select, arg *Arg) error {
-	if sel.ID != 0 {
+	if sel.ID != 0 && sel.Node == "" {
 		return nil
 	}
 
@@ -672,28 +1208,46 @@ func (com *Compiler) compileArgID(sel *Select, arg *Arg) error {
 	ex.Type = ValVar
 	ex.Val = arg.Val.Val
 
+	// the variable is a global id
+	if com.relay {
+		ex.Val = NodeParam(sel.Name, arg.Val.Val)
+	}
+
 	sel.Where = ex
 	return nil
 }
 
 func (com *Compiler) compileArgSearch(sel *Select, arg *Arg) error {
-	if arg.Val.Type != NodeVar {
-		return argErr("search", "variable")
+	var ty ValType
+
+	switch arg.Val.Type {
+	case NodeVar:
+		ty = ValVar
+	case NodeStr:
+		ty = ValStr
+	default:
+		return argErr("search", "variable or string")
 	}
 
 	ex := expPool.Get().(*Exp)
 	ex.Reset()
 
 	ex.Op = OpTsQuery
-	ex.Type = ValVar
+	ex.Type = ty
 	ex.Val = arg.Val.Val
 
 	if sel.Args == nil {
 		sel.Args = make(map[string]*Node)
 	}
 
-	sel.Args[arg.Name] = arg.Val
-	arg.df = true
+	// the arg outlives the operation and its arena so it's
+	// copied into a node that's freed by the sql compiler
+	n := nodePool.Get().(*Node)
+	*n = *arg.Val
+	n.Parent = nil
+	n.Children = nil
+
+	sel.Args[arg.Name] = n
 	AddFilter(sel, ex)
 
 	return nil
@@ -717,14 +1271,31 @@ func (com *Compiler) compileArgWhere(sel *Select, arg *Arg, role string) error {
 }
 
 func (com *Compiler) compileArgOrderBy(sel *Select, arg *Arg) error {
-	if arg.Val.Type != NodeObj {
-		return fmt.Errorf("expecting an object")
+	var nodes []*Node
+
+	switch arg.Val.Type {
+	case NodeObj:
+		nodes = arg.Val.Children
+
+	// a list of objects (eg. [{ price: desc }, { id: asc }]) for
+	// clients that can't keep the order of the keys of an object
+	case NodeList:
+		for _, n := range arg.Val.Children {
+			if n.Type != NodeObj {
+				return fmt.Errorf("expecting a list of objects")
+			}
+			nodes = append(nodes, n.Children...)
+		}
+
+	default:
+		return fmt.Errorf("expecting an object or a list of objects")
 	}
 
 	st := util.NewStack()
 
-	for i := range arg.Val.Children {
-		st.Push(arg.Val.Children[i])
+	// pushed in reverse so the columns are ordered by in the order of the query
+	for i := len(nodes) - 1; i >= 0; i-- {
+		st.Push(nodes[i])
 	}
 
 	for {
@@ -739,24 +1310,34 @@ func (com *Compiler) compileArgOrderBy(sel *Select, arg *Arg) error {
 			return fmt.Errorf("17: unexpected value %v (%t)", intf, intf)
 		}
 
+		// the columns of related tables (eg. user: { name: asc })
+		if node.Type == NodeObj {
+			for i := len(node.Children) - 1; i >= 0; i-- {
+				st.Push(node.Children[i])
+			}
+			continue
+		}
+
 		if node.Type != NodeStr && node.Type != NodeVar {
 			return fmt.Errorf("expecting a string or variable")
 		}
 
 		ob := &OrderBy{}
 
-		switch node.Val {
-		case "asc":
+		switch {
+		case node.Type == NodeVar:
+			ob.Var = node.Val
+		case node.Val == "asc":
 			ob.Order = OrderAsc
-		case "desc":
+		case node.Val == "desc":
 			ob.Order = OrderDesc
-		case "asc_nulls_first":
+		case node.Val == "asc_nulls_first":
 			ob.Order = OrderAscNullsFirst
-		case "desc_nulls_first":
+		case node.Val == "desc_nulls_first":
 			ob.Order = OrderDescNullsFirst
-		case "asc_nulls_last":
+		case node.Val == "asc_nulls_last":
 			ob.Order = OrderAscNullsLast
-		case "desc_nulls_last":
+		case node.Val == "desc_nulls_last":
 			ob.Order = OrderDescNullsLast
 		default:
 			return fmt.Errorf("valid values include asc, desc, asc_nulls_first and desc_nulls_first")
@@ -786,14 +1367,91 @@ func (com *Compiler) compileArgDistinctOn(sel *Select, arg *Arg) error {
 	return nil
 }
 
-func (com *Compiler) compileArgLimit(sel *Select, arg *Arg) error {
+func (com *Compiler) compileArgGroupBy(sel *Select, arg *Arg) error {
 	node := arg.Val
 
-	if node.Type != NodeNum {
-		return argErr("limit", "number")
+	if node.Type != NodeList && node.Type != NodeStr {
+		return fmt.Errorf("expecting a list of strings or just a string")
 	}
 
-	sel.Paging.Limit = node.Val
+	if node.Type == NodeStr {
+		sel.GroupBy = append(sel.GroupBy, node.Val)
+	}
+
+	for i := range node.Children {
+		sel.GroupBy = append(sel.GroupBy, node.Children[i].Val)
+	}
+
+	return nil
+}
+
+func (com *Compiler) compileArgFuncArgs(sel *Select, arg *Arg) error {
+	node := arg.Val
+
+	if sel.Func == "" {
+		return fmt.Errorf("argument 'args' is only valid on functions: %s", sel.FieldName)
+	}
+
+	if node.Type != NodeObj {
+		return argErr("args", "object")
+	}
+
+	for _, n := range node.Children {
+		fa := FuncArg{Name: n.Name, Val: n.Val}
+
+		switch n.Type {
+		case NodeStr:
+			fa.Type = ValStr
+		case NodeNum:
+			fa.Type = ValNum
+		case NodeBool:
+			fa.Type = ValBool
+		case NodeVar:
+			fa.Type = ValVar
+		default:
+			return fmt.Errorf("value for function argument '%s' must be a string, number, boolean or variable", n.Name)
+		}
+
+		sel.FuncArgs = append(sel.FuncArgs, fa)
+	}
+
+	return nil
+}
+
+func (com *Compiler) compileArgFind(sel *Select, arg *Arg) error {
+	node := arg.Val
+
+	if sel.ParentID == -1 {
+		return fmt.Errorf("argument 'find' is only valid on a nested selection: %s", sel.FieldName)
+	}
+
+	if node.Type != NodeStr {
+		return argErr("find", "string")
+	}
+
+	switch node.Val {
+	case "children":
+		sel.Find = FindChildren
+	case "parents":
+		sel.Find = FindParents
+	default:
+		return fmt.Errorf("value for argument 'find' must be children or parents")
+	}
+
+	return nil
+}
+
+func (com *Compiler) compileArgLimit(sel *Select, arg *Arg) error {
+	node := arg.Val
+
+	switch node.Type {
+	case NodeNum:
+		sel.Paging.Limit = node.Val
+	case NodeVar:
+		com.setLimitVar(sel, node.Val)
+	default:
+		return argErr("limit", "number or variable")
+	}
 
 	return nil
 }
@@ -812,16 +1470,27 @@ func (com *Compiler) compileArgOffset(sel *Select, arg *Arg) error {
 func (com *Compiler) compileArgFirstLast(sel *Select, arg *Arg, pt PagingType) error {
 	node := arg.Val
 
-	if node.Type != NodeNum {
-		return argErr(arg.Name, "number")
+	switch node.Type {
+	case NodeNum:
+		sel.Paging.Limit = node.Val
+	case NodeVar:
+		com.setLimitVar(sel, node.Val)
+	default:
+		return argErr(arg.Name, "number or variable")
 	}
 
 	sel.Paging.Type = pt
-	sel.Paging.Limit = node.Val
 
 	return nil
 }
 
+// setLimitVar sets the limit from the variable, the value
+// is clamped to the max limit when the query is run
+func (com *Compiler) setLimitVar(sel *Select, name string) {
+	sel.Paging.LimitVar = name
+	sel.Paging.Limit = strconv.Itoa(com.maxLimit)
+}
+
 func (com *Compiler) compileArgAfterBefore(sel *Select, arg *Arg, pt PagingType) error {
 	node := arg.Val
 
@@ -844,6 +1513,13 @@ func (com *Compiler) getRole(role, field string) *trval {
 	return nil
 }
 
+// CompileFilter compiles a filter (eg. `{ deleted: { eq: false } }`)
+// so it can be added to a selection with AddFilter, the bool is true
+// when the filter needs the user id
+func CompileFilter(filter string) (*Exp, bool, error) {
+	return compileFilter([]string{filter})
+}
+
 func AddFilter(sel *Select, fil *Exp) {
 	if sel.Where != nil {
 		ow := sel.Where
@@ -865,6 +1541,20 @@ func AddFilter(sel *Select, fil *Exp) {
 	}
 }
 
+// expOps is the list of operators supported in a where expression
+var expOps = []string{
+	"and", "or", "not",
+	"eq", "equals", "neq", "not_equals",
+	"gt", "greater_than", "lt", "lesser_than",
+	"gte", "greater_or_equals", "lte", "lesser_or_equals",
+	"in", "nin", "not_in",
+	"like", "nlike", "not_like", "ilike", "nilike", "not_ilike",
+	"similar", "nsimilar", "not_similar",
+	"contains", "contained_in", "has_key", "has_key_any", "has_key_all",
+	"is_null", "null_eq", "ndis", "not_distinct", "null_neq", "dis", "distinct",
+	"between", "st_dwithin",
+}
+
 func newExp(st *util.Stack, node *Node, usePool bool) (*Exp, error) {
 	name := node.Name
 	if name[0] == '_' {
@@ -967,9 +1657,23 @@ func newExp(st *util.Stack, node *Node, usePool bool) (*Exp, error) {
 	case "null_neq", "dis", "distinct":
 		ex.Op = OpDistinct
 		ex.Val = node.Val
+	case "between":
+		ex.Op = OpBetween
+		setListVal(ex, node)
+		if node.Type == NodeList && len(ex.ListVal) != 2 {
+			return nil, errors.New("[Where] between: expecting a list of two values")
+		}
+	case "st_dwithin":
+		ex.Op = OpStDWithin
+		if err := setDWithinVal(ex, node); err != nil {
+			return nil, err
+		}
+		setWhereColName(ex, node)
+		return ex, nil
 	default:
 		if len(node.Children) == 0 {
-			return nil, fmt.Errorf("[Where] invalid operation: %s", name)
+			return nil, fmt.Errorf("[Where] invalid operation: %s, %s",
+				name, util.NotFoundMsg(name, expOps))
 		}
 		pushChildren(st, node.exp, node)
 		return nil, nil // skip node
@@ -1018,6 +1722,58 @@ func setListVal(ex *Exp, node *Node) {
 
 }
 
+// setDWithinVal sets the point and distance of the st_dwithin operator
+// (eg. { point: [-122.4, 37.7], distance: 1000 }), the point is in ListVal
+// as its coordinates or a variable with a GeoJSON geometry and the distance
+// is in Val
+func setDWithinVal(ex *Exp, node *Node) error {
+	if node.Type != NodeObj {
+		return errors.New("[Where] st_dwithin: expecting an object with a point and distance")
+	}
+
+	for _, n := range node.Children {
+		switch n.Name {
+		case "point":
+			switch {
+			case n.Type == NodeVar:
+				ex.ListType = ValVar
+				ex.ListVal = append(ex.ListVal, n.Val)
+
+			case n.Type == NodeList && len(n.Children) == 2:
+				ex.ListType = ValNum
+				for _, c := range n.Children {
+					if c.Type != NodeNum {
+						return errors.New("[Where] st_dwithin: point coordinates must be numbers")
+					}
+					ex.ListVal = append(ex.ListVal, c.Val)
+				}
+
+			default:
+				return errors.New("[Where] st_dwithin: point must be a list of two numbers or a variable")
+			}
+
+		case "distance":
+			switch n.Type {
+			case NodeNum:
+				ex.Type = ValNum
+			case NodeVar:
+				ex.Type = ValVar
+			default:
+				return errors.New("[Where] st_dwithin: distance must be a number or a variable")
+			}
+			ex.Val = n.Val
+
+		default:
+			return fmt.Errorf("[Where] st_dwithin: unknown argument: %s", n.Name)
+		}
+	}
+
+	if len(ex.ListVal) == 0 || ex.Type == 0 {
+		return errors.New("[Where] st_dwithin: point and distance are required")
+	}
+	return nil
+}
+
 func setWhereColName(ex *Exp, node *Node) {
 	var list []string
 
@@ -1195,6 +1951,24 @@ func (t ExpOp) String() string {
 	return fmt.Sprintf("<%s>", v)
 }
 
+// hasIDFilter returns true if the rows are filtered by the id argument
+func hasIDFilter(ex *Exp) bool {
+	if ex == nil {
+		return false
+	}
+	switch ex.Op {
+	case OpEqID:
+		return true
+	case OpAnd:
+		for _, v := range ex.Children {
+			if hasIDFilter(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func FreeExp(ex *Exp) {
 	if ex.doFree {
 		expPool.Put(ex)
@@ -1205,84 +1979,6 @@ func argErr(name, ty string) error {
 	return fmt.Errorf("value for argument '%s' must be a %s", name, ty)
 }
 
-func freeNodes(op *Operation) {
-	var st *util.Stack
-	fm := make(map[*Node]struct{})
-
-	for i := range op.Args {
-		arg := op.Args[i]
-		if arg.df {
-			continue
-		}
-
-		for i := range arg.Val.Children {
-			if st == nil {
-				st = util.NewStack()
-			}
-			c := arg.Val.Children[i]
-			if _, ok := fm[c]; !ok {
-				st.Push(c)
-			}
-		}
-
-		if _, ok := fm[arg.Val]; !ok {
-			nodePool.Put(arg.Val)
-			fm[arg.Val] = struct{}{}
-		}
-
-	}
-
-	for i := range op.Fields {
-		f := op.Fields[i]
-
-		for j := range f.Args {
-			arg := f.Args[j]
-			if arg.df {
-				continue
-			}
-
-			for k := range arg.Val.Children {
-				if st == nil {
-					st = util.NewStack()
-				}
-				c := arg.Val.Children[k]
-				if _, ok := fm[c]; !ok {
-					st.Push(c)
-				}
-			}
-
-			if _, ok := fm[arg.Val]; !ok {
-				nodePool.Put(arg.Val)
-				fm[arg.Val] = struct{}{}
-			}
-		}
-	}
-
-	if st == nil {
-		return
-	}
-
-	for {
-		if st.Len() == 0 {
-			break
-		}
-		intf := st.Pop()
-		node, ok := intf.(*Node)
-		if !ok || node == nil {
-			continue
-		}
-
-		for i := range node.Children {
-			st.Push(node.Children[i])
-		}
-
-		if _, ok := fm[node]; !ok {
-			nodePool.Put(node)
-			fm[node] = struct{}{}
-		}
-	}
-}
-
 func (ex *Exp) IsFromQuery() bool {
 	return !ex.internal
 }
@@ -0,0 +1,197 @@
+package qcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gobuffalo/flect"
+)
+
+// Connection struct is set on a selection that's returned as a Relay connection
+// (eg. `users(first: 10) { edges { cursor node { id } } pageInfo { endCursor } }`).
+// The rows are selected as usual from the fields in the node, the names below
+// are the field names the parts of the connection are returned as and are
+// empty when not selected.
+type Connection struct {
+	Edges           string
+	Node            string
+	Cursor          string
+	PageInfo        string
+	HasNextPage     string
+	HasPreviousPage string
+	StartCursor     string
+	EndCursor       string
+}
+
+// RowCursor is the field name of the column with the
+// cursor of the row added to a connection
+const RowCursor = "__cursor"
+
+const nodeParamPrefix = "__node."
+
+// WithRelay enables the Relay node root field and connections
+func WithRelay(enable bool) Option {
+	return func(com *Compiler) error {
+		com.relay = enable
+		return nil
+	}
+}
+
+// NodeParam returns the name of the param the value of a global id variable
+// is passed as when used as the id of a table
+func NodeParam(table, varName string) string {
+	return nodeParamPrefix + table + "." + varName
+}
+
+// ParseNodeParam returns the table and variable of a param named with NodeParam
+func ParseNodeParam(name string) (string, string, bool) {
+	if !strings.HasPrefix(name, nodeParamPrefix) {
+		return "", "", false
+	}
+
+	v := strings.SplitN(name[len(nodeParamPrefix):], ".", 2)
+	if len(v) != 2 {
+		return "", "", false
+	}
+	return v[0], v[1], true
+}
+
+// relayNodes turns each node root field into a root for every type in its
+// inline fragments (eg. `... on users`), only the one for the table in the
+// global id returns a row. The fields outside the fragments are added to each.
+func relayNodes(op *Operation) error {
+	for i := range op.Fields {
+		f := &op.Fields[i]
+
+		if f.ParentID != -1 || f.Name != "node" {
+			continue
+		}
+
+		if !f.Union {
+			return errors.New("node: expecting the fields in inline fragments (eg. ... on users)")
+		}
+
+		if !hasArg(f.Args, "id") {
+			return errors.New("node: argument 'id' is required")
+		}
+
+		name := f.Name
+		if f.Alias != "" {
+			name = f.Alias
+		}
+
+		var types, cols []int32
+
+		for _, cid := range f.Children {
+			if len(op.Fields[cid].Children) != 0 {
+				types = append(types, cid)
+			} else {
+				cols = append(cols, cid)
+			}
+		}
+
+		for _, cid := range types {
+			t := &op.Fields[cid]
+			t.ParentID = -1
+			t.Name = flect.Singularize(t.Name)
+			t.node = name
+			t.Children = append(t.Children[:len(t.Children):len(t.Children)], cols...)
+		}
+
+		// it's no longer a root
+		f.ParentID = -2
+	}
+
+	return nil
+}
+
+var connFields = map[string]string{
+	"edges":           "edges",
+	"node":            "node",
+	"cursor":          "cursor",
+	"pageinfo":        "pageInfo",
+	"hasnextpage":     "hasNextPage",
+	"haspreviouspage": "hasPreviousPage",
+	"startcursor":     "startCursor",
+	"endcursor":       "endCursor",
+}
+
+// connection returns the connection of a field with edges or pageInfo in
+// it and the fields of its node, the names are lowercased by the lexer so
+// the field names are the Relay ones unless there's an alias
+func connection(op *Operation, field *Field) (*Connection, []int32, error) {
+	var conn *Connection
+	var children []int32
+	var other string
+
+	fname := func(f *Field) string {
+		if f.Alias != "" {
+			return f.Alias
+		}
+		return connFields[f.Name]
+	}
+
+	for _, cid := range field.Children {
+		f := &op.Fields[cid]
+
+		switch f.Name {
+		case "edges", "pageinfo":
+			if conn == nil {
+				conn = &Connection{}
+			}
+		default:
+			other = f.Name
+			continue
+		}
+
+		if f.Name == "pageinfo" {
+			conn.PageInfo = fname(f)
+
+			for _, id := range f.Children {
+				p := &op.Fields[id]
+
+				switch p.Name {
+				case "hasnextpage":
+					conn.HasNextPage = fname(p)
+				case "haspreviouspage":
+					conn.HasPreviousPage = fname(p)
+				case "startcursor":
+					conn.StartCursor = fname(p)
+				case "endcursor":
+					conn.EndCursor = fname(p)
+				default:
+					return nil, nil, fmt.Errorf("%s: unknown field in pageInfo: %s", field.Name, p.Name)
+				}
+			}
+			continue
+		}
+
+		conn.Edges = fname(f)
+
+		for _, id := range f.Children {
+			e := &op.Fields[id]
+
+			switch e.Name {
+			case "cursor":
+				conn.Cursor = fname(e)
+			case "node":
+				conn.Node = fname(e)
+				children = e.Children
+			default:
+				return nil, nil, fmt.Errorf("%s: unknown field in edges: %s", field.Name, e.Name)
+			}
+		}
+	}
+
+	if conn == nil {
+		return nil, field.Children, nil
+	}
+
+	if other != "" {
+		return nil, nil, fmt.Errorf("%s: only edges and pageInfo can be selected on a connection, found: %s",
+			field.Name, other)
+	}
+
+	return conn, children, nil
+}
@@ -0,0 +1,153 @@
+package qcode
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/gobuffalo/flect"
+)
+
+// defaultLimit is the limit used by the sql compiler when a query
+// does not set one
+const defaultLimit = 20
+
+// RewriteConfig is a rule that changes matching queries before they are
+// compiled. Name, Table and Field are glob patterns (eg. `get_*`) matched
+// against the operation name, the table and the columns selected from it.
+// An empty pattern matches everything.
+type RewriteConfig struct {
+	Name  string
+	Table string
+	Field string
+
+	// Filter is added to the where clause (eg. `{ deleted: { eq: false } }`)
+	Filter string
+
+	// Limit caps the number of rows returned
+	Limit int
+
+	// View replaces the table with a view of the same shape, the
+	// relationships of the table are used to join it
+	View string
+}
+
+type rewrite struct {
+	RewriteConfig
+	fil   *Exp
+	nu    bool
+	limit string
+}
+
+// AddRewrite adds a rule that's applied to the table selections of
+// queries and subscriptions. Rules are applied in the order added.
+func (com *Compiler) AddRewrite(rc RewriteConfig) error {
+	var err error
+
+	for _, p := range []string{rc.Name, rc.Table, rc.Field} {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("rewrite: invalid pattern '%s'", p)
+		}
+	}
+
+	if rc.Limit < 0 {
+		return fmt.Errorf("rewrite: invalid limit %d", rc.Limit)
+	}
+
+	rw := rewrite{RewriteConfig: rc}
+
+	if rc.Filter != "" {
+		rw.fil, rw.nu, err = compileFilter([]string{rc.Filter})
+		if err != nil {
+			return fmt.Errorf("rewrite: %w", err)
+		}
+	}
+
+	if rc.Limit != 0 {
+		rw.limit = strconv.Itoa(rc.Limit)
+	}
+
+	com.rw = append(com.rw, rw)
+	return nil
+}
+
+func (com *Compiler) applyRewrites(sel *Select, opName, role string) {
+	for i := range com.rw {
+		rw := &com.rw[i]
+
+		if !rw.match(sel, opName) {
+			continue
+		}
+
+		if rw.fil != nil {
+			if rw.nu && role == "anon" {
+				sel.SkipRender = SkipTypeUserNeeded
+			}
+
+			switch rw.fil.Op {
+			case OpNop:
+			case OpFalse:
+				sel.Where = rw.fil
+			default:
+				AddFilter(sel, rw.fil)
+			}
+		}
+
+		if rw.limit != "" {
+			capLimit(sel, rw.Limit, rw.limit)
+		}
+
+		if rw.View != "" {
+			sel.View = rw.View
+		}
+	}
+}
+
+func (rw *rewrite) match(sel *Select, opName string) bool {
+	if rw.Name != "" && !globMatch(rw.Name, opName) {
+		return false
+	}
+
+	if rw.Table != "" &&
+		!globMatch(rw.Table, sel.Name) &&
+		!globMatch(rw.Table, flect.Pluralize(sel.Name)) {
+		return false
+	}
+
+	if rw.Field == "" {
+		return true
+	}
+
+	for _, col := range sel.Cols {
+		if globMatch(rw.Field, col.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CapLimit lowers the limit of the selection to max, a smaller
+// limit is left as is
+func CapLimit(sel *Select, max int) {
+	capLimit(sel, max, strconv.Itoa(max))
+}
+
+func capLimit(sel *Select, max int, limit string) {
+	switch {
+	case sel.Paging.Limit == "":
+		if sel.Paging.NoLimit || max < defaultLimit {
+			sel.Paging.Limit = limit
+		}
+
+	default:
+		if n, err := strconv.Atoi(sel.Paging.Limit); err != nil || n > max {
+			sel.Paging.Limit = limit
+		}
+	}
+}
+
+func globMatch(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
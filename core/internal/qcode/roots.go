@@ -0,0 +1,135 @@
+package qcode
+
+// RootField is a root field of a query and its location in it. Open and
+// Close are the offsets of the braces of its selection or -1 if it has none
+type RootField struct {
+	Name  string
+	Alias string
+	Start int
+	Open  int
+	Close int
+}
+
+// RootFields returns the root fields of the query with their location, the
+// root fields of a fragment are located in the fragment
+func RootFields(gql []byte) ([]RootField, error) {
+	op, err := Parse(gql)
+	if err != nil {
+		return nil, err
+	}
+	defer FreeOperation(op)
+
+	var rf []RootField
+
+	for i := range op.Fields {
+		f := &op.Fields[i]
+
+		if f.ParentID != -1 {
+			continue
+		}
+
+		open, close := selectionSpan(gql, int(f.pos))
+
+		rf = append(rf, RootField{
+			Name:  f.Name,
+			Alias: f.Alias,
+			Start: int(f.pos),
+			Open:  open,
+			Close: close,
+		})
+	}
+
+	return rf, nil
+}
+
+// selectionSpan returns the offsets of the braces of the selection of the
+// field at i, the alias, arguments and directives of the field are skipped
+func selectionSpan(b []byte, i int) (int, int) {
+	i = skipName(b, i)
+	i = skipIgnored(b, i)
+
+	if i < len(b) && b[i] == ':' {
+		i = skipName(b, skipIgnored(b, i+1))
+		i = skipIgnored(b, i)
+	}
+
+	if i < len(b) && b[i] == '(' {
+		i = skipIgnored(b, skipNested(b, i, '(', ')'))
+	}
+
+	for i < len(b) && b[i] == '@' {
+		i = skipIgnored(b, skipName(b, i+1))
+
+		if i < len(b) && b[i] == '(' {
+			i = skipIgnored(b, skipNested(b, i, '(', ')'))
+		}
+	}
+
+	if i >= len(b) || b[i] != '{' {
+		return -1, -1
+	}
+
+	end := skipNested(b, i, '{', '}')
+	if end > len(b) {
+		return -1, -1
+	}
+
+	return i, end - 1
+}
+
+func skipName(b []byte, i int) int {
+	for i < len(b) && isNameChar(b[i]) {
+		i++
+	}
+	return i
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// skipIgnored skips the whitespace, commas and comments
+func skipIgnored(b []byte, i int) int {
+	for i < len(b) {
+		switch b[i] {
+		case ' ', '\t', '\n', '\r', ',':
+			i++
+		case '#':
+			for i < len(b) && b[i] != '\n' {
+				i++
+			}
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipNested returns the offset after the close matching the open at i,
+// strings and comments are skipped. It's past the end if there is no match
+func skipNested(b []byte, i int, open, close byte) int {
+	depth := 0
+
+	for ; i < len(b); i++ {
+		switch c := b[i]; c {
+		case '"':
+			for i++; i < len(b) && b[i] != '"'; i++ {
+				if b[i] == '\\' {
+					i++
+				}
+			}
+		case '#':
+			for i < len(b) && b[i] != '\n' {
+				i++
+			}
+		case open:
+			depth++
+		case close:
+			if depth--; depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return len(b) + 1
+}
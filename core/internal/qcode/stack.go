@@ -13,6 +13,16 @@ func NewStack() *Stack {
 	return s
 }
 
+// Reset empties the Stack, the items grown past stA are kept
+func (s *Stack) Reset() {
+	s.top = -1
+	if cap(s.st) > len(s.stA) {
+		s.st = s.st[:0]
+	} else {
+		s.st = s.stA[:0]
+	}
+}
+
 // Return the number of items in the Stack
 func (s *Stack) Len() int {
 	return (s.top + 1)
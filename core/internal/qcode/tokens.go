@@ -0,0 +1,175 @@
+package qcode
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// TokenType is the type of a token of a query
+type TokenType string
+
+const (
+	TokenName       TokenType = "name"
+	TokenKeyword    TokenType = "keyword"
+	TokenPunctuator TokenType = "punctuator"
+	TokenVariable   TokenType = "variable"
+	TokenDirective  TokenType = "directive"
+	TokenSpread     TokenType = "spread"
+	TokenNumber     TokenType = "number"
+	TokenString     TokenType = "string"
+	TokenBoolean    TokenType = "boolean"
+	TokenComment    TokenType = "comment"
+)
+
+// Token is a token of a query, Start and End are its byte offsets in the
+// query. The $ of variables, @ of directives and quotes of strings are
+// part of the token so the query can be rebuilt from the tokens and the
+// whitespace and commas between them
+type Token struct {
+	Type     TokenType `json:"type"`
+	Value    string    `json:"value"`
+	Start    int       `json:"start"`
+	End      int       `json:"end"`
+	Location Location  `json:"location"`
+}
+
+// Tokens returns the tokens of the query as scanned by the lexer for tools
+// like formatters and syntax highlighters. On an error the tokens before it
+// are returned with the error
+func Tokens(query []byte) ([]Token, error) {
+	if len(query) == 0 {
+		return nil, nil
+	}
+
+	// the lexer lowercases keywords and variables in place
+	in := make([]byte, len(query))
+	copy(in, query)
+
+	var l lexer
+	l.input = in
+	l.items = l.itemsA[:0]
+	l.line = 1
+	l.run()
+
+	var toks []Token
+	var err error
+
+	tl := tokenLoc{query: query, loc: Location{Line: 1, Column: 1}}
+	last := 0
+
+	for _, it := range l.items {
+		if it._type == itemError {
+			err = syntaxErr(errAt(query, it.pos, l.err), true)
+			break
+		}
+
+		start, end := int(it.pos), int(it.pos)+len(it.val)
+		typ := tokenType(it._type)
+
+		switch it._type {
+		case itemVariable, itemDirective:
+			start--
+
+		case itemStringVal:
+			start--
+			end++
+
+		case itemEOF:
+			// a name or unterminated string at the end of the query
+			if len(it.val) == 0 {
+				break
+			}
+			if start != 0 && (query[start-1] == '"' || query[start-1] == '\'') {
+				start--
+				typ = TokenString
+			} else {
+				typ = tokenType(keyword(it.val))
+			}
+		}
+
+		if typ == "" {
+			continue
+		}
+
+		toks = tl.comments(toks, last, start)
+		toks = append(toks, tl.token(typ, start, end))
+		last = end
+	}
+
+	if err == nil {
+		toks = tl.comments(toks, last, len(query))
+	}
+
+	return toks, err
+}
+
+// tokenLoc finds the locations of the tokens going through the query once
+type tokenLoc struct {
+	query []byte
+	pos   int
+	loc   Location
+}
+
+func (tl *tokenLoc) token(typ TokenType, start, end int) Token {
+	q := tl.query[tl.pos:start]
+
+	if n := bytes.LastIndexByte(q, '\n'); n != -1 {
+		tl.loc.Line += bytes.Count(q, []byte{'\n'})
+		tl.loc.Column = utf8.RuneCount(q[n+1:]) + 1
+	} else {
+		tl.loc.Column += utf8.RuneCount(q)
+	}
+	tl.pos = start
+
+	return Token{
+		Type:     typ,
+		Value:    string(tl.query[start:end]),
+		Start:    start,
+		End:      end,
+		Location: tl.loc,
+	}
+}
+
+// comments adds the comments between the tokens, they are not scanned
+// by the lexer and only whitespace and commas can be next to them
+func (tl *tokenLoc) comments(toks []Token, start, end int) []Token {
+	q := tl.query
+
+	for i := start; i < end; i++ {
+		if q[i] != '#' {
+			continue
+		}
+		j := i
+		for j < end && q[j] != '\n' && q[j] != '\r' {
+			j++
+		}
+		toks = append(toks, tl.token(TokenComment, i, j))
+		i = j
+	}
+	return toks
+}
+
+func tokenType(t itemType) TokenType {
+	switch t {
+	case itemName:
+		return TokenName
+	case itemQuery, itemMutation, itemFragment, itemSub, itemOn:
+		return TokenKeyword
+	case itemPunctuator, itemArgsOpen, itemArgsClose, itemListOpen, itemListClose,
+		itemObjOpen, itemObjClose, itemColon, itemEquals:
+		return TokenPunctuator
+	case itemVariable:
+		return TokenVariable
+	case itemDirective:
+		return TokenDirective
+	case itemSpread:
+		return TokenSpread
+	case itemNumberVal:
+		return TokenNumber
+	case itemStringVal:
+		return TokenString
+	case itemBoolVal:
+		return TokenBoolean
+	}
+	return ""
+}
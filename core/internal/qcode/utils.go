@@ -1,5 +1,7 @@
 package qcode
 
+import "strings"
+
 func GetQType(gql string) QType {
 	ic := false
 	for i := range gql {
@@ -49,3 +51,26 @@ func (qt QType) String() string {
 
 	return ""
 }
+
+// IsIntrospection returns true if the root fields of the query are all
+// introspection fields (eg. __schema, __type)
+func IsIntrospection(gql string) bool {
+	op, err := Parse([]byte(gql))
+	if err != nil {
+		return false
+	}
+	defer FreeOperation(op)
+
+	n := 0
+	for _, f := range op.Fields {
+		if f.ParentID != -1 {
+			continue
+		}
+		if !strings.HasPrefix(f.Name, "__") {
+			return false
+		}
+		n++
+	}
+
+	return n != 0
+}
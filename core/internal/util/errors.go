@@ -0,0 +1,66 @@
+package util
+
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultMaxErrors is the number of errors collected
+// from a query before giving up on it
+const DefaultMaxErrors = 10
+
+// Errors are the errors found in a query, they are returned together
+// so they can all be fixed at once
+type Errors []error
+
+func (e Errors) Error() string {
+	var sb strings.Builder
+
+	for i, err := range e {
+		if i != 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+// Is returns true if any of the errors is the target (errors.Is)
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As sets the target to the first of the errors that
+// matches it (errors.As)
+func (e Errors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds the error to the list, it returns false once
+// the list has the max number of errors
+func (e *Errors) Add(err error, max int) bool {
+	*e = append(*e, err)
+	return len(*e) < max
+}
+
+// Err returns nil for an empty list and the error
+// as is for a list of one
+func (e Errors) Err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Suggest returns the option closest to name by edit distance or an empty
+// string if none of the options are close enough to be a likely typo.
+func Suggest(name string, options []string) string {
+	var match string
+
+	max := len(name) / 3
+	if max < 2 {
+		max = 2
+	}
+	min := max + 1
+
+	for _, o := range options {
+		if d := editDistance(name, o); d < min {
+			match, min = o, d
+		}
+	}
+	return match
+}
+
+// NotFoundMsg returns a message listing the valid options with a
+// did-you-mean suggestion (eg. "did you mean 'email'? (valid: id, email)")
+func NotFoundMsg(name string, options []string) string {
+	var sb strings.Builder
+
+	if s := Suggest(name, options); s != "" {
+		fmt.Fprintf(&sb, "did you mean '%s'? ", s)
+	}
+	fmt.Fprintf(&sb, "(valid: %s)", strings.Join(options, ", "))
+
+	return sb.String()
+}
+
+// editDistance computes the levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(v ...int) int {
+	m := v[0]
+	for _, n := range v[1:] {
+		if n < m {
+			m = n
+		}
+	}
+	return m
+}
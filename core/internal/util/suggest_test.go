@@ -0,0 +1,23 @@
+package util
+
+import "testing"
+
+func TestSuggest(t *testing.T) {
+	opts := []string{"id", "email", "full_name", "created_at"}
+
+	tests := []struct {
+		name string
+		exp  string
+	}{
+		{"emial", "email"},
+		{"ful_name", "full_name"},
+		{"creatd_at", "created_at"},
+		{"price", ""},
+	}
+
+	for _, tt := range tests {
+		if v := Suggest(tt.name, opts); v != tt.exp {
+			t.Errorf("%s: expected '%s' got '%s'", tt.name, tt.exp, v)
+		}
+	}
+}
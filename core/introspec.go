@@ -1,12 +1,14 @@
 package core
 
 import (
+	"sort"
 	"strings"
 
 	"github.com/chirino/graphql"
 	"github.com/chirino/graphql/resolvers"
 	"github.com/chirino/graphql/schema"
 	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
 )
 
 var typeMap map[string]string = map[string]string{
@@ -24,17 +26,165 @@ var typeMap map[string]string = map[string]string{
 	"boolean":          "Boolean",
 }
 
+// introspectionQuery is the standard introspection query used by GraphQL
+// tools to read the schema
+const introspectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types { ...FullType }
+    directives {
+      name
+      description
+      locations
+      args { ...InputValue }
+    }
+  }
+}
+
+fragment FullType on __Type {
+  kind
+  name
+  description
+  fields(includeDeprecated: true) {
+    name
+    description
+    args { ...InputValue }
+    type { ...TypeRef }
+    isDeprecated
+    deprecationReason
+  }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) {
+    name
+    description
+    isDeprecated
+    deprecationReason
+  }
+  possibleTypes { ...TypeRef }
+}
+
+fragment InputValue on __InputValue {
+  name
+  description
+  type { ...TypeRef }
+  defaultValue
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType {
+    kind
+    name
+    ofType {
+      kind
+      name
+      ofType {
+        kind
+        name
+        ofType {
+          kind
+          name
+        }
+      }
+    }
+  }
+}`
+
+// gqlEngines are the introspection engines built from the same database schema
+type gqlEngines struct {
+	all   *graphql.Engine
+	roles map[string]*graphql.Engine
+}
+
+// initGraphQLEgine creates the engine used for introspection queries. Each role
+// gets it's own engine with only the tables, columns and mutations it can use.
 func (sg *SuperGraph) initGraphQLEgine() error {
+	ge, err := sg.newGraphQLEngines(sg.pc.Schema())
+	if err != nil {
+		return err
+	}
+	sg.engines.Store(ge)
+
+	return nil
+}
+
+func (sg *SuperGraph) newGraphQLEngines(dbSchema *psql.DBSchema) (*gqlEngines, error) {
+	var err error
+	ge := &gqlEngines{roles: make(map[string]*graphql.Engine, len(sg.roles))}
+
+	if ge.all, err = sg.newGraphQLEngine(dbSchema, nil); err != nil {
+		return nil, err
+	}
+
+	for name, ro := range sg.roles {
+		if ge.roles[name], err = sg.newGraphQLEngine(dbSchema, ro); err != nil {
+			return nil, err
+		}
+	}
+
+	return ge, nil
+}
+
+// introspectionEngine returns the engine for the role, an unknown role
+// gets the one of the anon role and never the full schema
+func (sg *SuperGraph) introspectionEngine(role string) *graphql.Engine {
+	ge := sg.engines.Load().(*gqlEngines)
+
+	if e, ok := ge.roles[role]; ok {
+		return e
+	}
+	return ge.roles["anon"]
+}
+
+// schemaEngine returns the engine with all the tables, it's only
+// used for the schema exports and never for queries
+func (sg *SuperGraph) schemaEngine() *graphql.Engine {
+	return sg.engines.Load().(*gqlEngines).all
+}
+
+// newGraphQLEngine creates an engine with the schema of the tables the role
+// can access. A nil role includes all tables.
+func (sg *SuperGraph) newGraphQLEngine(dbSchema *psql.DBSchema, ro *Role) (*graphql.Engine, error) {
 	engine := graphql.New()
 	engineSchema := engine.Schema
-	dbSchema := sg.schema
 
 	if err := engineSchema.Parse(`enum OrderDirection { asc desc }`); err != nil {
-		return err
+		return nil, err
+	}
+
+	// enums with values that are not valid names are left as strings
+	enums := make(map[string]struct{})
+
+	for _, e := range dbSchema.GetEnums() {
+		et := &schema.Enum{Name: e.Name}
+
+		for _, v := range e.Values {
+			if !isGraphQLName(v) {
+				et = nil
+				break
+			}
+			et.Values = append(et.Values, &schema.EnumValue{Name: v})
+		}
+
+		if et == nil || !isGraphQLName(e.Name) {
+			continue
+		}
+		if _, ok := engineSchema.Types[e.Name]; ok {
+			continue
+		}
+		engineSchema.Types[e.Name] = et
+		enums[e.Name] = struct{}{}
 	}
 
 	gqltype := func(col psql.DBColumn) schema.Type {
 		typeName := typeMap[strings.ToLower(col.Type)]
+		if _, ok := enums[col.Type]; ok {
+			typeName = col.Type
+		}
 		if typeName == "" {
 			typeName = "String"
 		}
@@ -60,14 +210,42 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 
 	//validGraphQLIdentifierRegex := regexp.MustCompile(`^[A-Za-z_][A-Za-z_0-9]*$`)
 
+	// the tables in a namespace are fields of an object type of the
+	// namespace (eg. billingQuery) that's a field of the root type
+	nsRoot := func(root *schema.Object, table string) *schema.Object {
+		ns, ok := sg.nsTables[table]
+		if !ok {
+			return root
+		}
+
+		name := ns.Name + root.Name
+		if t, ok := engineSchema.Types[name]; ok {
+			return t.(*schema.Object)
+		}
+
+		o := &schema.Object{Name: name, Fields: schema.FieldList{}}
+		engineSchema.Types[name] = o
+
+		root.Fields = append(root.Fields, &schema.Field{
+			Name: ns.Name,
+			Type: &schema.NonNull{OfType: &schema.TypeName{Name: name}},
+		})
+		return o
+	}
+
 	scalarExpressionTypesNeeded := map[string]bool{}
 	tableNames := dbSchema.GetTableNames()
 	funcs := dbSchema.GetFunctions()
 
+	// the output types and arguments of the tables by table name used
+	// to add the related tables to the output types
+	outputTypes := make(map[string]*schema.Object)
+	tableArgs := make(map[string]schema.InputValueList)
+
 	for _, table := range tableNames {
 		ti, err := dbSchema.GetTableInfo(table)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if ti.Blocked {
 			continue
@@ -76,6 +254,15 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 			continue
 		}
 
+		ta := sg.tableAccess(ro, ti.Name)
+		if !ta.query && !ta.insert && !ta.update {
+			continue
+		}
+
+		if ns, ok := sg.nsTables[ti.Name]; ok && !nsAllowed(ns, ro) {
+			continue
+		}
+
 		singularName := ti.Singular
 		// if !validGraphQLIdentifierRegex.MatchString(singularName) {
 		// 	return errors.New("table name is not a valid GraphQL identifier: " + singularName)
@@ -88,6 +275,7 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 		outputType := &schema.Object{
 			Name:   singularName + "Output",
 			Fields: schema.FieldList{},
+			Desc:   schema.Description{Text: ti.Comment},
 		}
 		engineSchema.Types[outputType.Name] = outputType
 
@@ -123,11 +311,56 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 		}
 		engineSchema.Types[expressionType.Name] = expressionType
 
+		// computed fields are only returned, they can't be set or filtered on
+		for _, name := range computedNames(sg.computed[ti.Name]) {
+			cf := sg.computed[ti.Name][name]
+			ok := ta.query
+
+			for _, cn := range cf.Requires {
+				ok = ok && colAllowed(ta.qcols, cn)
+			}
+			if !ok {
+				continue
+			}
+
+			t := cf.Type
+			if t == "" {
+				t = "String"
+			}
+			outputType.Fields = append(outputType.Fields, &schema.Field{
+				Name: name,
+				Type: &schema.TypeName{Name: t},
+			})
+		}
+
+		for _, name := range cachedNames(sg.cachedFields[ti.Name]) {
+			if !ta.query || !colAllowed(ta.qcols, name) {
+				continue
+			}
+
+			t := sg.cachedFields[ti.Name][name].Type
+			if t == "" {
+				t = "String"
+			}
+			outputType.Fields = append(outputType.Fields, &schema.Field{
+				Name: name,
+				Type: &schema.TypeName{Name: t},
+			})
+		}
+
 		for _, col := range ti.Columns {
 			colName := col.Name
 			if col.Blocked {
 				continue
 			}
+
+			queryCol := ta.query && colAllowed(ta.qcols, colName)
+			inputCol := !col.ReadOnly() && ((ta.insert && colAllowed(ta.icols, colName)) ||
+				(ta.update && colAllowed(ta.ucols, colName)))
+
+			if !queryCol && !inputCol {
+				continue
+			}
 			// if !validGraphQLIdentifierRegex.MatchString(colName) {
 			// 	return errors.New("column name is not a valid GraphQL identifier: " + colName)
 			// }
@@ -140,13 +373,26 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 				nullableColType = colType.(*schema.TypeName).Name
 			}
 
+			if inputCol {
+				inputType.Fields = append(inputType.Fields, &schema.InputValue{
+					Name: colName,
+					Type: colType,
+					Desc: schema.Description{Text: col.Comment},
+				})
+			}
+
+			if !queryCol {
+				continue
+			}
+
 			outputType.Fields = append(outputType.Fields, &schema.Field{
 				Name: colName,
 				Type: colType,
+				Desc: schema.Description{Text: col.Comment},
 			})
 
 			for _, f := range funcs {
-				if col.Type != f.Params[0].Type {
+				if !ta.funcs || col.Type != f.Params[0].Type {
 					continue
 				}
 				outputType.Fields = append(outputType.Fields, &schema.Field{
@@ -156,7 +402,7 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 			}
 
 			// If it's a numeric type...
-			if nullableColType == "Float" || nullableColType == "Int" {
+			if ta.funcs && (nullableColType == "Float" || nullableColType == "Int") {
 				outputType.Fields = append(outputType.Fields, &schema.Field{
 					Name: "avg_" + colName,
 					Type: colType,
@@ -199,10 +445,6 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 				})
 			}
 
-			inputType.Fields = append(inputType.Fields, &schema.InputValue{
-				Name: colName,
-				Type: colType,
-			})
 			orderByType.Fields = append(orderByType.Fields, &schema.InputValue{
 				Name: colName,
 				Type: &schema.NonNull{OfType: &schema.TypeName{Name: "OrderDirection"}},
@@ -216,6 +458,16 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 			})
 		}
 
+		// true when the role can update or delete the row
+		if ta.query {
+			for _, name := range []string{qcode.CanUpdate, qcode.CanDelete} {
+				outputType.Fields = append(outputType.Fields, &schema.Field{
+					Name: name,
+					Type: &schema.NonNull{OfType: &schema.TypeName{Name: "Boolean"}},
+				})
+			}
+		}
+
 		outputTypeName := &schema.TypeName{Name: outputType.Name}
 		inputTypeName := &schema.TypeName{Name: inputType.Name}
 		pluralOutputTypeName := &schema.NonNull{OfType: &schema.List{OfType: &schema.NonNull{OfType: &schema.TypeName{Name: outputType.Name}}}}
@@ -225,7 +477,7 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 			&schema.InputValue{
 				Desc: schema.Description{Text: "To sort or ordering results just use the order_by argument. This can be combined with where, search, etc to build complex queries to fit your needs."},
 				Name: "order_by",
-				Type: &schema.NonNull{OfType: &schema.TypeName{Name: orderByType.Name}},
+				Type: &schema.NonNull{OfType: &schema.List{OfType: &schema.NonNull{OfType: &schema.TypeName{Name: orderByType.Name}}}},
 			},
 			&schema.InputValue{
 				Desc: schema.Description{Text: ""},
@@ -275,7 +527,7 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 			})
 		}
 
-		if ti.TSVCol != nil {
+		if ti.HasSearch() {
 			args = append(args, &schema.InputValue{
 				Desc: schema.Description{Text: "Performs full text search using a TSV index"},
 				Name: "search",
@@ -283,37 +535,57 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 			})
 		}
 
-		query.Fields = append(query.Fields, &schema.Field{
-			Desc: schema.Description{Text: ""},
-			Name: singularName,
-			Type: outputTypeName,
-			Args: args,
-		})
-		query.Fields = append(query.Fields, &schema.Field{
-			Desc: schema.Description{Text: ""},
-			Name: pluralName,
-			Type: pluralOutputTypeName,
-			Args: args,
-		})
+		if ta.query {
+			query := nsRoot(query, ti.Name)
 
-		mutationArgs := append(args, schema.InputValueList{
-			&schema.InputValue{
+			query.Fields = append(query.Fields, &schema.Field{
+				Desc: schema.Description{Text: ti.Comment},
+				Name: singularName,
+				Type: outputTypeName,
+				Args: args,
+			})
+			query.Fields = append(query.Fields, &schema.Field{
+				Desc: schema.Description{Text: ti.Comment},
+				Name: pluralName,
+				Type: pluralOutputTypeName,
+				Args: args,
+			})
+
+			outputTypes[ti.Name] = outputType
+			tableArgs[ti.Name] = args
+		}
+
+		if !ta.insert && !ta.update {
+			continue
+		}
+
+		var mutationArgs, pluralMutationArgs schema.InputValueList
+		mutationArgs = append(mutationArgs, args...)
+
+		for _, a := range []struct {
+			name, plural string
+			ok           bool
+		}{
+			{"insert", "inserts", ta.insert},
+			{"update", "updates", ta.update},
+			{"upsert", "upserts", ta.insert && ta.update},
+		} {
+			if !a.ok {
+				continue
+			}
+			mutationArgs = append(mutationArgs, &schema.InputValue{
 				Desc: schema.Description{Text: ""},
-				Name: "insert",
+				Name: a.name,
 				Type: inputTypeName,
-			},
-			&schema.InputValue{
+			})
+			pluralMutationArgs = append(pluralMutationArgs, &schema.InputValue{
 				Desc: schema.Description{Text: ""},
-				Name: "update",
-				Type: inputTypeName,
-			},
+				Name: a.plural,
+				Type: pluralInputTypeName,
+			})
+		}
 
-			&schema.InputValue{
-				Desc: schema.Description{Text: ""},
-				Name: "upsert",
-				Type: inputTypeName,
-			},
-		}...)
+		mutation := nsRoot(mutation, ti.Name)
 
 		mutation.Fields = append(mutation.Fields, &schema.Field{
 			Name: singularName,
@@ -322,27 +594,92 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 		})
 		mutation.Fields = append(mutation.Fields, &schema.Field{
 			Name: pluralName,
-			Args: append(mutationArgs, schema.InputValueList{
-				&schema.InputValue{
-					Desc: schema.Description{Text: ""},
-					Name: "inserts",
-					Type: pluralInputTypeName,
-				},
-				&schema.InputValue{
-					Desc: schema.Description{Text: ""},
-					Name: "updates",
-					Type: pluralInputTypeName,
-				},
-				&schema.InputValue{
-					Desc: schema.Description{Text: ""},
-					Name: "upserts",
-					Type: pluralInputTypeName,
-				},
-			}...),
+			Args: append(mutationArgs[:len(mutationArgs):len(mutationArgs)], pluralMutationArgs...),
 			Type: outputType,
 		})
 	}
 
+	// functions returning rows of a table the role can query are root
+	// fields with the arguments of the table and the function
+	for _, f := range dbSchema.GetTableFunctions() {
+		ti, err := dbSchema.GetTableInfo(f.Table)
+		if err != nil {
+			continue
+		}
+
+		outputType, ok := outputTypes[ti.Name]
+		if !ok {
+			continue
+		}
+
+		argsType := &schema.InputObject{
+			Name:   f.Name + "Args",
+			Fields: schema.InputValueList{},
+		}
+		engineSchema.Types[argsType.Name] = argsType
+
+		for _, p := range f.Params {
+			argsType.Fields = append(argsType.Fields, &schema.InputValue{
+				Name: p.Name.String,
+				Type: gqltype(psql.DBColumn{Name: p.Name.String, Type: p.Type}),
+			})
+		}
+
+		var t schema.Type = &schema.TypeName{Name: outputType.Name}
+		if f.SetOf {
+			t = &schema.NonNull{OfType: &schema.List{OfType: &schema.NonNull{OfType: t}}}
+		}
+
+		args := tableArgs[ti.Name]
+		query.Fields = append(query.Fields, &schema.Field{
+			Name: f.Name,
+			Type: t,
+			Args: append(args[:len(args):len(args)], &schema.InputValue{
+				Desc: schema.Description{Text: "The arguments of the function"},
+				Name: "args",
+				Type: &schema.TypeName{Name: argsType.Name},
+			}),
+		})
+	}
+
+	// related tables the role can query are fields of the output types,
+	// the singular name returns one row and the plural a list
+	for table, outputType := range outputTypes {
+		related := dbSchema.GetRelatedTables(table)
+		sort.Strings(related)
+
+	next:
+		for _, name := range related {
+			ti, err := dbSchema.GetTableInfo(name)
+			if err != nil {
+				continue
+			}
+
+			rt, ok := outputTypes[ti.Name]
+			if !ok {
+				continue
+			}
+
+			for _, f := range outputType.Fields {
+				if f.Name == name {
+					continue next
+				}
+			}
+
+			var t schema.Type = &schema.TypeName{Name: rt.Name}
+			if !ti.IsSingular {
+				t = &schema.NonNull{OfType: &schema.List{OfType: &schema.NonNull{OfType: t}}}
+			}
+
+			outputType.Fields = append(outputType.Fields, &schema.Field{
+				Desc: schema.Description{Text: ti.Comment},
+				Name: name,
+				Type: t,
+				Args: tableArgs[ti.Name],
+			})
+		}
+	}
+
 	for typeName := range scalarExpressionTypesNeeded {
 		expressionType := &schema.InputObject{
 			Name: typeName + "Expression",
@@ -395,6 +732,10 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 					Name: "lesser_or_equals",
 					Type: &schema.NonNull{OfType: &schema.TypeName{Name: typeName}},
 				},
+				&schema.InputValue{
+					Name: "between",
+					Type: &schema.NonNull{OfType: &schema.List{OfType: &schema.NonNull{OfType: &schema.TypeName{Name: typeName}}}},
+				},
 				&schema.InputValue{
 					Name: "in",
 					Type: &schema.NonNull{OfType: &schema.List{OfType: &schema.NonNull{OfType: &schema.TypeName{Name: typeName}}}},
@@ -474,7 +815,7 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 	}
 
 	if err := engineSchema.ResolveTypes(); err != nil {
-		return err
+		return nil, err
 	}
 
 	engine.Resolver = resolvers.Func(func(request *resolvers.ResolveRequest, next resolvers.Resolution) resolvers.Resolution {
@@ -490,6 +831,92 @@ func (sg *SuperGraph) initGraphQLEgine() error {
 		return nil
 	})
 
-	sg.ge = engine
-	return nil
+	return engine, nil
+}
+
+// tableAccess struct defines what a role can do with a table. Empty column
+// lists allow all columns.
+type tableAccess struct {
+	query, insert, update bool
+	delete, funcs         bool
+	qcols, icols, ucols   []string
+}
+
+// tableAccess returns what the role can do with the table using the same
+// rules as the query compiler. A nil role has full access.
+func (sg *SuperGraph) tableAccess(ro *Role, table string) tableAccess {
+	ta := sg.roleTableAccess(ro, table)
+
+	// mutations are rejected for every role in read only mode
+	if sg.conf.ReadOnly {
+		ta.insert, ta.update, ta.delete = false, false, false
+	}
+	return ta
+}
+
+func (sg *SuperGraph) roleTableAccess(ro *Role, table string) tableAccess {
+	all := tableAccess{query: true, insert: true, update: true, delete: true, funcs: true}
+
+	if ro == nil {
+		return all
+	}
+
+	anonBlock := sg.conf.DefaultBlock && ro.Name == "anon"
+	rt := ro.GetTable(table)
+
+	if rt == nil {
+		if anonBlock {
+			return tableAccess{}
+		}
+		return all
+	}
+
+	ro1 := rt.ReadOnly || anonBlock
+	ta := tableAccess{query: true, insert: !ro1, update: !ro1, delete: !ro1, funcs: true}
+
+	if rt.Query != nil {
+		ta.query = !rt.Query.Block
+		ta.funcs = !rt.Query.DisableFunctions
+		ta.qcols = rt.Query.Columns
+	}
+
+	if rt.Insert != nil {
+		ta.insert = !rt.Insert.Block
+		ta.icols = rt.Insert.Columns
+	}
+
+	if rt.Update != nil {
+		ta.update = !rt.Update.Block
+		ta.ucols = rt.Update.Columns
+	}
+
+	if rt.Delete != nil {
+		ta.delete = !rt.Delete.Block
+	}
+
+	return ta
+}
+
+// isGraphQLName returns true if the name can be used as a
+// type or enum value in the schema
+func isGraphQLName(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i != 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func colAllowed(cols []string, name string) bool {
+	return len(cols) == 0 || inList(cols, name)
 }
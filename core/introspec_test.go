@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestRoleIntrospection(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{DefaultBlock: true}
+
+	err = conf.AddRoleTable("anon", "products", Query{Columns: []string{"id", "name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := `query IntrospectionQuery {
+		__schema { queryType { fields { name } } mutationType { fields { name } } }
+		__schema { types { name fields { name } } }
+	}`
+
+	res, err := sg.GraphQL(context.Background(), query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := string(res.Data)
+
+	if !strings.Contains(data, `"products"`) {
+		t.Fatalf("expected the products table: %s", data)
+	}
+
+	if !strings.Contains(data, `"search_products"`) || !strings.Contains(data, `"search_productsArgs"`) {
+		t.Fatalf("expected the search_products function: %s", data)
+	}
+
+	for _, v := range []string{`"users"`, `"price"`, `"mutationType":{"fields":[{`} {
+		if strings.Contains(data, v) {
+			t.Fatalf("unexpected %s for the anon role: %s", v, data)
+		}
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	res, err = sg.GraphQL(ct, query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(res.Data), `"users"`) {
+		t.Fatalf("expected the users table for the user role: %s", res.Data)
+	}
+
+	// an unknown role gets the schema of the anon role
+	if s := sg.introspectionEngine("admin").Schema.String(); strings.Contains(s, "users") {
+		t.Fatalf("unexpected users table for an unknown role: %s", s)
+	}
+}
+
+func TestIntrospectionSchema(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := `{ __type(name: "userOutput") { description fields { name description } } }`
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	res, err := sg.GraphQL(ct, query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := string(res.Data)
+
+	exp := []string{
+		`"description":"People with an account"`,
+		`{"name":"email","description":"Used to sign in"}`,
+		`{"name":"products","description":null}`,
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(data, v) {
+			t.Fatalf("expected %s: %s", v, data)
+		}
+	}
+}
+
+func TestGraphQLSchemaJSON(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := sg.GraphQLSchemaJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{`"__schema"`, `"name":"userOutput"`, `"kind":"NON_NULL"`} {
+		if !strings.Contains(string(b), v) {
+			t.Fatalf("expected %s: %s", v, b)
+		}
+	}
+}
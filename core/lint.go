@@ -0,0 +1,241 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// Builtin lint rules, they can be turned off with lint_skip
+const (
+	// LintUnboundedList warns of lists with no limit set in the query,
+	// the role or a rewrite (the default limit is used)
+	LintUnboundedList = "unbounded_list"
+
+	// LintOffsetPaging warns of lists paged with an offset, cursors
+	// are faster and don't skip or repeat rows as rows are added
+	LintOffsetPaging = "offset_paging"
+
+	// LintRequireTypename warns of tables selected without __typename
+	// which clients like Apollo need to normalize their cache
+	LintRequireTypename = "require_typename"
+
+	// LintAllColumns warns of tables selected with every column the
+	// role can select, the select-star of GraphQL
+	LintAllColumns = "all_columns"
+)
+
+// LintRule is a check run on each table selected in a query. Lint returns
+// the issue found with the selection or an empty string if there's none
+type LintRule interface {
+	Name() string
+	Lint(op OpType, sel *LintSelect) string
+}
+
+// LintSelect struct is a table selected in a query as seen by the lint rules
+type LintSelect struct {
+	// Field is the name of the field (or alias) in the query and
+	// Table the name of the table selected
+	Field string
+	Table string
+
+	// Root is true for the tables at the root of the query
+	// and List for the ones that return a list of rows
+	Root bool
+	List bool
+
+	// Columns are the columns selected and TableColumns all the
+	// columns of the table the role can select
+	Columns      []string
+	TableColumns []string
+
+	// Limit is the limit of the rows, empty when not set
+	// and Offset is true if the rows are paged with an offset
+	Limit  string
+	Offset bool
+}
+
+// LintIssue struct is an issue found in a query by a lint rule
+type LintIssue struct {
+	Rule    string
+	Field   string
+	Message string
+}
+
+func (li LintIssue) String() string {
+	return fmt.Sprintf("%s: %s (%s)", li.Field, li.Message, li.Rule)
+}
+
+type lintFunc func(op OpType, sel *LintSelect) string
+
+type builtinRule struct {
+	name string
+	fn   lintFunc
+}
+
+func (r builtinRule) Name() string {
+	return r.name
+}
+
+func (r builtinRule) Lint(op OpType, sel *LintSelect) string {
+	return r.fn(op, sel)
+}
+
+var builtinLintRules = []LintRule{
+	builtinRule{LintUnboundedList, lintUnboundedList},
+	builtinRule{LintOffsetPaging, lintOffsetPaging},
+	builtinRule{LintRequireTypename, lintRequireTypename},
+	builtinRule{LintAllColumns, lintAllColumns},
+}
+
+func lintUnboundedList(op OpType, sel *LintSelect) string {
+	if op == OpQuery && sel.List && sel.Limit == "" {
+		return "list with no limit, set one with limit or first"
+	}
+	return ""
+}
+
+func lintOffsetPaging(op OpType, sel *LintSelect) string {
+	if sel.Offset {
+		return "paged with an offset, use a cursor instead"
+	}
+	return ""
+}
+
+func lintRequireTypename(op OpType, sel *LintSelect) string {
+	for _, c := range sel.Columns {
+		if c == "__typename" {
+			return ""
+		}
+	}
+	return "__typename is not selected"
+}
+
+func lintAllColumns(op OpType, sel *LintSelect) string {
+	if len(sel.TableColumns) < 2 {
+		return ""
+	}
+
+	cm := make(map[string]struct{}, len(sel.Columns))
+	for _, c := range sel.Columns {
+		cm[c] = struct{}{}
+	}
+
+	for _, c := range sel.TableColumns {
+		if _, ok := cm[c]; !ok {
+			return ""
+		}
+	}
+
+	return "every column is selected, select only the ones needed"
+}
+
+// initLint sets the lint rules, the builtin ones not turned off
+// with lint_skip are run before the custom ones
+func (sg *SuperGraph) initLint() error {
+	skip := make(map[string]struct{}, len(sg.conf.LintSkip))
+
+	for _, name := range sg.conf.LintSkip {
+		found := false
+		for _, r := range builtinLintRules {
+			if r.Name() == name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("lint_skip: unknown rule '%s'", name)
+		}
+		skip[name] = struct{}{}
+	}
+
+	sg.lintRules = nil
+
+	for _, r := range builtinLintRules {
+		if _, ok := skip[r.Name()]; !ok {
+			sg.lintRules = append(sg.lintRules, r)
+		}
+	}
+	sg.lintRules = append(sg.lintRules, sg.conf.LintRules...)
+
+	return nil
+}
+
+// Lint function returns the issues found by the lint rules in the query
+// when compiled for the role
+func (sg *SuperGraph) Lint(query, role string) ([]LintIssue, error) {
+	cq := &cquery{q: rquery{
+		op:    qcode.GetQType(query),
+		name:  Name(query),
+		query: []byte(query),
+	}}
+
+	if err := sg.compileQueryFn(cq, role); err != nil {
+		return nil, err
+	}
+
+	return sg.lint(cq.st.qc), nil
+}
+
+// lint runs the lint rules on each table selected in the query
+func (sg *SuperGraph) lint(qc *qcode.QCode) []LintIssue {
+	if qc == nil || len(sg.lintRules) == 0 {
+		return nil
+	}
+
+	var issues []LintIssue
+
+	var op OpType
+
+	switch qc.Type {
+	case qcode.QTQuery:
+		op = OpQuery
+	case qcode.QTSubscription:
+		op = OpSubscription
+	default:
+		op = OpMutation
+	}
+
+	schema := sg.pc.Schema()
+
+	for i := range qc.Selects {
+		s := &qc.Selects[i]
+
+		if s.SkipRender != qcode.SkipTypeNone || s.Type == qcode.STUnion {
+			continue
+		}
+
+		ti, err := schema.GetTableInfo(s.Name)
+		if err != nil {
+			continue
+		}
+
+		sel := &LintSelect{
+			Field:  s.FieldName,
+			Table:  s.Name,
+			Root:   s.ParentID == -1,
+			List:   !ti.IsSingular,
+			Limit:  s.Paging.Limit,
+			Offset: s.Paging.Offset != "",
+		}
+
+		for _, c := range s.Cols {
+			sel.Columns = append(sel.Columns, c.Name)
+		}
+
+		for _, c := range ti.Columns {
+			if _, ok := s.Allowed[c.Name]; ok || len(s.Allowed) == 0 {
+				sel.TableColumns = append(sel.TableColumns, c.Name)
+			}
+		}
+
+		for _, r := range sg.lintRules {
+			if msg := r.Lint(op, sel); msg != "" {
+				issues = append(issues, LintIssue{Rule: r.Name(), Field: sel.Field, Message: msg})
+			}
+		}
+	}
+
+	return issues
+}
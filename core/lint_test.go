@@ -0,0 +1,100 @@
+package core
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+type noEmailRule struct{}
+
+func (noEmailRule) Name() string {
+	return "no_email"
+}
+
+func (noEmailRule) Lint(op OpType, sel *LintSelect) string {
+	for _, c := range sel.Columns {
+		if c == "email" {
+			return "email is private"
+		}
+	}
+	return ""
+}
+
+func TestLint(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		LintSkip:  []string{LintRequireTypename},
+		LintRules: []LintRule{noEmailRule{}},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := `query {
+		products(offset: $offset) { id name }
+		users(limit: 5) { id email }
+	}`
+
+	issues, err := sg.Lint(query, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res []string
+	for _, li := range issues {
+		res = append(res, li.Rule+":"+li.Field)
+	}
+
+	sort.Strings(res)
+	exp := "no_email:users offset_paging:products unbounded_list:products"
+
+	if v := strings.Join(res, " "); v != exp {
+		t.Fatalf("expected '%s' got '%s'", exp, v)
+	}
+
+	conf.LintSkip = []string{"unknown"}
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for an unknown rule")
+	}
+}
+
+func TestLintAllColumns(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{}
+
+	err = conf.AddRoleTable("user", "products", Query{Columns: []string{"id", "name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := sg.Lint(`query { product { id name __typename } }`, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 1 || issues[0].Rule != LintAllColumns {
+		t.Fatalf("expected an all_columns issue: %v", issues)
+	}
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Locales struct configures the locales the translated columns fall back to
+// when there is no translation for the locale of the request
+type Locales struct {
+	// Default is the locale tried last (eg. en)
+	Default string
+
+	// Fallbacks are the locales tried after a locale (eg. `pt-BR: [pt-PT]`),
+	// the language of a locale (eg. pt for pt-BR) is always tried after these
+	Fallbacks map[string][]string
+}
+
+// locales returns the locales the translated columns are looked up in as a
+// json array. The requested locales (the locale variable or the LocaleKey of
+// the context) each followed by their fallbacks and then the default locale.
+func (sg *SuperGraph) locales(c context.Context, v json.RawMessage) (json.RawMessage, error) {
+	var req string
+
+	if len(v) != 0 && v[0] == '"' {
+		if err := json.Unmarshal(v, &req); err != nil {
+			return nil, err
+		}
+	} else if s, ok := c.Value(LocaleKey).(string); ok {
+		req = s
+	}
+
+	conf := sg.conf.Locales
+	seen := make(map[string]struct{})
+	list := []string{}
+
+	var add func(l string)
+
+	add = func(l string) {
+		if l == "" || l == "*" {
+			return
+		}
+		if _, ok := seen[l]; ok {
+			return
+		}
+		seen[l] = struct{}{}
+		list = append(list, l)
+
+		for _, f := range conf.Fallbacks[l] {
+			add(f)
+		}
+
+		if i := strings.IndexByte(l, '-'); i != -1 {
+			add(l[:i])
+		}
+	}
+
+	for _, l := range parseAcceptLanguage(req) {
+		add(l)
+	}
+	add(conf.Default)
+
+	return json.Marshal(list)
+}
+
+// parseAcceptLanguage returns the locales of an Accept-Language
+// header value (eg. `fr-CH, fr;q=0.9, en;q=0.8`) by their weight
+func parseAcceptLanguage(s string) []string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+
+	var langs []lang
+
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		l := lang{tag: v, q: 1}
+
+		if i := strings.IndexByte(v, ';'); i != -1 {
+			l.tag = strings.TrimSpace(v[:i])
+
+			if p := strings.TrimSpace(v[i+1:]); strings.HasPrefix(p, "q=") {
+				if q, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					l.q = q
+				}
+			}
+		}
+
+		if l.q > 0 {
+			langs = append(langs, l)
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	tags := make([]string, len(langs))
+	for i := range langs {
+		tags[i] = langs[i].tag
+	}
+	return tags
+}
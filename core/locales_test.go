@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestLocales(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		Tables: []Table{{Name: "tags", Columns: []Column{
+			{Name: "title", Translated: true},
+		}}},
+		Locales: Locales{
+			Default:   "en",
+			Fallbacks: map[string][]string{"pt-BR": {"pt-PT"}},
+		},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	tests := []struct {
+		header string
+		vars   string
+		exp    string
+	}{
+		{"", "", `["en"]`},
+		{"fr-CH, fr;q=0.9, de;q=0.95, *;q=0.5", "", `["fr-CH","fr","de","en"]`},
+		{"pt-BR", "", `["pt-BR","pt-PT","pt","en"]`},
+		{"de", `{"locale": "pt-BR"}`, `["pt-BR","pt-PT","pt","en"]`},
+	}
+
+	for _, v := range tests {
+		c := ct
+		if v.header != "" {
+			c = context.WithValue(ct, LocaleKey, v.header)
+		}
+
+		mock.ExpectQuery(`"tags"."title" ->> "__sg_l"."l"`).
+			WithArgs(json.RawMessage(v.exp)).
+			WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"tags": []}`))
+
+		var vars json.RawMessage
+		if v.vars != "" {
+			vars = json.RawMessage(v.vars)
+		}
+
+		if _, err := sg.GraphQL(c, `query { tags { id title } }`, vars); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Tables[0].Columns[0].Name = "slug"
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for a text column set as translated")
+	}
+}
@@ -0,0 +1,263 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metering struct configures the metering of the operations run, rows
+// returned and time spent in the database for each api key or tenant
+// along with the quotas they are limited to
+type Metering struct {
+	Enable bool
+
+	// Period is how long the usage is counted for before it starts over,
+	// it can be `hour`, `day` or `month` (default)
+	Period string
+
+	// Header is the request header with the api key (eg. X-API-Key),
+	// only used by the service. In code set the key with MeterKey
+	Header string
+
+	// Claim is the claim of the user with the tenant (eg. tenant_id),
+	// it's used when the key is not set
+	Claim string
+
+	// Quotas keyed by the api key or tenant, the `default` quota is for
+	// the keys not in it
+	Quotas map[string]Quota
+}
+
+// Quota struct is the usage allowed in each period, zero values are unlimited.
+// Requests over a hard quota fail with ErrCodeQuotaExceeded and requests over
+// a soft quota are run with a warning in the response extensions
+type Quota struct {
+	Operations int64
+	Rows       int64
+	DBTime     time.Duration `mapstructure:"db_time"`
+	Soft       bool
+}
+
+// Usage struct is the usage of an api key or tenant in the period that
+// started at Period
+type Usage struct {
+	Key        string        `json:"key"`
+	Period     time.Time     `json:"period"`
+	Operations int64         `json:"operations"`
+	Rows       int64         `json:"rows"`
+	DBTime     time.Duration `json:"db_time"`
+}
+
+// UsageStore is the storage of the usage of the api keys and tenants. Add adds
+// to the usage of the key in the period and returns the total, Get returns the
+// usage of the key in the period and List the usage of all keys in it
+type UsageStore interface {
+	Add(ctx context.Context, key string, u Usage) (Usage, error)
+	Get(ctx context.Context, key string, period time.Time) (Usage, error)
+	List(ctx context.Context, period time.Time) ([]Usage, error)
+}
+
+func (sg *SuperGraph) initMetering() error {
+	m := &sg.conf.Metering
+
+	if !m.Enable {
+		return nil
+	}
+
+	switch m.Period {
+	case "", "hour", "day", "month":
+	default:
+		return fmt.Errorf("metering: unknown period '%s'", m.Period)
+	}
+
+	if sg.conf.UsageStore != nil {
+		sg.usage = sg.conf.UsageStore
+	} else {
+		sg.usage = NewMemoryUsageStore()
+	}
+
+	return nil
+}
+
+// meterKey returns the api key or tenant of the request
+func (sg *SuperGraph) meterKey(c context.Context) string {
+	if v, ok := c.Value(MeterKey).(string); ok && v != "" {
+		return v
+	}
+
+	if cn := sg.conf.Metering.Claim; cn != "" {
+		claims, _ := c.Value(UserClaimsKey).(map[string]interface{})
+
+		if v, ok := claims[cn]; ok && v != nil {
+			return fmt.Sprintf("%v", v)
+		}
+	}
+
+	return ""
+}
+
+// meterPeriod returns the start of the current period
+func (sg *SuperGraph) meterPeriod() time.Time {
+	t := time.Now().UTC()
+
+	switch sg.conf.Metering.Period {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "day":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// checkQuota returns an error when the key is over its hard quota and a
+// warning when it's over its soft quota. Requests run at the same time
+// can go a little over the quota
+func (sg *SuperGraph) checkQuota(c context.Context, key string) (string, error) {
+	q, ok := sg.conf.Metering.Quotas[key]
+	if !ok {
+		if q, ok = sg.conf.Metering.Quotas["default"]; !ok {
+			return "", nil
+		}
+	}
+
+	u, err := sg.usage.Get(c, key, sg.meterPeriod())
+	if err != nil {
+		sg.log.Printf("WRN metering: %s", err)
+		return "", nil
+	}
+
+	var over []string
+
+	if q.Operations != 0 && u.Operations >= q.Operations {
+		over = append(over, fmt.Sprintf("%d operations", q.Operations))
+	}
+	if q.Rows != 0 && u.Rows >= q.Rows {
+		over = append(over, fmt.Sprintf("%d rows", q.Rows))
+	}
+	if q.DBTime != 0 && u.DBTime >= q.DBTime {
+		over = append(over, fmt.Sprintf("%s of database time", q.DBTime))
+	}
+
+	if len(over) == 0 {
+		return "", nil
+	}
+
+	msg := "quota exceeded: " + strings.Join(over, ", ")
+
+	if q.Soft {
+		return msg, nil
+	}
+	return "", &codeError{ErrCodeQuotaExceeded, msg}
+}
+
+// meter adds an operation with the rows of its result to the usage of the key
+func (sg *SuperGraph) meter(c context.Context, key string, data []byte, dur time.Duration) {
+	u := Usage{
+		Period:     sg.meterPeriod(),
+		Operations: 1,
+		Rows:       countRows(data),
+		DBTime:     dur,
+	}
+
+	if _, err := sg.usage.Add(c, key, u); err != nil {
+		sg.log.Printf("WRN metering: %s", err)
+	}
+}
+
+// countRows returns the number of objects in the result, each
+// is a row of a table (the data object itself is not counted)
+func countRows(data []byte) int64 {
+	var n int64
+	var str, esc bool
+
+	for _, b := range data {
+		switch {
+		case esc:
+			esc = false
+		case str && b == '\\':
+			esc = true
+		case b == '"':
+			str = !str
+		case !str && b == '{':
+			n++
+		}
+	}
+
+	if n != 0 {
+		n--
+	}
+	return n
+}
+
+// Usage function returns the usage of each api key or tenant in the current period
+func (sg *SuperGraph) Usage(c context.Context) ([]Usage, error) {
+	if sg.usage == nil {
+		return nil, nil
+	}
+
+	list, err := sg.usage.List(c, sg.meterPeriod())
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+// memoryUsageStore keeps the usage of the current period of each key,
+// the usage of a key is reset when it's added to in a new period
+type memoryUsageStore struct {
+	sync.Mutex
+	m map[string]Usage
+}
+
+// NewMemoryUsageStore returns a store that keeps the usage in memory, use
+// a shared store (eg. a database) to meter across more than one instance
+func NewMemoryUsageStore() UsageStore {
+	return &memoryUsageStore{m: make(map[string]Usage)}
+}
+
+func (s *memoryUsageStore) Add(_ context.Context, key string, u Usage) (Usage, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	cur, ok := s.m[key]
+	if !ok || !cur.Period.Equal(u.Period) {
+		cur = Usage{Key: key, Period: u.Period}
+	}
+
+	cur.Operations += u.Operations
+	cur.Rows += u.Rows
+	cur.DBTime += u.DBTime
+	s.m[key] = cur
+
+	return cur, nil
+}
+
+func (s *memoryUsageStore) Get(_ context.Context, key string, period time.Time) (Usage, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if u, ok := s.m[key]; ok && u.Period.Equal(period) {
+		return u, nil
+	}
+	return Usage{Key: key, Period: period}, nil
+}
+
+func (s *memoryUsageStore) List(_ context.Context, period time.Time) ([]Usage, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var list []Usage
+
+	for _, u := range s.m {
+		if u.Period.Equal(period) {
+			list = append(list, u)
+		}
+	}
+	return list, nil
+}
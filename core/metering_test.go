@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestMetering(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		Metering: Metering{
+			Enable: true,
+			Claim:  "tenant_id",
+			Quotas: map[string]Quota{
+				"key1":    {Operations: 2},
+				"default": {Rows: 1, Soft: true},
+			},
+		},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := `query { products(limit: 5) { id } }`
+	data := `{"products": [{"id": 1}, {"id": 2}]}`
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+	ct1 := context.WithValue(ct, MeterKey, "key1")
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT`).
+			WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(data))
+
+		if _, err := sg.GraphQL(ct1, query, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// over the hard quota the query is not run
+	if _, err := sg.GraphQL(ct1, query, nil); ErrorCode(err) != ErrCodeQuotaExceeded {
+		t.Fatalf("expected the quota to be exceeded got %v", err)
+	}
+
+	// the tenant is taken from the claims and is over a soft quota
+	ct2 := context.WithValue(ct, UserClaimsKey, map[string]interface{}{"tenant_id": 7})
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT`).
+			WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(data))
+
+		res, err := sg.GraphQL(ct2, query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		warned := res.Extensions != nil && len(res.Extensions.Warnings) != 0
+		if warned != (i == 1) {
+			t.Fatalf("expected a quota warning only on the second query got %v", res.Extensions)
+		}
+	}
+
+	// no key is not metered
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(data))
+
+	if _, err := sg.GraphQL(ct, query, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := sg.Usage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(usage) != 2 {
+		t.Fatalf("expected the usage of 2 keys got %v", usage)
+	}
+
+	for _, u := range usage {
+		if u.Operations != 2 || u.Rows != 4 {
+			t.Errorf("%s: expected 2 operations and 4 rows got %d and %d", u.Key, u.Operations, u.Rows)
+		}
+	}
+
+	if usage[0].Key != "7" || usage[1].Key != "key1" {
+		t.Fatalf("expected the keys 7 and key1 got %s and %s", usage[0].Key, usage[1].Key)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCountRows(t *testing.T) {
+	tests := []struct {
+		data string
+		exp  int64
+	}{
+		{`{"products": [{"id": 1}, {"id": 2, "user": {"id": 3}}]}`, 3},
+		{`{"products": [{"id": 1, "name": "a {b} \"{c\""}]}`, 1},
+		{`{"products": []}`, 0},
+		{``, 0},
+	}
+
+	for _, v := range tests {
+		if n := countRows([]byte(v.data)); n != v.exp {
+			t.Errorf("%s: expected %d got %d", v.data, v.exp, n)
+		}
+	}
+}
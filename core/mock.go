@@ -0,0 +1,93 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dosco/super-graph/core/internal/mock"
+	"github.com/dosco/super-graph/core/internal/qcode"
+	"github.com/spf13/viper"
+)
+
+type mockData struct {
+	Tables []mock.Table
+}
+
+// initMock loads the tables and rows from the mock data file
+func (sg *SuperGraph) initMock() ([]mock.Table, error) {
+	vi := viper.New()
+	vi.SetConfigFile(sg.conf.MockData)
+
+	if err := vi.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read mock data: %w", err)
+	}
+
+	var md mockData
+
+	if err := vi.Unmarshal(&md); err != nil {
+		return nil, fmt.Errorf("failed to decode mock data: %w", err)
+	}
+
+	if sg.dbinfo == nil {
+		di, err := mock.NewDBInfo(md.Tables)
+		if err != nil {
+			return nil, err
+		}
+		sg.dbinfo = di
+	}
+
+	return md.Tables, nil
+}
+
+// resolveMock runs the query against the in-memory mock data instead of the database
+func (c *scontext) resolveMock(query string, vars []byte, role string) (qres, error) {
+	var res qres
+
+	rq := rquery{op: c.op, name: c.name, query: []byte(query), vars: vars}
+	cq := &cquery{q: rq, md: c.sg.compileMeta(c)}
+	res.q = cq
+
+	if c.op != qcode.QTQuery {
+		return res, errors.New("mock data: only queries are supported")
+	}
+
+	if v := c.Value(UserRoleKey); v != nil {
+		role = v.(string)
+	}
+
+	if err := c.sg.compileQuery(cq, role); err != nil {
+		return res, err
+	}
+
+	if cq.roleArg {
+		return res, errors.New("mock data: roles_query is not supported")
+	}
+
+	vars, err := varDefaults(cq.st.qc, vars)
+	if err != nil {
+		return res, err
+	}
+
+	args, err := c.sg.argList(c, cq.st.md, vars)
+	if err != nil {
+		return res, err
+	}
+
+	params := make(map[string]interface{}, len(args.values))
+	for i, p := range cq.st.md.Params() {
+		params[p.Name] = args.values[i]
+	}
+
+	if res.data, err = c.sg.mock.Query(cq.st.qc, params); err != nil {
+		return res, err
+	}
+	res.role = role
+
+	if c.sg.allowList.IsPersist() {
+		if err := c.sg.allowList.Set(vars, query, ""); err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
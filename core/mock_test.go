@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const mockYAML = `
+tables:
+  - name: users
+    columns:
+      - name: id
+        type: bigint
+        primary_key: true
+      - name: full_name
+        type: text
+    rows:
+      - id: 1
+        full_name: Jane Doe
+      - id: 2
+        full_name: John Doe
+`
+
+func TestMockData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sg-mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "mock.yml")
+
+	if err := ioutil.WriteFile(fn, []byte(mockYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{
+		MockData:      fn,
+		AllowListFile: filepath.Join(dir, "allow.list"),
+	}
+
+	sg, err := NewSuperGraph(conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	res, err := sg.GraphQL(ct, `query { users(where: { id: { eq: 2 } }) { full_name } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"users": [{"full_name": "John Doe"}]}`
+
+	if string(res.Data) != exp {
+		t.Fatalf("expected: %s got: %s", exp, res.Data)
+	}
+
+	if _, err := sg.GraphQL(ct, `mutation { user(insert: $data) { id } }`, nil); err == nil {
+		t.Fatal("expecting an error for mutations")
+	}
+}
+
+func TestMockPagingVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sg-mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "mock.yml")
+
+	if err := ioutil.WriteFile(fn, []byte(mockYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{
+		MockData:      fn,
+		AllowListFile: filepath.Join(dir, "allow.list"),
+		MaxLimit:      1,
+	}
+
+	sg, err := NewSuperGraph(conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+	gql := `query { users(limit: $limit, offset: $offset, order_by: { id: $order }) { full_name } }`
+
+	tests := []struct {
+		vars string
+		exp  string
+	}{
+		{`{"limit": 10, "offset": -5, "order": "desc"}`, `{"users": [{"full_name": "John Doe"}]}`},
+		{`{"limit": 10, "offset": 1, "order": "desc"}`, `{"users": [{"full_name": "Jane Doe"}]}`},
+		{`{"limit": 0, "order": "asc"}`, `{"users": []}`},
+	}
+
+	for _, tt := range tests {
+		res, err := sg.GraphQL(ct, gql, json.RawMessage(tt.vars))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(res.Data) != tt.exp {
+			t.Errorf("%s: expected: %s got: %s", tt.vars, tt.exp, res.Data)
+		}
+	}
+
+	if _, err := sg.GraphQL(ct, gql, json.RawMessage(`{"limit": 1, "order": "sideways"}`)); err == nil {
+		t.Fatal("expecting an error for an invalid order")
+	}
+
+	if _, err := sg.GraphQL(ct, gql, json.RawMessage(`{"order": "asc"}`)); err == nil {
+		t.Fatal("expecting an error for a missing limit")
+	}
+}
@@ -0,0 +1,330 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// currencyDigits are the digits of the minor unit of the
+// currencies that don't have two (eg. cents)
+var currencyDigits = map[string]int{
+	"BHD": 3, "CLP": 0, "IQD": 3, "ISK": 0, "JOD": 3, "JPY": 0,
+	"KRW": 0, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3, "UGX": 0,
+	"VND": 0, "XAF": 0, "XOF": 0,
+}
+
+// moneyCol is a column with amounts in a currency, integer
+// columns hold the amounts in the minor unit (eg. cents)
+type moneyCol struct {
+	currency string
+	digits   int
+	minor    bool
+}
+
+type money struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// addCurrencies sets the currency of the currency columns
+// so their aggregates are computed as numeric
+func addCurrencies(c *Config, di *psql.DBInfo) error {
+	for _, t := range c.Tables {
+		for _, c := range t.Columns {
+			if c.Currency == "" {
+				continue
+			}
+
+			col, err := di.GetColumn(t.Name, c.Name)
+			if err != nil {
+				return fmt.Errorf("currency column: %w", err)
+			}
+
+			if len(c.Currency) != 3 {
+				return fmt.Errorf("currency column: %s.%s: invalid currency code: %s",
+					t.Name, c.Name, c.Currency)
+			}
+
+			if !isMoneyType(col.Type) {
+				return fmt.Errorf(
+					"currency column: column '%s' in table '%s' is of type '%s'. Only MONEY, NUMERIC or INTEGER is valid",
+					c.Name, t.Name, col.Type)
+			}
+			col.Currency = strings.ToUpper(c.Currency)
+		}
+	}
+	return nil
+}
+
+func isMoneyType(t string) bool {
+	if n := strings.IndexByte(t, '('); n != -1 {
+		t = t[:n]
+	}
+
+	switch strings.TrimSpace(t) {
+	case "money", "numeric", "decimal":
+		return true
+	}
+	return isIntType(t)
+}
+
+func isIntType(t string) bool {
+	switch t {
+	case "smallint", "integer", "int", "int2", "int4", "int8", "bigint":
+		return true
+	}
+	return false
+}
+
+// initMoney adds the formatters of the currency columns and indexes
+// them by table for the amounts set in mutations
+func (sg *SuperGraph) initMoney() error {
+	schema := sg.pc.Schema()
+
+	for _, t := range sg.conf.Tables {
+		for _, c := range t.Columns {
+			if c.Currency == "" {
+				continue
+			}
+
+			if c.Format != "" && !strings.HasPrefix(c.Format, "currency") {
+				return fmt.Errorf("table %s: column %s: a currency column can only have the currency format",
+					t.Name, c.Name)
+			}
+
+			ti, err := schema.GetTableInfo(t.Name)
+			if err != nil {
+				return err
+			}
+
+			col, err := ti.GetColumn(c.Name)
+			if err != nil {
+				return err
+			}
+
+			mc := &moneyCol{currency: col.Currency, digits: 2, minor: isIntType(col.Type)}
+
+			if d, ok := currencyDigits[mc.currency]; ok {
+				mc.digits = d
+			}
+
+			f := &formatter{name: "money", arg: mc.currency, fn: mc.format}
+
+			if c.Format != "" {
+				f = &formatter{name: "currency", arg: mc.currency, fn: mc.formatString}
+
+				if v := strings.SplitN(c.Format, ":", 2); len(v) == 2 {
+					f.arg = v[1]
+				}
+			}
+
+			// the same amount is a different value in minor units
+			if mc.minor {
+				f.name += "_minor"
+			}
+
+			if sg.formats == nil {
+				sg.formats = make(map[string]map[string]*formatter)
+				sg.fcache = &formatCache{m: make(map[string]json.RawMessage)}
+			}
+			if sg.formats[ti.Name] == nil {
+				sg.formats[ti.Name] = make(map[string]*formatter)
+			}
+			sg.formats[ti.Name][col.Key] = f
+
+			if sg.moneyCols == nil {
+				sg.moneyCols = make(map[string]map[string]*moneyCol)
+			}
+			if sg.moneyCols[ti.Name] == nil {
+				sg.moneyCols[ti.Name] = make(map[string]*moneyCol)
+			}
+			sg.moneyCols[ti.Name][col.Key] = mc
+		}
+	}
+
+	return nil
+}
+
+// amount returns the amount of a value of the column
+func (mc *moneyCol) amount(v json.RawMessage) (*big.Rat, error) {
+	s := string(v)
+
+	// numeric columns can be returned as strings
+	if len(s) != 0 && s[0] == '"' {
+		if err := json.Unmarshal(v, &s); err != nil {
+			return nil, err
+		}
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("not an amount: %s", v)
+	}
+
+	if mc.minor {
+		r.Quo(r, mc.unit())
+	}
+	return r, nil
+}
+
+// unit is the number of minor units in a unit of the currency
+func (mc *moneyCol) unit() *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(mc.digits)), nil))
+}
+
+// format returns the value of the column as an
+// amount and currency (eg. {"amount": "12.50", "currency": "USD"})
+func (mc *moneyCol) format(v json.RawMessage, arg string) (json.RawMessage, error) {
+	r, err := mc.amount(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(money{Amount: mc.amountString(r), Currency: mc.currency})
+}
+
+// formatString returns the value of the column formatted (eg. "$12.50")
+func (mc *moneyCol) formatString(v json.RawMessage, arg string) (json.RawMessage, error) {
+	r, err := mc.amount(v)
+	if err != nil {
+		return nil, err
+	}
+	return formatCurrency(json.RawMessage(mc.amountString(r)), arg)
+}
+
+// amountString returns the amount with the digits of the currency,
+// more digits are kept when the amount has them (eg. a unit price)
+func (mc *moneyCol) amountString(r *big.Rat) string {
+	s := r.FloatString(mc.digits)
+
+	if v, _ := new(big.Rat).SetString(s); v.Cmp(r) != 0 {
+		for d := mc.digits + 1; d < 20; d++ {
+			s = r.FloatString(d)
+			if v, _ := new(big.Rat).SetString(s); v.Cmp(r) == 0 {
+				break
+			}
+		}
+	}
+	return s
+}
+
+// value returns the value of an amount set in a mutation for the column, the
+// amount (eg. 12.5 or "12.50") or an amount and currency object are accepted
+func (mc *moneyCol) value(v json.RawMessage) (json.RawMessage, error) {
+	v = bytes.TrimSpace(v)
+
+	if len(v) != 0 && v[0] == '{' {
+		var m struct {
+			Amount   json.RawMessage `json:"amount"`
+			Currency string          `json:"currency"`
+		}
+
+		if err := json.Unmarshal(v, &m); err != nil {
+			return nil, err
+		}
+
+		if m.Currency != "" && !strings.EqualFold(m.Currency, mc.currency) {
+			return nil, fmt.Errorf("currency must be %s not %s", mc.currency, m.Currency)
+		}
+
+		if len(m.Amount) == 0 {
+			return nil, errors.New("amount is required")
+		}
+		v = m.Amount
+	}
+
+	s := string(v)
+
+	if len(s) != 0 && s[0] == '"' {
+		if err := json.Unmarshal(v, &s); err != nil {
+			return nil, err
+		}
+	}
+
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return nil, fmt.Errorf("not an amount: %s", v)
+	}
+
+	if !mc.minor {
+		return json.Marshal(mc.amountString(r))
+	}
+
+	r.Mul(r, mc.unit())
+
+	if !r.IsInt() {
+		return nil, fmt.Errorf("amount has more than %d decimals for %s", mc.digits, mc.currency)
+	}
+	return json.RawMessage(r.Num().String()), nil
+}
+
+// moneyAmounts sets the amounts of the currency columns in the inserts,
+// updates and upserts in the form they are stored in
+func (sg *SuperGraph) moneyAmounts(qc *qcode.QCode, vm map[string]json.RawMessage) error {
+	for _, m := range qc.Mutations {
+		if m.Type != qcode.QTInsert && m.Type != qcode.QTUpdate && m.Type != qcode.QTUpsert {
+			continue
+		}
+
+		ti, err := sg.pc.Schema().GetTableInfo(qc.Selects[m.SelID].Name)
+		if err != nil {
+			continue
+		}
+
+		cols, ok := sg.moneyCols[ti.Name]
+		if !ok {
+			continue
+		}
+
+		v, ok := vm[m.ActionVar]
+		if !ok || len(v) == 0 {
+			continue
+		}
+
+		set := func(row map[string]json.RawMessage) error {
+			for cn, val := range row {
+				mc, ok := cols[strings.ToLower(cn)]
+				if !ok || string(val) == "null" {
+					continue
+				}
+				v, err := mc.value(val)
+				if err != nil {
+					return fmt.Errorf("currency column %s: %w", cn, err)
+				}
+				row[cn] = v
+			}
+			return nil
+		}
+
+		if vm[m.ActionVar], err = editRows(v, set); err != nil {
+			return fmt.Errorf("variable '%s': %w", m.ActionVar, err)
+		}
+	}
+
+	return nil
+}
+
+// moneyVarAmounts is moneyAmounts for the variables passed to the query
+func (sg *SuperGraph) moneyVarAmounts(qc *qcode.QCode, vars json.RawMessage) (json.RawMessage, error) {
+	if len(sg.moneyCols) == 0 || len(vars) == 0 || len(qc.Mutations) == 0 {
+		return vars, nil
+	}
+
+	var vm map[string]json.RawMessage
+
+	if err := json.Unmarshal(vars, &vm); err != nil {
+		return nil, err
+	}
+
+	if err := sg.moneyAmounts(qc, vm); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(vm)
+}
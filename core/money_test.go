@@ -0,0 +1,129 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestMoneyCol(t *testing.T) {
+	usd := &moneyCol{currency: "USD", digits: 2}
+	cents := &moneyCol{currency: "EUR", digits: 2, minor: true}
+	yen := &moneyCol{currency: "JPY", digits: 0, minor: true}
+
+	out := []struct {
+		mc       *moneyCol
+		val, exp string
+	}{
+		{usd, `12.5`, `{"amount":"12.50","currency":"USD"}`},
+		{usd, `"0.125"`, `{"amount":"0.125","currency":"USD"}`},
+		{cents, `-1250`, `{"amount":"-12.50","currency":"EUR"}`},
+		{yen, `1500`, `{"amount":"1500","currency":"JPY"}`},
+	}
+
+	for _, v := range out {
+		b, err := v.mc.format(json.RawMessage(v.val), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != v.exp {
+			t.Errorf("expected %s got %s", v.exp, b)
+		}
+	}
+
+	if b, err := cents.formatString(json.RawMessage(`123456`), "EUR"); err != nil || string(b) != `"€1,234.56"` {
+		t.Errorf("unexpected formatted amount: %s %v", b, err)
+	}
+
+	in := []struct {
+		mc       *moneyCol
+		val, exp string
+	}{
+		{usd, `12.5`, `"12.50"`},
+		{usd, `{"amount": "3", "currency": "usd"}`, `"3.00"`},
+		{cents, `"12.34"`, `1234`},
+		{cents, `{"amount": 0.1}`, `10`},
+		{yen, `1500`, `1500`},
+	}
+
+	for _, v := range in {
+		b, err := v.mc.value(json.RawMessage(v.val))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != v.exp {
+			t.Errorf("expected %s got %s", v.exp, b)
+		}
+	}
+
+	for _, v := range []string{`"12.345"`, `{"amount": 1, "currency": "USD"}`, `"abc"`, `{"currency": "EUR"}`} {
+		if _, err := cents.value(json.RawMessage(v)); err == nil {
+			t.Errorf("expected an error for %s", v)
+		}
+	}
+}
+
+func TestMoney(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		Tables: []Table{{Name: "products", Columns: []Column{
+			{Name: "price", Currency: "usd"},
+		}}},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`sum\("products"."price" :: numeric\) AS "sum_price"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).
+			AddRow(`{"products": [{"id": 1, "price": 12.5, "sum_price": 12.5}]}`))
+
+	res, err := sg.GraphQL(ct, `query { products { id price sum_price } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"products": [{"id": 1, "price":{"amount":"12.50","currency":"USD"}, "sum_price": 12.5}]}`
+
+	if string(res.Data) != exp {
+		t.Fatalf("unexpected result: %s", res.Data)
+	}
+
+	mock.ExpectQuery(`INSERT INTO "products"`).
+		WithArgs(json.RawMessage(`{"name":"Bag","price":"10.00"}`)).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"product": {"id": 2}}`))
+
+	vars := json.RawMessage(`{"data": {"name": "Bag", "price": {"amount": 10, "currency": "USD"}}}`)
+
+	if _, err := sg.GraphQL(ct, `mutation { product(insert: $data) { id } }`, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	vars = json.RawMessage(`{"data": {"name": "Bag", "price": {"amount": 10, "currency": "EUR"}}}`)
+
+	if _, err := sg.GraphQL(ct, `mutation { product(insert: $data) { id } }`, vars); err == nil {
+		t.Fatal("expected an error for an amount in another currency")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Tables[0].Columns[0].Name = "name"
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for a text column set as a currency")
+	}
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestMySQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{DBType: "mysql"}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery("SELECT JSON_OBJECT\\('product', `__sj_0`.`json`\\)").
+		WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"product": {"id": 5}}`))
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	res, err := sg.GraphQL(ct, `query { product(id: $id) { id } }`, json.RawMessage(`{"id": 5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(res.Data) != `{"product": {"id": 5}}` {
+		t.Fatalf("unexpected result: %s", res.Data)
+	}
+
+	if _, err := sg.GraphQL(ct, `mutation { product(insert: $data) { id } }`,
+		json.RawMessage(`{"data": {"name": "Bag"}}`)); err == nil {
+		t.Fatal("expected an error for a mutation with mysql")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTestGraph(t, &Config{DBType: "oracle"}, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for an unknown database type")
+	}
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// Namespace struct groups tables under a root field of its name (eg. `billing
+// { invoices { id } }`), the tables in it are not root fields. When Roles are
+// set only those roles can use the namespace
+type Namespace struct {
+	Name   string
+	Tables []string
+	Roles  []string
+}
+
+// namespaceOpts returns the qcode options of the namespaces and indexes
+// them by the tables in them for the introspection schema
+func (sg *SuperGraph) namespaceOpts(s *psql.DBSchema) ([]qcode.Option, error) {
+	var opts []qcode.Option
+
+	sg.nsTables = nil
+
+	nss := make([]*Namespace, 0, len(sg.conf.Namespaces))
+
+	for i := range sg.conf.Namespaces {
+		nss = append(nss, &sg.conf.Namespaces[i])
+	}
+	nss = append(nss, sg.schemaNamespaces()...)
+
+	for _, ns := range nss {
+
+		if !isGraphQLName(ns.Name) {
+			return nil, fmt.Errorf("namespace: invalid name: %s", ns.Name)
+		}
+
+		if _, err := s.GetTableInfo(ns.Name); err == nil {
+			return nil, fmt.Errorf("namespace: %s: a table of the same name exists", ns.Name)
+		}
+
+		if len(ns.Tables) == 0 {
+			return nil, fmt.Errorf("namespace: %s: no tables", ns.Name)
+		}
+
+		for _, t := range ns.Tables {
+			ti, err := s.GetTableInfo(t)
+			if err != nil {
+				return nil, fmt.Errorf("namespace: %s: %w", ns.Name, err)
+			}
+
+			if sg.nsTables == nil {
+				sg.nsTables = make(map[string]*Namespace)
+			}
+			sg.nsTables[ti.Name] = ns
+		}
+
+		opts = append(opts, qcode.WithNamespace(ns.Name, ns.Tables, ns.Roles))
+	}
+
+	return opts, nil
+}
+
+// nsAllowed returns true if the role can use the namespace,
+// a nil role is the schema of all the roles
+func nsAllowed(ns *Namespace, ro *Role) bool {
+	if len(ns.Roles) == 0 || ro == nil {
+		return true
+	}
+
+	for _, r := range ns.Roles {
+		if r == ro.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// nestNamespaces moves the roots selected in a namespace under it, they are
+// returned by the database as roots. The order of the roots is kept
+func nestNamespaces(qc *qcode.QCode, data []byte) ([]byte, error) {
+	if qc == nil || len(data) == 0 {
+		return data, nil
+	}
+
+	rns := make(map[string]string)
+
+	for _, id := range qc.Roots {
+		sel := &qc.Selects[id]
+
+		if sel.Namespace != "" {
+			rns[sel.FieldName] = sel.Namespace
+			rns[sel.FieldName+"_cursor"] = sel.Namespace
+		}
+	}
+
+	if len(rns) == 0 {
+		return data, nil
+	}
+
+	type field struct {
+		key    string
+		value  json.RawMessage
+		fields []field
+	}
+
+	var root []field
+	nsi := make(map[string]int)
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	if _, err := dec.Token(); err != nil {
+		return data, err
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return data, err
+		}
+		k, _ := t.(string)
+
+		var v json.RawMessage
+
+		if err := dec.Decode(&v); err != nil {
+			return data, err
+		}
+
+		ns, ok := rns[k]
+		if !ok {
+			root = append(root, field{key: k, value: v})
+			continue
+		}
+
+		i, ok := nsi[ns]
+		if !ok {
+			i = len(root)
+			nsi[ns] = i
+			root = append(root, field{key: ns})
+		}
+		root[i].fields = append(root[i].fields, field{key: k, value: v})
+	}
+
+	var b bytes.Buffer
+
+	write := func(fields []field, fn func(f field)) {
+		b.WriteByte('{')
+		for i, f := range fields {
+			if i != 0 {
+				b.WriteByte(',')
+			}
+			kb, _ := json.Marshal(f.key)
+			b.Write(kb)
+			b.WriteByte(':')
+			fn(f)
+		}
+		b.WriteByte('}')
+	}
+
+	write(root, func(f field) {
+		if f.fields == nil {
+			b.Write(f.value)
+			return
+		}
+		write(f.fields, func(f field) { b.Write(f.value) })
+	})
+
+	return b.Bytes(), nil
+}
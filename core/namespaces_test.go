@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+func TestNamespaces(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		Namespaces: []Namespace{
+			{Name: "shop", Tables: []string{"products", "purchases"}},
+			{Name: "crm", Tables: []string{"customers"}, Roles: []string{"admin"}},
+		},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`jsonb_build_object\('products', "__sj_0"."json", 'users', "__sj_1"."json"\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).
+			AddRow(`{"products": [{"id": 2}], "users": [{"id": 1}]}`))
+
+	res, err := sg.GraphQL(ct, `query { users(limit: 1) { id } shop { products(limit: 1) { id } } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"shop":{"products":[{"id": 2}]},"users":[{"id": 1}]}`; string(res.Data) != exp {
+		t.Fatalf("expected %s got %s", exp, res.Data)
+	}
+
+	errs := []struct {
+		query, err string
+	}{
+		{`query { products { id } }`, "is in the namespace shop"},
+		{`query { shop { users { id } } }`, "is not in the namespace shop"},
+		{`query { crm { customers { id } } }`, "namespace blocked"},
+		{`query { products: users { id } shop { products { id } } }`, "duplicate root field products"},
+	}
+
+	for _, v := range errs {
+		_, err := sg.GraphQL(ct, v.query, nil)
+		if err == nil || !strings.Contains(err.Error(), v.err) {
+			t.Fatalf("%s: expected the error '%s' got %v", v.query, v.err, err)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := sg.GraphQLSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{"shop:shopQuery!", "type shopQuery {", "crm:crmQuery!"} {
+		if !strings.Contains(schema, v) {
+			t.Fatalf("expected %s in the schema", v)
+		}
+	}
+}
+
+func TestNestNamespaces(t *testing.T) {
+	qc := &qcode.QCode{
+		Selects: []qcode.Select{
+			{ID: 0, FieldName: "a"},
+			{ID: 1, FieldName: "b", Namespace: "ns"},
+			{ID: 2, FieldName: "c", Namespace: "ns"},
+		},
+		Roots: []int32{0, 1, 2},
+	}
+
+	data, err := nestNamespaces(qc, []byte(`{"b": [2], "a": 1, "b_cursor": "x", "c": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"ns":{"b":[2],"b_cursor":"x","c":null},"a":1}`; string(data) != exp {
+		t.Fatalf("expected %s got %s", exp, data)
+	}
+}
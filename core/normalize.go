@@ -0,0 +1,212 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// refKey is the key of the objects that take the place of the rows of
+// tables in the data of a normalized result (eg. {"__ref": "users:1"})
+const refKey = "__ref"
+
+// isNormalized returns true if the rows of the result
+// are to be returned as entities keyed by id
+func isNormalized(ct context.Context) bool {
+	v, _ := ct.Value(NormalizeKey).(bool)
+	return v
+}
+
+type normalizer struct {
+	schema *psql.DBSchema
+	qc     *qcode.QCode
+
+	// the entities in the order they are found
+	keys     []string
+	entities map[string][]jsonField
+}
+
+// normalize replaces the rows of the tables in the data with a reference to
+// them (eg. {"__ref": "users:1"}), the rows are returned as entities keyed
+// by their table and primary key. Rows without the primary key selected and
+// the rows of relay connections are left in place.
+func normalize(schema *psql.DBSchema, qc *qcode.QCode, data json.RawMessage) (
+	json.RawMessage, json.RawMessage, error) {
+
+	if qc == nil || len(data) == 0 {
+		return data, nil, nil
+	}
+
+	n := normalizer{
+		schema:   schema,
+		qc:       qc,
+		entities: make(map[string][]jsonField),
+	}
+
+	root, err := readObj(data)
+	if err != nil {
+		return data, nil, err
+	}
+
+	for _, id := range qc.Roots {
+		sel := &qc.Selects[id]
+
+		// roots in a namespace are nested in it
+		if sel.Namespace == "" {
+			err = n.field(root, sel)
+		} else {
+			err = n.nested(root, sel.Namespace, sel)
+		}
+		if err != nil {
+			return data, nil, err
+		}
+	}
+
+	var ent []jsonField
+	for _, k := range n.keys {
+		ent = append(ent, jsonField{key: k, val: writeObj(n.entities[k])})
+	}
+
+	return writeObj(root), writeObj(ent), nil
+}
+
+// nested normalizes the selection in the object under the key
+func (n *normalizer) nested(obj []jsonField, key string, sel *qcode.Select) error {
+	for i := range obj {
+		if obj[i].key != key {
+			continue
+		}
+
+		v, err := readObj(obj[i].val)
+		if err != nil {
+			return err
+		}
+		if err := n.field(v, sel); err != nil {
+			return err
+		}
+		obj[i].val = writeObj(v)
+	}
+	return nil
+}
+
+// field normalizes the value of the selection in the object
+func (n *normalizer) field(obj []jsonField, sel *qcode.Select) error {
+	for i := range obj {
+		if obj[i].key != sel.FieldName {
+			continue
+		}
+
+		v, err := n.value(sel, obj[i].val)
+		if err != nil {
+			return err
+		}
+		obj[i].val = v
+	}
+	return nil
+}
+
+// value normalizes a row or a list of rows of the selection
+func (n *normalizer) value(sel *qcode.Select, v json.RawMessage) (json.RawMessage, error) {
+	if sel.Connection != nil || sel.SkipRender != qcode.SkipTypeNone {
+		return v, nil
+	}
+
+	if isNull(v) {
+		return v, nil
+	}
+
+	switch v[0] {
+	case '[':
+		var list []json.RawMessage
+
+		if err := json.Unmarshal(v, &list); err != nil {
+			return v, err
+		}
+
+		for i := range list {
+			v1, err := n.value(sel, list[i])
+			if err != nil {
+				return v, err
+			}
+			list[i] = v1
+		}
+		return json.Marshal(list)
+
+	case '{':
+		return n.row(sel, v)
+	}
+
+	return v, nil
+}
+
+// row returns a reference to the entity of the row, the
+// children of the row are normalized first
+func (n *normalizer) row(sel *qcode.Select, v json.RawMessage) (json.RawMessage, error) {
+	obj, err := readObj(v)
+	if err != nil {
+		return v, err
+	}
+
+	for _, cid := range sel.Children {
+		if err := n.field(obj, &n.qc.Selects[cid]); err != nil {
+			return v, err
+		}
+	}
+
+	key := n.entityKey(sel, obj)
+	if key == "" {
+		return writeObj(obj), nil
+	}
+
+	// the fields are merged when the row is
+	// selected more than once in the query
+	e, ok := n.entities[key]
+	if !ok {
+		n.keys = append(n.keys, key)
+	}
+
+	for _, f := range obj {
+		found := false
+		for i := range e {
+			if e[i].key == f.key {
+				e[i].val = f.val
+				found = true
+				break
+			}
+		}
+		if !found {
+			e = append(e, f)
+		}
+	}
+	n.entities[key] = e
+
+	kv, _ := json.Marshal(key)
+	return writeObj([]jsonField{{key: refKey, val: kv}}), nil
+}
+
+// entityKey returns the table and primary key of the row (eg. users:1),
+// empty if the row is not of a table or its primary key is not selected
+func (n *normalizer) entityKey(sel *qcode.Select, obj []jsonField) string {
+	ti, err := n.schema.GetTableInfo(sel.Name)
+	if err != nil || ti.PrimaryCol == nil {
+		return ""
+	}
+
+	for _, col := range sel.Cols {
+		if !strings.EqualFold(col.Name, ti.PrimaryCol.Name) {
+			continue
+		}
+
+		for _, f := range obj {
+			if f.key != col.FieldName || isNull(f.val) {
+				continue
+			}
+			return ti.Name + ":" + strings.Trim(string(f.val), `"`)
+		}
+	}
+
+	return ""
+}
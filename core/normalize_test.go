@@ -0,0 +1,65 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+func TestNormalize(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cq := &cquery{q: rquery{op: qcode.QTQuery,
+		query: []byte(`query {
+			products {
+				id
+				name
+				owner: user { id full_name }
+			}
+			users { id email }
+			me: user(id: $id) { full_name }
+		}`)}}
+
+	if err := sg.compileQuery(cq, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	data := `{"products": [{"id": 1, "name": "Apple", "owner": {"id": 5, "full_name": "Jane"}},` +
+		`{"id": 2, "name": "Pear", "owner": {"id": 5, "full_name": "Jane"}}],` +
+		`"users": [{"id": 5, "email": "jane@example.com"}, {"id": 6, "email": null}],` +
+		`"me": {"full_name": "Jane"}}`
+
+	expData := `{"products":[{"__ref":"products:1"},{"__ref":"products:2"}],` +
+		`"users":[{"__ref":"users:5"},{"__ref":"users:6"}],` +
+		`"me":{"full_name":"Jane"}}`
+
+	// the fields of a row selected more than once are merged
+	expEnt := `{"users:5":{"id":5,"email":"jane@example.com","full_name":"Jane"},` +
+		`"users:6":{"id":6,"email":null},` +
+		`"products:1":{"id":1,"name":"Apple","owner":{"__ref":"users:5"}},` +
+		`"products:2":{"id":2,"name":"Pear","owner":{"__ref":"users:5"}}}`
+
+	b, ent, err := normalize(sg.pc.Schema(), cq.st.qc, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != expData {
+		t.Errorf("expected data %s got %s", expData, b)
+	}
+
+	if string(ent) != expEnt {
+		t.Errorf("expected entities %s got %s", expEnt, ent)
+	}
+}
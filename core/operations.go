@@ -0,0 +1,180 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// OpInfo struct describes a query from the allow list with the types of its
+// variables and result, it's used to generate typed clients for the queries
+type OpInfo struct {
+	Name      string
+	Type      OpType
+	Query     string
+	Variables []OpVar
+	Fields    []OpField
+}
+
+// OpVar struct is a variable of an operation, Type is the database type
+type OpVar struct {
+	Name  string
+	Type  string
+	Array bool
+}
+
+// OpField struct is a field in the result of an operation. Fields of
+// a table have child Fields and no Type while columns have the database type
+// of the column as Type. Remote joins and unions have neither since their
+// shape is not known.
+type OpField struct {
+	Name    string
+	Type    string
+	Array   bool
+	List    bool
+	NotNull bool
+	Fields  []OpField
+}
+
+// Operations function returns the queries in the allow list with the types of their
+// variables and results when compiled for the role
+func (sg *SuperGraph) Operations(role string) ([]OpInfo, error) {
+	list, err := sg.allowedQueries()
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]OpInfo, 0, len(list))
+
+	for _, v := range list {
+		if v.Name == "" || v.Query == "" {
+			continue
+		}
+
+		op, err := sg.operation(v.Name, v.Query, []byte(v.Vars), role)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", v.Name, err)
+		}
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
+
+func (sg *SuperGraph) operation(name, query string, vars []byte, role string) (OpInfo, error) {
+	op := OpInfo{Name: name, Type: Operation(query), Query: query}
+
+	cq := &cquery{q: rquery{
+		op:    qcode.GetQType(query),
+		name:  name,
+		query: []byte(query),
+		vars:  vars,
+	}}
+
+	if err := sg.compileQueryFn(cq, role); err != nil {
+		return op, err
+	}
+
+	vm := make(map[string]struct{})
+
+	for _, p := range cq.st.md.Params() {
+		switch p.Name {
+		// set by the server and not the client
+		case "user_id", "user_id_provider", "user_role":
+			continue
+		}
+
+		v := OpVar{Name: p.Name, Type: p.Type, Array: p.IsArray}
+
+		// global ids (relay) are strings
+		if _, vn, ok := qcode.ParseNodeParam(p.Name); ok {
+			v = OpVar{Name: vn, Type: "text"}
+		}
+
+		if _, vn, ok := qcode.ParsePagingParam(p.Name); ok {
+			v = OpVar{Name: vn, Type: "integer"}
+		}
+
+		if vn, ok := qcode.ParseOrderParam(p.Name); ok {
+			v = OpVar{Name: vn, Type: "text"}
+		}
+
+		if _, ok := vm[v.Name]; ok {
+			continue
+		}
+		vm[v.Name] = struct{}{}
+
+		op.Variables = append(op.Variables, v)
+	}
+
+	qc := cq.st.qc
+	if qc == nil {
+		return op, nil
+	}
+
+	schema := sg.pc.Schema()
+
+	for _, id := range qc.Roots {
+		f, ok, err := selField(schema, qc.Selects, id)
+		if err != nil {
+			return op, err
+		}
+		if ok {
+			op.Fields = append(op.Fields, f)
+		}
+	}
+
+	return op, nil
+}
+
+func selField(schema *psql.DBSchema, sels []qcode.Select, id int32) (OpField, bool, error) {
+	sel := &sels[id]
+	f := OpField{Name: sel.FieldName}
+
+	switch sel.SkipRender {
+	case qcode.SkipTypeNone:
+	case qcode.SkipTypeRemote:
+		return f, true, nil
+	default:
+		return f, false, nil
+	}
+
+	if sel.Type == qcode.STUnion {
+		return f, true, nil
+	}
+
+	ti, err := schema.GetTableInfo(sel.Name)
+	if err != nil {
+		return f, false, err
+	}
+	f.List = !ti.IsSingular
+
+	for _, c := range sel.Cols {
+		col, err := ti.GetColumn(c.Name)
+		if err != nil {
+			// functions (eg. count_id) and other computed columns
+			f.Fields = append(f.Fields, OpField{Name: c.FieldName})
+			continue
+		}
+
+		f.Fields = append(f.Fields, OpField{
+			Name:    c.FieldName,
+			Type:    col.Type,
+			Array:   col.Array,
+			NotNull: col.NotNull || col.PrimaryKey,
+		})
+	}
+
+	for _, cid := range sel.Children {
+		cf, ok, err := selField(schema, sels, cid)
+		if err != nil {
+			return f, false, err
+		}
+		if ok {
+			f.Fields = append(f.Fields, cf)
+		}
+	}
+
+	return f, true, nil
+}
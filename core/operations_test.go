@@ -0,0 +1,46 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestOperation(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := `query getProducts { products(where: { id: { gt: $id } }) { id name user { email } } }`
+
+	op, err := sg.operation("getProducts", query, nil, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if op.Type != OpQuery || len(op.Variables) != 1 || op.Variables[0].Name != "id" {
+		t.Fatalf("unexpected operation: %+v", op)
+	}
+
+	if len(op.Fields) != 1 || !op.Fields[0].List || len(op.Fields[0].Fields) != 3 {
+		t.Fatalf("unexpected fields: %+v", op.Fields)
+	}
+
+	id, user := op.Fields[0].Fields[0], op.Fields[0].Fields[2]
+
+	if id.Name != "id" || id.Type == "" || !id.NotNull {
+		t.Fatalf("unexpected id field: %+v", id)
+	}
+
+	if user.Name != "user" || user.List || len(user.Fields) != 1 || user.Fields[0].Name != "email" {
+		t.Fatalf("unexpected user field: %+v", user)
+	}
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// outboxEvent is an outbox event with its payload template parsed
+type outboxEvent struct {
+	name    string
+	payload interface{}
+}
+
+// initOutbox collects the outbox events by mutation name and
+// builds the statement that inserts them
+func (sg *SuperGraph) initOutbox() error {
+	ob := sg.conf.Outbox
+
+	if len(ob.Events) == 0 {
+		return nil
+	}
+
+	table := ob.Table
+	if table == "" {
+		table = "outbox"
+	}
+
+	if !tableRe.MatchString(table) {
+		return fmt.Errorf("outbox: invalid table name '%s'", table)
+	}
+
+	sg.outboxStmt = `INSERT INTO ` + table + ` (name, payload) VALUES ($1, $2)`
+	sg.outbox = make(map[string]*outboxEvent, len(ob.Events))
+
+	for _, e := range ob.Events {
+		if e.Name == "" || e.Query == "" {
+			return errors.New("outbox: event name and query required")
+		}
+
+		ev := &outboxEvent{name: e.Name, payload: "$"}
+
+		if e.Payload != "" {
+			if err := json.Unmarshal([]byte(e.Payload), &ev.payload); err != nil {
+				return fmt.Errorf("outbox: event %s: invalid payload: %w", e.Name, err)
+			}
+		}
+
+		q := strings.ToLower(e.Query)
+
+		if _, ok := sg.outbox[q]; ok {
+			return fmt.Errorf("outbox: duplicate event for query: %s", e.Query)
+		}
+		sg.outbox[q] = ev
+	}
+
+	return nil
+}
+
+// outboxEvent returns the outbox event of the named mutation
+func (sg *SuperGraph) outboxEvent(name string) *outboxEvent {
+	if name == "" || sg.outbox == nil {
+		return nil
+	}
+	return sg.outbox[strings.ToLower(name)]
+}
+
+// insertOutbox inserts the event with its payload built from the
+// result of the mutation, it's done in the transaction of the mutation
+func (c *scontext) insertOutbox(tx *sql.Tx, ev *outboxEvent, data json.RawMessage) error {
+	var v interface{}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+
+	p, err := json.Marshal(outboxPayload(ev.payload, v))
+	if err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+
+	if _, err := tx.ExecContext(c, c.sg.outboxStmt, ev.name, string(p)); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	return nil
+}
+
+// outboxPayload returns the template with the $ paths in
+// it replaced by the values in the data
+func outboxPayload(t, data interface{}) interface{} {
+	switch v := t.(type) {
+	case string:
+		if !strings.HasPrefix(v, "$") {
+			return v
+		}
+		return dataAtPath(data, v[1:])
+
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = outboxPayload(val, data)
+		}
+		return m
+
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = outboxPayload(val, data)
+		}
+		return l
+	}
+
+	return t
+}
+
+// dataAtPath returns the value at the dot seperated path (eg. `user.id`),
+// numbers in it are indexes into lists. It's nil when there's no value
+func dataAtPath(data interface{}, path string) interface{} {
+	if path == "" {
+		return data
+	}
+
+	for _, k := range strings.Split(path, ".") {
+		switch v := data.(type) {
+		case map[string]interface{}:
+			data = v[k]
+
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			data = v[i]
+
+		default:
+			return nil
+		}
+	}
+
+	return data
+}
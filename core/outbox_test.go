@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Outbox: Outbox{
+		Table: "events.outbox",
+		Events: []OutboxEvent{{
+			Name:    "product_created",
+			Query:   "createProduct",
+			Payload: `{"id": "$product.id", "tags": ["new", "$product.name"], "all": "$"}`,
+		}},
+	}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := `{"product": {"id": 5, "name": "Bag"}}`
+	payload := `{"all":{"product":{"id":5,"name":"Bag"}},"id":5,"tags":["new","Bag"]}`
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "products"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(data))
+	mock.ExpectExec(`INSERT INTO events\.outbox \(name, payload\) VALUES \(\$1, \$2\)`).
+		WithArgs("product_created", payload).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+	vars := json.RawMessage(`{"data": {"name": "Bag"}}`)
+
+	res, err := sg.GraphQL(ct, `mutation createProduct { product(insert: $data) { id name } }`, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(res.Data) != data {
+		t.Fatalf("unexpected result: %s", res.Data)
+	}
+
+	// the mutation is rolled back when the event can't be inserted
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "products"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(data))
+	mock.ExpectExec(`INSERT INTO events\.outbox`).
+		WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+
+	if _, err := sg.GraphQL(ct, `mutation createProduct { product(insert: $data) { id name } }`, vars); err == nil {
+		t.Fatal("expected an error when the event is not inserted")
+	}
+
+	// other mutations don't use a transaction
+	mock.ExpectQuery(`INSERT INTO "products"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(data))
+
+	if _, err := sg.GraphQL(ct, `mutation addProduct { product(insert: $data) { id name } }`, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Outbox.Table = "outbox; drop table users"
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for an invalid table name")
+	}
+}
@@ -0,0 +1,240 @@
+package core
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// buildRootStmts returns a statement for each of the root selections of the
+// query, these are run at the same time on their own connections when the
+// query has at least ParallelRoots roots. Else when the sql of the query is
+// over SplitSQLBytes they are run one after the other on the same connection
+// so the database plans a few smaller statements. Skipped roots get none.
+func (sg *SuperGraph) buildRootStmts(cq *cquery, role string, md psql.Metadata) ([]stmt, bool, error) {
+	if md.Stream || cq.st.qc == nil || len(cq.st.qc.Roots) < 2 || cq.st.md.HasRemotes() {
+		return nil, false, nil
+	}
+
+	n := sg.conf.ParallelRoots
+	parallel := n >= 2 && len(cq.st.qc.Roots) >= n
+	split := sg.conf.SplitSQLBytes > 0 && len(cq.st.sql) > sg.conf.SplitSQLBytes
+
+	if !parallel && !split {
+		return nil, false, nil
+	}
+
+	var vm map[string]json.RawMessage
+
+	if len(cq.q.vars) != 0 {
+		if err := json.Unmarshal(cq.q.vars, &vm); err != nil {
+			return nil, false, err
+		}
+	}
+
+	roots := len(cq.st.qc.Roots)
+	parts := make([]stmt, 0, roots)
+
+	// the selections are changed by the compiler so each
+	// root is rendered from its own compile of the query
+	for i := 0; i < roots; i++ {
+		qc, err := sg.qc.Compile(cq.q.query, role)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if vm, err = applyVarDefs(qc, vm); err != nil {
+			return nil, false, err
+		}
+		if err := sg.initRemoteSorts(qc); err != nil {
+			return nil, false, err
+		}
+		qc.Roots = qc.Roots[i : i+1]
+
+		w := &bytes.Buffer{}
+
+		pmd, err := sg.pc.CompileWithMetadata(w, qc, psql.Variables(vm), md)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if pmd.Skipped() {
+			continue
+		}
+		parts = append(parts, stmt{role: cq.st.role, qc: qc, md: pmd, sql: w.String()})
+	}
+
+	if len(parts) < 2 {
+		return nil, false, nil
+	}
+	return parts, parallel, nil
+}
+
+// execParts runs the statements of the roots of the query at the same time,
+// the first on the connection already taken, and merges their results
+func (c *scontext) execParts(conn *sql.Conn, parts []stmt, vars []byte, role string) ([]byte, error) {
+	var wg sync.WaitGroup
+
+	data := make([][]byte, len(parts))
+	errs := make([]error, len(parts))
+	db := c.queryDB(role)
+
+	for i := range parts {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			data[i], errs[i] = c.execPart(db, conn, i, &parts[i], vars, role)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mergeObjects(data), nil
+}
+
+// execSplit runs the statements of the roots of the query one after
+// the other on the same connection and merges their results
+func (c *scontext) execSplit(conn *sql.Conn, parts []stmt, vars []byte, role string) ([]byte, error) {
+	data := make([][]byte, len(parts))
+
+	for i := range parts {
+		var err error
+		if data[i], err = c.execPart(nil, conn, 0, &parts[i], vars, role); err != nil {
+			return nil, err
+		}
+	}
+
+	return mergeObjects(data), nil
+}
+
+func (c *scontext) execPart(db *sql.DB, conn *sql.Conn, i int, st *stmt, vars []byte, role string) ([]byte, error) {
+	var data []byte
+
+	if i != 0 {
+		pc, err := db.Conn(c)
+		if err != nil {
+			return nil, err
+		}
+		defer pc.Close()
+
+		if c.sg.conf.SetUserID {
+			if err := c.setLocalUserID(pc); err != nil {
+				return nil, err
+			}
+		}
+		conn = pc
+	}
+
+	args, err := c.sg.argList(c, st.md, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	_, span := startSpan(c, "sql_root")
+	defer func() { endSpan(span, err) }()
+
+	// the session variables are set in a transaction of the root
+	if len(c.sg.sessionVars) != 0 {
+		var tx *sql.Tx
+
+		if tx, err = conn.BeginTx(c, nil); err != nil {
+			return nil, err
+		}
+		defer tx.Rollback() //nolint: errcheck
+
+		if err = c.sg.setSessionVars(c, tx, role); err != nil {
+			return nil, err
+		}
+
+		if err = tx.QueryRowContext(c, st.sql, args.values...).Scan(&data); err != nil {
+			return nil, err
+		}
+		err = tx.Commit()
+		return data, err
+	}
+
+	err = conn.QueryRowContext(c, st.sql, args.values...).Scan(&data)
+	return data, err
+}
+
+// mergeObjects merges the json objects of the roots into one object
+// with the keys in the order of the roots, like a single statement
+func mergeObjects(objs [][]byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte('{')
+
+	for _, v := range objs {
+		v = bytes.TrimSpace(v)
+
+		if len(v) < 2 {
+			continue
+		}
+		if v = bytes.TrimSpace(v[1 : len(v)-1]); len(v) == 0 {
+			continue
+		}
+
+		if b.Len() != 1 {
+			b.WriteByte(',')
+		}
+		b.Write(v)
+	}
+
+	b.WriteByte('}')
+	return b.Bytes()
+}
+
+// hasParts returns true if the query is run as a statement for each root
+func (cq *cquery) hasParts() bool {
+	return len(cq.parts) != 0 && cq.q.op == qcode.QTQuery && !cq.roleArg
+}
+
+// resolveParts is resolveSQL for the queries run as a statement for each root
+func (c *scontext) resolveParts(conn *sql.Conn, cq *cquery, vars []byte, role string) (qres, error) {
+	res := qres{q: cq, role: role}
+
+	var data []byte
+	var err error
+
+	if err := c.budget.addStmts(len(cq.parts)); err != nil {
+		return res, err
+	}
+
+	st := time.Now()
+	_, span := startSpan(c, "sql")
+	if cq.parallel {
+		data, err = c.execParts(conn, cq.parts, vars, role)
+	} else {
+		data, err = c.execSplit(conn, cq.parts, vars, role)
+	}
+	endSpan(span, err)
+	res.dbTime = time.Since(st)
+
+	if err != nil {
+		return res, err
+	}
+
+	cur, err := c.sg.encryptCursor(cq.st.qc, data)
+	if err != nil {
+		return res, err
+	}
+	res.data = cur.data
+
+	if c.sg.allowList.IsPersist() {
+		if err := c.sg.allowList.Set(vars, string(cq.q.query), ""); err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestParallelRoots(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.MatchExpectationsInOrder(false)
+
+	sg, err := newTestGraph(t, &Config{ParallelRoots: 2}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`jsonb_build_object\('products', "__sj_[0-9]+"."json"\) as "__root"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": [{"id": 1}]}`))
+
+	mock.ExpectQuery(`jsonb_build_object\('users', "__sj_[0-9]+"."json"\) as "__root"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"users": [{"id": 2}]}`))
+
+	res, err := sg.GraphQL(ct, `query { products(limit: 5) { id } users(limit: 5) { id } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"users": [{"id": 2}],"products": [{"id": 1}]}`; string(res.Data) != exp {
+		t.Fatalf("expected %s got %s", exp, res.Data)
+	}
+
+	// a single root is run as is
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+
+	if _, err = sg.GraphQL(ct, `query { products(limit: 5) { id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitSQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{SplitSQLBytes: 100}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`jsonb_build_object\('users', "__sj_[0-9]+"."json"\) as "__root"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"users": [{"id": 2}]}`))
+
+	mock.ExpectQuery(`jsonb_build_object\('products', "__sj_[0-9]+"."json"\) as "__root"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": [{"id": 1}]}`))
+
+	res, err := sg.GraphQL(ct, `query { products(limit: 5) { id } users(limit: 5) { id } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"users": [{"id": 2}],"products": [{"id": 1}]}`; string(res.Data) != exp {
+		t.Fatalf("expected %s got %s", exp, res.Data)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeObjects(t *testing.T) {
+	v := mergeObjects([][]byte{[]byte(`{"a": 1}`), []byte(`{}`), []byte(` { "b": [2] } `)})
+
+	if exp := `{"a": 1,"b": [2]}`; string(v) != exp {
+		t.Fatalf("expected %s got %s", exp, v)
+	}
+}
@@ -0,0 +1,337 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+const defaultPersistedMaxEntries = 1000
+
+// Error codes of the automatic persisted query (APQ) errors
+const (
+	ErrCodePersistedQueryNotFound     = "PERSISTED_QUERY_NOT_FOUND"
+	ErrCodePersistedQueryNotSupported = "PERSISTED_QUERY_NOT_SUPPORTED"
+	ErrCodePersistedQueryRequired     = "PERSISTED_QUERY_REQUIRED"
+	ErrCodePersistedQueryHashMismatch = "PERSISTED_QUERY_HASH_MISMATCH"
+)
+
+// Errors returned by PersistedQuery, the messages of the first two are
+// the ones Apollo Client looks for to retry with the full query
+var (
+	ErrPersistedQueryNotFound = &persistedError{
+		ErrCodePersistedQueryNotFound, "PersistedQueryNotFound"}
+
+	ErrPersistedQueryNotSupported = &persistedError{
+		ErrCodePersistedQueryNotSupported, "PersistedQueryNotSupported"}
+
+	ErrPersistedQueryRequired = &persistedError{
+		ErrCodePersistedQueryRequired, "only persisted queries are allowed"}
+
+	ErrPersistedQueryHashMismatch = &persistedError{
+		ErrCodePersistedQueryHashMismatch, "provided sha does not match query"}
+)
+
+type persistedError struct {
+	code string
+	msg  string
+}
+
+func (e *persistedError) Error() string {
+	return e.msg
+}
+
+// PersistedQueries struct configures automatic persisted queries (APQ).
+// Clients send the sha256 hash of a query in place of the query and only
+// send the full query when the hash is not known yet
+type PersistedQueries struct {
+	Enable bool
+
+	// Store is where the queries are kept, it can be `memory`, `file`,
+	// `database` or `storage` (the store set in the storage config). Defaults
+	// to `storage` when it's set or else to `memory`
+	Store string
+
+	// Path is the directory of the file store, each query is
+	// a file named after its hash (eg. <sha256>.graphql)
+	Path string
+
+	// Table is the table of the database store, it needs the
+	// columns `hash text primary key` and `query text`
+	Table string
+
+	// MaxEntries is the number of queries kept by the
+	// memory store. Defaults to 1000
+	MaxEntries int `mapstructure:"max_entries"`
+
+	// Locked only allows queries already in the store, new queries
+	// are not added and requests without a hash are rejected. Use it
+	// in production with queries registered ahead of time
+	Locked bool
+}
+
+// PersistedStore is the storage of the persisted queries keyed by their
+// sha256 hash (hex). Get returns an empty string for an unknown hash
+type PersistedStore interface {
+	Get(ctx context.Context, hash string) (string, error)
+	Put(ctx context.Context, hash, query string) error
+}
+
+type apqExtensions struct {
+	PersistedQuery *struct {
+		Version int    `json:"version"`
+		Hash    string `json:"sha256Hash"`
+	} `json:"persistedQuery"`
+}
+
+var (
+	hashRe  = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	tableRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)?$`)
+)
+
+func (sg *SuperGraph) initPersisted() error {
+	pq := &sg.conf.PersistedQueries
+
+	if !pq.Enable {
+		return nil
+	}
+
+	if sg.conf.PersistedStore != nil {
+		sg.apq = sg.conf.PersistedStore
+		return nil
+	}
+
+	st := pq.Store
+	if st == "" && sg.sharedStorage() {
+		st = "storage"
+	}
+
+	switch st {
+	case "", "memory":
+		sg.apq = NewMemoryStore(pq.MaxEntries)
+
+	case "file":
+		if pq.Path == "" {
+			return errors.New("persisted_queries: path is required for the file store")
+		}
+		if err := os.MkdirAll(pq.Path, 0755); err != nil {
+			return fmt.Errorf("persisted_queries: %w", err)
+		}
+		sg.apq = NewFileStore(pq.Path)
+
+	case "database":
+		s, err := NewDBStore(sg.db, pq.Table)
+		if err != nil {
+			return err
+		}
+		sg.apq = s
+
+	case "storage":
+		sg.apq = &kvPersistedStore{kv: sg.kv}
+
+	default:
+		return fmt.Errorf("persisted_queries: unknown store '%s'", pq.Store)
+	}
+
+	return nil
+}
+
+// PersistedQuery function returns the query to run for a request using the extensions
+// of the request. If they have the hash of a persisted query (APQ) the query is looked up
+// and when a query is also sent it's saved for the hash. Requests without a hash get their
+// query back unless the persisted queries are locked.
+func (sg *SuperGraph) PersistedQuery(c context.Context, query string, ext json.RawMessage) (string, error) {
+	var e apqExtensions
+
+	if len(ext) != 0 {
+		if err := json.Unmarshal(ext, &e); err != nil {
+			return "", fmt.Errorf("extensions: %w", err)
+		}
+	}
+
+	pq := &sg.conf.PersistedQueries
+
+	if e.PersistedQuery == nil {
+		if sg.apq != nil && pq.Locked {
+			return "", ErrPersistedQueryRequired
+		}
+		return query, nil
+	}
+
+	if sg.apq == nil {
+		if query != "" {
+			return query, nil
+		}
+		return "", ErrPersistedQueryNotSupported
+	}
+
+	if e.PersistedQuery.Version != 1 {
+		return "", fmt.Errorf("persisted query: unsupported version %d", e.PersistedQuery.Version)
+	}
+
+	hash := e.PersistedQuery.Hash
+
+	if !hashRe.MatchString(hash) {
+		return "", ErrPersistedQueryHashMismatch
+	}
+
+	q, err := sg.apq.Get(c, hash)
+	if err != nil {
+		return "", err
+	}
+
+	if q != "" {
+		return q, nil
+	}
+
+	if query == "" {
+		return "", ErrPersistedQueryNotFound
+	}
+
+	if pq.Locked {
+		return "", ErrPersistedQueryRequired
+	}
+
+	if h := sha256.Sum256([]byte(query)); hex.EncodeToString(h[:]) != hash {
+		return "", ErrPersistedQueryHashMismatch
+	}
+
+	if err := sg.apq.Put(c, hash, query); err != nil {
+		return "", err
+	}
+
+	return query, nil
+}
+
+type memoryStore struct {
+	sync.RWMutex
+	max     int
+	queries map[string]string
+}
+
+// NewMemoryStore function returns a persisted query store that keeps upto max
+// queries in memory, once full a random query is dropped for each new one
+func NewMemoryStore(max int) PersistedStore {
+	if max <= 0 {
+		max = defaultPersistedMaxEntries
+	}
+	return &memoryStore{max: max, queries: make(map[string]string)}
+}
+
+func (s *memoryStore) Get(ctx context.Context, hash string) (string, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.queries[hash], nil
+}
+
+func (s *memoryStore) Put(ctx context.Context, hash, query string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.queries[hash]; !ok && len(s.queries) >= s.max {
+		for k := range s.queries {
+			delete(s.queries, k)
+			break
+		}
+	}
+	s.queries[hash] = query
+
+	return nil
+}
+
+type fileStore struct {
+	dir string
+}
+
+// NewFileStore function returns a persisted query store that keeps each query
+// in a file named after its hash in the directory. Queries can be registered
+// ahead of time by adding these files
+func NewFileStore(dir string) PersistedStore {
+	return &fileStore{dir: dir}
+}
+
+func (s *fileStore) Get(ctx context.Context, hash string) (string, error) {
+	b, err := ioutil.ReadFile(s.path(hash))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (s *fileStore) Put(ctx context.Context, hash, query string) error {
+	// written to a temp file first so a half written
+	// query is never read
+	f, err := ioutil.TempFile(s.dir, hash)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(query); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path(hash))
+}
+
+func (s *fileStore) path(hash string) string {
+	return filepath.Join(s.dir, hash+".graphql")
+}
+
+type dbStore struct {
+	db       *sql.DB
+	getQuery string
+	putQuery string
+}
+
+// NewDBStore function returns a persisted query store that keeps the queries in a
+// database table with the columns `hash text primary key` and `query text`
+func NewDBStore(db *sql.DB, table string) (PersistedStore, error) {
+	if table == "" {
+		table = "persisted_queries"
+	}
+
+	if !tableRe.MatchString(table) {
+		return nil, fmt.Errorf("persisted_queries: invalid table name '%s'", table)
+	}
+
+	return &dbStore{
+		db:       db,
+		getQuery: `SELECT query FROM ` + table + ` WHERE hash = $1`,
+		putQuery: `INSERT INTO ` + table + ` (hash, query) VALUES ($1, $2) ON CONFLICT (hash) DO NOTHING`,
+	}, nil
+}
+
+func (s *dbStore) Get(ctx context.Context, hash string) (string, error) {
+	var q string
+
+	err := s.db.QueryRowContext(ctx, s.getQuery, hash).Scan(&q)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return q, err
+}
+
+func (s *dbStore) Put(ctx context.Context, hash, query string) error {
+	_, err := s.db.ExecContext(ctx, s.putQuery, hash, query)
+	return err
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func apqExt(query string) []byte {
+	h := sha256.Sum256([]byte(query))
+	return []byte(`{"persistedQuery":{"version":1,"sha256Hash":"` + hex.EncodeToString(h[:]) + `"}}`)
+}
+
+func TestPersistedQuery(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	gql := `query { products { id } }`
+	ext := apqExt(gql)
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sg.PersistedQuery(ctx, "", ext); err != ErrPersistedQueryNotSupported {
+		t.Fatalf("expected PersistedQueryNotSupported got: %v", err)
+	}
+
+	conf := &Config{PersistedQueries: PersistedQueries{Enable: true}}
+
+	if sg, err = newTestGraph(t, conf, db, psql.GetTestDBInfo()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sg.PersistedQuery(ctx, "", ext); err != ErrPersistedQueryNotFound {
+		t.Fatalf("expected PersistedQueryNotFound got: %v", err)
+	}
+
+	if ErrorCode(ErrPersistedQueryNotFound) != ErrCodePersistedQueryNotFound {
+		t.Fatal("expected the error code of the persisted query error")
+	}
+
+	if _, err := sg.PersistedQuery(ctx, `query { users { id } }`, ext); err != ErrPersistedQueryHashMismatch {
+		t.Fatalf("expected a hash mismatch got: %v", err)
+	}
+
+	if q, err := sg.PersistedQuery(ctx, gql, ext); err != nil || q != gql {
+		t.Fatalf("expected the query to be saved got: %s, %v", q, err)
+	}
+
+	if q, err := sg.PersistedQuery(ctx, "", ext); err != nil || q != gql {
+		t.Fatalf("expected the saved query got: %s, %v", q, err)
+	}
+
+	conf.PersistedQueries.Locked = true
+
+	if _, err := sg.PersistedQuery(ctx, gql, nil); err != ErrPersistedQueryRequired {
+		t.Fatalf("expected a query without a hash to be rejected got: %v", err)
+	}
+
+	other := `query { users { id } }`
+
+	if _, err := sg.PersistedQuery(ctx, other, apqExt(other)); err != ErrPersistedQueryRequired {
+		t.Fatalf("expected a new query to be rejected got: %v", err)
+	}
+
+	if q, err := sg.PersistedQuery(ctx, "", ext); err != nil || q != gql {
+		t.Fatalf("expected the saved query got: %s, %v", q, err)
+	}
+}
+
+func TestPersistedStores(t *testing.T) {
+	ctx := context.Background()
+	hash := hex.EncodeToString(make([]byte, 32))
+
+	ms := NewMemoryStore(1)
+
+	if err := ms.Put(ctx, hash, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ms.Put(ctx, "b", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if q, _ := ms.Get(ctx, hash); q != "" {
+		t.Fatal("expected the memory store to drop a query once full")
+	}
+
+	dir, err := ioutil.TempDir("", "apq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs := NewFileStore(dir)
+
+	if q, err := fs.Get(ctx, hash); err != nil || q != "" {
+		t.Fatalf("expected no query got: %s, %v", q, err)
+	}
+
+	if err := fs.Put(ctx, hash, "query { me }"); err != nil {
+		t.Fatal(err)
+	}
+
+	if q, err := fs.Get(ctx, hash); err != nil || q != "query { me }" {
+		t.Fatalf("expected the saved query got: %s, %v", q, err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ds, err := NewDBStore(db, "apq")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT query FROM apq WHERE hash = \$1`).
+		WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows([]string{"query"}).AddRow("query { me }"))
+
+	if q, err := ds.Get(ctx, hash); err != nil || q != "query { me }" {
+		t.Fatalf("expected the saved query got: %s, %v", q, err)
+	}
+
+	if _, err := NewDBStore(db, "apq; drop table users"); err == nil {
+		t.Fatal("expected an error for an invalid table name")
+	}
+}
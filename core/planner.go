@@ -0,0 +1,596 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+const (
+	defaultPlannerSampleRate = 0.01
+	defaultPlannerMinRuns    = 100
+
+	// max number of operations the statistics are kept for,
+	// the operations seen past it are not recorded
+	maxPlannerOps = 1000
+
+	// only one query is explained at a time so the
+	// sampling never adds much load to the database
+	maxPlannerExplains = 1
+	plannerTimeout     = time.Minute
+)
+
+// Planner struct configures the statistics kept in memory for each query
+// and the tuning of the join strategies from them. Only queries are
+// recorded and not mutations or subscriptions
+type Planner struct {
+	// Stats turns on the statistics of the queries (runs and time)
+	Stats bool
+
+	// SampleRate is the fraction of the runs of a query that are run again
+	// with EXPLAIN (ANALYZE, BUFFERS) in the background for the rows read
+	// and the buffers used. Defaults to 0.01, -1 turns it off
+	SampleRate float64 `mapstructure:"sample_rate"`
+
+	// Tune picks the join strategy (lateral or subquery) of the related
+	// tables from the time of the queries using them, each strategy is
+	// tried in turn and the faster one kept. The join strategies set in
+	// the config (join_strategy) are never changed
+	Tune bool
+
+	// MinRuns is the number of runs of the queries using a join with each
+	// strategy before one is picked. Defaults to 100
+	MinRuns int `mapstructure:"min_runs"`
+}
+
+// PlannerStats struct is the statistics of the queries and the strategies
+// picked for the joins of the related tables in them
+type PlannerStats struct {
+	Operations []PlannerOpStats `json:"operations"`
+	Joins      []JoinDecision   `json:"joins"`
+}
+
+// PlannerOpStats struct is the statistics of a query, the rows read
+// (by the scans of the tables) and the buffers are the means of the
+// samples run with EXPLAIN
+type PlannerOpStats struct {
+	Fingerprint string        `json:"fingerprint"`
+	Name        string        `json:"name,omitempty"`
+	Runs        int64         `json:"runs"`
+	MeanTime    time.Duration `json:"mean_time"`
+	MaxTime     time.Duration `json:"max_time"`
+	Samples     int64         `json:"samples"`
+	Rows        float64       `json:"rows"`
+	SharedHit   float64       `json:"shared_hit_blocks"`
+	SharedRead  float64       `json:"shared_read_blocks"`
+	Joins       []string      `json:"joins,omitempty"`
+}
+
+// JoinDecision struct is the strategy a related table (child) is fetched
+// with for the rows of its parent table. State is one of tuning (the
+// strategies are being tried), tuned, pinned (set with PinJoin) or
+// config (set with join_strategy)
+type JoinDecision struct {
+	Parent           string        `json:"parent"`
+	Child            string        `json:"child"`
+	Strategy         string        `json:"strategy"`
+	State            string        `json:"state"`
+	LateralRuns      int64         `json:"lateral_runs"`
+	LateralMeanTime  time.Duration `json:"lateral_mean_time"`
+	SubqueryRuns     int64         `json:"subquery_runs"`
+	SubqueryMeanTime time.Duration `json:"subquery_mean_time"`
+}
+
+const (
+	joinTuning = "tuning"
+	joinTuned  = "tuned"
+	joinPinned = "pinned"
+	joinConfig = "config"
+)
+
+type planner struct {
+	sync.Mutex
+	conf  Planner
+	sem   chan struct{}
+	ops   map[string]*opStats
+	joins map[joinKey]*joinState
+}
+
+type opStats struct {
+	name    string
+	runs    int64
+	total   time.Duration
+	max     time.Duration
+	samples int64
+	rows    float64
+	hit     float64
+	read    float64
+	joins   []joinKey
+}
+
+type joinKey struct {
+	parent, child string
+}
+
+type joinState struct {
+	strategy psql.JoinStrategy
+	state    string
+
+	// the runs of each query using the join with each strategy,
+	// the strategies are compared on the queries run with both
+	ops map[string]*[2]runStats
+}
+
+type runStats struct {
+	runs  int64
+	total time.Duration
+}
+
+func (rs runStats) mean() time.Duration {
+	if rs.runs == 0 {
+		return 0
+	}
+	return rs.total / time.Duration(rs.runs)
+}
+
+func (sg *SuperGraph) initPlanner() error {
+	conf := sg.conf.Planner
+
+	if !conf.Stats {
+		if conf.Tune {
+			return errors.New("planner: tune needs stats to be turned on")
+		}
+		return nil
+	}
+
+	if sg.conf.DBType == "mysql" {
+		return errors.New("planner: only supported with postgres")
+	}
+
+	if conf.SampleRate == 0 {
+		conf.SampleRate = defaultPlannerSampleRate
+	}
+
+	if conf.MinRuns <= 0 {
+		conf.MinRuns = defaultPlannerMinRuns
+	}
+
+	joins, err := joinStrategies(sg.conf)
+	if err != nil {
+		return err
+	}
+
+	p := &planner{
+		conf:  conf,
+		sem:   make(chan struct{}, maxPlannerExplains),
+		ops:   make(map[string]*opStats),
+		joins: make(map[joinKey]*joinState),
+	}
+
+	for pt, m := range joins {
+		for ct, js := range m {
+			p.joins[joinKey{pt, ct}] = &joinState{strategy: js, state: joinConfig}
+		}
+	}
+
+	sg.planner = p
+	return nil
+}
+
+// recordPlan adds the run of the query to the statistics, a few
+// of the runs are explained in the background
+func (c *scontext) recordPlan(query string, cq *cquery, role string, args []interface{}, d time.Duration) {
+	p := c.sg.planner
+	if p == nil || c.op != qcode.QTQuery {
+		return
+	}
+	fp := queryFingerprint([]byte(query))
+
+	if p.record(c.sg.pc.Schema(), fp, c.name, cq.st.qc, d) {
+		c.sg.applyJoins()
+	}
+
+	if p.conf.SampleRate > 0 && rand.Float64() < p.conf.SampleRate {
+		c.sg.explainPlan(c.queryDB(role), fp, cq.st.sql, args)
+	}
+}
+
+// record adds a run of the query and returns true if
+// the strategy of one of its joins was changed
+func (p *planner) record(schema *psql.DBSchema, fp, name string, qc *qcode.QCode, d time.Duration) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	op, ok := p.ops[fp]
+	if !ok {
+		if len(p.ops) >= maxPlannerOps {
+			return false
+		}
+		op = &opStats{name: name, joins: queryJoins(schema, qc)}
+		p.ops[fp] = op
+	}
+
+	op.runs++
+	op.total += d
+	if d > op.max {
+		op.max = d
+	}
+
+	changed := false
+
+	for _, k := range op.joins {
+		js, ok := p.joins[k]
+		if !ok {
+			js = &joinState{strategy: psql.JoinLateral, state: joinTuning}
+			p.joins[k] = js
+		}
+		if js.ops == nil {
+			js.ops = make(map[string]*[2]runStats)
+		}
+
+		rs, ok := js.ops[fp]
+		if !ok {
+			rs = &[2]runStats{}
+			js.ops[fp] = rs
+		}
+		rs[js.strategy].runs++
+		rs[js.strategy].total += d
+
+		if p.conf.Tune && js.state == joinTuning && js.tune(int64(p.conf.MinRuns)) {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// tune tries the other strategy once the current one has enough runs and
+// picks the faster one once both have, it returns true if the strategy
+// was changed
+func (js *joinState) tune(minRuns int64) bool {
+	cur := js.strategy
+	other := psql.JoinLateral
+	if cur == psql.JoinLateral {
+		other = psql.JoinSubquery
+	}
+
+	tot := js.totals()
+
+	switch {
+	case tot[cur].runs < minRuns:
+		return false
+
+	case tot[other].runs < minRuns:
+		js.strategy = other
+		return true
+	}
+
+	// the mean time of each query with each strategy weighted by its runs,
+	// only the queries run with both are compared unless there are none
+	var cost [2]float64
+	for _, rs := range js.ops {
+		if rs[0].runs == 0 || rs[1].runs == 0 {
+			continue
+		}
+		w := float64(rs[0].runs + rs[1].runs)
+		cost[0] += w * float64(rs[0].mean())
+		cost[1] += w * float64(rs[1].mean())
+	}
+
+	if cost[0] == 0 && cost[1] == 0 {
+		cost[0], cost[1] = float64(tot[0].mean()), float64(tot[1].mean())
+	}
+
+	js.state = joinTuned
+	js.strategy = psql.JoinLateral
+	if cost[psql.JoinSubquery] < cost[psql.JoinLateral] {
+		js.strategy = psql.JoinSubquery
+	}
+
+	return js.strategy != cur
+}
+
+// totals returns the runs and time of all the queries with each strategy
+func (js *joinState) totals() [2]runStats {
+	var tot [2]runStats
+
+	for _, rs := range js.ops {
+		for i := range rs {
+			tot[i].runs += rs[i].runs
+			tot[i].total += rs[i].total
+		}
+	}
+	return tot
+}
+
+// queryJoins returns the related tables of the query that can be
+// fetched with either strategy (eg. not the ones with a cursor)
+func queryJoins(schema *psql.DBSchema, qc *qcode.QCode) []joinKey {
+	var keys []joinKey
+
+	for i := range qc.Selects {
+		sel := &qc.Selects[i]
+
+		if sel.ParentID == -1 || sel.Type != qcode.STNone ||
+			sel.Paging.Type != qcode.PtOffset ||
+			sel.SkipRender != qcode.SkipTypeNone || sel.Find != qcode.FindNone {
+			continue
+		}
+
+		k := joinKey{
+			parent: tableName(schema, qc.Selects[sel.ParentID].Name),
+			child:  tableName(schema, sel.Name),
+		}
+
+		found := false
+		for _, k1 := range keys {
+			if k1 == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+func tableName(schema *psql.DBSchema, name string) string {
+	if ti, err := schema.GetTableInfo(name); err == nil {
+		return ti.Name
+	}
+	return strings.ToLower(name)
+}
+
+// applyJoins sets the strategies picked and pinned on the compiler, the
+// compiled queries are dropped so they are compiled again with them.
+// The queries of the allow list are compiled once and only get them
+// on a restart
+func (sg *SuperGraph) applyJoins() {
+	p := sg.planner
+
+	p.Lock()
+	joins := make(map[string]map[string]psql.JoinStrategy)
+
+	for k, js := range p.joins {
+		if joins[k.parent] == nil {
+			joins[k.parent] = make(map[string]psql.JoinStrategy)
+		}
+		joins[k.parent][k.child] = js.strategy
+	}
+	p.Unlock()
+
+	sg.pc.SetJoins(joins)
+
+	if sg.compiled != nil {
+		sg.compiled.flush()
+	}
+}
+
+// explainPlan runs the query with EXPLAIN (ANALYZE, BUFFERS) in the
+// background and adds the rows read and the buffers to the statistics
+func (sg *SuperGraph) explainPlan(db *sql.DB, fp, query string, args []interface{}) {
+	p := sg.planner
+
+	select {
+	case p.sem <- struct{}{}:
+	default:
+		return
+	}
+
+	go func() {
+		defer func() { <-p.sem }()
+
+		ct, cancel := context.WithTimeout(context.Background(), plannerTimeout)
+		defer cancel()
+
+		var b []byte
+
+		err := db.QueryRowContext(ct, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "+query, args...).Scan(&b)
+		if err != nil {
+			sg.log.Printf("WRN planner: %s", err)
+			return
+		}
+
+		var plans []struct {
+			Plan planNode
+		}
+
+		if err := json.Unmarshal(b, &plans); err != nil || len(plans) == 0 {
+			sg.log.Printf("WRN planner: invalid plan: %v", err)
+			return
+		}
+		pn := &plans[0].Plan
+
+		p.Lock()
+		defer p.Unlock()
+
+		if op, ok := p.ops[fp]; ok {
+			op.samples++
+			op.rows += pn.rowsRead()
+			op.hit += pn.SharedHit
+			op.read += pn.SharedRead
+		}
+	}()
+}
+
+// planNode is a node of the plan returned by EXPLAIN (FORMAT JSON),
+// the buffers include the ones of the nodes under it
+type planNode struct {
+	Relation   string     `json:"Relation Name"`
+	Rows       float64    `json:"Actual Rows"`
+	Loops      float64    `json:"Actual Loops"`
+	SharedHit  float64    `json:"Shared Hit Blocks"`
+	SharedRead float64    `json:"Shared Read Blocks"`
+	Plans      []planNode `json:"Plans"`
+}
+
+// rowsRead returns the rows returned by the scans of the tables in the plan
+func (pn *planNode) rowsRead() float64 {
+	var n float64
+
+	if pn.Relation != "" {
+		n = pn.Rows * pn.Loops
+	}
+	for i := range pn.Plans {
+		n += pn.Plans[i].rowsRead()
+	}
+	return n
+}
+
+// PlannerStats function returns the statistics of the queries
+// and the strategies of the joins in them (planner)
+func (sg *SuperGraph) PlannerStats() PlannerStats {
+	var ps PlannerStats
+
+	p := sg.planner
+	if p == nil {
+		return ps
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	for fp, op := range p.ops {
+		v := PlannerOpStats{
+			Fingerprint: fp,
+			Name:        op.name,
+			Runs:        op.runs,
+			MeanTime:    runStats{op.runs, op.total}.mean(),
+			MaxTime:     op.max,
+			Samples:     op.samples,
+		}
+
+		if op.samples != 0 {
+			n := float64(op.samples)
+			v.Rows, v.SharedHit, v.SharedRead = op.rows/n, op.hit/n, op.read/n
+		}
+
+		for _, k := range op.joins {
+			v.Joins = append(v.Joins, k.parent+"."+k.child)
+		}
+		ps.Operations = append(ps.Operations, v)
+	}
+
+	for k, js := range p.joins {
+		tot := js.totals()
+
+		ps.Joins = append(ps.Joins, JoinDecision{
+			Parent:           k.parent,
+			Child:            k.child,
+			Strategy:         joinStrategyName(js.strategy),
+			State:            js.state,
+			LateralRuns:      tot[psql.JoinLateral].runs,
+			LateralMeanTime:  tot[psql.JoinLateral].mean(),
+			SubqueryRuns:     tot[psql.JoinSubquery].runs,
+			SubqueryMeanTime: tot[psql.JoinSubquery].mean(),
+		})
+	}
+
+	// slowest first
+	sort.Slice(ps.Operations, func(i, j int) bool {
+		return ps.Operations[i].MeanTime > ps.Operations[j].MeanTime
+	})
+
+	sort.Slice(ps.Joins, func(i, j int) bool {
+		a, b := ps.Joins[i], ps.Joins[j]
+		if a.Parent != b.Parent {
+			return a.Parent < b.Parent
+		}
+		return a.Child < b.Child
+	})
+
+	return ps
+}
+
+// PinJoin function sets the strategy (lateral or subquery) a related table
+// (child) is fetched with for the rows of its parent, it's not changed by
+// the tuning till unpinned
+func (sg *SuperGraph) PinJoin(parent, child, strategy string) error {
+	var js psql.JoinStrategy
+
+	switch strings.ToLower(strategy) {
+	case "lateral":
+		js = psql.JoinLateral
+	case "subquery":
+		js = psql.JoinSubquery
+	default:
+		return fmt.Errorf("planner: unknown join strategy '%s'", strategy)
+	}
+
+	return sg.setJoin(parent, child, func(st *joinState) error {
+		st.strategy = js
+		st.state = joinPinned
+		return nil
+	})
+}
+
+// UnpinJoin function drops the strategy pinned for a related table, the
+// strategies are tried again when tuning (planner.tune) else the lateral
+// join is used
+func (sg *SuperGraph) UnpinJoin(parent, child string) error {
+	return sg.setJoin(parent, child, func(st *joinState) error {
+		if st.state != joinPinned {
+			return fmt.Errorf("planner: join %s.%s is not pinned", parent, child)
+		}
+		st.strategy = psql.JoinLateral
+		st.state = joinTuning
+		st.ops = nil
+		return nil
+	})
+}
+
+func (sg *SuperGraph) setJoin(parent, child string, fn func(*joinState) error) error {
+	p := sg.planner
+	if p == nil {
+		return errors.New("planner: stats not turned on (planner.stats)")
+	}
+
+	schema := sg.pc.Schema()
+	k := joinKey{tableName(schema, parent), tableName(schema, child)}
+
+	if _, err := schema.GetRel(k.child, k.parent); err != nil {
+		return fmt.Errorf("planner: %w", err)
+	}
+
+	p.Lock()
+	js, ok := p.joins[k]
+	if !ok {
+		js = &joinState{strategy: psql.JoinLateral, state: joinTuning}
+	}
+
+	if js.state == joinConfig {
+		p.Unlock()
+		return fmt.Errorf("planner: join %s.%s is set in the config (join_strategy)",
+			k.parent, k.child)
+	}
+
+	if err := fn(js); err != nil {
+		p.Unlock()
+		return err
+	}
+	p.joins[k] = js
+	p.Unlock()
+
+	sg.applyJoins()
+	return nil
+}
+
+func joinStrategyName(js psql.JoinStrategy) string {
+	if js == psql.JoinSubquery {
+		return "subquery"
+	}
+	return "lateral"
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestPlannerTuneJoins(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Planner: Planner{Stats: true, Tune: true, MinRuns: 2, SampleRate: -1}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.Background()
+	gql := `query getProducts { products(limit: 5) { id user { full_name } } }`
+
+	run := func(re string, d time.Duration) {
+		mock.ExpectQuery(re).WillDelayFor(d).
+			WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+
+		if _, err := sg.GraphQL(ct, gql, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lateral := `LATERAL .* LATERAL`
+	subquery := `\(SELECT "__sj_1"\."json" FROM`
+
+	// each strategy is tried in turn and the faster one kept
+	run(lateral, 20*time.Millisecond)
+	run(lateral, 20*time.Millisecond)
+	run(subquery, 0)
+	run(subquery, 0)
+	run(subquery, 0)
+
+	ps := sg.PlannerStats()
+
+	if len(ps.Operations) != 1 || ps.Operations[0].Name != "getProducts" ||
+		ps.Operations[0].Runs != 5 || ps.Operations[0].Joins[0] != "products.users" {
+		t.Fatalf("unexpected operations: %+v", ps.Operations)
+	}
+
+	if len(ps.Joins) != 1 {
+		t.Fatalf("expected one join: %+v", ps.Joins)
+	}
+
+	jd := ps.Joins[0]
+	if jd.Strategy != "subquery" || jd.State != joinTuned ||
+		jd.LateralRuns != 2 || jd.SubqueryRuns != 3 {
+		t.Fatalf("unexpected join: %+v", jd)
+	}
+
+	// a pinned strategy is kept
+	if err := sg.PinJoin("products", "users", "lateral"); err != nil {
+		t.Fatal(err)
+	}
+	run(lateral, 0)
+
+	if jd := sg.PlannerStats().Joins[0]; jd.Strategy != "lateral" || jd.State != joinPinned {
+		t.Fatalf("expected the join to be pinned: %+v", jd)
+	}
+
+	if err := sg.UnpinJoin("products", "users"); err != nil {
+		t.Fatal(err)
+	}
+
+	if jd := sg.PlannerStats().Joins[0]; jd.State != joinTuning || jd.LateralRuns != 0 {
+		t.Fatalf("expected the join to be tuned again: %+v", jd)
+	}
+
+	if err := sg.UnpinJoin("products", "users"); err == nil {
+		t.Fatal("expected an error for a join not pinned")
+	}
+
+	if err := sg.PinJoin("products", "users", "hash"); err == nil {
+		t.Fatal("expected an error for an unknown strategy")
+	}
+
+	if err := sg.PinJoin("products", "unknown", "lateral"); err == nil {
+		t.Fatal("expected an error for an unknown relationship")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlannerExplain(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		Planner: Planner{Stats: true, SampleRate: 1},
+		Tables: []Table{{
+			Name:         "products",
+			JoinStrategy: map[string]string{"users": "subquery"},
+		}},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+	mock.ExpectQuery(`EXPLAIN \(ANALYZE, BUFFERS, FORMAT JSON\) SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"plan"}).AddRow(`[{"Plan": {
+			"Shared Hit Blocks": 12, "Shared Read Blocks": 3, "Plans": [
+				{"Relation Name": "products", "Actual Rows": 5, "Actual Loops": 1},
+				{"Relation Name": "users", "Actual Rows": 1, "Actual Loops": 5}
+			]}}]`))
+
+	gql := `query { products(limit: 5) { id user { full_name } } }`
+
+	if _, err := sg.GraphQL(context.Background(), gql, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var op PlannerOpStats
+
+	waitFor(t, "expected the query to be explained", func() bool {
+		ps := sg.PlannerStats()
+		if len(ps.Operations) == 1 {
+			op = ps.Operations[0]
+		}
+		return op.Samples == 1
+	})
+
+	if op.Rows != 10 || op.SharedHit != 12 || op.SharedRead != 3 {
+		t.Fatalf("unexpected stats: %+v", op)
+	}
+
+	// the strategies set in the config can't be pinned
+	if jd := sg.PlannerStats().Joins; len(jd) != 1 || jd[0].State != joinConfig {
+		t.Fatalf("unexpected joins: %+v", jd)
+	}
+
+	if err := sg.PinJoin("products", "users", "lateral"); err == nil {
+		t.Fatal("expected an error for a join set in the config")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
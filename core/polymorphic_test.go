@@ -0,0 +1,82 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+func TestPolymorphicTypes(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		Tables: []Table{{
+			Name:    "subject",
+			Type:    "polymorphic",
+			Columns: []Column{{Name: "subject_id", ForeignKey: "subject_type.id"}},
+			Types: []PolymorphicType{
+				{Name: "Product", Table: "products"},
+				{Name: "User", Table: "users"},
+			},
+		}},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := `query {
+		notifications {
+			id
+			subject {
+				... on Product { name }
+				... on User { email }
+			}
+		}
+	}`
+
+	cq := &cquery{q: rquery{op: qcode.QTQuery, query: []byte(gql)}}
+
+	if err := sg.compileQuery(cq, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{`= 'Product' THEN`, `= 'User' THEN`, `= ('Product')`, `"products"."name"`} {
+		if !strings.Contains(cq.st.sql, v) {
+			t.Fatalf("expected %s: %s", v, cq.st.sql)
+		}
+	}
+
+	if strings.Contains(cq.st.sql, `'products'`) {
+		t.Fatalf("unexpected table name as the type: %s", cq.st.sql)
+	}
+}
+
+func TestPolymorphicTypesUnknownTable(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		Tables: []Table{{
+			Name:    "subject",
+			Type:    "polymorphic",
+			Columns: []Column{{Name: "subject_id", ForeignKey: "subject_type.id"}},
+			Types:   []PolymorphicType{{Name: "Service", Table: "services"}},
+		}},
+	}
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for an unknown table")
+	}
+}
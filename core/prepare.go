@@ -8,15 +8,21 @@ import (
 	"sync"
 
 	"github.com/dosco/super-graph/core/internal/allow"
+	"github.com/dosco/super-graph/core/internal/psql"
 	"github.com/dosco/super-graph/core/internal/qcode"
 )
 
 type cquery struct {
 	sync.Once
-	q       rquery
-	stmts   []stmt
-	st      stmt
-	roleArg bool
+	q        rquery
+	md       psql.Metadata // compile options (eg. set by feature flags)
+	stmts    []stmt
+	st       stmt
+	parts    []stmt // the statements of the roots run on their own
+	parallel bool   // the parts are run at the same time
+	roleArg  bool
+	cached   bool          // taken from the compile cache
+	frags    *SQLFragments // added by a trusted caller
 }
 
 type rquery struct {
@@ -73,11 +79,23 @@ func (sg *SuperGraph) initAllowList() error {
 		ac = allow.Config{CreateIfNotExists: true, Persist: true, Log: sg.log}
 	}
 
+	// the list is kept in the storage so all
+	// the instances share it
+	if sg.sharedStorage() {
+		ac.Store = &kvAllowStore{kv: sg.kv}
+	}
+
 	sg.allowList, err = allow.New(sg.conf.AllowListFile, ac)
 	if err != nil {
 		return fmt.Errorf("failed to initialize allow list: %w", err)
 	}
 
+	if sg.conf.QueryRegistry != "" {
+		if sg.registry, err = OpenQueryRegistry(sg.conf.QueryRegistry); err != nil {
+			return err
+		}
+	}
+
 	// List is presistant in dev mode so don't go ahead and set
 	// the queries struct
 	if sg.allowList.IsPersist() {
@@ -86,7 +104,7 @@ func (sg *SuperGraph) initAllowList() error {
 
 	sg.queries = make(map[string]*cquery)
 
-	list, err := sg.allowList.Load()
+	list, err := sg.allowedQueries()
 	if err != nil {
 		return err
 	}
@@ -117,3 +135,12 @@ func (sg *SuperGraph) initAllowList() error {
 
 	return nil
 }
+
+// allowedQueries returns the queries of the allow list or the
+// current versions of the queries in the registry when it's set
+func (sg *SuperGraph) allowedQueries() ([]allow.Item, error) {
+	if sg.registry != nil {
+		return sg.registry.items()
+	}
+	return sg.allowList.Load()
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"sort"
+	"strings"
+)
+
+// privilegesQuery returns the privileges of the database user on the tables
+// of the schemas (comma seperated)
+const privilegesQuery = `SELECT n.nspname, c.relname,
+	has_table_privilege(c.oid, 'SELECT'),
+	has_table_privilege(c.oid, 'INSERT'),
+	has_table_privilege(c.oid, 'UPDATE'),
+	has_table_privilege(c.oid, 'DELETE')
+FROM pg_catalog.pg_class c
+	JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r', 'v', 'm', 'f', 'p')
+	AND n.nspname = ANY(string_to_array($1, ','))`
+
+// tablePrivs are the privileges of the database user on a table
+type tablePrivs struct {
+	query, insert, update, delete bool
+}
+
+// checkPrivileges logs a warning when the privileges of the database user
+// don't match what the roles can do with the tables (eg. a role can insert
+// into a table the user can't insert into) or when the user can write to
+// the tables in read only mode
+func (sg *SuperGraph) checkPrivileges() {
+	if sg.conf.DBType == "mysql" {
+		return
+	}
+
+	privs, err := sg.tablePrivileges()
+	if err != nil {
+		sg.log.Printf("WRN privileges check: %s", err)
+		return
+	}
+
+	for _, w := range sg.privilegeWarnings(privs) {
+		sg.log.Printf("WRN %s", w)
+	}
+}
+
+// tablePrivileges returns the privileges of the database user
+// keyed by the name the tables are selected with
+func (sg *SuperGraph) tablePrivileges() (map[string]tablePrivs, error) {
+	names := make(map[string]string)
+	schemas := []string{sg.dbSchemaName()}
+
+	for _, t := range sg.dbinfo.Tables {
+		// json and virtual tables are not in the database
+		switch {
+		case t.Blocked:
+			continue
+		case t.Type != "table" && t.Type != "view" &&
+			t.Type != "materialized view" && t.Type != "foreign table":
+			continue
+		}
+
+		if t.Schema == "" {
+			names[sg.dbSchemaName()+"."+t.Name] = t.Name
+			continue
+		}
+
+		names[t.Schema+"."+t.Table] = t.Name
+
+		if !inList(schemas, t.Schema) {
+			schemas = append(schemas, t.Schema)
+		}
+	}
+
+	rows, err := sg.db.Query(privilegesQuery, strings.Join(schemas, ","))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	privs := make(map[string]tablePrivs)
+
+	for rows.Next() {
+		var s, t string
+		var p tablePrivs
+
+		if err := rows.Scan(&s, &t, &p.query, &p.insert, &p.update, &p.delete); err != nil {
+			return nil, err
+		}
+
+		if name, ok := names[s+"."+t]; ok {
+			privs[name] = p
+		}
+	}
+
+	return privs, rows.Err()
+}
+
+// privilegeWarnings returns the mismatches between the privileges
+// of the database user and what the roles can do with the tables
+func (sg *SuperGraph) privilegeWarnings(privs map[string]tablePrivs) []string {
+	var noQuery, noInsert, noUpdate, noDelete, canWrite []string
+
+	for table, p := range privs {
+		var ta tableAccess
+
+		for _, ro := range sg.roles {
+			a := sg.tableAccess(ro, table)
+			ta.query = ta.query || a.query
+			ta.insert = ta.insert || a.insert
+			ta.update = ta.update || a.update
+			ta.delete = ta.delete || a.delete
+		}
+
+		if ta.query && !p.query {
+			noQuery = append(noQuery, table)
+		}
+		if ta.insert && !p.insert {
+			noInsert = append(noInsert, table)
+		}
+		if ta.update && !p.update {
+			noUpdate = append(noUpdate, table)
+		}
+		if ta.delete && !p.delete {
+			noDelete = append(noDelete, table)
+		}
+		if sg.conf.ReadOnly && (p.insert || p.update || p.delete) {
+			canWrite = append(canWrite, table)
+		}
+	}
+
+	var warns []string
+
+	add := func(tables []string, msg string) {
+		if len(tables) != 0 {
+			sort.Strings(tables)
+			warns = append(warns, msg+": "+strings.Join(tables, ", "))
+		}
+	}
+
+	add(noQuery, "database user can't SELECT from tables queries can select")
+	add(noInsert, "database user can't INSERT into tables mutations can insert into (set read_only for a query only deployment)")
+	add(noUpdate, "database user can't UPDATE tables mutations can update (set read_only for a query only deployment)")
+	add(noDelete, "database user can't DELETE from tables mutations can delete from (set read_only for a query only deployment)")
+	add(canWrite, "read_only is set but the database user can write to tables (use a database role with only SELECT)")
+
+	return warns
+}
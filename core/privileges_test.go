@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	_log "log"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestCheckPrivileges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{DefaultBlock: true, Roles: []Role{{
+		Name:   "user",
+		Tables: []RoleTable{{Name: "products", ReadOnly: true}},
+	}}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	sg.log = _log.New(&buf, "", 0)
+
+	cols := []string{"nspname", "relname", "select", "insert", "update", "delete"}
+
+	mock.ExpectQuery(`has_table_privilege`).
+		WithArgs("public").
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow("public", "users", true, false, false, false).
+			AddRow("public", "products", true, false, false, false).
+			AddRow("public", "customers", false, true, true, true).
+			AddRow("public", "schema_migrations", true, true, true, true))
+
+	sg.checkPrivileges()
+
+	exp := []string{
+		"WRN database user can't SELECT from tables queries can select: customers",
+		"WRN database user can't INSERT into tables mutations can insert into (set read_only for a query only deployment): users",
+		"WRN database user can't DELETE from tables mutations can delete from (set read_only for a query only deployment): users",
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(buf.String(), v) {
+			t.Fatalf("expected '%s' in: %s", v, buf.String())
+		}
+	}
+
+	// the role can't write to products
+	if strings.Contains(buf.String(), "products") {
+		t.Fatalf("unexpected warning for products: %s", buf.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	sg.conf.ReadOnly = true
+
+	mock.ExpectQuery(`has_table_privilege`).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow("public", "users", true, false, false, false).
+			AddRow("public", "customers", true, true, false, false))
+
+	sg.checkPrivileges()
+
+	if w := "WRN read_only is set but the database user can write to tables (use a database role with only SELECT): customers"; strings.TrimSpace(buf.String()) != w {
+		t.Fatalf("expected '%s' got: %s", w, buf.String())
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{ReadOnly: true}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	_, err = sg.GraphQL(ct, `mutation { products(insert: $data) { id } }`, []byte(`{"data": {"name": "a"}}`))
+	if ErrorCode(err) != ErrCodeRoleForbidden {
+		t.Fatalf("expected a role forbidden error got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisTimeout = 3 * time.Second
+	redisMaxIdle = 8
+)
+
+// redisClient is a small client of the redis protocol (RESP) with
+// a pool of idle connections, it's shared by the redis stores
+type redisClient struct {
+	addr     string
+	password string
+	db       int
+	conns    chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// newRedisClient returns a client of the redis server at
+// the url (eg. redis://:password@localhost:6379/0)
+func newRedisClient(u string) (*redisClient, error) {
+	if u == "" {
+		return nil, errors.New("url is required for the redis store")
+	}
+
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if pu.Scheme != "redis" {
+		return nil, fmt.Errorf("redis url expected: %s", u)
+	}
+
+	s := &redisClient{
+		addr:  pu.Host,
+		conns: make(chan *redisConn, redisMaxIdle),
+	}
+
+	if pu.Port() == "" {
+		s.addr = net.JoinHostPort(pu.Hostname(), "6379")
+	}
+
+	if pu.User != nil {
+		if v, ok := pu.User.Password(); ok {
+			s.password = v
+		} else {
+			s.password = pu.User.Username()
+		}
+	}
+
+	if v := strings.Trim(pu.Path, "/"); v != "" {
+		if s.db, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid redis database: %s", v)
+		}
+	}
+
+	return s, nil
+}
+
+// do runs a command and returns its reply, a connection is only
+// put back for reuse when the reply was read in full
+func (s *redisClient) do(ctx context.Context, args ...string) (interface{}, error) {
+	rc, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := rc.do(ctx, args...)
+
+	var re redisError
+	if err != nil && !errors.As(err, &re) {
+		rc.Close()
+		return nil, err
+	}
+
+	select {
+	case s.conns <- rc:
+	default:
+		rc.Close()
+	}
+
+	return v, err
+}
+
+func (s *redisClient) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case rc := <-s.conns:
+		return rc, nil
+	default:
+	}
+
+	return s.dial(ctx)
+}
+
+// dial opens a new connection that's not from the pool
+func (s *redisClient) dial(ctx context.Context) (*redisConn, error) {
+	d := net.Dialer{Timeout: redisTimeout}
+
+	c, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{Conn: c, r: bufio.NewReader(c)}
+
+	if s.password != "" {
+		if _, err := rc.do(ctx, "AUTH", s.password); err != nil {
+			rc.Close()
+			return nil, err
+		}
+	}
+
+	if s.db != 0 {
+		if _, err := rc.do(ctx, "SELECT", strconv.Itoa(s.db)); err != nil {
+			rc.Close()
+			return nil, err
+		}
+	}
+
+	return rc, nil
+}
+
+func (rc *redisConn) do(ctx context.Context, args ...string) (interface{}, error) {
+	dl, ok := ctx.Deadline()
+	if !ok {
+		dl = time.Now().Add(redisTimeout)
+	}
+
+	if err := rc.SetDeadline(dl); err != nil {
+		return nil, err
+	}
+
+	if err := rc.send(args...); err != nil {
+		return nil, err
+	}
+
+	return readRedisReply(rc.r)
+}
+
+// send writes a command without reading its reply
+func (rc *redisConn) send(args ...string) error {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+
+	_, err := rc.Write(b.Bytes())
+	return err
+}
+
+// readRedisReply reads a reply in the redis protocol (RESP), bulk strings
+// are returned as []byte and arrays as []interface{}
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return nil, redisError(line[1:])
+
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		vals := make([]interface{}, n)
+		for i := range vals {
+			if vals[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return vals, nil
+	}
+
+	return nil, fmt.Errorf("redis: unknown reply: %s", line)
+}
@@ -0,0 +1,298 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dosco/super-graph/core/internal/allow"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// QueryVersion is an approved version of a query in the registry,
+// it's addressed by the sha256 hash of the query
+type QueryVersion struct {
+	Hash       string          `json:"hash"`
+	Query      string          `json:"query"`
+	Vars       json.RawMessage `json:"vars,omitempty"`
+	Comment    string          `json:"comment,omitempty"`
+	Author     string          `json:"author,omitempty"`
+	ApprovedBy string          `json:"approved_by,omitempty"`
+	ApprovedAt time.Time       `json:"approved_at"`
+}
+
+// RegistryQuery is a named query in the registry with its
+// versions oldest first, the last one is the current version
+type RegistryQuery struct {
+	Name     string         `json:"name"`
+	Versions []QueryVersion `json:"versions"`
+}
+
+// Current returns the current version of the query
+func (q RegistryQuery) Current() QueryVersion {
+	return q.Versions[len(q.Versions)-1]
+}
+
+// QueryApproval is a query approved to be added to the registry
+type QueryApproval struct {
+	Query      string          `json:"query"`
+	Vars       json.RawMessage `json:"vars,omitempty"`
+	Comment    string          `json:"comment,omitempty"`
+	Author     string          `json:"author,omitempty"`
+	ApprovedBy string          `json:"approved_by"`
+}
+
+// QueryRegistry is a file of the approved queries with their history, in
+// production (use_allow_list) the current versions are the queries that can
+// run instead of the ones in the allow list. It's for larger teams that need
+// to know who wrote and approved each version of a query
+type QueryRegistry struct {
+	path string
+
+	// mu is held while the file is rewritten
+	mu sync.Mutex
+}
+
+type registryFile struct {
+	Queries []RegistryQuery `json:"queries"`
+}
+
+// OpenQueryRegistry function opens the registry file at the path,
+// it's created when the first query is approved
+func OpenQueryRegistry(path string) (*QueryRegistry, error) {
+	if path == "" {
+		return nil, errors.New("query registry: path required")
+	}
+
+	r := &QueryRegistry{path: path}
+
+	if _, err := r.load(); err != nil {
+		return nil, fmt.Errorf("query registry: %w", err)
+	}
+	return r, nil
+}
+
+// List returns the queries in the registry by name
+func (r *QueryRegistry) List() ([]RegistryQuery, error) {
+	return r.load()
+}
+
+// Get returns the named query with its versions
+func (r *QueryRegistry) Get(name string) (RegistryQuery, error) {
+	list, err := r.load()
+	if err != nil {
+		return RegistryQuery{}, err
+	}
+
+	if i := findQuery(list, name); i != -1 {
+		return list[i], nil
+	}
+	return RegistryQuery{}, fmt.Errorf("query not found: %s", name)
+}
+
+// Version returns the version of a query with the hash
+func (r *QueryRegistry) Version(hash string) (QueryVersion, error) {
+	list, err := r.load()
+	if err != nil {
+		return QueryVersion{}, err
+	}
+
+	for _, q := range list {
+		for _, v := range q.Versions {
+			if v.Hash == hash {
+				return v, nil
+			}
+		}
+	}
+	return QueryVersion{}, fmt.Errorf("query version not found: %s", hash)
+}
+
+// Approve adds the query as the current version of the query with its name.
+// Approving the current version again changes nothing and an older version
+// is added again as the current one
+func (r *QueryRegistry) Approve(a QueryApproval) (QueryVersion, error) {
+	name := Name(a.Query)
+	if name == "" {
+		return QueryVersion{}, errors.New("query must be named")
+	}
+
+	if a.ApprovedBy == "" {
+		return QueryVersion{}, errors.New("approved_by required")
+	}
+
+	op, err := qcode.Parse([]byte(a.Query))
+	if err != nil {
+		return QueryVersion{}, err
+	}
+	qcode.FreeOperation(op)
+
+	v := QueryVersion{
+		Hash:       queryHash(a.Query),
+		Query:      a.Query,
+		Vars:       a.Vars,
+		Comment:    a.Comment,
+		Author:     a.Author,
+		ApprovedBy: a.ApprovedBy,
+		ApprovedAt: time.Now().UTC(),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list, err := r.load()
+	if err != nil {
+		return QueryVersion{}, err
+	}
+
+	i := findQuery(list, name)
+
+	if i == -1 {
+		list = append(list, RegistryQuery{Name: name})
+		i = len(list) - 1
+	} else if cur := list[i].Current(); cur.Hash == v.Hash {
+		return cur, nil
+	}
+
+	list[i].Versions = append(list[i].Versions, v)
+
+	return v, r.write(list)
+}
+
+// Rollback makes an older version of the named query the current one
+func (r *QueryRegistry) Rollback(name, hash, approvedBy string) (QueryVersion, error) {
+	q, err := r.Get(name)
+	if err != nil {
+		return QueryVersion{}, err
+	}
+
+	for _, v := range q.Versions {
+		if v.Hash == hash {
+			return r.Approve(QueryApproval{
+				Query:      v.Query,
+				Vars:       v.Vars,
+				Comment:    v.Comment,
+				Author:     v.Author,
+				ApprovedBy: approvedBy,
+			})
+		}
+	}
+	return QueryVersion{}, fmt.Errorf("query version not found: %s", hash)
+}
+
+// Remove deletes the named query and its versions from the registry
+func (r *QueryRegistry) Remove(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	i := findQuery(list, name)
+	if i == -1 {
+		return fmt.Errorf("query not found: %s", name)
+	}
+
+	return r.write(append(list[:i], list[i+1:]...))
+}
+
+// items returns the current versions of the queries as allow list items
+func (r *QueryRegistry) items() ([]allow.Item, error) {
+	list, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]allow.Item, 0, len(list))
+
+	for _, q := range list {
+		v := q.Current()
+
+		items = append(items, allow.Item{
+			Name:    q.Name,
+			Query:   v.Query,
+			Vars:    string(v.Vars),
+			Comment: v.Comment,
+			Tags:    allow.ParseTags(v.Comment),
+		})
+	}
+	return items, nil
+}
+
+func (r *QueryRegistry) load() ([]RegistryQuery, error) {
+	b, err := ioutil.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rf registryFile
+
+	if err := json.Unmarshal(b, &rf); err != nil {
+		return nil, fmt.Errorf("%s: %w", r.path, err)
+	}
+
+	for _, q := range rf.Queries {
+		if len(q.Versions) == 0 {
+			return nil, fmt.Errorf("%s: query %s has no versions", r.path, q.Name)
+		}
+	}
+	return rf.Queries, nil
+}
+
+func (r *QueryRegistry) write(list []RegistryQuery) error {
+	sort.Slice(list, func(i, j int) bool {
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+
+	b, err := json.MarshalIndent(registryFile{Queries: list}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// written to a temp file first so a half
+	// written registry is never read
+	f, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path))
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), r.path)
+}
+
+func findQuery(list []RegistryQuery, name string) int {
+	for i := range list {
+		if strings.EqualFold(list[i].Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func queryHash(query string) string {
+	h := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestQueryRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reg, err := OpenQueryRegistry(filepath.Join(dir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reg.Approve(QueryApproval{Query: `query { products { id } }`, ApprovedBy: "jo"}); err == nil {
+		t.Fatal("expected an error for a query without a name")
+	}
+
+	if _, err := reg.Approve(QueryApproval{Query: `query getProducts { products { id } }`}); err == nil {
+		t.Fatal("expected an error without an approver")
+	}
+
+	v1, err := reg.Approve(QueryApproval{
+		Query:      `query getProducts { products { id } }`,
+		Author:     "sam",
+		ApprovedBy: "jo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// approving the current version again adds no version
+	if v, err := reg.Approve(QueryApproval{Query: `query getProducts { products { id } }`, ApprovedBy: "al"}); err != nil || v.Hash != v1.Hash || v.ApprovedBy != "jo" {
+		t.Fatalf("expected the current version got %v (%v)", v, err)
+	}
+
+	v2, err := reg.Approve(QueryApproval{
+		Query:      `query getProducts { products { id name } }`,
+		Comment:    "@owner:catalog",
+		ApprovedBy: "jo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v2.Hash == v1.Hash {
+		t.Fatal("expected the versions to have different hashes")
+	}
+
+	q, err := reg.Get("getproducts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(q.Versions) != 2 || q.Current().Hash != v2.Hash {
+		t.Fatalf("unexpected versions: %v", q.Versions)
+	}
+
+	if v, err := reg.Version(v1.Hash); err != nil || v.Author != "sam" {
+		t.Fatalf("unexpected version: %v (%v)", v, err)
+	}
+
+	items, err := reg.items()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 1 || items[0].Query != v2.Query || items[0].Tags["owner"] != "catalog" {
+		t.Fatalf("unexpected items: %v", items)
+	}
+
+	// the older version is added again as the current one
+	v3, err := reg.Rollback("getProducts", v1.Hash, "al")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q, _ = reg.Get("getProducts"); len(q.Versions) != 3 || q.Current().Hash != v1.Hash || v3.ApprovedBy != "al" {
+		t.Fatalf("unexpected versions after the rollback: %v", q.Versions)
+	}
+
+	if err := reg.Remove("getProducts"); err != nil {
+		t.Fatal(err)
+	}
+
+	if list, err := reg.List(); err != nil || len(list) != 0 {
+		t.Fatalf("expected an empty registry got %v (%v)", list, err)
+	}
+}
+
+func TestQueryRegistryAllowList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dir, err := ioutil.TempDir("", "test_registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	al := filepath.Join(dir, "allow.list")
+
+	// the queries in the allow list are not used
+	err = ioutil.WriteFile(al, []byte("query getUsers { users { id } }\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := OpenQueryRegistry(filepath.Join(dir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = reg.Approve(QueryApproval{Query: `query getProducts { products { id } }`, ApprovedBy: "jo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{UseAllowList: true, AllowListFile: al, QueryRegistry: filepath.Join(dir, "registry.json")}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sg.QueryRegistry() == nil {
+		t.Fatal("expected the query registry")
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+
+	if _, err := sg.GraphQL(ct, `query getProducts { products { id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sg.GraphQL(ct, `query getUsers { users { id } }`, nil); err == nil {
+		t.Fatal("expected an error for a query not in the registry")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,388 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// globalID returns the Relay global id of a row, it's the table name
+// and the primary key (eg. `users:5`) base64 encoded
+func globalID(table string, pk json.RawMessage) (json.RawMessage, error) {
+	v := string(pk)
+
+	if len(pk) != 0 && pk[0] == '"' {
+		if err := json.Unmarshal(pk, &v); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(base64.StdEncoding.EncodeToString([]byte(table + ":" + v)))
+}
+
+// parseGlobalID returns the table and the primary key in a global id
+func parseGlobalID(id string) (string, string, error) {
+	b, err := base64.StdEncoding.DecodeString(id)
+	if err != nil {
+		return "", "", errors.New("invalid global id")
+	}
+
+	v := strings.SplitN(string(b), ":", 2)
+	if len(v) != 2 || v[0] == "" {
+		return "", "", errors.New("invalid global id")
+	}
+
+	return v[0], v[1], nil
+}
+
+// nodeArg returns the primary key in the global id passed as the id of a
+// table, a global id of another table matches no rows
+func (sg *SuperGraph) nodeArg(table string, p psql.Param, v json.RawMessage) (interface{}, error) {
+	if len(v) == 0 || v[0] != '"' {
+		return nil, argErr(p)
+	}
+
+	var id string
+
+	if err := json.Unmarshal(v, &id); err != nil {
+		return nil, err
+	}
+
+	t, pk, err := parseGlobalID(id)
+	if err != nil {
+		return nil, fmt.Errorf("variable '%s': %w", p.Name, err)
+	}
+
+	ti, err := sg.pc.Schema().GetTableInfo(table)
+	if err != nil {
+		return nil, err
+	}
+
+	if ti.Name != t {
+		return nil, nil
+	}
+
+	return pk, nil
+}
+
+type jsonField struct {
+	key string
+	val json.RawMessage
+}
+
+// relayData changes the response into the shape Relay expects, the primary keys
+// are returned as global ids, the types of a node are merged into the node field
+// and the rows and cursors of connections are returned as edges and pageInfo
+func (sg *SuperGraph) relayData(qc *qcode.QCode, data []byte) ([]byte, error) {
+	if !sg.conf.Relay || qc == nil || len(data) == 0 {
+		return data, nil
+	}
+
+	r := relayer{sels: qc.Selects, schema: sg.pc.Schema()}
+
+	b, _, err := r.obj(nil, qc.Roots, data)
+	return b, err
+}
+
+type relayer struct {
+	sels   []qcode.Select
+	schema *psql.DBSchema
+}
+
+// obj returns the object of a row of the selection (or the root when sel is nil)
+// with its children in the Relay shape and the cursor of the row if it's in a
+// connection
+func (r *relayer) obj(sel *qcode.Select, ids []int32, b []byte) ([]byte, json.RawMessage, error) {
+	fields, err := readObj(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cursor json.RawMessage
+
+	index := func(k string) int {
+		for i := range fields {
+			if fields[i].key == k {
+				return i
+			}
+		}
+		return -1
+	}
+
+	if sel != nil {
+		if i := index(qcode.RowCursor); i != -1 {
+			cursor = fields[i].val
+			fields[i].key = ""
+		}
+
+		if err := r.globalIDs(sel, fields); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	nodes := make(map[string]int)
+
+	for _, id := range ids {
+		c := &r.sels[id]
+
+		i := index(c.FieldName)
+		if i == -1 {
+			continue
+		}
+		f := &fields[i]
+
+		if c.SkipRender != qcode.SkipTypeNone || c.Type == qcode.STUnion {
+			if c.Node != "" {
+				f.val = nil
+			} else {
+				continue
+			}
+		}
+
+		var v json.RawMessage
+
+		switch {
+		case c.Connection != nil:
+			var cur json.RawMessage
+
+			if j := index(c.FieldName + "_cursor"); j != -1 {
+				cur = fields[j].val
+				fields[j].key = ""
+			}
+			v, err = r.conn(c, f.val, cur)
+
+		default:
+			v, err = r.value(c, f.val)
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if c.Node == "" {
+			f.val = v
+			continue
+		}
+
+		// only the type the global id is of has a row
+		if j, ok := nodes[c.Node]; ok {
+			if !isNull(v) {
+				fields[j].val = v
+			}
+			f.key = ""
+		} else {
+			nodes[c.Node] = i
+			f.key, f.val = c.Node, v
+		}
+	}
+
+	return writeObj(fields), cursor, nil
+}
+
+func (r *relayer) value(sel *qcode.Select, b json.RawMessage) (json.RawMessage, error) {
+	if isNull(b) {
+		return json.RawMessage(`null`), nil
+	}
+
+	if b[0] == '{' {
+		v, _, err := r.obj(sel, sel.Children, b)
+		return v, err
+	}
+
+	var rows []json.RawMessage
+
+	if err := json.Unmarshal(b, &rows); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+
+	for i := range rows {
+		v, _, err := r.obj(sel, sel.Children, rows[i])
+		if err != nil {
+			return nil, err
+		}
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte(']')
+
+	return buf.Bytes(), nil
+}
+
+// conn returns the rows of the selection as a connection, a page is
+// expected to have more after it when it's full
+func (r *relayer) conn(sel *qcode.Select, b, cur json.RawMessage) (json.RawMessage, error) {
+	var rows []json.RawMessage
+
+	if !isNull(b) {
+		if err := json.Unmarshal(b, &rows); err != nil {
+			return nil, err
+		}
+	}
+
+	cn := sel.Connection
+	edges := make([]json.RawMessage, len(rows))
+	cursors := make([]json.RawMessage, len(rows))
+
+	for i := range rows {
+		v, c, err := r.obj(sel, sel.Children, rows[i])
+		if err != nil {
+			return nil, err
+		}
+
+		var e []jsonField
+
+		if cn.Cursor != "" {
+			e = append(e, jsonField{cn.Cursor, nullable(c)})
+		}
+		if cn.Node != "" {
+			e = append(e, jsonField{cn.Node, v})
+		}
+
+		edges[i] = writeObj(e)
+		cursors[i] = nullable(c)
+	}
+
+	var fields []jsonField
+
+	if cn.Edges != "" {
+		v, err := json.Marshal(edges)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, jsonField{cn.Edges, v})
+	}
+
+	if cn.PageInfo != "" {
+		limit, _ := strconv.Atoi(sel.Paging.Limit)
+		full := limit != 0 && len(rows) >= limit
+
+		next, prev := full, false
+		if sel.Paging.Type == qcode.PtBackward {
+			next, prev = false, full
+		}
+
+		start, end := json.RawMessage(`null`), nullable(cur)
+		if len(cursors) != 0 {
+			start = cursors[0]
+
+			if isNull(end) {
+				end = cursors[len(cursors)-1]
+			}
+		}
+
+		var p []jsonField
+
+		if cn.HasNextPage != "" {
+			p = append(p, jsonField{cn.HasNextPage, json.RawMessage(strconv.FormatBool(next))})
+		}
+		if cn.HasPreviousPage != "" {
+			p = append(p, jsonField{cn.HasPreviousPage, json.RawMessage(strconv.FormatBool(prev))})
+		}
+		if cn.StartCursor != "" {
+			p = append(p, jsonField{cn.StartCursor, start})
+		}
+		if cn.EndCursor != "" {
+			p = append(p, jsonField{cn.EndCursor, end})
+		}
+
+		fields = append(fields, jsonField{cn.PageInfo, writeObj(p)})
+	}
+
+	return writeObj(fields), nil
+}
+
+// globalIDs replaces the primary key of the row with its global id
+func (r *relayer) globalIDs(sel *qcode.Select, fields []jsonField) error {
+	ti, err := r.schema.GetTableInfo(sel.Name)
+	if err != nil || ti.PrimaryCol == nil {
+		return nil
+	}
+
+	for _, col := range sel.Cols {
+		if col.Name != ti.PrimaryCol.Name {
+			continue
+		}
+
+		for i := range fields {
+			if fields[i].key != col.FieldName || isNull(fields[i].val) {
+				continue
+			}
+			if fields[i].val, err = globalID(ti.Name, fields[i].val); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readObj returns the fields of a json object in order
+func readObj(b []byte) ([]jsonField, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("relay: expecting an object: %s", b)
+	}
+
+	var fields []jsonField
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		var v json.RawMessage
+
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		fields = append(fields, jsonField{t.(string), v})
+	}
+
+	return fields, nil
+}
+
+// writeObj returns the fields as a json object, fields with
+// an empty key are left out
+func writeObj(fields []jsonField) json.RawMessage {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	n := 0
+	for _, f := range fields {
+		if f.key == "" {
+			continue
+		}
+		if n != 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(f.key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(nullable(f.val))
+		n++
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes()
+}
+
+func nullable(v json.RawMessage) json.RawMessage {
+	if len(v) == 0 {
+		return json.RawMessage(`null`)
+	}
+	return v
+}
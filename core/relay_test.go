@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+func newRelaySG(t *testing.T, db *sql.DB) *SuperGraph {
+	sg, err := newTestGraph(t, &Config{Relay: true}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sg
+}
+
+func TestRelayNode(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg := newRelaySG(t, db)
+
+	cq := &cquery{q: rquery{op: qcode.QTQuery,
+		query: []byte(`query { node(id: $id) { id ... on users { email } ... on products { name } } }`)}}
+
+	if err := sg.compileQuery(cq, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(cq.st.qc.Roots); n != 2 {
+		t.Fatalf("expected a root for each type got %d", n)
+	}
+
+	vars := json.RawMessage(`{"id":"dXNlcnM6NQ=="}`)
+
+	ar, err := sg.argList(context.Background(), cq.st.md, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found int
+	for i, p := range cq.st.md.Params() {
+		table, _, ok := qcode.ParseNodeParam(p.Name)
+		if !ok {
+			continue
+		}
+		found++
+
+		switch table {
+		case "user":
+			if ar.values[i] != "5" {
+				t.Errorf("expected the primary key got %v", ar.values[i])
+			}
+		default:
+			if ar.values[i] != nil {
+				t.Errorf("expected no primary key for %s got %v", table, ar.values[i])
+			}
+		}
+	}
+
+	if found != 2 {
+		t.Fatalf("expected the id param of each type got %d", found)
+	}
+
+	if _, err := sg.argList(context.Background(), cq.st.md, json.RawMessage(`{"id":"5"}`)); err == nil {
+		t.Error("expected an error for an invalid global id")
+	}
+
+	data := `{"__node_product": null, "__node_user": {"id": 5, "email": "a@b.com"}}`
+	exp := `{"node":{"id":"dXNlcnM6NQ==","email":"a@b.com"}}`
+
+	b, err := sg.relayData(cq.st.qc, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != exp {
+		t.Errorf("expected %s got %s", exp, b)
+	}
+}
+
+func TestRelayConnection(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg := newRelaySG(t, db)
+
+	cq := &cquery{q: rquery{op: qcode.QTQuery,
+		query: []byte(`query { products(first: 2) { edges { cursor node { id name } } ` +
+			`pageInfo { hasNextPage endCursor } } }`)}}
+
+	if err := sg.compileQuery(cq, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	data := `{"products": [{"id": 1, "name": "a", "__cursor": "c1"}, ` +
+		`{"id": 2, "name": "b", "__cursor": "c2"}], "products_cursor": "c2"}`
+
+	exp := `{"products":{"edges":[` +
+		`{"cursor":"c1","node":{"id":"cHJvZHVjdHM6MQ==","name":"a"}},` +
+		`{"cursor":"c2","node":{"id":"cHJvZHVjdHM6Mg==","name":"b"}}],` +
+		`"pageInfo":{"hasNextPage":true,"endCursor":"c2"}}}`
+
+	b, err := sg.relayData(cq.st.qc, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != exp {
+		t.Errorf("expected %s got %s", exp, b)
+	}
+
+	cq = &cquery{q: rquery{op: qcode.QTQuery,
+		query: []byte(`query { products { edges { node { id } } name } }`)}}
+
+	if err := sg.compileQuery(cq, "user"); err == nil {
+		t.Error("expected an error for a field next to the edges")
+	}
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestReloadSchema(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := `query { products { id sku } }`
+
+	if err := sg.Validate(query, nil, "user"); err == nil {
+		t.Fatal("expected an error for the unknown column")
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for n := 0; n < 20; n++ {
+				_ = sg.Validate(query, nil, "user")
+				_, _ = sg.Completions([]string{"products"}, "user")
+
+				if _, err := sg.GraphQLSchema(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 5; i++ {
+		di := psql.GetTestDBInfo()
+		di.Columns[2] = append(di.Columns[2], psql.DBColumn{ID: 99, Name: "sku", Key: "sku", Type: "text"})
+
+		if err := sg.reloadSchema(di); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wg.Wait()
+
+	if err := sg.Validate(query, nil, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := sg.GraphQLSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(s, "sku") {
+		t.Fatal("expected the introspection schema to have the new column")
+	}
+}
@@ -2,17 +2,19 @@ package core
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"hash/maphash"
 	"net/http"
+	"strconv"
 	"sync"
 
 	"github.com/dosco/super-graph/core/internal/qcode"
 	"github.com/dosco/super-graph/jsn"
 )
 
-func (sg *SuperGraph) execRemoteJoin(res qres, hdr http.Header) (qres, error) {
+func (sg *SuperGraph) execRemoteJoin(res qres, hdr http.Header, bu *budget) (qres, error) {
 	var err error
 
 	sel := res.q.st.qc.Selects
@@ -36,7 +38,7 @@ func (sg *SuperGraph) execRemoteJoin(res qres, hdr http.Header) (qres, error) {
 		return res, errors.New("something wrong no remote ids found in db response")
 	}
 
-	to, err = sg.resolveRemotes(hdr, &h, from, sel, sfmap)
+	to, res.warns, err = sg.resolveRemotes(hdr, bu, &h, from, sel, sfmap)
 	if err != nil {
 		return res, err
 	}
@@ -54,20 +56,40 @@ func (sg *SuperGraph) execRemoteJoin(res qres, hdr http.Header) (qres, error) {
 
 func (sg *SuperGraph) resolveRemotes(
 	hdr http.Header,
+	bu *budget,
 	h *maphash.Hash,
 	from []jsn.Field,
 	sel []qcode.Select,
-	sfmap map[uint64]*qcode.Select) ([]jsn.Field, error) {
+	sfmap map[uint64]*qcode.Select) ([]jsn.Field, []string, error) {
 
 	// replacement data for the marked insertion points
 	// key and value will be replaced by whats below
 	to := make([]jsn.Field, len(from))
 
-	var wg sync.WaitGroup
-	wg.Add(len(from))
+	// remotes that support batching are grouped by resolver
+	// and fetched after all the ids are collected
+	batches := make(map[uint64]*remoteBatch)
+
+	// the same remote entity can be needed by many rows and
+	// selections, it's only fetched once for the request
+	calls := make(map[string]*remoteCall)
 
+	var wg sync.WaitGroup
+	var mu sync.Mutex
 	var cerr error
 
+	// the ids of a batch that failed are set to null and
+	// returned as warnings
+	var warns []string
+
+	setErr := func(err error) {
+		mu.Lock()
+		if cerr == nil {
+			cerr = err
+		}
+		mu.Unlock()
+	}
+
 	for i, id := range from {
 		// use the json key to find the related Select object
 		_, _ = h.Write(id.Key)
@@ -76,13 +98,13 @@ func (sg *SuperGraph) resolveRemotes(
 
 		s, ok := sfmap[k1]
 		if !ok {
-			return nil, fmt.Errorf("invalid remote field key")
+			return nil, nil, fmt.Errorf("invalid remote field key")
 		}
 		p := sel[s.ParentID]
 
-		pti, err := sg.schema.GetTableInfo(p.Name)
+		pti, err := sg.pc.Schema().GetTableInfo(p.Name)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		// then use the Table nme in the Select and it's parent
@@ -91,48 +113,251 @@ func (sg *SuperGraph) resolveRemotes(
 
 		r, ok := sg.rmap[k2]
 		if !ok {
-			return nil, fmt.Errorf("no resolver found")
+			return nil, nil, fmt.Errorf("no resolver found")
+		}
+
+		if err := r.checkFields(s); err != nil {
+			return nil, nil, err
 		}
 
 		id := jsn.Value(id.Value)
 		if len(id) == 0 {
-			return nil, fmt.Errorf("invalid remote field id")
+			return nil, nil, fmt.Errorf("invalid remote field id")
 		}
 
-		go func(n int, id []byte, s *qcode.Select) {
+		if r.BatchFn != nil {
+			b, ok := batches[k2]
+			if !ok {
+				b = &remoteBatch{r: r, s: s, idx: make(map[string][]int)}
+				batches[k2] = b
+			}
+			b.add(string(id), i)
+			continue
+		}
+
+		ck := strconv.FormatUint(k2, 36) + ":" + string(id)
+
+		if c, ok := calls[ck]; ok {
+			c.idx = append(c.idx, i)
+		} else {
+			calls[ck] = &remoteCall{r: r, s: s, id: id, idx: []int{i}}
+		}
+	}
+
+	// the calls are counted before any is made
+	n := len(calls)
+	for _, b := range batches {
+		n += (len(b.ids) + b.r.BatchSize - 1) / b.r.BatchSize
+	}
+	if err := bu.addCalls(n); err != nil {
+		return nil, nil, err
+	}
+
+	for _, c := range calls {
+		wg.Add(1)
+
+		go func(c *remoteCall) {
 			defer wg.Done()
 
 			//st := time.Now()
 
-			b, err := r.Fn(hdr, id)
+			b, err := c.r.fetch(hdr, c.id)
 			if err != nil {
-				cerr = fmt.Errorf("%s: %s", s.Name, err)
+				setErr(fmt.Errorf("%s: %s", c.s.Name, err))
 				return
 			}
 
-			if len(r.Path) != 0 {
-				b = jsn.Strip(b, r.Path)
+			if len(c.r.Path) != 0 {
+				b = jsn.Strip(b, c.r.Path)
 			}
 
-			var ob bytes.Buffer
+			f, err := remoteField(c.s, b)
+			if err != nil {
+				setErr(err)
+				return
+			}
+
+			for _, n := range c.idx {
+				to[n] = f
+			}
+		}(c)
+	}
 
-			if len(s.Cols) != 0 {
-				err = jsn.Filter(&ob, b, colsToList(s.Cols))
-				if err != nil {
-					cerr = fmt.Errorf("%s: %s", s.Name, err)
-					return
+	for _, b := range batches {
+		sem := make(chan struct{}, b.r.BatchParallelism)
+
+		for i := 0; i < len(b.ids); i += b.r.BatchSize {
+			end := i + b.r.BatchSize
+			if end > len(b.ids) {
+				end = len(b.ids)
+			}
+
+			wg.Add(1)
+			sem <- struct{}{}
+
+			go func(b *remoteBatch, ids []string) {
+				defer func() { <-sem; wg.Done() }()
+
+				if errs := b.fetch(hdr, ids, to); len(errs) != 0 {
+					mu.Lock()
+					for _, err := range errs {
+						warns = append(warns, err.Error())
+					}
+					mu.Unlock()
 				}
+			}(b, b.ids[i:end])
+		}
+	}
+
+	wg.Wait()
+
+	return to, warns, cerr
+}
+
+// remoteCall is a request for a remote entity and the
+// insertion points it's value is used at
+type remoteCall struct {
+	r   resolvFn
+	s   *qcode.Select
+	id  []byte
+	idx []int
+}
+
+// remoteBatch collects the unique ids for a batched remote and
+// the insertion points each of those ids maps to
+type remoteBatch struct {
+	r   resolvFn
+	s   *qcode.Select
+	ids []string
+	idx map[string][]int
+}
+
+func (b *remoteBatch) add(id string, n int) {
+	if _, ok := b.idx[id]; !ok {
+		b.ids = append(b.ids, id)
+	}
+	b.idx[id] = append(b.idx[id], n)
+}
+
+// fetch maps the values for the ids back to their insertion points. Values
+// not found in the cache are fetched with a single request and ids missing
+// from the response are set to null. Ids that failed (eg. the request failed
+// or the value is not an object) are set to null and an error is returned
+// for each of them.
+func (b *remoteBatch) fetch(hdr http.Header, ids []string, to []jsn.Field) []error {
+	var errs []error
+
+	vals := make(map[string]json.RawMessage, len(ids))
+	miss := ids
+
+	if c := b.r.cache; c != nil {
+		var stale []string
+		miss = nil
+
+		for _, id := range ids {
+			v, refresh, ok := c.get(c.key(hdr, []byte(id)))
+			if !ok {
+				miss = append(miss, id)
+				continue
+			}
+			if refresh {
+				stale = append(stale, id)
+			}
+			vals[id] = v
+		}
+
+		if len(stale) != 0 {
+			go b.revalidate(hdr.Clone(), stale)
+		}
+	}
 
+	if len(miss) != 0 {
+		v, err := b.load(hdr, miss)
+		if err != nil {
+			for _, id := range miss {
+				errs = append(errs, fmt.Errorf("%s: id %s: %s", b.s.Name, id, err))
+			}
+		}
+		for id := range v {
+			vals[id] = v[id]
+		}
+	}
+
+	for _, id := range ids {
+		f := jsn.Field{Key: []byte(b.s.FieldName), Value: []byte(`null`)}
+
+		if v, ok := vals[id]; ok {
+			if vf, err := remoteField(b.s, v); err != nil {
+				errs = append(errs, fmt.Errorf("id %s: %s", id, err))
 			} else {
-				ob.WriteString("null")
+				f = vf
 			}
+		}
 
-			to[n] = jsn.Field{Key: []byte(s.FieldName), Value: ob.Bytes()}
-		}(i, id, s)
+		for _, n := range b.idx[id] {
+			to[n] = f
+		}
+	}
+
+	return errs
+}
+
+// load fetches the values for the ids with a single request
+// and adds them to the cache
+func (b *remoteBatch) load(hdr http.Header, ids []string) (map[string]json.RawMessage, error) {
+	list := make([][]byte, len(ids))
+	for i := range ids {
+		list[i] = []byte(ids[i])
+	}
+
+	data, err := b.r.BatchFn(hdr, list)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b.r.Path) != 0 {
+		data = jsn.Strip(data, b.r.Path)
+	}
+
+	var vals map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &vals); err != nil {
+		return nil, fmt.Errorf("batch response must be an object keyed by id: %s", err)
+	}
+
+	if c := b.r.cache; c != nil {
+		for _, id := range ids {
+			if v, ok := vals[id]; ok {
+				c.set(c.key(hdr, []byte(id)), v)
+			}
+		}
+	}
+
+	return vals, nil
+}
+
+func (b *remoteBatch) revalidate(hdr http.Header, ids []string) {
+	if _, err := b.load(hdr, ids); err != nil {
+		for _, id := range ids {
+			b.r.cache.failed(b.r.cache.key(hdr, []byte(id)))
+		}
+	}
+}
+
+// remoteField filters the remote data down to the selected columns
+func remoteField(s *qcode.Select, b []byte) (jsn.Field, error) {
+	var ob bytes.Buffer
+
+	if len(s.Cols) != 0 {
+		if err := jsn.Filter(&ob, b, colsToList(s.Cols)); err != nil {
+			return jsn.Field{}, fmt.Errorf("%s: %s", s.Name, err)
+		}
+
+	} else {
+		ob.WriteString("null")
 	}
-	wg.Wait()
 
-	return to, cerr
+	return jsn.Field{Key: []byte(s.FieldName), Value: ob.Bytes()}, nil
 }
 
 func (sg *SuperGraph) parentFieldIds(h *maphash.Hash, sel []qcode.Select, remotes int) (
@@ -155,7 +380,7 @@ func (sg *SuperGraph) parentFieldIds(h *maphash.Hash, sel []qcode.Select, remote
 
 		p := sel[s.ParentID]
 
-		pti, err := sg.schema.GetTableInfo(p.Name)
+		pti, err := sg.pc.Schema().GetTableInfo(p.Name)
 		if err != nil {
 			return nil, nil, err
 		}
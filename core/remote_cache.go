@@ -0,0 +1,126 @@
+package core
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxRemoteCacheEntries = 10000
+)
+
+// remoteCache caches the responses of a remote by id. Expired responses are
+// still served for the stale duration while they are refreshed in the
+// background (stale-while-revalidate).
+type remoteCache struct {
+	ttl   time.Duration
+	stale time.Duration
+
+	// headers passed to the remote are part of the key since
+	// the response can be different for each user
+	hdrs []string
+
+	sync.Mutex
+	m      map[string]*remoteEntry
+	hits   uint64
+	misses uint64
+}
+
+type remoteEntry struct {
+	data       []byte
+	at         time.Time
+	refreshing bool
+}
+
+func newRemoteCache(r Remote) *remoteCache {
+	if r.CacheTTL <= 0 {
+		return nil
+	}
+
+	return &remoteCache{
+		ttl:   r.CacheTTL,
+		stale: r.CacheStale,
+		hdrs:  r.PassHeaders,
+		m:     make(map[string]*remoteEntry),
+	}
+}
+
+func (c *remoteCache) key(hdr http.Header, id []byte) string {
+	var sb strings.Builder
+
+	sb.Write(id)
+	for _, h := range c.hdrs {
+		sb.WriteByte(0)
+		sb.WriteString(hdr.Get(h))
+	}
+	return sb.String()
+}
+
+// get returns the cached value for the key, refresh is true when the value
+// is stale and the caller must revalidate it
+func (c *remoteCache) get(k string) (data []byte, refresh bool, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.m[k]
+	if !ok {
+		c.misses++
+		return nil, false, false
+	}
+	age := time.Since(e.at)
+
+	switch {
+	case age < c.ttl:
+		c.hits++
+		return e.data, false, true
+
+	case age < (c.ttl + c.stale):
+		c.hits++
+		refresh = !e.refreshing
+		e.refreshing = true
+		return e.data, refresh, true
+	}
+
+	c.misses++
+	delete(c.m, k)
+	return nil, false, false
+}
+
+func (c *remoteCache) set(k string, data []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.m) >= maxRemoteCacheEntries {
+		c.evict()
+	}
+
+	if len(c.m) < maxRemoteCacheEntries {
+		c.m[k] = &remoteEntry{data: data, at: time.Now()}
+	}
+}
+
+// failed is called when revalidating a stale value fails so
+// that the next request can try again
+func (c *remoteCache) failed(k string) {
+	c.Lock()
+	if e, ok := c.m[k]; ok {
+		e.refreshing = false
+	}
+	c.Unlock()
+}
+
+func (c *remoteCache) evict() {
+	for k, e := range c.m {
+		if time.Since(e.at) >= (c.ttl + c.stale) {
+			delete(c.m, k)
+		}
+	}
+}
+
+func (c *remoteCache) flush() {
+	c.Lock()
+	c.m = make(map[string]*remoteEntry)
+	c.Unlock()
+}
@@ -0,0 +1,268 @@
+package core
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dosco/super-graph/jsn"
+)
+
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+var errCircuitOpen = errors.New("circuit open: too many failed requests")
+
+// remoteClient makes the http requests for a remote using the timeout,
+// retry, tls and proxy settings in it's config
+type remoteClient struct {
+	r       Remote
+	client  *http.Client
+	retries int
+	backoff time.Duration
+	cb      *breaker
+}
+
+func (sg *SuperGraph) newRemoteClient(r Remote) (*remoteClient, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+
+	if r.ProxyURL != "" {
+		u, err := url.Parse(r.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("remote %s: invalid proxy_url: %w", r.Name, err)
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+
+	tc, err := remoteTLSConfig(r.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("remote %s: %w", r.Name, err)
+	}
+	if tc != nil {
+		tr.TLSClientConfig = tc
+	}
+
+	rc := &remoteClient{
+		r:       r,
+		client:  &http.Client{Transport: tr, Timeout: r.Timeout},
+		retries: r.Retries,
+		backoff: r.RetryBackoff,
+	}
+
+	if rc.backoff <= 0 {
+		rc.backoff = defaultRetryBackoff
+	}
+
+	if r.CircuitBreaker.MaxFailures > 0 {
+		u, err := url.Parse(r.URL)
+		if err != nil {
+			return nil, fmt.Errorf("remote %s: invalid url: %w", r.Name, err)
+		}
+		rc.cb = sg.hostBreaker(u.Host, r.CircuitBreaker)
+	}
+
+	return rc, nil
+}
+
+func remoteTLSConfig(c RemoteTLS) (*tls.Config, error) {
+	if !c.InsecureSkipVerify && c.CAFile == "" && c.CertFile == "" && c.ServerName == "" {
+		return nil, nil
+	}
+
+	tc := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify, //nolint: gosec
+		ServerName:         c.ServerName,
+	}
+
+	if c.CAFile != "" {
+		b, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in ca_file: %s", c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	return tc, nil
+}
+
+// get fetches the uri retrying with an exponential backoff on
+// connection errors and 5xx or 429 responses
+func (rc *remoteClient) get(hdr http.Header, uri string) ([]byte, error) {
+	return rc.send(hdr, "GET", uri, nil)
+}
+
+// post sends the json body to the uri with the same retries as get
+func (rc *remoteClient) post(hdr http.Header, uri string, body []byte) ([]byte, error) {
+	return rc.send(hdr, "POST", uri, body)
+}
+
+func (rc *remoteClient) send(hdr http.Header, method, uri string, body []byte) ([]byte, error) {
+	var b []byte
+	var err error
+
+	for i := 0; i <= rc.retries; i++ {
+		if i != 0 {
+			time.Sleep(rc.backoff * time.Duration(1<<uint(i-1)))
+		}
+
+		if !rc.cb.allow() {
+			return nil, fmt.Errorf("'%s': %w", uri, errCircuitOpen)
+		}
+
+		var retry bool
+		b, retry, err = rc.do(hdr, method, uri, body)
+		rc.cb.done(err == nil || !retry)
+
+		if err == nil || !retry {
+			break
+		}
+	}
+
+	return b, err
+}
+
+func (rc *remoteClient) do(hdr http.Header, method, uri string, body []byte) ([]byte, bool, error) {
+	var rb io.Reader
+	if body != nil {
+		rb = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, uri, rb)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if host, ok := hdr["Host"]; ok {
+		req.Host = host[0]
+	}
+
+	for _, v := range rc.r.SetHeaders {
+		req.Header.Set(v.Name, v.Value)
+	}
+
+	for _, v := range rc.r.PassHeaders {
+		req.Header.Set(v, hdr.Get(v))
+	}
+
+	res, err := rc.client.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to connect to '%s': %v", uri, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+		return nil, retry,
+			fmt.Errorf("server responded with a %d", res.StatusCode)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if err := jsn.ValidateBytes(b); err != nil {
+		return nil, false, err
+	}
+
+	return b, false, nil
+}
+
+// breaker stops requests to a host after too many failures in a row,
+// after the cooldown a single request is let through to test the host
+type breaker struct {
+	max      int
+	cooldown time.Duration
+
+	sync.Mutex
+	fails    int
+	openedAt time.Time
+}
+
+func (sg *SuperGraph) hostBreaker(host string, c RemoteCircuitBreaker) *breaker {
+	sg.breakersMu.Lock()
+	defer sg.breakersMu.Unlock()
+
+	if b, ok := sg.breakers[host]; ok {
+		return b
+	}
+
+	b := &breaker{max: c.MaxFailures, cooldown: c.Cooldown}
+	if b.cooldown <= 0 {
+		b.cooldown = defaultBreakerCooldown
+	}
+
+	if sg.breakers == nil {
+		sg.breakers = make(map[string]*breaker)
+	}
+	sg.breakers[host] = b
+
+	return b
+}
+
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.fails < b.max {
+		return true
+	}
+
+	if time.Since(b.openedAt) >= b.cooldown {
+		b.openedAt = time.Now()
+		return true
+	}
+
+	return false
+}
+
+// done records the result of a request, client errors (eg. a 404)
+// are not counted as failures of the host
+func (b *breaker) done(ok bool) {
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if ok {
+		b.fails = 0
+		return
+	}
+
+	b.fails++
+	if b.fails >= b.max {
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,377 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+const (
+	defaultRemoteSortRows  = 1000
+	defaultRemoteSortLimit = 20
+)
+
+// initRemoteSorts moves the order by the fields of remote selections
+// (eg. payments: { amount: desc }) of the roots out of the sql, the rows
+// are fetched without their paging and are sorted once the remote data
+// is joined
+func (sg *SuperGraph) initRemoteSorts(qc *qcode.QCode) error {
+	if qc.Type != qcode.QTQuery {
+		return nil
+	}
+
+	for i := range qc.Selects {
+		sel := &qc.Selects[i]
+
+		var rob []*qcode.OrderBy
+		n := 0
+
+		for j, ob := range sel.OrderBy {
+			rs, err := sg.remoteSortSel(qc, sel, ob.Col)
+			if err != nil {
+				return err
+			}
+
+			if rs == nil {
+				continue
+			}
+
+			switch {
+			case sel.ParentID != -1:
+				return fmt.Errorf("order_by: %s: remote fields can only be ordered by in root selections", ob.Col)
+
+			case sel.Paging.Type != qcode.PtOffset:
+				return fmt.Errorf("order_by: %s: can't be used with cursor pagination", ob.Col)
+
+			case ob.Var != "":
+				return fmt.Errorf("order_by: %s: remote fields can't be ordered by a variable", ob.Col)
+
+			case j != n:
+				return fmt.Errorf("order_by: %s: remote fields have to be ordered by first", ob.Col)
+			}
+
+			rob = append(rob, ob)
+			n++
+		}
+
+		if len(rob) == 0 {
+			continue
+		}
+
+		max := sg.conf.MaxRemoteSortRows
+		if max <= 0 {
+			max = defaultRemoteSortRows
+		}
+
+		sel.RemoteSort = &qcode.RemoteSort{OrderBy: rob, Paging: sel.Paging}
+		sel.OrderBy = sel.OrderBy[n:]
+
+		// one more row than can be sorted to know when there are too many
+		sel.Paging = qcode.Paging{Limit: strconv.Itoa(max + 1)}
+	}
+
+	return nil
+}
+
+// remoteSortSel returns the remote selection of the field
+// ordered by or nil when it's not a field of one
+func (sg *SuperGraph) remoteSortSel(qc *qcode.QCode, sel *qcode.Select, col string) (*qcode.Select, error) {
+	path := strings.Split(col, ".")
+	if len(path) < 2 {
+		return nil, nil
+	}
+
+	for _, id := range sel.Children {
+		c := &qc.Selects[id]
+
+		if c.Name != path[0] {
+			continue
+		}
+
+		rel, err := sg.pc.Schema().GetRel(c.Name, sel.Name)
+		if err != nil || rel.Type != psql.RelRemote {
+			return nil, nil
+		}
+
+		if len(path) != 2 {
+			return nil, fmt.Errorf("order_by: %s: only the fields of a remote selection can be ordered by", col)
+		}
+
+		for _, cc := range c.Cols {
+			if cc.Name == path[1] {
+				return c, nil
+			}
+		}
+		return nil, fmt.Errorf("order_by: %s: field has to be selected to be ordered by", col)
+	}
+
+	return nil, nil
+}
+
+// sortRemote sorts the rows of the roots ordered by the fields of remote
+// selections and applies their paging
+func (sg *SuperGraph) sortRemote(qc *qcode.QCode, data, vars []byte) ([]byte, error) {
+	if qc == nil || len(data) == 0 {
+		return data, nil
+	}
+
+	var fields []jsonField
+	var vm map[string]json.RawMessage
+
+	for _, id := range qc.Roots {
+		sel := &qc.Selects[id]
+
+		if sel.RemoteSort == nil {
+			continue
+		}
+
+		if fields == nil {
+			var err error
+			if fields, err = readObj(data); err != nil {
+				return nil, err
+			}
+
+			if len(vars) != 0 {
+				if err := json.Unmarshal(vars, &vm); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for i := range fields {
+			f := &fields[i]
+
+			if f.key != sel.FieldName || len(f.val) == 0 || f.val[0] != '[' {
+				continue
+			}
+
+			v, err := sg.sortRows(qc, sel, f.val, vm)
+			if err != nil {
+				return nil, err
+			}
+			f.val = v
+		}
+	}
+
+	if fields == nil {
+		return data, nil
+	}
+	return writeObj(fields), nil
+}
+
+// sortRows sorts the rows of the selection by the fields of its remote selections
+func (sg *SuperGraph) sortRows(qc *qcode.QCode, sel *qcode.Select, b []byte,
+	vm map[string]json.RawMessage) ([]byte, error) {
+	var rows []json.RawMessage
+
+	if err := json.Unmarshal(b, &rows); err != nil {
+		return nil, err
+	}
+
+	max := sg.conf.MaxRemoteSortRows
+	if max <= 0 {
+		max = defaultRemoteSortRows
+	}
+
+	if len(rows) > max {
+		return nil, fmt.Errorf("%s: too many rows to order by remote fields (max %d)",
+			sel.FieldName, max)
+	}
+
+	rs := sel.RemoteSort
+	keys := make([][]json.RawMessage, len(rows))
+
+	for i, r := range rows {
+		fields, err := readObj(r)
+		if err != nil {
+			return nil, err
+		}
+
+		keys[i] = make([]json.RawMessage, len(rs.OrderBy))
+
+		for j, ob := range rs.OrderBy {
+			if keys[i][j], err = remoteSortKey(qc, sel, fields, ob.Col); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	idx := make([]int, len(rows))
+	for i := range idx {
+		idx[i] = i
+	}
+
+	// stable to keep the order of the rows by the rest
+	// of the columns ordered by in the sql
+	sort.SliceStable(idx, func(a, b int) bool {
+		ka, kb := keys[idx[a]], keys[idx[b]]
+
+		for j, ob := range rs.OrderBy {
+			if c := compareSortKeys(ka[j], kb[j], ob.Order); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	start, end, err := remoteSortPage(rs.Paging, len(rows), vm)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+
+	for i, n := range idx[start:end] {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(rows[n])
+	}
+	buf.WriteByte(']')
+
+	return buf.Bytes(), nil
+}
+
+// remoteSortKey returns the value of the field of the remote selection in the row
+func remoteSortKey(qc *qcode.QCode, sel *qcode.Select, fields []jsonField, col string) (json.RawMessage, error) {
+	path := strings.SplitN(col, ".", 2)
+
+	for _, id := range sel.Children {
+		c := &qc.Selects[id]
+
+		if c.Name != path[0] {
+			continue
+		}
+
+		for _, f := range fields {
+			if f.key != c.FieldName {
+				continue
+			}
+
+			if len(f.val) == 0 || f.val[0] == 'n' {
+				return nil, nil
+			}
+
+			if f.val[0] != '{' {
+				return nil, fmt.Errorf("order_by: %s: %s is not an object", col, c.FieldName)
+			}
+
+			rf, err := readObj(f.val)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, v := range rf {
+				if v.key == path[1] {
+					return v.val, nil
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// compareSortKeys compares the values of a field, numbers are compared by value,
+// nulls are last in ascending order and first in descending order by default
+func compareSortKeys(a, b json.RawMessage, order qcode.Order) int {
+	an, bn := isNullValue(a), isNullValue(b)
+
+	desc := order == qcode.OrderDesc || order == qcode.OrderDescNullsFirst ||
+		order == qcode.OrderDescNullsLast
+
+	if an || bn {
+		if an && bn {
+			return 0
+		}
+
+		nullsFirst := order == qcode.OrderDesc || order == qcode.OrderAscNullsFirst ||
+			order == qcode.OrderDescNullsFirst
+
+		if an == nullsFirst {
+			return -1
+		}
+		return 1
+	}
+
+	c := compareValues(a, b)
+	if desc {
+		return -c
+	}
+	return c
+}
+
+func compareValues(a, b json.RawMessage) int {
+	if fa, err := strconv.ParseFloat(string(a), 64); err == nil {
+		if fb, err := strconv.ParseFloat(string(b), 64); err == nil {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	var sa, sb string
+
+	if json.Unmarshal(a, &sa) != nil || json.Unmarshal(b, &sb) != nil {
+		sa, sb = string(a), string(b)
+	}
+	return strings.Compare(sa, sb)
+}
+
+func isNullValue(v json.RawMessage) bool {
+	return len(v) == 0 || string(v) == "null"
+}
+
+// remoteSortPage returns the range of the sorted rows in the page,
+// the offset is a variable
+func remoteSortPage(p qcode.Paging, n int, vm map[string]json.RawMessage) (int, int, error) {
+	start, end := 0, n
+
+	if p.Offset != "" {
+		v, err := pagingArg(p.Offset, 0, vm[p.Offset])
+		if err != nil {
+			return 0, 0, fmt.Errorf("offset: %w", err)
+		}
+		if start = v; start > n {
+			start = n
+		}
+	}
+
+	if p.NoLimit {
+		return start, end, nil
+	}
+
+	limit := defaultRemoteSortLimit
+
+	if p.Limit != "" {
+		v, err := strconv.Atoi(p.Limit)
+		if err != nil {
+			return 0, 0, fmt.Errorf("limit: %w", err)
+		}
+		limit = v
+	}
+
+	if p.LimitVar != "" {
+		v, err := pagingArg(p.LimitVar, limit, vm[p.LimitVar])
+		if err != nil {
+			return 0, 0, fmt.Errorf("limit: %w", err)
+		}
+		limit = v
+	}
+
+	if start+limit < end {
+		end = start + limit
+	}
+	return start, end, nil
+}
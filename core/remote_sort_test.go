@@ -0,0 +1,91 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestRemoteSort(t *testing.T) {
+	amounts := map[string]string{"/1": `50`, "/2": `300`, "/3": `null`, "/4": `120`, "/5": `80`}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"amount": ` + amounts[r.URL.Path] + `}`))
+	}))
+	defer ts.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		MaxRemoteSortRows: 4,
+		Tables: []Table{{
+			Name:    "customers",
+			Remotes: []Remote{{Name: "payments", ID: "id", URL: ts.URL + "/$id"}},
+		}},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	rows := `{"customers": [{"id": 1, "__customers_id": 1}, {"id": 2, "__customers_id": 2}, ` +
+		`{"id": 3, "__customers_id": 3}, {"id": 4, "__customers_id": 4}]}`
+
+	// the rows are fetched without the limit and
+	// ordered by the rest of the columns in the sql
+	mock.ExpectQuery(`ORDER BY "customers"."id" ASC LIMIT \('5'\) :: integer`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(rows))
+
+	res, err := sg.GraphQL(ct, `query {
+		customers(limit: 3, order_by: { payments: { amount: desc }, id: asc }) { id payments { amount } }
+	}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"customers":[{"id": 3, "payments":{"amount": null}},` +
+		`{"id": 2, "payments":{"amount": 300}},{"id": 4, "payments":{"amount": 120}}]}`
+
+	if string(res.Data) != exp {
+		t.Fatalf("expected %s got %s", exp, res.Data)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// more rows than can be sorted
+	mock.ExpectQuery(`LIMIT \('5'\) :: integer`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(
+			`{"customers": [{"id": 1, "__customers_id": 1}, {"id": 2, "__customers_id": 2}, ` +
+				`{"id": 3, "__customers_id": 3}, {"id": 4, "__customers_id": 4}, {"id": 5, "__customers_id": 5}]}`))
+
+	if _, err := sg.GraphQL(ct, `query {
+		customers(order_by: { payments: { amount: asc } }) { id payments { amount } }
+	}`, nil); err == nil || !strings.Contains(err.Error(), "too many rows") {
+		t.Fatalf("expected an error for too many rows to sort: %v", err)
+	}
+
+	errs := []string{
+		`customers(order_by: { id: asc, payments: { amount: desc } }) { id payments { amount } }`,
+		`customers(order_by: { payments: { amount: desc } }) { id payments { currency } }`,
+		`users { customers(order_by: { payments: { amount: desc } }) { id payments { amount } } }`,
+	}
+
+	for _, v := range errs {
+		if _, err := sg.GraphQL(ct, `query { `+v+` }`, nil); err == nil {
+			t.Fatalf("%s: expected an error", v)
+		}
+	}
+}
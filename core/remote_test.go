@@ -0,0 +1,344 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"hash/maphash"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+	"github.com/dosco/super-graph/jsn"
+)
+
+func TestRemoteBatch(t *testing.T) {
+	var calls int32
+
+	r := resolvFn{
+		BatchFn: func(h http.Header, ids [][]byte) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+
+			if !bytes.Equal(bytes.Join(ids, []byte(",")), []byte("cus_1,cus_2")) {
+				t.Errorf("unexpected ids: %s", bytes.Join(ids, []byte(",")))
+			}
+			return []byte(`{"cus_1": {"amount": 100, "currency": "usd"}}`), nil
+		},
+		BatchSize:        50,
+		BatchParallelism: 4,
+	}
+
+	s := &qcode.Select{
+		Name:      "payments",
+		FieldName: "payments",
+		Cols:      []qcode.Column{{Name: "amount"}},
+	}
+
+	b := &remoteBatch{r: r, s: s, idx: make(map[string][]int)}
+	b.add("cus_1", 0)
+	b.add("cus_2", 1)
+	b.add("cus_1", 2)
+
+	to := make([]jsn.Field, 3)
+
+	if errs := b.fetch(nil, b.ids, to); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected a single batch request, got %d", calls)
+	}
+
+	exp := []string{`{"amount": 100}`, `null`, `{"amount": 100}`}
+
+	for i := range exp {
+		if string(to[i].Value) != exp[i] {
+			t.Errorf("%d: expected %s got %s", i, exp[i], to[i].Value)
+		}
+	}
+}
+
+func TestRemoteBatchErrors(t *testing.T) {
+	r := resolvFn{
+		BatchFn: func(h http.Header, ids [][]byte) ([]byte, error) {
+			if bytes.Equal(ids[0], []byte("cus_3")) {
+				return nil, errors.New("unavailable")
+			}
+			return []byte(`{"cus_1": {"amount": 100}}`), nil
+		},
+		BatchSize:        2,
+		BatchParallelism: 1,
+	}
+
+	s := &qcode.Select{
+		Name:      "payments",
+		FieldName: "payments",
+		Cols:      []qcode.Column{{Name: "amount"}},
+	}
+
+	b := &remoteBatch{r: r, s: s, idx: make(map[string][]int)}
+	b.add("cus_1", 0)
+	b.add("cus_2", 1)
+	b.add("cus_3", 2)
+
+	to := make([]jsn.Field, 3)
+
+	// only the ids of the batch that failed get an error,
+	// the others keep their value
+	errs := b.fetch(nil, b.ids[:2], to)
+	errs = append(errs, b.fetch(nil, b.ids[2:], to)...)
+
+	if len(errs) != 1 || errs[0].Error() != "payments: id cus_3: unavailable" {
+		t.Fatalf("expected an error for cus_3, got: %v", errs)
+	}
+
+	exp := []string{`{"amount": 100}`, `null`, `null`}
+
+	for i := range exp {
+		if string(to[i].Value) != exp[i] {
+			t.Errorf("%d: expected %s got %s", i, exp[i], to[i].Value)
+		}
+	}
+}
+
+func TestRemoteCache(t *testing.T) {
+	c := newRemoteCache(Remote{CacheTTL: time.Minute, CacheStale: time.Minute})
+	k := c.key(nil, []byte("cus_1"))
+
+	if _, _, ok := c.get(k); ok {
+		t.Fatal("expected a cache miss")
+	}
+
+	c.set(k, []byte(`{"amount": 100}`))
+
+	if _, refresh, ok := c.get(k); !ok || refresh {
+		t.Fatal("expected a fresh cache hit")
+	}
+
+	// expired but within the stale window
+	c.m[k].at = time.Now().Add(-90 * time.Second)
+
+	if _, refresh, ok := c.get(k); !ok || !refresh {
+		t.Fatal("expected a stale cache hit that needs a refresh")
+	}
+
+	if _, refresh, ok := c.get(k); !ok || refresh {
+		t.Fatal("expected only one refresh for a stale value")
+	}
+
+	c.m[k].at = time.Now().Add(-3 * time.Minute)
+
+	if _, _, ok := c.get(k); ok {
+		t.Fatal("expected an expired value to be a cache miss")
+	}
+
+	if c.hits != 3 || c.misses != 2 {
+		t.Fatalf("expected 3 hits and 2 misses got %d and %d", c.hits, c.misses)
+	}
+
+	c.set(k, []byte(`{"amount": 100}`))
+	c.flush()
+
+	if _, _, ok := c.get(k); ok {
+		t.Fatal("expected a flushed value to be a cache miss")
+	}
+}
+
+func TestRemoteClientRetry(t *testing.T) {
+	var n int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"amount": 100}`))
+	}))
+	defer ts.Close()
+
+	sg := &SuperGraph{}
+
+	rc, err := sg.newRemoteClient(Remote{
+		URL:          ts.URL,
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := rc.get(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != `{"amount": 100}` || n != 3 {
+		t.Fatalf("unexpected response after %d requests: %s", n, b)
+	}
+}
+
+func TestRemoteCircuitBreaker(t *testing.T) {
+	var n int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	sg := &SuperGraph{}
+
+	rc, err := sg.newRemoteClient(Remote{
+		URL:            ts.URL,
+		CircuitBreaker: RemoteCircuitBreaker{MaxFailures: 2, Cooldown: time.Minute},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := rc.get(nil, ts.URL); err == nil || errors.Is(err, errCircuitOpen) {
+			t.Fatalf("expected a server error, got: %v", err)
+		}
+	}
+
+	if _, err := rc.get(nil, ts.URL); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected the circuit to be open, got: %v", err)
+	}
+
+	if n != 2 {
+		t.Fatalf("expected 2 requests to the server, got %d", n)
+	}
+}
+
+func TestRemoteDedupe(t *testing.T) {
+	var n int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		_, _ = w.Write([]byte(`{"amount": 100, "currency": "usd"}`))
+	}))
+	defer ts.Close()
+
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{Tables: []Table{{
+		Name:    "customers",
+		Remotes: []Remote{{Name: "payments", ID: "id", URL: ts.URL + "/$id"}},
+	}}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sel := []qcode.Select{
+		{ID: 0, ParentID: -1, Name: "customers", FieldName: "customers"},
+		{ID: 1, ParentID: 0, Name: "payments", FieldName: "payments",
+			Cols: []qcode.Column{{Name: "amount"}}, SkipRender: qcode.SkipTypeRemote},
+	}
+
+	h := maphash.Hash{}
+	h.SetSeed(sg.hashSeed)
+
+	_, sfmap, err := sg.parentFieldIds(&h, sel, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := []jsn.Field{
+		{Key: []byte("__customers_id"), Value: []byte("1")},
+		{Key: []byte("__customers_id"), Value: []byte("2")},
+		{Key: []byte("__customers_id"), Value: []byte("1")},
+	}
+
+	to, warns, err := sg.resolveRemotes(nil, nil, &h, from, sel, sfmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warns) != 0 {
+		t.Fatalf("unexpected warnings: %v", warns)
+	}
+
+	if n != 2 {
+		t.Fatalf("expected 2 remote requests, got %d", n)
+	}
+
+	for i := range to {
+		if string(to[i].Value) != `{"amount": 100}` {
+			t.Errorf("%d: unexpected value: %s", i, to[i].Value)
+		}
+	}
+}
+
+func TestRemoteGraphQL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string
+			Variables map[string]string
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.Method != "POST" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if req.Variables["id"] == "cus_2" {
+			_, _ = w.Write([]byte(`{"errors": [{"message": "not found"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": {"customer": {"id": "` + req.Variables["id"] + `"}}}`))
+	}))
+	defer ts.Close()
+
+	sg := &SuperGraph{}
+
+	rc, err := sg.newRemoteClient(Remote{
+		URL:   ts.URL,
+		Query: `query ($id: ID!) { customer(id: $id) { id } }`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn := buildFn(rc)
+
+	b, err := fn(nil, []byte("cus_1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != `{"customer": {"id": "cus_1"}}` {
+		t.Fatalf("unexpected response: %s", b)
+	}
+
+	if _, err := fn(nil, []byte("cus_2")); err == nil || err.Error() != "graphql: not found" {
+		t.Fatalf("expected the graphql error: %v", err)
+	}
+}
+
+func TestRemoteFields(t *testing.T) {
+	r := resolvFn{fields: map[string]struct{}{"amount": {}}}
+
+	s := &qcode.Select{Name: "payments", Cols: []qcode.Column{{Name: "amount"}}}
+
+	if err := r.checkFields(s); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Cols = append(s.Cols, qcode.Column{Name: "card_number"})
+
+	if err := r.checkFields(s); err == nil {
+		t.Fatal("expected an error for a field that's not allowed")
+	}
+}
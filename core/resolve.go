@@ -1,20 +1,37 @@
 package core
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"hash/maphash"
-	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/dosco/super-graph/core/internal/psql"
-	"github.com/dosco/super-graph/jsn"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+const (
+	defaultBatchSize        = 50
+	defaultBatchParallelism = 4
 )
 
 type resolvFn struct {
 	IDField []byte
 	Path    [][]byte
 	Fn      func(h http.Header, id []byte) ([]byte, error)
+
+	// BatchFn is set when the remote supports fetching many
+	// ids with a single request
+	BatchFn          func(h http.Header, ids [][]byte) ([]byte, error)
+	BatchSize        int
+	BatchParallelism int
+
+	name   string
+	cache  *remoteCache
+	fields map[string]struct{}
 }
 
 func (sg *SuperGraph) initResolvers() error {
@@ -40,36 +57,27 @@ func (sg *SuperGraph) initRemotes(t Table) error {
 	h.SetSeed(sg.hashSeed)
 
 	for _, r := range t.Remotes {
-		// defines the table column to be used as an id in the
-		// remote request
-		idcol := r.ID
-
-		// if no table column specified in the config then
-		// use the primary key of the table as the id
-		if idcol == "" {
-			pcol, err := sg.pc.IDColumn(t.Name)
-			if err != nil {
-				return err
-			}
-			idcol = pcol.Key
-		}
-		idk := fmt.Sprintf("__%s_%s", t.Name, idcol)
-
 		// register a relationship between the remote data
 		// and the database table
+		val, err := remoteRel(sg.pc.Schema(), t, r)
+		if err != nil {
+			return err
+		}
+		idk := val.Right.Col
 
-		val := &psql.DBRel{Type: psql.RelRemote}
-		val.Left.Col = idcol
-		val.Right.Col = idk
+		err = sg.pc.AddRelationship(sanitize(r.Name), t.Name, val)
+		if err != nil {
+			return err
+		}
 
-		err := sg.pc.AddRelationship(sanitize(r.Name), t.Name, val)
+		rc, err := sg.newRemoteClient(r)
 		if err != nil {
 			return err
 		}
 
 		// the function thats called to resolve this remote
 		// data request
-		fn := buildFn(r)
+		fn := buildFn(rc)
 
 		path := [][]byte{}
 		for _, p := range strings.Split(r.Path, ".") {
@@ -80,6 +88,29 @@ func (sg *SuperGraph) initRemotes(t Table) error {
 			IDField: []byte(idk),
 			Path:    path,
 			Fn:      fn,
+			name:    t.Name + "." + r.Name,
+			cache:   newRemoteCache(r),
+		}
+
+		if len(r.Fields) != 0 {
+			rf.fields = make(map[string]struct{}, len(r.Fields))
+			for _, f := range r.Fields {
+				rf.fields[sanitize(f)] = struct{}{}
+			}
+		}
+
+		if r.BatchURL != "" && r.Query == "" {
+			rf.BatchFn = buildBatchFn(rc)
+			rf.BatchSize = r.BatchSize
+			rf.BatchParallelism = r.BatchParallelism
+
+			if rf.BatchSize <= 0 {
+				rf.BatchSize = defaultBatchSize
+			}
+
+			if rf.BatchParallelism <= 0 {
+				rf.BatchParallelism = defaultBatchParallelism
+			}
 		}
 
 		// index resolver obj by parent and child names
@@ -93,66 +124,149 @@ func (sg *SuperGraph) initRemotes(t Table) error {
 	return nil
 }
 
-func buildFn(r Remote) func(http.Header, []byte) ([]byte, error) {
-	reqURL := strings.Replace(r.URL, "$id", "%s", 1)
-	client := &http.Client{}
+// remoteRel returns the relationship between the remote and the table
+func remoteRel(schema *psql.DBSchema, t Table, r Remote) (*psql.DBRel, error) {
+	// defines the table column to be used as an id in the
+	// remote request
+	idcol := r.ID
 
-	fn := func(hdr http.Header, id []byte) ([]byte, error) {
-		uri := fmt.Sprintf(reqURL, id)
-		req, err := http.NewRequest("GET", uri, nil)
+	// if no table column specified in the config then
+	// use the primary key of the table as the id
+	if idcol == "" {
+		ti, err := schema.GetTableInfo(t.Name)
 		if err != nil {
 			return nil, err
 		}
-
-		if host, ok := hdr["Host"]; ok {
-			req.Host = host[0]
+		if ti.PrimaryCol == nil {
+			return nil, fmt.Errorf("no primary key column found")
 		}
+		idcol = ti.PrimaryCol.Key
+	}
 
-		for _, v := range r.SetHeaders {
-			req.Header.Set(v.Name, v.Value)
-		}
+	rel := &psql.DBRel{Type: psql.RelRemote}
+	rel.Left.Col = idcol
+	rel.Right.Col = fmt.Sprintf("__%s_%s", t.Name, idcol)
 
-		for _, v := range r.PassHeaders {
-			req.Header.Set(v, hdr.Get(v))
+	return rel, nil
+}
+
+// fetch returns the remote data for the id from the cache if enabled
+func (r resolvFn) fetch(hdr http.Header, id []byte) ([]byte, error) {
+	if r.cache == nil {
+		return r.Fn(hdr, id)
+	}
+	k := r.cache.key(hdr, id)
+
+	if b, refresh, ok := r.cache.get(k); ok {
+		if refresh {
+			go r.revalidate(hdr.Clone(), id, k)
 		}
+		return b, nil
+	}
 
-		res, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to connect to '%s': %v", uri, err)
+	b, err := r.Fn(hdr, id)
+	if err == nil {
+		r.cache.set(k, b)
+	}
+	return b, err
+}
+
+func (r resolvFn) revalidate(hdr http.Header, id []byte, k string) {
+	if b, err := r.Fn(hdr, id); err != nil {
+		r.cache.failed(k)
+	} else {
+		r.cache.set(k, b)
+	}
+}
+
+func buildFn(rc *remoteClient) func(http.Header, []byte) ([]byte, error) {
+	if rc.r.Query != "" {
+		return buildGraphQLFn(rc)
+	}
+
+	reqURL := strings.Replace(rc.r.URL, "$id", "%s", 1)
+
+	fn := func(hdr http.Header, id []byte) ([]byte, error) {
+		return rc.get(hdr, fmt.Sprintf(reqURL, id))
+	}
+
+	return fn
+}
+
+// buildBatchFn returns a function that fetches the remote data for a
+// list of ids with a single request to the batch url
+func buildBatchFn(rc *remoteClient) func(http.Header, [][]byte) ([]byte, error) {
+	fn := func(hdr http.Header, ids [][]byte) ([]byte, error) {
+		var b bytes.Buffer
+
+		for i := range ids {
+			if i != 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(url.QueryEscape(string(ids[i])))
 		}
-		defer res.Body.Close()
 
-		// if r.Debug {
-		// reqDump, err := httputil.DumpRequestOut(req, true)
-		// if err != nil {
-		// 	return nil, err
-		// }
+		uri := strings.Replace(rc.r.BatchURL, "$ids", b.String(), 1)
+		return rc.get(hdr, uri)
+	}
 
-		// resDump, err := httputil.DumpResponse(res, true)
-		// if err != nil {
-		// 	return nil, err
-		// }
+	return fn
+}
 
-		// logger.Debug().Msgf("Remote Request Debug:\n%s\n%s",
-		// 	reqDump, resDump)
-		// }
+// buildGraphQLFn returns a function that fetches the remote data from a
+// GraphQL api, the id is sent as the $id variable of the query and the
+// data of the response is returned
+func buildGraphQLFn(rc *remoteClient) func(http.Header, []byte) ([]byte, error) {
+	fn := func(hdr http.Header, id []byte) ([]byte, error) {
+		req := struct {
+			Query     string            `json:"query"`
+			Variables map[string]string `json:"variables"`
+		}{rc.r.Query, map[string]string{"id": string(id)}}
 
-		if res.StatusCode != 200 {
-			return nil,
-				fmt.Errorf("server responded with a %d", res.StatusCode)
+		body, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
 		}
 
-		b, err := ioutil.ReadAll(res.Body)
+		b, err := rc.post(hdr, rc.r.URL, body)
 		if err != nil {
 			return nil, err
 		}
 
-		if err := jsn.ValidateBytes(b); err != nil {
+		var res struct {
+			Data   json.RawMessage
+			Errors []struct{ Message string }
+		}
+
+		if err := json.Unmarshal(b, &res); err != nil {
 			return nil, err
 		}
 
-		return b, nil
+		if len(res.Errors) != 0 {
+			return nil, fmt.Errorf("graphql: %s", res.Errors[0].Message)
+		}
+
+		if len(res.Data) == 0 {
+			return []byte("null"), nil
+		}
+		return res.Data, nil
 	}
 
 	return fn
 }
+
+// checkFields returns an error when a field not in the allowed
+// fields of the remote is selected
+func (r resolvFn) checkFields(s *qcode.Select) error {
+	if len(r.fields) == 0 {
+		return nil
+	}
+
+	for _, c := range s.Cols {
+		if _, ok := r.fields[c.Name]; !ok {
+			return fmt.Errorf("%s: field not allowed: %s", s.Name, c.Name)
+		}
+	}
+
+	return nil
+}
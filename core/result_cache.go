@@ -0,0 +1,366 @@
+package core
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+const defaultResultCacheEntries = 1000
+
+// ResultCache struct configures the cache of query results. Results are
+// keyed by the query, its variables and the user and role it's run for.
+// When a mutation changes a table the cached results of the queries
+// that have the table are dropped
+type ResultCache struct {
+	Enable bool
+
+	// Store is where the results are kept, it can be `memory`
+	// (default) or `redis`
+	Store string
+
+	// TTL is how long the results of queries are cached for when not set
+	// with the @cacheControl directive or in Queries. Queries without
+	// one are not cached
+	TTL time.Duration
+
+	// Queries is how long the results of a query are cached
+	// for keyed by the query name
+	Queries map[string]time.Duration
+
+	// MaxEntries is the number of results kept by the memory
+	// store or in memory with Local. Defaults to 1000
+	MaxEntries int `mapstructure:"max_entries"`
+
+	// URL is the address of the redis store
+	// (eg. redis://:password@localhost:6379/0)
+	URL string
+
+	// Local keeps the results of the redis store in memory too, the mutations
+	// on any instance drop them from all the instances with redis pub/sub
+	Local bool
+
+	// LocalTTL is the longest a result is kept in memory for with Local, it's
+	// the most an instance can be behind when an invalidation is lost.
+	// Defaults to 10s
+	LocalTTL time.Duration `mapstructure:"local_ttl"`
+}
+
+// ResultStore is the storage of the cached query results. Get returns nil
+// when the key is not found or one of the tables of the result was changed
+// after it was set. Invalidate drops the results that have the tables
+type ResultStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, data []byte, ttl time.Duration, tables []string) error
+	Invalidate(ctx context.Context, tables []string) error
+	Flush(ctx context.Context) error
+}
+
+func (sg *SuperGraph) initResultCache() error {
+	rc := &sg.conf.ResultCache
+
+	if !rc.Enable {
+		return nil
+	}
+
+	if sg.conf.ResultStore != nil {
+		sg.results = sg.conf.ResultStore
+		return nil
+	}
+
+	switch rc.Store {
+	case "", "memory":
+		sg.results = NewMemoryResultStore(rc.MaxEntries)
+
+	case "redis":
+		var s ResultStore
+		var err error
+
+		if rc.Local {
+			s, err = NewCoordinatedResultStore(rc.URL, rc.MaxEntries, rc.LocalTTL)
+		} else {
+			s, err = NewRedisResultStore(rc.URL)
+		}
+		if err != nil {
+			return fmt.Errorf("result_cache: %w", err)
+		}
+		sg.results = s
+
+	default:
+		return fmt.Errorf("result_cache: unknown store '%s'", rc.Store)
+	}
+
+	return nil
+}
+
+// cacheControlDirective is the handler of the @cacheControl(maxAge: 60)
+// directive that sets the seconds the results of a query are cached for
+func cacheControlDirective(sel *qcode.Select, args []qcode.Arg, _ string) error {
+	if len(args) != 1 || args[0].Name != "maxAge" || args[0].Val.Type != qcode.NodeNum {
+		return errors.New("expecting a single 'maxAge' number argument")
+	}
+
+	n, err := strconv.Atoi(args[0].Val.Val)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid maxAge: %s", args[0].Val.Val)
+	}
+
+	sel.CacheMaxAge = n
+	return nil
+}
+
+// resultKey returns the cache key of the results of the query, it has
+// everything from the context that can change them
+func resultKey(c context.Context, query string, vars json.RawMessage, role string) string {
+	h := sha256.New()
+	h.Write(fingerprint([]byte(query))) //nolint: errcheck
+
+	var b bytes.Buffer
+	if len(vars) != 0 && json.Compact(&b, vars) == nil {
+		vars = b.Bytes()
+	}
+
+	h.Write([]byte{0})
+	h.Write(vars) //nolint: errcheck
+
+	fmt.Fprintf(h, "\x00%s\x00%v\x00%v\x00%v\x00%v", role, c.Value(UserIDKey),
+		c.Value(UserIDProviderKey), c.Value(UserRoleKey), c.Value(LocaleKey))
+
+	if v := c.Value(UserClaimsKey); v != nil {
+		if cl, err := json.Marshal(v); err == nil {
+			h.Write([]byte{0})
+			h.Write(cl) //nolint: errcheck
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// resultTTL returns how long the results of the query are cached for,
+// the smallest max age set with @cacheControl comes first
+func (sg *SuperGraph) resultTTL(qc *qcode.QCode, name string) time.Duration {
+	age := -1
+
+	for i := range qc.Selects {
+		sel := &qc.Selects[i]
+
+		if sel.SkipRender == qcode.SkipTypeNone && sel.CacheMaxAge != 0 &&
+			(age == -1 || sel.CacheMaxAge < age) {
+			age = sel.CacheMaxAge
+		}
+	}
+
+	if age != -1 {
+		return time.Duration(age) * time.Second
+	}
+
+	if ttl, ok := sg.conf.ResultCache.Queries[name]; ok {
+		return ttl
+	}
+	return sg.conf.ResultCache.TTL
+}
+
+// resultTables returns the tables of the selections in the statements
+func (sg *SuperGraph) resultTables(sts ...stmt) []string {
+	m := make(map[string]struct{})
+
+	for _, st := range sts {
+		if st.qc == nil {
+			continue
+		}
+
+		for i := range st.qc.Selects {
+			name := st.qc.Selects[i].Name
+
+			if ti, err := sg.pc.Schema().GetTableInfo(name); err == nil {
+				name = ti.Name
+			}
+			m[name] = struct{}{}
+		}
+	}
+
+	tables := make([]string, 0, len(m))
+	for k := range m {
+		tables = append(tables, k)
+	}
+	sort.Strings(tables)
+
+	return tables
+}
+
+// cacheResult caches the results of a query or drops the cached
+// results with the tables changed by a mutation. gen is the count of
+// the invalidations when the query was started, the results are not
+// cached if one of its tables may have changed since then
+func (sg *SuperGraph) cacheResult(c context.Context, key string, qr qres, gen uint64) {
+	var err error
+
+	switch {
+	case qr.q.q.op == qcode.QTQuery:
+		ttl := sg.resultTTL(qr.q.st.qc, qr.q.q.name)
+
+		if ttl <= 0 || qr.q.st.md.HasRemotes() || qr.q.frags != nil || sg.resultGen() != gen {
+			return
+		}
+
+		// cached results are returned without the warnings, and the
+		// ones of lenient mode depend on the flags of the request
+		if len(qr.q.st.md.Warnings()) != 0 {
+			return
+		}
+		if sg.conf.Lint && !sg.conf.UseAllowList && len(sg.lint(qr.q.st.qc)) != 0 {
+			return
+		}
+
+		// the signed urls of the blob columns expire
+		if bt := sg.blobURLTTL(); ttl > bt && sg.selectsBlobs(qr.q.st.qc) {
+			ttl = bt
+		}
+		err = sg.results.Set(c, key, qr.data, ttl, sg.resultTables(qr.q.st))
+
+	case qr.q.q.op == qcode.QTMutation:
+		sg.resultsMu.Lock()
+		sg.resultsGen++
+		sg.resultsMu.Unlock()
+
+		sts := append([]stmt{qr.q.st}, qr.q.stmts...)
+		err = sg.results.Invalidate(c, sg.resultTables(sts...))
+	}
+
+	if err != nil {
+		sg.log.Printf("WRN result cache: %s", err)
+	}
+}
+
+// resultGen returns the count of the invalidations, it includes the ones
+// made on other instances when the store gets them (eg. with Local)
+func (sg *SuperGraph) resultGen() uint64 {
+	var gen uint64
+
+	if s, ok := sg.results.(interface{ generation() uint64 }); ok {
+		gen = s.generation()
+	}
+
+	sg.resultsMu.Lock()
+	defer sg.resultsMu.Unlock()
+	return sg.resultsGen + gen
+}
+
+// memoryResultStore is an LRU of the results with a version for each table
+// that's incremented when the table is changed, a result is only returned
+// if the versions of its tables are the same as when it was set
+type memoryResultStore struct {
+	sync.Mutex
+	max  int
+	ll   *list.List
+	m    map[string]*list.Element
+	vers map[string]uint64
+}
+
+type resultEntry struct {
+	key  string
+	data []byte
+	exp  time.Time
+	vers map[string]uint64
+}
+
+// NewMemoryResultStore returns a store that keeps the
+// results in memory, the least recently used are dropped
+func NewMemoryResultStore(max int) ResultStore {
+	if max <= 0 {
+		max = defaultResultCacheEntries
+	}
+
+	return &memoryResultStore{
+		max:  max,
+		ll:   list.New(),
+		m:    make(map[string]*list.Element),
+		vers: make(map[string]uint64),
+	}
+}
+
+func (s *memoryResultStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.m[key]
+	if !ok {
+		return nil, nil
+	}
+	re := e.Value.(*resultEntry)
+
+	stale := time.Now().After(re.exp)
+	for t, v := range re.vers {
+		if s.vers[t] != v {
+			stale = true
+		}
+	}
+
+	if stale {
+		s.ll.Remove(e)
+		delete(s.m, key)
+		return nil, nil
+	}
+
+	s.ll.MoveToFront(e)
+	return re.data, nil
+}
+
+func (s *memoryResultStore) Set(_ context.Context, key string, data []byte, ttl time.Duration, tables []string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	re := &resultEntry{
+		key:  key,
+		data: data,
+		exp:  time.Now().Add(ttl),
+		vers: make(map[string]uint64, len(tables)),
+	}
+
+	for _, t := range tables {
+		re.vers[t] = s.vers[t]
+	}
+
+	if e, ok := s.m[key]; ok {
+		e.Value = re
+		s.ll.MoveToFront(e)
+		return nil
+	}
+
+	s.m[key] = s.ll.PushFront(re)
+
+	if s.ll.Len() > s.max {
+		e := s.ll.Back()
+		s.ll.Remove(e)
+		delete(s.m, e.Value.(*resultEntry).key)
+	}
+	return nil
+}
+
+func (s *memoryResultStore) Invalidate(_ context.Context, tables []string) error {
+	s.Lock()
+	for _, t := range tables {
+		s.vers[t]++
+	}
+	s.Unlock()
+	return nil
+}
+
+func (s *memoryResultStore) Flush(_ context.Context) error {
+	s.Lock()
+	s.ll.Init()
+	s.m = make(map[string]*list.Element)
+	s.Unlock()
+	return nil
+}
@@ -0,0 +1,349 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestResultCache(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		ResultCache: ResultCache{
+			Enable:  true,
+			Queries: map[string]time.Duration{"getProducts": time.Minute},
+		},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+	query := `query getProducts { products(limit: 5) { id } }`
+
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": [{"id": 1}]}`))
+
+	for i := 0; i < 2; i++ {
+		res, err := sg.GraphQL(ct, query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := `{"products": [{"id": 1}]}`; string(res.Data) != exp {
+			t.Fatalf("expected %s got %s", exp, res.Data)
+		}
+	}
+
+	// another user has its own results
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": [{"id": 2}]}`))
+
+	ct2 := context.WithValue(context.Background(), UserIDKey, 2)
+
+	if _, err := sg.GraphQL(ct2, query, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// and so does the same user id from another provider
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": [{"id": 4}]}`))
+
+	ct3 := context.WithValue(ct, UserIDProviderKey, "github")
+
+	if res, err := sg.GraphQL(ct3, query, nil); err != nil {
+		t.Fatal(err)
+	} else if exp := `{"products": [{"id": 4}]}`; string(res.Data) != exp {
+		t.Fatalf("expected %s got %s", exp, res.Data)
+	}
+
+	// a mutation of products drops the results
+	mock.ExpectQuery(`INSERT INTO "products"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"product": {"id": 3}}`))
+
+	vars := json.RawMessage(`{"data": {"name": "Bag"}}`)
+
+	if _, err := sg.GraphQL(ct, `mutation { product(insert: $data) { id } }`, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": [{"id": 1}, {"id": 3}]}`))
+
+	if _, err := sg.GraphQL(ct, query, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// queries without a ttl are not cached
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT`).
+			WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"users": []}`))
+
+		if _, err := sg.GraphQL(ct, `query { users(limit: 5) { id } }`, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the ttl can be set with @cacheControl
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"users": []}`))
+
+	for i := 0; i < 2; i++ {
+		if _, err := sg.GraphQL(ct, `query { users(limit: 5) @cacheControl(maxAge: 60) { id } }`, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResultCacheWarnings(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		LenientMode: true,
+		ResultCache: ResultCache{
+			Enable:  true,
+			Queries: map[string]time.Duration{"getProducts": time.Minute},
+		},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	// the results with warnings are not cached
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT`).
+			WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+
+		res, err := sg.GraphQL(ct, `query getProducts { products(limit: 5) { id unknown_col } }`, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Extensions == nil || len(res.Extensions.Warnings) == 0 {
+			t.Fatal("expected a warning for the unknown column")
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryResultStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryResultStore(2)
+
+	get := func(k string) string {
+		v, err := s.Get(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(v)
+	}
+
+	_ = s.Set(ctx, "a", []byte("1"), time.Minute, []string{"users"})
+	_ = s.Set(ctx, "b", []byte("2"), time.Minute, []string{"products"})
+	_ = s.Set(ctx, "c", []byte("3"), -time.Second, nil)
+
+	if v := get("a"); v != "" {
+		t.Fatalf("expected the least recently used to be dropped got %s", v)
+	}
+
+	if v := get("c"); v != "" {
+		t.Fatalf("expected the expired result to be dropped got %s", v)
+	}
+
+	_ = s.Invalidate(ctx, []string{"users"})
+
+	if v := get("b"); v != "2" {
+		t.Fatalf("expected 2 got %s", v)
+	}
+
+	_ = s.Invalidate(ctx, []string{"products"})
+
+	if v := get("b"); v != "" {
+		t.Fatalf("expected the invalidated result to be dropped got %s", v)
+	}
+}
+
+func TestRedisResultStore(t *testing.T) {
+	l := fakeRedis(t)
+	defer l.Close()
+
+	addr := l.Addr().String()
+	ctx := context.Background()
+
+	s, err := NewRedisResultStore("redis://:secret@" + addr + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set(ctx, "a", []byte(`{"users": []}`), time.Minute, []string{"users"}); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := s.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `{"users": []}`; string(v) != exp {
+		t.Fatalf("expected %s got %s", exp, v)
+	}
+
+	if err := s.Invalidate(ctx, []string{"users"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err = s.Get(ctx, "a"); err != nil || v != nil {
+		t.Fatalf("expected no result got %s (%v)", v, err)
+	}
+
+	_ = s.Set(ctx, "b", []byte(`{}`), time.Minute, []string{"products"})
+
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err = s.Get(ctx, "b"); err != nil || v != nil {
+		t.Fatalf("expected no result after a flush got %s (%v)", v, err)
+	}
+
+	if _, err := NewRedisResultStore("http://localhost"); err == nil {
+		t.Fatal("expected an error for a url that's not redis")
+	}
+}
+
+// fakeRedis runs a server with the few redis commands used by the store
+func fakeRedis(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	m := make(map[string]string)
+	subs := make(map[net.Conn]struct{})
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(c net.Conn) {
+				defer func() {
+					mu.Lock()
+					delete(subs, c)
+					mu.Unlock()
+					c.Close()
+				}()
+				r := bufio.NewReader(c)
+
+				for {
+					v, err := readRedisReply(r)
+					if err != nil {
+						return
+					}
+
+					var args []string
+					for _, a := range v.([]interface{}) {
+						args = append(args, string(a.([]byte)))
+					}
+
+					mu.Lock()
+					switch args[0] {
+					case "AUTH", "SELECT":
+						_, err = c.Write([]byte("+OK\r\n"))
+
+					case "GET":
+						if v, ok := m[args[1]]; ok {
+							_, err = c.Write([]byte("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"))
+						} else {
+							_, err = c.Write([]byte("$-1\r\n"))
+						}
+
+					case "SET":
+						if _, ok := m[args[1]]; ok && args[len(args)-1] == "NX" {
+							_, err = c.Write([]byte("$-1\r\n"))
+							break
+						}
+						m[args[1]] = args[2]
+						_, err = c.Write([]byte("+OK\r\n"))
+
+					case "DEL":
+						delete(m, args[1])
+						_, err = c.Write([]byte(":1\r\n"))
+
+					case "PING":
+						_, err = c.Write([]byte("+PONG\r\n"))
+
+					case "SUBSCRIBE":
+						subs[c] = struct{}{}
+						_, err = c.Write([]byte("*3\r\n$9\r\nsubscribe\r\n$" +
+							strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n:1\r\n"))
+
+					case "PUBLISH":
+						msg := "*3\r\n$7\r\nmessage\r\n$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] +
+							"\r\n$" + strconv.Itoa(len(args[2])) + "\r\n" + args[2] + "\r\n"
+						for sc := range subs {
+							sc.Write([]byte(msg)) //nolint: errcheck
+						}
+						_, err = c.Write([]byte(":" + strconv.Itoa(len(subs)) + "\r\n"))
+
+					case "INCR":
+						n, _ := strconv.Atoi(m[args[1]])
+						m[args[1]] = strconv.Itoa(n + 1)
+						_, err = c.Write([]byte(":" + m[args[1]] + "\r\n"))
+
+					case "MGET":
+						b := "*" + strconv.Itoa(len(args)-1) + "\r\n"
+						for _, k := range args[1:] {
+							if v, ok := m[k]; ok {
+								b += "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+							} else {
+								b += "$-1\r\n"
+							}
+						}
+						_, err = c.Write([]byte(b))
+
+					default:
+						_, err = c.Write([]byte("-ERR unknown command\r\n"))
+					}
+					mu.Unlock()
+
+					if err != nil {
+						return
+					}
+				}
+			}(c)
+		}
+	}()
+
+	return l
+}
@@ -0,0 +1,262 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	redisInvalidateChannel = "sg:rc:invalidate"
+	defaultLocalTTL        = 10 * time.Second
+	pubsubPing             = 5 * time.Second
+	pubsubRetry            = time.Second
+)
+
+// coordStores keeps a store for each redis url, the instances created
+// on a config reload share it instead of each subscribing again
+var coordStores = struct {
+	sync.Mutex
+	m map[string]*coordResultStore
+}{m: make(map[string]*coordResultStore)}
+
+// coordResultStore keeps the results in memory in front of the redis store.
+// Invalidations are published on a redis channel so the mutations run on
+// any instance drop the results in the memory of all of them. The memory is
+// only used while subscribed and a result is kept there for upto ttl so an
+// instance never serves a changed result for longer than that
+type coordResultStore struct {
+	local  *memoryResultStore
+	remote *redisResultStore
+	ttl    time.Duration
+	id     string
+
+	// mu is held while an invalidation is applied to the memory
+	mu        sync.Mutex
+	gen       uint64
+	connected bool
+}
+
+// NewCoordinatedResultStore returns a store that keeps upto max results in
+// memory in front of the redis server at the url, for upto ttl. The results
+// in memory are dropped on all instances when a table is changed on any of
+// them, using redis pub/sub
+func NewCoordinatedResultStore(u string, max int, ttl time.Duration) (ResultStore, error) {
+	coordStores.Lock()
+	defer coordStores.Unlock()
+
+	if s, ok := coordStores.m[u]; ok {
+		return s, nil
+	}
+
+	s, err := newCoordResultStore(u, max, ttl)
+	if err != nil {
+		return nil, err
+	}
+	go s.listen()
+
+	coordStores.m[u] = s
+	return s, nil
+}
+
+func newCoordResultStore(u string, max int, ttl time.Duration) (*coordResultStore, error) {
+	c, err := newRedisClient(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl <= 0 {
+		ttl = defaultLocalTTL
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &coordResultStore{
+		local:  NewMemoryResultStore(max).(*memoryResultStore),
+		remote: &redisResultStore{c},
+		ttl:    ttl,
+		id:     hex.EncodeToString(id),
+	}, nil
+}
+
+func (s *coordResultStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	ok, gen := s.connected, s.gen
+	s.mu.Unlock()
+
+	if !ok {
+		return s.remote.Get(ctx, key)
+	}
+
+	if b, _ := s.local.Get(ctx, key); b != nil {
+		return b, nil
+	}
+
+	b, tables, err := s.remote.get(ctx, key)
+	if err != nil || b == nil {
+		return b, err
+	}
+
+	// not kept in memory if an invalidation came in
+	// while it was read from redis
+	s.mu.Lock()
+	if s.connected && s.gen == gen {
+		_ = s.local.Set(ctx, key, b, s.ttl, tables)
+	}
+	s.mu.Unlock()
+
+	return b, nil
+}
+
+func (s *coordResultStore) Set(ctx context.Context, key string, data []byte, ttl time.Duration, tables []string) error {
+	if err := s.remote.Set(ctx, key, data, ttl, tables); err != nil {
+		return err
+	}
+
+	if ttl > s.ttl {
+		ttl = s.ttl
+	}
+
+	s.mu.Lock()
+	if s.connected {
+		_ = s.local.Set(ctx, key, data, ttl, tables)
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *coordResultStore) Invalidate(ctx context.Context, tables []string) error {
+	s.apply(tables)
+
+	if err := s.remote.Invalidate(ctx, tables); err != nil {
+		return err
+	}
+
+	_, err := s.remote.do(ctx, "PUBLISH", redisInvalidateChannel,
+		s.id+"\n"+strings.Join(tables, "\n"))
+	return err
+}
+
+func (s *coordResultStore) Flush(ctx context.Context) error {
+	return s.Invalidate(ctx, []string{""})
+}
+
+// generation is incremented for each invalidation applied to the memory
+// including the ones from other instances, results of queries started
+// before one are not cached
+func (s *coordResultStore) generation() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gen
+}
+
+// apply drops the results with the tables from the memory,
+// the empty table name drops all of them
+func (s *coordResultStore) apply(tables []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gen++
+
+	for _, t := range tables {
+		if t == "" {
+			_ = s.local.Flush(context.Background())
+			return
+		}
+	}
+	_ = s.local.Invalidate(context.Background(), tables)
+}
+
+// setConnected turns the memory on or off, it's emptied either way
+// since invalidations may have been missed while not subscribed
+func (s *coordResultStore) setConnected(v bool) {
+	s.mu.Lock()
+	s.connected = v
+	s.gen++
+	_ = s.local.Flush(context.Background())
+	s.mu.Unlock()
+}
+
+// listen subscribes to the invalidations and subscribes
+// again when the connection is lost
+func (s *coordResultStore) listen() {
+	for {
+		_ = s.subscribe()
+		s.setConnected(false)
+		time.Sleep(pubsubRetry)
+	}
+}
+
+func (s *coordResultStore) subscribe() error {
+	ctx := context.Background()
+
+	rc, err := s.remote.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if _, err := rc.do(ctx, "SUBSCRIBE", redisInvalidateChannel); err != nil {
+		return err
+	}
+
+	s.setConnected(true)
+
+	// pings find a dead connection, the reads
+	// time out when the replies stop coming
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		t := time.NewTicker(pubsubPing)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if rc.send("PING") != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		if err := rc.SetDeadline(time.Now().Add(2 * pubsubPing)); err != nil {
+			return err
+		}
+
+		v, err := readRedisReply(rc.r)
+		if err != nil {
+			return err
+		}
+
+		msg, _ := v.([]interface{})
+		if len(msg) != 3 {
+			continue
+		}
+
+		if k, _ := msg[0].([]byte); string(k) != "message" {
+			continue
+		}
+
+		if b, ok := msg[2].([]byte); ok {
+			lines := strings.Split(string(b), "\n")
+
+			// skip the invalidations of this instance,
+			// they're applied when they're published
+			if lines[0] != s.id {
+				s.apply(lines[1:])
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitFor polls fn until it returns true or fails the test after a second
+func waitFor(t *testing.T, msg string, fn func() bool) {
+	for i := 0; i < 100; i++ {
+		if fn() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal(msg)
+}
+
+func TestCoordinatedResultStore(t *testing.T) {
+	l := fakeRedis(t)
+	defer l.Close()
+
+	ctx := context.Background()
+	u := "redis://" + l.Addr().String()
+
+	var stores [2]*coordResultStore
+
+	for i := range stores {
+		s, err := newCoordResultStore(u, 10, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go s.listen()
+		stores[i] = s
+	}
+	a, b := stores[0], stores[1]
+
+	waitFor(t, "expected the stores to subscribe", func() bool {
+		a.mu.Lock()
+		b.mu.Lock()
+		defer a.mu.Unlock()
+		defer b.mu.Unlock()
+		return a.connected && b.connected
+	})
+
+	if err := a.Set(ctx, "k", []byte(`{"users": []}`), time.Minute, []string{"users"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// read from redis and kept in the memory of b
+	if v, err := b.Get(ctx, "k"); err != nil || string(v) != `{"users": []}` {
+		t.Fatalf("expected the result got %s (%v)", v, err)
+	}
+
+	if v, _ := b.local.Get(ctx, "k"); v == nil {
+		t.Fatal("expected the result in memory")
+	}
+
+	gen := b.generation()
+
+	if err := a.Invalidate(ctx, []string{"users"}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "expected the invalidation to drop the result in memory", func() bool {
+		v, _ := b.local.Get(ctx, "k")
+		return v == nil
+	})
+
+	if b.generation() == gen {
+		t.Fatal("expected the generation to change with the invalidation")
+	}
+
+	if v, err := b.Get(ctx, "k"); err != nil || v != nil {
+		t.Fatalf("expected no result got %s (%v)", v, err)
+	}
+
+	// the memory is emptied and bypassed when not subscribed
+	_ = b.Set(ctx, "k2", []byte(`{}`), time.Minute, []string{"products"})
+	b.setConnected(false)
+
+	if v, _ := b.local.Get(ctx, "k2"); v != nil {
+		t.Fatal("expected the memory to be emptied")
+	}
+
+	if v, err := b.Get(ctx, "k2"); err != nil || string(v) != `{}` {
+		t.Fatalf("expected the result from redis got %s (%v)", v, err)
+	}
+
+	if v, _ := b.local.Get(ctx, "k2"); v != nil {
+		t.Fatal("expected the memory not to be used while not subscribed")
+	}
+}
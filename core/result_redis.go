@@ -0,0 +1,154 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisKeyData  = "sg:rc:"
+	redisKeyTable = "sg:rv:"
+)
+
+// redisResultStore keeps the results in redis along with the versions of
+// their tables, a version is incremented when the table is changed. The
+// version of the empty table name is incremented to flush all results
+type redisResultStore struct {
+	*redisClient
+}
+
+// NewRedisResultStore returns a store that keeps the results in the
+// redis server at the url (eg. redis://:password@localhost:6379/0)
+func NewRedisResultStore(u string) (ResultStore, error) {
+	c, err := newRedisClient(u)
+	if err != nil {
+		return nil, err
+	}
+	return &redisResultStore{c}, nil
+}
+
+func (s *redisResultStore) Get(ctx context.Context, key string) ([]byte, error) {
+	b, _, err := s.get(ctx, key)
+	return b, err
+}
+
+// get returns the result along with its tables
+func (s *redisResultStore) get(ctx context.Context, key string) ([]byte, []string, error) {
+	v, err := s.do(ctx, "GET", redisKeyData+key)
+	if err != nil || v == nil {
+		return nil, nil, err
+	}
+
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	// the value is the versions of the tables on the first line
+	n := bytes.IndexByte(b, '\n')
+	if n == -1 {
+		return nil, nil, nil
+	}
+
+	tables, vers := parseResultVersions(string(b[:n]))
+
+	cur, err := s.versions(ctx, tables)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range vers {
+		if vers[i] != cur[i] {
+			return nil, nil, nil
+		}
+	}
+
+	return b[n+1:], tables, nil
+}
+
+func (s *redisResultStore) Set(ctx context.Context, key string, data []byte, ttl time.Duration, tables []string) error {
+	tables = append([]string{""}, tables...)
+
+	vers, err := s.versions(ctx, tables)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+
+	for i, t := range tables {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(t)
+		b.WriteByte('=')
+		b.WriteString(vers[i])
+	}
+	b.WriteByte('\n')
+	b.Write(data)
+
+	ms := strconv.FormatInt(int64(ttl/time.Millisecond), 10)
+	_, err = s.do(ctx, "SET", redisKeyData+key, b.String(), "PX", ms)
+	return err
+}
+
+func (s *redisResultStore) Invalidate(ctx context.Context, tables []string) error {
+	for _, t := range tables {
+		if _, err := s.do(ctx, "INCR", redisKeyTable+t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *redisResultStore) Flush(ctx context.Context) error {
+	return s.Invalidate(ctx, []string{""})
+}
+
+// versions returns the current versions of the tables
+func (s *redisResultStore) versions(ctx context.Context, tables []string) ([]string, error) {
+	args := make([]string, 0, len(tables)+1)
+	args = append(args, "MGET")
+
+	for _, t := range tables {
+		args = append(args, redisKeyTable+t)
+	}
+
+	v, err := s.do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	vals, _ := v.([]interface{})
+	vers := make([]string, len(tables))
+
+	for i := range vers {
+		vers[i] = "0"
+
+		if i < len(vals) {
+			if b, ok := vals[i].([]byte); ok {
+				vers[i] = string(b)
+			}
+		}
+	}
+
+	return vers, nil
+}
+
+// parseResultVersions parses the `table=version,...` line of a result
+func parseResultVersions(s string) ([]string, []string) {
+	var tables, vers []string
+
+	for _, v := range strings.Split(s, ",") {
+		n := strings.LastIndexByte(v, '=')
+		if n == -1 {
+			continue
+		}
+		tables = append(tables, v[:n])
+		vers = append(vers, v[n+1:])
+	}
+	return tables, vers
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+func TestCtxRole(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{}
+
+	err = conf.AddRoleTable("user", "products", Query{
+		Filters: []string{"{ user_id: { eq: $user_id } }"},
+		Columns: []string{"id", "name"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conf.AddRoleTable("admin", "products", Query{}); err != nil {
+		t.Fatal(err)
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := context.Background()
+
+	if _, ok, err := sg.ctxRole(c); ok || err != nil {
+		t.Fatal("expected no role")
+	}
+
+	role, ok, err := sg.ctxRole(context.WithValue(c, UserRoleKey, "Admin"))
+	if !ok || err != nil || role != "admin" {
+		t.Fatalf("unexpected role: %s %v", role, err)
+	}
+
+	if _, _, err := sg.ctxRole(context.WithValue(c, UserRoleKey, "root")); err == nil {
+		t.Fatal("expected an error for an unknown role")
+	}
+
+	// the same query gets different sql for each role
+	compile := func(role string) string {
+		cq := &cquery{q: rquery{op: qcode.QTQuery, query: []byte(`query { products { id name } }`)}}
+		if err := sg.compileQuery(cq, role); err != nil {
+			t.Fatal(err)
+		}
+		return cq.st.sql
+	}
+
+	if sql := compile("user"); !strings.Contains(sql, `"user_id"`) {
+		t.Fatalf("expected the user filter: %s", sql)
+	}
+
+	if sql := compile("admin"); strings.Contains(sql, `"user_id"`) {
+		t.Fatalf("unexpected filter for admin: %s", sql)
+	}
+}
+
+func TestClaimArgs(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cq := &cquery{q: rquery{op: qcode.QTQuery,
+		query: []byte(`query { products(where: { and: { id: { eq: $org_id }, name: { in: $tags } } }) { id } }`)}}
+
+	if err := sg.compileQuery(cq, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{"org_id": float64(7), "tags": []interface{}{"a", "b"}}
+	c := context.WithValue(context.Background(), UserClaimsKey, claims)
+
+	// the claims win over the request variables
+	ar, err := sg.argList(c, cq.st.md, []byte(`{"org_id": 5, "tags": ["c"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ar.values[1] != "7" || string(ar.values[0].(json.RawMessage)) != `["a","b"]` {
+		t.Fatalf("unexpected values: %v", ar.values)
+	}
+
+	// a claim not in the token can't be set by the request
+	claims = map[string]interface{}{"org_id": nil, "tags": []interface{}{"a"}}
+	c = context.WithValue(context.Background(), UserClaimsKey, claims)
+
+	if _, err := sg.argList(c, cq.st.md, []byte(`{"org_id": 42, "tags": ["c"]}`)); err == nil {
+		t.Fatal("expected an error for a missing claim sent as a variable")
+	}
+}
+
+func TestRoleDB(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	adb, amock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer adb.Close()
+
+	conf := &Config{}
+
+	if err := conf.AddRoleTable("admin", "products", Query{}); err != nil {
+		t.Fatal(err)
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sg.SetRoleDB("root", adb); err == nil {
+		t.Fatal("expected an error for an unknown role")
+	}
+
+	if err := sg.SetRoleDB("admin", adb); err != nil {
+		t.Fatal(err)
+	}
+
+	c := context.WithValue(context.Background(), UserIDKey, 1)
+
+	amock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{"__root"}).
+		AddRow(`{"products": [{"id": 1}]}`))
+
+	if _, err := sg.GraphQL(context.WithValue(c, UserRoleKey, "admin"),
+		`query { products { id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// roles without a database of their own use the default one
+	mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{"__root"}).
+		AddRow(`{"products": [{"id": 2}]}`))
+
+	if _, err := sg.GraphQL(c, `query { products { id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
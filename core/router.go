@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// DBRouter function returns the database a read-only query should be run on
+// (eg. the closest read replica). Returning nil uses the database passed to
+// NewSuperGraph. Mutations always use that database.
+type DBRouter func(c context.Context) *sql.DB
+
+// SetDBRouter function sets the router used to pick the database for queries.
+// It must be called before the SuperGraph instance is used.
+func (sg *SuperGraph) SetDBRouter(fn DBRouter) {
+	sg.router = fn
+}
+
+// SetRoleDB function sets the database the queries and mutations of the role
+// are run on (eg. a pool of a database user with only the grants the role
+// needs) so the database enforces its grants beneath the ones of the role.
+// Queries of a role with its own database are not routed to replicas.
+// It must be called before the SuperGraph instance is used.
+func (sg *SuperGraph) SetRoleDB(role string, db *sql.DB) error {
+	if _, ok := sg.roles[role]; !ok {
+		return fmt.Errorf("role not found: %s", role)
+	}
+
+	if sg.roleDBs == nil {
+		sg.roleDBs = make(map[string]*sql.DB)
+	}
+	sg.roleDBs[role] = db
+
+	return nil
+}
+
+// roleDB returns the database of the role or the default one
+func (sg *SuperGraph) roleDB(role string) *sql.DB {
+	if db, ok := sg.roleDBs[role]; ok {
+		return db
+	}
+	return sg.db
+}
+
+// queryDB returns the database to run the query of the role on
+func (c *scontext) queryDB(role string) *sql.DB {
+	if db, ok := c.sg.roleDBs[role]; ok {
+		return db
+	}
+
+	if c.op != qcode.QTQuery || c.sg.router == nil {
+		return c.sg.db
+	}
+
+	if db := c.sg.router(c); db != nil {
+		return db
+	}
+
+	return c.sg.db
+}
@@ -0,0 +1,306 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// scalarKind is a column type with values that are validated when set
+// and can be formatted when returned
+type scalarKind int
+
+const (
+	scalarNone scalarKind = iota
+	scalarTime
+	scalarUUID
+	scalarInterval
+	scalarGeo
+)
+
+var uuidRe = regexp.MustCompile(`^\{?[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}\}?$`)
+
+// timeLayouts are the layouts of the timestamps and dates accepted
+// in variables, they are passed to the database as RFC3339
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// timeSpecial are the special values of timestamps and dates in postgres
+var timeSpecial = map[string]struct{}{
+	"now": {}, "today": {}, "tomorrow": {}, "yesterday": {},
+	"infinity": {}, "-infinity": {}, "epoch": {},
+}
+
+func scalarKindOf(t string) scalarKind {
+	switch {
+	case strings.HasPrefix(t, "timestamp"), t == "date":
+		return scalarTime
+	case t == "uuid":
+		return scalarUUID
+	case strings.HasPrefix(t, "interval"):
+		return scalarInterval
+	case psql.GeoType(t) != "":
+		return scalarGeo
+	}
+	return scalarNone
+}
+
+// addScalars sets the geometry columns returned as GeoJSON and checks
+// the formats of the date and time columns
+func addScalars(c *Config, di *psql.DBInfo) error {
+	for _, t := range c.Tables {
+		for _, cc := range t.Columns {
+			name := strings.SplitN(cc.Format, ":", 2)[0]
+
+			if name != "geojson" && name != "rfc3339" && name != "epoch_ms" {
+				continue
+			}
+
+			col, err := di.GetColumn(t.Name, cc.Name)
+			if err != nil {
+				return fmt.Errorf("column format: %w", err)
+			}
+
+			switch k := scalarKindOf(col.Type); {
+			case name == "geojson" && k == scalarGeo:
+				col.GeoJSON = true
+
+			case name != "geojson" && k == scalarTime:
+
+			default:
+				return fmt.Errorf("column format: column '%s' in table '%s' of type '%s' can't have the %s format",
+					cc.Name, t.Name, col.Type, name)
+			}
+		}
+	}
+	return nil
+}
+
+// scalarValue validates the value of a variable or column set in a
+// mutation for the type of the column. Timestamps set as epoch millis
+// are changed to RFC3339, intervals set as a number of seconds or a
+// duration (eg. 1h30m) are changed to seconds
+func scalarValue(typ string, v json.RawMessage) (json.RawMessage, error) {
+	k := scalarKindOf(typ)
+
+	if k == scalarNone || len(v) == 0 || bytes.Equal(v, []byte("null")) {
+		return v, nil
+	}
+
+	if k == scalarGeo {
+		var g struct {
+			Type string `json:"type"`
+		}
+		if v[0] != '{' || json.Unmarshal(v, &g) != nil || g.Type == "" {
+			return nil, errors.New("a GeoJSON geometry object expected")
+		}
+		return v, nil
+	}
+
+	var s string
+
+	if v[0] == '"' {
+		if err := json.Unmarshal(v, &s); err != nil {
+			return nil, err
+		}
+	}
+
+	switch k {
+	case scalarTime:
+		if v[0] != '"' {
+			ms, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp: %s", v)
+			}
+			t := time.Unix(0, ms*int64(time.Millisecond)).UTC()
+			return json.Marshal(t.Format(time.RFC3339Nano))
+		}
+
+		if _, ok := timeSpecial[strings.ToLower(s)]; ok {
+			return v, nil
+		}
+
+		for _, l := range timeLayouts {
+			if _, err := time.Parse(l, s); err == nil {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid timestamp: %s", s)
+
+	case scalarUUID:
+		if !uuidRe.MatchString(s) {
+			return nil, fmt.Errorf("invalid uuid: %s", v)
+		}
+
+	case scalarInterval:
+		if v[0] != '"' {
+			if _, err := strconv.ParseFloat(string(v), 64); err != nil {
+				return nil, fmt.Errorf("invalid interval: %s", v)
+			}
+			return json.Marshal(string(v) + " seconds")
+		}
+
+		if d, err := time.ParseDuration(s); err == nil {
+			return json.Marshal(strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + " seconds")
+		}
+		if strings.TrimSpace(s) == "" {
+			return nil, errors.New("invalid interval: empty")
+		}
+	}
+
+	return v, nil
+}
+
+// scalarArg is scalarValue for a variable bound to a param,
+// each value of a list is validated
+func scalarArg(p psql.Param, v json.RawMessage) (json.RawMessage, error) {
+	if scalarKindOf(p.Type) == scalarNone {
+		return v, nil
+	}
+
+	if !p.IsArray || v[0] != '[' {
+		return scalarValue(p.Type, v)
+	}
+
+	var list []json.RawMessage
+
+	if err := json.Unmarshal(v, &list); err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		var err error
+		if list[i], err = scalarValue(p.Type, list[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(list)
+}
+
+// scalarValues validates the values of the columns set in the
+// inserts, updates and upserts for the types of the columns
+func (sg *SuperGraph) scalarValues(qc *qcode.QCode, vm map[string]json.RawMessage) error {
+	for _, m := range qc.Mutations {
+		if m.Type != qcode.QTInsert && m.Type != qcode.QTUpdate && m.Type != qcode.QTUpsert {
+			continue
+		}
+
+		ti, err := sg.pc.Schema().GetTableInfo(qc.Selects[m.SelID].Name)
+		if err != nil {
+			continue
+		}
+
+		v, ok := vm[m.ActionVar]
+		if !ok || len(v) == 0 {
+			continue
+		}
+
+		set := func(row map[string]json.RawMessage) error {
+			for cn, val := range row {
+				col, err := ti.GetColumn(strings.ToLower(cn))
+				if err != nil {
+					continue
+				}
+				if val, err = sg.coerceValue(col.Type, val); err != nil {
+					return fmt.Errorf("column %s: %w", cn, err)
+				}
+				if row[cn], err = scalarValue(col.Type, val); err != nil {
+					return fmt.Errorf("column %s: %w", cn, err)
+				}
+			}
+			return nil
+		}
+
+		if vm[m.ActionVar], err = editRows(v, set); err != nil {
+			return fmt.Errorf("variable '%s': %w", m.ActionVar, err)
+		}
+	}
+
+	return nil
+}
+
+// scalarVarValues is scalarValues for the variables passed to the query
+func (sg *SuperGraph) scalarVarValues(qc *qcode.QCode, vars json.RawMessage) (json.RawMessage, error) {
+	if len(vars) == 0 || len(qc.Mutations) == 0 {
+		return vars, nil
+	}
+
+	var vm map[string]json.RawMessage
+
+	if err := json.Unmarshal(vars, &vm); err != nil {
+		return nil, err
+	}
+
+	if err := sg.scalarValues(qc, vm); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(vm)
+}
+
+// parseTime parses a timestamp or date returned by the database,
+// timestamps without a time zone are in UTC
+func parseTime(v json.RawMessage) (time.Time, error) {
+	var s string
+
+	if err := json.Unmarshal(v, &s); err != nil {
+		return time.Time{}, err
+	}
+
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+
+	// postgres returns the offset of the time zone without minutes
+	if t, err := time.Parse("2006-01-02T15:04:05.999999999Z07", s); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid timestamp: %s", s)
+}
+
+// formatRFC3339 formats a timestamp as RFC3339 in UTC or in the
+// time zone in the arg (eg. rfc3339:America/New_York)
+func formatRFC3339(v json.RawMessage, arg string) (json.RawMessage, error) {
+	t, err := parseTime(v)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := time.UTC
+
+	if arg != "" {
+		if loc, err = time.LoadLocation(arg); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(t.In(loc).Format(time.RFC3339Nano))
+}
+
+// formatEpochMillis formats a timestamp as the milliseconds since the epoch
+func formatEpochMillis(v json.RawMessage, arg string) (json.RawMessage, error) {
+	t, err := parseTime(v)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := t.UnixNano() / int64(time.Millisecond)
+	return json.RawMessage(strconv.FormatInt(ms, 10)), nil
+}
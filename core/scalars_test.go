@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestScalarValue(t *testing.T) {
+	tests := []struct {
+		typ string
+		val string
+		exp string
+	}{
+		{"timestamp with time zone", `"2020-01-02T03:04:05Z"`, `"2020-01-02T03:04:05Z"`},
+		{"timestamp without time zone", `"2020-01-02 03:04:05"`, `"2020-01-02 03:04:05"`},
+		{"timestamp without time zone", `1577934245000`, `"2020-01-02T03:04:05Z"`},
+		{"date", `"2020-01-02"`, `"2020-01-02"`},
+		{"date", `"today"`, `"today"`},
+		{"uuid", `"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"`, `"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"`},
+		{"interval", `90`, `"90 seconds"`},
+		{"interval", `"1h30m"`, `"5400 seconds"`},
+		{"interval", `"2 days"`, `"2 days"`},
+		{"geometry(Point,4326)", `{"type": "Point", "coordinates": [1, 2]}`, `{"type": "Point", "coordinates": [1, 2]}`},
+		{"text", `"anything"`, `"anything"`},
+		{"uuid", `null`, `null`},
+	}
+
+	for _, v := range tests {
+		res, err := scalarValue(v.typ, json.RawMessage(v.val))
+		if err != nil {
+			t.Errorf("%s %s: %s", v.typ, v.val, err)
+			continue
+		}
+		if string(res) != v.exp {
+			t.Errorf("%s %s: expected %s got %s", v.typ, v.val, v.exp, res)
+		}
+	}
+
+	invalid := []struct {
+		typ string
+		val string
+	}{
+		{"timestamp with time zone", `"yesterday at noon"`},
+		{"timestamp with time zone", `true`},
+		{"uuid", `"1234"`},
+		{"interval", `""`},
+		{"geometry", `"POINT(1 2)"`},
+		{"geography", `{"coordinates": [1, 2]}`},
+	}
+
+	for _, v := range invalid {
+		if _, err := scalarValue(v.typ, json.RawMessage(v.val)); err == nil {
+			t.Errorf("%s %s: expected an error", v.typ, v.val)
+		}
+	}
+}
+
+func TestTimeFormats(t *testing.T) {
+	v := json.RawMessage(`"2020-01-02T08:34:05.5+05:30"`)
+
+	res, err := formatRFC3339(v, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `"2020-01-02T03:04:05.5Z"`; string(res) != exp {
+		t.Fatalf("expected %s got %s", exp, res)
+	}
+
+	res, err = formatEpochMillis(v, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `1577934245500`; string(res) != exp {
+		t.Fatalf("expected %s got %s", exp, res)
+	}
+
+	// timestamps without a time zone are in utc
+	res, err = formatEpochMillis(json.RawMessage(`"2020-01-02T03:04:05"`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `1577934245000`; string(res) != exp {
+		t.Fatalf("expected %s got %s", exp, res)
+	}
+}
+
+func TestScalarColumns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		Tables: []Table{{
+			Name:    "products",
+			Columns: []Column{{Name: "created_at", Format: "epoch_ms"}},
+		}},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`BETWEEN`).
+		WithArgs([]byte(`["2020-01-01T00:00:00Z","2020-02-01"]`)).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).
+			AddRow(`{"products": [{"id": 1, "created_at": "2020-01-02T03:04:05"}]}`))
+
+	res, err := sg.GraphQL(ct, `query {
+		products(where: { created_at: { between: $range } }) { id created_at }
+	}`, json.RawMessage(`{"range": [1577836800000, "2020-02-01"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"products": [{"id": 1, "created_at":1577934245000}]}`; string(res.Data) != exp {
+		t.Fatalf("expected %s got %s", exp, res.Data)
+	}
+
+	_, err = sg.GraphQL(ct, `query {
+		products(where: { created_at: { gt: $after } }) { id }
+	}`, json.RawMessage(`{"after": "last tuesday"}`))
+	if err == nil {
+		t.Fatal("expected an error for an invalid timestamp")
+	}
+
+	_, err = sg.GraphQL(ct, `mutation {
+		product(insert: $data) { id }
+	}`, json.RawMessage(`{"data": {"name": "Hat", "created_at": "soon"}}`))
+	if err == nil {
+		t.Fatal("expected an error for an invalid timestamp in a mutation")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Tables[0].Columns[0] = Column{Name: "name", Format: "geojson"}
+
+	if _, err := newTestGraph(t, conf, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for the geojson format on a text column")
+	}
+}
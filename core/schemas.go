@@ -0,0 +1,158 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// Schema struct is another schema of the database whose tables are added.
+// The tables are named with the prefix (defaults to `<name>_`) or when
+// Namespace is set are grouped under a root field of the schema name with
+// no prefix (eg. `billing { invoices { id } }`)
+type Schema struct {
+	Name      string
+	Prefix    string
+	Namespace bool
+}
+
+func (s *Schema) prefix() string {
+	if s.Prefix != "" || s.Namespace {
+		return s.Prefix
+	}
+	return s.Name + "_"
+}
+
+// addSchemas adds the tables of the other schemas in the config
+func (sg *SuperGraph) addSchemas(di *psql.DBInfo) error {
+	for i := range sg.conf.Schemas {
+		s := &sg.conf.Schemas[i]
+
+		if err := di.AddSchema(sg.db, s.Name, s.prefix(), sg.conf.Blocklist); err != nil {
+			return fmt.Errorf("schema %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// schemaNamespaces returns the namespaces of the schemas with namespace set
+func (sg *SuperGraph) schemaNamespaces() []*Namespace {
+	var nss []*Namespace
+
+	for _, s := range sg.conf.Schemas {
+		if !s.Namespace {
+			continue
+		}
+
+		ns := &Namespace{Name: s.Name}
+
+		for _, t := range sg.dbinfo.Tables {
+			if t.Schema == s.Name && !t.Blocked {
+				ns.Tables = append(ns.Tables, t.Name)
+			}
+		}
+		nss = append(nss, ns)
+	}
+
+	return nss
+}
+
+// Attach adds another Super Graph (eg. of another database) under a root field
+// of the name, its tables are selected in it (eg. `analytics { events { id } }`).
+// A query can't select from both since they are on different connections, and
+// the attached tables are not in the introspection schema. It should be called
+// before the Super Graph is used
+func (sg *SuperGraph) Attach(name string, other *SuperGraph) error {
+	if !isGraphQLName(name) {
+		return fmt.Errorf("attach: invalid name: %s", name)
+	}
+
+	if sg.dbinfo != nil {
+		for _, t := range sg.dbinfo.Tables {
+			if t.Key == strings.ToLower(name) {
+				return fmt.Errorf("attach: %s: a table of the same name exists", name)
+			}
+		}
+	}
+
+	if _, ok := sg.attached[name]; ok {
+		return fmt.Errorf("attach: %s: already attached", name)
+	}
+
+	if sg.attached == nil {
+		sg.attached = make(map[string]*SuperGraph)
+	}
+	sg.attached[name] = other
+
+	return nil
+}
+
+// attachedGraphQL runs the query on the attached Super Graph if its root field
+// is one, the root field is removed from the query and added to the result
+func (sg *SuperGraph) attachedGraphQL(c context.Context, query string, vars json.RawMessage) (
+	*Result, bool, error) {
+
+	rf, err := qcode.RootFields([]byte(query))
+	if err != nil {
+		// the error is returned when the query is compiled
+		return nil, false, nil
+	}
+
+	var at *qcode.RootField
+	n := 0
+
+	for i := range rf {
+		if _, ok := sg.attached[rf[i].Name]; ok {
+			at = &rf[i]
+			n++
+		}
+	}
+
+	if n == 0 {
+		return nil, false, nil
+	}
+
+	if n != 1 || len(rf) != 1 {
+		err := fmt.Errorf("attached database %s: can't be selected with other root fields", at.Name)
+		return &Result{Error: err.Error()}, true, err
+	}
+
+	if at.Open == -1 {
+		err := fmt.Errorf("attached database %s: no fields selected", at.Name)
+		return &Result{Error: err.Error()}, true, err
+	}
+
+	if qcode.GetQType(query) == qcode.QTSubscription {
+		err := errors.New("subscriptions are not supported on attached databases")
+		return &Result{Error: err.Error()}, true, err
+	}
+
+	q := query[:at.Start] + query[at.Open+1:at.Close] + query[at.Close+1:]
+
+	res, err := sg.attached[at.Name].GraphQL(c, q, vars)
+	if res == nil || len(res.Data) == 0 {
+		return res, true, err
+	}
+
+	key := at.Alias
+	if key == "" {
+		key = at.Name
+	}
+
+	kb, _ := json.Marshal(key)
+	data := make([]byte, 0, len(kb)+len(res.Data)+3)
+
+	data = append(data, '{')
+	data = append(data, kb...)
+	data = append(data, ':')
+	data = append(data, res.Data...)
+	data = append(data, '}')
+	res.Data = data
+
+	return res, true, err
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestSchemas(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	di := psql.GetTestDBInfo()
+	di.Schema = "public"
+
+	tables := []psql.DBTable{{Name: "invoices", Type: "table"}}
+	columns := [][]psql.DBColumn{{
+		{ID: 1, Name: "id", Type: "bigint", NotNull: true, PrimaryKey: true, UniqueKey: true},
+		{ID: 2, Name: "customer_id", Type: "bigint", FKeyTable: "public.customers", FKeyColID: []int16{1}},
+	}}
+
+	if err := di.AddSchemaTables("billing", "", tables, columns, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{Schemas: []Schema{{Name: "billing", Namespace: true}}}
+
+	sg, err := newTestGraph(t, conf, db, di)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectQuery(`FROM "billing"."invoices" AS "invoices"`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).
+			AddRow(`{"invoices": [{"id": 1, "customer": {"id": 3}}]}`))
+
+	res, err := sg.GraphQL(ct, `query { billing { invoices(limit: 1) { id customer { id } } } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"billing":{"invoices":[{"id": 1, "customer": {"id": 3}}]}}`; string(res.Data) != exp {
+		t.Fatalf("expected %s got %s", exp, res.Data)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAttach(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	adb, amock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer adb.Close()
+
+	sg, err := newTestGraph(t, nil, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asg, err := newTestGraph(t, nil, adb, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sg.Attach("analytics", asg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sg.Attach("users", asg); err == nil {
+		t.Fatal("expected an error for the name of a table")
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	amock.ExpectQuery(`SELECT jsonb_build_object\('products', `).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).
+			AddRow(`{"products": [{"id": 2}]}`))
+
+	res, err := sg.GraphQL(ct, `query { stats: analytics { products(limit: 1) { id } } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"stats":{"products": [{"id": 2}]}}`; string(res.Data) != exp {
+		t.Fatalf("expected %s got %s", exp, res.Data)
+	}
+
+	_, err = sg.GraphQL(ct, `query { users { id } analytics { products { id } } }`, nil)
+	if err == nil || !strings.Contains(err.Error(), "can't be selected with other root fields") {
+		t.Fatalf("expected an error for mixed root fields got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
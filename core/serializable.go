@@ -0,0 +1,46 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// retries of the mutations that failed a serializable transaction
+const defaultSerializableRetries = 3
+
+// serializable returns true if the mutation is run in
+// a transaction at the serializable isolation level
+func (c *scontext) serializable() bool {
+	return c.op == qcode.QTMutation && c.sg.conf.SerializableMutations &&
+		c.sg.conf.DBType != "mysql"
+}
+
+// txOptions returns the options of the transaction of the query
+func (c *scontext) txOptions() *sql.TxOptions {
+	if c.serializable() {
+		return &sql.TxOptions{Isolation: sql.LevelSerializable}
+	}
+	return nil
+}
+
+// serializableRetries returns the number of times a mutation
+// that failed with a serialization failure is run again
+func (c *scontext) serializableRetries() int {
+	if !c.serializable() {
+		return 0
+	}
+	if n := c.sg.conf.SerializableRetries; n != 0 {
+		return n
+	}
+	return defaultSerializableRetries
+}
+
+// isSerializationErr returns true when the transaction was rolled back since it
+// conflicted with another one, nothing was written to the database so it's safe
+// to run again. The blobs uploaded by the first run are used by the retries
+func isSerializationErr(err error) bool {
+	var se interface{ SQLState() string }
+	return errors.As(err, &se) && se.SQLState() == "40001"
+}
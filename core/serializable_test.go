@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestSerializableMutations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{SerializableMutations: true, SerializableRetries: 1}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 5)
+	query := `mutation { products(insert: $data) { id } }`
+	vars := []byte(`{"data": {"name": "shoes"}}`)
+
+	// the conflicting transaction is run again
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT`).WillReturnError(stateErr("40001"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": {"id": 1}}`))
+	mock.ExpectCommit()
+
+	if _, err := sg.GraphQL(ct, query, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	// up to the number of retries
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT`).WillReturnError(stateErr("40001"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT`).WillReturnError(stateErr("40001"))
+	mock.ExpectRollback()
+
+	if _, err := sg.GraphQL(ct, query, vars); !errors.Is(err, stateErr("40001")) {
+		t.Fatalf("expected a serialization failure got %v", err)
+	}
+
+	// queries are not run in a transaction
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+
+	if _, err := sg.GraphQL(ct, `query { products { id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSerializableBlobs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bs := &testBlobStore{}
+
+	conf := &Config{
+		SerializableMutations: true,
+		Tables: []Table{{Name: "products", Columns: []Column{
+			{Name: "description", Blob: true},
+		}}},
+		BlobStore: bs,
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 5)
+	vars := []byte(`{"data": {"name": "Bag", "description": "data:text/plain;base64,aGVsbG8="}}`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT`).WillReturnError(stateErr("40001"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"product": {"id": 1}}`))
+	mock.ExpectCommit()
+
+	if _, err := sg.GraphQL(ct, `mutation { product(insert: $data) { id } }`, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	// the retry uses the blob uploaded by the first run
+	if len(bs.keys) != 1 {
+		t.Fatalf("expected a single upload got %v", bs.keys)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sessionVar is a setting set in the transaction of a request, val is the
+// constant value or the name of the value of the request when from is set
+type sessionVar struct {
+	name string
+	val  string
+	from bool
+}
+
+func (sg *SuperGraph) initSessionVars() error {
+	if len(sg.conf.SessionVars) == 0 {
+		return nil
+	}
+
+	if sg.conf.DBType == "mysql" {
+		return errors.New("session_vars: only supported with postgres")
+	}
+
+	names := make([]string, 0, len(sg.conf.SessionVars))
+	for k := range sg.conf.SessionVars {
+		if k == "" {
+			return errors.New("session_vars: a name is required")
+		}
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(`SELECT `)
+
+	for i, k := range names {
+		v := sg.conf.SessionVars[k]
+		sv := sessionVar{name: k, val: v}
+
+		if strings.HasPrefix(v, "$") {
+			sv.val, sv.from = v[1:], true
+		}
+		sg.sessionVars = append(sg.sessionVars, sv)
+
+		if i != 0 {
+			sb.WriteString(`, `)
+		}
+		fmt.Fprintf(&sb, `set_config($%d, $%d, true)`, i*2+1, i*2+2)
+	}
+	sg.sessionStmt = sb.String()
+
+	return nil
+}
+
+// setSessionVars sets the session variables in the transaction,
+// they're dropped when it ends
+func (sg *SuperGraph) setSessionVars(c context.Context, tx *sql.Tx, role string) error {
+	if len(sg.sessionVars) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(sg.sessionVars)*2)
+
+	for _, sv := range sg.sessionVars {
+		v := sv.val
+		if sv.from {
+			v = sessionVal(c, sv.val, role)
+		}
+		args = append(args, sv.name, v)
+	}
+
+	_, err := tx.ExecContext(c, sg.sessionStmt, args...)
+	return err
+}
+
+// sessionVal returns the value of the request with the name, the user id,
+// provider and role or a claim of the user. Values not set are empty
+func sessionVal(c context.Context, name, role string) string {
+	var v interface{}
+
+	switch name {
+	case "user_id":
+		v = c.Value(UserIDKey)
+	case "user_id_provider":
+		v = c.Value(UserIDProviderKey)
+	case "user_role":
+		v = c.Value(UserRoleKey)
+	case "role":
+		v = role
+	default:
+		claims, _ := c.Value(UserClaimsKey).(map[string]interface{})
+		v = claims[name]
+	}
+
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
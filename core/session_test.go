@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestSessionVars(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{SessionVars: map[string]string{
+		"app.current_user_id": "$user_id",
+		"app.role":            "$role",
+		"app.source":          "super-graph",
+		"app.tenant_id":       "$tenant_id",
+	}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 5)
+	ct = context.WithValue(ct, UserClaimsKey, map[string]interface{}{"tenant_id": "acme"})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT set_config\(\$1, \$2, true\), set_config\(\$3, \$4, true\), `+
+		`set_config\(\$5, \$6, true\), set_config\(\$7, \$8, true\)`).
+		WithArgs("app.current_user_id", "5", "app.role", "user", "app.source", "super-graph",
+			"app.tenant_id", "acme").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+	mock.ExpectCommit()
+
+	if _, err := sg.GraphQL(ct, `query { products { id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// values not set are empty
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT set_config`).
+		WithArgs("app.current_user_id", "", "app.role", "anon", "app.source", "super-graph",
+			"app.tenant_id", "").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+	mock.ExpectCommit()
+
+	if _, err := sg.GraphQL(context.Background(), `query { products { id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	// max number of queries replayed on the shadow database at the
+	// same time, more are dropped so the shadow never slows down the
+	// primary database
+	maxShadowQueries = 10
+	shadowTimeout    = 30 * time.Second
+)
+
+// ShadowResult struct is the outcome of replaying a query on the shadow database
+type ShadowResult struct {
+	Name          string
+	SQL           string
+	Match         bool
+	Latency       time.Duration
+	ShadowLatency time.Duration
+	Err           error
+}
+
+// ShadowFn function is called with the result of every replayed query
+type ShadowFn func(ShadowResult)
+
+type shadow struct {
+	db  *sql.DB
+	fn  ShadowFn
+	sem chan struct{}
+}
+
+// SetShadowDB function sets a second database that read queries are replayed
+// on in the background (eg. a new Postgres version you're migrating to). The
+// result and latency are compared with those of the primary database and
+// passed to fn. It must be called before the SuperGraph instance is used.
+func (sg *SuperGraph) SetShadowDB(db *sql.DB, fn ShadowFn) {
+	sg.shadow = &shadow{
+		db:  db,
+		fn:  fn,
+		sem: make(chan struct{}, maxShadowQueries),
+	}
+}
+
+// replay runs the query on the shadow database if there's room for it
+func (s *shadow) replay(res ShadowResult, args []interface{}, data []byte) {
+	select {
+	case s.sem <- struct{}{}:
+	default:
+		return
+	}
+
+	go func() {
+		defer func() { <-s.sem }()
+
+		ct, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+		defer cancel()
+
+		var sdata []byte
+		st := time.Now()
+
+		res.Err = s.db.QueryRowContext(ct, res.SQL, args...).Scan(&sdata)
+		res.ShadowLatency = time.Since(st)
+		res.Match = res.Err == nil && bytes.Equal(data, sdata)
+
+		s.fn(res)
+	}()
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestShadowDB(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sdb, smock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdb.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan ShadowResult, 1)
+	sg.SetShadowDB(sdb, func(res ShadowResult) { results <- res })
+
+	tests := []struct {
+		data, sdata string
+		match       bool
+	}{
+		{`{"products": [{"id": 1}]}`, `{"products": [{"id": 1}]}`, true},
+		{`{"products": [{"id": 1}]}`, `{"products": [{"id": 2}]}`, false},
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	for _, tt := range tests {
+		mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(tt.data))
+		smock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(tt.sdata))
+
+		res, err := sg.GraphQL(ct, `query getProducts { products { id } }`, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(res.Data) != tt.data {
+			t.Fatalf("expected the primary database result, got: %s", res.Data)
+		}
+
+		select {
+		case sr := <-results:
+			if sr.Err != nil {
+				t.Fatal(sr.Err)
+			}
+			if sr.Match != tt.match || sr.Name != "getProducts" {
+				t.Fatalf("unexpected shadow result: %+v", sr)
+			}
+
+		case <-time.After(2 * time.Second):
+			t.Fatal("shadow query was not replayed")
+		}
+	}
+
+	if _, err := sg.GraphQL(ct, `mutation { product(insert: $data) { id } }`, nil); err == nil {
+		t.Fatal("expected an error for the unmocked mutation")
+	}
+
+	select {
+	case sr := <-results:
+		t.Fatalf("mutations should not be replayed: %+v", sr)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// keys of the slow query samples kept in the storage
+	kvKeySlowQuery   = "slow_query:"
+	kvKeySlowQueries = "slow_queries"
+	kvKeySlowSampled = "slow_query_sampled:"
+
+	defaultSlowQueryInterval = time.Hour
+	defaultSlowQueryMax      = 100
+
+	// max number of slow queries explained at the same time, more
+	// are dropped so the sampling never adds much load to the database
+	maxSlowQueryExplains = 2
+	slowQueryTimeout     = time.Minute
+)
+
+// SlowQuery struct configures the sampling of the plans of the slow queries,
+// a query slower than the threshold is run again with EXPLAIN ANALYZE in the
+// background and the plan kept in the storage. Only queries are sampled and
+// not mutations since the statement is run again
+type SlowQuery struct {
+	// Threshold is the time a query runs for before it's slow.
+	// Defaults to zero which turns the sampling off
+	Threshold time.Duration
+
+	// Interval is the time between the samples of a query, queries with
+	// the same fingerprint are the same query. Defaults to an hour
+	Interval time.Duration
+
+	// Max is the number of samples kept, the oldest are dropped past it.
+	// Defaults to 100
+	Max int
+}
+
+// SlowQuerySample struct is the plan of a slow query, the plan is the
+// output of EXPLAIN (ANALYZE, FORMAT JSON) and Error is set instead
+// when the query could not be explained
+type SlowQuerySample struct {
+	Fingerprint string          `json:"fingerprint"`
+	Name        string          `json:"name,omitempty"`
+	Role        string          `json:"role"`
+	SQL         string          `json:"sql"`
+	Duration    time.Duration   `json:"duration"`
+	At          time.Time       `json:"at"`
+	Plan        json.RawMessage `json:"plan,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+func (sg *SuperGraph) initSlowQuery() error {
+	sq := &sg.conf.SlowQuery
+
+	if sq.Threshold <= 0 {
+		return nil
+	}
+
+	if sg.conf.DBType == "mysql" {
+		return errors.New("slow_query: only supported with postgres")
+	}
+
+	if sq.Interval <= 0 {
+		sq.Interval = defaultSlowQueryInterval
+	}
+
+	if sq.Max <= 0 {
+		sq.Max = defaultSlowQueryMax
+	}
+
+	sg.slowSem = make(chan struct{}, maxSlowQueryExplains)
+	return nil
+}
+
+// slowQuery returns true if a query that took d is slow
+func (sg *SuperGraph) slowQuery(d time.Duration) bool {
+	return sg.slowSem != nil && d >= sg.conf.SlowQuery.Threshold
+}
+
+// sampleSlowQuery explains the query in the background
+// if it was not sampled in the interval
+func (sg *SuperGraph) sampleSlowQuery(db *sql.DB, s SlowQuerySample, args []interface{}) {
+	select {
+	case sg.slowSem <- struct{}{}:
+	default:
+		return
+	}
+
+	go func() {
+		defer func() { <-sg.slowSem }()
+
+		ct, cancel := context.WithTimeout(context.Background(), slowQueryTimeout)
+		defer cancel()
+
+		// the storage is shared so an instance samples a query
+		// that was not sampled by any of them in the interval
+		ok, err := sg.kv.Add(ct, kvKeySlowSampled+s.Fingerprint, []byte{'1'},
+			sg.conf.SlowQuery.Interval)
+		if err != nil {
+			sg.log.Printf("WRN slow query: %s", err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		var plan []byte
+
+		err = db.QueryRowContext(ct, "EXPLAIN (ANALYZE, FORMAT JSON) "+s.SQL, args...).Scan(&plan)
+		if err != nil {
+			s.Error = err.Error()
+		} else {
+			s.Plan = plan
+		}
+
+		if err := sg.saveSlowQuery(ct, s); err != nil {
+			sg.log.Printf("WRN slow query: %s", err)
+		}
+	}()
+}
+
+// saveSlowQuery keeps the sample of the query in the storage along with
+// a list of the queries sampled, oldest first
+func (sg *SuperGraph) saveSlowQuery(c context.Context, s SlowQuerySample) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	if err := sg.kv.Set(c, kvKeySlowQuery+s.Fingerprint, b, 0); err != nil {
+		return err
+	}
+
+	sg.slowMu.Lock()
+	defer sg.slowMu.Unlock()
+
+	fps, err := sg.slowQueryList(c)
+	if err != nil {
+		return err
+	}
+
+	list := make([]string, 0, len(fps)+1)
+	for _, fp := range fps {
+		if fp != s.Fingerprint {
+			list = append(list, fp)
+		}
+	}
+	list = append(list, s.Fingerprint)
+
+	if n := len(list) - sg.conf.SlowQuery.Max; n > 0 {
+		for _, fp := range list[:n] {
+			if err := sg.kv.Delete(c, kvKeySlowQuery+fp); err != nil {
+				return err
+			}
+		}
+		list = list[n:]
+	}
+
+	if b, err = json.Marshal(list); err != nil {
+		return err
+	}
+	return sg.kv.Set(c, kvKeySlowQueries, b, 0)
+}
+
+func (sg *SuperGraph) slowQueryList(c context.Context) ([]string, error) {
+	var fps []string
+
+	b, err := sg.kv.Get(c, kvKeySlowQueries)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &fps); err != nil {
+		return nil, err
+	}
+	return fps, nil
+}
+
+// SlowQueries function returns the plans sampled for the slow queries
+// newest first (slow_query)
+func (sg *SuperGraph) SlowQueries(c context.Context) ([]SlowQuerySample, error) {
+	fps, err := sg.slowQueryList(c)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]SlowQuerySample, 0, len(fps))
+
+	for i := len(fps) - 1; i >= 0; i-- {
+		b, err := sg.kv.Get(c, kvKeySlowQuery+fps[i])
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			continue
+		}
+
+		var s SlowQuerySample
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+
+	return samples, nil
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestSlowQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{SlowQuery: SlowQuery{Threshold: time.Nanosecond, Max: 1}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.Background()
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`)
+	}
+
+	mock.ExpectQuery(`SELECT`).WillReturnRows(rows())
+	mock.ExpectQuery(`EXPLAIN \(ANALYZE, FORMAT JSON\) SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"plan"}).AddRow(`[{"Plan":{}}]`))
+
+	if _, err := sg.GraphQL(ct, `query getProducts { products { id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var ss []SlowQuerySample
+
+	waitFor(t, "expected the slow query to be sampled", func() bool {
+		ss, err = sg.SlowQueries(ct)
+		return err == nil && len(ss) == 1
+	})
+
+	if ss[0].Name != "getProducts" || string(ss[0].Plan) != `[{"Plan":{}}]` || ss[0].SQL == "" {
+		t.Fatalf("unexpected sample: %+v", ss[0])
+	}
+
+	// the same query is not sampled again in the interval
+	mock.ExpectQuery(`SELECT`).WillReturnRows(rows())
+
+	if _, err := sg.GraphQL(ct, `query getProducts { products { id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest sample is dropped past max
+	mock.ExpectQuery(`SELECT`).WillReturnRows(rows())
+	mock.ExpectQuery(`EXPLAIN`).WillReturnError(context.Canceled)
+
+	if _, err := sg.GraphQL(ct, `query getIDs { products { id name } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "expected the new sample", func() bool {
+		ss, err = sg.SlowQueries(ct)
+		return err == nil && len(ss) == 1 && ss[0].Name == "getIDs"
+	})
+
+	if ss[0].Error == "" || ss[0].Plan != nil {
+		t.Fatalf("expected the explain error in the sample: %+v", ss[0])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SQLFragments are extra sql added to the queries of trusted callers,
+// they're rendered as is so they must never come from the public api
+type SQLFragments struct {
+	// Hint is a comment added before the query (eg. for pg_hint_plan)
+	// as /*+ hint */
+	Hint string `json:"hint"`
+
+	// Where are conditions added to the filters of the selections of the
+	// tables (eg. {"products": "products.price > 10"})
+	Where map[string]string `json:"where"`
+}
+
+// sqlFragments returns the sql fragments set on the context
+func sqlFragments(ct context.Context) *SQLFragments {
+	v, _ := ct.Value(SQLFragmentsKey).(*SQLFragments)
+	return v
+}
+
+// setSQLFragments checks the sql fragments and adds them to the compile
+// options of the query, the tables are keyed by their name in the database
+func (c *scontext) setSQLFragments(cq *cquery, sf *SQLFragments) error {
+	if c.sg.conf.DBType == "mysql" {
+		return fmt.Errorf("sql fragments: not supported with mysql")
+	}
+
+	if strings.Contains(sf.Hint, "*/") {
+		return fmt.Errorf("sql fragments: hint can't end the comment")
+	}
+
+	if len(sf.Where) != 0 {
+		cq.md.Where = make(map[string]string, len(sf.Where))
+	}
+
+	for k, v := range sf.Where {
+		ti, err := c.sg.pc.Schema().GetTableInfo(k)
+		if err != nil {
+			return fmt.Errorf("sql fragments: %w", err)
+		}
+		if strings.TrimSpace(v) == "" {
+			return fmt.Errorf("sql fragments: empty condition for '%s'", k)
+		}
+		cq.md.Where[ti.Name] = v
+	}
+
+	cq.frags = sf
+	return nil
+}
+
+// hintComment returns the hint as an sql comment, it goes first
+// since planners like pg_hint_plan only read the first comment
+func hintComment(sf *SQLFragments) string {
+	if sf == nil || sf.Hint == "" {
+		return ""
+	}
+	return "/*+ " + sf.Hint + " */ "
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestSQLFragments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := `query getProducts { products(where: { id: { gt: 1 } }) { id user { id } } }`
+
+	ct := context.WithValue(context.Background(), SQLFragmentsKey, &SQLFragments{
+		Hint:  "SeqScan(products)",
+		Where: map[string]string{"products": "products.price > 10", "user": "users.id <> 0"},
+	})
+
+	mock.ExpectQuery(`^/\*\+ SeqScan\(products\) \*/ SELECT .*` +
+		`WHERE \(\(\("products"\."id"\) > '1' :: bigint\) AND \(products\.price > 10\)\).*` +
+		`AND \(users\.id <> 0\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+
+	if _, err := sg.GraphQL(ct, gql, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the query with the fragments isn't kept in the compile cache
+	if n := sg.CompileCacheStats().Entries; n != 0 {
+		t.Fatalf("expected an empty compile cache got %d", n)
+	}
+
+	ct = context.WithValue(context.Background(), SQLFragmentsKey, &SQLFragments{Hint: "x */ DROP"})
+
+	if _, err := sg.GraphQL(ct, gql, nil); err == nil {
+		t.Fatal("expected an error for a hint ending the comment")
+	}
+
+	ct = context.WithValue(context.Background(), SQLFragmentsKey, &SQLFragments{
+		Where: map[string]string{"unknown": "true"},
+	})
+
+	if _, err := sg.GraphQL(ct, gql, nil); err == nil {
+		t.Fatal("expected an error for an unknown table")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
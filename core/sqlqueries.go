@@ -0,0 +1,153 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// addSQLQueries adds the named sql queries as tables of the sql type
+// with the columns set, their rows are selected from the sql
+func addSQLQueries(c *Config, di *psql.DBInfo) error {
+	for _, q := range c.SQLQueries {
+		if err := checkSQLQuery(c, q); err != nil {
+			return fmt.Errorf("sql query %s: %w", q.Name, err)
+		}
+
+		for _, t := range di.Tables {
+			if strings.EqualFold(t.Name, q.Name) {
+				return fmt.Errorf("sql query %s: a table of the same name exists", q.Name)
+			}
+		}
+
+		table := psql.DBTable{
+			Name:    q.Name,
+			Key:     strings.ToLower(q.Name),
+			Type:    "sql",
+			SQL:     q.SQL,
+			SQLArgs: sqlQueryCols(q.Args),
+		}
+
+		di.AddTable(table, sqlQueryCols(q.Columns))
+	}
+
+	return nil
+}
+
+// checkSQLQuery returns an error if the arguments used in the sql are
+// not set or the arguments, columns or roles are not valid
+func checkSQLQuery(c *Config, q SQLQuery) error {
+	switch {
+	case q.Name == "":
+		return errors.New("name required")
+	case strings.TrimSpace(q.SQL) == "":
+		return errors.New("sql required")
+	case len(q.Columns) == 0:
+		return errors.New("columns required")
+	}
+
+	for _, col := range append(q.Args, q.Columns...) {
+		if col.Name == "" || col.Type == "" {
+			return fmt.Errorf("name and type required: '%s'", col.Name)
+		}
+	}
+
+	_, names := psql.SplitSQLArgs(q.SQL)
+
+	for _, n := range names {
+		found := false
+		for _, a := range q.Args {
+			if strings.EqualFold(a.Name, n) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("argument '$%s' used in the sql is not set in args", n)
+		}
+	}
+
+	for _, r := range q.Roles {
+		found := false
+		for _, role := range c.Roles {
+			if role.Name == sanitize(r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("role not found: %s", r)
+		}
+	}
+
+	return nil
+}
+
+func sqlQueryCols(cols []Column) []psql.DBColumn {
+	dc := make([]psql.DBColumn, 0, len(cols))
+
+	for _, c := range cols {
+		dc = append(dc, psql.DBColumn{
+			Name: c.Name,
+			Key:  strings.ToLower(c.Name),
+			Type: c.Type,
+		})
+	}
+	return dc
+}
+
+// sqlQueryOpts returns the options that make the named sql queries root
+// fields that take the args argument like the table functions
+func sqlQueryOpts(c *Config) []qcode.Option {
+	opts := make([]qcode.Option, 0, len(c.SQLQueries))
+
+	for _, q := range c.SQLQueries {
+		opts = append(opts, qcode.WithTableFunction(q.Name, q.Name))
+	}
+	return opts
+}
+
+// addSQLQueryRoles blocks the named sql queries for the roles not set
+// in their roles, for all of them when it's empty, and their mutations
+// for all the roles. The other settings
+// of the role for the query (eg. filters) are kept
+func addSQLQueryRoles(c *Config, qc *qcode.Compiler) error {
+	for _, q := range c.SQLQueries {
+		for _, r := range c.Roles {
+			rt := RoleTable{Name: q.Name}
+
+			if t := r.GetTable(q.Name); t != nil {
+				rt = *t
+			}
+			rt.ReadOnly = true
+			rt.Insert, rt.Update, rt.Delete = nil, nil, nil
+
+			if !inSanitizedList(q.Roles, r.Name) {
+				query := Query{}
+				if rt.Query != nil {
+					query = *rt.Query
+				}
+				query.Block = true
+				rt.Query = &query
+			}
+
+			if err := addRole(qc, r, rt, c.DefaultBlock); err != nil {
+				return fmt.Errorf("sql query %s: %w", q.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func inSanitizedList(list []string, v string) bool {
+	for _, s := range list {
+		if sanitize(s) == v {
+			return true
+		}
+	}
+	return false
+}
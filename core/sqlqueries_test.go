@@ -0,0 +1,107 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+func TestSQLQueries(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	topProducts := SQLQuery{
+		Name:    "top_products",
+		SQL:     `SELECT id, name, 'a $b' AS note FROM products WHERE price > $min_price ORDER BY price DESC`,
+		Args:    []Column{{Name: "min_price", Type: "numeric"}},
+		Columns: []Column{{Name: "id", Type: "bigint"}, {Name: "name", Type: "text"}, {Name: "note", Type: "text"}},
+		Roles:   []string{"user"},
+	}
+
+	conf := &Config{SQLQueries: []SQLQuery{topProducts}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compile := func(query, role string) (*cquery, error) {
+		cq := &cquery{q: rquery{op: qcode.GetQType(query), query: []byte(query)}}
+		return cq, sg.compileQuery(cq, role)
+	}
+
+	cq, err := compile(`query { top_products(args: { min_price: $min }, where: { id: { gt: 2 } }) { id name } }`, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `FROM (SELECT id, name, 'a $b' AS note FROM products WHERE price > ( $1 :: numeric) ORDER BY price DESC) AS "top_products"`
+	if !strings.Contains(cq.st.sql, exp) {
+		t.Fatalf("expected the sql query in:\n%s", cq.st.sql)
+	}
+
+	// arguments not set are null
+	if cq, err = compile(`query { top_products { id } }`, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(cq.st.sql, `price > (NULL :: numeric)`) {
+		t.Fatalf("expected a null argument in:\n%s", cq.st.sql)
+	}
+
+	if _, err := compile(`query { top_products(args: { max_price: 10 }) { id } }`, "user"); err == nil {
+		t.Fatal("expected an error for an unknown argument")
+	}
+
+	// roles not set in roles get nothing
+	if cq, err = compile(`query { top_products { id } }`, "anon"); err != nil {
+		t.Fatal(err)
+	}
+
+	if cq.st.qc.Selects[0].SkipRender != qcode.SkipTypeBlocked {
+		t.Fatal("expected the sql query to be blocked for anon")
+	}
+
+	// no role can run a query without roles
+	open := topProducts
+	open.Roles = nil
+
+	sg1, err := newTestGraph(t, &Config{SQLQueries: []SQLQuery{open}}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, role := range []string{"user", "anon"} {
+		cq := &cquery{q: rquery{op: qcode.QTQuery, query: []byte(`query { top_products { id } }`)}}
+		if err := sg1.compileQuery(cq, role); err != nil {
+			t.Fatal(err)
+		}
+		if cq.st.qc.Selects[0].SkipRender != qcode.SkipTypeBlocked {
+			t.Fatalf("expected the sql query without roles to be blocked for %s", role)
+		}
+	}
+
+	if _, err := compile(`mutation { top_products(insert: $data) { id } }`, "user"); err == nil {
+		t.Fatal("expected an error for a mutation")
+	}
+
+	bad := topProducts
+	bad.Args = nil
+
+	if _, err := newTestGraph(t, &Config{SQLQueries: []SQLQuery{bad}}, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for an argument that's not set")
+	}
+
+	bad = topProducts
+	bad.Name = "products"
+
+	if _, err := newTestGraph(t, &Config{SQLQueries: []SQLQuery{bad}}, db, psql.GetTestDBInfo()); err == nil {
+		t.Fatal("expected an error for the name of a table")
+	}
+}
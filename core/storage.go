@@ -0,0 +1,573 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	redisKeyStorage     = "sg:kv:"
+	defaultStorageTable = "sg_storage"
+
+	// keys of the values kept in the storage
+	kvKeyAPQ       = "apq:"
+	kvKeyAllowList = "allow_list"
+)
+
+// Storage configures the key value store shared by the automatic persisted
+// queries, the allow list, the idempotency keys and the rate limits. Pick
+// one that all the instances can reach so they see the same values
+type Storage struct {
+	// Type of the store, it can be `memory` (default), `file`,
+	// `redis` or `database`
+	Type string
+
+	// Path is the directory of the file store
+	Path string
+
+	// URL is the url of the redis store (eg. redis://:password@localhost:6379/0)
+	URL string
+
+	// Table is the table of the database store, it needs the columns
+	// `key text primary key`, `value bytea` and `expires_at timestamptz`.
+	// Defaults to sg_storage
+	Table string
+}
+
+// KVStore is a key value store with values that can expire, a ttl of
+// zero never expires. Get returns nil for an unknown or expired key
+type KVStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, val []byte, ttl time.Duration) error
+
+	// Add sets the value only when the key is not set and returns true if it was
+	Add(ctx context.Context, key string, val []byte, ttl time.Duration) (bool, error)
+
+	// Incr adds one to the counter at the key and returns it, the
+	// ttl is only set when the counter is created
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+
+	Delete(ctx context.Context, key string) error
+}
+
+func (sg *SuperGraph) initStorage() error {
+	if sg.conf.KVStore != nil {
+		sg.kv = sg.conf.KVStore
+		return nil
+	}
+
+	s, err := newKVStore(sg.conf, sg.db)
+	if err != nil {
+		return err
+	}
+	sg.kv = s
+
+	return nil
+}
+
+// newKVStore returns the store set in the storage config
+func newKVStore(conf *Config, db *sql.DB) (KVStore, error) {
+	st := &conf.Storage
+
+	switch st.Type {
+	case "", "memory":
+		return NewMemoryKVStore(), nil
+
+	case "file":
+		if st.Path == "" {
+			return nil, errors.New("storage: path is required for the file store")
+		}
+		if err := os.MkdirAll(st.Path, 0755); err != nil {
+			return nil, fmt.Errorf("storage: %w", err)
+		}
+		return NewFileKVStore(st.Path), nil
+
+	case "redis":
+		s, err := NewRedisKVStore(st.URL)
+		if err != nil {
+			return nil, fmt.Errorf("storage: %w", err)
+		}
+		return s, nil
+
+	case "database":
+		if db == nil {
+			return nil, errors.New("storage: a database connection is required for the database store")
+		}
+		return NewDBKVStore(db, st.Table)
+	}
+
+	return nil, fmt.Errorf("storage: unknown store '%s'", st.Type)
+}
+
+// sharedStorage returns true if the storage is set to something other
+// than memory, only then the allow list and the persisted queries use it
+func (sg *SuperGraph) sharedStorage() bool {
+	return sg.conf.KVStore != nil ||
+		(sg.conf.Storage.Type != "" && sg.conf.Storage.Type != "memory")
+}
+
+// KVStore function returns the key value store set in the storage
+// config, it's the memory store when nothing is set
+func (sg *SuperGraph) KVStore() KVStore {
+	return sg.kv
+}
+
+// kvPersistedStore keeps the persisted queries in the storage
+type kvPersistedStore struct {
+	kv KVStore
+}
+
+func (s *kvPersistedStore) Get(ctx context.Context, hash string) (string, error) {
+	b, err := s.kv.Get(ctx, kvKeyAPQ+hash)
+	return string(b), err
+}
+
+func (s *kvPersistedStore) Put(ctx context.Context, hash, query string) error {
+	return s.kv.Set(ctx, kvKeyAPQ+hash, []byte(query), 0)
+}
+
+// kvAllowStore keeps the allow list in the storage in place of the file
+type kvAllowStore struct {
+	kv KVStore
+}
+
+func (s *kvAllowStore) Read() ([]byte, error) {
+	return s.kv.Get(context.Background(), kvKeyAllowList)
+}
+
+func (s *kvAllowStore) Write(b []byte) error {
+	return s.kv.Set(context.Background(), kvKeyAllowList, b, 0)
+}
+
+type kvItem struct {
+	val []byte
+	exp time.Time
+}
+
+func (it kvItem) expired(now time.Time) bool {
+	return !it.exp.IsZero() && !now.Before(it.exp)
+}
+
+func kvExpiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+type memoryKVStore struct {
+	sync.Mutex
+	items map[string]kvItem
+	swept time.Time
+}
+
+// NewMemoryKVStore function returns a key value store that keeps the values
+// in memory, it's only seen by this instance and lost on restart
+func NewMemoryKVStore() KVStore {
+	return &memoryKVStore{items: make(map[string]kvItem), swept: time.Now()}
+}
+
+func (s *memoryKVStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if it, ok := s.get(key); ok {
+		return it.val, nil
+	}
+	return nil, nil
+}
+
+func (s *memoryKVStore) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.set(key, kvItem{val: val, exp: kvExpiry(ttl)})
+	return nil
+}
+
+func (s *memoryKVStore) Add(ctx context.Context, key string, val []byte, ttl time.Duration) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.get(key); ok {
+		return false, nil
+	}
+
+	s.set(key, kvItem{val: val, exp: kvExpiry(ttl)})
+	return true, nil
+}
+
+func (s *memoryKVStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	it, ok := s.get(key)
+	if !ok {
+		it = kvItem{exp: kvExpiry(ttl)}
+	}
+
+	n, err := incrValue(it.val)
+	if err != nil {
+		return 0, err
+	}
+
+	it.val = []byte(strconv.FormatInt(n, 10))
+	s.set(key, it)
+
+	return n, nil
+}
+
+func (s *memoryKVStore) Delete(ctx context.Context, key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.items, key)
+	return nil
+}
+
+func (s *memoryKVStore) get(key string) (kvItem, bool) {
+	it, ok := s.items[key]
+	if ok && it.expired(time.Now()) {
+		delete(s.items, key)
+		return kvItem{}, false
+	}
+	return it, ok
+}
+
+// set saves the item, the expired items are dropped once a minute
+// so the keys that are never read again don't pile up
+func (s *memoryKVStore) set(key string, it kvItem) {
+	now := time.Now()
+
+	if now.Sub(s.swept) > time.Minute {
+		for k, v := range s.items {
+			if v.expired(now) {
+				delete(s.items, k)
+			}
+		}
+		s.swept = now
+	}
+
+	s.items[key] = it
+}
+
+// fileKVStore keeps each value in a file named after the hash of its key,
+// the first line of the file is the time it expires at (unix nanoseconds)
+type fileKVStore struct {
+	dir string
+
+	// mu is held while a value is read and changed
+	// by Add and Incr
+	mu sync.Mutex
+}
+
+// NewFileKVStore function returns a key value store that keeps the values
+// in files in the directory. Add and Incr are only atomic in this process,
+// use it with a single instance or a read only allow list
+func NewFileKVStore(dir string) KVStore {
+	return &fileKVStore{dir: dir}
+}
+
+func (s *fileKVStore) Get(ctx context.Context, key string) ([]byte, error) {
+	it, ok, err := s.read(key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return it.val, nil
+}
+
+func (s *fileKVStore) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	return s.write(key, kvItem{val: val, exp: kvExpiry(ttl)})
+}
+
+func (s *fileKVStore) Add(ctx context.Context, key string, val []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok, err := s.read(key); err != nil || ok {
+		return false, err
+	}
+
+	return true, s.write(key, kvItem{val: val, exp: kvExpiry(ttl)})
+}
+
+func (s *fileKVStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok, err := s.read(key)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		it = kvItem{exp: kvExpiry(ttl)}
+	}
+
+	n, err := incrValue(it.val)
+	if err != nil {
+		return 0, err
+	}
+
+	it.val = []byte(strconv.FormatInt(n, 10))
+	return n, s.write(key, it)
+}
+
+func (s *fileKVStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *fileKVStore) read(key string) (kvItem, bool, error) {
+	var it kvItem
+
+	b, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return it, false, nil
+	}
+	if err != nil {
+		return it, false, err
+	}
+
+	n := bytes.IndexByte(b, '\n')
+	if n == -1 {
+		return it, false, fmt.Errorf("storage: invalid file for key '%s'", key)
+	}
+
+	exp, err := strconv.ParseInt(string(b[:n]), 10, 64)
+	if err != nil {
+		return it, false, fmt.Errorf("storage: invalid file for key '%s'", key)
+	}
+
+	if exp != 0 {
+		it.exp = time.Unix(0, exp)
+	}
+	it.val = b[n+1:]
+
+	if it.expired(time.Now()) {
+		return it, false, s.Delete(context.Background(), key)
+	}
+	return it, true, nil
+}
+
+func (s *fileKVStore) write(key string, it kvItem) error {
+	var exp int64
+	if !it.exp.IsZero() {
+		exp = it.exp.UnixNano()
+	}
+
+	b := make([]byte, 0, len(it.val)+20)
+	b = strconv.AppendInt(b, exp, 10)
+	b = append(b, '\n')
+	b = append(b, it.val...)
+
+	// written to a temp file first so a half
+	// written value is never read
+	f, err := ioutil.TempFile(s.dir, "kv")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func (s *fileKVStore) path(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(h[:]))
+}
+
+type redisKVStore struct {
+	*redisClient
+}
+
+// NewRedisKVStore function returns a key value store that keeps the values
+// in the redis server at the url (eg. redis://:password@localhost:6379/0)
+func NewRedisKVStore(u string) (KVStore, error) {
+	c, err := newRedisClient(u)
+	if err != nil {
+		return nil, err
+	}
+	return &redisKVStore{c}, nil
+}
+
+func (s *redisKVStore) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := s.do(ctx, "GET", redisKeyStorage+key)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := v.([]byte)
+	return b, nil
+}
+
+func (s *redisKVStore) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	_, err := s.do(ctx, redisSetArgs(key, val, ttl)...)
+	return err
+}
+
+func (s *redisKVStore) Add(ctx context.Context, key string, val []byte, ttl time.Duration) (bool, error) {
+	v, err := s.do(ctx, append(redisSetArgs(key, val, ttl), "NX")...)
+	if err != nil {
+		return false, err
+	}
+	return v != nil, nil
+}
+
+func (s *redisKVStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	// the counter is created with the ttl first since
+	// INCR keeps the ttl of the key
+	if ttl > 0 {
+		if _, err := s.do(ctx, append(redisSetArgs(key, []byte("0"), ttl), "NX")...); err != nil {
+			return 0, err
+		}
+	}
+
+	v, err := s.do(ctx, "INCR", redisKeyStorage+key)
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply: %v", v)
+	}
+	return n, nil
+}
+
+func (s *redisKVStore) Delete(ctx context.Context, key string) error {
+	_, err := s.do(ctx, "DEL", redisKeyStorage+key)
+	return err
+}
+
+func redisSetArgs(key string, val []byte, ttl time.Duration) []string {
+	args := []string{"SET", redisKeyStorage + key, string(val)}
+
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+	return args
+}
+
+type dbKVStore struct {
+	db        *sql.DB
+	getQuery  string
+	setQuery  string
+	addQuery  string
+	incrQuery string
+	delQuery  string
+}
+
+// NewDBKVStore function returns a key value store that keeps the values in a
+// database table with the columns `key text primary key`, `value bytea` and
+// `expires_at timestamptz`. Expired rows are ignored but not deleted
+func NewDBKVStore(db *sql.DB, table string) (KVStore, error) {
+	if table == "" {
+		table = defaultStorageTable
+	}
+
+	if !tableRe.MatchString(table) {
+		return nil, fmt.Errorf("storage: invalid table name '%s'", table)
+	}
+
+	ins := `INSERT INTO ` + table + ` AS t (key, value, expires_at) VALUES ($1, $2, $3) `
+	expired := `t.expires_at <= now()`
+
+	return &dbKVStore{
+		db: db,
+		getQuery: `SELECT value FROM ` + table +
+			` WHERE key = $1 AND (expires_at IS NULL OR expires_at > now())`,
+		setQuery: ins +
+			`ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`,
+		addQuery: ins +
+			`ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at ` +
+			`WHERE ` + expired,
+		incrQuery: ins +
+			`ON CONFLICT (key) DO UPDATE SET ` +
+			`value = CASE WHEN ` + expired + ` THEN EXCLUDED.value ` +
+			`ELSE convert_to((convert_from(t.value, 'UTF8')::bigint + 1)::text, 'UTF8') END, ` +
+			`expires_at = CASE WHEN ` + expired + ` THEN EXCLUDED.expires_at ELSE t.expires_at END ` +
+			`RETURNING convert_from(value, 'UTF8')::bigint`,
+		delQuery: `DELETE FROM ` + table + ` WHERE key = $1`,
+	}, nil
+}
+
+func (s *dbKVStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var b []byte
+
+	err := s.db.QueryRowContext(ctx, s.getQuery, key).Scan(&b)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return b, err
+}
+
+func (s *dbKVStore) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	_, err := s.db.ExecContext(ctx, s.setQuery, key, val, dbExpiry(ttl))
+	return err
+}
+
+func (s *dbKVStore) Add(ctx context.Context, key string, val []byte, ttl time.Duration) (bool, error) {
+	res, err := s.db.ExecContext(ctx, s.addQuery, key, val, dbExpiry(ttl))
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *dbKVStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	var n int64
+
+	err := s.db.QueryRowContext(ctx, s.incrQuery, key, []byte("1"), dbExpiry(ttl)).Scan(&n)
+	return n, err
+}
+
+func (s *dbKVStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.delQuery, key)
+	return err
+}
+
+// dbExpiry returns the expires_at of the ttl, null never expires
+func dbExpiry(ttl time.Duration) interface{} {
+	if ttl <= 0 {
+		return nil
+	}
+	return time.Now().Add(ttl).UTC()
+}
+
+// incrValue returns the counter value plus one
+func incrValue(b []byte) (int64, error) {
+	if len(b) == 0 {
+		return 1, nil
+	}
+
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, errors.New("storage: value is not a counter")
+	}
+	return n + 1, nil
+}
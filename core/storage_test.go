@@ -0,0 +1,198 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+// testKVStore runs the checks all the stores must pass, expires
+// is false for stores that can't expire keys in the test
+func testKVStore(t *testing.T, s KVStore, expires bool) {
+	ctx := context.Background()
+
+	if v, err := s.Get(ctx, "a"); err != nil || v != nil {
+		t.Fatalf("expected no value got: %s, %v", v, err)
+	}
+
+	if err := s.Set(ctx, "a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := s.Get(ctx, "a"); err != nil || string(v) != "1" {
+		t.Fatalf("expected the value got: %s, %v", v, err)
+	}
+
+	if ok, err := s.Add(ctx, "a", []byte("2"), 0); err != nil || ok {
+		t.Fatalf("expected a key that's set not to be added: %v", err)
+	}
+
+	if ok, err := s.Add(ctx, "b", []byte("2"), 0); err != nil || !ok {
+		t.Fatalf("expected a new key to be added: %v", err)
+	}
+
+	for i := int64(1); i <= 2; i++ {
+		if n, err := s.Incr(ctx, "c", time.Minute); err != nil || n != i {
+			t.Fatalf("expected counter %d got: %d, %v", i, n, err)
+		}
+	}
+
+	if err := s.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := s.Get(ctx, "a"); err != nil || v != nil {
+		t.Fatalf("expected the value to be deleted got: %s, %v", v, err)
+	}
+
+	if !expires {
+		return
+	}
+
+	if err := s.Set(ctx, "d", []byte("1"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if v, err := s.Get(ctx, "d"); err != nil || v != nil {
+		t.Fatalf("expected the value to expire got: %s, %v", v, err)
+	}
+
+	if ok, err := s.Add(ctx, "d", []byte("2"), 0); err != nil || !ok {
+		t.Fatalf("expected an expired key to be added: %v", err)
+	}
+}
+
+func TestMemoryKVStore(t *testing.T) {
+	testKVStore(t, NewMemoryKVStore(), true)
+}
+
+func TestFileKVStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testKVStore(t, NewFileKVStore(dir), true)
+}
+
+func TestRedisKVStore(t *testing.T) {
+	l := fakeRedis(t)
+	defer l.Close()
+
+	s, err := NewRedisKVStore("redis://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testKVStore(t, s, false)
+}
+
+func TestDBKVStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	s, err := NewDBKVStore(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT value FROM sg_storage WHERE key = \$1`).
+		WithArgs("a").
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow([]byte("1")))
+
+	if v, err := s.Get(ctx, "a"); err != nil || string(v) != "1" {
+		t.Fatalf("expected the value got: %s, %v", v, err)
+	}
+
+	mock.ExpectExec(`INSERT INTO sg_storage AS t .* WHERE t.expires_at <= now\(\)`).
+		WithArgs("a", []byte("2"), nil).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if ok, err := s.Add(ctx, "a", []byte("2"), 0); err != nil || ok {
+		t.Fatalf("expected a key that's set not to be added: %v", err)
+	}
+
+	mock.ExpectQuery(`INSERT INTO sg_storage AS t .* RETURNING`).
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(3))
+
+	if n, err := s.Incr(ctx, "c", time.Minute); err != nil || n != 3 {
+		t.Fatalf("expected counter 3 got: %d, %v", n, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDBKVStore(db, "kv; drop table users"); err == nil {
+		t.Fatal("expected an error for an invalid table name")
+	}
+}
+
+func TestSharedStorage(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dir, err := ioutil.TempDir("", "kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		Storage:          Storage{Type: "file", Path: dir},
+		PersistedQueries: PersistedQueries{Enable: true},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	gql := `query { products { id } }`
+
+	if _, err := sg.PersistedQuery(ctx, gql, apqExt(gql)); err != nil {
+		t.Fatal(err)
+	}
+
+	h := sha256.Sum256([]byte(gql))
+
+	if v, err := sg.KVStore().Get(ctx, kvKeyAPQ+hex.EncodeToString(h[:])); err != nil || string(v) != gql {
+		t.Fatalf("expected the persisted query in the storage got: %s, %v", v, err)
+	}
+
+	query := `query getProducts { products { id } }`
+
+	if err := sg.allowList.Add(nil, query, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := sg.KVStore().Get(ctx, kvKeyAllowList)
+	if err != nil || !strings.Contains(string(v), "getProducts") {
+		t.Fatalf("expected the allow list in the storage got: %s, %v", v, err)
+	}
+
+	list, err := sg.allowedQueries()
+	if err != nil || len(list) != 1 || list[0].Name != "getProducts" {
+		t.Fatalf("expected the query in the allow list got: %v, %v", list, err)
+	}
+}
@@ -0,0 +1,294 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+const (
+	// defaultStreamBatch is the number of rows fetched at a time
+	defaultStreamBatch = 1000
+
+	// defaultStreamMaxRows is the max number of rows streamed
+	defaultStreamMaxRows = 100000
+)
+
+// GraphQLStream function runs a query with a single root list (eg. an export
+// of all the products) and writes the response to w as the rows are fetched
+// from the database in batches with a cursor, so large results are never held
+// in memory. The default limit does not apply to the root, instead the rows
+// are capped at StreamMaxRows.
+//
+// Errors found before the response is started are returned and nothing is written,
+// after that the error is also written in the response (eg. when the rows go over
+// StreamMaxRows), use Result.Streamed to tell them apart.
+func (sg *SuperGraph) GraphQLStream(c context.Context, query string, vars json.RawMessage, w io.Writer) (*Result, error) {
+	ct := scontext{
+		Context: c,
+		sg:      sg,
+		op:      qcode.GetQType(query),
+		name:    Name(query),
+	}
+
+	res := &Result{
+		op:   ct.op,
+		name: ct.name,
+		tags: sg.queryTags(ct.name),
+	}
+
+	if ct.op != qcode.QTQuery {
+		return res, errors.New("stream: only queries can be streamed")
+	}
+
+	if sg.mock != nil {
+		return res, errors.New("stream: not supported with mock data")
+	}
+
+	var role string
+
+	if keyExists(c, UserIDKey) {
+		role = "user"
+	} else {
+		role = "anon"
+	}
+
+	if v, ok, err := sg.ctxRole(c); err != nil {
+		return res, err
+	} else if ok {
+		role = v
+	}
+
+	err := ct.streamQuery(res, query, vars, role, w)
+
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res, err
+}
+
+// Streamed returns true if the response was written by GraphQLStream
+func (r *Result) Streamed() bool {
+	return r.streamed
+}
+
+func (c *scontext) streamQuery(res *Result, query string, vars []byte, role string, w io.Writer) error {
+	sg := c.sg
+
+	// the sql that sets the role from the roles_query
+	// returns a single row and cannot be streamed
+	if sg.abacEnabled {
+		return errors.New("stream: not supported with roles_query")
+	}
+
+	rq := rquery{op: c.op, name: c.name, query: []byte(query), vars: vars}
+	cq := &cquery{q: rq, md: sg.compileMeta(c)}
+	cq.md.Stream = true
+
+	if err := sg.compileQuery(cq, role); err != nil {
+		return err
+	}
+
+	res.sql = cq.st.sql
+	res.role = role
+
+	qc := cq.st.qc
+
+	if err := sg.checkIntents(qc, vars, role, true); err != nil {
+		return err
+	}
+
+	if cq.st.md.Skipped() {
+		res.streamed = true
+		_, err := io.WriteString(w, `{"data":{}}`)
+		return err
+	}
+
+	if cq.st.md.HasRemotes() {
+		return errors.New("stream: remote joins cannot be streamed")
+	}
+
+	var root *qcode.Select
+
+	for _, id := range qc.Roots {
+		if s := &qc.Selects[id]; s.SkipRender == qcode.SkipTypeNone {
+			root = s
+		}
+	}
+
+	if root.Connection != nil {
+		return fmt.Errorf("stream: %s: connections cannot be streamed", root.FieldName)
+	}
+
+	conn, err := c.queryDB(role).Conn(c)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if sg.conf.SetUserID {
+		if err := c.setLocalUserID(conn); err != nil {
+			return err
+		}
+	}
+
+	if vars, err = varDefaults(qc, vars); err != nil {
+		return err
+	}
+
+	args, err := sg.argList(c, cq.st.md, vars)
+	if err != nil {
+		return err
+	}
+
+	// a cursor only lives as long as its transaction
+	tx, err := conn.BeginTx(c, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint: errcheck
+
+	if err := sg.setSessionVars(c, tx, role); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(c, `DECLARE "__stream" NO SCROLL CURSOR FOR `+cq.st.sql, args.values...)
+	if err != nil {
+		return err
+	}
+
+	batch := sg.conf.StreamBatchSize
+	if batch <= 0 {
+		batch = defaultStreamBatch
+	}
+
+	max := sg.conf.StreamMaxRows
+	if max == 0 {
+		max = defaultStreamMaxRows
+	}
+
+	fetch := `FETCH ` + strconv.Itoa(batch) + ` FROM "__stream"`
+
+	var r *relayer
+	if sg.conf.Relay {
+		r = &relayer{sels: qc.Selects, schema: sg.pc.Schema()}
+	}
+
+	bw := bufio.NewWriter(w)
+	n := 0
+
+	begin := func() {
+		res.streamed = true
+		bw.WriteString(`{"data":{`) //nolint: errcheck
+		writeKey(bw, root.FieldName)
+		bw.WriteByte('[') //nolint: errcheck
+	}
+
+	for {
+		rows, err := tx.QueryContext(c, fetch)
+		if err != nil {
+			return sg.streamErr(bw, n, err)
+		}
+
+		fetched := 0
+
+		for rows.Next() {
+			var row []byte
+
+			if err := rows.Scan(&row); err != nil {
+				rows.Close()
+				return sg.streamErr(bw, n, err)
+			}
+			fetched++
+
+			if max > 0 && n == max {
+				rows.Close()
+				err := &codeError{ErrCodeResultTooLarge,
+					fmt.Sprintf("result has more than %d rows", max)}
+				return sg.streamErr(bw, n, err)
+			}
+
+			if row, err = sg.formatData(qc, row); err != nil {
+				rows.Close()
+				return sg.streamErr(bw, n, err)
+			}
+
+			if r != nil {
+				if row, _, err = r.obj(root, root.Children, row); err != nil {
+					rows.Close()
+					return sg.streamErr(bw, n, err)
+				}
+			}
+
+			if n == 0 {
+				begin()
+			} else {
+				bw.WriteByte(',') //nolint: errcheck
+			}
+			bw.Write(row) //nolint: errcheck
+			n++
+		}
+
+		if err := rows.Err(); err != nil {
+			return sg.streamErr(bw, n, err)
+		}
+
+		if fetched < batch {
+			break
+		}
+
+		// each batch is sent as it's fetched
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return sg.streamErr(bw, n, err)
+	}
+
+	if n == 0 {
+		begin()
+	}
+	bw.WriteString(`]}}`) //nolint: errcheck
+
+	return bw.Flush()
+}
+
+// streamErr returns the error, if the response was started it's ended
+// with the error and the rows written so far as the data
+func (sg *SuperGraph) streamErr(bw *bufio.Writer, n int, err error) error {
+	if n == 0 {
+		return err
+	}
+
+	bw.WriteString(`]},"error":`) //nolint: errcheck
+	msg, _ := json.Marshal(err.Error())
+	bw.Write(msg) //nolint: errcheck
+
+	if code := ErrorCode(err); code != "" {
+		bw.WriteString(`,"code":`)          //nolint: errcheck
+		bw.WriteString(strconv.Quote(code)) //nolint: errcheck
+	}
+	bw.WriteByte('}') //nolint: errcheck
+
+	if ferr := bw.Flush(); ferr != nil {
+		sg.log.Printf("ERR stream: %s", ferr)
+	}
+
+	return err
+}
+
+func writeKey(bw *bufio.Writer, k string) {
+	b, _ := json.Marshal(k)
+	bw.Write(b)       //nolint: errcheck
+	bw.WriteByte(':') //nolint: errcheck
+}
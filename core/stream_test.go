@@ -0,0 +1,85 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestGraphQLStream(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{StreamBatchSize: 2, StreamMaxRows: 4}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+	query := `query { products { id } }`
+
+	rows := func(ids ...string) *sqlmock.Rows {
+		r := sqlmock.NewRows([]string{"json"})
+		for _, id := range ids {
+			r.AddRow(`{"id": ` + id + `}`)
+		}
+		return r
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DECLARE "__stream" NO SCROLL CURSOR FOR SELECT "__sj_0"."json"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FETCH 2 FROM "__stream"`).WillReturnRows(rows("1", "2"))
+	mock.ExpectQuery(`FETCH 2 FROM "__stream"`).WillReturnRows(rows("3"))
+	mock.ExpectCommit()
+
+	var w bytes.Buffer
+
+	res, err := sg.GraphQLStream(ct, query, nil, &w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"data":{"products":[{"id": 1},{"id": 2},{"id": 3}]}}`
+
+	if !res.Streamed() || w.String() != exp {
+		t.Fatalf("expected %s got %s", exp, w.String())
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DECLARE`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FETCH`).WillReturnRows(rows("1", "2"))
+	mock.ExpectQuery(`FETCH`).WillReturnRows(rows("3", "4"))
+	mock.ExpectQuery(`FETCH`).WillReturnRows(rows("5"))
+	mock.ExpectRollback()
+
+	w.Reset()
+
+	res, err = sg.GraphQLStream(ct, query, nil, &w)
+	if ErrorCode(err) != ErrCodeResultTooLarge || !res.Streamed() {
+		t.Fatalf("expected a result too large error: %v", err)
+	}
+
+	exp = `{"data":{"products":[{"id": 1},{"id": 2},{"id": 3},{"id": 4}]},` +
+		`"error":"result has more than 4 rows","code":"RESULT_TOO_LARGE"}`
+
+	if w.String() != exp {
+		t.Fatalf("expected %s got %s", exp, w.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	w.Reset()
+
+	if _, err := sg.GraphQLStream(ct, `query { product { id } }`, nil, &w); err == nil || w.Len() != 0 {
+		t.Fatal("expected an error for a single row")
+	}
+}
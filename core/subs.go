@@ -31,6 +31,10 @@ type sub struct {
 	ops int64
 	// index of cursor value in the arguments array
 	cindx int
+	// count of members read outside the controller
+	members int64
+	// the data is hashed with only the columns set with @watch
+	watch bool
 
 	add  chan *Member
 	del  chan *Member
@@ -60,6 +64,7 @@ type mmsg struct {
 
 type Member struct {
 	sub    *sub
+	ev     *eventSub
 	Result chan *Result
 	done   bool
 	id     xid.ID
@@ -75,6 +80,10 @@ func (sg *SuperGraph) Subscribe(c context.Context, query string, vars json.RawMe
 		return nil, errors.New("subscription: not a subscription query")
 	}
 
+	if sg.mock != nil {
+		return nil, errors.New("subscription: not supported with mock data")
+	}
+
 	if name == "" {
 		if sg.conf.UseAllowList {
 			return nil, errors.New("subscription: query name is required")
@@ -92,6 +101,16 @@ func (sg *SuperGraph) Subscribe(c context.Context, query string, vars json.RawMe
 		role = "anon"
 	}
 
+	if v, ok, err := sg.ctxRole(c); err != nil {
+		return nil, err
+	} else if ok {
+		role = v
+	}
+
+	if isEventsQuery(query) {
+		return sg.subscribeEvents(query, vars, role)
+	}
+
 	v, _ := sg.subs.LoadOrStore((name + role), &sub{
 		name: name,
 		role: role,
@@ -110,6 +129,10 @@ func (sg *SuperGraph) Subscribe(c context.Context, query string, vars json.RawMe
 		return nil, err
 	}
 
+	if vars, err = varDefaults(s.q.st.qc, vars); err != nil {
+		return nil, err
+	}
+
 	args, err := sg.argList(c, s.q.st.md, vars)
 	if err != nil {
 		return nil, err
@@ -133,12 +156,27 @@ func (sg *SuperGraph) newSub(c context.Context, s *sub, query string, vars json.
 		query: []byte(query),
 		vars:  vars,
 	}
-	s.q = &cquery{q: rq}
+	s.q = &cquery{q: rq, md: sg.compileMeta(c)}
 
 	if err := sg.compileQuery(s.q, s.role); err != nil {
 		return err
 	}
 
+	if err := sg.checkIntents(s.q.st.qc, vars, s.role, false); err != nil {
+		return err
+	}
+
+	// all members share the compiled query so it cannot depend on their variables
+	if s.q.st.md.HasDirectiveVars() {
+		return errors.New("subscription: @skip and @include only support literal values")
+	}
+
+	watch, err := checkWatch(s.q.st.qc)
+	if err != nil {
+		return err
+	}
+	s.watch = watch
+
 	if len(s.q.st.md.Params()) != 0 {
 		s.q.st.sql = renderSubWrap(s.q.st)
 	}
@@ -199,6 +237,7 @@ func (s *sub) addMember(m *Member) error {
 	s.mi = append(s.mi, mi)
 	s.res = append(s.res, m.Result)
 	s.ids = append(s.ids, m.id)
+	atomic.AddInt64(&s.members, 1)
 	return nil
 }
 
@@ -219,6 +258,7 @@ func (s *sub) deleteMember(m *Member) {
 
 	s.ids[i] = s.ids[len(s.ids)-1]
 	s.ids = s.ids[:len(s.ids)-1]
+	atomic.AddInt64(&s.members, -1)
 }
 
 func (s *sub) updateMember(msg mmsg) error {
@@ -288,9 +328,9 @@ func (sg *SuperGraph) checkUpdates(s *sub, mv mval, start int) {
 	// more details on this optimization are towards the end
 	// of the function
 	if hasParams {
-		rows, err = sg.db.QueryContext(c, s.q.st.sql, renderJSONArray(mv.params[start:end]))
+		rows, err = sg.roleDB(s.role).QueryContext(c, s.q.st.sql, renderJSONArray(mv.params[start:end]))
 	} else {
-		rows, err = sg.db.QueryContext(c, s.q.st.sql)
+		rows, err = sg.roleDB(s.role).QueryContext(c, s.q.st.sql)
 	}
 
 	if err != nil {
@@ -309,7 +349,11 @@ func (sg *SuperGraph) checkUpdates(s *sub, mv mval, start int) {
 		j := start + i
 		i++
 
-		newDH := sha256.Sum256(js)
+		newDH, err := s.dataHash(js)
+		if err != nil {
+			sg.log.Printf("ERR %s", err)
+			return
+		}
 		if mv.mi[j].dh == newDH {
 			continue
 		}
@@ -328,12 +372,33 @@ func (sg *SuperGraph) checkUpdates(s *sub, mv mval, start int) {
 
 		s.updt <- mmsg{id: mv.ids[j], dh: newDH, cursor: cur.value}
 
+		data, err := sg.computeData(c, s.q.st.qc, cur.data)
+		if err != nil {
+			sg.log.Printf("ERR %s", err)
+			return
+		}
+
+		if data, err = sg.formatData(s.q.st.qc, data); err != nil {
+			sg.log.Printf("ERR %s", err)
+			return
+		}
+
+		if data, err = sg.relayData(s.q.st.qc, data); err != nil {
+			sg.log.Printf("ERR %s", err)
+			return
+		}
+
+		if data, err = nestNamespaces(s.q.st.qc, data); err != nil {
+			sg.log.Printf("ERR %s", err)
+			return
+		}
+
 		res := &Result{
 			op:   qcode.QTQuery,
 			name: s.name,
 			sql:  s.q.st.sql,
 			role: s.q.st.role.Name,
-			Data: cur.data,
+			Data: data,
 		}
 
 		// if parameters exists then each response is unique
@@ -372,8 +437,9 @@ func renderSubWrap(st stmt) string {
 		w.WriteString(strconv.FormatInt(int64(i), 10))
 		w.WriteString(` as `)
 		w.WriteString(p.Type)
-		w.WriteString(`) as `)
+		w.WriteString(`) as "`)
 		w.WriteString(p.Name)
+		w.WriteString(`"`)
 	}
 	w.WriteString(` FROM json_array_elements($1::json) AS x`)
 	w.WriteString(`) SELECT "_sg_sub_data"."__root" FROM "_sg_sub" LEFT OUTER JOIN LATERAL (`)
@@ -407,7 +473,11 @@ func (s *sub) findByID(id xid.ID) (int, bool) {
 
 func (m *Member) Unsubscribe() {
 	if m != nil && !m.done {
-		m.sub.del <- m
+		if m.ev != nil {
+			m.ev.hub.remove(m)
+		} else {
+			m.sub.del <- m
+		}
 		m.done = true
 	}
 }
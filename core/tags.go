@@ -0,0 +1,94 @@
+package core
+
+import (
+	"sort"
+	"strings"
+)
+
+// initTags collects the tags of the queries from the allow list comments
+// (eg. /* Fetch the user @owner:accounts @team:identity */) and the
+// query_tags config, the config wins when both set a tag
+func (sg *SuperGraph) initTags() error {
+	sg.tags = make(map[string]map[string]string)
+
+	list, err := sg.allowedQueries()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range list {
+		for k, t := range v.Tags {
+			sg.addTag(v.Name, k, t)
+		}
+	}
+
+	for name, tags := range sg.conf.QueryTags {
+		for k, t := range tags {
+			sg.addTag(name, k, t)
+		}
+	}
+
+	return nil
+}
+
+func (sg *SuperGraph) addTag(name, k, v string) {
+	k, v = cleanTag(k), cleanTag(v)
+
+	if name == "" || k == "" || v == "" {
+		return
+	}
+
+	name = strings.ToLower(name)
+
+	tags, ok := sg.tags[name]
+	if !ok {
+		tags = make(map[string]string)
+		sg.tags[name] = tags
+	}
+	tags[k] = v
+}
+
+// queryTags returns the tags of the named query
+func (sg *SuperGraph) queryTags(name string) map[string]string {
+	if name == "" {
+		return nil
+	}
+	return sg.tags[strings.ToLower(name)]
+}
+
+// tagComment returns the tags as an sql comment so a slow
+// query seen in the database can be traced to its owner
+func tagComment(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+
+	sb.WriteString("/* ")
+	for i, k := range keys {
+		if i != 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(tags[k])
+	}
+	sb.WriteString(" */ ")
+
+	return sb.String()
+}
+
+// cleanTag drops the characters not allowed in tags, this keeps
+// them safe for use in sql comments and metrics labels
+func cleanTag(v string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+			r == '_' || r == '-' || r == '.' || r == ':' || r == '/' {
+			return r
+		}
+		return -1
+	}, v)
+}
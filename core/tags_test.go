@@ -0,0 +1,46 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+func TestQueryTags(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{QueryTags: map[string]map[string]string{
+		"getproducts": {"owner": "catalog", "team": "shop */ DROP"},
+	}}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := `query getProducts { products { id } }`
+	cq := &cquery{q: rquery{op: qcode.QTQuery, name: Name(query), query: []byte(query)}}
+
+	if err := sg.compileQuery(cq, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(cq.st.sql, "/* owner=catalog, team=shop/DROP */ SELECT") {
+		t.Fatalf("expected the tags in an sql comment: %s", cq.st.sql)
+	}
+
+	if tags := sg.queryTags("getProducts"); tags["owner"] != "catalog" {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+
+	if tags := sg.queryTags("getUsers"); tags != nil {
+		t.Fatalf("expected no tags got: %v", tags)
+	}
+}
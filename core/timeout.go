@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// queryTimeout returns the timeout of the query, the one of the query name
+// comes first then the one of the role and then QueryTimeout
+func (c *scontext) queryTimeout(role string) time.Duration {
+	if d, ok := c.sg.conf.QueryTimeouts[c.name]; ok && c.name != "" {
+		return d
+	}
+
+	if v, ok, err := c.sg.ctxRole(c); err == nil && ok {
+		role = v
+	}
+
+	if ro, ok := c.sg.roles[role]; ok && ro.Timeout != 0 {
+		return ro.Timeout
+	}
+	return c.sg.conf.QueryTimeout
+}
+
+// withTimeout returns a copy of the context that's canceled after the timeout,
+// the database driver cancels the running statement when it's done
+func (c *scontext) withTimeout(d time.Duration) (*scontext, context.CancelFunc) {
+	ct, cancel := context.WithTimeout(c.Context, d)
+
+	tc := *c
+	tc.Context = ct
+	tc.timeout = d
+
+	return &tc, cancel
+}
+
+// setStatementTimeout sets the timeout in the database for the statements of
+// the transaction so they're canceled even when the client can't cancel them
+func (c *scontext) setStatementTimeout(tx *sql.Tx) error {
+	ms := c.timeout.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	_, err := tx.ExecContext(c, fmt.Sprintf(`SET LOCAL statement_timeout = %d`, ms))
+	return err
+}
+
+// timeoutErr returns a QUERY_TIMEOUT error when the query was canceled for
+// running past its timeout, a client that went away is not a timeout
+func (c *scontext) timeoutErr(err error) error {
+	if err == nil || c.timeout == 0 {
+		return err
+	}
+
+	var se interface{ SQLState() string }
+
+	// 57014 is query_canceled, it's the error of the statement_timeout
+	if c.Err() == context.DeadlineExceeded ||
+		c.Err() == nil && errors.As(err, &se) && se.SQLState() == "57014" {
+		return &codeError{ErrCodeQueryTimeout, fmt.Sprintf("query timed out after %s", c.timeout)}
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := &Config{
+		QueryTimeout:  2 * time.Second,
+		QueryTimeouts: map[string]time.Duration{"salesReport": time.Minute},
+		Roles:         []Role{{Name: "user", Timeout: 5 * time.Second}},
+	}
+
+	sg, err := newTestGraph(t, conf, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		role string
+		exp  time.Duration
+	}{
+		{"salesReport", "user", time.Minute},
+		{"getProducts", "user", 5 * time.Second},
+		{"getProducts", "anon", 2 * time.Second},
+	}
+
+	for _, v := range tests {
+		c := &scontext{Context: context.Background(), sg: sg, name: v.name}
+
+		if d := c.queryTimeout(v.role); d != v.exp {
+			t.Fatalf("%s (%s): expected %s got %s", v.name, v.role, v.exp, d)
+		}
+	}
+
+	ct := context.WithValue(context.Background(), UserIDKey, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET LOCAL statement_timeout = 5000`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+	mock.ExpectCommit()
+
+	if _, err := sg.GraphQL(ct, `query getProducts { products { id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the statement canceled by the statement_timeout
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET LOCAL statement_timeout = 60000`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT`).WillReturnError(stateErr("57014"))
+	mock.ExpectRollback()
+
+	_, err = sg.GraphQL(ct, `query salesReport { products { id } }`, nil)
+
+	if code := ErrorCode(err); code != ErrCodeQueryTimeout {
+		t.Fatalf("expected the code %s got '%s' (%v)", ErrCodeQueryTimeout, code, err)
+	}
+
+	if cat := ErrorCategory(err); cat != ErrCatExecute {
+		t.Fatalf("expected the category %s got '%s'", ErrCatExecute, cat)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a query canceled by the client is not a timeout
+	cc, cancel := context.WithCancel(ct)
+	cancel()
+
+	c := &scontext{Context: cc, sg: sg, timeout: time.Second}
+
+	if err := c.timeoutErr(context.Canceled); err != context.Canceled {
+		t.Fatalf("expected the context error got %v", err)
+	}
+}
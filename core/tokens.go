@@ -0,0 +1,31 @@
+package core
+
+import "github.com/dosco/super-graph/core/internal/qcode"
+
+// Token is a token of a query with its type, value, byte offsets and location,
+// see Tokens. TokenType is the type of a token (eg. TokenName or TokenString)
+type Token = qcode.Token
+type TokenType = qcode.TokenType
+
+// Types of the tokens of a query, the keywords are query, mutation,
+// subscription, fragment and on
+const (
+	TokenName       = qcode.TokenName
+	TokenKeyword    = qcode.TokenKeyword
+	TokenPunctuator = qcode.TokenPunctuator
+	TokenVariable   = qcode.TokenVariable
+	TokenDirective  = qcode.TokenDirective
+	TokenSpread     = qcode.TokenSpread
+	TokenNumber     = qcode.TokenNumber
+	TokenString     = qcode.TokenString
+	TokenBoolean    = qcode.TokenBoolean
+	TokenComment    = qcode.TokenComment
+)
+
+// Tokens function returns the tokens of the query scanned by the same lexer
+// as queries are so formatters, syntax highlighters and editors don't need
+// a GraphQL parser of their own. The whitespace and commas between the tokens
+// are left out. On an error the tokens before it are returned with the error
+func Tokens(query string) ([]Token, error) {
+	return qcode.Tokens([]byte(query))
+}
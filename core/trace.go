@@ -0,0 +1,52 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	octrace "go.opencensus.io/trace"
+)
+
+// startSpan starts the span of a stage of the request (eg. compile), it's
+// a child of the span in the context and only recorded when that is sampled
+func startSpan(c context.Context, name string) (context.Context, *octrace.Span) {
+	return octrace.StartSpan(c, "super_graph/"+name)
+}
+
+// endSpan ends the span and sets its status when the stage failed
+func endSpan(span *octrace.Span, err error) {
+	spanError(span, err)
+	span.End()
+}
+
+func spanError(span *octrace.Span, err error) {
+	if err != nil {
+		span.SetStatus(octrace.Status{Code: octrace.StatusCodeUnknown, Message: err.Error()})
+	}
+}
+
+// compile compiles the query in a span, parsing the query is part of it
+// unless the compiled query was taken from the cache
+func (c *scontext) compile(cq *cquery, role string) error {
+	_, span := startSpan(c, "compile")
+	err := c.sg.compileQuery(cq, role)
+
+	span.AddAttributes(octrace.BoolAttribute("cache_hit", cq.cached))
+	endSpan(span, err)
+
+	return err
+}
+
+// queryFingerprint returns a short hash of the query that is the
+// same for queries only differing in whitespace, commas or comments
+func queryFingerprint(q []byte) string {
+	h := sha256.Sum256(fingerprint(q))
+	return hex.EncodeToString(h[:8])
+}
+
+// Fingerprint returns a hash of the query that is the same for queries that
+// only differ in formatting (eg. to group the metrics or traces of a query)
+func (r *Result) Fingerprint() string {
+	return r.fp
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	octrace "go.opencensus.io/trace"
+)
+
+type spanRecorder struct {
+	sync.Mutex
+	spans []*octrace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *octrace.SpanData) {
+	r.Lock()
+	r.spans = append(r.spans, s)
+	r.Unlock()
+}
+
+func TestTraceSpans(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &spanRecorder{}
+	octrace.RegisterExporter(rec)
+	defer octrace.UnregisterExporter(rec)
+
+	c, span := octrace.StartSpan(context.Background(), "request",
+		octrace.WithSampler(octrace.AlwaysSample()))
+
+	ct := context.WithValue(c, UserIDKey, 1)
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT`).WillReturnRows(
+			sqlmock.NewRows([]string{"data"}).AddRow(`{"products": []}`))
+	}
+
+	res, err := sg.GraphQL(ct, `query { products { id } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sg.GraphQL(ct, "query {\n  products {\n    id\n  }\n}", nil); err != nil {
+		t.Fatal(err)
+	}
+	span.End()
+
+	rec.Lock()
+	defer rec.Unlock()
+
+	var names []string
+	var hits []bool
+
+	for _, s := range rec.spans {
+		names = append(names, s.Name)
+
+		switch s.Name {
+		case "super_graph/graphql":
+			if s.Attributes["fingerprint"] != res.Fingerprint() {
+				t.Errorf("expected the fingerprint %s got %v", res.Fingerprint(), s.Attributes["fingerprint"])
+			}
+			if s.ParentSpanID != span.SpanContext().SpanID {
+				t.Error("expected the graphql span to be a child of the request span")
+			}
+
+		case "super_graph/compile":
+			hits = append(hits, s.Attributes["cache_hit"].(bool))
+		}
+	}
+
+	exp := []string{
+		"super_graph/compile", "super_graph/sql", "super_graph/graphql",
+		"super_graph/compile", "super_graph/sql", "super_graph/graphql",
+		"request",
+	}
+
+	if len(names) != len(exp) {
+		t.Fatalf("expected the spans %v got %v", exp, names)
+	}
+	for i := range exp {
+		if names[i] != exp[i] {
+			t.Fatalf("expected the spans %v got %v", exp, names)
+		}
+	}
+
+	if len(hits) != 2 || hits[0] || !hits[1] {
+		t.Errorf("expected a compile cache miss then a hit: %v", hits)
+	}
+}
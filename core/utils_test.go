@@ -0,0 +1,21 @@
+package core
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+// newTestGraph creates a super graph for a test, the queries it saves go
+// to an allow list in the temp dir of the test and not the package dir
+func newTestGraph(t testing.TB, conf *Config, db *sql.DB, dbinfo *psql.DBInfo) (*SuperGraph, error) {
+	if conf == nil {
+		conf = &Config{Debug: true}
+	}
+	if conf.AllowListFile == "" {
+		conf.AllowListFile = filepath.Join(t.TempDir(), "allow.list")
+	}
+	return newSuperGraph(conf, db, dbinfo)
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// Validate function compiles the query for the role against the current database schema
+// without executing it. It returns the same errors the GraphQL function would and is used
+// by editor plugins to give feedback while writing queries for the allow list.
+func (sg *SuperGraph) Validate(query string, vars json.RawMessage, role string) error {
+	if role == "" {
+		role = "user"
+	}
+
+	switch qcode.GetQType(query) {
+	case qcode.QTQuery:
+		_, err := sg.buildRoleStmt([]byte(query), vars, role, psql.Metadata{})
+		return err
+
+	case qcode.QTMutation, qcode.QTSubscription:
+		_, err := sg.buildRoleStmt([]byte(query), vars, role, psql.Metadata{Poll: true})
+		return err
+	}
+
+	return errors.New("unknown query")
+}
+
+// Authorize function checks the query can be run by the role of the context without
+// running it. In production the query has to be in the allow list, the role has to be
+// able to use its tables and columns and be granted the intents it needs. It returns the
+// role, with a roles_query the role is only known once the query runs and the user or
+// anon role is checked.
+func (sg *SuperGraph) Authorize(c context.Context, query string, vars json.RawMessage) (string, error) {
+	role := "anon"
+	if keyExists(c, UserIDKey) {
+		role = "user"
+	}
+
+	if v, ok, err := sg.ctxRole(c); err != nil {
+		return role, err
+	} else if ok {
+		role = v
+	}
+
+	op := qcode.GetQType(query)
+
+	if op == qcode.QTMutation && sg.conf.ReadOnly {
+		return role, &codeError{ErrCodeRoleForbidden, "mutations are disabled: read only"}
+	}
+
+	q := rquery{op: op, name: Name(query), query: []byte(query), vars: vars}
+
+	if sg.conf.UseAllowList {
+		cq, ok := sg.queries[(q.name + role)]
+		if !ok {
+			return role, errNotFound
+		}
+		q.query = cq.q.query
+
+		if op == qcode.QTMutation {
+			q.vars = cq.q.vars
+		}
+	}
+
+	st, err := sg.buildRoleStmt(q.query, q.vars, role, psql.Metadata{Poll: op != qcode.QTQuery})
+	if err != nil {
+		return role, err
+	}
+
+	return role, sg.checkIntents(st.qc, vars, role, false)
+}
+
+// Completions function returns the names of the fields that can be selected at the given
+// path for the role. An empty path returns the root tables, while a path like
+// `[products, user]` returns the columns and related tables of the last table in it.
+func (sg *SuperGraph) Completions(path []string, role string) ([]string, error) {
+	var names []string
+
+	if role == "" {
+		role = "user"
+	}
+
+	ro, ok := sg.roles[role]
+	if !ok {
+		return nil, errors.New("role not found: " + role)
+	}
+
+	schema := sg.pc.Schema()
+
+	if len(path) == 0 {
+		for _, n := range schema.GetTableNames() {
+			if tableAllowed(schema, sg.conf, ro, n) {
+				names = append(names, n)
+			}
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+
+	table := strings.ToLower(path[len(path)-1])
+
+	ti, err := schema.GetTableInfoB(table)
+	if err != nil {
+		return nil, err
+	}
+
+	var cols []string
+
+	if rt := ro.GetTable(ti.Name); rt != nil && rt.Query != nil {
+		cols = rt.Query.Columns
+	}
+
+	for _, c := range ti.Columns {
+		if c.Blocked {
+			continue
+		}
+		if len(cols) != 0 && !inList(cols, c.Name) {
+			continue
+		}
+		names = append(names, c.Name)
+	}
+
+	for _, n := range schema.GetRelatedTables(table) {
+		if tableAllowed(schema, sg.conf, ro, n) {
+			names = append(names, n)
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func tableAllowed(schema *psql.DBSchema, conf *Config, ro *Role, name string) bool {
+	ti, err := schema.GetTableInfoB(name)
+	if err != nil {
+		return false
+	}
+
+	rt := ro.GetTable(ti.Name)
+
+	if rt == nil {
+		return !conf.DefaultBlock || ro.Name != "anon"
+	}
+
+	return rt.Query == nil || !rt.Query.Block
+}
+
+func inList(list []string, val string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, val) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestValidate(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sg.Validate(`query { products { id name } }`, nil, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sg.Validate(`query { products { id emial } }`, nil, "user"); err == nil {
+		t.Fatal("expecting an error for an unknown column")
+	}
+
+	if err := sg.Validate(`query { products { id } }`, nil, "admin"); err == nil {
+		t.Fatal("expecting an error for an unknown role")
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := sg.Completions(nil, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !inList(names, "products") {
+		t.Fatalf("expecting 'products' in root completions: %v", names)
+	}
+
+	names, err = sg.Completions([]string{"products"}, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{"id", "name", "user"} {
+		if !inList(names, v) {
+			t.Fatalf("expecting '%s' in completions: %v", v, names)
+		}
+	}
+}
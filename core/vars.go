@@ -0,0 +1,170 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+	"github.com/dosco/super-graph/core/internal/util"
+)
+
+// applyVarDefs checks the variables against the definitions in the operation
+// header and sets the default value of the ones missing. The errors of all
+// the variables are returned together.
+func applyVarDefs(qc *qcode.QCode, vm map[string]json.RawMessage) (
+	map[string]json.RawMessage, error) {
+	var errs util.Errors
+
+	for _, vd := range qc.Vars {
+		v, ok := vm[vd.Name]
+
+		if !ok || isNull(v) {
+			switch {
+			case len(vd.Default) != 0:
+				if vm == nil {
+					vm = make(map[string]json.RawMessage)
+				}
+				vm[vd.Name] = vd.Default
+
+			case vd.NonNull:
+				errs = append(errs, fmt.Errorf("required variable '%s' of type '%s' must be set", vd.Name, varType(vd)))
+			}
+			continue
+		}
+
+		if err := checkVar(vd, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) != 0 {
+		return nil, errs.Err()
+	}
+	return vm, nil
+}
+
+// varDefaults is applyVarDefs for the variables passed to the query
+func varDefaults(qc *qcode.QCode, vars json.RawMessage) (json.RawMessage, error) {
+	if len(qc.Vars) == 0 {
+		return vars, nil
+	}
+
+	var vm map[string]json.RawMessage
+
+	if len(vars) != 0 {
+		if err := json.Unmarshal(vars, &vm); err != nil {
+			return nil, err
+		}
+	}
+
+	vm, err := applyVarDefs(qc, vm)
+	if err != nil {
+		return nil, err
+	}
+
+	if vm == nil {
+		return vars, nil
+	}
+
+	return json.Marshal(vm)
+}
+
+func checkVar(vd qcode.VarDef, v json.RawMessage) error {
+	if !vd.List {
+		if !isType(vd.Type, v) {
+			return varErr(vd)
+		}
+		return nil
+	}
+
+	var list []json.RawMessage
+
+	if v[0] != '[' {
+		return varErr(vd)
+	}
+
+	if err := json.Unmarshal(v, &list); err != nil {
+		return err
+	}
+
+	for _, item := range list {
+		if !isNull(item) && !isType(vd.Type, item) {
+			return varErr(vd)
+		}
+	}
+
+	return nil
+}
+
+// isType returns true if the json value is of the graphql type, input
+// objects and enums are not checked
+func isType(t string, v json.RawMessage) bool {
+	switch t {
+	case "Int":
+		return isNum(v) && !bytes.ContainsAny(v, ".eE")
+	case "Float":
+		return isNum(v)
+	case "String":
+		return v[0] == '"'
+	case "ID":
+		return v[0] == '"' || isNum(v)
+	case "Boolean":
+		return bytes.Equal(v, []byte("true")) || bytes.Equal(v, []byte("false"))
+	}
+	return true
+}
+
+func isNum(v json.RawMessage) bool {
+	return v[0] == '-' || (v[0] >= '0' && v[0] <= '9')
+}
+
+func isNull(v json.RawMessage) bool {
+	v = bytes.TrimSpace(v)
+	return len(v) == 0 || bytes.Equal(v, []byte("null"))
+}
+
+func varType(vd qcode.VarDef) string {
+	t := vd.Type
+	if vd.List {
+		t = "[" + t + "]"
+	}
+	if vd.NonNull {
+		t += "!"
+	}
+	return t
+}
+
+func varErr(vd qcode.VarDef) error {
+	return fmt.Errorf("variable '%s' should be of type '%s'", vd.Name, varType(vd))
+}
+
+// editRows calls fn with each row of the value of a mutation variable, a
+// single object or a list of them, and returns the changed rows
+func editRows(v json.RawMessage, fn func(row map[string]json.RawMessage) error) (json.RawMessage, error) {
+	if v = bytes.TrimSpace(v); len(v) == 0 || v[0] != '[' {
+		var row map[string]json.RawMessage
+
+		if err := json.Unmarshal(v, &row); err != nil {
+			return nil, err
+		}
+		if err := fn(row); err != nil {
+			return nil, err
+		}
+		return json.Marshal(row)
+	}
+
+	var rows []map[string]json.RawMessage
+
+	if err := json.Unmarshal(v, &rows); err != nil {
+		return nil, err
+	}
+
+	for i := range rows {
+		if err := fn(rows[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(rows)
+}
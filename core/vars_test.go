@@ -0,0 +1,50 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+)
+
+func TestVarDefs(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gql := `query getProducts($id: Int!, $price: Float = 10.5) {
+		products(where: { id: { gt: $id }, price: { lt: $price } }) { id }
+	}`
+
+	_, err = sg.buildRoleStmt([]byte(gql), nil, "user", psql.Metadata{})
+	if err == nil || !strings.Contains(err.Error(), "required variable 'id'") {
+		t.Fatalf("expected a missing variable error got: %v", err)
+	}
+
+	_, err = sg.buildRoleStmt([]byte(gql), []byte(`{ "id": "one" }`), "user", psql.Metadata{})
+	if err == nil || !strings.Contains(err.Error(), "should be of type 'Int!'") {
+		t.Fatalf("expected a variable type error got: %v", err)
+	}
+
+	st, err := sg.buildRoleStmt([]byte(gql), []byte(`{ "id": 1 }`), "user", psql.Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := varDefaults(st.qc, []byte(`{ "id": 1 }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := `{"id":1,"price":10.5}`; string(vars) != exp {
+		t.Fatalf("expected %s got %s", exp, vars)
+	}
+}
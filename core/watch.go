@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+// watchDirective sets the columns a subscription is updated for
+// (eg. `products @watch(columns: ["price", "stock"]) { id name price stock }`)
+func watchDirective(sel *qcode.Select, args []qcode.Arg, _ string) error {
+	if len(args) != 1 || args[0].Name != "columns" {
+		return errors.New("expecting a single 'columns' argument")
+	}
+	v := args[0].Val
+
+	switch v.Type {
+	case qcode.NodeStr:
+		sel.Watch = []string{v.Val}
+
+	case qcode.NodeList:
+		for _, c := range v.Children {
+			if c.Type != qcode.NodeStr {
+				return errors.New("columns: expecting a list of strings")
+			}
+			sel.Watch = append(sel.Watch, c.Val)
+		}
+
+	default:
+		return errors.New("columns: expecting a list of strings")
+	}
+
+	return nil
+}
+
+// checkWatch returns true if the columns a selection is updated for are set
+// with @watch, they have to be selected
+func checkWatch(qc *qcode.QCode) (bool, error) {
+	watch := false
+
+	for i := range qc.Selects {
+		sel := &qc.Selects[i]
+
+		if sel.Watch == nil || sel.SkipRender != qcode.SkipTypeNone {
+			continue
+		}
+
+		for _, w := range sel.Watch {
+			found := false
+
+			for _, c := range sel.Cols {
+				if c.Name == w {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return false, fmt.Errorf("%s: @watch: column %s is not selected", sel.FieldName, w)
+			}
+		}
+		watch = true
+	}
+
+	return watch, nil
+}
+
+// dataHash returns the hash of the data compared to find if the
+// result of the subscription changed
+func (s *sub) dataHash(data json.RawMessage) ([sha256.Size]byte, error) {
+	if !s.watch {
+		return sha256.Sum256(data), nil
+	}
+
+	wd, err := watchData(s.q.st.qc, data)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(wd), nil
+}
+
+// watchData returns the data without the columns of
+// the selections not set with @watch
+func watchData(qc *qcode.QCode, data json.RawMessage) (json.RawMessage, error) {
+	fields, err := readObj(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range fields {
+		f := &fields[i]
+
+		for _, id := range qc.Roots {
+			if sel := &qc.Selects[id]; sel.FieldName == f.key {
+				if f.val, err = watchSel(qc, sel, f.val); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return writeObj(fields), nil
+}
+
+func watchSel(qc *qcode.QCode, sel *qcode.Select, v json.RawMessage) (json.RawMessage, error) {
+	switch {
+	case len(v) == 0:
+		return v, nil
+
+	case v[0] == '[':
+		var rows []json.RawMessage
+
+		if err := json.Unmarshal(v, &rows); err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+
+		for i, r := range rows {
+			wr, err := watchSel(qc, sel, r)
+			if err != nil {
+				return nil, err
+			}
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(wr)
+		}
+		buf.WriteByte(']')
+
+		return buf.Bytes(), nil
+
+	case v[0] != '{':
+		return v, nil
+	}
+
+	fields, err := readObj(v)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range fields {
+		f := &fields[i]
+
+		if c := childSel(qc, sel, f.key); c != nil {
+			if f.val, err = watchSel(qc, c, f.val); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// an empty key drops the field
+		if sel.Watch != nil && !isWatched(sel, f.key) {
+			f.key = ""
+		}
+	}
+
+	return writeObj(fields), nil
+}
+
+// childSel returns the child selection of the field
+func childSel(qc *qcode.QCode, sel *qcode.Select, key string) *qcode.Select {
+	for _, id := range sel.Children {
+		if c := &qc.Selects[id]; c.FieldName == key {
+			return c
+		}
+	}
+	return nil
+}
+
+// isWatched returns true if the field is a column set with @watch
+func isWatched(sel *qcode.Select, key string) bool {
+	for _, c := range sel.Cols {
+		if c.FieldName == key && inList(sel.Watch, c.Name) {
+			return true
+		}
+	}
+	return false
+}
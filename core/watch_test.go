@@ -0,0 +1,83 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dosco/super-graph/core/internal/psql"
+	"github.com/dosco/super-graph/core/internal/qcode"
+)
+
+func TestWatch(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sg, err := newTestGraph(t, &Config{}, db, psql.GetTestDBInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compile := func(query string) *sub {
+		s := &sub{q: &cquery{q: rquery{op: qcode.QTSubscription, query: []byte(query)}}}
+		if err := sg.compileQuery(s.q, "user"); err != nil {
+			t.Fatal(err)
+		}
+		if s.watch, err = checkWatch(s.q.st.qc); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	s := compile(`subscription { products @watch(columns: ["price"]) { id name price user { id email } } }`)
+
+	if !s.watch {
+		t.Fatal("expected the subscription to watch columns")
+	}
+
+	hash := func(data string) string {
+		h, err := s.dataHash(json.RawMessage(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(h[:])
+	}
+
+	h := hash(`{"products": [{"id": 1, "name": "Bag", "price": 10, "user": {"id": 1, "email": "a@b.c"}}]}`)
+
+	// a change to a column that is not watched
+	if hash(`{"products": [{"id": 1, "name": "Bags", "price": 10, "user": {"id": 1, "email": "a@b.c"}}]}`) != h {
+		t.Fatal("expected no change for a column not watched")
+	}
+
+	// the columns of selections without @watch are all watched
+	if hash(`{"products": [{"id": 1, "name": "Bag", "price": 10, "user": {"id": 1, "email": "b@b.c"}}]}`) == h {
+		t.Fatal("expected a change for the email")
+	}
+
+	if hash(`{"products": [{"id": 1, "name": "Bag", "price": 12, "user": {"id": 1, "email": "a@b.c"}}]}`) == h {
+		t.Fatal("expected a change for the price")
+	}
+
+	if hash(`{"products": []}`) == h {
+		t.Fatal("expected a change when the rows change")
+	}
+
+	if compile(`subscription { products { id name } }`).watch {
+		t.Fatal("expected no watched columns")
+	}
+
+	cq := &cquery{q: rquery{op: qcode.QTSubscription,
+		query: []byte(`subscription { products @watch(columns: ["price"]) { id name } }`)}}
+
+	if err := sg.compileQuery(cq, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := checkWatch(cq.st.qc); err == nil {
+		t.Fatal("expected an error for a column watched that is not selected")
+	}
+}
@@ -11,7 +11,7 @@ require (
 	github.com/GeertJohan/go.rice v1.0.0
 	github.com/NYTimes/gziphandler v1.1.1
 	github.com/adjust/gorails v0.0.0-20171013043634-2786ed0c03d3
-	github.com/aws/aws-sdk-go v1.33.4 // indirect
+	github.com/aws/aws-sdk-go v1.33.4
 	github.com/bradfitz/gomemcache v0.0.0-20190913173617-a41fca850d0b
 	github.com/brianvoe/gofakeit/v5 v5.9.0
 	github.com/chirino/graphql v0.0.0-20200620205252-3aa1055298c1
@@ -26,6 +26,7 @@ require (
 	github.com/gobuffalo/flect v0.2.1
 	github.com/gorilla/websocket v1.4.2
 	github.com/gosimple/slug v1.9.0
+	github.com/jackc/pgconn v1.6.1
 	github.com/jackc/pgtype v1.4.0
 	github.com/jackc/pgx v3.6.2+incompatible // indirect
 	github.com/jackc/pgx/v4 v4.7.1
@@ -60,6 +61,7 @@ require (
 	google.golang.org/grpc v1.30.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/ini.v1 v1.57.0 // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 go 1.13
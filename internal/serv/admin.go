@@ -0,0 +1,342 @@
+package serv
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dosco/super-graph/core"
+)
+
+// maxRecentErrors is the number of errors kept for the admin API
+const maxRecentErrors = 100
+
+var errNoRegistry = errors.New("query registry not set (query_registry)")
+
+type recentError struct {
+	At       time.Time `json:"at"`
+	Name     string    `json:"name,omitempty"`
+	Error    string    `json:"error"`
+	Category string    `json:"category"`
+}
+
+// recentErrors is a ring of the last errors returned by queries
+var recentErrors struct {
+	sync.Mutex
+	errs []recentError
+	next int
+}
+
+func addRecentError(name string, err error) {
+	e := recentError{At: time.Now(), Name: name, Error: err.Error(),
+		Category: core.ErrorCategory(err)}
+
+	recentErrors.Lock()
+	defer recentErrors.Unlock()
+
+	if len(recentErrors.errs) < maxRecentErrors {
+		recentErrors.errs = append(recentErrors.errs, e)
+		return
+	}
+	recentErrors.errs[recentErrors.next] = e
+	recentErrors.next = (recentErrors.next + 1) % maxRecentErrors
+}
+
+// lastErrors returns the recent errors newest first
+func lastErrors() []recentError {
+	recentErrors.Lock()
+	defer recentErrors.Unlock()
+
+	n := len(recentErrors.errs)
+	errs := make([]recentError, n)
+
+	for i := 0; i < n; i++ {
+		errs[i] = recentErrors.errs[(recentErrors.next+n-1-i)%n]
+	}
+	return errs
+}
+
+type adminStats struct {
+	Parser   core.PoolStats         `json:"parser"`
+	Compiled core.CompileCacheStats `json:"compiled"`
+	DB       *sql.DBStats           `json:"db,omitempty"`
+	Caches   []core.CacheStats      `json:"caches"`
+	Subs     int                    `json:"subscriptions"`
+}
+
+func startAdmin(servConf *ServConfig) {
+	if servConf.conf.Admin.Token == "" {
+		servConf.log.Printf("ERR admin: a token is required, admin api not started")
+		return
+	}
+
+	srv := &http.Server{
+		Addr:         servConf.conf.Admin.HostPort,
+		Handler:      adminHandler(servConf),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	servConf.log.Printf("INF admin api started, host-port: %s", servConf.conf.Admin.HostPort)
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		servConf.log.Printf("ERR admin: %s", err)
+	}
+}
+
+// adminHandler returns the routes of the management API, all of them
+// need the admin token and the actions are only allowed with a POST
+func adminHandler(servConf *ServConfig) http.Handler {
+	mux := http.NewServeMux()
+
+	get := map[string]func() (interface{}, error){
+		"/admin/allow-list": func() (interface{}, error) {
+			return graph().AllowList().List()
+		},
+		"/admin/stats": func() (interface{}, error) {
+			return statsResp(servConf), nil
+		},
+		"/admin/subscriptions": func() (interface{}, error) {
+			return graph().Subscriptions(), nil
+		},
+		"/admin/errors": func() (interface{}, error) {
+			return lastErrors(), nil
+		},
+		// the last requests and responses of each operation (samples)
+		"/admin/samples": func() (interface{}, error) {
+			return lastSamples(), nil
+		},
+		// the usage of each api key or tenant in the current period
+		"/admin/usage": func() (interface{}, error) {
+			return graph().Usage(context.Background())
+		},
+		// the plans sampled for the slow queries (slow_query)
+		"/admin/slow-queries": func() (interface{}, error) {
+			return graph().SlowQueries(context.Background())
+		},
+		// the statistics of the queries and the join strategies (planner)
+		"/admin/planner": func() (interface{}, error) {
+			return graph().PlannerStats(), nil
+		},
+		// the allow list queries that fail with the database
+		// schema as it is now (eg. after a migration)
+		"/admin/schema/impact": func() (interface{}, error) {
+			return graph().CheckSchema()
+		},
+	}
+
+	post := map[string]func(){
+		"/admin/cache/flush": func() {
+			graph().FlushCache()
+		},
+		"/admin/reload": func() {
+			// the response is sent before the process is restarted
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				reloadFn(servConf)()
+			}()
+		},
+	}
+
+	for p, fn := range get {
+		fn := fn
+		mux.HandleFunc(p, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			v, err := fn()
+			if err != nil {
+				renderErr(w, err)
+				return
+			}
+			//nolint: errcheck
+			json.NewEncoder(w).Encode(v)
+		})
+	}
+
+	for p, fn := range post {
+		fn := fn
+		mux.HandleFunc(p, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			fn()
+			w.WriteHeader(http.StatusAccepted)
+		})
+	}
+
+	// the approved queries and their versions
+	mux.HandleFunc("/admin/registry", registryHandler)
+	mux.HandleFunc("/admin/registry/rollback", registryRollbackHandler)
+
+	// the join strategies pinned by hand
+	mux.HandleFunc("/admin/planner/joins", plannerJoinsHandler)
+
+	return adminAuth(servConf.conf.Admin.Token, mux)
+}
+
+// registryHandler lists the queries of the registry (GET, ?name= for a query
+// and ?hash= for a version), approves a query (POST) or removes it (DELETE)
+func registryHandler(w http.ResponseWriter, r *http.Request) {
+	reg := graph().QueryRegistry()
+	if reg == nil {
+		w.WriteHeader(http.StatusNotFound)
+		renderErr(w, errNoRegistry)
+		return
+	}
+
+	var v interface{}
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+
+		switch {
+		case q.Get("name") != "":
+			v, err = reg.Get(q.Get("name"))
+		case q.Get("hash") != "":
+			v, err = reg.Version(q.Get("hash"))
+		default:
+			v, err = reg.List()
+		}
+
+	case http.MethodPost:
+		var a core.QueryApproval
+
+		if err = json.NewDecoder(r.Body).Decode(&a); err == nil {
+			v, err = reg.Approve(a)
+		}
+
+	case http.MethodDelete:
+		if err = reg.Remove(r.URL.Query().Get("name")); err == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		renderErr(w, err)
+		return
+	}
+	//nolint: errcheck
+	json.NewEncoder(w).Encode(v)
+}
+
+// registryRollbackHandler makes an older version of a query the current one
+func registryRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	reg := graph().QueryRegistry()
+	if reg == nil {
+		w.WriteHeader(http.StatusNotFound)
+		renderErr(w, errNoRegistry)
+		return
+	}
+
+	var req struct {
+		Name       string `json:"name"`
+		Hash       string `json:"hash"`
+		ApprovedBy string `json:"approved_by"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderErr(w, err)
+		return
+	}
+
+	v, err := reg.Rollback(req.Name, req.Hash, req.ApprovedBy)
+	if err != nil {
+		renderErr(w, err)
+		return
+	}
+	//nolint: errcheck
+	json.NewEncoder(w).Encode(v)
+}
+
+// plannerJoinsHandler pins the strategy of a join (POST) or unpins it
+// (DELETE, ?parent= and ?child=) so it's tuned again
+func plannerJoinsHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			Parent   string `json:"parent"`
+			Child    string `json:"child"`
+			Strategy string `json:"strategy"`
+		}
+
+		if err = json.NewDecoder(r.Body).Decode(&req); err == nil {
+			err = graph().PinJoin(req.Parent, req.Child, req.Strategy)
+		}
+
+	case http.MethodDelete:
+		q := r.URL.Query()
+		err = graph().UnpinJoin(q.Get("parent"), q.Get("child"))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		renderErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func adminAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		t := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) != 1 {
+			renderErr(w, errUnauthorized)
+			return
+		}
+
+		// the errors are kept even when not ready (eg. the database is down)
+		if !isReady() && r.URL.Path != "/admin/errors" {
+			renderErr(w, errNotReady)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func statsResp(servConf *ServConfig) adminStats {
+	s := adminStats{
+		Parser:   core.ParserPoolStats(),
+		Compiled: graph().CompileCacheStats(),
+		Caches:   graph().CacheStats(),
+		Subs:     len(graph().Subscriptions()),
+	}
+
+	if servConf.db != nil {
+		st := servConf.db.Stats()
+		s.DB = &st
+	}
+
+	return s
+}
@@ -0,0 +1,59 @@
+package serv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuth(t *testing.T) {
+	h := adminAuth("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		path, auth string
+		code       int
+	}{
+		{"/admin/errors", "", http.StatusUnauthorized},
+		{"/admin/errors", "Bearer wrong", http.StatusUnauthorized},
+		{"/admin/errors", "Bearer secret", http.StatusTeapot},
+		{"/admin/stats", "Bearer secret", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%s (%s): expected %d got %d", tt.path, tt.auth, tt.code, w.Code)
+		}
+	}
+}
+
+func TestRecentErrors(t *testing.T) {
+	for i := 0; i < maxRecentErrors+5; i++ {
+		addRecentError("getProducts", fmt.Errorf("error %d", i))
+	}
+
+	errs := lastErrors()
+
+	if len(errs) != maxRecentErrors {
+		t.Fatalf("expected %d errors got %d", maxRecentErrors, len(errs))
+	}
+
+	if errs[0].Error != fmt.Sprintf("error %d", maxRecentErrors+4) || errs[len(errs)-1].Error != "error 5" {
+		t.Fatalf("expected the newest errors first got: %s ... %s", errs[0].Error, errs[len(errs)-1].Error)
+	}
+
+	if _, err := json.Marshal(errs); err != nil {
+		t.Fatal(err)
+	}
+}
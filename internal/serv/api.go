@@ -50,6 +50,14 @@ type Serv struct {
 	APIPath        string   `mapstructure:"api_path"`
 	CacheControl   string   `mapstructure:"cache_control"`
 
+	// Socket is the path of a unix socket to listen on instead of
+	// the host and port. A socket passed by systemd is used over both
+	Socket string
+
+	// UpgradeTimeout is how long open subscriptions are kept going by the
+	// old process after a binary upgrade (SIGUSR2), defaults to 5m
+	UpgradeTimeout time.Duration `mapstructure:"upgrade_timeout"`
+
 	// Telemetry struct contains OpenCensus metrics and tracing related config
 	Telemetry struct {
 		Debug    bool
@@ -90,14 +98,144 @@ type Serv struct {
 		ServerCert  string        `mapstructure:"server_cert"`
 		ClientCert  string        `mapstructure:"client_cert"`
 		ClientKey   string        `mapstructure:"client_key"`
+
+		// Replicas are read replicas queries are routed to based on their
+		// latency or round-robin (replica_select: round_robin). A negative
+		// sticky window turns off keeping users on the primary after a write
+		Replicas []struct {
+			Host string
+			Port uint16
+		}
+		ReplicaSelect string        `mapstructure:"replica_select"`
+		ReplicaProbe  time.Duration `mapstructure:"replica_probe_interval"`
+		ReplicaSticky time.Duration `mapstructure:"replica_sticky_window"`
+
+		// Roles are the database users the queries and mutations of the
+		// roles are run as, each with its own pool, so the database enforces
+		// their grants beneath the ones of the roles. The role of a query
+		// with a roles_query match is found in the same statement and uses
+		// the user of the 'user' role
+		Roles []struct {
+			Name     string
+			User     string
+			Password string
+		}
+
+		// Shadow is a database read queries are replayed on in the background
+		// to compare results and latency (eg. before a major version upgrade).
+		// It uses the same credentials and database name
+		Shadow struct {
+			Host string
+			Port uint16
+		}
 	} `mapstructure:"database"`
 
+	// Databases are other databases whose tables are selected under a root
+	// field of the name (eg. `analytics { events { id } }`). The host, port
+	// and credentials default to the ones of the database above
+	Databases []struct {
+		Name     string
+		Host     string
+		Port     uint16
+		DBName   string
+		User     string
+		Password string
+		Schema   string
+	}
+
 	Actions []Action
 
+	// Schedules run named queries of the allow list on a cron schedule
+	// and deliver the results to a table, object storage or a webhook
+	Schedules []Schedule
+
+	// REST serves the named queries of the allow list as REST endpoints
+	// (GET <path>/<name> for queries and POST for mutations) with an
+	// OpenAPI spec at <path>/openapi.json. Path defaults to /api/v1/rest
+	REST struct {
+		Enable bool
+		Path   string
+	}
+
+	// Uploads accepts files in GraphQL multipart requests (the Upload scalar),
+	// they're stored in the directory or when it's not set in the object
+	// storage of the blobs config. The url of a file is the base url and
+	// its key. MaxSize (bytes) defaults to 10MB and MaxFiles to 10. Only
+	// the roles can upload files, any role but anon when it's not set
+	Uploads struct {
+		Enable   bool
+		Dir      string
+		BaseURL  string `mapstructure:"base_url"`
+		MaxSize  int64  `mapstructure:"max_size"`
+		MaxFiles int    `mapstructure:"max_files"`
+		Roles    []string
+	}
+
+	// Canary rolls out config changes to a percent of the requests
+	// and rolls them back if the error rate goes up. Used with
+	// reload_on_config_change
+	Canary core.CanaryConfig
+
+	// Admin is the management API, it's served on its own host and
+	// port and only started when these are set
+	Admin struct {
+		HostPort string `mapstructure:"host_port"`
+
+		// Token is the bearer token all admin requests must have
+		Token string
+	}
+
+	// Internal is the api for trusted services, on it queries can add sql
+	// fragments (eg. planner hints) with the extensions. It's served on
+	// a unix socket or on its own host and port and never on the public
+	// endpoint
+	Internal struct {
+		HostPort string `mapstructure:"host_port"`
+		Socket   string
+
+		// Token is the bearer token all internal requests must have,
+		// it's required with a host and port
+		Token string
+	}
+
+	// RateLimiter limits the requests of each client ip to rate per second
+	// with bursts of upto bucket requests. When the storage is set the
+	// requests are counted in it so the limit is shared by all instances
 	RateLimiter struct {
 		Rate   float64
 		Bucket int
 	} `mapstructure:"rate_limiter"`
+
+	// Samples keeps the last requests and responses of each operation for
+	// the admin api (GET /admin/samples) with the values of the fields in
+	// the blocklist or mask masked. Size is the number kept for each
+	// operation (default 5) and Rate the part of the requests sampled
+	// (eg. 0.1 for 10%), all of them when it's not set
+	Samples struct {
+		Enable bool
+		Size   int
+		Rate   float64
+		Mask   []string
+	}
+
+	// SQLLog writes the sql of the queries with the time they took to run
+	// to the file (defaults to stdout) in a format log based tools can read,
+	// `pgbadger` for the Postgres log format or `slowlog` for the MySQL slow
+	// query log read by pt-query-digest. The sql has placeholders ($1) in
+	// place of the values of the variables
+	SQLLog struct {
+		Format string
+		File   string
+	} `mapstructure:"sql_log"`
+
+	// Idempotency runs the mutations sent with an Idempotency-Key header only
+	// once, the response is kept in the storage and sent again to retries
+	Idempotency struct {
+		Enable bool
+
+		// TTL is how long the responses are kept for. Defaults to 24h
+		TTL time.Duration
+	}
 }
 
 // Auth struct contains authentication related config values used by the Super Graph service
@@ -0,0 +1,97 @@
+package serv
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/dosco/super-graph/core"
+)
+
+// canary holds the *core.Canary rolling out the last config change
+var canary atomic.Value
+
+// graph returns the Super Graph instance to use for everything other
+// than queries, these only move to a new config once it's promoted
+func graph() *core.SuperGraph {
+	if c, ok := canary.Load().(*core.Canary); ok {
+		return c.Current()
+	}
+	return sg
+}
+
+func graphQL(ct context.Context, query string, vars json.RawMessage) (*core.Result, error) {
+	if c, ok := canary.Load().(*core.Canary); ok {
+		return c.GraphQL(ct, query, vars)
+	}
+	return sg.GraphQL(ct, query, vars)
+}
+
+// startCanary is called when the config changes instead of restarting
+// the process. It creates a Super Graph instance with the new config and
+// rolls it out to a share of the requests. Only the core config (tables,
+// roles, allow list, etc) is rolled out, the service config is unchanged.
+func startCanary(servConf *ServConfig) func() {
+	return func() {
+		if !isReady() {
+			servConf.log.Println("WRN canary: config changed before ready, ignored")
+			return
+		}
+
+		conf, err := initConf(servConf)
+		if err != nil {
+			servConf.log.Printf("ERR canary: failed to read config: %s", err)
+			return
+		}
+
+		next, err := core.NewSuperGraph(&conf.Core, servConf.db)
+		if err != nil {
+			servConf.log.Printf("ERR canary: failed to initialize Super Graph: %s", err)
+			return
+		}
+
+		if servConf.router != nil {
+			next.SetDBRouter(servConf.router.route)
+		}
+
+		if err := setRoleDBs(servConf, next); err != nil {
+			next.Close()
+			servConf.log.Printf("ERR canary: %s", err)
+			return
+		}
+
+		if servConf.shadow != nil {
+			next.SetShadowDB(servConf.shadow, shadowLog(servConf))
+		}
+
+		if err := attachDatabases(servConf, next); err != nil {
+			next.Close()
+			servConf.log.Printf("ERR canary: %s", err)
+			return
+		}
+
+		cc := servConf.conf.Canary
+		c, err := core.NewCanary(graph(), next, cc, func(state int32, stable, next core.CanaryStats) {
+			if state == core.CanaryPromoted {
+				servConf.log.Printf("INF canary: new config promoted (errors %d/%d, current %d/%d)",
+					next.Errors, next.Requests, stable.Errors, stable.Requests)
+			} else {
+				servConf.log.Printf("WRN canary: new config rolled back (errors %d/%d, current %d/%d)",
+					next.Errors, next.Requests, stable.Errors, stable.Requests)
+			}
+		})
+		if err != nil {
+			next.Close()
+			servConf.log.Printf("ERR %s", err)
+			return
+		}
+
+		// the instance of a rollout that's still running is dropped
+		if old, ok := canary.Load().(*core.Canary); ok {
+			old.Stop()
+		}
+		canary.Store(c)
+
+		servConf.log.Printf("INF canary: rolling out new config to %d%% of requests", cc.Percent)
+	}
+}
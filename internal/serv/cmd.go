@@ -32,6 +32,13 @@ type ServConfig struct {
 	conf     *Config      // parsed config
 	confPath string       // path to the config file
 	db       *sql.DB      // database connection pool
+	router   *dbRouter    // read replica router
+	shadow   *sql.DB      // shadow database queries are replayed on
+	attached []attachedDB // other databases selected under a root field
+	roleDBs  []roleDB     // databases of the roles with their own user
+	uploads  uploadStore  // store of the uploaded files
+	sqlLog   *sqlLogger   // log of the sql of the queries
+	readOnly bool         // database sessions are read only
 }
 
 func Cmd() {
@@ -130,6 +137,67 @@ e.g. db:migrate -+1
 		Run:   cmdNew(servConf),
 	})
 
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "allow:list",
+		Short: "List the queries in the allow list",
+		Run:   cmdAllowList(servConf),
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "allow:add QUERY-FILE [VARIABLES-FILE]",
+		Short: "Add a query to the allow list",
+		Long:  "Add the named query in the file to the allow list with its variables (json) if set, a query with the same name is replaced",
+		Run:   cmdAllowAdd(servConf),
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "allow:remove NAME",
+		Short: "Remove a query from the allow list",
+		Run:   cmdAllowRemove(servConf),
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "gen:go OUTPUT-FILE [PACKAGE] [ROLE]",
+		Short: "Generate a Go client for the allow list",
+		Long:  "Generate a Go client with a typed function for each query in the allow list, the types are read from the database for the role (user by default)",
+		Run:   cmdGenGo(servConf),
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "gen:ts OUTPUT-FILE [ROLE]",
+		Short: "Generate TypeScript types for the allow list",
+		Long:  "Generate TypeScript types for the variables and result of each query in the allow list and a persisted operations manifest keyed by the sha256 hash of each query",
+		Run:   cmdGenTS(servConf),
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "lint [ROLE]",
+		Short: "Lint the queries in the allow list",
+		Long:  "Run the lint rules on the queries in the allow list compiled for the role (user by default), exits with an error if any issues are found",
+		Run:   cmdLint(servConf),
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "db:indexes [ROLE]",
+		Short: "Suggest indexes for the allow list",
+		Long:  "Report the indexes missing for the columns the queries in the allow list filter, order and join on for the role (user by default), with the estimated benefit when the hypopg extension is installed",
+		Run:   cmdDBIndexes(servConf),
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "schema:dump OUTPUT-FILE",
+		Short: "Save a snapshot of the GraphQL schema",
+		Long:  "Save the result of the standard introspection query for the GraphQL schema of the database, a snapshot to compare with schema:diff",
+		Run:   cmdSchemaDump(servConf),
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "schema:diff OLD-FILE NEW-FILE",
+		Short: "Compare two snapshots of the GraphQL schema",
+		Long:  "List the changes between two snapshots of the GraphQL schema as breaking, dangerous or safe, exits with an error if any breaking changes are found",
+		Run:   cmdSchemaDiff(servConf),
+	})
+
 	// rootCmd.AddCommand(&cobra.Command{
 	// 	Use:   fmt.Sprintf("conf:dump [%s]", strings.Join(viper.SupportedExts, "|")),
 	// 	Short: "Dump config to file",
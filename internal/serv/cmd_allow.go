@@ -0,0 +1,97 @@
+package serv
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dosco/super-graph/core"
+	"github.com/spf13/cobra"
+)
+
+func cmdAllowList(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		al := openAllowList(servConf)
+
+		list, err := al.List()
+		if err != nil {
+			servConf.log.Fatalf("ERR failed to read allow list: %s", err)
+		}
+
+		for _, v := range list {
+			if v.Comment != "" && v.Comment != v.Name {
+				fmt.Printf("%s\t%s\n", v.Name, v.Comment)
+			} else {
+				fmt.Println(v.Name)
+			}
+		}
+	}
+}
+
+func cmdAllowAdd(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 || len(args) > 2 {
+			cmd.Help() //nolint: errcheck
+			return
+		}
+
+		query, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			servConf.log.Fatalf("ERR failed to read query: %s", err)
+		}
+
+		var vars []byte
+
+		if len(args) == 2 {
+			if vars, err = ioutil.ReadFile(args[1]); err != nil {
+				servConf.log.Fatalf("ERR failed to read variables: %s", err)
+			}
+		}
+
+		al := openAllowList(servConf)
+
+		if err := al.Add(string(query), vars, ""); err != nil {
+			servConf.log.Fatalf("ERR failed to add query: %s", err)
+		}
+
+		servConf.log.Printf("INF added %s to the allow list", core.Name(string(query)))
+	}
+}
+
+func cmdAllowRemove(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help() //nolint: errcheck
+			return
+		}
+
+		al := openAllowList(servConf)
+
+		if err := al.Remove(args[0]); err != nil {
+			servConf.log.Fatalf("ERR failed to remove query: %s", err)
+		}
+
+		servConf.log.Printf("INF removed %s from the allow list", args[0])
+	}
+}
+
+func openAllowList(servConf *ServConfig) *core.AllowList {
+	initConfOnce(servConf)
+
+	// the database store needs a connection to open
+	if st := &servConf.conf.Core.Storage; st.Type == "database" {
+		db, err := initDB(servConf, true, false)
+		if err != nil {
+			servConf.log.Fatalf("ERR failed to connect to database: %s", err)
+		}
+
+		if servConf.conf.Core.KVStore, err = core.NewDBKVStore(db, st.Table); err != nil {
+			servConf.log.Fatalf("ERR %s", err)
+		}
+	}
+
+	al, err := core.OpenAllowList(&servConf.conf.Core)
+	if err != nil {
+		servConf.log.Fatalf("ERR %s", err)
+	}
+	return al
+}
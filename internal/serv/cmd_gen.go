@@ -0,0 +1,118 @@
+package serv
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/dosco/super-graph/core"
+	"github.com/spf13/cobra"
+)
+
+func cmdGenGo(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 || len(args) > 3 {
+			cmd.Help() //nolint: errcheck
+			return
+		}
+
+		fname := args[0]
+
+		// the package is named after the directory of the file by default
+		pkg := filepath.Base(filepath.Dir(fname))
+		if len(args) > 1 {
+			pkg = args[1]
+		}
+
+		if pkg == "." || pkg == string(filepath.Separator) {
+			pkg = "client"
+		}
+		pkg = strings.ReplaceAll(pkg, "-", "")
+
+		role := "user"
+		if len(args) > 2 {
+			role = args[2]
+		}
+
+		ops := genOperations(servConf, role)
+
+		b, err := genGo(ops, pkg)
+		if err != nil {
+			servConf.log.Fatalf("ERR failed to generate client: %s", err)
+		}
+
+		if err := ioutil.WriteFile(fname, b, 0644); err != nil {
+			servConf.log.Fatalf("ERR failed to write client: %s", err)
+		}
+
+		servConf.log.Printf("INF client with %d operations saved to %s", len(ops), fname)
+	}
+}
+
+func cmdGenTS(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 || len(args) > 2 {
+			cmd.Help() //nolint: errcheck
+			return
+		}
+
+		fname := args[0]
+
+		role := "user"
+		if len(args) > 1 {
+			role = args[1]
+		}
+
+		ops := genOperations(servConf, role)
+
+		b, m, err := genTS(ops)
+		if err != nil {
+			servConf.log.Fatalf("ERR failed to generate types: %s", err)
+		}
+
+		// the manifest is saved next to the types
+		mname := filepath.Join(filepath.Dir(fname), "persisted-operations.json")
+
+		if err := ioutil.WriteFile(fname, b, 0644); err != nil {
+			servConf.log.Fatalf("ERR failed to write types: %s", err)
+		}
+
+		if err := ioutil.WriteFile(mname, m, 0644); err != nil {
+			servConf.log.Fatalf("ERR failed to write manifest: %s", err)
+		}
+
+		servConf.log.Printf("INF types for %d operations saved to %s and %s", len(ops), fname, mname)
+	}
+}
+
+// genOperations returns the queries in the allow list with their types for the role
+func genOperations(servConf *ServConfig, role string) []core.OpInfo {
+	loadSuperGraph(servConf)
+
+	ops, err := sg.Operations(role)
+	if err != nil {
+		servConf.log.Fatalf("ERR failed to read allow list: %s", err)
+	}
+
+	return ops
+}
+
+// loadSuperGraph reads the config and connects to the database
+// for the commands that compile the queries in the allow list
+func loadSuperGraph(servConf *ServConfig) {
+	var err error
+
+	if servConf.conf, err = initConf(servConf); err != nil {
+		servConf.log.Fatalf("ERR failed to read config: %s", err)
+	}
+
+	servConf.db, err = initDB(servConf, true, false)
+	if err != nil {
+		servConf.log.Fatalf("ERR failed to connect to database: %s", err)
+	}
+
+	sg, err = core.NewSuperGraph(&servConf.conf.Core, servConf.db)
+	if err != nil {
+		servConf.log.Fatalf("ERR failed to initialize Super Graph: %s", err)
+	}
+}
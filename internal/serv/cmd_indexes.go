@@ -0,0 +1,39 @@
+package serv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dosco/super-graph/core"
+	"github.com/spf13/cobra"
+)
+
+func cmdDBIndexes(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			cmd.Help() //nolint: errcheck
+			return
+		}
+
+		role := "user"
+		if len(args) != 0 {
+			role = args[0]
+		}
+
+		loadSuperGraph(servConf)
+
+		// queries filtered by the user id need one to be explained
+		c := context.WithValue(context.Background(), core.UserIDKey, 1)
+
+		advice, err := sg.IndexAdvice(c, role)
+		if err != nil {
+			servConf.log.Fatalf("ERR %s", err)
+		}
+
+		for _, ia := range advice {
+			fmt.Printf("-- %s\n%s\n\n", ia, ia.SQL())
+		}
+
+		servConf.log.Printf("INF %d missing indexes found", len(advice))
+	}
+}
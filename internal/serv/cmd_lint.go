@@ -0,0 +1,52 @@
+package serv
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func cmdLint(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			cmd.Help() //nolint: errcheck
+			return
+		}
+
+		role := "user"
+		if len(args) != 0 {
+			role = args[0]
+		}
+
+		loadSuperGraph(servConf)
+
+		list, err := sg.AllowList().List()
+		if err != nil {
+			servConf.log.Fatalf("ERR failed to read allow list: %s", err)
+		}
+
+		n := 0
+
+		for _, v := range list {
+			if v.Query == "" {
+				continue
+			}
+
+			issues, err := sg.Lint(v.Query, role)
+			if err != nil {
+				servConf.log.Fatalf("ERR %s: %s", v.Name, err)
+			}
+
+			for _, li := range issues {
+				fmt.Printf("%s\t%s\n", v.Name, li)
+			}
+			n += len(issues)
+		}
+
+		if n != 0 {
+			servConf.log.Printf("INF %d lint issues found", n)
+			os.Exit(1)
+		}
+	}
+}
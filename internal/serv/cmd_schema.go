@@ -0,0 +1,73 @@
+package serv
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func cmdSchemaDump(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help() //nolint: errcheck
+			return
+		}
+
+		loadSuperGraph(servConf)
+
+		b, err := sg.GraphQLSchemaJSON()
+		if err != nil {
+			servConf.log.Fatalf("ERR failed to read the schema: %s", err)
+		}
+
+		if err := ioutil.WriteFile(args[0], b, 0644); err != nil {
+			servConf.log.Fatalf("ERR failed to write schema: %s", err)
+		}
+
+		servConf.log.Printf("INF schema written to %s", args[0])
+	}
+}
+
+func cmdSchemaDiff(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			cmd.Help() //nolint: errcheck
+			return
+		}
+
+		old, err := readSchemaSnapshot(args[0])
+		if err != nil {
+			servConf.log.Fatalf("ERR %s: %s", args[0], err)
+		}
+
+		new, err := readSchemaSnapshot(args[1])
+		if err != nil {
+			servConf.log.Fatalf("ERR %s: %s", args[1], err)
+		}
+
+		n := 0
+
+		for _, sc := range diffSchema(old, new) {
+			fmt.Println(sc)
+
+			if sc.Level == changeBreaking {
+				n++
+			}
+		}
+
+		if n != 0 {
+			servConf.log.Printf("INF %d breaking changes found", n)
+			os.Exit(1)
+		}
+	}
+}
+
+func readSchemaSnapshot(file string) (*introSchema, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseSchemaSnapshot(b)
+}
@@ -52,6 +52,15 @@ func cmdDBSeed(servConf *ServConfig) func(*cobra.Command, []string) {
 			servConf.log.Fatalf("ERR failed to initialize Super Graph: %s", err)
 		}
 
+		// seed files ending in .tmpl are templates of the queries to run
+		if strings.HasSuffix(sfile, ".tmpl") {
+			if err := runSeedTemplate(servConf, sg, sfile, b); err != nil {
+				servConf.log.Fatalf("ERR failed to execute seed template: %s", err)
+			}
+			servConf.log.Println("INF seed template done")
+			return
+		}
+
 		graphQLFn := func(query string, data interface{}, opt map[string]string) map[string]interface{} {
 			return graphQLFunc(servConf, sg, query, data, opt)
 		}
@@ -65,11 +74,11 @@ func cmdDBSeed(servConf *ServConfig) func(*cobra.Command, []string) {
 		vm.Set("console", console)
 
 		fake := vm.NewObject()
-		setFakeFuncs(fake)
+		setFakeFuncs(func(k string, v interface{}) { fake.Set(k, v) }) //nolint: errcheck
 		vm.Set("fake", fake)
 
 		util := vm.NewObject()
-		setUtilFuncs(util)
+		setUtilFuncs(func(k string, v interface{}) { util.Set(k, v) }) //nolint: errcheck
 		vm.Set("util", util)
 
 		_, err = vm.RunScript("seed.js", string(b))
@@ -259,175 +268,175 @@ func getRandValue(values []string) string {
 	return values[rand.Intn(len(values))]
 }
 
-//nolint: errcheck
-func setFakeFuncs(f *goja.Object) {
+// setFakeFuncs sets the fake data functions with f, the same
+// functions are used by seed scripts and seed templates
+func setFakeFuncs(f func(string, interface{})) {
 	gofakeit.Seed(0)
 
 	// Person
-	f.Set("person", gofakeit.Person)
-	f.Set("name", gofakeit.Name)
-	f.Set("name_prefix", gofakeit.NamePrefix)
-	f.Set("name_suffix", gofakeit.NameSuffix)
-	f.Set("first_name", gofakeit.FirstName)
-	f.Set("last_name", gofakeit.LastName)
-	f.Set("gender", gofakeit.Gender)
-	f.Set("ssn", gofakeit.SSN)
-	f.Set("contact", gofakeit.Contact)
-	f.Set("email", gofakeit.Email)
-	f.Set("phone", gofakeit.Phone)
-	f.Set("phone_formatted", gofakeit.PhoneFormatted)
-	f.Set("username", gofakeit.Username)
-	f.Set("password", gofakeit.Password)
+	f("person", gofakeit.Person)
+	f("name", gofakeit.Name)
+	f("name_prefix", gofakeit.NamePrefix)
+	f("name_suffix", gofakeit.NameSuffix)
+	f("first_name", gofakeit.FirstName)
+	f("last_name", gofakeit.LastName)
+	f("gender", gofakeit.Gender)
+	f("ssn", gofakeit.SSN)
+	f("contact", gofakeit.Contact)
+	f("email", gofakeit.Email)
+	f("phone", gofakeit.Phone)
+	f("phone_formatted", gofakeit.PhoneFormatted)
+	f("username", gofakeit.Username)
+	f("password", gofakeit.Password)
 
 	// Address
-	f.Set("address", gofakeit.Address)
-	f.Set("city", gofakeit.City)
-	f.Set("country", gofakeit.Country)
-	f.Set("country_abr", gofakeit.CountryAbr)
-	f.Set("state", gofakeit.State)
-	f.Set("state_abr", gofakeit.StateAbr)
-	f.Set("street", gofakeit.Street)
-	f.Set("street_name", gofakeit.StreetName)
-	f.Set("street_number", gofakeit.StreetNumber)
-	f.Set("street_prefix", gofakeit.StreetPrefix)
-	f.Set("street_suffix", gofakeit.StreetSuffix)
-	f.Set("zip", gofakeit.Zip)
-	f.Set("latitude", gofakeit.Latitude)
-	f.Set("latitude_in_range", gofakeit.LatitudeInRange)
-	f.Set("longitude", gofakeit.Longitude)
-	f.Set("longitude_in_range", gofakeit.LongitudeInRange)
+	f("address", gofakeit.Address)
+	f("city", gofakeit.City)
+	f("country", gofakeit.Country)
+	f("country_abr", gofakeit.CountryAbr)
+	f("state", gofakeit.State)
+	f("state_abr", gofakeit.StateAbr)
+	f("street", gofakeit.Street)
+	f("street_name", gofakeit.StreetName)
+	f("street_number", gofakeit.StreetNumber)
+	f("street_prefix", gofakeit.StreetPrefix)
+	f("street_suffix", gofakeit.StreetSuffix)
+	f("zip", gofakeit.Zip)
+	f("latitude", gofakeit.Latitude)
+	f("latitude_in_range", gofakeit.LatitudeInRange)
+	f("longitude", gofakeit.Longitude)
+	f("longitude_in_range", gofakeit.LongitudeInRange)
 
 	// Beer
-	f.Set("beer_alcohol", gofakeit.BeerAlcohol)
-	f.Set("beer_hop", gofakeit.BeerHop)
-	f.Set("beer_ibu", gofakeit.BeerIbu)
-	f.Set("beer_blg", gofakeit.BeerBlg)
-	f.Set("beer_malt", gofakeit.BeerMalt)
-	f.Set("beer_name", gofakeit.BeerName)
-	f.Set("beer_style", gofakeit.BeerStyle)
-	f.Set("beer_yeast", gofakeit.BeerYeast)
+	f("beer_alcohol", gofakeit.BeerAlcohol)
+	f("beer_hop", gofakeit.BeerHop)
+	f("beer_ibu", gofakeit.BeerIbu)
+	f("beer_blg", gofakeit.BeerBlg)
+	f("beer_malt", gofakeit.BeerMalt)
+	f("beer_name", gofakeit.BeerName)
+	f("beer_style", gofakeit.BeerStyle)
+	f("beer_yeast", gofakeit.BeerYeast)
 
 	// Cars
-	f.Set("car", gofakeit.Car)
-	f.Set("car_type", gofakeit.CarType)
-	f.Set("car_maker", gofakeit.CarMaker)
-	f.Set("car_model", gofakeit.CarModel)
+	f("car", gofakeit.Car)
+	f("car_type", gofakeit.CarType)
+	f("car_maker", gofakeit.CarMaker)
+	f("car_model", gofakeit.CarModel)
 
 	// Text
-	f.Set("word", gofakeit.Word)
-	f.Set("sentence", gofakeit.Sentence)
-	f.Set("paragraph", gofakeit.Paragraph)
-	f.Set("question", gofakeit.Question)
-	f.Set("quote", gofakeit.Quote)
+	f("word", gofakeit.Word)
+	f("sentence", gofakeit.Sentence)
+	f("paragraph", gofakeit.Paragraph)
+	f("question", gofakeit.Question)
+	f("quote", gofakeit.Quote)
 
 	// Misc
-	f.Set("generate", gofakeit.Generate)
-	f.Set("boolean", gofakeit.Bool)
-	f.Set("uuid", gofakeit.UUID)
+	f("generate", gofakeit.Generate)
+	f("boolean", gofakeit.Bool)
+	f("uuid", gofakeit.UUID)
 
 	// Colors
-	f.Set("color", gofakeit.Color)
-	f.Set("hex_color", gofakeit.HexColor)
-	f.Set("rgb_color", gofakeit.RGBColor)
-	f.Set("safe_color", gofakeit.SafeColor)
+	f("color", gofakeit.Color)
+	f("hex_color", gofakeit.HexColor)
+	f("rgb_color", gofakeit.RGBColor)
+	f("safe_color", gofakeit.SafeColor)
 
 	// Internet
-	f.Set("url", gofakeit.URL)
-	f.Set("image_url", imageURL)
-	f.Set("avatar_url", avatarURL)
-	f.Set("domain_name", gofakeit.DomainName)
-	f.Set("domain_suffix", gofakeit.DomainSuffix)
-	f.Set("ipv4_address", gofakeit.IPv4Address)
-	f.Set("ipv6_address", gofakeit.IPv6Address)
-	f.Set("http_method", gofakeit.HTTPMethod)
-	f.Set("user_agent", gofakeit.UserAgent)
-	f.Set("user_agent_firefox", gofakeit.FirefoxUserAgent)
-	f.Set("user_agent_chrome", gofakeit.ChromeUserAgent)
-	f.Set("user_agent_opera", gofakeit.OperaUserAgent)
-	f.Set("user_agent_safari", gofakeit.SafariUserAgent)
+	f("url", gofakeit.URL)
+	f("image_url", imageURL)
+	f("avatar_url", avatarURL)
+	f("domain_name", gofakeit.DomainName)
+	f("domain_suffix", gofakeit.DomainSuffix)
+	f("ipv4_address", gofakeit.IPv4Address)
+	f("ipv6_address", gofakeit.IPv6Address)
+	f("http_method", gofakeit.HTTPMethod)
+	f("user_agent", gofakeit.UserAgent)
+	f("user_agent_firefox", gofakeit.FirefoxUserAgent)
+	f("user_agent_chrome", gofakeit.ChromeUserAgent)
+	f("user_agent_opera", gofakeit.OperaUserAgent)
+	f("user_agent_safari", gofakeit.SafariUserAgent)
 
 	// Date / Time
-	f.Set("date", gofakeit.Date)
-	f.Set("date_range", gofakeit.DateRange)
-	f.Set("nano_second", gofakeit.NanoSecond)
-	f.Set("second", gofakeit.Second)
-	f.Set("minute", gofakeit.Minute)
-	f.Set("hour", gofakeit.Hour)
-	f.Set("month", gofakeit.Month)
-	f.Set("day", gofakeit.Day)
-	f.Set("weekday", gofakeit.WeekDay)
-	f.Set("year", gofakeit.Year)
-	f.Set("timezone", gofakeit.TimeZone)
-	f.Set("timezone_abv", gofakeit.TimeZoneAbv)
-	f.Set("timezone_full", gofakeit.TimeZoneFull)
-	f.Set("timezone_offset", gofakeit.TimeZoneOffset)
+	f("date", gofakeit.Date)
+	f("date_range", gofakeit.DateRange)
+	f("nano_second", gofakeit.NanoSecond)
+	f("second", gofakeit.Second)
+	f("minute", gofakeit.Minute)
+	f("hour", gofakeit.Hour)
+	f("month", gofakeit.Month)
+	f("day", gofakeit.Day)
+	f("weekday", gofakeit.WeekDay)
+	f("year", gofakeit.Year)
+	f("timezone", gofakeit.TimeZone)
+	f("timezone_abv", gofakeit.TimeZoneAbv)
+	f("timezone_full", gofakeit.TimeZoneFull)
+	f("timezone_offset", gofakeit.TimeZoneOffset)
 
 	// Payment
-	f.Set("price", gofakeit.Price)
-	f.Set("credit_card", gofakeit.CreditCard)
-	f.Set("credit_card_cvv", gofakeit.CreditCardCvv)
-	f.Set("credit_card_number", gofakeit.CreditCardNumber)
-	f.Set("credit_card_type", gofakeit.CreditCardType)
-	f.Set("currency", gofakeit.Currency)
-	f.Set("currency_long", gofakeit.CurrencyLong)
-	f.Set("currency_short", gofakeit.CurrencyShort)
+	f("price", gofakeit.Price)
+	f("credit_card", gofakeit.CreditCard)
+	f("credit_card_cvv", gofakeit.CreditCardCvv)
+	f("credit_card_number", gofakeit.CreditCardNumber)
+	f("credit_card_type", gofakeit.CreditCardType)
+	f("currency", gofakeit.Currency)
+	f("currency_long", gofakeit.CurrencyLong)
+	f("currency_short", gofakeit.CurrencyShort)
 
 	// Company
-	f.Set("bs", gofakeit.BS)
-	f.Set("buzzword", gofakeit.BuzzWord)
-	f.Set("company", gofakeit.Company)
-	f.Set("company_suffix", gofakeit.CompanySuffix)
-	f.Set("job", gofakeit.Job)
-	f.Set("job_description", gofakeit.JobDescriptor)
-	f.Set("job_level", gofakeit.JobLevel)
-	f.Set("job_title", gofakeit.JobTitle)
+	f("bs", gofakeit.BS)
+	f("buzzword", gofakeit.BuzzWord)
+	f("company", gofakeit.Company)
+	f("company_suffix", gofakeit.CompanySuffix)
+	f("job", gofakeit.Job)
+	f("job_description", gofakeit.JobDescriptor)
+	f("job_level", gofakeit.JobLevel)
+	f("job_title", gofakeit.JobTitle)
 
 	// Hacker
-	f.Set("hacker_abbreviation", gofakeit.HackerAbbreviation)
-	f.Set("hacker_adjective", gofakeit.HackerAdjective)
-	f.Set("hacker_noun", gofakeit.HackerNoun)
-	f.Set("hacker_phrase", gofakeit.HackerPhrase)
-	f.Set("hacker_verb", gofakeit.HackerVerb)
+	f("hacker_abbreviation", gofakeit.HackerAbbreviation)
+	f("hacker_adjective", gofakeit.HackerAdjective)
+	f("hacker_noun", gofakeit.HackerNoun)
+	f("hacker_phrase", gofakeit.HackerPhrase)
+	f("hacker_verb", gofakeit.HackerVerb)
 
 	//Hipster
-	f.Set("hipster_word", gofakeit.HipsterWord)
-	f.Set("hipster_paragraph", gofakeit.HipsterParagraph)
-	f.Set("hipster_sentence", gofakeit.HipsterSentence)
+	f("hipster_word", gofakeit.HipsterWord)
+	f("hipster_paragraph", gofakeit.HipsterParagraph)
+	f("hipster_sentence", gofakeit.HipsterSentence)
 
 	// File
-	f.Set("file_extension", gofakeit.FileExtension)
-	f.Set("file_mine_type", gofakeit.FileMimeType)
+	f("file_extension", gofakeit.FileExtension)
+	f("file_mine_type", gofakeit.FileMimeType)
 
 	// Numbers
-	f.Set("number", gofakeit.Number)
-	f.Set("numerify", gofakeit.Numerify)
-	f.Set("int8", gofakeit.Int8)
-	f.Set("int16", gofakeit.Int16)
-	f.Set("int32", gofakeit.Int32)
-	f.Set("int64", gofakeit.Int64)
-	f.Set("uint8", gofakeit.Uint8)
-	f.Set("uint16", gofakeit.Uint16)
-	f.Set("uint32", gofakeit.Uint32)
-	f.Set("uint64", gofakeit.Uint64)
-	f.Set("float32", gofakeit.Float32)
-	f.Set("float32_range", gofakeit.Float32Range)
-	f.Set("float64", gofakeit.Float64)
-	f.Set("float64_range", gofakeit.Float64Range)
-	f.Set("shuffle_ints", gofakeit.ShuffleInts)
-	f.Set("mac_address", gofakeit.MacAddress)
+	f("number", gofakeit.Number)
+	f("numerify", gofakeit.Numerify)
+	f("int8", gofakeit.Int8)
+	f("int16", gofakeit.Int16)
+	f("int32", gofakeit.Int32)
+	f("int64", gofakeit.Int64)
+	f("uint8", gofakeit.Uint8)
+	f("uint16", gofakeit.Uint16)
+	f("uint32", gofakeit.Uint32)
+	f("uint64", gofakeit.Uint64)
+	f("float32", gofakeit.Float32)
+	f("float32_range", gofakeit.Float32Range)
+	f("float64", gofakeit.Float64)
+	f("float64_range", gofakeit.Float64Range)
+	f("shuffle_ints", gofakeit.ShuffleInts)
+	f("mac_address", gofakeit.MacAddress)
 
 	// String
-	f.Set("digit", gofakeit.Digit)
-	f.Set("letter", gofakeit.Letter)
-	f.Set("lexify", gofakeit.Lexify)
-	f.Set("rand_string", getRandValue)
-	f.Set("numerify", gofakeit.Numerify)
+	f("digit", gofakeit.Digit)
+	f("letter", gofakeit.Letter)
+	f("lexify", gofakeit.Lexify)
+	f("rand_string", getRandValue)
+	f("numerify", gofakeit.Numerify)
 }
 
-//nolint: errcheck
-func setUtilFuncs(f *goja.Object) {
+func setUtilFuncs(f func(string, interface{})) {
 	// Slugs
-	f.Set("make_slug", slug.Make)
-	f.Set("make_slug_lang", slug.MakeLang)
-	f.Set("shuffle_strings", gofakeit.ShuffleStrings)
+	f("make_slug", slug.Make)
+	f("make_slug_lang", slug.MakeLang)
+	f("shuffle_strings", gofakeit.ShuffleStrings)
 }
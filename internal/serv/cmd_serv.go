@@ -20,13 +20,32 @@ func cmdServ(servConf *ServConfig) func(*cobra.Command, []string) {
 
 		initWatcher(servConf)
 
+		// serve the tables and rows from the mock data file
+		// without connecting to a database
+		if servConf.conf.MockData != "" {
+			servConf.log.Printf("INF using mock data: %s", servConf.conf.MockData)
+
+			if err := initSuperGraph(servConf); err != nil {
+				fatalInProd(servConf, err, "failed to initialize Super Graph")
+			}
+			startHTTP(servConf)
+			return
+		}
+
+		// only the server and not the migrations or
+		// seeding is read only in read only mode
+		servConf.readOnly = servConf.conf.ReadOnly
+
 		servConf.db, err = initDB(servConf, true, true)
 		if err != nil {
 			fatalInProd(servConf, err, "failed to connect to database")
 		}
 
-		sg, err = core.NewSuperGraph(&servConf.conf.Core, servConf.db)
-		if err != nil {
+		if err := pingDB(servConf); err != nil {
+			servConf.log.Printf("WRN database not reachable, starting as not ready: %s", err)
+			go waitForDB(servConf)
+
+		} else if err := initSuperGraph(servConf); err != nil {
 			fatalInProd(servConf, err, "failed to initialize Super Graph")
 		}
 
@@ -0,0 +1,241 @@
+package serv
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/dosco/super-graph/core"
+	"github.com/gobuffalo/flect"
+)
+
+// goClient is the part of the generated Go client that's the same
+// for all the operations
+const goClient = `
+// Client calls the queries in the allow list of a Super Graph server
+type Client struct {
+	URL    string
+	HTTP   *http.Client
+	Header http.Header
+}
+
+// NewClient returns a client for the GraphQL endpoint at the url
+// (eg. http://localhost:8080/api/v1/graphql)
+func NewClient(url string) *Client {
+	return &Client{URL: url, HTTP: http.DefaultClient, Header: make(http.Header)}
+}
+
+// Error is an error returned by the server, Code is set for the errors
+// clients are expected to handle (eg. RATE_LIMITED)
+type Error struct {
+	Message string
+	Code    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (c *Client) do(ctx context.Context, name, query string, vars, data interface{}) error {
+	body, err := json.Marshal(struct {
+		Query         string      ` + "`json:\"query\"`" + `
+		OperationName string      ` + "`json:\"operationName\"`" + `
+		Variables     interface{} ` + "`json:\"variables,omitempty\"`" + `
+	}{query, name, vars})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var r struct {
+		Data    json.RawMessage ` + "`json:\"data\"`" + `
+		Error   string          ` + "`json:\"error\"`" + `
+		Message string          ` + "`json:\"message\"`" + `
+		Code    string          ` + "`json:\"code\"`" + `
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return fmt.Errorf("%s: %s", name, res.Status)
+	}
+
+	if r.Error != "" || r.Message != "" {
+		return &Error{Message: r.Error + r.Message, Code: r.Code}
+	}
+
+	return json.Unmarshal(r.Data, data)
+}
+`
+
+// genGo returns the source of a Go client package with a typed
+// function for each of the operations
+func genGo(ops []core.OpInfo, pkg string) ([]byte, error) {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "// Code generated by super-graph gen:go. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&sb, "package %s\n\n", pkg)
+	sb.WriteString("import (\n\t\"bytes\"\n\t\"context\"\n\t\"encoding/json\"\n\t\"fmt\"\n\t\"net/http\"\n)\n")
+	sb.WriteString(goClient)
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Name < ops[j].Name })
+
+	for _, op := range ops {
+		if op.Type == core.OpSubscription {
+			continue
+		}
+		genGoOp(&sb, op)
+	}
+
+	b, err := format.Source([]byte(sb.String()))
+	if err != nil {
+		return nil, fmt.Errorf("gen:go: %w", err)
+	}
+	return b, nil
+}
+
+func genGoOp(sb *strings.Builder, op core.OpInfo) {
+	name := goName(op.Name)
+
+	fmt.Fprintf(sb, "\nconst %sQuery = %s\n", lowerFirst(name), goString(op.Query))
+
+	if len(op.Variables) != 0 {
+		fmt.Fprintf(sb, "\n// %sVars are the variables of %s\ntype %sVars struct {\n", name, op.Name, name)
+		for _, v := range op.Variables {
+			t := goType(v.Type)
+			if t == "json.RawMessage" {
+				t = "interface{}"
+			}
+			if v.Array {
+				t = "[]" + t
+			}
+			fmt.Fprintf(sb, "\t%s %s `json:\"%s\"`\n", goName(v.Name), t, v.Name)
+		}
+		sb.WriteString("}\n")
+	}
+
+	fmt.Fprintf(sb, "\n// %sResult is the result of %s\ntype %sResult struct {\n", name, op.Name, name)
+	var types []core.OpField
+	types = genGoFields(sb, name, op.Fields, types)
+	sb.WriteString("}\n")
+
+	for len(types) != 0 {
+		f := types[0]
+		types = types[1:]
+
+		fmt.Fprintf(sb, "\ntype %s struct {\n", f.Type)
+		types = genGoFields(sb, f.Type, f.Fields, types)
+		sb.WriteString("}\n")
+	}
+
+	fmt.Fprintf(sb, "\n// %s runs the %s operation\n", name, op.Name)
+
+	if len(op.Variables) != 0 {
+		fmt.Fprintf(sb, "func (c *Client) %s(ctx context.Context, vars %sVars) (*%sResult, error) {\n", name, name, name)
+	} else {
+		fmt.Fprintf(sb, "func (c *Client) %s(ctx context.Context) (*%sResult, error) {\n", name, name)
+		sb.WriteString("\tvar vars interface{}\n")
+	}
+
+	fmt.Fprintf(sb, "\tvar res %sResult\n", name)
+	fmt.Fprintf(sb, "\tif err := c.do(ctx, %q, %sQuery, vars, &res); err != nil {\n", op.Name, lowerFirst(name))
+	sb.WriteString("\t\treturn nil, err\n\t}\n\treturn &res, nil\n}\n")
+}
+
+// genGoFields writes the fields of a struct and returns the types of
+// the tables in it, their name is set as the Type
+func genGoFields(sb *strings.Builder, parent string, fields []core.OpField, types []core.OpField) []core.OpField {
+	for _, f := range fields {
+		var t string
+
+		switch {
+		case len(f.Fields) != 0:
+			tn := parent + goName(f.Name)
+			types = append(types, core.OpField{Type: tn, Fields: f.Fields})
+
+			if f.List {
+				t = "[]" + tn
+			} else {
+				t = "*" + tn
+			}
+
+		case f.Type == "":
+			t = "json.RawMessage"
+
+		default:
+			t = goType(f.Type)
+
+			switch {
+			case f.Array:
+				t = "[]" + t
+			case !f.NotNull && t != "json.RawMessage":
+				t = "*" + t
+			}
+		}
+
+		fmt.Fprintf(sb, "\t%s %s `json:\"%s\"`\n", goName(f.Name), t, f.Name)
+	}
+
+	return types
+}
+
+// goType returns the Go type for a database type
+func goType(t string) string {
+	t = strings.ToLower(t)
+
+	if i := strings.IndexByte(t, '('); i != -1 {
+		t = strings.TrimSpace(t[:i])
+	}
+
+	switch t {
+	case "smallint", "integer", "int", "int2", "int4", "bigint", "int8",
+		"smallserial", "serial", "bigserial":
+		return "int64"
+
+	case "real", "float4", "double precision", "float8", "numeric", "decimal":
+		return "float64"
+
+	case "boolean", "bool":
+		return "bool"
+
+	case "json", "jsonb":
+		return "json.RawMessage"
+	}
+
+	return "string"
+}
+
+func goName(s string) string {
+	n := flect.Pascalize(s)
+	if n == "" || (n[0] >= '0' && n[0] <= '9') {
+		n = "X" + n
+	}
+	return n
+}
+
+func lowerFirst(s string) string {
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// goString quotes the query as a raw string unless it has a backtick
+func goString(s string) string {
+	if strings.Contains(s, "`") {
+		return fmt.Sprintf("%q", s)
+	}
+	return "`" + s + "`"
+}
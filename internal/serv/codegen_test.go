@@ -0,0 +1,124 @@
+package serv
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/dosco/super-graph/core"
+)
+
+func TestGenGo(t *testing.T) {
+	ops := []core.OpInfo{
+		{
+			Name:      "getUser",
+			Type:      core.OpQuery,
+			Query:     "query getUser { user(id: $id) { id email products { name price tags } } }",
+			Variables: []core.OpVar{{Name: "id", Type: "bigint"}},
+			Fields: []core.OpField{{
+				Name: "user",
+				Fields: []core.OpField{
+					{Name: "id", Type: "bigint", NotNull: true},
+					{Name: "email", Type: "character varying(255)"},
+					{Name: "products", List: true, Fields: []core.OpField{
+						{Name: "name", Type: "text", NotNull: true},
+						{Name: "price", Type: "numeric(7,2)"},
+						{Name: "tags", Type: "text", Array: true},
+					}},
+				},
+			}},
+		},
+		{
+			Name:  "newUsers",
+			Type:  core.OpSubscription,
+			Query: "subscription newUsers { users { id } }",
+		},
+	}
+
+	b, err := genGo(ops, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "client.go", b, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// gofmt aligns the fields
+	src := strings.Join(strings.Fields(string(b)), " ")
+
+	exp := []string{
+		"func (c *Client) GetUser(ctx context.Context, vars GetUserVars) (*GetUserResult, error)",
+		"ID int64 `json:\"id\"`",
+		"User *GetUserUser `json:\"user\"`",
+		"Email *string `json:\"email\"`",
+		"Products []GetUserUserProducts `json:\"products\"`",
+		"Price *float64 `json:\"price\"`",
+		"Tags []string `json:\"tags\"`",
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(src, v) {
+			t.Errorf("expected '%s' in:\n%s", v, src)
+		}
+	}
+
+	// subscriptions need a websocket and are skipped
+	if strings.Contains(src, "NewUsers") {
+		t.Errorf("unexpected subscription in:\n%s", src)
+	}
+}
+
+func TestGenTS(t *testing.T) {
+	query := "query getUser { user(id: $id) { id email products { name tags } } }"
+
+	ops := []core.OpInfo{{
+		Name:      "getUser",
+		Type:      core.OpQuery,
+		Query:     query,
+		Variables: []core.OpVar{{Name: "id", Type: "bigint"}},
+		Fields: []core.OpField{{
+			Name: "user",
+			Fields: []core.OpField{
+				{Name: "id", Type: "bigint", NotNull: true},
+				{Name: "email", Type: "character varying(255)"},
+				{Name: "products", List: true, Fields: []core.OpField{
+					{Name: "name", Type: "text", NotNull: true},
+					{Name: "tags", Type: "text", Array: true},
+				}},
+			},
+		}},
+	}}
+
+	b, m, err := genTS(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := string(b)
+
+	exp := []string{
+		"export type GetUserQueryVariables = {\n  id?: number | null;\n};",
+		"export type GetUserQuery = {\n  user: {\n    id: number;\n    email: string | null;\n",
+		"    products: Array<{\n      name: string;\n      tags: Array<string> | null;\n    }>;\n",
+		"export const getUserDocument = ",
+		"export const getUserDocumentHash = \"" + queryHash(query) + "\";",
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(src, v) {
+			t.Errorf("expected '%s' in:\n%s", v, src)
+		}
+	}
+
+	var manifest map[string]string
+
+	if err := json.Unmarshal(m, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest[queryHash(query)] != query {
+		t.Errorf("expected the query in the manifest: %s", m)
+	}
+}
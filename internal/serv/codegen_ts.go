@@ -0,0 +1,165 @@
+package serv
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dosco/super-graph/core"
+)
+
+// genTS returns the source of a TypeScript module with the types of the
+// variables and result of each operation, named the way graphql-code-generator
+// names them (eg. GetUserQuery and GetUserQueryVariables), along with the
+// persisted operations manifest that maps the sha256 hash of each query to it
+func genTS(ops []core.OpInfo) ([]byte, []byte, error) {
+	var sb strings.Builder
+
+	sb.WriteString("// Code generated by super-graph gen:ts. DO NOT EDIT.\n")
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Name < ops[j].Name })
+
+	manifest := make(map[string]string, len(ops))
+
+	for _, op := range ops {
+		h := queryHash(op.Query)
+		manifest[h] = op.Query
+
+		genTSOp(&sb, op, h)
+	}
+
+	sb.WriteString("\nexport const operations = {\n")
+	for _, op := range ops {
+		fmt.Fprintf(&sb, "  %s: %sDocument,\n", tsKey(op.Name), lowerFirst(goName(op.Name)))
+	}
+	sb.WriteString("};\n")
+
+	// json.MarshalIndent sorts the keys
+	m, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("gen:ts: %w", err)
+	}
+
+	return []byte(sb.String()), m, nil
+}
+
+func genTSOp(sb *strings.Builder, op core.OpInfo, hash string) {
+	name := goName(op.Name)
+
+	switch op.Type {
+	case core.OpMutation:
+		name += "Mutation"
+	case core.OpSubscription:
+		name += "Subscription"
+	default:
+		name += "Query"
+	}
+
+	doc := lowerFirst(goName(op.Name)) + "Document"
+
+	fmt.Fprintf(sb, "\nexport const %s = %s;\n", doc, tsString(op.Query))
+	fmt.Fprintf(sb, "export const %sHash = %s;\n", doc, tsString(hash))
+
+	fmt.Fprintf(sb, "\nexport type %sVariables = {\n", name)
+	for _, v := range op.Variables {
+		t := tsType(v.Type)
+		if v.Array {
+			t = "Array<" + t + ">"
+		}
+		fmt.Fprintf(sb, "  %s?: %s | null;\n", tsKey(v.Name), t)
+	}
+	sb.WriteString("};\n")
+
+	fmt.Fprintf(sb, "\nexport type %s = ", name)
+	genTSFields(sb, op.Fields, 0)
+	sb.WriteString(";\n")
+}
+
+// genTSFields writes the fields as an object type, the tables in
+// it are written inline
+func genTSFields(sb *strings.Builder, fields []core.OpField, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	sb.WriteString("{\n")
+
+	for _, f := range fields {
+		var t string
+
+		switch {
+		case len(f.Fields) != 0:
+			var b strings.Builder
+			genTSFields(&b, f.Fields, depth+1)
+			t = b.String()
+
+			if f.List {
+				t = "Array<" + t + ">"
+			} else {
+				t += " | null"
+			}
+
+		case f.Type == "":
+			t = "unknown"
+
+		default:
+			t = tsType(f.Type)
+
+			if f.Array {
+				t = "Array<" + t + ">"
+			}
+			if !f.NotNull && t != "unknown" {
+				t += " | null"
+			}
+		}
+
+		fmt.Fprintf(sb, "%s  %s: %s;\n", indent, tsKey(f.Name), t)
+	}
+
+	sb.WriteString(indent + "}")
+}
+
+// tsType returns the TypeScript type for a database type
+func tsType(t string) string {
+	switch goType(t) {
+	case "int64", "float64":
+		return "number"
+	case "bool":
+		return "boolean"
+	case "json.RawMessage":
+		return "unknown"
+	}
+	return "string"
+}
+
+// tsString quotes the string, a JSON string is a valid TypeScript string
+func tsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// tsKey returns the name as a property name, quoted unless it's an identifier
+func tsKey(s string) string {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case c == '_', c == '$', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i != 0:
+		default:
+			return tsString(s)
+		}
+	}
+
+	if s == "" {
+		return tsString(s)
+	}
+	return s
+}
+
+// queryHash returns the sha256 hash clients send for a persisted query
+func queryHash(query string) string {
+	h := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(h[:])
+}
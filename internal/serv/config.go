@@ -128,3 +128,8 @@ func (c *Config) relPath(p string) string {
 func (c *Config) rateLimiterEnable() bool {
 	return c.RateLimiter.Rate > 0 && c.RateLimiter.Bucket > 0
 }
+
+// sharedStorage returns true if the storage is one the instances share
+func (c *Config) sharedStorage() bool {
+	return c.Storage.Type != "" && c.Storage.Type != "memory"
+}
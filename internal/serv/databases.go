@@ -0,0 +1,85 @@
+package serv
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+
+	"github.com/dosco/super-graph/core"
+)
+
+// attachedDB is another database selected under a root field of its name
+type attachedDB struct {
+	name string
+	db   *sql.DB
+	sg   *core.SuperGraph
+}
+
+// initDatabases connects to the other databases and creates their Super
+// Graph instances. They use the defaults of the core config, the tables and
+// roles in it are of the primary database
+func initDatabases(servConf *ServConfig) error {
+	c := servConf.conf
+
+	for _, v := range c.Databases {
+		dc := *c
+
+		if v.Host != "" {
+			dc.DB.Host = v.Host
+		}
+		if v.Port != 0 {
+			dc.DB.Port = v.Port
+		}
+		if v.DBName != "" {
+			dc.DB.DBName = v.DBName
+		}
+		if v.User != "" {
+			dc.DB.User = v.User
+			dc.DB.Password = v.Password
+		}
+		dc.DB.Schema = v.Schema
+
+		sc := *servConf
+		sc.conf = &dc
+
+		db, err := initDB(&sc, true, false)
+		if err != nil {
+			return fmt.Errorf("database %s: %w", v.Name, err)
+		}
+
+		conf := core.Config{
+			SecretKey:     c.SecretKey,
+			UseAllowList:  c.UseAllowList,
+			AllowListFile: filepath.Join(filepath.Dir(c.AllowListFile), "allow."+v.Name+".list"),
+			DefaultBlock:  c.DefaultBlock,
+			DBSchema:      v.Schema,
+			Debug:         c.Debug,
+		}
+
+		g, err := core.NewSuperGraph(&conf, db)
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("database %s: %w", v.Name, err)
+		}
+
+		servConf.attached = append(servConf.attached, attachedDB{name: v.Name, db: db, sg: g})
+	}
+
+	return nil
+}
+
+// attachDatabases attaches the other databases to the Super Graph instance
+func attachDatabases(servConf *ServConfig, g *core.SuperGraph) error {
+	for _, v := range servConf.attached {
+		if err := g.Attach(v.name, v.sg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func closeDatabases(servConf *ServConfig) {
+	for _, v := range servConf.attached {
+		v.db.Close()
+	}
+}
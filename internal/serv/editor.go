@@ -0,0 +1,81 @@
+package serv
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/dosco/super-graph/core"
+)
+
+const editorRoute = "/api/v1/editor"
+
+type editorReq struct {
+	Query  string          `json:"query"`
+	Vars   json.RawMessage `json:"variables"`
+	Role   string          `json:"role"`
+	Path   []string        `json:"path"`
+	Tokens bool            `json:"tokens"`
+}
+
+type editorResp struct {
+	Errors      []diagnostic `json:"errors,omitempty"`
+	Completions []string     `json:"completions,omitempty"`
+	Tokens      []core.Token `json:"tokens,omitempty"`
+}
+
+type diagnostic struct {
+	Message string `json:"message"`
+}
+
+// editorHandler validates queries and returns completions and the tokens of
+// the query for editor plugins (eg. VS Code) while writing queries for the
+// allow list. It's only enabled in development mode.
+func editorHandler(servConf *ServConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !isReady() {
+			renderErr(w, errNotReady)
+			return
+		}
+
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxReadBytes))
+		if err != nil {
+			renderErr(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		req := editorReq{}
+
+		if err := json.Unmarshal(b, &req); err != nil {
+			renderErr(w, err)
+			return
+		}
+
+		var res editorResp
+
+		if req.Query != "" {
+			if err := graph().Validate(req.Query, req.Vars, req.Role); err != nil {
+				res.Errors = append(res.Errors, diagnostic{err.Error()})
+			}
+		}
+
+		// a lex error is already in the errors of validating the query
+		if req.Tokens {
+			res.Tokens, _ = core.Tokens(req.Query)
+		}
+
+		if req.Path != nil {
+			res.Completions, err = graph().Completions(req.Path, req.Role)
+			if err != nil {
+				res.Errors = append(res.Errors, diagnostic{err.Error()})
+			}
+		}
+
+		//nolint: errcheck
+		json.NewEncoder(w).Encode(res)
+	}
+}
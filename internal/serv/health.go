@@ -5,17 +5,30 @@ import (
 	"net/http"
 )
 
-var healthyResponse = []byte("All's Well")
+var (
+	healthyResponse  = []byte("All's Well")
+	notReadyResponse = []byte("Not Ready")
+)
 
 func health(servConf *ServConfig) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReady() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			//nolint: errcheck
+			w.Write(notReadyResponse)
+			return
+		}
+
 		ct, cancel := context.WithTimeout(r.Context(), servConf.conf.DB.PingTimeout)
 		defer cancel()
 
-		if err := servConf.db.PingContext(ct); err != nil {
-			servConf.log.Printf("ERR error pinging database: %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		// there's no database to ping when using mock data
+		if servConf.db != nil {
+			if err := servConf.db.PingContext(ct); err != nil {
+				servConf.log.Printf("ERR error pinging database: %s", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
 		}
 
 		if _, err := w.Write(healthyResponse); err != nil {
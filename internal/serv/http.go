@@ -1,11 +1,12 @@
 package serv
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
-	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/dosco/super-graph/core"
 	"github.com/dosco/super-graph/internal/serv/internal/auth"
@@ -27,13 +28,29 @@ var (
 )
 
 type gqlReq struct {
-	OpName string          `json:"operationName"`
-	Query  string          `json:"query"`
-	Vars   json.RawMessage `json:"variables"`
+	OpName     string          `json:"operationName"`
+	Query      string          `json:"query"`
+	Vars       json.RawMessage `json:"variables"`
+	Extensions json.RawMessage `json:"extensions"`
+
+	// get is set for requests sent with GET, these can't run mutations
+	get bool
+
+	// uploads are the files stored for the request, they're deleted
+	// when it fails
+	uploads []*upload
+
+	// allowed is set for queries taken from the allow list, these
+	// are not checked against the persisted queries
+	allowed bool
 }
 
+// errorResp has the errors in the format of the spec, with the locations
+// and paths clients use to point to them, error and code are the first
 type errorResp struct {
-	Error string `json:"error"`
+	Error  string              `json:"error"`
+	Code   string              `json:"code,omitempty"`
+	Errors []core.GraphQLError `json:"errors"`
 }
 
 func apiV1Handler(servConf *ServConfig) http.Handler {
@@ -56,12 +73,18 @@ func apiV1Handler(servConf *ServConfig) http.Handler {
 
 func apiV1(servConf *ServConfig) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReady() {
+			w.Header().Set("Content-Type", "application/json")
+			renderErr(w, errNotReady)
+			return
+		}
+
 		if websocket.IsWebSocketUpgrade(r) {
 			apiV1Ws(servConf, w, r)
 			return
 		}
 
-		ct := r.Context()
+		ct := reqContext(servConf, r)
 		w.Header().Set("Content-Type", "application/json")
 
 		//nolint: errcheck
@@ -70,64 +93,255 @@ func apiV1(servConf *ServConfig) func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxReadBytes))
+		var reqs []gqlReq
+		var batch bool
+		var err error
+
+		if isMultipart(r) {
+			reqs, batch, err = decodeUpload(servConf, ct, r)
+		} else {
+			reqs, batch, err = decodeRequest(r)
+		}
+
 		if err != nil {
 			renderErr(w, err)
 			return
 		}
-		defer r.Body.Close()
 
-		req := gqlReq{}
+		if servConf.conf.telemetryEnabled() {
+			ochttp.SetRoute(ct, apiRoute)
+		}
 
-		if err = json.Unmarshal(b, &req); err != nil {
-			renderErr(w, err)
+		if !batch && wantsStream(reqs[0].Extensions) {
+			streamReq(servConf, w, ct, &reqs[0])
 			return
 		}
 
-		doLog := true
-		res, err := sg.GraphQL(ct, req.Query, req.Vars)
-
-		if servConf.conf.telemetryEnabled() {
-			span := trace.FromContext(ct)
-
-			span.AddAttributes(
-				trace.StringAttribute("operation", res.OperationName()),
-				trace.StringAttribute("query_name", res.QueryName()),
-				trace.StringAttribute("role", res.Role()),
-			)
+		if !batch {
+			if key := wantsIdempotency(servConf, r, &reqs[0]); key != "" {
+				idempotentReq(servConf, w, ct, key, &reqs[0])
+				return
+			}
 
+			res, err := execReq(servConf, ct, &reqs[0])
 			if err != nil {
-				span.AddAttributes(trace.StringAttribute("error", err.Error()))
+				renderErr(w, err)
+				return
 			}
 
-			ochttp.SetRoute(ct, apiRoute)
+			if servConf.conf.CacheControl != "" && res.Operation() == core.OpQuery {
+				w.Header().Set("Cache-Control", servConf.conf.CacheControl)
+			}
+			//nolint: errcheck
+			json.NewEncoder(w).Encode(res)
+			return
 		}
 
-		if !servConf.conf.Production && res.QueryName() == introspectionQuery {
-			doLog = false
+		// each query of a batch gets its own result or error
+		out := make([]interface{}, len(reqs))
+
+		for i := range reqs {
+			if res, err := execReq(servConf, ct, &reqs[i]); err != nil {
+				out[i] = errResp(err)
+			} else {
+				out[i] = res
+			}
 		}
 
-		if doLog && servConf.logLevel >= LogLevelDebug {
-			servConf.log.Printf("DBG query %s: %s", res.QueryName(), res.SQL())
+		//nolint: errcheck
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// reqContext returns the context of the request with the values
+// taken from its headers
+func reqContext(servConf *ServConfig, r *http.Request) context.Context {
+	ct := r.Context()
+
+	// translated columns are returned in the language of the client
+	if v := r.Header.Get("Accept-Language"); v != "" {
+		ct = context.WithValue(ct, core.LocaleKey, v)
+	}
+
+	// the usage is metered for the api key of the request
+	if h := servConf.conf.Metering.Header; h != "" {
+		if v := r.Header.Get(h); v != "" {
+			ct = context.WithValue(ct, core.MeterKey, v)
 		}
+	}
 
-		if err == nil {
-			if servConf.conf.CacheControl != "" && res.Operation() == core.OpQuery {
-				w.Header().Set("Cache-Control", servConf.conf.CacheControl)
+	return ct
+}
+
+// execReq runs the query of a request the same in or out of a batch, a panic
+// is returned as an internal error so it doesn't take down the connection
+// and the other requests of the batch
+func execReq(servConf *ServConfig, ct context.Context, req *gqlReq) (res *core.Result, err error) {
+	// the files stored for a failed or rolled back mutation are deleted
+	if len(req.uploads) != 0 {
+		defer func() {
+			if err != nil || wantsDryRun(req.Extensions) {
+				discardUploads(servConf, ct, req)
 			}
-			//nolint: errcheck
-			json.NewEncoder(w).Encode(res)
+		}()
+	}
 
-		} else {
-			renderErr(w, err)
+	defer func() {
+		if v := recover(); v != nil {
+			res, err = nil, reqPanic(servConf, ct, req, v)
 		}
+	}()
+
+	return runReq(servConf, ct, req)
+}
 
-		if doLog && servConf.logLevel >= LogLevelInfo {
-			reqLog(servConf, res, err)
+func runReq(servConf *ServConfig, ct context.Context, req *gqlReq) (*core.Result, error) {
+	query, err := reqQuery(ct, req)
+	if err != nil {
+		addRecentError(req.OpName, err)
+
+		if servConf.conf.telemetryEnabled() {
+			recordError(ct, "", req.OpName, err)
 		}
+		return nil, err
+	}
+
+	// the mutation is rolled back
+	if wantsDryRun(req.Extensions) {
+		ct = context.WithValue(ct, core.DryRunKey, true)
+	}
+
+	// the rows are returned as entities keyed by id
+	if wantsNormalize(req.Extensions) {
+		ct = context.WithValue(ct, core.NormalizeKey, true)
+	}
+
+	// trusted services add sql to the query (internal endpoint only)
+	if sf, err := sqlFragments(ct, req.Extensions); err != nil {
+		addRecentError(req.OpName, err)
+		return nil, err
+	} else if sf != nil {
+		ct = context.WithValue(ct, core.SQLFragmentsKey, sf)
+	}
+
+	st := time.Now()
+	res, err := graphQL(ct, query, req.Vars)
+
+	afterReq(servConf, ct, req, query, res, err, st)
+
+	return res, err
+}
+
+// afterReq traces, logs, samples and audits a request once it's run, it's the
+// same for requests with the result streamed
+func afterReq(servConf *ServConfig, ct context.Context, req *gqlReq, query string,
+	res *core.Result, err error, st time.Time) {
+	doLog := true
+
+	if servConf.conf.telemetryEnabled() {
+		span := trace.FromContext(ct)
+
+		span.AddAttributes(
+			trace.StringAttribute("operation", res.OperationName()),
+			trace.StringAttribute("query_name", res.QueryName()),
+			trace.StringAttribute("fingerprint", res.Fingerprint()),
+			trace.StringAttribute("role", res.Role()),
+		)
+
+		for k, v := range res.Tags() {
+			span.AddAttributes(trace.StringAttribute("tag."+k, v))
+		}
+
+		if err != nil {
+			span.AddAttributes(
+				trace.StringAttribute("error", err.Error()),
+				trace.StringAttribute("error_category", core.ErrorCategory(err)),
+			)
+			recordError(ct, res.OperationName(), res.QueryName(), err)
+		}
+
+		recordQuery(ct, res, time.Since(st))
+	}
+
+	if !servConf.conf.Production && res.QueryName() == introspectionQuery {
+		doLog = false
+	}
+
+	if doLog && servConf.logLevel >= LogLevelDebug {
+		servConf.log.Printf("DBG query %s: %s", res.QueryName(), res.SQL())
+	}
+
+	if servConf.sqlLog != nil {
+		servConf.sqlLog.write(res, err, st)
+	}
+
+	if servConf.conf.Samples.Enable && doLog {
+		addSample(servConf, query, req.Vars, res, err)
+	}
+
+	if err != nil {
+		addRecentError(res.QueryName(), err)
+	} else if servConf.router != nil && res.Operation() == core.OpMutation && !wantsDryRun(req.Extensions) {
+		servConf.router.written(ct)
+	}
+
+	if doLog && servConf.logLevel >= LogLevelInfo {
+		reqLog(servConf, res, err)
+	}
+
+	if admin, ok := auth.Impersonator(ct); ok {
+		fields := []zapcore.Field{
+			zap.String("op", res.OperationName()),
+			zap.String("name", res.QueryName()),
+			zap.String("role", res.Role()),
+		}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		}
+		auditLog(servConf, ct, admin, fields...)
+	}
+}
+
+// streamReq runs a query with its rows written to the response as they're
+// fetched, each batch is flushed so it's sent as a chunk
+func streamReq(servConf *ServConfig, w http.ResponseWriter, ct context.Context, req *gqlReq) {
+	query, err := reqQuery(ct, req)
+	if err != nil {
+		addRecentError(req.OpName, err)
+
+		if servConf.conf.telemetryEnabled() {
+			recordError(ct, "", req.OpName, err)
+		}
+		renderErr(w, err)
+		return
+	}
+
+	fw := flushWriter{w: w}
+	fw.f, _ = w.(http.Flusher)
+
+	st := time.Now()
+	res, err := graph().GraphQLStream(ct, query, req.Vars, fw)
+
+	afterReq(servConf, ct, req, query, res, err, st)
+
+	if err != nil && !res.Streamed() {
+		renderErr(w, err)
 	}
 }
 
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func (fw flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	if err == nil && fw.f != nil {
+		fw.f.Flush()
+	}
+	return n, err
+}
+
 func reqLog(servConf *ServConfig, res *core.Result, err error) {
 	var msg string
 
@@ -137,9 +351,13 @@ func reqLog(servConf *ServConfig, res *core.Result, err error) {
 		zap.String("role", res.Role()),
 	}
 
+	if tags := res.Tags(); len(tags) != 0 {
+		fields = append(fields, zap.Any("tags", tags))
+	}
+
 	if err != nil {
 		msg = "error"
-		fields = append(fields, zap.Error(err))
+		fields = append(fields, zap.Error(err), zap.String("category", core.ErrorCategory(err)))
 	} else {
 		msg = "success"
 	}
@@ -147,11 +365,49 @@ func reqLog(servConf *ServConfig, res *core.Result, err error) {
 	servConf.zlog.Info(msg, fields...)
 }
 
+// auditLog records every request made by an admin as another
+// user, it's logged whatever the log level
+func auditLog(servConf *ServConfig, ct context.Context, admin string, fields ...zapcore.Field) {
+	fields = append([]zapcore.Field{
+		zap.String("admin", admin),
+		zap.Any("user_id", ct.Value(core.UserIDKey)),
+	}, fields...)
+
+	servConf.zlog.Warn("impersonation", fields...)
+}
+
 //nolint: errcheck
 func renderErr(w http.ResponseWriter, err error) {
-	if err == errUnauthorized {
+	switch err {
+	case errUnauthorized:
 		w.WriteHeader(http.StatusUnauthorized)
+	case errNotReady:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case core.ErrRateLimited:
+		w.WriteHeader(http.StatusTooManyRequests)
+	case errIdemInProgress:
+		w.WriteHeader(http.StatusConflict)
+	case errIdemMismatch:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	case errInternal:
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		switch core.ErrorCode(err) {
+		case core.ErrCodeQuotaExceeded:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case core.ErrCodeQueryTimeout:
+			w.WriteHeader(http.StatusGatewayTimeout)
+		}
 	}
 
-	json.NewEncoder(w).Encode(errorResp{err.Error()})
+	json.NewEncoder(w).Encode(errResp(err))
+}
+
+// errResp returns the response body for the error
+func errResp(err error) interface{} {
+	return errorResp{
+		Error:  err.Error(),
+		Code:   core.ErrorCode(err),
+		Errors: core.GraphQLErrors(err),
+	}
 }
@@ -0,0 +1,55 @@
+package serv
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/dosco/super-graph/core"
+	"github.com/dosco/super-graph/internal/serv/internal/auth"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestStreamAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sg-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	setUploadsGraph(t, dir)
+
+	zc, logs := observer.New(zap.InfoLevel)
+	servConf := &ServConfig{
+		log:  log.New(ioutil.Discard, "", 0),
+		zlog: zap.New(zc),
+		conf: &Config{},
+	}
+
+	var ac auth.Auth
+	ac.Impersonate.Admins = []string{"1"}
+
+	h, err := auth.ImpersonateHandler(&ac, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := gqlReq{Query: `query { documents { id } }`}
+		streamReq(servConf, w, r.Context(), &req)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("X-Impersonate-User-ID", "2")
+	r = r.WithContext(context.WithValue(r.Context(), core.UserIDKey, "1"))
+
+	h(httptest.NewRecorder(), r)
+
+	// streamed requests are audited like the others
+	if n := logs.FilterMessage("impersonation").Len(); n != 1 {
+		t.Fatalf("expected an audit log of the streamed request, got %d", n)
+	}
+}
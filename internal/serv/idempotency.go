@@ -0,0 +1,159 @@
+package serv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dosco/super-graph/core"
+)
+
+const (
+	idempotencyHeader   = "Idempotency-Key"
+	idempotencyReplayed = "Idempotent-Replayed"
+	idempotencyKey      = "idem:"
+	defaultIdemTTL      = 24 * time.Hour
+)
+
+var (
+	errIdemInProgress = errors.New("a request with this idempotency key is in progress")
+	errIdemMismatch   = errors.New("the idempotency key was used with a different request")
+)
+
+// idemEntry is the request saved for an idempotency key, the
+// response is set once the mutation is done
+type idemEntry struct {
+	Hash string          `json:"hash"`
+	Done bool            `json:"done"`
+	Res  json.RawMessage `json:"res,omitempty"`
+}
+
+// wantsIdempotency returns the idempotency key of the request when
+// it's a mutation and the idempotency keys are enabled. Dry runs are
+// rolled back so their response is never kept for the key
+func wantsIdempotency(servConf *ServConfig, r *http.Request, req *gqlReq) string {
+	if !servConf.conf.Idempotency.Enable || wantsDryRun(req.Extensions) {
+		return ""
+	}
+
+	if core.Operation(req.Query) != core.OpMutation {
+		return ""
+	}
+	return r.Header.Get(idempotencyHeader)
+}
+
+// idempotentReq runs the mutation once for the idempotency key, the response
+// is kept in the storage and sent again to the retries of the request. The key
+// is dropped when the mutation fails so the request can be retried
+func idempotentReq(servConf *ServConfig, w http.ResponseWriter, ct context.Context, key string, req *gqlReq) {
+	kv := graph().KVStore()
+
+	ttl := servConf.conf.Idempotency.TTL
+	if ttl <= 0 {
+		ttl = defaultIdemTTL
+	}
+
+	k := idemStoreKey(ct, key)
+	e := idemEntry{Hash: idemReqHash(req)}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		renderErr(w, err)
+		return
+	}
+
+	added, err := kv.Add(ct, k, b, ttl)
+	if err != nil {
+		renderErr(w, fmt.Errorf("idempotency: %w", err))
+		return
+	}
+
+	if !added {
+		replayIdemReq(ct, w, kv, k, e.Hash)
+		return
+	}
+
+	res, err := execReq(servConf, ct, req)
+	if err != nil {
+		if err1 := kv.Delete(ct, k); err1 != nil {
+			servConf.log.Printf("ERR idempotency: %s", err1)
+		}
+		renderErr(w, err)
+		return
+	}
+
+	if e.Res, err = json.Marshal(res); err != nil {
+		renderErr(w, err)
+		return
+	}
+	e.Done = true
+
+	if b, err = json.Marshal(e); err == nil {
+		err = kv.Set(ct, k, b, ttl)
+	}
+
+	if err != nil {
+		servConf.log.Printf("ERR idempotency: %s", err)
+	}
+
+	w.Write(e.Res) //nolint: errcheck
+}
+
+// replayIdemReq sends back the saved response of the idempotency key
+func replayIdemReq(ct context.Context, w http.ResponseWriter, kv core.KVStore, k, hash string) {
+	var e idemEntry
+
+	b, err := kv.Get(ct, k)
+	if err != nil {
+		renderErr(w, fmt.Errorf("idempotency: %w", err))
+		return
+	}
+
+	// the key expired since it was added
+	if b == nil {
+		renderErr(w, errIdemInProgress)
+		return
+	}
+
+	if err := json.Unmarshal(b, &e); err != nil {
+		renderErr(w, fmt.Errorf("idempotency: %w", err))
+		return
+	}
+
+	switch {
+	case e.Hash != hash:
+		renderErr(w, errIdemMismatch)
+
+	case !e.Done:
+		renderErr(w, errIdemInProgress)
+
+	default:
+		w.Header().Set(idempotencyReplayed, "true")
+		w.Write(e.Res) //nolint: errcheck
+	}
+}
+
+// idemStoreKey returns the key in the storage, it has the user
+// so users can't see the responses of each others keys
+func idemStoreKey(ct context.Context, key string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%v\x00%s", ct.Value(core.UserIDKey), key)
+	return idempotencyKey + hex.EncodeToString(h.Sum(nil))
+}
+
+// idemReqHash returns the hash of the query, operation name and variables
+// of the request to catch a key used again for a different request
+func idemReqHash(req *gqlReq) string {
+	h := sha256.New()
+	h.Write([]byte(req.Query))  //nolint: errcheck
+	h.Write([]byte{0})          //nolint: errcheck
+	h.Write([]byte(req.OpName)) //nolint: errcheck
+	h.Write([]byte{0})          //nolint: errcheck
+	h.Write(req.Vars)           //nolint: errcheck
+	return hex.EncodeToString(h.Sum(nil))
+}
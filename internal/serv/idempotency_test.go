@@ -0,0 +1,86 @@
+package serv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dosco/super-graph/core"
+)
+
+func TestWantsIdempotency(t *testing.T) {
+	servConf := &ServConfig{conf: &Config{}}
+
+	r := httptest.NewRequest("POST", "/api/v1/graphql", nil)
+	r.Header.Set(idempotencyHeader, "k1")
+
+	mut := &gqlReq{Query: `mutation { products(insert: $data) { id } }`}
+
+	if key := wantsIdempotency(servConf, r, mut); key != "" {
+		t.Fatal("expected no key when idempotency is not enabled")
+	}
+
+	servConf.conf.Idempotency.Enable = true
+
+	if key := wantsIdempotency(servConf, r, mut); key != "k1" {
+		t.Fatalf("expected the key got '%s'", key)
+	}
+
+	if key := wantsIdempotency(servConf, r, &gqlReq{Query: `query { products { id } }`}); key != "" {
+		t.Fatal("expected no key for a query")
+	}
+
+	dry := *mut
+	dry.Extensions = json.RawMessage(`{"dry_run": true}`)
+
+	if key := wantsIdempotency(servConf, r, &dry); key != "" {
+		t.Fatal("expected no key for a dry run")
+	}
+}
+
+func TestReplayIdemReq(t *testing.T) {
+	ct := context.WithValue(context.Background(), core.UserIDKey, 1)
+	kv := core.NewMemoryKVStore()
+
+	req := &gqlReq{Query: `mutation { products(insert: $data) { id } }`}
+	hash := idemReqHash(req)
+	k := idemStoreKey(ct, "k1")
+
+	if hash == idemReqHash(&gqlReq{Query: req.Query, OpName: "other"}) {
+		t.Fatal("expected the operation name in the hash")
+	}
+
+	if k == idemStoreKey(context.WithValue(ct, core.UserIDKey, 2), "k1") {
+		t.Fatal("expected the keys of users to differ")
+	}
+
+	b, _ := json.Marshal(idemEntry{Hash: hash})
+	_ = kv.Set(ct, k, b, time.Minute)
+
+	w := httptest.NewRecorder()
+	replayIdemReq(ct, w, kv, k, hash)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected a conflict while in progress got %d", w.Code)
+	}
+
+	b, _ = json.Marshal(idemEntry{Hash: hash, Done: true, Res: json.RawMessage(`{"data":{}}`)})
+	_ = kv.Set(ct, k, b, time.Minute)
+
+	w = httptest.NewRecorder()
+	replayIdemReq(ct, w, kv, k, hash)
+
+	if w.Body.String() != `{"data":{}}` || w.Header().Get(idempotencyReplayed) != "true" {
+		t.Fatalf("expected the saved response got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	replayIdemReq(ct, w, kv, k, "other")
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected a mismatch for a different request got %d", w.Code)
+	}
+}
@@ -50,6 +50,15 @@ func initConf(servConfig *ServConfig) (*Config, error) {
 		c.DB.Schema = c.DBSchema
 	}
 
+	// retry queries on database failover using max_retries
+	if c.FailoverRetries == 0 {
+		c.FailoverRetries = c.DB.MaxRetries
+	}
+
+	if p := c.Canary.Percent; p < 0 || p > 100 {
+		return nil, fmt.Errorf("canary: percent must be from 0 to 100, got %d", p)
+	}
+
 	// set default database schema
 	if c.DB.Schema == "" {
 		c.DB.Schema = "public"
@@ -106,6 +115,18 @@ func initConf(servConfig *ServConfig) (*Config, error) {
 		c.AllowListFile = c.relPath("./allow.list")
 	}
 
+	if c.MockData != "" {
+		c.MockData = c.relPath(c.MockData)
+	}
+
+	if c.QueryRegistry != "" {
+		c.QueryRegistry = c.relPath(c.QueryRegistry)
+	}
+
+	if c.Storage.Path != "" {
+		c.Storage.Path = c.relPath(c.Storage.Path)
+	}
+
 	if c.Production {
 		c.UseAllowList = true
 	} else {
@@ -116,13 +137,20 @@ func initConf(servConfig *ServConfig) (*Config, error) {
 }
 
 func initDB(servConfig *ServConfig, useDB, useTelemetry bool) (*sql.DB, error) {
+	c := servConfig.conf
+	return initDBHost(servConfig, c.DB.Host, c.DB.Port, useDB, useTelemetry)
+}
+
+// initDBHost opens a connection pool to the database on the host, it's used
+// for both the primary database and the read replicas
+func initDBHost(servConfig *ServConfig, host string, port uint16, useDB, useTelemetry bool) (*sql.DB, error) {
 	var db *sql.DB
 	var err error
 	c := servConfig.conf
 
 	config, _ := pgx.ParseConfig("")
-	config.Host = c.DB.Host
-	config.Port = c.DB.Port
+	config.Host = host
+	config.Port = port
 	config.User = c.DB.User
 	config.Password = c.DB.Password
 	config.RuntimeParams = map[string]string{
@@ -130,6 +158,11 @@ func initDB(servConfig *ServConfig, useDB, useTelemetry bool) (*sql.DB, error) {
 		"search_path":      c.DB.Schema,
 	}
 
+	// the database rejects any write even if the user can write
+	if servConfig.readOnly {
+		config.RuntimeParams["default_transaction_read_only"] = "on"
+	}
+
 	if useDB {
 		config.Database = c.DB.DBName
 	}
@@ -236,16 +269,6 @@ func initDB(servConfig *ServConfig, useDB, useTelemetry bool) (*sql.DB, error) {
 		}
 		ocsql.RegisterAllViews()
 
-		var interval time.Duration
-
-		if servConfig.conf.Telemetry.Interval != nil {
-			interval = *servConfig.conf.Telemetry.Interval
-		} else {
-			interval = 5 * time.Second
-		}
-
-		defer ocsql.RecordStats(db, interval)()
-
 		servConfig.log.Println("INF OpenCensus telemetry enabled")
 	}
 
@@ -262,5 +285,19 @@ func initDB(servConfig *ServConfig, useDB, useTelemetry bool) (*sql.DB, error) {
 		return nil, fmt.Errorf("unable to open db connection: %v", err)
 	}
 
+	if n := servConfig.conf.MaxIdleConns; n != 0 {
+		db.SetMaxIdleConns(n)
+	}
+
+	// the connection pool stats are recorded for as long as the pool is open
+	if useTelemetry && servConfig.conf.telemetryEnabled() {
+		interval := 5 * time.Second
+
+		if servConfig.conf.Telemetry.Interval != nil {
+			interval = *servConfig.conf.Telemetry.Interval
+		}
+		ocsql.RecordStats(db, interval)
+	}
+
 	return db, nil
 }
@@ -0,0 +1,99 @@
+package serv
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dosco/super-graph/core"
+)
+
+type ctxKey int
+
+// internalReqKey is set on the context of the requests
+// that came in on the internal endpoint
+const internalReqKey ctxKey = iota
+
+var errSQLFragments = errors.New("sql extension only allowed on the internal endpoint")
+
+// startInternal starts the internal endpoint, it serves the api for trusted
+// services that can add sql fragments to their queries (extensions.sql)
+func startInternal(servConf *ServConfig) {
+	conf := servConf.conf.Internal
+
+	var ln net.Listener
+	var err error
+
+	// a unix socket is guarded by its file permissions, on a
+	// host and port the token is required
+	if conf.Socket != "" {
+		ln, err = listenUnix(conf.Socket)
+	} else if conf.Token == "" {
+		servConf.log.Printf("ERR internal: a token is required, internal api not started")
+		return
+	} else {
+		ln, err = net.Listen("tcp", conf.HostPort)
+	}
+
+	if err != nil {
+		servConf.log.Printf("ERR internal: %s", err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(apiRoute, internalAuth(conf.Token, apiV1Handler(servConf)))
+
+	srv := &http.Server{Handler: mux}
+
+	servConf.log.Printf("INF internal api started, listening on: %s", ln.Addr())
+
+	if err := srv.Serve(ln); err != http.ErrServerClosed {
+		servConf.log.Printf("ERR internal: %s", err)
+	}
+}
+
+// internalAuth checks the token if one is set and marks the
+// request as coming in on the internal endpoint
+func internalAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			t := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+			if subtle.ConstantTimeCompare([]byte(t), []byte(token)) != 1 {
+				w.Header().Set("Content-Type", "application/json")
+				renderErr(w, errUnauthorized)
+				return
+			}
+		}
+
+		ct := context.WithValue(r.Context(), internalReqKey, true)
+		next.ServeHTTP(w, r.WithContext(ct))
+	})
+}
+
+func isInternalReq(ct context.Context) bool {
+	v, _ := ct.Value(internalReqKey).(bool)
+	return v
+}
+
+// sqlFragments returns the sql fragments of a request ({"sql": {"hint": "..",
+// "where": {"products": ".."}}} in the extensions), these are only allowed
+// on the internal endpoint
+func sqlFragments(ct context.Context, ext json.RawMessage) (*core.SQLFragments, error) {
+	var e struct {
+		SQL *core.SQLFragments `json:"sql"`
+	}
+
+	if len(ext) == 0 || json.Unmarshal(ext, &e) != nil || e.SQL == nil {
+		return nil, nil
+	}
+
+	if !isInternalReq(ct) {
+		return nil, errSQLFragments
+	}
+	return e.SQL, nil
+}
@@ -33,6 +33,18 @@ type Auth struct {
 		PubKeyFile string `mapstructure:"public_key_file"`
 		PubKeyType string `mapstructure:"public_key_type"`
 		Audience   string `mapstructure:"audience"`
+		Issuer     string
+
+		// JWKSURL is the key set used to validate tokens, the keys
+		// are fetched again every JWKSRefresh minutes (default 60)
+		JWKSURL     string `mapstructure:"jwks_url"`
+		JWKSRefresh int    `mapstructure:"jwks_refresh"`
+
+		// RoleClaim is the claim with the role of the user
+		RoleClaim string `mapstructure:"role_claim"`
+
+		// Claims maps variables (eg. $org_id) to the claims they are set from
+		Claims map[string]string
 	}
 
 	Header struct {
@@ -40,6 +52,11 @@ type Auth struct {
 		Value  string
 		Exists bool
 	}
+
+	Impersonate struct {
+		// Admins are the ids of the users allowed to impersonate others
+		Admins []string
+	}
 }
 
 func SimpleHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
@@ -100,6 +117,15 @@ func HeaderHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
 func WithAuth(next http.Handler, ac *Auth) (http.Handler, error) {
 	var err error
 
+	// impersonation is checked after the admin is authenticated
+	if len(ac.Impersonate.Admins) != 0 {
+		next, err = ImpersonateHandler(ac, next)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
 	if ac.CredsInHeader {
 		next, err = SimpleHandler(ac, next)
 	}
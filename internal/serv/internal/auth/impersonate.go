@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/dosco/super-graph/core"
+)
+
+type contextkey int
+
+const (
+	impersonatorKey contextkey = iota
+)
+
+// ImpersonateHandler lets the users listed as admins run a request as another
+// user or role by setting the X-Impersonate-User-ID and X-Impersonate-Role
+// headers. The id of the admin is kept in the context for the audit log.
+func ImpersonateHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
+	admins := make(map[string]struct{}, len(ac.Impersonate.Admins))
+
+	for _, v := range ac.Impersonate.Admins {
+		admins[v] = struct{}{}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Header.Get("X-Impersonate-User-ID")
+		userRole := r.Header.Get("X-Impersonate-Role")
+
+		if userID == "" && userRole == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		admin := ctx.Value(core.UserIDKey)
+
+		if admin == nil {
+			http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		adminID := fmt.Sprintf("%v", admin)
+
+		if _, ok := admins[adminID]; !ok {
+			http.Error(w, "403 forbidden", http.StatusForbidden)
+			return
+		}
+
+		// nothing of the admin is left in the context so the
+		// request sees exactly what the impersonated user does
+		ctx = context.WithValue(ctx, core.UserIDProviderKey, nil)
+		ctx = context.WithValue(ctx, core.UserIDKey, nil)
+		ctx = context.WithValue(ctx, core.UserRoleKey, nil)
+		ctx = context.WithValue(ctx, core.UserClaimsKey, nil)
+
+		if userID != "" {
+			ctx = context.WithValue(ctx, core.UserIDKey, userID)
+		}
+
+		if userRole != "" {
+			ctx = context.WithValue(ctx, core.UserRoleKey, userRole)
+		}
+
+		ctx = context.WithValue(ctx, impersonatorKey, adminID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}, nil
+}
+
+// Impersonator returns the id of the admin impersonating
+// the user of the request if any
+func Impersonator(ct context.Context) (string, bool) {
+	v, ok := ct.Value(impersonatorKey).(string)
+	return v, ok
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	defaultJWKSRefresh = time.Hour
+
+	// jwksMinRefresh limits how often a token with an
+	// unknown key id can trigger a fetch of the keys
+	jwksMinRefresh = time.Minute
+)
+
+// jwks fetches the public keys of a JSON Web Key Set (eg. Auth0's
+// https://<tenant>/.well-known/jwks.json) and keeps them by key id, the
+// keys are fetched again after the refresh interval or when a token is
+// signed with a key not seen before so rotated keys are picked up
+type jwks struct {
+	sync.Mutex
+	url     string
+	refresh time.Duration
+	client  *http.Client
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func newJWKS(url string, refresh time.Duration) *jwks {
+	if refresh <= 0 {
+		refresh = defaultJWKSRefresh
+	}
+
+	return &jwks{
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (ks *jwks) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	ks.Lock()
+	defer ks.Unlock()
+
+	key, ok := ks.keys[kid]
+
+	stale := time.Since(ks.fetched) > ks.refresh
+	retry := !ok && time.Since(ks.fetched) > jwksMinRefresh
+
+	if stale || retry {
+		if err := ks.fetch(); err != nil {
+			// the old keys are used till the next fetch works
+			if !ok {
+				return nil, err
+			}
+		}
+		key, ok = ks.keys[kid]
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("jwks: no key found for kid '%s'", kid)
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("jwks: unexpected signing method %s", token.Method.Alg())
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, fmt.Errorf("jwks: unexpected signing method %s", token.Method.Alg())
+		}
+	}
+
+	return key, nil
+}
+
+func (ks *jwks) fetch() error {
+	ks.fetched = time.Now()
+
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks: %s returned %s", ks.url, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(b, &set); err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		// keys that can't be parsed are skipped so one
+		// bad key does not break the others
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return errors.New("jwks: no signing keys found")
+	}
+
+	ks.keys = keys
+	return nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("jwks: unsupported curve %s", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("jwks: unsupported key type %s", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
@@ -30,6 +31,7 @@ var firebasePublicKeys firebasePKCache
 
 func JwtHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
 	var key interface{}
+	var ks *jwks
 	var jwtProvider int
 
 	cookie := ac.Cookie
@@ -42,6 +44,13 @@ func JwtHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
 
 	secret := ac.JWT.Secret
 	publicKeyFile := ac.JWT.PubKeyFile
+	jwksURL := ac.JWT.JWKSURL
+
+	// auth0 publishes the keys of a tenant at a well known path of the issuer
+	if jwksURL == "" && secret == "" && publicKeyFile == "" &&
+		jwtProvider == jwtAuth0 && ac.JWT.Issuer != "" {
+		jwksURL = strings.TrimSuffix(ac.JWT.Issuer, "/") + "/.well-known/jwks.json"
+	}
 
 	switch {
 	case secret != "":
@@ -68,9 +77,44 @@ func JwtHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
 		if err != nil {
 			return nil, err
 		}
+
+	case jwksURL != "":
+		ks = newJWKS(jwksURL, time.Duration(ac.JWT.JWKSRefresh)*time.Minute)
+
+	case jwtProvider != jwtFirebase:
+		return nil, fmt.Errorf("auth '%s': jwt: no secret, public_key_file or jwks_url defined", ac.Name)
+	}
+
+	var keyFunc jwt.Keyfunc
+
+	switch {
+	case jwtProvider == jwtFirebase:
+		keyFunc = firebaseKeyFunction
+
+	case ks != nil:
+		keyFunc = ks.keyFunc
+
+	default:
+		keyFunc = func(token *jwt.Token) (interface{}, error) {
+			return key, nil
+		}
+	}
+
+	// the claims are set to nil for requests without a token so
+	// they're never taken from the request variables
+	var noClaims map[string]interface{}
+
+	if len(ac.JWT.Claims) != 0 {
+		noClaims = make(map[string]interface{}, len(ac.JWT.Claims))
+		for name := range ac.JWT.Claims {
+			noClaims[name] = nil
+		}
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
+		if noClaims != nil {
+			r = r.WithContext(context.WithValue(r.Context(), core.UserClaimsKey, noClaims))
+		}
 
 		var tok string
 
@@ -90,51 +134,108 @@ func JwtHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
 			tok = ah[7:]
 		}
 
-		var keyFunc jwt.Keyfunc
-		if jwtProvider == jwtFirebase {
-			keyFunc = firebaseKeyFunction
-		} else {
-			keyFunc = func(token *jwt.Token) (interface{}, error) {
-				return key, nil
-			}
+		token, err := jwt.Parse(tok, keyFunc)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
 		}
 
-		token, err := jwt.ParseWithClaims(tok, &jwt.StandardClaims{}, keyFunc)
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		if err != nil {
+		if ac.JWT.Audience != "" && !hasAudience(claims, ac.JWT.Audience) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ac.JWT.Issuer != "" && !claims.VerifyIssuer(ac.JWT.Issuer, true) {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		if claims, ok := token.Claims.(*jwt.StandardClaims); ok {
-			ctx := r.Context()
+		ctx := r.Context()
+		subject, _ := claims["sub"].(string)
 
-			if ac.JWT.Audience != "" && claims.Audience != ac.JWT.Audience {
-				next.ServeHTTP(w, r)
-				return
+		switch jwtProvider {
+		case jwtAuth0:
+			if sub := strings.SplitN(subject, "|", 2); len(sub) == 2 {
+				ctx = context.WithValue(ctx, core.UserIDProviderKey, sub[0])
+				ctx = context.WithValue(ctx, core.UserIDKey, sub[1])
+			} else if subject != "" {
+				ctx = context.WithValue(ctx, core.UserIDKey, subject)
 			}
 
-			if jwtProvider == jwtAuth0 {
-				sub := strings.Split(claims.Subject, "|")
-				if len(sub) != 2 {
-					ctx = context.WithValue(ctx, core.UserIDProviderKey, sub[0])
-					ctx = context.WithValue(ctx, core.UserIDKey, sub[1])
-				}
-			} else if jwtProvider == jwtFirebase &&
-				claims.Issuer == firebaseIssuerPrefix+ac.JWT.Audience {
-				ctx = context.WithValue(ctx, core.UserIDKey, claims.Subject)
-			} else {
-				ctx = context.WithValue(ctx, core.UserIDKey, claims.Subject)
+		case jwtFirebase:
+			if claims.VerifyIssuer(firebaseIssuerPrefix+ac.JWT.Audience, true) {
+				ctx = context.WithValue(ctx, core.UserIDKey, subject)
 			}
 
-			next.ServeHTTP(w, r.WithContext(ctx))
-			return
+		default:
+			if subject != "" {
+				ctx = context.WithValue(ctx, core.UserIDKey, subject)
+			}
+		}
+
+		if ac.JWT.RoleClaim != "" {
+			if v, ok := claimValue(claims, ac.JWT.RoleClaim).(string); ok && v != "" {
+				ctx = context.WithValue(ctx, core.UserRoleKey, v)
+			}
 		}
 
-		next.ServeHTTP(w, r)
+		if len(ac.JWT.Claims) != 0 {
+			vars := make(map[string]interface{}, len(ac.JWT.Claims))
+
+			// a missing claim is nil so the variable is not set
+			for name, c := range ac.JWT.Claims {
+				vars[name] = claimValue(claims, c)
+			}
+			ctx = context.WithValue(ctx, core.UserClaimsKey, vars)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
 	}, nil
 }
 
+// hasAudience checks the aud claim which can be a string or a list
+func hasAudience(claims jwt.MapClaims, aud string) bool {
+	switch v := claims["aud"].(type) {
+	case string:
+		return v == aud
+
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == aud {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// claimValue returns the claim with the name, when there is no such claim the
+// name is used as a path of nested claims (eg. app_metadata.org_id)
+func claimValue(claims jwt.MapClaims, name string) interface{} {
+	if v, ok := claims[name]; ok {
+		return v
+	}
+
+	var v interface{} = map[string]interface{}(claims)
+
+	for _, k := range strings.Split(name, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+
+	return v
+}
+
 type firebaseKeyError struct {
 	Err     error
 	Message string
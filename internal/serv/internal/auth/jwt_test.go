@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dosco/super-graph/core"
+)
+
+func TestJwtClaims(t *testing.T) {
+	var ac Auth
+	ac.JWT.Secret = "secret"
+	ac.JWT.Audience = "app"
+	ac.JWT.Issuer = "https://auth.example.com/"
+	ac.JWT.RoleClaim = "https://example.com/role"
+	ac.JWT.Claims = map[string]string{"org_id": "app_metadata.org_id"}
+
+	var ctx context.Context
+
+	h, err := JwtHandler(&ac, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":                      "5",
+		"aud":                      []string{"other", "app"},
+		"iss":                      "https://auth.example.com/",
+		"exp":                      time.Now().Add(time.Hour).Unix(),
+		"https://example.com/role": "admin",
+		"app_metadata":             map[string]interface{}{"org_id": 7},
+	})
+
+	serve := func(claims jwt.Claims, key interface{}) {
+		ctx = nil
+
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+s)
+		h(httptest.NewRecorder(), r)
+	}
+
+	serve(tok.Claims, []byte("secret"))
+
+	if ctx.Value(core.UserIDKey) != "5" || ctx.Value(core.UserRoleKey) != "admin" {
+		t.Fatalf("unexpected user: %v %v", ctx.Value(core.UserIDKey), ctx.Value(core.UserRoleKey))
+	}
+
+	if v := ctx.Value(core.UserClaimsKey).(map[string]interface{}); v["org_id"] != float64(7) {
+		t.Fatalf("unexpected claims: %v", v)
+	}
+
+	// wrong key, audience, issuer or an expired token are not authenticated
+	bad := []jwt.MapClaims{
+		{"sub": "5", "aud": "other", "iss": "https://auth.example.com/"},
+		{"sub": "5", "aud": "app", "iss": "https://evil.example.com/"},
+		{"sub": "5", "aud": "app", "iss": "https://auth.example.com/", "exp": time.Now().Add(-time.Hour).Unix()},
+	}
+
+	serve(tok.Claims, []byte("wrong"))
+
+	if ctx.Value(core.UserIDKey) != nil {
+		t.Fatal("expected no user for the wrong key")
+	}
+
+	for _, c := range bad {
+		serve(c, []byte("secret"))
+
+		if ctx.Value(core.UserIDKey) != nil {
+			t.Fatalf("expected no user: %v", c)
+		}
+	}
+
+	// claims not in the token or without a token are nil
+	serve(jwt.MapClaims{"sub": "5", "aud": "app", "iss": "https://auth.example.com/"}, []byte("secret"))
+
+	if v, ok := ctx.Value(core.UserClaimsKey).(map[string]interface{}); !ok || v["org_id"] != nil {
+		t.Fatalf("expected a nil claim: %v", v)
+	} else if _, ok := v["org_id"]; !ok {
+		t.Fatal("expected the missing claim to be set")
+	}
+
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if v, ok := ctx.Value(core.UserClaimsKey).(map[string]interface{}); !ok || len(v) != 1 || v["org_id"] != nil {
+		t.Fatalf("expected a nil claim without a token: %v", v)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys := map[string]*rsa.PrivateKey{"k1": newRSAKey(t)}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var set struct {
+			Keys []jwk `json:"keys"`
+		}
+
+		for kid, k := range keys {
+			set.Keys = append(set.Keys, jwk{
+				Kid: kid,
+				Kty: "RSA",
+				N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(set) //nolint: errcheck
+	}))
+	defer srv.Close()
+
+	ks := newJWKS(srv.URL, 0)
+
+	parse := func(kid string, key *rsa.PrivateKey) error {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "5"})
+		tok.Header["kid"] = kid
+
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = jwt.Parse(s, ks.keyFunc)
+		return err
+	}
+
+	if err := parse("k1", keys["k1"]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the key is rotated
+	keys = map[string]*rsa.PrivateKey{"k2": newRSAKey(t)}
+
+	// an unknown kid only fetches the keys again after a while
+	if err := parse("k2", keys["k2"]); err == nil {
+		t.Fatal("expected an error for an unknown kid")
+	}
+
+	ks.fetched = time.Now().Add(-2 * jwksMinRefresh)
+
+	if err := parse("k2", keys["k2"]); err != nil {
+		t.Fatal(err)
+	}
+
+	// HMAC signed with the public key is not accepted
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "5"})
+	tok.Header["kid"] = "k2"
+
+	s, err := tok.SignedString(keys["k2"].N.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := jwt.Parse(s, ks.keyFunc); err == nil {
+		t.Fatal("expected an error for the wrong signing method")
+	}
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
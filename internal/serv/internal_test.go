@@ -0,0 +1,53 @@
+package serv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInternalSQLFragments(t *testing.T) {
+	ext := json.RawMessage(`{"sql": {"hint": "SeqScan(products)", "where": {"products": "price > 10"}}}`)
+
+	if _, err := sqlFragments(context.Background(), ext); err != errSQLFragments {
+		t.Fatalf("expected the sql extension to be rejected got: %v", err)
+	}
+
+	if sf, err := sqlFragments(context.Background(), json.RawMessage(`{"normalize": true}`)); sf != nil || err != nil {
+		t.Fatalf("expected no sql fragments got: %v, %v", sf, err)
+	}
+
+	h := internalAuth("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sf, err := sqlFragments(r.Context(), ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sf.Hint != "SeqScan(products)" || sf.Where["products"] != "price > 10" {
+			t.Fatalf("unexpected sql fragments: %+v", sf)
+		}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for _, tt := range []struct {
+		auth string
+		code int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusTeapot},
+	} {
+		r := httptest.NewRequest("POST", apiRoute, nil)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("(%s): expected %d got %d", tt.auth, tt.code, w.Code)
+		}
+	}
+}
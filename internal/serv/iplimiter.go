@@ -1,11 +1,14 @@
 package serv
 
 import (
+	"context"
 	"errors"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/dosco/super-graph/core"
 	cache "github.com/go-pkgz/expirable-cache"
 	"golang.org/x/time/rate"
 )
@@ -28,6 +31,35 @@ func getIPLimiter(ip string) *rate.Limiter {
 	return v.(*rate.Limiter)
 }
 
+// allowIP returns true if the ip is within its rate limit, the limit is kept
+// in the storage when it's shared by the instances else in this instance
+func allowIP(servConf *ServConfig, ct context.Context, ip string) bool {
+	if !servConf.conf.sharedStorage() || !isReady() {
+		return getIPLimiter(ip).Allow()
+	}
+
+	rl := &servConf.conf.RateLimiter
+
+	// a fixed window of the time the bucket takes to fill up (at
+	// least a second), the ip gets rate requests a second in it
+	w := time.Duration(float64(rl.Bucket) / rl.Rate * float64(time.Second))
+	if w < time.Second {
+		w = time.Second
+	}
+	max := int64(rl.Rate * w.Seconds())
+
+	key := "rate:" + ip + ":" + strconv.FormatInt(time.Now().UnixNano()/int64(w), 10)
+
+	n, err := graph().KVStore().Incr(ct, key, w)
+	if err != nil {
+		// the requests are let through when the storage is down
+		servConf.log.Printf("ERR rate limiter: %s", err)
+		return true
+	}
+
+	return n <= max
+}
+
 func limit(servConf *ServConfig, w http.ResponseWriter, r *http.Request) error {
 	// X-Remote-Address is used when super graph configure behind load balancer
 	remoteAddr := r.Header.Get("X-Remote-Address")
@@ -42,8 +74,9 @@ func limit(servConf *ServConfig, w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
-	if !getIPLimiter(remoteAddr).Allow() {
-		http.Error(w, "429 Too Many Requests", http.StatusTooManyRequests)
+	if !allowIP(servConf, r.Context(), remoteAddr) {
+		w.Header().Set("Content-Type", "application/json")
+		renderErr(w, core.ErrRateLimited)
 		return errors.New("StatusTooManyRequests")
 	}
 	return nil
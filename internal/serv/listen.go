@@ -0,0 +1,94 @@
+package serv
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd
+const listenFdsStart = 3
+
+// listen returns the listener for the http server. A socket handed over
+// by the process being upgraded or passed by systemd (socket activation)
+// is used first, then the unix socket if one is set in the config and
+// finally the host and port.
+func listen(servConf *ServConfig) (net.Listener, string, error) {
+	ln, err := upgradeListener()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if ln != nil {
+		return ln, "upgrade:" + ln.Addr().String(), nil
+	}
+
+	ln, err = systemdListener()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if ln != nil {
+		return ln, "systemd:" + ln.Addr().String(), nil
+	}
+
+	if sock := servConf.conf.Socket; sock != "" {
+		ln, err := listenUnix(sock)
+		if err != nil {
+			return nil, "", err
+		}
+		return ln, "unix:" + sock, nil
+	}
+
+	ln, err = net.Listen("tcp", servConf.conf.hostPort)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return ln, servConf.conf.hostPort, nil
+}
+
+// systemdListener returns the first socket passed by systemd if the
+// process was started by socket activation
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+
+	// the variables are not meant for child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(listenFdsStart), "systemd-listen")
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket: %w", err)
+	}
+
+	return ln, nil
+}
+
+// listenUnix listens on the unix socket, a socket file left behind
+// by an earlier run is removed first
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("socket: %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("socket: %w", err)
+		}
+	}
+
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,53 @@
+package serv
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sg-listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "sg.sock")
+	servConf := &ServConfig{conf: &Config{}}
+	servConf.conf.Socket = sock
+
+	// a socket file left behind is replaced
+	for i := 0; i < 2; i++ {
+		ln, addr, err := listen(servConf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if addr != "unix:"+sock {
+			t.Fatalf("unexpected address: %s", addr)
+		}
+
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+
+		// keep the socket file like a crashed process would
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+		ln.Close()
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	servConf.conf.Socket = file
+
+	if _, _, err := listen(servConf); err == nil {
+		t.Fatal("expected an error for a file that's not a socket")
+	}
+}
@@ -0,0 +1,116 @@
+package serv
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/dosco/super-graph/core"
+)
+
+const (
+	minConnectDelay = 500 * time.Millisecond
+	maxConnectDelay = 30 * time.Second
+)
+
+var (
+	errNotReady = errors.New("not ready: waiting for database")
+
+	// ready is set once the database is reachable and Super Graph is initialized
+	ready int32
+)
+
+func isReady() bool {
+	return atomic.LoadInt32(&ready) == 1
+}
+
+// initSuperGraph creates the Super Graph instance and marks the service as ready
+func initSuperGraph(servConf *ServConfig) error {
+	var err error
+
+	sg, err = core.NewSuperGraph(&servConf.conf.Core, servConf.db)
+	if err != nil {
+		return err
+	}
+
+	if len(servConf.conf.DB.Replicas) != 0 {
+		servConf.router, err = initDBRouter(servConf)
+		if err != nil {
+			return err
+		}
+		sg.SetDBRouter(servConf.router.route)
+		go servConf.router.probe(servConf)
+	}
+
+	if len(servConf.conf.DB.Roles) != 0 {
+		if err := initRoleDBs(servConf); err != nil {
+			return err
+		}
+		if err := setRoleDBs(servConf, sg); err != nil {
+			return err
+		}
+	}
+
+	if servConf.conf.DB.Shadow.Host != "" {
+		if err := initShadow(servConf, sg); err != nil {
+			return err
+		}
+	}
+
+	if len(servConf.conf.Databases) != 0 {
+		if err := initDatabases(servConf); err != nil {
+			return err
+		}
+		if err := attachDatabases(servConf, sg); err != nil {
+			return err
+		}
+	}
+
+	if err := initSchedules(servConf); err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&ready, 1)
+	return nil
+}
+
+// waitForDB pings the database with an exponential backoff and initializes
+// Super Graph once it's reachable. It allows the service to start before the
+// database is up (eg. docker-compose).
+func waitForDB(servConf *ServConfig) {
+	d := minConnectDelay
+
+	for {
+		err := pingDB(servConf)
+		if err == nil {
+			break
+		}
+
+		servConf.log.Printf("WRN database not ready, retrying in %s: %s", d, err)
+		time.Sleep(d)
+
+		if d *= 2; d > maxConnectDelay {
+			d = maxConnectDelay
+		}
+	}
+
+	if err := initSuperGraph(servConf); err != nil {
+		fatalInProd(servConf, err, "failed to initialize Super Graph")
+		return
+	}
+
+	servConf.log.Println("INF database connected, ready")
+}
+
+func pingDB(servConf *ServConfig) error {
+	timeout := servConf.conf.DB.PingTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	ct, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return servConf.db.PingContext(ct)
+}
@@ -0,0 +1,73 @@
+package serv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// errInternal is returned for requests that panicked, the
+// details are only logged so they are not leaked to clients
+var errInternal = errors.New("internal server error")
+
+// reqPanic logs the panic of the request with its stack and query, only the
+// names of the variables are logged since their values may be sensitive
+func reqPanic(servConf *ServConfig, ct context.Context, req *gqlReq, v interface{}) error {
+	var vars map[string]json.RawMessage
+	var names []string
+
+	if json.Unmarshal(req.Vars, &vars) == nil {
+		for k := range vars {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+	}
+
+	servConf.zlog.Error("panic",
+		zap.String("error", fmt.Sprint(v)),
+		zap.String("name", req.OpName),
+		zap.String("query", req.Query),
+		zap.Strings("variables", names),
+		zap.ByteString("stack", debug.Stack()))
+
+	addRecentError(req.OpName, errInternal)
+
+	if servConf.conf.telemetryEnabled() {
+		recordPanic(ct, req.OpName)
+	}
+
+	return errInternal
+}
+
+// recoverHTTP is deferred by the handler of all routes, a panic outside of
+// running a query is logged with the path and a 500 error is returned
+func recoverHTTP(servConf *ServConfig, w http.ResponseWriter, r *http.Request) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	// net/http uses it to abort the response, it's not logged
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+
+	servConf.zlog.Error("panic",
+		zap.String("error", fmt.Sprint(v)),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.ByteString("stack", debug.Stack()))
+
+	if servConf.conf.telemetryEnabled() {
+		recordPanic(r.Context(), "")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	renderErr(w, errInternal)
+}
@@ -0,0 +1,61 @@
+package serv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	core, logs := observer.New(zapcore.ErrorLevel)
+	servConf := &ServConfig{conf: &Config{}, zlog: zap.New(core)}
+
+	req := &gqlReq{
+		OpName: "getProducts",
+		Query:  "query getProducts { products { id } }",
+		Vars:   json.RawMessage(`{"token": "secret", "id": 5}`),
+	}
+
+	// no graph is set so running the query panics
+	res, err := execReq(servConf, context.Background(), req)
+	if err != errInternal || res != nil {
+		t.Fatalf("expected an internal error got %v", err)
+	}
+
+	if logs.Len() != 1 {
+		t.Fatalf("expected the panic to be logged")
+	}
+
+	fields := logs.All()[0].ContextMap()
+
+	if fields["query"] != req.Query || !strings.Contains(fields["stack"].(string), "runReq") {
+		t.Fatalf("unexpected log fields: %v", fields)
+	}
+
+	if v, ok := fields["variables"].([]interface{}); !ok || len(v) != 2 || v[0] != "id" || v[1] != "token" {
+		t.Fatalf("expected only the names of the variables: %v", fields["variables"])
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer recoverHTTP(servConf, w, r)
+		panic("bad request")
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/graphql", nil))
+
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), errInternal.Error()) {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	if strings.Contains(w.Body.String(), "bad request") {
+		t.Fatalf("the panic leaked to the client: %s", w.Body.String())
+	}
+}
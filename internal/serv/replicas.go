@@ -0,0 +1,191 @@
+package serv
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dosco/super-graph/core"
+)
+
+const (
+	defaultReplicaProbe  = 5 * time.Second
+	defaultReplicaSticky = 10 * time.Second
+)
+
+// replica selection, the healthy replica with the lowest latency
+// or each healthy replica in turn
+const (
+	selectLatency    = "latency"
+	selectRoundRobin = "round_robin"
+)
+
+type replica struct {
+	host    string
+	db      *sql.DB
+	latency int64 // nanoseconds, updated by the probe
+	healthy int32
+}
+
+// dbRouter routes queries to the healthy read replica with the lowest latency
+// or round-robin. Users who recently ran a mutation are kept on the primary
+// database for the sticky window so they always read their own writes.
+type dbRouter struct {
+	replicas []*replica
+	sticky   time.Duration
+	rr       bool
+	next     uint32
+	writes   sync.Map // user id -> time of last write
+}
+
+func initDBRouter(servConf *ServConfig) (*dbRouter, error) {
+	c := servConf.conf
+
+	r := &dbRouter{sticky: c.DB.ReplicaSticky}
+
+	if r.sticky == 0 {
+		r.sticky = defaultReplicaSticky
+	}
+
+	switch c.DB.ReplicaSelect {
+	case "", selectLatency:
+	case selectRoundRobin:
+		r.rr = true
+	default:
+		return nil, fmt.Errorf("unknown replica_select: %s", c.DB.ReplicaSelect)
+	}
+
+	for _, v := range c.DB.Replicas {
+		port := v.Port
+		if port == 0 {
+			port = c.DB.Port
+		}
+
+		db, err := initDBHost(servConf, v.Host, port, true, false)
+		if err != nil {
+			return nil, fmt.Errorf("replica %s: %w", v.Host, err)
+		}
+		r.replicas = append(r.replicas, &replica{host: v.Host, db: db})
+	}
+
+	return r, nil
+}
+
+// probe pings the replicas at every interval to update their latency and health,
+// the users past the sticky window are dropped at the same time
+func (r *dbRouter) probe(servConf *ServConfig) {
+	interval := servConf.conf.DB.ReplicaProbe
+
+	if interval == 0 {
+		interval = defaultReplicaProbe
+	}
+
+	r.ping(servConf, interval)
+
+	for range time.Tick(interval) {
+		r.ping(servConf, interval)
+		r.expire()
+	}
+}
+
+func (r *dbRouter) ping(servConf *ServConfig, timeout time.Duration) {
+	for _, rp := range r.replicas {
+		ct, cancel := context.WithTimeout(context.Background(), timeout)
+		st := time.Now()
+		err := rp.db.PingContext(ct)
+		cancel()
+
+		if err != nil {
+			if atomic.SwapInt32(&rp.healthy, 0) == 1 {
+				servConf.log.Printf("WRN replica %s unhealthy: %s", rp.host, err)
+			}
+			continue
+		}
+
+		atomic.StoreInt64(&rp.latency, int64(time.Since(st)))
+		atomic.StoreInt32(&rp.healthy, 1)
+	}
+}
+
+// route returns the replica to run a query on or nil to use the primary
+func (r *dbRouter) route(c context.Context) *sql.DB {
+	if r.pinned(c) {
+		return nil
+	}
+
+	if r.rr {
+		return r.roundRobin()
+	}
+
+	var db *sql.DB
+	var min int64
+
+	for _, rp := range r.replicas {
+		if atomic.LoadInt32(&rp.healthy) == 0 {
+			continue
+		}
+		if l := atomic.LoadInt64(&rp.latency); db == nil || l < min {
+			db, min = rp.db, l
+		}
+	}
+
+	return db
+}
+
+// roundRobin returns the next healthy replica
+func (r *dbRouter) roundRobin() *sql.DB {
+	n := atomic.AddUint32(&r.next, 1)
+
+	for i := range r.replicas {
+		rp := r.replicas[(int(n)+i)%len(r.replicas)]
+
+		if atomic.LoadInt32(&rp.healthy) == 1 {
+			return rp.db
+		}
+	}
+
+	return nil
+}
+
+// pinned returns true if the user ran a mutation within the sticky window
+func (r *dbRouter) pinned(c context.Context) bool {
+	if uid := c.Value(core.UserIDKey); uid != nil {
+		if v, ok := r.writes.Load(uid); ok {
+			if time.Since(v.(time.Time)) < r.sticky {
+				return true
+			}
+			r.writes.Delete(uid)
+		}
+	}
+	return false
+}
+
+// written records a mutation by the user to keep them on the primary
+func (r *dbRouter) written(c context.Context) {
+	if r.sticky < 0 {
+		return
+	}
+	if uid := c.Value(core.UserIDKey); uid != nil {
+		r.writes.Store(uid, time.Now())
+	}
+}
+
+// expire drops the users whose last mutation is past the sticky window
+// so the writes don't grow with every user that ever ran one
+func (r *dbRouter) expire() {
+	r.writes.Range(func(uid, v interface{}) bool {
+		if time.Since(v.(time.Time)) >= r.sticky {
+			r.writes.Delete(uid)
+		}
+		return true
+	})
+}
+
+func (r *dbRouter) close() {
+	for _, rp := range r.replicas {
+		rp.db.Close()
+	}
+}
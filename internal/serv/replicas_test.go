@@ -0,0 +1,64 @@
+package serv
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/dosco/super-graph/core"
+)
+
+func TestDBRouter(t *testing.T) {
+	r1 := &replica{host: "r1", db: new(sql.DB), latency: 20, healthy: 1}
+	r2 := &replica{host: "r2", db: new(sql.DB), latency: 10, healthy: 1}
+	r3 := &replica{host: "r3", db: new(sql.DB), latency: 5}
+
+	r := &dbRouter{replicas: []*replica{r1, r2, r3}, sticky: time.Minute}
+	ct := context.WithValue(context.Background(), core.UserIDKey, 1)
+
+	if db := r.route(ct); db != r2.db {
+		t.Fatal("expected the healthy replica with the lowest latency")
+	}
+
+	r.written(ct)
+
+	if db := r.route(ct); db != nil {
+		t.Fatal("expected the primary after a write")
+	}
+
+	if db := r.route(context.Background()); db != r2.db {
+		t.Fatal("expected a replica for other users")
+	}
+
+	// users past the sticky window are dropped
+	r.writes.Store(2, time.Now().Add(-2*time.Minute))
+	r.expire()
+
+	if _, ok := r.writes.Load(2); ok {
+		t.Fatal("expected the expired write to be dropped")
+	}
+
+	if _, ok := r.writes.Load(1); !ok {
+		t.Fatal("expected the write within the sticky window to be kept")
+	}
+
+	r = &dbRouter{replicas: []*replica{r1, r2, r3}, sticky: -1, rr: true}
+	seen := make(map[*sql.DB]int)
+
+	r.written(ct)
+
+	for i := 0; i < 4; i++ {
+		seen[r.route(ct)]++
+	}
+
+	if seen[r1.db] != 2 || seen[r2.db] != 2 {
+		t.Fatalf("expected round-robin over the healthy replicas: %v", seen)
+	}
+
+	r1.healthy, r2.healthy = 0, 0
+
+	if db := r.route(ct); db != nil {
+		t.Fatal("expected the primary with no healthy replicas")
+	}
+}
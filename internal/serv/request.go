@@ -0,0 +1,226 @@
+package serv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/dosco/super-graph/core"
+)
+
+// maxBatchSize is the most queries sent together in a batch
+const maxBatchSize = 10
+
+var (
+	errMutationGET = errors.New("mutations are not allowed in a GET request")
+	errBatchSize   = fmt.Errorf("batch: more than %d queries", maxBatchSize)
+	errEmptyBatch  = errors.New("batch: no queries")
+)
+
+// decodeRequest reads the GraphQL requests sent over HTTP. A GET has the
+// query, operationName, variables and extensions in the query params (the
+// last two as JSON) and a POST has them in the JSON body, a list in the
+// body is a batch of requests. The websocket transport decodes the
+// same gqlReq so the fields are read the same way everywhere.
+func decodeRequest(r *http.Request) ([]gqlReq, bool, error) {
+	if r.Method == http.MethodGet {
+		req, err := decodeGetRequest(r)
+		if err != nil {
+			return nil, false, err
+		}
+		return []gqlReq{req}, false, nil
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxReadBytes))
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Body.Close()
+
+	return decodeBody(b)
+}
+
+func decodeGetRequest(r *http.Request) (gqlReq, error) {
+	p := r.URL.Query()
+
+	req := gqlReq{
+		OpName: p.Get("operationName"),
+		Query:  p.Get("query"),
+		get:    true,
+	}
+
+	if v := p.Get("variables"); v != "" {
+		if !json.Valid([]byte(v)) {
+			return req, errors.New("variables: invalid json")
+		}
+		req.Vars = json.RawMessage(v)
+	}
+
+	if v := p.Get("extensions"); v != "" {
+		if !json.Valid([]byte(v)) {
+			return req, errors.New("extensions: invalid json")
+		}
+		req.Extensions = json.RawMessage(v)
+	}
+
+	req.normalize()
+	return req, nil
+}
+
+func decodeBody(b []byte) ([]gqlReq, bool, error) {
+	b = bytes.TrimSpace(b)
+
+	if len(b) == 0 || b[0] != '[' {
+		var req gqlReq
+
+		if err := json.Unmarshal(b, &req); err != nil {
+			return nil, false, err
+		}
+		req.normalize()
+		return []gqlReq{req}, false, nil
+	}
+
+	var reqs []gqlReq
+
+	if err := json.Unmarshal(b, &reqs); err != nil {
+		return nil, true, err
+	}
+
+	if len(reqs) == 0 {
+		return nil, true, errEmptyBatch
+	}
+
+	if len(reqs) > maxBatchSize {
+		return nil, true, errBatchSize
+	}
+
+	for i := range reqs {
+		reqs[i].normalize()
+	}
+
+	return reqs, true, nil
+}
+
+// normalize drops null variables and extensions so
+// they are treated the same as missing ones
+func (req *gqlReq) normalize() {
+	if isNull(req.Vars) {
+		req.Vars = nil
+	}
+	if isNull(req.Extensions) {
+		req.Extensions = nil
+	}
+}
+
+// reqQuery returns the query to run for the request, the persisted
+// query of the extensions is looked up and the operation selected
+func reqQuery(ct context.Context, req *gqlReq) (string, error) {
+	query := req.Query
+
+	if !req.allowed {
+		q, err := graph().PersistedQuery(ct, req.Query, req.Extensions)
+		if err != nil {
+			return "", err
+		}
+		query = q
+	}
+
+	query, err := core.SelectOperation(query, req.OpName)
+	if err != nil {
+		return "", err
+	}
+
+	if req.get && core.Operation(query) == core.OpMutation {
+		return "", errMutationGET
+	}
+
+	return query, nil
+}
+
+// initHeaders returns the headers set by the websocket init payload, these
+// are its string values and the ones in a `headers` object since clients
+// put them in either place, the `headers` object wins
+func initHeaders(payload map[string]json.RawMessage) map[string]string {
+	h := make(map[string]string, len(payload))
+	addStrings(h, payload)
+
+	var hm map[string]json.RawMessage
+
+	if v, ok := payload["headers"]; ok && json.Unmarshal(v, &hm) == nil {
+		addStrings(h, hm)
+	}
+
+	return h
+}
+
+func addStrings(h map[string]string, m map[string]json.RawMessage) {
+	for k, v := range m {
+		var s string
+
+		if err := json.Unmarshal(v, &s); err == nil {
+			h[k] = s
+		}
+	}
+}
+
+// wantsPatch returns true when a subscription asks for JSON Patch deltas
+// in place of the full result after the first one ({"patch": true} in
+// the extensions)
+func wantsPatch(ext json.RawMessage) bool {
+	var e struct {
+		Patch bool `json:"patch"`
+	}
+
+	if len(ext) == 0 || json.Unmarshal(ext, &e) != nil {
+		return false
+	}
+	return e.Patch
+}
+
+// wantsStream returns true when a query asks for its rows to be written
+// to the response as they're fetched ({"stream": true} in the extensions)
+func wantsStream(ext json.RawMessage) bool {
+	var e struct {
+		Stream bool `json:"stream"`
+	}
+
+	if len(ext) == 0 || json.Unmarshal(ext, &e) != nil {
+		return false
+	}
+	return e.Stream
+}
+
+// wantsDryRun returns true when a mutation asks to be run in a transaction
+// that's rolled back ({"dry_run": true} in the extensions)
+func wantsDryRun(ext json.RawMessage) bool {
+	var e struct {
+		DryRun bool `json:"dry_run"`
+	}
+
+	if len(ext) == 0 || json.Unmarshal(ext, &e) != nil {
+		return false
+	}
+	return e.DryRun
+}
+
+// wantsNormalize returns true when a query asks for the rows to be returned
+// as entities keyed by id ({"normalize": true} in the extensions)
+func wantsNormalize(ext json.RawMessage) bool {
+	var e struct {
+		Normalize bool `json:"normalize"`
+	}
+
+	if len(ext) == 0 || json.Unmarshal(ext, &e) != nil {
+		return false
+	}
+	return e.Normalize
+}
+
+func isNull(b json.RawMessage) bool {
+	return len(b) == 0 || string(bytes.TrimSpace(b)) == "null"
+}
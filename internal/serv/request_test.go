@@ -0,0 +1,143 @@
+package serv
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const apqExt = `{"persistedQuery":{"version":1,"sha256Hash":"abc"}}`
+
+func TestDecodeGetRequest(t *testing.T) {
+	p := url.Values{}
+	p.Set("query", "query getMe { me { id } }")
+	p.Set("operationName", "getMe")
+	p.Set("variables", `{"id":1}`)
+	p.Set("extensions", apqExt)
+
+	r := httptest.NewRequest("GET", "/api/v1/graphql?"+p.Encode(), nil)
+
+	reqs, batch, err := decodeRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if batch || len(reqs) != 1 {
+		t.Fatalf("expected a single request got: %d", len(reqs))
+	}
+
+	req := reqs[0]
+
+	if req.Query != "query getMe { me { id } }" || req.OpName != "getMe" || !req.get {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+
+	if string(req.Vars) != `{"id":1}` || string(req.Extensions) != apqExt {
+		t.Fatalf("unexpected variables or extensions: %s, %s", req.Vars, req.Extensions)
+	}
+
+	r = httptest.NewRequest("GET", "/api/v1/graphql?extensions=%7Bbad", nil)
+
+	if _, _, err := decodeRequest(r); err == nil {
+		t.Fatal("expected an error for invalid extensions")
+	}
+}
+
+func TestDecodePostRequest(t *testing.T) {
+	body := `{"query":"{ me { id } }","variables":null,"extensions":` + apqExt + `}`
+	r := httptest.NewRequest("POST", "/api/v1/graphql", strings.NewReader(body))
+
+	reqs, batch, err := decodeRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if batch || len(reqs) != 1 {
+		t.Fatalf("expected a single request got: %d", len(reqs))
+	}
+
+	if reqs[0].Vars != nil || string(reqs[0].Extensions) != apqExt || reqs[0].get {
+		t.Fatalf("unexpected request: %+v", reqs[0])
+	}
+}
+
+func TestDecodeBatchRequest(t *testing.T) {
+	body := ` [{"query":"{ me { id } }"},{"extensions":` + apqExt + `,"variables":{"id":2}}]`
+	r := httptest.NewRequest("POST", "/api/v1/graphql", strings.NewReader(body))
+
+	reqs, batch, err := decodeRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !batch || len(reqs) != 2 {
+		t.Fatalf("expected a batch of 2 requests got: %d", len(reqs))
+	}
+
+	if string(reqs[1].Extensions) != apqExt || string(reqs[1].Vars) != `{"id":2}` {
+		t.Fatalf("unexpected request: %+v", reqs[1])
+	}
+
+	if _, _, err := decodeBody([]byte(`[]`)); err != errEmptyBatch {
+		t.Fatalf("expected an empty batch error got: %v", err)
+	}
+
+	big := "[" + strings.Repeat(`{"query":"{ me { id } }"},`, maxBatchSize) + `{"query":"{ me { id } }"}]`
+
+	if _, _, err := decodeBody([]byte(big)); err != errBatchSize {
+		t.Fatalf("expected a batch size error got: %v", err)
+	}
+}
+
+func TestDecodeWsRequest(t *testing.T) {
+	var msg gqlWsReq
+
+	b := `{"id":"1","type":"subscribe","payload":{"query":"subscription { me { id } }","extensions":` + apqExt + `}}`
+
+	if err := json.Unmarshal([]byte(b), &msg); err != nil {
+		t.Fatal(err)
+	}
+	msg.Payload.normalize()
+
+	if string(msg.Payload.Extensions) != apqExt {
+		t.Fatalf("unexpected extensions: %s", msg.Payload.Extensions)
+	}
+
+	var initReq wsConnInit
+
+	b = `{"type":"connection_init","payload":{"X-User-ID":"1","retries":3,"headers":{"Authorization":"Bearer abc"}}}`
+
+	if err := json.Unmarshal([]byte(b), &initReq); err != nil {
+		t.Fatal(err)
+	}
+
+	h := initHeaders(initReq.Payload)
+
+	if len(h) != 2 || h["X-User-ID"] != "1" || h["Authorization"] != "Bearer abc" {
+		t.Fatalf("unexpected headers: %v", h)
+	}
+}
+
+func TestPatchData(t *testing.T) {
+	if !wantsPatch(json.RawMessage(`{"patch":true}`)) || wantsPatch(nil) || wantsPatch(json.RawMessage(`{"patch":1}`)) {
+		t.Fatal("unexpected wantsPatch result")
+	}
+
+	prev := json.RawMessage(`{"products":[{"id":1,"name":"Apple","description":"A red fruit"},{"id":2,"name":"Banana","description":"A yellow fruit"}]}`)
+	data := json.RawMessage(`{"products":[{"id":1,"name":"Apple","description":"A red fruit"},{"id":2,"name":"Mango","description":"A yellow fruit"}]}`)
+
+	ops, d := patchData(prev, data)
+
+	if d != nil || len(ops) != 1 || ops[0].Path != "/products/1/name" {
+		t.Fatalf("unexpected patch: %v %s", ops, d)
+	}
+
+	// the full result is sent when the patch is not smaller
+	data = json.RawMessage(`{"products":[]}`)
+
+	if ops, d := patchData(prev, data); ops != nil || string(d) != string(data) {
+		t.Fatalf("expected the full result: %v %s", ops, d)
+	}
+}
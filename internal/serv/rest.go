@@ -0,0 +1,487 @@
+package serv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dosco/super-graph/core"
+	"github.com/dosco/super-graph/internal/serv/internal/auth"
+	"go.opencensus.io/plugin/ochttp"
+)
+
+// restRole is the role the variables and results of the
+// operations are typed for in the OpenAPI spec
+const restRole = "user"
+
+type jsonObj map[string]interface{}
+
+// restAPI serves the named queries and mutations of the allow list as
+// REST endpoints, the variables of the operation are the parameters
+type restAPI struct {
+	servConf *ServConfig
+	path     string
+
+	sync.Mutex
+	sg   *core.SuperGraph
+	ops  map[string]*core.OpInfo
+	spec []byte
+}
+
+func setRESTRoutes(servConf *ServConfig, routes map[string]http.Handler) error {
+	rc := &servConf.conf.REST
+
+	if !rc.Enable {
+		return nil
+	}
+
+	p := rc.Path
+	if p == "" {
+		p = strings.TrimSuffix(apiRoute, "/graphql") + "/rest"
+	}
+
+	ra := &restAPI{servConf: servConf, path: path.Clean("/" + p)}
+
+	h, err := auth.WithAuth(ra, &servConf.conf.Auth)
+	if err != nil {
+		return err
+	}
+
+	if servConf.conf.telemetryEnabled() {
+		h = ochttp.WithRouteTag(h, ra.path)
+	}
+
+	routes[ra.path+"/"] = h
+	return nil
+}
+
+// operations returns the operations by name and their spec. They are loaded
+// again when Super Graph is reloaded, and on every request in development
+// since queries are added to the allow list as they are used
+func (ra *restAPI) operations() (map[string]*core.OpInfo, []byte, error) {
+	ra.Lock()
+	defer ra.Unlock()
+
+	g := graph()
+
+	if ra.sg == g && ra.servConf.conf.Production {
+		return ra.ops, ra.spec, nil
+	}
+
+	list, err := g.Operations(restRole)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ops := make(map[string]*core.OpInfo, len(list))
+	var sops []core.OpInfo
+
+	for i := range list {
+		op := &list[i]
+
+		// subscriptions can't be served as a request
+		if op.Type != core.OpQuery && op.Type != core.OpMutation {
+			continue
+		}
+		ops[op.Name] = op
+		sops = append(sops, *op)
+	}
+
+	title := ra.servConf.conf.AppName
+	if title == "" {
+		title = serverName
+	}
+
+	spec, err := genOpenAPI(sops, ra.path, title)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ra.sg, ra.ops, ra.spec = g, ops, spec
+	return ops, spec, nil
+}
+
+//nolint: errcheck
+func (ra *restAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !isReady() {
+		restErr(w, errNotReady)
+		return
+	}
+
+	ops, spec, err := ra.operations()
+	if err != nil {
+		restErr(w, err)
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, ra.path), "/")
+
+	if name == "openapi.json" {
+		w.Write(spec)
+		return
+	}
+
+	var id string
+
+	if i := strings.IndexByte(name, '/'); i != -1 {
+		name, id = name[:i], name[i+1:]
+	}
+
+	op, ok := ops[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(errResp(fmt.Errorf("rest: operation not found: %s", name)))
+		return
+	}
+
+	method := http.MethodGet
+	if op.Type == core.OpMutation {
+		method = http.MethodPost
+	}
+
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(errResp(fmt.Errorf("rest: %s: use %s", name, method)))
+		return
+	}
+
+	vars, err := restVars(op, r, id)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(errResp(err))
+		return
+	}
+
+	ct := reqContext(ra.servConf, r)
+
+	if ra.servConf.conf.AuthFailBlock && !auth.IsAuth(ct) {
+		restErr(w, errUnauthorized)
+		return
+	}
+
+	if ra.servConf.conf.telemetryEnabled() {
+		ochttp.SetRoute(ct, ra.path)
+	}
+
+	res, err := execReq(ra.servConf, ct, &gqlReq{Query: op.Query, Vars: vars, allowed: true})
+	if err != nil {
+		restErr(w, err)
+		return
+	}
+
+	if ra.servConf.conf.CacheControl != "" && op.Type == core.OpQuery {
+		w.Header().Set("Cache-Control", ra.servConf.conf.CacheControl)
+	}
+
+	json.NewEncoder(w).Encode(res)
+}
+
+// restErr renders the error with the status code for it
+//nolint: errcheck
+func restErr(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+
+	switch {
+	case err == errUnauthorized:
+		status = http.StatusUnauthorized
+	case err == errNotReady:
+		status = http.StatusServiceUnavailable
+	case err == errInternal:
+		status = http.StatusInternalServerError
+	case err == core.ErrRateLimited, core.ErrorCode(err) == core.ErrCodeQuotaExceeded:
+		status = http.StatusTooManyRequests
+	case core.ErrorCode(err) == core.ErrCodeRoleForbidden:
+		status = http.StatusForbidden
+	case core.ErrorCode(err) == core.ErrCodeQueryTimeout:
+		status = http.StatusGatewayTimeout
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errResp(err))
+}
+
+// restVars returns the variables of the operation set from the query
+// parameters, the id in the path and the JSON body of a POST
+func restVars(op *core.OpInfo, r *http.Request, id string) (json.RawMessage, error) {
+	vars := make(map[string]json.RawMessage)
+
+	if r.Method == http.MethodPost && r.Body != nil {
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxReadBytes))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(b) != 0 {
+			if err := json.Unmarshal(b, &vars); err != nil {
+				return nil, fmt.Errorf("rest: the body must be a JSON object: %w", err)
+			}
+		}
+	}
+
+	vm := make(map[string]*core.OpVar, len(op.Variables))
+
+	for i := range op.Variables {
+		v := &op.Variables[i]
+		vm[v.Name] = v
+	}
+
+	for k := range vars {
+		if _, ok := vm[k]; !ok {
+			return nil, fmt.Errorf("rest: %s: unknown variable: %s", op.Name, k)
+		}
+	}
+
+	q := r.URL.Query()
+
+	if id != "" {
+		if v, ok := vm["id"]; !ok || v.Array || strings.Contains(id, "/") {
+			return nil, fmt.Errorf("rest: %s: no id in the path expected", op.Name)
+		}
+		q.Set("id", id)
+	}
+
+	for k, vals := range q {
+		v, ok := vm[k]
+		if !ok {
+			return nil, fmt.Errorf("rest: %s: unknown parameter: %s", op.Name, k)
+		}
+
+		b, err := restParam(v, vals)
+		if err != nil {
+			return nil, fmt.Errorf("rest: %s: %w", op.Name, err)
+		}
+		vars[k] = b
+	}
+
+	if len(vars) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(vars)
+}
+
+// restParam returns the JSON value of a parameter, arrays are set with the
+// parameter repeated (ids=1&ids=2) or a comma separated list (ids=1,2)
+func restParam(v *core.OpVar, vals []string) (json.RawMessage, error) {
+	if !v.Array {
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("%s: expected one value", v.Name)
+		}
+		return restValue(v, vals[0])
+	}
+
+	if len(vals) == 1 {
+		if vals[0] == "" {
+			return json.RawMessage(`[]`), nil
+		}
+		vals = strings.Split(vals[0], ",")
+	}
+
+	list := make([]json.RawMessage, len(vals))
+
+	for i, s := range vals {
+		b, err := restValue(v, s)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = b
+	}
+
+	return json.Marshal(list)
+}
+
+// restValue returns the JSON value of the string for the type of the variable
+func restValue(v *core.OpVar, s string) (json.RawMessage, error) {
+	switch goType(v.Type) {
+	case "int64":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: expected an integer: %s", v.Name, s)
+		}
+		return json.Marshal(n)
+
+	case "float64":
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: expected a number: %s", v.Name, s)
+		}
+		return json.Marshal(n)
+
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: expected a boolean: %s", v.Name, s)
+		}
+		return json.Marshal(b)
+
+	case "json.RawMessage":
+		if !json.Valid([]byte(s)) {
+			return nil, fmt.Errorf("%s: expected JSON: %s", v.Name, s)
+		}
+		return json.RawMessage(s), nil
+	}
+
+	return json.Marshal(s)
+}
+
+// genOpenAPI returns the OpenAPI 3 spec of the REST endpoints of the operations,
+// operations with an id variable can also be called with the id in the path
+func genOpenAPI(ops []core.OpInfo, prefix, title string) ([]byte, error) {
+	paths := make(jsonObj)
+
+	for i := range ops {
+		op := &ops[i]
+		p := path.Join(prefix, op.Name)
+
+		paths[p] = restOpSpec(op, false)
+
+		for _, v := range op.Variables {
+			if v.Name == "id" && !v.Array {
+				paths[p+"/{id}"] = restOpSpec(op, true)
+			}
+		}
+	}
+
+	spec := jsonObj{
+		"openapi": "3.0.3",
+		"info":    jsonObj{"title": title, "version": "1"},
+		"paths":   paths,
+		"components": jsonObj{
+			"schemas": jsonObj{
+				"Error": jsonObj{
+					"type": "object",
+					"properties": jsonObj{
+						"error":  jsonObj{"type": "string"},
+						"code":   jsonObj{"type": "string"},
+						"errors": jsonObj{"type": "array", "items": jsonObj{"type": "object"}},
+					},
+				},
+			},
+		},
+	}
+
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+// restOpSpec returns the path item of the operation, the variables are query
+// parameters of queries and in the JSON body of mutations
+func restOpSpec(op *core.OpInfo, idInPath bool) jsonObj {
+	var params []jsonObj
+	props := make(jsonObj)
+
+	for _, v := range op.Variables {
+		s := typeSchema(v.Type)
+		if v.Array {
+			s = jsonObj{"type": "array", "items": s}
+		}
+
+		switch {
+		case idInPath && v.Name == "id":
+			params = append(params, jsonObj{"name": v.Name, "in": "path", "required": true, "schema": s})
+		case op.Type == core.OpQuery:
+			params = append(params, jsonObj{"name": v.Name, "in": "query", "schema": s})
+		default:
+			props[v.Name] = s
+		}
+	}
+
+	o := jsonObj{
+		"operationId": op.Name,
+		"responses": jsonObj{
+			"200": jsonObj{
+				"description": "The result of " + op.Name,
+				"content": jsonObj{"application/json": jsonObj{"schema": jsonObj{
+					"type":       "object",
+					"properties": jsonObj{"data": fieldsSchema(op.Fields)},
+				}}},
+			},
+			"default": jsonObj{
+				"description": "An error",
+				"content": jsonObj{"application/json": jsonObj{
+					"schema": jsonObj{"$ref": "#/components/schemas/Error"},
+				}},
+			},
+		},
+	}
+
+	if idInPath {
+		o["operationId"] = op.Name + "ByID"
+	}
+
+	if len(params) != 0 {
+		o["parameters"] = params
+	}
+
+	if op.Type == core.OpMutation {
+		if len(props) != 0 {
+			o["requestBody"] = jsonObj{"content": jsonObj{"application/json": jsonObj{
+				"schema": jsonObj{"type": "object", "properties": props},
+			}}}
+		}
+		return jsonObj{"post": o}
+	}
+
+	return jsonObj{"get": o}
+}
+
+// fieldsSchema returns the schema of an object with the fields, the type of
+// remote joins and unions is not known so they can have any value
+func fieldsSchema(fields []core.OpField) jsonObj {
+	props := make(jsonObj, len(fields))
+
+	for _, f := range fields {
+		var s jsonObj
+
+		switch {
+		case len(f.Fields) != 0:
+			s = fieldsSchema(f.Fields)
+
+			if f.List {
+				s = jsonObj{"type": "array", "items": s}
+			} else {
+				s["nullable"] = true
+			}
+
+		case f.Type == "":
+			s = jsonObj{}
+
+		default:
+			s = typeSchema(f.Type)
+
+			if f.Array {
+				s = jsonObj{"type": "array", "items": s}
+			}
+			if !f.NotNull {
+				s["nullable"] = true
+			}
+		}
+
+		props[f.Name] = s
+	}
+
+	return jsonObj{"type": "object", "properties": props}
+}
+
+// typeSchema returns the JSON schema for a database type
+func typeSchema(t string) jsonObj {
+	switch goType(t) {
+	case "int64":
+		return jsonObj{"type": "integer", "format": "int64"}
+	case "float64":
+		return jsonObj{"type": "number"}
+	case "bool":
+		return jsonObj{"type": "boolean"}
+	case "json.RawMessage":
+		return jsonObj{}
+	}
+	return jsonObj{"type": "string"}
+}
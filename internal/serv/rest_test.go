@@ -0,0 +1,161 @@
+package serv
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dosco/super-graph/core"
+)
+
+func TestRESTVars(t *testing.T) {
+	op := &core.OpInfo{
+		Name: "getProducts",
+		Type: core.OpQuery,
+		Variables: []core.OpVar{
+			{Name: "id", Type: "bigint"},
+			{Name: "ids", Type: "integer", Array: true},
+			{Name: "price", Type: "numeric(7,2)"},
+			{Name: "active", Type: "boolean"},
+			{Name: "name", Type: "text"},
+			{Name: "meta", Type: "jsonb"},
+		},
+	}
+
+	r := httptest.NewRequest("GET", `/api/v1/rest/getProducts/5?ids=1,2&price=2.5&active=true&name=Beer&meta={"a":1}`, nil)
+
+	vars, err := restVars(op, r, "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"active":true,"id":5,"ids":[1,2],"meta":{"a":1},"name":"Beer","price":2.5}`
+	if string(vars) != exp {
+		t.Fatalf("expected %s got %s", exp, vars)
+	}
+
+	r = httptest.NewRequest("GET", `/api/v1/rest/getProducts?ids=1&ids=3`, nil)
+
+	if vars, err = restVars(op, r, ""); err != nil {
+		t.Fatal(err)
+	}
+	if exp := `{"ids":[1,3]}`; string(vars) != exp {
+		t.Fatalf("expected %s got %s", exp, vars)
+	}
+
+	errs := []string{
+		`/api/v1/rest/getProducts?id=x`,
+		`/api/v1/rest/getProducts?active=maybe`,
+		`/api/v1/rest/getProducts?meta={`,
+		`/api/v1/rest/getProducts?limit=5`,
+		`/api/v1/rest/getProducts?id=1&id=2`,
+	}
+
+	for _, u := range errs {
+		if _, err := restVars(op, httptest.NewRequest("GET", u, nil), ""); err == nil {
+			t.Fatalf("%s: expected an error", u)
+		}
+	}
+
+	// the variables of a mutation are in the body
+	op = &core.OpInfo{
+		Name:      "updateProduct",
+		Type:      core.OpMutation,
+		Variables: []core.OpVar{{Name: "id", Type: "bigint"}, {Name: "data", Type: "json"}},
+	}
+
+	r = httptest.NewRequest("POST", `/api/v1/rest/updateProduct/3`, strings.NewReader(`{"data":{"name":"Wine"}}`))
+
+	if vars, err = restVars(op, r, "3"); err != nil {
+		t.Fatal(err)
+	}
+	if exp := `{"data":{"name":"Wine"},"id":3}`; string(vars) != exp {
+		t.Fatalf("expected %s got %s", exp, vars)
+	}
+
+	r = httptest.NewRequest("POST", `/api/v1/rest/updateProduct`, strings.NewReader(`{"name":"Wine"}`))
+
+	if _, err := restVars(op, r, ""); err == nil {
+		t.Fatal("expected an error for an unknown variable")
+	}
+}
+
+func TestGenOpenAPI(t *testing.T) {
+	ops := []core.OpInfo{
+		{
+			Name:      "getUser",
+			Type:      core.OpQuery,
+			Variables: []core.OpVar{{Name: "id", Type: "bigint"}},
+			Fields: []core.OpField{{
+				Name: "user",
+				Fields: []core.OpField{
+					{Name: "id", Type: "bigint", NotNull: true},
+					{Name: "email", Type: "character varying(255)"},
+					{Name: "products", List: true, Fields: []core.OpField{
+						{Name: "price", Type: "numeric(7,2)"},
+						{Name: "tags", Type: "text", Array: true},
+					}},
+				},
+			}},
+		},
+		{
+			Name:      "addProduct",
+			Type:      core.OpMutation,
+			Variables: []core.OpVar{{Name: "data", Type: "json"}},
+		},
+	}
+
+	b, err := genOpenAPI(ops, "/api/v1/rest", "Shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Parameters  []struct {
+				Name string
+				In   string
+			}
+			RequestBody json.RawMessage
+			Responses   map[string]json.RawMessage
+		}
+	}
+
+	if err := json.Unmarshal(b, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(spec.Paths) != 3 {
+		t.Fatalf("expected 3 paths got %d", len(spec.Paths))
+	}
+
+	get := spec.Paths["/api/v1/rest/getUser"]["get"]
+	if get.OperationID != "getUser" || len(get.Parameters) != 1 || get.Parameters[0].In != "query" {
+		t.Fatalf("unexpected query spec: %+v", get)
+	}
+
+	if p := spec.Paths["/api/v1/rest/getUser/{id}"]["get"].Parameters; len(p) != 1 || p[0].In != "path" {
+		t.Fatalf("expected the id in the path: %+v", p)
+	}
+
+	post, ok := spec.Paths["/api/v1/rest/addProduct"]["post"]
+	if !ok || len(post.RequestBody) == 0 {
+		t.Fatalf("expected a post with a body: %+v", post)
+	}
+
+	res := string(get.Responses["200"])
+	res = strings.Join(strings.Fields(res), "")
+
+	for _, v := range []string{
+		`"id":{"format":"int64","type":"integer"}`,
+		`"email":{"nullable":true,"type":"string"}`,
+		`"products":{"items":{"properties":`,
+		`"tags":{"items":{"type":"string"},"nullable":true,"type":"array"}`,
+	} {
+		if !strings.Contains(res, v) {
+			t.Fatalf("expected %s in %s", v, res)
+		}
+	}
+}
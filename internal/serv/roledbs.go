@@ -0,0 +1,52 @@
+package serv
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/dosco/super-graph/core"
+)
+
+// roleDB is the database of a role opened with its own user
+type roleDB struct {
+	role string
+	db   *sql.DB
+}
+
+// initRoleDBs opens a connection pool for each role with its own
+// database user, the host and database are the ones of the primary
+func initRoleDBs(servConf *ServConfig) error {
+	c := servConf.conf
+
+	for _, v := range c.DB.Roles {
+		if v.Name == "" || v.User == "" {
+			return fmt.Errorf("database roles: name and user are required")
+		}
+
+		dc := *c
+		dc.DB.User = v.User
+		dc.DB.Password = v.Password
+
+		sc := *servConf
+		sc.conf = &dc
+
+		db, err := initDB(&sc, true, false)
+		if err != nil {
+			return fmt.Errorf("database role %s: %w", v.Name, err)
+		}
+
+		servConf.roleDBs = append(servConf.roleDBs, roleDB{role: v.Name, db: db})
+	}
+
+	return nil
+}
+
+// setRoleDBs sets the databases of the roles on the Super Graph instance
+func setRoleDBs(servConf *ServConfig, g *core.SuperGraph) error {
+	for _, v := range servConf.roleDBs {
+		if err := g.SetRoleDB(v.role, v.db); err != nil {
+			return fmt.Errorf("database role %s: %w", v.role, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package serv
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dosco/super-graph/core"
+)
+
+const (
+	defaultSampleSize = 5
+
+	// max number of operations samples are kept for and the max size of
+	// the variables and data of a sample, larger ones are left out
+	maxSampleOps   = 1000
+	maxSampleBytes = 64 << 10
+
+	maskedValue = "***"
+)
+
+type sample struct {
+	At        time.Time       `json:"at"`
+	Name      string          `json:"name"`
+	Role      string          `json:"role"`
+	Query     string          `json:"query"`
+	Vars      json.RawMessage `json:"variables,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+type sampleRing struct {
+	samples []sample
+	next    int
+}
+
+// samples are the last requests and responses of each operation
+// keyed by the operation name or the fingerprint of the query
+var samples struct {
+	sync.Mutex
+	ops map[string]*sampleRing
+}
+
+// addSample keeps the request and response of the operation, the values
+// of the fields in the blocklist or mask are masked
+func addSample(servConf *ServConfig, query string, vars json.RawMessage, res *core.Result, err error) {
+	c := &servConf.conf.Samples
+
+	if res == nil || (c.Rate > 0 && rand.Float64() >= c.Rate) {
+		return
+	}
+
+	mask := make([]string, 0, len(servConf.conf.Blocklist)+len(c.Mask))
+	mask = append(append(mask, servConf.conf.Blocklist...), c.Mask...)
+
+	s := sample{
+		At:    time.Now(),
+		Name:  res.QueryName(),
+		Role:  res.Role(),
+		Query: query,
+	}
+
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	if len(vars) > maxSampleBytes || len(res.Data) > maxSampleBytes {
+		s.Truncated = true
+	} else {
+		s.Vars = maskJSON(vars, mask)
+		s.Data = maskJSON(res.Data, mask)
+	}
+
+	key := s.Name
+	if key == "" {
+		key = res.Fingerprint()
+	}
+
+	size := c.Size
+	if size <= 0 {
+		size = defaultSampleSize
+	}
+
+	samples.Lock()
+	defer samples.Unlock()
+
+	if samples.ops == nil {
+		samples.ops = make(map[string]*sampleRing)
+	}
+
+	r, ok := samples.ops[key]
+	if !ok {
+		if len(samples.ops) >= maxSampleOps {
+			return
+		}
+		r = &sampleRing{}
+		samples.ops[key] = r
+	}
+
+	if len(r.samples) < size {
+		r.samples = append(r.samples, s)
+		return
+	}
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % len(r.samples)
+}
+
+// lastSamples returns the samples of each operation, newest first
+func lastSamples() map[string][]sample {
+	samples.Lock()
+	defer samples.Unlock()
+
+	ops := make(map[string][]sample, len(samples.ops))
+
+	for k, r := range samples.ops {
+		n := len(r.samples)
+		list := make([]sample, n)
+
+		for i := 0; i < n; i++ {
+			list[i] = r.samples[(r.next+n-1-i)%n]
+		}
+		ops[k] = list
+	}
+	return ops
+}
+
+// maskJSON returns the json with the values of the keys that have
+// a name in the mask list in them (eg. password in user_password)
+// replaced, json that can't be decoded is left out
+func maskJSON(b json.RawMessage, mask []string) json.RawMessage {
+	if len(b) == 0 {
+		return nil
+	}
+
+	var v interface{}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	if err := d.Decode(&v); err != nil {
+		return nil
+	}
+
+	mb, err := json.Marshal(maskValue(v, mask))
+	if err != nil {
+		return nil
+	}
+	return mb
+}
+
+func maskValue(v interface{}, mask []string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, v1 := range val {
+			if masked(k, mask) && v1 != nil {
+				val[k] = maskedValue
+			} else {
+				val[k] = maskValue(v1, mask)
+			}
+		}
+
+	case []interface{}:
+		for i := range val {
+			val[i] = maskValue(val[i], mask)
+		}
+	}
+	return v
+}
+
+func masked(key string, mask []string) bool {
+	key = strings.ToLower(key)
+
+	for _, m := range mask {
+		if m != "" && strings.Contains(key, strings.ToLower(m)) {
+			return true
+		}
+	}
+	return false
+}
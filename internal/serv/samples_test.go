@@ -0,0 +1,23 @@
+package serv
+
+import (
+	"testing"
+)
+
+func TestMaskJSON(t *testing.T) {
+	mask := []string{"password", "Token"}
+
+	v := maskJSON([]byte(`{"user": {"id": 1.50, "encrypted_password": "x", "api_token": null},
+		"users": [{"email": "a@b.c", "password": "y"}]}`), mask)
+
+	exp := `{"user":{"api_token":null,"encrypted_password":"***","id":1.50},` +
+		`"users":[{"email":"a@b.c","password":"***"}]}`
+
+	if string(v) != exp {
+		t.Fatalf("expected %s got %s", exp, v)
+	}
+
+	if v := maskJSON([]byte(`{"bad"`), mask); v != nil {
+		t.Fatalf("expected nothing for bad json got %s", v)
+	}
+}
@@ -0,0 +1,412 @@
+package serv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dosco/super-graph/core"
+	"github.com/jackc/pgx/v4"
+)
+
+const defaultScheduleTimeout = time.Minute
+
+// Schedule struct runs a named query of the allow list on a cron schedule
+// (eg. "0 6 * * *", "@daily" or "@every 1h") and delivers the result to a
+// table (with name text and data jsonb columns), object storage (under the
+// blob key prefix) or a webhook. It runs as the user when user_id is set
+type Schedule struct {
+	Name    string
+	Cron    string
+	Vars    map[string]interface{} `mapstructure:"variables"`
+	UserID  string                 `mapstructure:"user_id"`
+	Table   string
+	Blob    string
+	URL     string
+	Timeout time.Duration
+}
+
+type scheduler struct {
+	servConf *ServConfig
+	s        *Schedule
+	spec     *cronSpec
+	vars     json.RawMessage
+	timeout  time.Duration
+	blobs    core.BlobStore
+	client   *http.Client
+}
+
+// initSchedules starts running the scheduled queries
+func initSchedules(servConf *ServConfig) error {
+	c := servConf.conf
+
+	for i := range c.Schedules {
+		s := &c.Schedules[i]
+
+		sc, err := newScheduler(servConf, s)
+		if err != nil {
+			return fmt.Errorf("schedule %s: %w", s.Name, err)
+		}
+		go sc.start()
+	}
+
+	return nil
+}
+
+func newScheduler(servConf *ServConfig, s *Schedule) (*scheduler, error) {
+	var err error
+
+	if s.Name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	if s.Table == "" && s.Blob == "" && s.URL == "" {
+		return nil, errors.New("no table, blob or url to deliver the result to")
+	}
+
+	sc := &scheduler{servConf: servConf, s: s, timeout: s.Timeout}
+
+	if sc.spec, err = parseCron(s.Cron); err != nil {
+		return nil, err
+	}
+
+	if len(s.Vars) != 0 {
+		if sc.vars, err = json.Marshal(s.Vars); err != nil {
+			return nil, err
+		}
+	}
+
+	if sc.timeout == 0 {
+		sc.timeout = defaultScheduleTimeout
+	}
+
+	if s.Blob != "" {
+		if sc.blobs, err = core.NewS3BlobStore(servConf.conf.Blobs); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.URL != "" {
+		sc.client = &http.Client{Timeout: sc.timeout}
+	}
+
+	return sc, nil
+}
+
+func (sc *scheduler) start() {
+	for {
+		now := time.Now()
+		next := sc.spec.next(now)
+
+		if next.IsZero() {
+			sc.servConf.log.Printf("WRN schedule %s: never runs", sc.s.Name)
+			return
+		}
+		time.Sleep(next.Sub(now))
+
+		if err := sc.run(); err != nil {
+			sc.servConf.log.Printf("ERR schedule %s: %s", sc.s.Name, err)
+		}
+	}
+}
+
+// run runs the query and delivers the result
+func (sc *scheduler) run() error {
+	ct, cancel := context.WithTimeout(context.Background(), sc.timeout)
+	defer cancel()
+
+	role := "anon"
+
+	if sc.s.UserID != "" {
+		ct = context.WithValue(ct, core.UserIDKey, sc.s.UserID)
+		role = "user"
+	}
+
+	query, err := sc.query(role)
+	if err != nil {
+		return err
+	}
+
+	st := time.Now()
+
+	res, err := graphQL(ct, query, sc.vars)
+	if err != nil {
+		return err
+	}
+
+	return sc.deliver(ct, st, res.Data)
+}
+
+// query returns the query of the schedule from the allow list
+func (sc *scheduler) query(role string) (string, error) {
+	ops, err := graph().Operations(role)
+	if err != nil {
+		return "", err
+	}
+
+	for _, op := range ops {
+		if op.Name != sc.s.Name {
+			continue
+		}
+		if op.Type != core.OpQuery {
+			return "", errors.New("only queries can be scheduled")
+		}
+		return op.Query, nil
+	}
+
+	return "", errors.New("query not found in the allow list")
+}
+
+// deliver writes the result to the table, object storage and webhook of
+// the schedule, the first error is returned
+func (sc *scheduler) deliver(ct context.Context, at time.Time, data json.RawMessage) error {
+	var errs []error
+
+	if sc.s.Table != "" {
+		if err := sc.insert(ct, data); err != nil {
+			errs = append(errs, fmt.Errorf("table %s: %w", sc.s.Table, err))
+		}
+	}
+
+	if sc.blobs != nil {
+		key := sc.s.Blob + sc.s.Name + "/" + at.UTC().Format("20060102T150405Z") + ".json"
+
+		if err := sc.blobs.Put(ct, key, "application/json", data); err != nil {
+			errs = append(errs, fmt.Errorf("blob %s: %w", key, err))
+		}
+	}
+
+	if sc.client != nil {
+		if err := sc.post(ct, at, data); err != nil {
+			errs = append(errs, fmt.Errorf("url %s: %w", sc.s.URL, err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func (sc *scheduler) insert(ct context.Context, data json.RawMessage) error {
+	if sc.servConf.db == nil {
+		return errors.New("no database")
+	}
+
+	t := pgx.Identifier(strings.Split(sc.s.Table, ".")).Sanitize()
+
+	_, err := sc.servConf.db.ExecContext(ct,
+		`INSERT INTO `+t+` (name, data) VALUES ($1, $2)`, sc.s.Name, string(data))
+
+	return err
+}
+
+func (sc *scheduler) post(ct context.Context, at time.Time, data json.RawMessage) error {
+	body, err := json.Marshal(struct {
+		Name string          `json:"name"`
+		Time time.Time       `json:"time"`
+		Data json.RawMessage `json:"data"`
+	}{sc.s.Name, at.UTC(), data})
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", sc.s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ct)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// cronSpec is a cron schedule, the fields are bitsets of the minutes,
+// hours, days of the month, months and days of the week it runs on
+type cronSpec struct {
+	min, hour, dom, month, dow uint64
+	domAll, dowAll             bool
+	every                      time.Duration
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses a cron expression with the five standard fields
+// (minute hour day-of-month month day-of-week), a macro like @daily
+// or an interval like @every 1h30m
+func parseCron(s string) (*cronSpec, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.HasPrefix(s, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(s[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("cron: %w", err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("cron: interval too short: %s", d)
+		}
+		return &cronSpec{every: d}, nil
+	}
+
+	if v, ok := cronMacros[s]; ok {
+		s = v
+	}
+
+	f := strings.Fields(s)
+	if len(f) != 5 {
+		return nil, fmt.Errorf("cron: expected 5 fields: %s", s)
+	}
+
+	var c cronSpec
+	var err error
+
+	if c.min, err = parseCronField(f[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(f[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(f[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(f[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(f[4], 0, 7); err != nil {
+		return nil, err
+	}
+
+	// 7 is also sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	c.domAll = f[2][0] == '*'
+	c.dowAll = f[4][0] == '*'
+
+	return &c, nil
+}
+
+// parseCronField parses a list of values, ranges (1-5) and steps (*/15 or 1-30/5)
+func parseCronField(f string, min, max int) (uint64, error) {
+	var set uint64
+
+	for _, v := range strings.Split(f, ",") {
+		step := 1
+
+		if i := strings.IndexByte(v, '/'); i != -1 {
+			n, err := strconv.Atoi(v[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("cron: invalid step: %s", f)
+			}
+			step, v = n, v[:i]
+		}
+
+		lo, hi := min, max
+
+		if v != "*" {
+			var err error
+			r := strings.SplitN(v, "-", 2)
+
+			if lo, err = strconv.Atoi(r[0]); err != nil {
+				return 0, fmt.Errorf("cron: invalid value: %s", f)
+			}
+
+			switch {
+			case len(r) == 2:
+				if hi, err = strconv.Atoi(r[1]); err != nil {
+					return 0, fmt.Errorf("cron: invalid value: %s", f)
+				}
+			case step == 1:
+				hi = lo
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("cron: value out of range: %s", f)
+		}
+
+		for i := lo; i <= hi; i += step {
+			set |= 1 << uint(i)
+		}
+	}
+
+	return set, nil
+}
+
+// next returns the time it runs next after t, it's zero if it never runs
+func (c *cronSpec) next(t time.Time) time.Time {
+	if c.every != 0 {
+		return t.Add(c.every)
+	}
+
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	end := t.AddDate(5, 0, 0)
+
+	for t.Before(end) {
+		y, m, d := t.Date()
+
+		switch {
+		case c.month&(1<<uint(m)) == 0:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+
+		case !c.dayMatch(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+
+		case c.min&(1<<uint(t.Minute())) == 0:
+			// skip to the next minute it runs on in the hour
+			n := bits.TrailingZeros64(c.min >> uint(t.Minute()+1))
+			if t.Minute()+1+n > 59 {
+				t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+			} else {
+				t = t.Add(time.Duration(n+1) * time.Minute)
+			}
+
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// dayMatch follows cron, when both the day of the month and the day of the
+// week are restricted either can match
+func (c *cronSpec) dayMatch(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domAll || c.dowAll {
+		return dom && dow
+	}
+	return dom || dow
+}
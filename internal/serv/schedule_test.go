@@ -0,0 +1,101 @@
+package serv
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// a wednesday
+	now := time.Date(2020, 4, 15, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		cron string
+		exp  string
+	}{
+		{"* * * * *", "2020-04-15 10:18"},
+		{"*/15 * * * *", "2020-04-15 10:30"},
+		{"5 * * * *", "2020-04-15 11:05"},
+		{"0 6 * * *", "2020-04-16 06:00"},
+		{"@daily", "2020-04-16 00:00"},
+		{"@hourly", "2020-04-15 11:00"},
+		{"30 9 * * 1-5", "2020-04-16 09:30"},
+		{"0 0 * * 7", "2020-04-19 00:00"},
+		{"0 0 1,15 * *", "2020-05-01 00:00"},
+		{"0 0 13 * 5", "2020-04-17 00:00"},
+		{"0 12 29 2 *", "2024-02-29 12:00"},
+		{"10-20/5 8 * 6 *", "2020-06-01 08:10"},
+	}
+
+	for _, v := range tests {
+		c, err := parseCron(v.cron)
+		if err != nil {
+			t.Fatalf("%s: %s", v.cron, err)
+		}
+
+		if next := c.next(now).Format("2006-01-02 15:04"); next != v.exp {
+			t.Fatalf("%s: expected %s got %s", v.cron, v.exp, next)
+		}
+	}
+
+	c, err := parseCron("@every 90m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next := c.next(now); next.Sub(now) != 90*time.Minute {
+		t.Fatalf("expected 90m got %s", next.Sub(now))
+	}
+
+	if c, err := parseCron("0 0 30 2 *"); err != nil || !c.next(now).IsZero() {
+		t.Fatalf("expected a schedule that never runs: %v", err)
+	}
+
+	for _, v := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@every 1ms"} {
+		if _, err := parseCron(v); err == nil {
+			t.Fatalf("%s: expected an error", v)
+		}
+	}
+}
+
+func TestScheduleDeliver(t *testing.T) {
+	var body struct {
+		Name string
+		Time time.Time
+		Data json.RawMessage
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer ts.Close()
+
+	s := &Schedule{Name: "dailySales", Cron: "@daily", URL: ts.URL}
+
+	sc, err := newScheduler(&ServConfig{conf: &Config{}}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2020, 4, 15, 0, 0, 0, 0, time.UTC)
+
+	if err := sc.deliver(context.Background(), at, json.RawMessage(`{"sales":[1,2]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Name != "dailySales" || !body.Time.Equal(at) || string(body.Data) != `{"sales":[1,2]}` {
+		t.Fatalf("unexpected body: %+v", body)
+	}
+
+	if _, err := newScheduler(&ServConfig{conf: &Config{}}, &Schedule{Name: "x", Cron: "@daily"}); err == nil {
+		t.Fatal("expected an error for no delivery")
+	}
+}
@@ -0,0 +1,341 @@
+package serv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// The levels of the schema changes, breaking changes fail existing
+// queries while dangerous ones can change what existing clients get
+const (
+	changeBreaking  = "BREAKING"
+	changeDangerous = "DANGEROUS"
+	changeSafe      = "SAFE"
+)
+
+// schemaChange is a change found between two schema snapshots
+type schemaChange struct {
+	Level   string
+	Path    string
+	Message string
+}
+
+func (sc schemaChange) String() string {
+	return fmt.Sprintf("%s\t%s: %s", sc.Level, sc.Path, sc.Message)
+}
+
+// introSchema is the schema in the result of an introspection query
+type introSchema struct {
+	Types []introType `json:"types"`
+}
+
+type introType struct {
+	Kind          string         `json:"kind"`
+	Name          string         `json:"name"`
+	Fields        []introField   `json:"fields"`
+	InputFields   []introInput   `json:"inputFields"`
+	Interfaces    []introTypeRef `json:"interfaces"`
+	EnumValues    []introEnum    `json:"enumValues"`
+	PossibleTypes []introTypeRef `json:"possibleTypes"`
+}
+
+type introField struct {
+	Name string       `json:"name"`
+	Args []introInput `json:"args"`
+	Type introTypeRef `json:"type"`
+}
+
+type introInput struct {
+	Name         string       `json:"name"`
+	Type         introTypeRef `json:"type"`
+	DefaultValue *string      `json:"defaultValue"`
+}
+
+type introEnum struct {
+	Name string `json:"name"`
+}
+
+type introTypeRef struct {
+	Kind   string        `json:"kind"`
+	Name   string        `json:"name"`
+	OfType *introTypeRef `json:"ofType"`
+}
+
+func (t introTypeRef) String() string {
+	switch {
+	case t.Kind == "NON_NULL" && t.OfType != nil:
+		return t.OfType.String() + "!"
+	case t.Kind == "LIST" && t.OfType != nil:
+		return "[" + t.OfType.String() + "]"
+	}
+	return t.Name
+}
+
+// of returns the type wrapped by a list or non-null type
+func (t introTypeRef) of() introTypeRef {
+	if t.OfType == nil {
+		return introTypeRef{}
+	}
+	return *t.OfType
+}
+
+// parseSchemaSnapshot reads the result of an introspection query,
+// with or without the data key around it
+func parseSchemaSnapshot(b []byte) (*introSchema, error) {
+	var v struct {
+		Data *struct {
+			Schema *introSchema `json:"__schema"`
+		} `json:"data"`
+		Schema *introSchema `json:"__schema"`
+	}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case v.Schema != nil:
+		return v.Schema, nil
+	case v.Data != nil && v.Data.Schema != nil:
+		return v.Data.Schema, nil
+	}
+
+	return nil, errors.New("no __schema found, expected the result of an introspection query")
+}
+
+// diffSchema returns the changes from the old to the new schema snapshot
+// sorted by level (breaking first) and path
+func diffSchema(old, new *introSchema) []schemaChange {
+	var sd schemaDiff
+
+	nt := make(map[string]*introType, len(new.Types))
+	for i := range new.Types {
+		nt[new.Types[i].Name] = &new.Types[i]
+	}
+
+	ot := make(map[string]struct{}, len(old.Types))
+
+	for i := range old.Types {
+		o := &old.Types[i]
+		ot[o.Name] = struct{}{}
+
+		n, ok := nt[o.Name]
+		if !ok {
+			sd.add(changeBreaking, o.Name, "type removed")
+			continue
+		}
+
+		if o.Kind != n.Kind {
+			sd.add(changeBreaking, o.Name, fmt.Sprintf("type changed from %s to %s", o.Kind, n.Kind))
+			continue
+		}
+
+		switch o.Kind {
+		case "OBJECT", "INTERFACE":
+			sd.fields(o, n)
+			sd.typeRefs(o.Name, o.Interfaces, n.Interfaces, "interface")
+		case "INPUT_OBJECT":
+			sd.inputFields(o, n)
+		case "ENUM":
+			sd.enumValues(o, n)
+		case "UNION":
+			sd.typeRefs(o.Name, o.PossibleTypes, n.PossibleTypes, "union member")
+		}
+	}
+
+	for _, n := range new.Types {
+		if _, ok := ot[n.Name]; !ok {
+			sd.add(changeSafe, n.Name, "type added")
+		}
+	}
+
+	level := map[string]int{changeBreaking: 0, changeDangerous: 1, changeSafe: 2}
+
+	sort.SliceStable(sd.changes, func(i, j int) bool {
+		ci, cj := sd.changes[i], sd.changes[j]
+		if ci.Level != cj.Level {
+			return level[ci.Level] < level[cj.Level]
+		}
+		return ci.Path < cj.Path
+	})
+
+	return sd.changes
+}
+
+type schemaDiff struct {
+	changes []schemaChange
+}
+
+func (sd *schemaDiff) add(level, path, msg string) {
+	sd.changes = append(sd.changes, schemaChange{Level: level, Path: path, Message: msg})
+}
+
+func (sd *schemaDiff) fields(o, n *introType) {
+	nf := make(map[string]*introField, len(n.Fields))
+	for i := range n.Fields {
+		nf[n.Fields[i].Name] = &n.Fields[i]
+	}
+
+	of := make(map[string]struct{}, len(o.Fields))
+
+	for i := range o.Fields {
+		f := &o.Fields[i]
+		path := o.Name + "." + f.Name
+		of[f.Name] = struct{}{}
+
+		n, ok := nf[f.Name]
+		if !ok {
+			sd.add(changeBreaking, path, "field removed")
+			continue
+		}
+
+		if !safeOutputType(f.Type, n.Type) {
+			sd.add(changeBreaking, path, fmt.Sprintf("field type changed from %s to %s", f.Type, n.Type))
+		} else if f.Type.String() != n.Type.String() {
+			sd.add(changeSafe, path, fmt.Sprintf("field type changed from %s to %s", f.Type, n.Type))
+		}
+
+		sd.inputs(path, "argument", f.Args, n.Args)
+	}
+
+	for _, f := range n.Fields {
+		if _, ok := of[f.Name]; !ok {
+			sd.add(changeSafe, o.Name+"."+f.Name, "field added")
+		}
+	}
+}
+
+func (sd *schemaDiff) inputFields(o, n *introType) {
+	sd.inputs(o.Name, "input field", o.InputFields, n.InputFields)
+}
+
+// inputs compares arguments and input fields, they are
+// the values sent by clients
+func (sd *schemaDiff) inputs(parent, kind string, old, new []introInput) {
+	nv := make(map[string]*introInput, len(new))
+	for i := range new {
+		nv[new[i].Name] = &new[i]
+	}
+
+	ov := make(map[string]struct{}, len(old))
+
+	for i := range old {
+		o := &old[i]
+		path := parent + "." + o.Name
+		ov[o.Name] = struct{}{}
+
+		n, ok := nv[o.Name]
+		if !ok {
+			sd.add(changeBreaking, path, kind+" removed")
+			continue
+		}
+
+		if !safeInputType(o.Type, n.Type) {
+			sd.add(changeBreaking, path, fmt.Sprintf("%s type changed from %s to %s", kind, o.Type, n.Type))
+		} else if o.Type.String() != n.Type.String() {
+			sd.add(changeSafe, path, fmt.Sprintf("%s type changed from %s to %s", kind, o.Type, n.Type))
+		}
+
+		if o.DefaultValue != nil && (n.DefaultValue == nil || *o.DefaultValue != *n.DefaultValue) {
+			sd.add(changeDangerous, path, kind+" default value changed")
+		}
+	}
+
+	for i := range new {
+		n := &new[i]
+		if _, ok := ov[n.Name]; ok {
+			continue
+		}
+
+		if n.Type.Kind == "NON_NULL" && n.DefaultValue == nil {
+			sd.add(changeBreaking, parent+"."+n.Name, "required "+kind+" added")
+		} else {
+			sd.add(changeDangerous, parent+"."+n.Name, "optional "+kind+" added")
+		}
+	}
+}
+
+func (sd *schemaDiff) enumValues(o, n *introType) {
+	nv := make(map[string]struct{}, len(n.EnumValues))
+	for _, v := range n.EnumValues {
+		nv[v.Name] = struct{}{}
+	}
+
+	ov := make(map[string]struct{}, len(o.EnumValues))
+
+	for _, v := range o.EnumValues {
+		ov[v.Name] = struct{}{}
+		if _, ok := nv[v.Name]; !ok {
+			sd.add(changeBreaking, o.Name+"."+v.Name, "enum value removed")
+		}
+	}
+
+	// clients that switch on the values may not handle the new ones
+	for _, v := range n.EnumValues {
+		if _, ok := ov[v.Name]; !ok {
+			sd.add(changeDangerous, o.Name+"."+v.Name, "enum value added")
+		}
+	}
+}
+
+// typeRefs compares the interfaces of an object or the members of a union
+func (sd *schemaDiff) typeRefs(parent string, old, new []introTypeRef, kind string) {
+	nv := make(map[string]struct{}, len(new))
+	for _, t := range new {
+		nv[t.Name] = struct{}{}
+	}
+
+	ov := make(map[string]struct{}, len(old))
+
+	for _, t := range old {
+		ov[t.Name] = struct{}{}
+		if _, ok := nv[t.Name]; !ok {
+			sd.add(changeBreaking, parent, kind+" "+t.Name+" removed")
+		}
+	}
+
+	for _, t := range new {
+		if _, ok := ov[t.Name]; !ok {
+			sd.add(changeDangerous, parent, kind+" "+t.Name+" added")
+		}
+	}
+}
+
+// safeOutputType returns true if queries of a field of the old type
+// still work with the new one, a nullable field can become non-null
+func safeOutputType(old, new introTypeRef) bool {
+	switch {
+	case old.Kind == "NON_NULL":
+		return new.Kind == "NON_NULL" && safeOutputType(old.of(), new.of())
+
+	case new.Kind == "NON_NULL":
+		return safeOutputType(old, new.of())
+
+	case old.Kind == "LIST":
+		return new.Kind == "LIST" && safeOutputType(old.of(), new.of())
+	}
+
+	return new.Kind != "LIST" && old.Name == new.Name
+}
+
+// safeInputType returns true if values sent for the old type are still
+// valid for the new one, a required value can become optional
+func safeInputType(old, new introTypeRef) bool {
+	switch {
+	case old.Kind == "NON_NULL":
+		if new.Kind == "NON_NULL" {
+			return safeInputType(old.of(), new.of())
+		}
+		return safeInputType(old.of(), new)
+
+	case new.Kind == "NON_NULL":
+		return false
+
+	case old.Kind == "LIST":
+		return new.Kind == "LIST" && safeInputType(old.of(), new.of())
+	}
+
+	return new.Kind != "LIST" && old.Name == new.Name
+}
@@ -0,0 +1,77 @@
+package serv
+
+import (
+	"strings"
+	"testing"
+)
+
+const oldSchema = `{"data":{"__schema":{"types":[
+	{"kind":"OBJECT","name":"user","fields":[
+		{"name":"id","args":[],"type":{"kind":"NON_NULL","ofType":{"kind":"SCALAR","name":"Int"}}},
+		{"name":"email","args":[],"type":{"kind":"SCALAR","name":"String"}},
+		{"name":"name","args":[],"type":{"kind":"SCALAR","name":"String"}},
+		{"name":"age","args":[],"type":{"kind":"NON_NULL","ofType":{"kind":"SCALAR","name":"Int"}}}
+	]},
+	{"kind":"INPUT_OBJECT","name":"userInput","inputFields":[
+		{"name":"email","type":{"kind":"NON_NULL","ofType":{"kind":"SCALAR","name":"String"}}},
+		{"name":"name","type":{"kind":"SCALAR","name":"String"}}
+	]},
+	{"kind":"ENUM","name":"status","enumValues":[{"name":"active"},{"name":"banned"}]},
+	{"kind":"OBJECT","name":"tag","fields":[]}
+]}}}`
+
+const newSchema = `{"__schema":{"types":[
+	{"kind":"OBJECT","name":"user","fields":[
+		{"name":"id","args":[],"type":{"kind":"NON_NULL","ofType":{"kind":"SCALAR","name":"Int"}}},
+		{"name":"email","args":[],"type":{"kind":"NON_NULL","ofType":{"kind":"SCALAR","name":"String"}}},
+		{"name":"age","args":[],"type":{"kind":"SCALAR","name":"Int"}},
+		{"name":"bio","args":[],"type":{"kind":"SCALAR","name":"String"}}
+	]},
+	{"kind":"INPUT_OBJECT","name":"userInput","inputFields":[
+		{"name":"email","type":{"kind":"SCALAR","name":"String"}},
+		{"name":"name","type":{"kind":"SCALAR","name":"String"}},
+		{"name":"age","type":{"kind":"NON_NULL","ofType":{"kind":"SCALAR","name":"Int"}}}
+	]},
+	{"kind":"ENUM","name":"status","enumValues":[{"name":"active"},{"name":"pending"}]},
+	{"kind":"OBJECT","name":"product","fields":[]}
+]}}`
+
+func TestDiffSchema(t *testing.T) {
+	old, err := parseSchemaSnapshot([]byte(oldSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	new, err := parseSchemaSnapshot([]byte(newSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, sc := range diffSchema(old, new) {
+		lines = append(lines, sc.String())
+	}
+
+	exp := []string{
+		"BREAKING\tstatus.banned: enum value removed",
+		"BREAKING\ttag: type removed",
+		"BREAKING\tuser.age: field type changed from Int! to Int",
+		"BREAKING\tuser.name: field removed",
+		"BREAKING\tuserInput.age: required input field added",
+		"DANGEROUS\tstatus.pending: enum value added",
+		"SAFE\tproduct: type added",
+		"SAFE\tuser.bio: field added",
+		"SAFE\tuser.email: field type changed from String to String!",
+		"SAFE\tuserInput.email: input field type changed from String! to String",
+	}
+
+	if got := strings.Join(lines, "\n"); got != strings.Join(exp, "\n") {
+		t.Fatalf("expected:\n%s\ngot:\n%s", strings.Join(exp, "\n"), got)
+	}
+}
+
+func TestParseSchemaSnapshotInvalid(t *testing.T) {
+	if _, err := parseSchemaSnapshot([]byte(`{"data":{}}`)); err == nil {
+		t.Fatal("expected an error for a snapshot with no schema")
+	}
+}
@@ -0,0 +1,137 @@
+package serv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"path"
+	"reflect"
+	"text/template"
+
+	"github.com/dosco/super-graph/core"
+	"gopkg.in/yaml.v2"
+)
+
+// seedStep is a query of a seed template, the template renders a yaml list
+// of them (eg. `- query: "mutation { users(insert: $data) { id } }"`)
+type seedStep struct {
+	Query     string      `yaml:"query"`
+	Variables interface{} `yaml:"variables"`
+	UserID    string      `yaml:"user_id"`
+}
+
+// runSeedTemplate renders the seed template and runs its queries in order
+// with the GraphQL api, a failed query stops the seeding
+func runSeedTemplate(servConf *ServConfig, sg *core.SuperGraph, name string, b []byte) error {
+	steps, err := parseSeedTemplate(name, b)
+	if err != nil {
+		return err
+	}
+
+	for i, st := range steps {
+		ct := context.Background()
+
+		if st.UserID != "" {
+			ct = context.WithValue(ct, core.UserIDKey, st.UserID)
+		}
+
+		vars, err := json.Marshal(jsonValue(st.Variables))
+		if err != nil {
+			return fmt.Errorf("query %d: %w", i+1, err)
+		}
+
+		if servConf.conf.Debug {
+			servConf.log.Printf("INF %s", st.Query)
+		}
+
+		if _, err := sg.GraphQL(ct, st.Query, vars); err != nil {
+			return fmt.Errorf("query %d: %w", i+1, err)
+		}
+	}
+
+	servConf.log.Printf("INF %d seed queries done", len(steps))
+	return nil
+}
+
+// parseSeedTemplate renders the seed template with the fake data and
+// util functions of seed scripts and returns the queries in it
+func parseSeedTemplate(name string, b []byte) ([]seedStep, error) {
+	fm := template.FuncMap{
+		"seq":      seq,
+		"add":      func(a, b int) int { return a + b },
+		"rand_int": rand.Intn,
+		"json":     toJSON,
+	}
+
+	// functions that change their arguments (eg. shuffle_ints) are left out
+	set := func(k string, v interface{}) {
+		if reflect.TypeOf(v).NumOut() == 1 {
+			fm[k] = v
+		}
+	}
+	setFakeFuncs(set)
+	setUtilFuncs(set)
+
+	t, err := template.New(path.Base(name)).Funcs(fm).Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	var w bytes.Buffer
+
+	if err := t.Execute(&w, nil); err != nil {
+		return nil, err
+	}
+
+	var steps []seedStep
+
+	if err := yaml.Unmarshal(w.Bytes(), &steps); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	for i, st := range steps {
+		if st.Query == "" {
+			return nil, fmt.Errorf("%s: query %d: no query found", name, i+1)
+		}
+	}
+
+	return steps, nil
+}
+
+// seq returns the numbers from 0 to n-1 to range over in a template
+func seq(n int) []int {
+	v := make([]int, n)
+	for i := range v {
+		v[i] = i
+	}
+	return v
+}
+
+// toJSON returns the value as json, it's valid yaml for strings
+// with quotes or newlines (eg. `bio: {{ json (sentence 10) }}`)
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// jsonValue returns the value decoded from yaml with
+// the keys of its maps as strings so it can be json
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = jsonValue(val)
+		}
+		return m
+
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+		return v
+	}
+	return v
+}
@@ -0,0 +1,66 @@
+package serv
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseSeedTemplate(t *testing.T) {
+	tmpl := `
+{{- range $i := seq 3 }}
+- query: |
+    mutation { users(insert: $data) { id } }
+  variables:
+    data:
+      id: {{ add $i 1 }}
+      email: {{ json (email) }}
+      bio: {{ json (sentence 5) }}
+      tags: [a, b]
+{{- end }}
+- query: "mutation { products(insert: $data) { id } }"
+  user_id: "1"
+  variables:
+    data: { name: {{ json (make_slug "Pale Ale") }} }
+`
+	steps, err := parseSeedTemplate("seed.yml.tmpl", []byte(tmpl))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(steps) != 4 {
+		t.Fatalf("expected 4 queries got %d", len(steps))
+	}
+
+	var v struct {
+		Data struct {
+			ID    int      `json:"id"`
+			Email string   `json:"email"`
+			Tags  []string `json:"tags"`
+		} `json:"data"`
+	}
+
+	b, err := json.Marshal(jsonValue(steps[2].Variables))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Data.ID != 3 || v.Data.Email == "" || len(v.Data.Tags) != 2 {
+		t.Fatalf("unexpected variables: %s", b)
+	}
+
+	if st := steps[3]; st.UserID != "1" || st.Query != "mutation { products(insert: $data) { id } }" {
+		t.Fatalf("unexpected query: %+v", st)
+	}
+
+	if b, _ := json.Marshal(jsonValue(steps[3].Variables)); string(b) != `{"data":{"name":"pale-ale"}}` {
+		t.Fatalf("unexpected variables: %s", b)
+	}
+
+	if _, err := parseSeedTemplate("seed.yml.tmpl", []byte(`- variables: { a: 1 }`)); err == nil {
+		t.Fatal("expected an error for a step without a query")
+	}
+}
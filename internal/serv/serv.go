@@ -26,11 +26,13 @@ func initWatcher(servConf *ServConfig) {
 		return
 	}
 
+	cb := reloadFn(servConf)
+
 	var d dir
 	if cpath == "" || cpath == "./" {
-		d = Dir("./config", ReExec(servConf))
+		d = Dir("./config", cb)
 	} else {
-		d = Dir(cpath, ReExec(servConf))
+		d = Dir(cpath, cb)
 	}
 
 	go func() {
@@ -41,6 +43,16 @@ func initWatcher(servConf *ServConfig) {
 	}()
 }
 
+// reloadFn returns the function called when the config changes, it rolls
+// out the change to a share of the requests when canary is enabled else
+// the process is restarted
+func reloadFn(servConf *ServConfig) func() {
+	if servConf.conf.Canary.Percent > 0 {
+		return startCanary(servConf)
+	}
+	return ReExec(servConf)
+}
+
 func startHTTP(servConf *ServConfig) {
 	var appName string
 
@@ -85,11 +97,42 @@ func startHTTP(servConf *ServConfig) {
 		srv.Handler = &ochttp.Handler{Handler: routes}
 	}
 
+	ln, addr, err := listen(servConf)
+	if err != nil {
+		servConf.log.Fatalf("ERR %s", err)
+	}
+
+	if servConf.conf.Admin.HostPort != "" {
+		go startAdmin(servConf)
+	}
+
+	if servConf.conf.Internal.HostPort != "" || servConf.conf.Internal.Socket != "" {
+		go startInternal(servConf)
+	}
+
+	// on an upgrade the new binary takes over the listener and
+	// this process keeps the open subscriptions going
+	var upgrading bool
+
 	idleConnsClosed := make(chan struct{})
 	go func() {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
-		<-sigint
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		notifyUpgrade(sig)
+
+		for s := range sig {
+			if !isUpgrade(s) {
+				break
+			}
+
+			if err := upgrade(ln); err != nil {
+				servConf.log.Printf("ERR %s", err)
+				continue
+			}
+			servConf.log.Printf("INF upgrade started, draining connections")
+			upgrading = true
+			break
+		}
 
 		if err := srv.Shutdown(context.Background()); err != nil {
 			servConf.log.Fatalln("INF shutdown signal received")
@@ -98,17 +141,31 @@ func startHTTP(servConf *ServConfig) {
 	}()
 
 	srv.RegisterOnShutdown(func() {
+		if upgrading {
+			drainWs(servConf)
+		}
 		if servConf.conf.closeFn != nil {
 			servConf.conf.closeFn()
 		}
-		servConf.db.Close()
+		if servConf.db != nil {
+			servConf.db.Close()
+		}
+		if servConf.router != nil {
+			servConf.router.close()
+		}
+		closeDatabases(servConf)
 		servConf.log.Fatalln("INF shutdown complete")
 	})
 
+	// the process being upgraded stops accepting connections once told
+	if err := upgradeReady(); err != nil {
+		servConf.log.Printf("ERR %s", err)
+	}
+
 	servConf.log.Printf("INF Super Graph started, version: %s, git-branch: %s, host-port: %s, app-name: %s, env: %s\n",
-		version, gitBranch, servConf.conf.hostPort, appName, env)
+		version, gitBranch, addr, appName, env)
 
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+	if err := srv.Serve(ln); err != http.ErrServerClosed {
 		servConf.log.Fatalln("INF server closed")
 	}
 
@@ -127,6 +184,14 @@ func routeHandler(servConf *ServConfig) (http.Handler, error) {
 		apiRoute = path.Join("/", servConf.conf.APIPath, "/v1/graphql")
 	}
 
+	if err := initUploads(servConf); err != nil {
+		return nil, err
+	}
+
+	if err := initSQLLog(servConf); err != nil {
+		return nil, err
+	}
+
 	routes := map[string]http.Handler{
 		"/health": http.HandlerFunc(health(servConf)),
 		apiRoute:  apiV1Handler(servConf),
@@ -136,6 +201,14 @@ func routeHandler(servConf *ServConfig) (http.Handler, error) {
 		return nil, err
 	}
 
+	if err := setRESTRoutes(servConf, routes); err != nil {
+		return nil, err
+	}
+
+	if !servConf.conf.Production {
+		routes[editorRoute] = http.HandlerFunc(editorHandler(servConf))
+	}
+
 	if servConf.conf.WebUI {
 		routes["/"] = http.FileServer(rice.MustFindBox("./web/build").HTTPBox())
 	}
@@ -159,6 +232,8 @@ func routeHandler(servConf *ServConfig) (http.Handler, error) {
 	}
 
 	fn := func(w http.ResponseWriter, r *http.Request) {
+		defer recoverHTTP(servConf, w, r)
+
 		w.Header().Set("Server", serverName)
 		// rate limiter only apply if it's enable from configuration and for API route
 		// WebUI and health are excluded from rate limiter
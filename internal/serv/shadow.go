@@ -0,0 +1,51 @@
+package serv
+
+import (
+	"fmt"
+
+	"github.com/dosco/super-graph/core"
+	"go.uber.org/zap"
+)
+
+// initShadow connects to the shadow database and replays the
+// read queries on it
+func initShadow(servConf *ServConfig, g *core.SuperGraph) error {
+	var err error
+	c := servConf.conf
+
+	port := c.DB.Shadow.Port
+	if port == 0 {
+		port = c.DB.Port
+	}
+
+	servConf.shadow, err = initDBHost(servConf, c.DB.Shadow.Host, port, true, false)
+	if err != nil {
+		return fmt.Errorf("shadow %s: %w", c.DB.Shadow.Host, err)
+	}
+
+	g.SetShadowDB(servConf.shadow, shadowLog(servConf))
+	return nil
+}
+
+// shadowLog logs the queries that returned a different result or
+// failed on the shadow database
+func shadowLog(servConf *ServConfig) core.ShadowFn {
+	return func(res core.ShadowResult) {
+		fields := []zap.Field{
+			zap.String("name", res.Name),
+			zap.Duration("latency", res.Latency),
+			zap.Duration("shadow_latency", res.ShadowLatency),
+		}
+
+		switch {
+		case res.Err != nil:
+			servConf.zlog.Warn("shadow error", append(fields, zap.Error(res.Err))...)
+
+		case !res.Match:
+			servConf.zlog.Warn("shadow mismatch", append(fields, zap.String("sql", res.SQL))...)
+
+		case servConf.logLevel >= LogLevelDebug:
+			servConf.zlog.Debug("shadow match", fields...)
+		}
+	}
+}
@@ -1,43 +1,145 @@
 package serv
 
-// import (
-// 	"context"
-
-// 	"github.com/jackc/pgx/v4"
-// 	"github.com/rs/zerolog"
-// )
-
-// type Logger struct {
-// 	logger zerolog.Logger
-// }
-
-// // NewLogger accepts a zerolog.Logger as input and returns a new custom pgx
-// // logging fascade as output.
-// func NewSQLLogger(logger zerolog.Logger) *Logger {
-// 	return &Logger{
-// 		logger: // logger.With().Logger(),
-// 	}
-// }
-
-// func (pl *Logger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
-// 	var zlevel zerolog.Level
-// 	switch level {
-// 	case pgx.LogLevelNone:
-// 		zlevel = zerolog.NoLevel
-// 	case pgx.LogLevelError:
-// 		zlevel = zerolog.ErrorLevel
-// 	case pgx.LogLevelWarn:
-// 		zlevel = zerolog.WarnLevel
-// 	case pgx.LogLevelDebug, pgx.LogLevelInfo:
-// 		zlevel = zerolog.DebugLevel
-// 	default:
-// 		zlevel = zerolog.DebugLevel
-// 	}
-
-// 	if sql, ok := data["sql"]; ok {
-// 		delete(data, "sql")
-// 		pl.// logger.WithLevel(zlevel).Fields(data).Msg(sql.(string))
-// 	} else {
-// 		pl.// logger.WithLevel(zlevel).Fields(data).Msg(msg)
-// 	}
-// }
+import (
+	"fmt"
+	"io"
+	_log "log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dosco/super-graph/core"
+)
+
+// sqlLogger writes the sql of the queries with their timing in the format
+// of the Postgres logs (pgbadger) or the MySQL slow query log (slowlog)
+// so log based tools like pgBadger and pt-query-digest can read them
+type sqlLogger struct {
+	log    *_log.Logger
+	format string
+	user   string
+	dbname string
+	app    string
+	pid    int
+}
+
+func initSQLLog(servConf *ServConfig) error {
+	c := servConf.conf
+
+	if c.SQLLog.Format == "" {
+		return nil
+	}
+
+	switch c.SQLLog.Format {
+	case "pgbadger", "slowlog":
+	default:
+		return fmt.Errorf("sql_log: unknown format '%s'", c.SQLLog.Format)
+	}
+
+	var w io.Writer = os.Stdout
+
+	if c.SQLLog.File != "" {
+		f, err := os.OpenFile(c.relPath(c.SQLLog.File), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("sql_log: %w", err)
+		}
+		w = f
+	}
+
+	app := c.AppName
+	if app == "" {
+		app = "super-graph"
+	}
+
+	servConf.sqlLog = &sqlLogger{
+		log:    _log.New(w, "", 0),
+		format: c.SQLLog.Format,
+		user:   c.DB.User,
+		dbname: c.DB.DBName,
+		app:    app,
+		pid:    os.Getpid(),
+	}
+	return nil
+}
+
+// sqlLogEntry is a query written to the sql log
+type sqlLogEntry struct {
+	sql    string
+	name   string
+	role   string
+	dbTime time.Duration
+	at     time.Time
+	err    error
+}
+
+// write logs the sql of the query, results from the cache have none
+func (l *sqlLogger) write(res *core.Result, err error, at time.Time) {
+	if res == nil || res.SQL() == "" {
+		return
+	}
+
+	e := sqlLogEntry{
+		sql:    res.SQL(),
+		name:   res.QueryName(),
+		role:   res.Role(),
+		dbTime: res.DBTime(),
+		at:     at,
+		err:    err,
+	}
+
+	if l.format == "slowlog" {
+		l.log.Print(l.slowlog(e))
+	} else {
+		l.log.Print(l.pgbadger(e))
+	}
+}
+
+// pgbadger returns the query in the format of the Postgres stderr log
+// with the log_line_prefix '%t [%p]: user=%u,db=%d,app=%a '
+func (l *sqlLogger) pgbadger(e sqlLogEntry) string {
+	var sb strings.Builder
+
+	prefix := fmt.Sprintf("%s [%d]: user=%s,db=%s,app=%s ",
+		e.at.UTC().Format("2006-01-02 15:04:05 MST"), l.pid, l.user, l.dbname, l.app)
+
+	// lines after the first start with a tab
+	sql := strings.ReplaceAll(e.sql, "\n", "\n\t")
+
+	sb.WriteString(prefix)
+
+	if e.err != nil {
+		fmt.Fprintf(&sb, "ERROR:  %s\n", strings.ReplaceAll(e.err.Error(), "\n", " "))
+		sb.WriteString(prefix)
+		fmt.Fprintf(&sb, "STATEMENT:  %s", sql)
+	} else {
+		fmt.Fprintf(&sb, "LOG:  duration: %.3f ms  statement: %s",
+			float64(e.dbTime)/float64(time.Millisecond), sql)
+	}
+
+	return sb.String()
+}
+
+// slowlog returns the query in the format of the MySQL slow query log,
+// the user is the role the query was run as
+func (l *sqlLogger) slowlog(e sqlLogEntry) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# Time: %s\n", e.at.UTC().Format("2006-01-02T15:04:05.000000Z"))
+	fmt.Fprintf(&sb, "# User@Host: %s[%s] @ %s []\n", e.role, l.user, l.app)
+
+	if e.name != "" {
+		fmt.Fprintf(&sb, "# Query_name: %s\n", e.name)
+	}
+
+	if e.err != nil {
+		fmt.Fprintf(&sb, "# Error: %s\n", strings.ReplaceAll(e.err.Error(), "\n", " "))
+	}
+
+	fmt.Fprintf(&sb, "# Query_time: %.6f  Lock_time: 0.000000  Rows_sent: 1  Rows_examined: 0\n",
+		e.dbTime.Seconds())
+	fmt.Fprintf(&sb, "use %s;\n", l.dbname)
+	fmt.Fprintf(&sb, "SET timestamp=%d;\n", e.at.Unix())
+	fmt.Fprintf(&sb, "%s;", strings.TrimSuffix(strings.TrimSpace(e.sql), ";"))
+
+	return sb.String()
+}
@@ -0,0 +1,51 @@
+package serv
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSQLLog(t *testing.T) {
+	l := &sqlLogger{user: "postgres", dbname: "app", app: "super-graph", pid: 10}
+
+	e := sqlLogEntry{
+		sql:    "SELECT $1\nFROM products",
+		name:   "getProducts",
+		role:   "user",
+		dbTime: 1500 * time.Microsecond,
+		at:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	exp := "2020-01-02 03:04:05 UTC [10]: user=postgres,db=app,app=super-graph " +
+		"LOG:  duration: 1.500 ms  statement: SELECT $1\n\tFROM products"
+
+	if v := l.pgbadger(e); v != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, v)
+	}
+
+	e.err = errors.New("relation does not exist")
+
+	exp = "2020-01-02 03:04:05 UTC [10]: user=postgres,db=app,app=super-graph " +
+		"ERROR:  relation does not exist\n" +
+		"2020-01-02 03:04:05 UTC [10]: user=postgres,db=app,app=super-graph " +
+		"STATEMENT:  SELECT $1\n\tFROM products"
+
+	if v := l.pgbadger(e); v != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, v)
+	}
+
+	e.err = nil
+
+	exp = "# Time: 2020-01-02T03:04:05.000000Z\n" +
+		"# User@Host: user[postgres] @ super-graph []\n" +
+		"# Query_name: getProducts\n" +
+		"# Query_time: 0.001500  Lock_time: 0.000000  Rows_sent: 1  Rows_examined: 0\n" +
+		"use app;\n" +
+		"SET timestamp=1577934245;\n" +
+		"SELECT $1\nFROM products;"
+
+	if v := l.slowlog(e); v != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, v)
+	}
+}
@@ -1,10 +1,12 @@
 package serv
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 
 	"contrib.go.opencensus.io/exporter/aws"
 	"contrib.go.opencensus.io/exporter/prometheus"
@@ -12,13 +14,138 @@ import (
 
 	"contrib.go.opencensus.io/exporter/zipkin"
 	"contrib.go.opencensus.io/integrations/ocsql"
+	"github.com/dosco/super-graph/core"
 	stdzipkin "github.com/openzipkin/zipkin-go"
 	httpreporter "github.com/openzipkin/zipkin-go/reporter/http"
+	"go.opencensus.io/metric"
+	"go.opencensus.io/metric/metricproducer"
+	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
 	"go.opencensus.io/trace"
 	"go.opencensus.io/zpages"
 )
 
+var (
+	mQueryLatency = stats.Float64("super_graph/query_latency",
+		"Latency of the GraphQL queries", stats.UnitMilliseconds)
+
+	mErrors = stats.Int64("super_graph/errors",
+		"Errors of the GraphQL queries", stats.UnitDimensionless)
+
+	mPanics = stats.Int64("super_graph/panics",
+		"Panics recovered while serving requests", stats.UnitDimensionless)
+
+	// the query tags used as labels, other tags are
+	// left out to keep the number of series low
+	keyQuery   = tag.MustNewKey("query")
+	keyOp      = tag.MustNewKey("operation")
+	keyOwner   = tag.MustNewKey("owner")
+	keyTeam    = tag.MustNewKey("team")
+	keyFeature = tag.MustNewKey("feature")
+
+	// the stage of running the query the error is from (eg. parse or execute)
+	keyCategory = tag.MustNewKey("category")
+
+	queryViews = []*view.View{
+		{
+			Name:        "super_graph/query_count",
+			Description: "Count of GraphQL queries by name and tags",
+			Measure:     mQueryLatency,
+			TagKeys:     []tag.Key{keyQuery, keyOp, keyOwner, keyTeam, keyFeature},
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        "super_graph/query_latency",
+			Description: "Latency of GraphQL queries by name and tags",
+			Measure:     mQueryLatency,
+			TagKeys:     []tag.Key{keyQuery, keyOp, keyOwner, keyTeam, keyFeature},
+			Aggregation: view.Distribution(1, 5, 10, 25, 50, 100, 250, 500, 1000, 5000),
+		},
+		{
+			Name:        "super_graph/error_count",
+			Description: "Count of GraphQL query errors by category, operation and name",
+			Measure:     mErrors,
+			TagKeys:     []tag.Key{keyCategory, keyOp, keyQuery},
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        "super_graph/panic_count",
+			Description: "Count of panics recovered by query name",
+			Measure:     mPanics,
+			TagKeys:     []tag.Key{keyQuery},
+			Aggregation: view.Count(),
+		},
+	}
+)
+
+// recordQuery records the latency of the query with its name and tags
+func recordQuery(ct context.Context, res *core.Result, d time.Duration) {
+	t := res.Tags()
+
+	//nolint: errcheck
+	stats.RecordWithTags(ct, []tag.Mutator{
+		tag.Upsert(keyQuery, res.QueryName()),
+		tag.Upsert(keyOp, res.OperationName()),
+		tag.Upsert(keyOwner, t["owner"]),
+		tag.Upsert(keyTeam, t["team"]),
+		tag.Upsert(keyFeature, t["feature"]),
+	}, mQueryLatency.M(float64(d)/float64(time.Millisecond)))
+}
+
+// recordError records the error with its category (eg. parse or execute)
+// so the errors of clients can be told apart from those of the server
+func recordError(ct context.Context, op, name string, err error) {
+	//nolint: errcheck
+	stats.RecordWithTags(ct, []tag.Mutator{
+		tag.Upsert(keyCategory, core.ErrorCategory(err)),
+		tag.Upsert(keyOp, op),
+		tag.Upsert(keyQuery, name),
+	}, mErrors.M(1))
+}
+
+// recordPanic records a panic recovered while running the query
+func recordPanic(ct context.Context, name string) {
+	//nolint: errcheck
+	stats.RecordWithTags(ct, []tag.Mutator{
+		tag.Upsert(keyQuery, name),
+	}, mPanics.M(1))
+}
+
+// registerCacheMetrics adds the counters of the compiled query
+// cache, the hit rate is hits / (hits + misses)
+func registerCacheMetrics() error {
+	r := metric.NewRegistry()
+
+	counters := []struct {
+		name, desc string
+		fn         func(core.CompileCacheStats) uint64
+	}{
+		{"super_graph/compile_cache_hits", "Queries found in the compiled query cache",
+			func(s core.CompileCacheStats) uint64 { return s.Hits }},
+		{"super_graph/compile_cache_misses", "Queries not found in the compiled query cache",
+			func(s core.CompileCacheStats) uint64 { return s.Misses }},
+		{"super_graph/compile_cache_evictions", "Queries evicted from the compiled query cache",
+			func(s core.CompileCacheStats) uint64 { return s.Evictions }},
+	}
+
+	for _, v := range counters {
+		c, err := r.AddInt64DerivedCumulative(v.name, metric.WithDescription(v.desc))
+		if err != nil {
+			return err
+		}
+
+		fn := v.fn
+		err = c.UpsertEntry(func() int64 { return int64(fn(graph().CompileCacheStats())) })
+		if err != nil {
+			return err
+		}
+	}
+
+	metricproducer.GlobalManager().AddProducer(r)
+	return nil
+}
+
 func enableObservability(servConf *ServConfig, mux *http.ServeMux) (func(), error) {
 	// Enable OpenCensus zPages
 	if servConf.conf.Telemetry.Debug {
@@ -28,6 +155,14 @@ func enableObservability(servConf *ServConfig, mux *http.ServeMux) (func(), erro
 	// Enable ocsql metrics with OpenCensus
 	ocsql.RegisterAllViews()
 
+	if err := view.Register(queryViews...); err != nil {
+		return nil, err
+	}
+
+	if err := registerCacheMetrics(); err != nil {
+		return nil, err
+	}
+
 	var mex view.Exporter
 	var tex trace.Exporter
 
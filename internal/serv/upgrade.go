@@ -0,0 +1,170 @@
+package serv
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// upgradeFdEnv is set for the new process with the
+	// file descriptor of the listener handed over to it
+	upgradeFdEnv = "SG_UPGRADE_FD"
+
+	// upgradeReadyEnv is set for the new process with the file descriptor
+	// of the pipe it writes to once it's listening and ready
+	upgradeReadyEnv = "SG_UPGRADE_READY_FD"
+
+	// upgradeReadyTimeout is how long the new process has to get
+	// ready before the upgrade fails and it's killed
+	upgradeReadyTimeout = time.Minute
+
+	defaultUpgradeTimeout = 5 * time.Minute
+)
+
+// wsConns are the open websocket connections, on an upgrade the old
+// process keeps running till they are closed or the upgrade timeout
+var wsConns sync.WaitGroup
+
+// upgradeListener returns the listener handed over by the process
+// being upgraded if any
+func upgradeListener() (net.Listener, error) {
+	v := os.Getenv(upgradeFdEnv)
+	if v == "" {
+		return nil, nil
+	}
+	os.Unsetenv(upgradeFdEnv)
+
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("upgrade: invalid fd: %s", v)
+	}
+
+	f := os.NewFile(uintptr(fd), "upgrade-listen")
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("upgrade: %w", err)
+	}
+
+	return ln, nil
+}
+
+// upgradeReady tells the process being upgraded that this one is
+// listening and ready, it stops accepting connections once told
+func upgradeReady() error {
+	v := os.Getenv(upgradeReadyEnv)
+	if v == "" {
+		return nil
+	}
+	os.Unsetenv(upgradeReadyEnv)
+
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("upgrade: invalid fd: %s", v)
+	}
+
+	f := os.NewFile(uintptr(fd), "upgrade-ready")
+	defer f.Close()
+
+	if _, err := f.Write([]byte{1}); err != nil {
+		return fmt.Errorf("upgrade: %w", err)
+	}
+	return nil
+}
+
+// upgrade starts the new binary with the listener, it returns once the new
+// process is ready so the old one can stop accepting connections
+func upgrade(ln net.Listener) error {
+	var f *os.File
+	var err error
+
+	switch l := ln.(type) {
+	case *net.TCPListener:
+		f, err = l.File()
+	case *net.UnixListener:
+		// the socket file must stay for the new process
+		l.SetUnlinkOnClose(false)
+		f, err = l.File()
+	default:
+		err = errors.New("listener cannot be handed over")
+	}
+
+	if err != nil {
+		return fmt.Errorf("upgrade: %w", err)
+	}
+	defer f.Close()
+
+	bin, err := self()
+	if err != nil {
+		return err
+	}
+
+	// the new process writes to the pipe once it's ready, the
+	// pipe is closed without a write if it exits before that
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("upgrade: %w", err)
+	}
+	defer r.Close()
+
+	cmd := exec.Command(bin, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{f, w}
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%d", upgradeFdEnv, listenFdsStart),
+		fmt.Sprintf("%s=%d", upgradeReadyEnv, listenFdsStart+1))
+
+	err = cmd.Start()
+	w.Close()
+
+	if err != nil {
+		return fmt.Errorf("upgrade: %w", err)
+	}
+	go cmd.Wait() //nolint: errcheck
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			return fmt.Errorf("upgrade: new process exited before it was ready")
+		}
+	case <-time.After(upgradeReadyTimeout):
+		cmd.Process.Kill() //nolint: errcheck
+		return fmt.Errorf("upgrade: new process not ready after %s", upgradeReadyTimeout)
+	}
+
+	return nil
+}
+
+// drainWs waits for the open websocket connections to close
+func drainWs(servConf *ServConfig) {
+	timeout := servConf.conf.UpgradeTimeout
+	if timeout == 0 {
+		timeout = defaultUpgradeTimeout
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wsConns.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		servConf.log.Printf("WRN upgrade timeout, closing open subscriptions")
+	}
+}
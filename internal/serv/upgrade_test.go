@@ -0,0 +1,83 @@
+//go:build !windows
+// +build !windows
+
+package serv
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestUpgradeListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// the fd is closed by listen once it has the listener so it gets a
+	// copy, closing the fd of f would close whatever reused the number
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(upgradeFdEnv, strconv.Itoa(fd))
+
+	ln1, addr, err := listen(&ServConfig{conf: &Config{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln1.Close()
+
+	if addr != "upgrade:"+ln.Addr().String() {
+		t.Fatalf("unexpected address: %s", addr)
+	}
+
+	if os.Getenv(upgradeFdEnv) != "" {
+		t.Fatal("expected the upgrade fd to be cleared")
+	}
+}
+
+func TestUpgradeReady(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	fd, err := syscall.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	os.Setenv(upgradeReadyEnv, strconv.Itoa(fd))
+
+	if err := upgradeReady(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 2)
+	if n, _ := r.Read(b); n != 1 {
+		t.Fatalf("expected the ready byte got %d bytes", n)
+	}
+
+	// the pipe is closed once the byte is written
+	if _, err := r.Read(b); err == nil {
+		t.Fatal("expected the pipe to be closed")
+	}
+
+	if os.Getenv(upgradeReadyEnv) != "" {
+		t.Fatal("expected the ready fd to be cleared")
+	}
+}
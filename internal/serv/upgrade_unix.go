@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package serv
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyUpgrade relays the upgrade signal (SIGUSR2)
+func notifyUpgrade(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR2)
+}
+
+func isUpgrade(sig os.Signal) bool {
+	return sig == syscall.SIGUSR2
+}
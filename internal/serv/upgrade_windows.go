@@ -0,0 +1,14 @@
+package serv
+
+import (
+	"os"
+)
+
+// notifyUpgrade does nothing since binary upgrades
+// are not supported on windows
+func notifyUpgrade(c chan<- os.Signal) {
+}
+
+func isUpgrade(sig os.Signal) bool {
+	return false
+}
@@ -0,0 +1,482 @@
+package serv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dosco/super-graph/core"
+)
+
+const (
+	defaultUploadMaxSize  = 10 << 20 // 10MB
+	defaultUploadMaxFiles = 10
+)
+
+var (
+	errUploadSize = errors.New("upload: file too large")
+	errUploadOp   = errors.New("upload: files can only be sent with mutations")
+)
+
+// uploadStore stores the uploaded files by key
+type uploadStore interface {
+	put(ct context.Context, key, mime string, r io.Reader) error
+	del(ct context.Context, key string) error
+}
+
+// upload is a stored file
+type upload struct {
+	key  string
+	url  string
+	name string
+	mime string
+	size int64
+
+	// reqs is the number of requests using the file and failed the ones
+	// of them that failed, it's deleted once all of them have
+	reqs   int
+	failed int
+}
+
+// initUploads sets up the store of the files uploaded with GraphQL multipart
+// requests, a local directory or the object storage of the blobs config
+func initUploads(servConf *ServConfig) error {
+	c := servConf.conf
+
+	if !c.Uploads.Enable {
+		return nil
+	}
+
+	if c.Uploads.Dir != "" {
+		dir := c.relPath(c.Uploads.Dir)
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("uploads: %w", err)
+		}
+		servConf.uploads = diskStore{dir: dir}
+		return nil
+	}
+
+	bs, err := core.NewS3BlobStore(c.Blobs)
+	if err != nil {
+		return fmt.Errorf("uploads: %w", err)
+	}
+	servConf.uploads = blobUploads{bs: bs}
+
+	return nil
+}
+
+func isMultipart(r *http.Request) bool {
+	return r.Method == http.MethodPost &&
+		strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data")
+}
+
+// decodeUpload decodes a GraphQL multipart request (github.com/jaydenseric/graphql-multipart-request-spec),
+// the files are stored as they're read and each is replaced in the variables with its url. Next
+// to it the size, mime type, name and key of the file are set (eg. file_size for file). The
+// operations are checked before any file is stored and the stored files are deleted on an error
+func decodeUpload(servConf *ServConfig, ct context.Context, r *http.Request) (reqs []gqlReq, batch bool, err error) {
+	if servConf.uploads == nil {
+		return nil, false, errors.New("uploads are not enabled")
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, false, err
+	}
+
+	b, err := readFormField(mr, "operations")
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ops interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	if err := dec.Decode(&ops); err != nil {
+		return nil, false, fmt.Errorf("operations: %w", err)
+	}
+
+	if err := checkUpload(servConf, ct, b); err != nil {
+		return nil, false, err
+	}
+
+	if b, err = readFormField(mr, "map"); err != nil {
+		return nil, false, err
+	}
+
+	var files map[string][]string
+
+	if err := json.Unmarshal(b, &files); err != nil {
+		return nil, false, fmt.Errorf("map: %w", err)
+	}
+
+	uc := &servConf.conf.Uploads
+
+	maxFiles := uc.MaxFiles
+	if maxFiles == 0 {
+		maxFiles = defaultUploadMaxFiles
+	}
+
+	if len(files) > maxFiles {
+		return nil, false, fmt.Errorf("upload: too many files (max %d)", maxFiles)
+	}
+
+	// the requests using each file by the index of the request
+	used := make(map[*upload]map[int]struct{})
+
+	defer func() {
+		if err != nil {
+			for f := range used {
+				delUpload(servConf, ct, f)
+			}
+		}
+	}()
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		name := part.FormName()
+
+		paths, ok := files[name]
+		if !ok {
+			part.Close()
+			return nil, false, fmt.Errorf("upload: file %s is not in the map", name)
+		}
+		delete(files, name)
+
+		f, err := storeUpload(servConf, ct, part)
+		part.Close()
+
+		if err != nil {
+			return nil, false, err
+		}
+		used[f] = make(map[int]struct{})
+
+		for _, p := range paths {
+			if err := setUpload(ops, p, f); err != nil {
+				return nil, false, err
+			}
+			used[f][uploadReq(ops, p)] = struct{}{}
+		}
+	}
+
+	for name := range files {
+		return nil, false, fmt.Errorf("upload: file %s is missing", name)
+	}
+
+	if b, err = json.Marshal(ops); err != nil {
+		return nil, false, err
+	}
+
+	if reqs, batch, err = decodeBody(b); err != nil {
+		return nil, false, err
+	}
+
+	for f, v := range used {
+		for i := range v {
+			if i < len(reqs) {
+				reqs[i].uploads = append(reqs[i].uploads, f)
+				f.reqs++
+			}
+		}
+	}
+
+	return reqs, batch, nil
+}
+
+// checkUpload returns an error if the operations can't be sent files, they
+// have to be mutations the role of the request can run and upload with
+func checkUpload(servConf *ServConfig, ct context.Context, ops []byte) error {
+	reqs, _, err := decodeBody(ops)
+	if err != nil {
+		return err
+	}
+
+	for i := range reqs {
+		query, err := reqQuery(ct, &reqs[i])
+		if err != nil {
+			return err
+		}
+
+		if core.Operation(query) != core.OpMutation {
+			return errUploadOp
+		}
+
+		role, err := graph().Authorize(ct, query, reqs[i].Vars)
+		if err != nil {
+			return err
+		}
+
+		if !uploadRole(servConf, role) {
+			return fmt.Errorf("upload: role '%s' can't upload files", role)
+		}
+	}
+
+	return nil
+}
+
+// uploadRole returns true if the role can upload files, when the
+// roles are not set any role but anon can
+func uploadRole(servConf *ServConfig, role string) bool {
+	roles := servConf.conf.Uploads.Roles
+
+	if len(roles) == 0 {
+		return role != "anon"
+	}
+
+	for _, v := range roles {
+		if v == role {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadReq returns the index of the request of a batch the path is
+// in (eg. 1.variables.file) or zero when it's not a batch
+func uploadReq(ops interface{}, path string) int {
+	if _, ok := ops.([]interface{}); !ok {
+		return 0
+	}
+
+	n := strings.IndexByte(path, '.')
+	if n == -1 {
+		return 0
+	}
+
+	i, _ := strconv.Atoi(path[:n])
+	return i
+}
+
+// discardUploads is called for a request that failed or was rolled back,
+// its files are deleted unless another request of the batch uses them
+func discardUploads(servConf *ServConfig, ct context.Context, req *gqlReq) {
+	for _, f := range req.uploads {
+		if f.failed++; f.failed == f.reqs {
+			delUpload(servConf, ct, f)
+		}
+	}
+}
+
+func delUpload(servConf *ServConfig, ct context.Context, f *upload) {
+	if err := servConf.uploads.del(ct, f.key); err != nil {
+		servConf.log.Printf("WRN upload: failed to delete %s: %s", f.key, err)
+	}
+}
+
+// readFormField reads the next part which has to be the field
+func readFormField(mr *multipart.Reader, name string) ([]byte, error) {
+	part, err := mr.NextPart()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	defer part.Close()
+
+	if part.FormName() != name {
+		return nil, fmt.Errorf("upload: expected the %s field", name)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(part, maxReadBytes))
+}
+
+// storeUpload streams the file to the store with a new key, the mime type
+// is detected from its content when the client did not set it
+func storeUpload(servConf *ServConfig, ct context.Context, part *multipart.Part) (*upload, error) {
+	uc := &servConf.conf.Uploads
+
+	maxSize := uc.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultUploadMaxSize
+	}
+
+	br := bufio.NewReader(part)
+
+	mime := part.Header.Get("Content-Type")
+	if mime == "" || mime == "application/octet-stream" {
+		head, _ := br.Peek(512)
+		mime = http.DetectContentType(head)
+	}
+
+	var id [16]byte
+
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	f := &upload{
+		key:  hex.EncodeToString(id[:]) + uploadExt(part.FileName()),
+		name: part.FileName(),
+		mime: mime,
+	}
+
+	// the keys in the object storage have the prefix of the blobs config
+	if uc.Dir == "" {
+		f.key = servConf.conf.Blobs.Prefix + f.key
+	}
+	f.url = uc.BaseURL + f.key
+
+	sr := &sizeReader{r: br, max: maxSize}
+
+	if err := servConf.uploads.put(ct, f.key, mime, sr); err != nil {
+		if sr.n > sr.max {
+			return nil, errUploadSize
+		}
+		return nil, fmt.Errorf("upload: %w", err)
+	}
+	f.size = sr.n
+
+	return f, nil
+}
+
+// uploadExt returns the extension of the file name if it's a plain one
+func uploadExt(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+
+	if len(ext) < 2 || len(ext) > 10 {
+		return ""
+	}
+
+	for _, c := range ext[1:] {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// setUpload sets the url of the file at the path (eg. variables.data.file)
+// and its size, mime type, name and key next to it
+func setUpload(ops interface{}, path string, f *upload) error {
+	keys := strings.Split(path, ".")
+	v := ops
+
+	for i, k := range keys {
+		last := i == len(keys)-1
+
+		switch n := v.(type) {
+		case map[string]interface{}:
+			if _, ok := n[k]; !ok {
+				return fmt.Errorf("upload: invalid path: %s", path)
+			}
+			if !last {
+				v = n[k]
+				continue
+			}
+			n[k] = f.url
+			n[k+"_size"] = f.size
+			n[k+"_mime"] = f.mime
+			n[k+"_name"] = f.name
+			n[k+"_key"] = f.key
+
+		case []interface{}:
+			j, err := strconv.Atoi(k)
+			if err != nil || j < 0 || j >= len(n) {
+				return fmt.Errorf("upload: invalid path: %s", path)
+			}
+			if !last {
+				v = n[j]
+				continue
+			}
+			n[j] = f.url
+
+		default:
+			return fmt.Errorf("upload: invalid path: %s", path)
+		}
+	}
+
+	return nil
+}
+
+// sizeReader counts the bytes read and fails once there are more than max
+type sizeReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (s *sizeReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+
+	if s.n > s.max {
+		return n, errUploadSize
+	}
+	return n, err
+}
+
+// diskStore stores the files in a local directory
+type diskStore struct {
+	dir string
+}
+
+func (s diskStore) put(ct context.Context, key, mime string, r io.Reader) error {
+	f, err := ioutil.TempFile(s.dir, ".upload-")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(s.dir, key))
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (s diskStore) del(ct context.Context, key string) error {
+	return os.Remove(filepath.Join(s.dir, key))
+}
+
+// blobUploads stores the files in the object storage of the blobs config
+type blobUploads struct {
+	bs core.BlobStore
+}
+
+func (s blobUploads) put(ct context.Context, key, mime string, r io.Reader) error {
+	if rs, ok := s.bs.(core.BlobReaderStore); ok {
+		return rs.PutReader(ct, key, mime, r)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return s.bs.Put(ct, key, mime, b)
+}
+
+func (s blobUploads) del(ct context.Context, key string) error {
+	if ds, ok := s.bs.(core.BlobDeleteStore); ok {
+		return ds.Delete(ct, key)
+	}
+	return errors.New("the blob store can't delete files")
+}
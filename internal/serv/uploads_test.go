@@ -0,0 +1,213 @@
+package serv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dosco/super-graph/core"
+)
+
+const uploadsMockYAML = `
+tables:
+  - name: documents
+    columns:
+      - name: id
+        type: bigint
+        primary_key: true
+      - name: title
+        type: text
+      - name: file
+        type: text
+      - name: file_size
+        type: bigint
+      - name: file_mime
+        type: text
+      - name: file_name
+        type: text
+      - name: file_key
+        type: text
+`
+
+// setUploadsGraph sets a super graph with the documents table the
+// operations of the upload requests are checked against
+func setUploadsGraph(t *testing.T, dir string) {
+	fn := filepath.Join(dir, "mock.yml")
+
+	if err := ioutil.WriteFile(fn, []byte(uploadsMockYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := core.NewSuperGraph(&core.Config{
+		MockData:      fn,
+		AllowListFile: filepath.Join(dir, "allow.list"),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sg = g
+	t.Cleanup(func() { sg = nil })
+}
+
+func newUploadReq(t *testing.T, ops, fmap string, files ...[2]string) (string, *bytes.Buffer) {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+
+	if err := mw.WriteField("operations", ops); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.WriteField("map", fmap); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range files {
+		w, err := mw.CreateFormFile(f[0], f[0]+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return mw.FormDataContentType(), &b
+}
+
+func TestDecodeUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	setUploadsGraph(t, dir)
+
+	dir = filepath.Join(dir, "uploads")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	servConf := &ServConfig{conf: &Config{}, uploads: diskStore{dir: dir}}
+	servConf.conf.Uploads.BaseURL = "https://cdn.example.com/"
+	servConf.conf.Uploads.MaxSize = 10
+
+	ops := `{"query": "mutation ($data: json!) { documents(insert: $data) { id } }",
+		"variables": {"data": {"title": "Report", "file": null}}}`
+
+	ctype, body := newUploadReq(t, ops, `{"0": ["variables.data.file"]}`, [2]string{"0", "hello"})
+
+	r := httptest.NewRequest("POST", "/api/v1/graphql", body)
+	r.Header.Set("Content-Type", ctype)
+
+	if !isMultipart(r) {
+		t.Fatal("expected a multipart request")
+	}
+
+	ct := context.WithValue(context.Background(), core.UserIDKey, 1)
+
+	reqs, batch, err := decodeUpload(servConf, ct, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if batch || len(reqs) != 1 {
+		t.Fatalf("expected a single request")
+	}
+
+	var vars struct {
+		Data map[string]interface{}
+	}
+
+	if err := json.Unmarshal(reqs[0].Vars, &vars); err != nil {
+		t.Fatal(err)
+	}
+
+	d := vars.Data
+	key, _ := d["file_key"].(string)
+
+	if !strings.HasSuffix(key, ".txt") || d["file"] != "https://cdn.example.com/"+key {
+		t.Fatalf("unexpected file: %v", d)
+	}
+
+	if d["file_size"] != float64(5) || d["file_mime"] != "text/plain; charset=utf-8" ||
+		d["file_name"] != "0.txt" || d["title"] != "Report" {
+		t.Fatalf("unexpected file details: %v", d)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "hello" {
+		t.Fatalf("unexpected file content: %s", b)
+	}
+
+	errs := []struct {
+		fmap  string
+		files [][2]string
+		err   string
+	}{
+		{`{"0": ["variables.data.file"]}`, [][2]string{{"0", "more than ten bytes"}}, "file too large"},
+		{`{"0": ["variables.data.file"]}`, nil, "file 0 is missing"},
+		{`{"0": ["variables.data.other.file"]}`, [][2]string{{"0", "hi"}}, "invalid path"},
+		{`{}`, [][2]string{{"0", "hi"}}, "not in the map"},
+	}
+
+	for _, v := range errs {
+		ctype, body := newUploadReq(t, ops, v.fmap, v.files...)
+
+		r := httptest.NewRequest("POST", "/api/v1/graphql", body)
+		r.Header.Set("Content-Type", ctype)
+
+		if _, _, err := decodeUpload(servConf, ct, r); err == nil ||
+			!strings.Contains(err.Error(), v.err) {
+			t.Fatalf("%s: expected the error '%s' got %v", v.fmap, v.err, err)
+		}
+	}
+
+	// files are only stored for mutations the role can run
+	query := `{"query": "query { documents { id } }"}`
+
+	for _, v := range []struct {
+		ct  context.Context
+		ops string
+		err string
+	}{
+		{context.Background(), ops, "role 'anon' can't upload"},
+		{ct, query, errUploadOp.Error()},
+	} {
+		ctype, body := newUploadReq(t, v.ops, `{"0": ["variables.data.file"]}`, [2]string{"0", "hi"})
+
+		r := httptest.NewRequest("POST", "/api/v1/graphql", body)
+		r.Header.Set("Content-Type", ctype)
+
+		if _, _, err := decodeUpload(servConf, v.ct, r); err == nil ||
+			!strings.Contains(err.Error(), v.err) {
+			t.Fatalf("expected the error '%s' got %v", v.err, err)
+		}
+	}
+
+	// the files of a failed mutation are deleted
+	discardUploads(servConf, ct, &reqs[0])
+
+	if _, err := os.Stat(filepath.Join(dir, key)); !os.IsNotExist(err) {
+		t.Fatalf("expected the file to be deleted got: %v", err)
+	}
+
+	// the files stored before an error were deleted with it
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 0 {
+		t.Fatalf("expected no files got: %v (%v)", files, err)
+	}
+}
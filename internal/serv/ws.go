@@ -3,12 +3,16 @@ package serv
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/dosco/super-graph/core"
 	"github.com/dosco/super-graph/internal/serv/internal/auth"
+	"github.com/dosco/super-graph/jsn"
 	ws "github.com/gorilla/websocket"
+	"go.uber.org/zap"
 )
 
 type gqlWsReq struct {
@@ -21,7 +25,8 @@ type gqlWsResp struct {
 	ID      string `json:"id"`
 	Type    string `json:"type"`
 	Payload struct {
-		Data   json.RawMessage `json:"data"`
+		Data   json.RawMessage `json:"data,omitempty"`
+		Patch  []jsn.PatchOp   `json:"patch,omitempty"`
 		Errors []string        `json:"errors,omitempty"`
 	} `json:"payload"`
 }
@@ -31,12 +36,74 @@ type gqlWsError struct {
 	Type    string `json:"type"`
 	Payload struct {
 		Error string `json:"error"`
+		Code  string `json:"code,omitempty"`
 	} `json:"payload"`
 }
 
+// gqlWsErrors is an error in the graphql-transport-ws protocol
+type gqlWsErrors struct {
+	ID      string              `json:"id"`
+	Type    string              `json:"type"`
+	Payload []core.GraphQLError `json:"payload"`
+}
+
+type gqlWsMsg struct {
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type"`
+}
+
+// wsProto has the message types that differ between the graphql-ws
+// (subscriptions-transport-ws) and graphql-transport-ws subprotocols
+type wsProto struct {
+	start, stop, data string
+	errors            bool
+}
+
+var (
+	graphqlWs          = wsProto{start: "start", stop: "stop", data: "data"}
+	graphqlTransportWs = wsProto{start: "subscribe", stop: "complete", data: "next", errors: true}
+)
+
 type wsConnInit struct {
-	Type    string            `json:"type,omitempty"`
-	Payload map[string]string `json:"payload,omitempty"`
+	Type    string                     `json:"type,omitempty"`
+	Payload map[string]json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsConn is a websocket connection written to by the reader loop and
+// the subscriptions, gorilla/websocket only allows one writer at a time
+type wsConn struct {
+	*ws.Conn
+	mu sync.Mutex
+}
+
+func (c *wsConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+func (c *wsConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteJSON(v)
+}
+
+func (c *wsConn) WritePreparedMessage(pm *ws.PreparedMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WritePreparedMessage(pm)
+}
+
+// wsSub is a subscription of a connection, the protocols run
+// many of them on a connection keyed by the id of the start message
+type wsSub struct {
+	m    *core.Member
+	done chan bool
+}
+
+func (s wsSub) stop() {
+	s.m.Unsubscribe()
+	close(s.done)
 }
 
 var upgrader = ws.Upgrader{
@@ -44,7 +111,7 @@ var upgrader = ws.Upgrader{
 	ReadBufferSize:    1024,
 	WriteBufferSize:   1024,
 	HandshakeTimeout:  10 * time.Second,
-	Subprotocols:      []string{"graphql-ws"},
+	Subprotocols:      []string{"graphql-transport-ws", "graphql-ws"},
 	CheckOrigin:       func(r *http.Request) bool { return true },
 }
 
@@ -63,27 +130,37 @@ func init() {
 }
 
 func apiV1Ws(servConf *ServConfig, w http.ResponseWriter, r *http.Request) {
-	var m *core.Member
-	var run bool
-
 	ctx := r.Context()
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	c, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		renderErr(w, err)
 		return
 	}
-	defer conn.Close()
+	defer c.Close()
+
+	conn := &wsConn{Conn: c}
+
+	wsConns.Add(1)
+	defer wsConns.Done()
+
+	proto := graphqlWs
+	if conn.Subprotocol() == "graphql-transport-ws" {
+		proto = graphqlTransportWs
+	}
 
 	var msg gqlWsReq
+	var id string
 	var b []byte
 
-	done := make(chan bool)
+	subs := make(map[string]wsSub)
 
 	for {
 		if _, b, err = conn.ReadMessage(); err != nil {
 			break
 		}
+		msg = gqlWsReq{}
+
 		if err = json.Unmarshal(b, &msg); err != nil {
 			servConf.log.Println(err)
 			continue
@@ -105,32 +182,68 @@ func apiV1Ws(servConf *ServConfig, w http.ResponseWriter, r *http.Request) {
 				break
 			}
 
-			for k, v := range initReq.Payload {
+			for k, v := range initHeaders(initReq.Payload) {
 				r.Header.Set(k, v)
 			}
 			handler.ServeHTTP(w, r)
 
-		case "start":
-			if run {
+		case "ping":
+			err = conn.WriteJSON(gqlWsMsg{Type: "pong"})
+
+		case proto.start:
+			var query string
+			var m *core.Member
+
+			if id = msg.ID; id == "" {
+				id = "1"
+			}
+
+			if _, ok := subs[id]; ok {
+				err = sendError(conn, id, proto, fmt.Errorf("subscription: id '%s' already in use", id))
 				continue
 			}
-			m, err = sg.Subscribe(ctx, msg.Payload.Query, msg.Payload.Vars)
+
+			msg.Payload.normalize()
+
+			query, err = reqQuery(ctx, &msg.Payload)
 			if err == nil {
-				go waitForData(servConf, done, conn, m)
-				run = true
+				m, err = graph().Subscribe(ctx, query, msg.Payload.Vars)
+
+				if admin, ok := auth.Impersonator(ctx); ok {
+					auditLog(servConf, ctx, admin,
+						zap.String("op", "subscription"),
+						zap.String("query", query))
+				}
+			}
+
+			// a failed subscription is sent an error, the
+			// connection and its other subscriptions are kept
+			if err != nil {
+				addRecentError(msg.Payload.OpName, err)
+				err = sendError(conn, id, proto, err)
+				continue
 			}
 
-		case "stop":
-			m.Unsubscribe()
-			done <- true
-			run = false
+			sub := wsSub{m: m, done: make(chan bool)}
+			subs[id] = sub
+			go waitForData(servConf, sub.done, conn, m, id, proto, wantsPatch(msg.Payload.Extensions))
+
+		case proto.stop:
+			if id = msg.ID; id == "" {
+				id = "1"
+			}
+			if sub, ok := subs[id]; ok {
+				sub.stop()
+				delete(subs, id)
+			}
 
 		default:
 			servConf.log.Println("subscription: unknown type: ", msg.Type)
 		}
 
 		if err != nil {
-			err = sendError(conn, err)
+			addRecentError(msg.Payload.OpName, err)
+			err = sendError(conn, id, proto, err)
 			break
 		}
 	}
@@ -139,11 +252,18 @@ func apiV1Ws(servConf *ServConfig, w http.ResponseWriter, r *http.Request) {
 		servConf.log.Printf("ERR %s", err)
 	}
 
-	m.Unsubscribe()
+	for _, sub := range subs {
+		sub.stop()
+	}
 }
 
-func waitForData(servConf *ServConfig, done chan bool, conn *ws.Conn, m *core.Member) {
+// waitForData sends the results of the subscription, with patch set only the first
+// result is sent in full and then the changes to it as a JSON Patch (RFC 6902)
+func waitForData(servConf *ServConfig, done chan bool, conn *wsConn, m *core.Member,
+	id string, proto wsProto, patch bool) {
+
 	var buf bytes.Buffer
+	var prev json.RawMessage
 	var err error
 
 	enc := json.NewEncoder(&buf)
@@ -151,13 +271,20 @@ func waitForData(servConf *ServConfig, done chan bool, conn *ws.Conn, m *core.Me
 	for {
 		select {
 		case v := <-m.Result:
-			res := gqlWsResp{ID: "1", Type: "data"}
+			res := gqlWsResp{ID: id, Type: proto.data}
 			res.Payload.Data = v.Data
 
 			if v.Error != "" {
 				res.Payload.Errors = []string{v.Error}
 			}
 
+			if patch && v.Error == "" {
+				if prev != nil {
+					res.Payload.Patch, res.Payload.Data = patchData(prev, v.Data)
+				}
+				prev = v.Data
+			}
+
 			if err = enc.Encode(res); err != nil {
 				continue
 			}
@@ -167,14 +294,12 @@ func waitForData(servConf *ServConfig, done chan bool, conn *ws.Conn, m *core.Me
 			if err = conn.WriteMessage(ws.TextMessage, msg); err != nil {
 				continue
 			}
-		case v := <-done:
-			if v {
-				return
-			}
+		case <-done:
+			return
 		}
 
 		if err != nil {
-			err = sendError(conn, err)
+			err = sendError(conn, id, proto, err)
 			break
 		}
 	}
@@ -184,9 +309,36 @@ func waitForData(servConf *ServConfig, done chan bool, conn *ws.Conn, m *core.Me
 	}
 }
 
-func sendError(conn *ws.Conn, err error) error {
-	res := gqlWsError{ID: "1", Type: "error"}
-	res.Payload.Error = err.Error()
+// patchData returns the patch from the previous result to the new one,
+// the new result is returned instead when the patch is not smaller
+func patchData(prev, data json.RawMessage) ([]jsn.PatchOp, json.RawMessage) {
+	ops, err := jsn.Diff(prev, data)
+	if err != nil || len(ops) == 0 {
+		return nil, data
+	}
+
+	if b, err := json.Marshal(ops); err != nil || len(b) >= len(data) {
+		return nil, data
+	}
+
+	return ops, nil
+}
+
+func sendError(conn *wsConn, id string, proto wsProto, err error) error {
+	var res interface{}
+
+	if id == "" {
+		id = "1"
+	}
+
+	if proto.errors {
+		res = gqlWsErrors{ID: id, Type: "error", Payload: core.GraphQLErrors(err)}
+	} else {
+		e := gqlWsError{ID: id, Type: "error"}
+		e.Payload.Error = err.Error()
+		e.Payload.Code = core.ErrorCode(err)
+		res = e
+	}
 
 	msg, err := json.Marshal(res)
 	if err != nil {
@@ -0,0 +1,104 @@
+package serv
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	ws "github.com/gorilla/websocket"
+)
+
+func TestWsConnWrites(t *testing.T) {
+	const n = 100
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+
+		conn := &wsConn{Conn: c}
+
+		// the pongs of the reader loop and the results of the
+		// subscriptions are written at the same time
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				conn.WriteJSON(gqlWsMsg{Type: "pong"}) //nolint: errcheck
+			}()
+			go func() {
+				defer wg.Done()
+				conn.WriteMessage(ws.TextMessage, []byte(`{"type":"next"}`)) //nolint: errcheck
+			}()
+		}
+		wg.Wait()
+	}))
+	defer srv.Close()
+
+	c, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 2*n; i++ {
+		var msg gqlWsMsg
+		if err := c.ReadJSON(&msg); err != nil {
+			t.Fatalf("message %d: %s", i, err)
+		}
+		if msg.Type != "pong" && msg.Type != "next" {
+			t.Fatalf("unexpected message: %+v", msg)
+		}
+	}
+}
+
+func TestWsStartError(t *testing.T) {
+	setUploadsGraph(t, t.TempDir())
+
+	servConf := &ServConfig{log: log.New(ioutil.Discard, "", 0), conf: &Config{}}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiV1Ws(servConf, w, r)
+	}))
+	defer srv.Close()
+
+	c, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.WriteJSON(map[string]interface{}{
+		"id": "1", "type": "start", "payload": map[string]string{"query": "subscription { bad"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg gqlWsMsg
+	if err := c.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "error" || msg.ID != "1" {
+		t.Fatalf("expected an error for the subscription got: %+v", msg)
+	}
+
+	// the connection is kept open after the error
+	if err := c.WriteJSON(gqlWsMsg{Type: "ping"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "pong" {
+		t.Fatalf("expected a pong got: %+v", msg)
+	}
+}
@@ -0,0 +1,144 @@
+package jsn
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatchOp is an operation of a JSON Patch (RFC 6902)
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Diff function returns the JSON Patch (RFC 6902) that changes a into b. Objects are
+// compared key by key and arrays by index, items added or removed at the end of an
+// array are added or removed while other changes replace the item.
+func Diff(a, b []byte) ([]PatchOp, error) {
+	va, err := decode(a)
+	if err != nil {
+		return nil, err
+	}
+
+	vb, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffVal(nil, "", va, vb), nil
+}
+
+func decode(b []byte) (interface{}, error) {
+	var v interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func diffVal(ops []PatchOp, path string, a, b interface{}) []PatchOp {
+	switch va := a.(type) {
+	case map[string]interface{}:
+		if vb, ok := b.(map[string]interface{}); ok {
+			return diffObj(ops, path, va, vb)
+		}
+
+	case []interface{}:
+		if vb, ok := b.([]interface{}); ok {
+			return diffArr(ops, path, va, vb)
+		}
+
+	default:
+		if reflect.DeepEqual(a, b) {
+			return ops
+		}
+	}
+
+	return append(ops, PatchOp{Op: "replace", Path: path, Value: nullable(b)})
+}
+
+func diffObj(ops []PatchOp, path string, a, b map[string]interface{}) []PatchOp {
+	// sorted so the patch is the same for the same change
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := path + "/" + escapeKey(k)
+		va, inA := a[k]
+		vb, inB := b[k]
+
+		switch {
+		case !inB:
+			ops = append(ops, PatchOp{Op: "remove", Path: p})
+		case !inA:
+			ops = append(ops, PatchOp{Op: "add", Path: p, Value: nullable(vb)})
+		default:
+			ops = diffVal(ops, p, va, vb)
+		}
+	}
+
+	return ops
+}
+
+func diffArr(ops []PatchOp, path string, a, b []interface{}) []PatchOp {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+
+	for i := 0; i < n; i++ {
+		ops = diffVal(ops, path+"/"+strconv.Itoa(i), a[i], b[i])
+	}
+
+	// removed from the end first so the indexes stay valid
+	for i := len(a) - 1; i >= n; i-- {
+		ops = append(ops, PatchOp{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+	}
+
+	for i := n; i < len(b); i++ {
+		ops = append(ops, PatchOp{Op: "add", Path: path + "/-", Value: nullable(b[i])})
+	}
+
+	return ops
+}
+
+// escapeKey escapes the key for a JSON Pointer (RFC 6901)
+func escapeKey(k string) string {
+	if strings.IndexAny(k, "~/") == -1 {
+		return k
+	}
+	k = strings.Replace(k, "~", "~0", -1)
+	return strings.Replace(k, "/", "~1", -1)
+}
+
+// jsonNull keeps null values in the patch since
+// the value field is left out when it's nil
+type jsonNull struct{}
+
+func (jsonNull) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+func nullable(v interface{}) interface{} {
+	if v == nil {
+		return jsonNull{}
+	}
+	return v
+}
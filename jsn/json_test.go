@@ -2,6 +2,7 @@ package jsn_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"strings"
@@ -641,3 +642,35 @@ func BenchmarkTest(b *testing.B) {
 
 	fmt.Println(">", test)
 }
+
+func TestDiff(t *testing.T) {
+	a := `{"products": [{"id": 1, "name": "a"}, {"id": 2, "name": "b"}, {"id": 3}], "a/b": 1, "old": true}`
+	b := `{"products": [{"id": 1, "name": "c"}, {"id": 2, "name": "b"}], "a/b": null, "new": 1.50}`
+
+	ops, err := jsn.Diff([]byte(a), []byte(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := json.Marshal(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `[{"op":"replace","path":"/a~1b","value":null},{"op":"add","path":"/new","value":1.50},` +
+		`{"op":"remove","path":"/old"},{"op":"replace","path":"/products/0/name","value":"c"},` +
+		`{"op":"remove","path":"/products/2"}]`
+
+	if string(p) != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, p)
+	}
+
+	ops, err = jsn.Diff([]byte(b), []byte(`{"products": [{"id": 1, "name": "c"}, {"id": 2, "name": "b"}, {"id": 4}], "a/b": null, "new": 1.50}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p, _ = json.Marshal(ops); string(p) != `[{"op":"add","path":"/products/-","value":{"id":4}}]` {
+		t.Fatalf("unexpected patch: %s", p)
+	}
+}